@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"encoding/csv"
 	"encoding/json"
@@ -22,6 +23,8 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/parquet-go/parquet-go"
 )
 
 type Config struct {
@@ -38,7 +41,11 @@ type Config struct {
 	AppendTimestamp bool
 	TimestampFormat string
 	CentroidFile    string
+	CentroidFormat  string
+	SamplesFormat   string
 	Seed            int64
+	HotCenters      string
+	HotFraction     float64
 }
 
 func loadConfig() Config {
@@ -55,8 +62,12 @@ func loadConfig() Config {
 	flag.DurationVar(&cfg.RequestTimeout, "timeout", 10*time.Second, "Per-request timeout")
 	flag.BoolVar(&cfg.AppendTimestamp, "append-ts", true, "Append timestamp to output prefix")
 	flag.StringVar(&cfg.TimestampFormat, "ts-format", "iso", "Timestamp format: iso|unix|none")
-	flag.StringVar(&cfg.CentroidFile, "centroids", "", "Optional centroid CSV file (id,lon,lat) to drive BBOXes")
+	flag.StringVar(&cfg.CentroidFile, "centroids", "", "Optional centroid file (id,lon,lat) to drive BBOXes")
+	flag.StringVar(&cfg.CentroidFormat, "centroids-format", "csv", "Centroid file format: csv|parquet")
+	flag.StringVar(&cfg.SamplesFormat, "samples-format", "csv", "Per-request sample output format: csv|jsonl")
 	flag.Int64Var(&cfg.Seed, "seed", 0, "RNG seed (0 = time-based)")
+	flag.StringVar(&cfg.HotCenters, "hot-centers", "", "Hot-region centers as lon,lat[;lon,lat...] (default: four Swedish cities)")
+	flag.Float64Var(&cfg.HotFraction, "hot-fraction", 0.25, "Fraction of synthetic BBOXes placed around hot centers, in [0,1]")
 	flag.Parse()
 	return cfg
 }
@@ -68,17 +79,62 @@ func (b BBox) String() string {
 	return fmt.Sprintf("%.5f,%.5f,%.5f,%.5f,EPSG:4326", b.X1, b.Y1, b.X2, b.Y2)
 }
 
-// creates a mix of "hot" and "cold" bounding boxes for testing.
-func makeBBoxes(count int, r *rand.Rand) []BBox {
-	centers := [][2]float64{
-		{18.0686, 59.3293}, // Stockholm
-		{11.9746, 57.7089}, // Göteborg
-		{13.0038, 55.6050}, // Malmö
-		{22.1547, 65.5848}, // Luleå
+// Swedish city centers used for hot boxes when -hot-centers is unset
+var defaultHotCenters = [][2]float64{
+	{18.0686, 59.3293}, // Stockholm
+	{11.9746, 57.7089}, // Göteborg
+	{13.0038, 55.6050}, // Malmö
+	{22.1547, 65.5848}, // Luleå
+}
+
+// parses "lon,lat;lon,lat"; empty yields nil, meaning the Swedish defaults
+func parseHotCenters(s string) ([][2]float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	var out [][2]float64
+	for part := range strings.SplitSeq(s, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		lonStr, latStr, ok := strings.Cut(part, ",")
+		if !ok {
+			return nil, fmt.Errorf("hot center %q: want lon,lat", part)
+		}
+		lon, err := strconv.ParseFloat(strings.TrimSpace(lonStr), 64)
+		if err != nil || lon < -180 || lon > 180 {
+			return nil, fmt.Errorf("hot center %q: invalid lon", part)
+		}
+		lat, err := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+		if err != nil || lat < -90 || lat > 90 {
+			return nil, fmt.Errorf("hot center %q: invalid lat", part)
+		}
+		out = append(out, [2]float64{lon, lat})
+	}
+	if len(out) == 0 {
+		return nil, errors.New("no hot centers given")
+	}
+	return out, nil
+}
+
+// creates a mix of "hot" boxes around centers and "cold" boxes spread over the
+// region they span; hotFraction of count (at least 8 when positive) are hot.
+// No centers means the Swedish defaults with cold boxes over all of sweden
+func makeBBoxes(count int, r *rand.Rand, centers [][2]float64, hotFraction float64) []BBox {
+	minLon, minLat, maxLon, maxLat := 11.0, 55.0, 24.0, 66.0
+	if len(centers) == 0 {
+		centers = defaultHotCenters
+	} else {
+		minLon, minLat, maxLon, maxLat = coldRegion(centers)
 	}
 	bboxes := make([]BBox, 0, count)
 
-	hotBoxCount := int(math.Max(8, float64(count/4))) // at least 8 hot boxes
+	hotBoxCount := int(math.Round(float64(count) * hotFraction))
+	if hotFraction > 0 {
+		hotBoxCount = max(hotBoxCount, min(8, count)) // at least 8 hot boxes
+	}
 
 	// generate "hot" boxes around centers
 	for i := range hotBoxCount {
@@ -89,16 +145,27 @@ func makeBBoxes(count int, r *rand.Rand) []BBox {
 		bboxes = append(bboxes, BBox{lon - w/2, lat - h/2, lon + w/2, lat + h/2}) // create box
 	}
 
-	// generate remaining "cold" boxes randomly over sweden
+	// generate remaining "cold" boxes randomly over the region
 	for len(bboxes) < count {
-		lon := 11 + r.Float64()*(24-11)                                           // random lon
-		lat := 55 + r.Float64()*(66-55)                                           // random lat
+		lon := minLon + r.Float64()*(maxLon-minLon)                               // random lon
+		lat := minLat + r.Float64()*(maxLat-minLat)                               // random lat
 		w, h := 0.2*r.Float64()+0.05, 0.2*r.Float64()+0.05                        // random size
 		bboxes = append(bboxes, BBox{lon - w/2, lat - h/2, lon + w/2, lat + h/2}) // create box
 	}
 	return bboxes
 }
 
+// the centers' extent padded by a degree on each side
+func coldRegion(centers [][2]float64) (minLon, minLat, maxLon, maxLat float64) {
+	minLon, minLat, maxLon, maxLat = 180, 90, -180, -90
+	for _, c := range centers {
+		minLon, maxLon = math.Min(minLon, c[0]), math.Max(maxLon, c[0])
+		minLat, maxLat = math.Min(minLat, c[1]), math.Max(maxLat, c[1])
+	}
+	const pad = 1.0
+	return math.Max(minLon-pad, -180), math.Max(minLat-pad, -90), math.Min(maxLon+pad, 180), math.Min(maxLat+pad, 90)
+}
+
 type Centroid struct {
 	ID  string
 	Lon float64
@@ -164,6 +231,54 @@ func loadCentroidsCSV(path string) ([]Centroid, error) {
 	return out, nil
 }
 
+// parquet row layout for centroid files (columns id, lon, lat)
+type centroidRow struct {
+	ID  string  `parquet:"id"`
+	Lon float64 `parquet:"lon"`
+	Lat float64 `parquet:"lat"`
+}
+
+func loadCentroidsParquet(path string) ([]Centroid, error) {
+	rows, err := parquet.ReadFile[centroidRow](filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("read centroids parquet: %w", err)
+	}
+	out := make([]Centroid, 0, len(rows))
+	for _, row := range rows {
+		id := strings.TrimSpace(row.ID)
+		if id == "" {
+			continue
+		}
+		out = append(out, Centroid{ID: id, Lon: row.Lon, Lat: row.Lat})
+	}
+	return out, nil
+}
+
+// loads centroids in the given format, defaulting to CSV
+func loadCentroids(path, format string) ([]Centroid, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "parquet":
+		return loadCentroidsParquet(path)
+	case "", "csv":
+		return loadCentroidsCSV(path)
+	default:
+		return nil, fmt.Errorf("unsupported centroids format %q (want csv|parquet)", format)
+	}
+}
+
+// effectiveSeed returns seed, or a time-based one when seed is 0
+func effectiveSeed(seed int64) int64 {
+	if seed == 0 {
+		return time.Now().UnixNano()
+	}
+	return seed
+}
+
+// workerZipf returns worker id's bbox index stream, fixed by seed
+func workerZipf(seed int64, id int, s, v float64, imax uint64) *rand.Zipf {
+	return rand.NewZipf(rand.New(rand.NewSource(seed+int64(id)+1)), s, v, imax)
+}
+
 func makeBBoxesFromCentroids(centroids []Centroid, count int) []BBox {
 	if len(centroids) == 0 || count <= 0 {
 		return nil
@@ -197,6 +312,115 @@ type sample struct {
 	BBoxStr   string
 }
 
+// writes per-request samples as they arrive
+type sampleWriter interface {
+	Write(s sample) error
+	Close() error
+}
+
+type csvSampleWriter struct {
+	f *os.File
+	w *csv.Writer
+}
+
+func (c *csvSampleWriter) Write(s sample) error {
+	if err := c.w.Write([]string{
+		s.Timestamp.UTC().Format(time.RFC3339Nano),
+		fmt.Sprintf("%.3f", float64(s.Latency.Microseconds())/1000.0),
+		fmt.Sprintf("%d", s.Status),
+		s.ErrorMsg,
+		fmt.Sprintf("%d", s.BoxIndex),
+		s.BBoxStr,
+	}); err != nil {
+		return fmt.Errorf("write csv sample: %w", err)
+	}
+	return nil
+}
+
+func (c *csvSampleWriter) Close() error {
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		_ = c.f.Close()
+		return fmt.Errorf("csv flush: %w", err)
+	}
+	if err := c.f.Close(); err != nil {
+		return fmt.Errorf("close csv: %w", err)
+	}
+	return nil
+}
+
+type jsonlSample struct {
+	Timestamp string  `json:"timestamp"`
+	LatencyMs float64 `json:"latency_ms"`
+	Status    int     `json:"status"`
+	Error     string  `json:"error,omitempty"`
+	BBoxIdx   int     `json:"bbox_idx"`
+	BBox      string  `json:"bbox"`
+}
+
+// one JSON object per line, flushed per sample so the file can be tailed live
+type jsonlSampleWriter struct {
+	f   *os.File
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func (j *jsonlSampleWriter) Write(s sample) error {
+	if err := j.enc.Encode(jsonlSample{
+		Timestamp: s.Timestamp.UTC().Format(time.RFC3339Nano),
+		LatencyMs: float64(s.Latency.Microseconds()) / 1000.0,
+		Status:    s.Status,
+		Error:     s.ErrorMsg,
+		BBoxIdx:   s.BoxIndex,
+		BBox:      s.BBoxStr,
+	}); err != nil {
+		return fmt.Errorf("write jsonl sample: %w", err)
+	}
+	if err := j.buf.Flush(); err != nil {
+		return fmt.Errorf("flush jsonl: %w", err)
+	}
+	return nil
+}
+
+func (j *jsonlSampleWriter) Close() error {
+	if err := j.buf.Flush(); err != nil {
+		_ = j.f.Close()
+		return fmt.Errorf("flush jsonl: %w", err)
+	}
+	if err := j.f.Close(); err != nil {
+		return fmt.Errorf("close jsonl: %w", err)
+	}
+	return nil
+}
+
+// opens the samples file for the given format; returns the writer and its path
+func newSampleWriter(prefix, format string) (sampleWriter, string, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "jsonl":
+		path := prefix + "_samples.jsonl"
+		f, err := os.Create(filepath.Clean(path))
+		if err != nil {
+			return nil, path, fmt.Errorf("open jsonl: %w", err)
+		}
+		buf := bufio.NewWriter(f)
+		return &jsonlSampleWriter{f: f, buf: buf, enc: json.NewEncoder(buf)}, path, nil
+	case "", "csv":
+		path := prefix + "_samples.csv"
+		f, err := os.Create(filepath.Clean(path))
+		if err != nil {
+			return nil, path, fmt.Errorf("open csv: %w", err)
+		}
+		w := csv.NewWriter(f)
+		if err := w.Write([]string{"timestamp", "latency_ms", "status", "error", "bbox_idx", "bbox"}); err != nil {
+			_ = f.Close()
+			return nil, path, fmt.Errorf("write csv header: %w", err)
+		}
+		return &csvSampleWriter{f: f, w: w}, path, nil
+	default:
+		return nil, "", fmt.Errorf("unsupported samples format %q (want csv|jsonl)", format)
+	}
+}
+
 type summary struct {
 	StartTime             time.Time `json:"start"`
 	EndTime               time.Time `json:"end"`
@@ -246,16 +470,15 @@ func main() {
 		}
 	}
 
-	// precompute random workload
-	seedUsed := cfg.Seed
-	if seedUsed == 0 {
-		seedUsed = time.Now().UnixNano()
-	}
+	// precompute random workload; the seed alone fixes the bbox pool and every
+	// worker's request stream, so two builds can be compared on one sequence
+	seedUsed := effectiveSeed(cfg.Seed)
 	r := rand.New(rand.NewSource(seedUsed))
+	log.Printf("seed=%d", seedUsed)
 
 	var bboxes []BBox
 	if strings.TrimSpace(cfg.CentroidFile) != "" {
-		centroids, err := loadCentroidsCSV(cfg.CentroidFile)
+		centroids, err := loadCentroids(cfg.CentroidFile, cfg.CentroidFormat)
 		if err != nil {
 			log.Printf("WARN: failed to load centroids from %q: %v; falling back to synthetic BBOXes", cfg.CentroidFile, err)
 		} else {
@@ -266,7 +489,14 @@ func main() {
 
 	// fallback if centroids disabled or failed
 	if len(bboxes) == 0 {
-		bboxes = makeBBoxes(cfg.BBoxCount, r)
+		centers, err := parseHotCenters(cfg.HotCenters)
+		if err != nil {
+			log.Fatalf("invalid -hot-centers: %v", err)
+		}
+		if cfg.HotFraction < 0 || cfg.HotFraction > 1 {
+			log.Fatalf("invalid -hot-fraction %v: want a value in [0,1]", cfg.HotFraction)
+		}
+		bboxes = makeBBoxes(cfg.BBoxCount, r, centers, cfg.HotFraction)
 		log.Printf("using %d synthetic BBOXes", len(bboxes))
 	}
 
@@ -358,21 +588,17 @@ func main() {
 	}
 
 	// Prepare output files
-	csvPath := prefix + "_samples.csv"
 	jsonPath := prefix + "_summary.json"
-	csvFile, err := os.Create(filepath.Clean(csvPath))
+	samplesOut, samplesPath, err := newSampleWriter(prefix, cfg.SamplesFormat)
 	if err != nil {
-		log.Printf("open csv: %v", err)
+		log.Printf("samples output: %v", err)
 		return
 	}
-	defer func() { _ = csvFile.Close() }()
-	csvWriter := csv.NewWriter(csvFile)
 
 	// Collects results asynchronously
 	samplesChan := make(chan sample, 4096)
 	resultsChan := make(chan aggregatedResult, 1)
 	go func() {
-		_ = csvWriter.Write([]string{"timestamp", "latency_ms", "status", "error", "bbox_idx", "bbox"})
 		var total, successCount, errorCount int64
 		latencies := make([]float64, 0, 1<<20)
 		for s := range samplesChan {
@@ -383,18 +609,10 @@ func main() {
 			} else {
 				errorCount++
 			}
-			_ = csvWriter.Write([]string{
-				s.Timestamp.UTC().Format(time.RFC3339Nano),
-				fmt.Sprintf("%.3f", float64(s.Latency.Microseconds())/1000.0),
-				fmt.Sprintf("%d", s.Status),
-				s.ErrorMsg,
-				fmt.Sprintf("%d", s.BoxIndex),
-				s.BBoxStr,
-			})
+			_ = samplesOut.Write(s)
 		}
-		csvWriter.Flush()
-		if err := csvWriter.Error(); err != nil {
-			log.Printf("csv flush error: %v", err)
+		if err := samplesOut.Close(); err != nil {
+			log.Printf("samples close error: %v", err)
 		}
 		resultsChan <- aggregatedResult{total: total, success: successCount, errors: errorCount, latMs: latencies}
 	}()
@@ -411,8 +629,7 @@ func main() {
 		go func(id int) {
 			defer wg.Done()
 
-			rWorker := rand.New(rand.NewSource(seedUsed + int64(id) + 1))
-			zipfDist := rand.NewZipf(rWorker, cfg.ZipfS, cfg.ZipfV, imax)
+			zipfDist := workerZipf(seedUsed, id, cfg.ZipfS, cfg.ZipfV, imax)
 			for {
 				select {
 				case <-ctx.Done():
@@ -538,7 +755,7 @@ func main() {
 
 	log.Printf("done: total=%d succ=%d err=%d thr=%.2f rps p50=%.1fms p95=%.1fms p99=%.1fms",
 		aggResult.total, aggResult.success, aggResult.errors, runSummary.ThroughputRPS, p50, p95, p99)
-	log.Printf("wrote %s and %s", jsonPath, csvPath)
+	log.Printf("wrote %s and %s", jsonPath, samplesPath)
 }
 
 func percentile(sortedValues []float64, p float64) float64 {
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestLoadCentroids_Parquet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "centroids.parquet")
+	rows := []centroidRow{
+		{ID: "a", Lon: 18.0686, Lat: 59.3293},
+		{ID: "", Lon: 0, Lat: 0},
+		{ID: "b", Lon: 11.9746, Lat: 57.7089},
+	}
+	if err := parquet.WriteFile(path, rows); err != nil {
+		t.Fatalf("write parquet: %v", err)
+	}
+
+	got, err := loadCentroids(path, "parquet")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("centroids=%d want 2", len(got))
+	}
+	if got[0].ID != "a" || got[0].Lon != 18.0686 || got[0].Lat != 59.3293 {
+		t.Fatalf("first centroid=%+v", got[0])
+	}
+	if got[1].ID != "b" {
+		t.Fatalf("second centroid=%+v", got[1])
+	}
+}
+
+func TestLoadCentroids_UnknownFormat(t *testing.T) {
+	if _, err := loadCentroids("x", "xlsx"); err == nil {
+		t.Fatalf("expected error for unknown format")
+	}
+}
+
+func TestSampleWriter_JSONL(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "run")
+	w, path, err := newSampleWriter(prefix, "jsonl")
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := w.Write(sample{Timestamp: ts, Latency: 1500 * time.Microsecond, Status: 200, BoxIndex: 3}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	// flushed per sample, readable before Close
+	b, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var got jsonlSample
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("decode %q: %v", b, err)
+	}
+	if got.LatencyMs != 1.5 || got.Status != 200 || got.BBoxIdx != 3 || got.Timestamp != "2024-01-01T00:00:00Z" {
+		t.Fatalf("sample=%+v", got)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+}
+
+func TestMakeBBoxes_HotBoxesClusterAroundCenters(t *testing.T) {
+	centers, err := parseHotCenters("-73.9857,40.7484; 2.3522,48.8566")
+	if err != nil {
+		t.Fatalf("parse centers: %v", err)
+	}
+	boxes := makeBBoxes(100, rand.New(rand.NewSource(1)), centers, 0.4)
+	if len(boxes) != 100 {
+		t.Fatalf("boxes=%d want 100", len(boxes))
+	}
+
+	// hot boxes come first, cycling through the centers
+	for i, b := range boxes[:40] {
+		c := centers[i%len(centers)]
+		lon, lat := (b.X1+b.X2)/2, (b.Y1+b.Y2)/2
+		if math.Abs(lon-c[0]) > 0.1 || math.Abs(lat-c[1]) > 0.1 {
+			t.Fatalf("hot box %d center (%.4f,%.4f) not within 0.1° of %v", i, lon, lat, c)
+		}
+	}
+	// cold boxes stay inside the padded extent of the centers, not sweden
+	for i, b := range boxes[40:] {
+		lon, lat := (b.X1+b.X2)/2, (b.Y1+b.Y2)/2
+		if lon < -75 || lon > 3.4 || lat < 39.7 || lat > 49.9 {
+			t.Fatalf("cold box %d center (%.4f,%.4f) outside the centers' region", i, lon, lat)
+		}
+	}
+}
+
+func TestParseHotCenters(t *testing.T) {
+	if got, err := parseHotCenters(""); err != nil || got != nil {
+		t.Fatalf("empty: got %v err=%v, want nil for the defaults", got, err)
+	}
+	for _, bad := range []string{"18.0", "200,10", "10,95", "a,b", ";"} {
+		if _, err := parseHotCenters(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestSeed_ReproducesBBoxPoolAndWorkerStreams(t *testing.T) {
+	centers, err := parseHotCenters("")
+	if err != nil {
+		t.Fatalf("parse centers: %v", err)
+	}
+	pool := func(seed int64) []BBox {
+		return makeBBoxes(64, rand.New(rand.NewSource(effectiveSeed(seed))), centers, 0.25)
+	}
+	stream := func(seed int64, id int) []uint64 {
+		z := workerZipf(seed, id, 1.3, 1.0, 63)
+		out := make([]uint64, 32)
+		for i := range out {
+			out[i] = z.Uint64()
+		}
+		return out
+	}
+
+	a, b := pool(42), pool(42)
+	if !slices.Equal(a, b) {
+		t.Fatalf("same seed produced different bbox pools")
+	}
+	if slices.Equal(a, pool(43)) {
+		t.Fatalf("different seeds produced the same bbox pool")
+	}
+	for id := range 3 {
+		if !slices.Equal(stream(42, id), stream(42, id)) {
+			t.Fatalf("worker %d: same seed produced different request streams", id)
+		}
+	}
+	if slices.Equal(stream(42, 0), stream(42, 1)) {
+		t.Fatalf("workers share one request stream")
+	}
+	if effectiveSeed(0) == 0 {
+		t.Fatalf("seed 0 should resolve to a time-based seed")
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// metric is one prom_results.json entry the diff compares. Lower-is-better
+// metrics regress when they grow, the others when they shrink
+type metric struct {
+	Name        string
+	LowerBetter bool
+}
+
+var metrics = []metric{
+	{"hit_ratio", false},
+	{"p50_latency_s", true},
+	{"p95_latency_s", true},
+	{"p99_latency_s", true},
+	{"staleness_ratio", true},
+	{"redis_memory_used_bytes_sum", true},
+}
+
+// combo is one bundle directory of a results tree: the per-metric median over
+// its reps, NaN where no rep had a value
+type combo struct {
+	Reps   int
+	Values map[string]float64
+}
+
+func (c combo) value(name string) float64 {
+	if v, ok := c.Values[name]; ok {
+		return v
+	}
+	return math.NaN()
+}
+
+type row struct {
+	Combo      string  `json:"combo"`
+	Metric     string  `json:"metric"`
+	Base       float64 `json:"-"`
+	Candidate  float64 `json:"-"`
+	Change     float64 `json:"-"` // relative, candidate vs base
+	Regression bool    `json:"regression"`
+	Note       string  `json:"note,omitempty"`
+}
+
+func main() {
+	format := flag.String("format", "table", "Output format: table|csv|json")
+	threshold := flag.Float64("threshold", 0.05, "Relative change in the worse direction flagged as a regression (0.05 = 5%)")
+	failOnRegression := flag.Bool("fail-on-regression", false, "Exit with status 1 when any regression is flagged")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: experiment-diff [flags] <base results/<ts>> <candidate results/<ts>>\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	base, err := loadTree(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("base: %v", err)
+	}
+	cand, err := loadTree(flag.Arg(1))
+	if err != nil {
+		log.Fatalf("candidate: %v", err)
+	}
+	rows := diff(base, cand, *threshold)
+	if err := write(os.Stdout, *format, rows); err != nil {
+		log.Fatalf("write: %v", err)
+	}
+	if *failOnRegression && slices.ContainsFunc(rows, func(r row) bool { return r.Regression }) {
+		os.Exit(1)
+	}
+}
+
+// loadTree reads a results/<ts> tree written by experiment-runner: one
+// directory per combo, holding repNN directories with prom_results.json.
+// Reps without the file (e.g. a failed Prometheus query) are skipped
+func loadTree(root string) (map[string]combo, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, fmt.Errorf("read results tree: %w", err)
+	}
+	out := make(map[string]combo)
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		reps, err := filepath.Glob(filepath.Join(root, e.Name(), "rep*", "prom_results.json"))
+		if err != nil {
+			return nil, fmt.Errorf("glob %s: %w", e.Name(), err)
+		}
+		samples := make(map[string][]float64, len(metrics))
+		n := 0
+		for _, p := range reps {
+			vals, err := readPromResults(p)
+			if err != nil {
+				return nil, err
+			}
+			n++
+			for k, v := range vals {
+				samples[k] = append(samples[k], v)
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		c := combo{Reps: n, Values: make(map[string]float64, len(metrics))}
+		for _, m := range metrics {
+			c.Values[m.Name] = median(samples[m.Name])
+		}
+		out[e.Name()] = c
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%s: no prom_results.json under */rep*/", root)
+	}
+	return out, nil
+}
+
+// readPromResults returns the scalar value of every instant-vector query in
+// a prom_results.json. Queries that errored or matched nothing are left out
+func readPromResults(path string) (map[string]float64, error) {
+	b, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	out := make(map[string]float64, len(raw))
+	for name, data := range raw {
+		var d struct {
+			Result []struct {
+				Value []json.RawMessage `json:"value"`
+			} `json:"result"`
+		}
+		if json.Unmarshal(data, &d) != nil || len(d.Result) == 0 || len(d.Result[0].Value) != 2 {
+			continue
+		}
+		var s string
+		if json.Unmarshal(d.Result[0].Value[1], &s) != nil {
+			continue
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsNaN(v) {
+			continue
+		}
+		out[name] = v
+	}
+	return out, nil
+}
+
+func median(xs []float64) float64 {
+	if len(xs) == 0 {
+		return math.NaN()
+	}
+	s := slices.Sorted(slices.Values(xs))
+	if n := len(s); n%2 == 0 {
+		return (s[n/2-1] + s[n/2]) / 2
+	}
+	return s[len(s)/2]
+}
+
+// diff compares every metric of the combos both trees share, sorted by combo
+// then metric order. Combos found in only one tree get a single noted row
+func diff(base, cand map[string]combo, threshold float64) []row {
+	names := make([]string, 0, len(base)+len(cand))
+	for k := range base {
+		names = append(names, k)
+	}
+	for k := range cand {
+		if _, ok := base[k]; !ok {
+			names = append(names, k)
+		}
+	}
+	slices.Sort(names)
+
+	var out []row
+	for _, name := range names {
+		b, inBase := base[name]
+		c, inCand := cand[name]
+		switch {
+		case !inCand:
+			out = append(out, row{Combo: name, Base: math.NaN(), Candidate: math.NaN(), Change: math.NaN(), Note: "only in base"})
+			continue
+		case !inBase:
+			out = append(out, row{Combo: name, Base: math.NaN(), Candidate: math.NaN(), Change: math.NaN(), Note: "only in candidate"})
+			continue
+		}
+		for _, m := range metrics {
+			r := row{Combo: name, Metric: m.Name, Base: b.value(m.Name), Candidate: c.value(m.Name)}
+			r.Change = relChange(r.Base, r.Candidate)
+			if math.IsNaN(r.Change) {
+				r.Note = "missing"
+			} else {
+				worse := r.Change
+				if !m.LowerBetter {
+					worse = -worse
+				}
+				r.Regression = worse > threshold
+			}
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// relChange is (cand-base)/|base|. From a zero base any growth is infinite,
+// so it is flagged whatever the threshold
+func relChange(base, cand float64) float64 {
+	switch {
+	case math.IsNaN(base) || math.IsNaN(cand):
+		return math.NaN()
+	case base == cand:
+		return 0
+	case base == 0:
+		return math.Copysign(math.Inf(1), cand)
+	}
+	return (cand - base) / math.Abs(base)
+}
+
+func write(w io.Writer, format string, rows []row) error {
+	switch strings.ToLower(format) {
+	case "table":
+		return writeTable(w, rows)
+	case "csv":
+		return writeCSV(w, rows)
+	case "json":
+		return writeJSON(w, rows)
+	}
+	return fmt.Errorf("unknown format %q (want table, csv or json)", format)
+}
+
+var header = []string{"combo", "metric", "base", "candidate", "change", "regression"}
+
+func (r row) fields() []string {
+	num := func(v float64) string {
+		if math.IsNaN(v) {
+			return ""
+		}
+		return strconv.FormatFloat(v, 'g', 6, 64)
+	}
+	change, mark := r.Note, ""
+	if change == "" {
+		change = fmt.Sprintf("%+.1f%%", 100*r.Change)
+	}
+	if r.Regression {
+		mark = "REGRESSION"
+	}
+	return []string{r.Combo, r.Metric, num(r.Base), num(r.Candidate), change, mark}
+}
+
+func writeTable(w io.Writer, rows []row) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, strings.ToUpper(strings.Join(header, "\t")))
+	for _, r := range rows {
+		_, _ = fmt.Fprintln(tw, strings.Join(r.fields(), "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("flush table: %w", err)
+	}
+	return nil
+}
+
+func writeCSV(w io.Writer, rows []row) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write(header)
+	for _, r := range rows {
+		f := r.fields()
+		if r.Note == "" {
+			f[4] = strconv.FormatFloat(r.Change, 'g', 6, 64)
+		}
+		f[5] = strconv.FormatBool(r.Regression)
+		_ = cw.Write(f)
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("write csv: %w", err)
+	}
+	return nil
+}
+
+// jsonRow carries the numbers as pointers: NaN and ±Inf have no JSON form,
+// so they become null
+type jsonRow struct {
+	row
+	Base      *float64 `json:"base"`
+	Candidate *float64 `json:"candidate"`
+	Change    *float64 `json:"change"`
+}
+
+func writeJSON(w io.Writer, rows []row) error {
+	finite := func(v float64) *float64 {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil
+		}
+		return &v
+	}
+	out := make([]jsonRow, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, jsonRow{row: r, Base: finite(r.Base), Candidate: finite(r.Candidate), Change: finite(r.Change)})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return fmt.Errorf("encode json: %w", err)
+	}
+	return nil
+}
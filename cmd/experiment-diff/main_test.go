@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeRep writes a prom_results.json in the shape experiment-runner stores:
+// the raw "data" of each Prometheus instant query
+func writeRep(t *testing.T, root, combo, rep string, vals map[string]float64) {
+	t.Helper()
+	dir := filepath.Join(root, combo, rep)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	out := map[string]json.RawMessage{
+		// errored queries are stored as {"error": ...} and must be skipped
+		"postgres_cpu_rate": json.RawMessage(`{"error": "no such job"}`),
+	}
+	for k, v := range vals {
+		out[k] = json.RawMessage(fmt.Sprintf(`{"resultType":"vector","result":[{"metric":{},"value":[1700000000.123,"%g"]}]}`, v))
+	}
+	b, _ := json.Marshal(out)
+	if err := os.WriteFile(filepath.Join(dir, "prom_results.json"), b, 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func syntheticTrees(t *testing.T) (string, string) {
+	t.Helper()
+	base, cand := t.TempDir(), t.TempDir()
+	const combo = "cache-r8-ttl30s-hot5-invttl-zipfs1.3"
+	baseVals := map[string]float64{
+		"hit_ratio":                   0.80,
+		"p50_latency_s":               0.010,
+		"p95_latency_s":               0.050,
+		"p99_latency_s":               0.100,
+		"staleness_ratio":             0,
+		"redis_memory_used_bytes_sum": 1e6,
+	}
+	writeRep(t, base, combo, "rep01", baseVals)
+	slow := map[string]float64{}
+	for k, v := range baseVals {
+		slow[k] = v
+	}
+	slow["p95_latency_s"] = 0.070
+	writeRep(t, base, combo, "rep02", slow)
+	writeRep(t, base, combo, "rep03", baseVals)
+	writeRep(t, base, "baseline-r0-ttl30s-hot5-invttl-zipfs1.3", "rep01", map[string]float64{"p50_latency_s": 0.02})
+
+	writeRep(t, cand, combo, "rep01", map[string]float64{
+		"hit_ratio":                   0.70, // worse: -12.5%
+		"p50_latency_s":               0.0102,
+		"p95_latency_s":               0.040, // better
+		"p99_latency_s":               0.120, // worse: +20%
+		"staleness_ratio":             0,
+		"redis_memory_used_bytes_sum": 1.01e6,
+	})
+	// a rep the runner never finished has no prom_results.json
+	if err := os.MkdirAll(filepath.Join(cand, combo, "rep02"), 0o750); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	writeRep(t, cand, "cache-r9-ttl30s-hot5-invttl-zipfs1.3", "rep01", map[string]float64{"hit_ratio": 0.9})
+	return base, cand
+}
+
+func TestLoadTree_MedianOverReps(t *testing.T) {
+	base, _ := syntheticTrees(t)
+	tree, err := loadTree(base)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	c, ok := tree["cache-r8-ttl30s-hot5-invttl-zipfs1.3"]
+	if !ok || c.Reps != 3 {
+		t.Fatalf("combo=%+v ok=%v want 3 reps", c, ok)
+	}
+	if got := c.Values["p95_latency_s"]; got != 0.050 {
+		t.Fatalf("p95 median=%v want 0.05", got)
+	}
+	if _, ok := c.Values["postgres_cpu_rate"]; ok {
+		t.Fatalf("unexpected metric outside the compared set: %v", c.Values)
+	}
+
+	if _, err := loadTree(t.TempDir()); err == nil {
+		t.Fatalf("expected error for a tree without results")
+	}
+}
+
+func TestDiff_FlagsRegressionsBeyondThreshold(t *testing.T) {
+	basePath, candPath := syntheticTrees(t)
+	base, err := loadTree(basePath)
+	if err != nil {
+		t.Fatalf("load base: %v", err)
+	}
+	cand, err := loadTree(candPath)
+	if err != nil {
+		t.Fatalf("load candidate: %v", err)
+	}
+
+	rows := diff(base, cand, 0.05)
+	got := map[string]row{}
+	var notes []string
+	for _, r := range rows {
+		if r.Metric == "" {
+			notes = append(notes, r.Combo+": "+r.Note)
+			continue
+		}
+		got[r.Metric] = r
+	}
+	want := map[string]bool{
+		"hit_ratio":                   true,
+		"p50_latency_s":               false, // +2% is under the threshold
+		"p95_latency_s":               false,
+		"p99_latency_s":               true,
+		"staleness_ratio":             false,
+		"redis_memory_used_bytes_sum": false,
+	}
+	for m, reg := range want {
+		if got[m].Regression != reg {
+			t.Fatalf("%s: regression=%v want %v (row %+v)", m, got[m].Regression, reg, got[m])
+		}
+	}
+	if c := got["hit_ratio"].Change; c > -0.12 || c < -0.13 {
+		t.Fatalf("hit_ratio change=%v want -0.125", c)
+	}
+	wantNotes := []string{
+		"baseline-r0-ttl30s-hot5-invttl-zipfs1.3: only in base",
+		"cache-r9-ttl30s-hot5-invttl-zipfs1.3: only in candidate",
+	}
+	if strings.Join(notes, "|") != strings.Join(wantNotes, "|") {
+		t.Fatalf("notes=%v want %v", notes, wantNotes)
+	}
+
+	// a tighter threshold catches the small p50 drift too
+	for _, r := range diff(base, cand, 0.01) {
+		if r.Metric == "p50_latency_s" && !r.Regression {
+			t.Fatalf("p50 +2%% not flagged at 1%%: %+v", r)
+		}
+	}
+}
+
+func TestDiff_ZeroBase(t *testing.T) {
+	base := map[string]combo{"c": {Values: map[string]float64{"staleness_ratio": 0, "hit_ratio": 0}}}
+	cand := map[string]combo{"c": {Values: map[string]float64{"staleness_ratio": 0.01, "hit_ratio": 0.5}}}
+	for _, r := range diff(base, cand, 0.05) {
+		switch r.Metric {
+		case "staleness_ratio":
+			if !r.Regression {
+				t.Fatalf("staleness from zero should be flagged: %+v", r)
+			}
+		case "hit_ratio":
+			if r.Regression {
+				t.Fatalf("hit ratio growth flagged: %+v", r)
+			}
+		default:
+			if r.Note != "missing" {
+				t.Fatalf("%s: note=%q want missing", r.Metric, r.Note)
+			}
+		}
+	}
+}
+
+func TestWrite_Formats(t *testing.T) {
+	basePath, candPath := syntheticTrees(t)
+	base, _ := loadTree(basePath)
+	cand, _ := loadTree(candPath)
+	rows := diff(base, cand, 0.05)
+
+	var tbl bytes.Buffer
+	if err := write(&tbl, "table", rows); err != nil {
+		t.Fatalf("table: %v", err)
+	}
+	if !strings.HasPrefix(tbl.String(), "COMBO") || strings.Count(tbl.String(), "REGRESSION") != 3 {
+		t.Fatalf("table:\n%s", tbl.String())
+	}
+
+	var cb bytes.Buffer
+	if err := write(&cb, "csv", rows); err != nil {
+		t.Fatalf("csv: %v", err)
+	}
+	recs, err := csv.NewReader(&cb).ReadAll()
+	if err != nil {
+		t.Fatalf("parse csv: %v", err)
+	}
+	if len(recs) != len(rows)+1 || strings.Join(recs[0], ",") != strings.Join(header, ",") {
+		t.Fatalf("csv records=%d header=%v", len(recs), recs[0])
+	}
+
+	var jb bytes.Buffer
+	if err := write(&jb, "json", rows); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	var decoded []struct {
+		Combo      string   `json:"combo"`
+		Metric     string   `json:"metric"`
+		Base       *float64 `json:"base"`
+		Change     *float64 `json:"change"`
+		Regression bool     `json:"regression"`
+	}
+	if err := json.Unmarshal(jb.Bytes(), &decoded); err != nil {
+		t.Fatalf("decode json: %v\n%s", err, jb.String())
+	}
+	if len(decoded) != len(rows) {
+		t.Fatalf("json rows=%d want %d", len(decoded), len(rows))
+	}
+	for _, d := range decoded {
+		if d.Metric == "" && (d.Base != nil || d.Change != nil) {
+			t.Fatalf("one-sided combo should have null numbers: %+v", d)
+		}
+	}
+
+	if err := write(&bytes.Buffer{}, "xml", rows); err == nil {
+		t.Fatalf("expected error for unknown format")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
@@ -27,6 +28,7 @@ type opt struct {
 	HotThreshold string
 	Invalidation string
 	ZipfS        float64
+	RedisDB      int
 }
 
 type cfg struct {
@@ -48,6 +50,7 @@ type cfg struct {
 	Invalidations []string
 	CentroidsPath string
 	ClearCache    bool
+	RedisDBs      int
 	ZipfSList     []float64
 	ZipfV         float64
 	Seed          int64
@@ -93,7 +96,8 @@ func parseFlags() cfg {
 	flag.StringVar(&ttls, "ttls", "30s,60s", "TTLs CSV (Cache TTL Default)")
 	flag.StringVar(&hots, "hots", "5,10", "Hot thresholds CSV")
 	flag.StringVar(&invs, "invalidations", "ttl,kafka", "Invalidation modes CSV")
-	flag.BoolVar(&c.ClearCache, "clear-cache", true, "Flush Redis before each cache scenario run")
+	flag.BoolVar(&c.ClearCache, "clear-cache", true, "Flush the combo's Redis database before each cache scenario run")
+	flag.IntVar(&c.RedisDBs, "redis-dbs", 16, "Redis databases handed out round-robin, one per combo, starting at REDIS_DB (1 = all combos share REDIS_DB)")
 
 	flag.Parse()
 
@@ -155,6 +159,7 @@ func runAll(c cfg) error {
 	}
 
 	reps := max(c.Reps, 1)
+	combo := 0
 
 	for _, sc := range c.Scenarios {
 		for _, zipfS := range c.ZipfSList {
@@ -180,7 +185,9 @@ func runAll(c cfg) error {
 					HotThreshold: hot,
 					Invalidation: inv,
 					ZipfS:        zipfS,
+					RedisDB:      c.comboDB(combo),
 				}
+				combo++
 				for rep := 1; rep <= reps; rep++ {
 					if err := runOne(c, root, one, campaignSeed, rep); err != nil {
 						return err
@@ -200,7 +207,9 @@ func runAll(c cfg) error {
 								HotThreshold: hot,
 								Invalidation: inv,
 								ZipfS:        zipfS,
+								RedisDB:      c.comboDB(combo),
 							}
+							combo++
 							for rep := 1; rep <= reps; rep++ {
 								if err := runOne(c, root, one, campaignSeed, rep); err != nil {
 									return err
@@ -215,6 +224,16 @@ func runAll(c cfg) error {
 	return nil
 }
 
+// comboDB is the Redis database for the i-th combo: REDIS_DB offset by i,
+// wrapping at RedisDBs, so neighbouring combos never share cache state
+func (c cfg) comboDB(i int) int {
+	base, _ := strconv.Atoi(strings.TrimSpace(os.Getenv("REDIS_DB")))
+	if c.RedisDBs <= 1 {
+		return base
+	}
+	return (base + i) % c.RedisDBs
+}
+
 func bundleDir(root string, o opt) string {
 	return filepath.Join(root,
 		fmt.Sprintf("%s-r%d-ttl%s-hot%s-inv%s-zipfs%s",
@@ -246,7 +265,7 @@ func runOne(c cfg, root string, o opt, campaignSeed int64, rep int) error {
 	}
 
 	if c.ClearCache && o.Scenario == "cache" {
-		if err := clearRedis(); err != nil {
+		if err := clearRedis(o.RedisDB); err != nil {
 			return fmt.Errorf("clear redis before scenario=%s: %w", o.Scenario, err)
 		}
 	}
@@ -256,6 +275,7 @@ func runOne(c cfg, root string, o opt, campaignSeed int64, rep int) error {
 	env = set(env, "H3_RES", fmt.Sprintf("%d", o.H3Res))
 	env = set(env, "CACHE_TTL_DEFAULT", o.TTL)
 	env = set(env, "HOT_THRESHOLD", o.HotThreshold)
+	env = set(env, "REDIS_DB", strconv.Itoa(o.RedisDB))
 	switch o.Invalidation {
 	case "kafka":
 		env = set(env, "INVALIDATION_ENABLED", "true")
@@ -490,6 +510,9 @@ func queryPrometheus(base, dir string, o opt, start, end time.Time) error {
   sum(increase(spatial_reads_total{stale="true",scenario="%s"}[%ds]))
 ) / clamp_min(sum(increase(spatial_reads_total{scenario="%s"}[%ds])), 1e-9)`, sc, windowSeconds, sc, windowSeconds)
 
+	// cumulative since middleware start, unlike the windowed ratios above
+	qHitGauge := fmt.Sprintf(`max(spatial_hit_ratio{scenario="%s"})`, sc)
+
 	qRedisMem := fmt.Sprintf(`max_over_time(sum(redis_memory_used_bytes)[%ds:])`, windowSeconds)
 	qPgCPU := fmt.Sprintf(`avg_over_time(sum by (instance) (rate(process_cpu_seconds_total{job=~"postgres.*"}[1m]))[%ds:])`, windowSeconds)
 
@@ -499,6 +522,7 @@ func queryPrometheus(base, dir string, o opt, start, end time.Time) error {
 		{"p99_latency_s", qP99, mkURL(qP99)},
 		{"hit_ratio", qHit, mkURL(qHit)},
 		{"staleness_ratio", qStale, mkURL(qStale)},
+		{"hit_ratio_gauge", qHitGauge, mkURL(qHitGauge)},
 		{"redis_memory_used_bytes_sum", qRedisMem, mkURL(qRedisMem)},
 		{"postgres_cpu_rate", qPgCPU, mkURL(qPgCPU)},
 	}
@@ -569,7 +593,8 @@ func checkPortAvailable(addr string) error {
 	return nil
 }
 
-func clearRedis() error {
+// clearRedis flushes only db, leaving other combos' databases alone
+func clearRedis(db int) error {
 	addr := os.Getenv("REDIS_ADDR")
 	if strings.TrimSpace(addr) == "" {
 		addr = "localhost:6379"
@@ -581,8 +606,19 @@ func clearRedis() error {
 	}
 	defer func() { _ = conn.Close() }()
 
-	if _, err := conn.Write([]byte("FLUSHALL\r\n")); err != nil {
-		return fmt.Errorf("write FLUSHALL to redis %s: %w", addr, err)
+	if _, err := fmt.Fprintf(conn, "SELECT %d\r\nFLUSHDB\r\n", db); err != nil {
+		return fmt.Errorf("write FLUSHDB to redis %s db %d: %w", addr, db, err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	rd := bufio.NewReader(conn)
+	for _, cmd := range []string{"SELECT", "FLUSHDB"} {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("read %s reply from redis %s: %w", cmd, addr, err)
+		}
+		if !strings.HasPrefix(line, "+") {
+			return fmt.Errorf("redis %s %s: %s", addr, cmd, strings.TrimSpace(line))
+		}
 	}
 
 	return nil
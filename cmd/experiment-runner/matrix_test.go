@@ -18,3 +18,18 @@ func TestMatrixExpansionCount(t *testing.T) {
 		t.Fatalf("dry-run: %v", err)
 	}
 }
+
+func TestComboDB_RoundRobin(t *testing.T) {
+	t.Setenv("REDIS_DB", "3")
+
+	c := cfg{RedisDBs: 4}
+	got := []int{c.comboDB(0), c.comboDB(1), c.comboDB(2)}
+	if got[0] != 3 || got[1] != 0 || got[2] != 1 {
+		t.Fatalf("comboDB=%v want [3 0 1]", got)
+	}
+
+	c.RedisDBs = 1
+	if db := c.comboDB(5); db != 3 {
+		t.Fatalf("with one database every combo should use REDIS_DB, got %d", db)
+	}
+}
@@ -5,26 +5,28 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
-	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 
-	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/cellindex"
-	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/redisstore"
+	cachev2 "github.com/mohammed-shakir/h3-spatial-cache/internal/cache/v2"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/executor"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/health"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/httpclient"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/ogc"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/router"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/server"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/warmstart"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/hitevents"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/logger"
 	mapperh3 "github.com/mohammed-shakir/h3-spatial-cache/internal/mapper/h3"
@@ -32,31 +34,58 @@ import (
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/scenarios"
 	_ "github.com/mohammed-shakir/h3-spatial-cache/internal/scenarios/baseline"
 	_ "github.com/mohammed-shakir/h3-spatial-cache/internal/scenarios/cache"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/scenarios/shadow"
 	invkafka "github.com/mohammed-shakir/h3-spatial-cache/pkg/invalidation/kafka"
 )
 
 type consumerCache struct {
 	base    context.Context
-	inner   *redisstore.Client
+	inner   *cachev2.Store
 	timeout time.Duration
 }
 
 func (c consumerCache) MGet(_ []string) (map[string][]byte, error)    { return nil, nil }
 func (c consumerCache) Set(_ string, _ []byte, _ time.Duration) error { return nil }
 
-var Version = "dev"
-
-func main() {
-	os.Exit(run())
+// closeHandler stops a scenario's background jobs, when it runs any
+func closeHandler(log *slog.Logger, handler router.QueryHandler) {
+	c, ok := handler.(io.Closer)
+	if !ok {
+		return
+	}
+	if err := c.Close(); err != nil {
+		log.Warn("scenario close failed", "err", err)
+	}
 }
 
-func envInt(k string, def int) int {
-	if v := os.Getenv(k); v != "" {
-		if n, err := strconv.Atoi(v); err == nil {
-			return n
+// invalidationStore is the store the invalidation runner works on: the
+// engine's own when the scenario caches, so both share one backend and its
+// connections whatever CACHE_BACKEND is, else one opened from cfg
+func invalidationStore(cfg config.Config, handler, shadow router.QueryHandler) (*cachev2.Store, error) {
+	st := cacheStore(handler)
+	if st == nil {
+		var err error
+		if st, err = cachev2.Open(cfg); err != nil {
+			return nil, fmt.Errorf("open cache backend: %w", err)
 		}
 	}
-	return def
+	// the shadow caches in its own Redis DB; mirror deletes into it so it
+	// can't go on serving what the primary has invalidated
+	return cachev2.Mirror(st, cacheStore(shadow)), nil
+}
+
+// cacheStore is handler's cache store, or nil when it doesn't cache
+func cacheStore(handler router.QueryHandler) *cachev2.Store {
+	if sp, ok := handler.(interface{ CacheStore() *cachev2.Store }); ok {
+		return sp.CacheStore()
+	}
+	return nil
+}
+
+var Version = "dev"
+
+func main() {
+	os.Exit(run())
 }
 
 func (c consumerCache) Del(keys ...string) error {
@@ -67,7 +96,7 @@ func (c consumerCache) Del(keys ...string) error {
 		defer cancel()
 	}
 	if err := c.inner.Del(ctx, keys...); err != nil {
-		return fmt.Errorf("redis del: %w", err)
+		return fmt.Errorf("cache del: %w", err)
 	}
 	return nil
 }
@@ -83,20 +112,31 @@ func run() int {
 	}
 
 	zl := logger.Build(logger.Config{
-		Level:     cfg.LogLevel,
-		Console:   strings.ToLower(os.Getenv("LOG_CONSOLE")) == "true",
-		SampleN:   envInt("LOG_SAMPLE_N", 0),
-		Scenario:  cfg.Scenario,
-		Component: "middleware",
+		Level:                cfg.LogLevel,
+		Console:              strings.ToLower(os.Getenv("LOG_CONSOLE")) == "true",
+		SampleN:              cfg.LogSampleN,
+		SlowRequestThreshold: cfg.SlowRequestThreshold,
+		Scenario:             cfg.Scenario,
+		Component:            "middleware",
 	}, os.Stdout)
 
 	appLog := logger.NewSlog(&zl)
 
+	build := observability.BuildInfo{
+		Version:   Version,
+		Revision:  os.Getenv("BUILD_REVISION"),
+		Branch:    os.Getenv("BUILD_BRANCH"),
+		BuildDate: os.Getenv("BUILD_DATE"),
+	}
+	if v := os.Getenv("BUILD_VERSION"); v != "" && Version == "dev" {
+		build.Version = v
+	}
+
 	observability.SetScenario(cfg.Scenario)
-	observability.ExposeBuildInfo(Version)
+	observability.SetBuildInfo(build)
 	appLog.Info("starting middleware",
 		"addr", cfg.Addr,
-		"version", Version,
+		"version", build.Version,
 		"geoserver", cfg.GeoServerURL,
 		"scenario", cfg.Scenario)
 
@@ -137,7 +177,7 @@ func run() int {
 		}
 	}
 
-	httpClient := httpclient.NewOutbound()
+	httpClient := httpclient.NewOutboundPool(httpclient.PoolFromConfig(cfg))
 	owsURL := ogc.OWSEndpoint(cfg.GeoServerURL)
 
 	exec, err := executor.New(appLog, httpClient, owsURL)
@@ -152,6 +192,37 @@ func run() int {
 		appLog.Error("scenario setup failed", "err", err)
 		return 1
 	}
+	defer closeHandler(appLog, handler)
+
+	var shadowRunner *shadow.Runner
+	var sh router.Shadower
+	var sHandler router.QueryHandler
+	// invalidation covers the shadow's resolutions too when it caches
+	resMin, resMax := cfg.H3ResMin, cfg.H3ResMax
+	if cfg.Shadow.Enabled {
+		scfg := cfg.ShadowConfig()
+		sHandler, err = scenarios.New(scfg.Scenario, scfg, appLog.With("shadow", cfg.Shadow.Name), exec)
+		if err != nil {
+			appLog.Error("shadow scenario setup failed", "err", err)
+			return 1
+		}
+		defer closeHandler(appLog, sHandler)
+		// one upstream budget for both engines, so the shadow can't double
+		// GeoServer concurrency
+		if s, ok := sHandler.(interface {
+			ShareUpstreamLimit(router.QueryHandler) bool
+		}); ok {
+			s.ShareUpstreamLimit(handler)
+		}
+		resMin, resMax = scfg.H3ResMin, scfg.H3ResMax
+		shadowRunner = shadow.New(cfg.Shadow.Name, sHandler, appLog, cfg.Shadow.MaxInFlight, cfg.Shadow.Timeout)
+		sh = shadowRunner
+		appLog.Info("shadow engine enabled",
+			"shadow", cfg.Shadow.Name,
+			"scenario", scfg.Scenario,
+			"h3_res", scfg.H3Res,
+			"redis_db", scfg.RedisDB)
+	}
 
 	type resetter interface{ Reset(...string) }
 	var hot resetter
@@ -181,17 +252,20 @@ func run() int {
 			Addr:    addr,
 			Path:    path,
 			Build: metrics.BuildInfo{
-				Version:   os.Getenv("BUILD_VERSION"),
-				Revision:  os.Getenv("BUILD_REVISION"),
-				Branch:    os.Getenv("BUILD_BRANCH"),
-				BuildDate: os.Getenv("BUILD_DATE"),
+				Version:   build.Version,
+				Revision:  build.Revision,
+				Branch:    build.Branch,
+				BuildDate: build.BuildDate,
 			},
+			OpenMetrics: cfg.TracingEnabled,
 		})
 
 		observability.Init(p.Registerer(), true)
+		observability.EnableExemplars(cfg.TracingEnabled)
 		promReg = p.Registerer()
 		observability.SetScenario(cfg.Scenario)
-		observability.ExposeBuildInfo(Version)
+		observability.StartHitRatioUpdater(ctx, observability.HitRatioRefresh)
+		httpclient.StartPoolSampler(ctx, httpclient.PoolSampleInterval)
 
 		mux := http.NewServeMux()
 		mux.Handle(path, p.Handler())
@@ -230,33 +304,28 @@ func run() int {
 
 	var readinessReporter health.ReadinessReporter
 	if strings.ToLower(cfg.Invalidation.Driver) == "kafka" && cfg.Invalidation.Enabled {
-		rcli, err := redisstore.New(ctx, cfg.RedisAddr)
-		idx := cellindex.NewRedisIndex(rcli)
+		store, err := invalidationStore(cfg, handler, sHandler)
 		if err != nil {
-			appLog.Error("invalidation: redis connect failed", "err", err)
+			appLog.Error("invalidation: cache backend open failed", "backend", cfg.CacheBackend, "err", err)
 		} else {
 			h3m := mapperh3.New()
 
-			resRange := []int{cfg.H3ResMin}
-			for r := cfg.H3ResMin + 1; r <= cfg.H3ResMax; r++ {
+			resRange := []int{resMin}
+			for r := resMin + 1; r <= resMax; r++ {
 				resRange = append(resRange, r)
 			}
 
 			invCfg := invkafka.FromEnv()
 
-			delCache := consumerCache{base: ctx, inner: rcli, timeout: cfg.CacheOpTimeout}
+			delCache := consumerCache{base: ctx, inner: store, timeout: cfg.CacheOpTimeout}
 
 			runner := invkafka.New(invCfg, delCache, h3m, invkafka.Options{
-				Logger:   appLog,
-				Register: promReg,
-				ResRange: resRange,
-				Hotness: func() resetter {
-					if cfg.AdaptiveEnabled && hot != nil {
-						return hot
-					}
-					return nil
-				}(),
-				CellIndex: idx,
+				Logger:    appLog,
+				Register:  promReg,
+				ResRange:  resRange,
+				Hotness:   hot,
+				CellIndex: store.Cells,
+				Features:  store.Features,
 			})
 
 			go func() {
@@ -268,10 +337,28 @@ func run() int {
 		}
 	}
 
-	if err := server.Run(ctx, cfg, appLog, handler, readinessReporter); err != nil {
+	if cfg.WarmManifest != "" {
+		w, ok := handler.(warmstart.Warmer)
+		if !ok {
+			appLog.Error("WARM_MANIFEST set but the scenario can't warm its cache", "scenario", cfg.Scenario)
+			return 1
+		}
+		entries, err := warmstart.Load(cfg.WarmManifest, cfg)
+		if err != nil {
+			appLog.Error("warm start", "err", err)
+			return 1
+		}
+		appLog.Info("warm start", "manifest", cfg.WarmManifest, "entries", len(entries))
+		readinessReporter = health.All(readinessReporter, warmstart.Start(ctx, w, entries, appLog))
+	}
+
+	if err := server.Run(ctx, cfg, appLog, handler, sh, readinessReporter); err != nil {
 		appLog.Error("server exited with error", "err", err)
 		return 1
 	}
+	if shadowRunner != nil {
+		shadowRunner.Wait()
+	}
 	appLog.Info("server stopped")
 	return 0
 }
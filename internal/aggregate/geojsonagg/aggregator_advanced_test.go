@@ -5,7 +5,9 @@ import (
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
 func loadJSON[T any](t *testing.T, path string) T {
@@ -101,3 +103,317 @@ func Test_MergeRequest_HitClassifications(t *testing.T) {
 		}
 	}
 }
+
+func Test_MergeRequest_NumberHint_MixedValues(t *testing.T) {
+	mk := func(name, score string) json.RawMessage {
+		return json.RawMessage(`{"type":"Feature","geometry":null,"properties":{"name":"` + name + `","score":` + score + `}}`)
+	}
+	agg := &Aggregator{}
+	req := Request{
+		Query: Query{Sort: []SortKey{{Property: "score", TypeHint: "number"}}},
+		Shards: []ShardPage{
+			{Features: []json.RawMessage{mk("ten", `10`), mk("nine", `"9"`), mk("junk", `"abc"`)}},
+			{Features: []json.RawMessage{mk("hundred", `"100"`), mk("half", `2.5`)}},
+		},
+	}
+	out, _, err := agg.MergeRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := featureNames(t, parseOut(t, out).Features)
+	want := []string{"half", "nine", "ten", "hundred", "junk"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("names=%v want %v", got, want)
+	}
+}
+
+func Test_MergeRequest_MalformedFeature(t *testing.T) {
+	good := json.RawMessage(feat(`"a"`, "a"))
+	bad := json.RawMessage(`{"type":"Feature",`)
+	req := Request{Shards: []ShardPage{
+		{Features: []json.RawMessage{good, bad}},
+	}}
+
+	if _, _, err := NewAdvanced().MergeRequest(req); err == nil {
+		t.Fatalf("expected error for malformed feature")
+	}
+
+	agg := NewAdvanced()
+	agg.SkipMalformed = true
+	out, diag, err := agg.MergeRequest(req)
+	if err != nil {
+		t.Fatalf("skip mode: unexpected error: %v", err)
+	}
+	if got := featureNames(t, parseOut(t, out).Features); !slices.Equal(got, []string{"a"}) {
+		t.Fatalf("names=%v want [a]", got)
+	}
+	if diag.SkippedMalformed != 1 {
+		t.Fatalf("skipped=%d want 1", diag.SkippedMalformed)
+	}
+}
+
+func Test_MergeRequest_GeomPrecisionDedup(t *testing.T) {
+	mk := func(name, x string) json.RawMessage {
+		return json.RawMessage(`{"type":"Feature","geometry":{"type":"Point","coordinates":[` + x + `,55.0]},"properties":{"name":"` + name + `"}}`)
+	}
+	req := Request{Shards: []ShardPage{
+		{Features: []json.RawMessage{mk("a", "12.12345671")}},
+		{Features: []json.RawMessage{mk("b", "12.12345674")}},
+	}}
+
+	agg := NewAdvanced()
+	agg.GeomPrecision = 6
+	out, diag, err := agg.MergeRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(parseOut(t, out).Features); n != 1 || diag.DedupByGH != 1 {
+		t.Fatalf("precision 6: features=%d dedup=%d, want 1/1", n, diag.DedupByGH)
+	}
+
+	req.Query.GeomPrecision = 8
+	out, diag, err = agg.MergeRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(parseOut(t, out).Features); n != 2 || diag.DedupByGH != 0 {
+		t.Fatalf("precision 8 override: features=%d dedup=%d, want 2/0", n, diag.DedupByGH)
+	}
+}
+
+func Test_MergeRequest_DedupStrict_IDConflict(t *testing.T) {
+	mk := func(name, x string) json.RawMessage {
+		return json.RawMessage(`{"type":"Feature","id":"dup","geometry":{"type":"Point","coordinates":[` + x + `,55]},"properties":{"name":"` + name + `"}}`)
+	}
+	req := Request{Shards: []ShardPage{
+		{Features: []json.RawMessage{mk("first", "12")}},
+		{Features: []json.RawMessage{mk("second", "13")}},
+	}}
+
+	agg := NewAdvanced()
+	agg.DedupStrict = true
+	out, diag, err := agg.MergeRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := featureNames(t, parseOut(t, out).Features); !slices.Equal(got, []string{"first"}) {
+		t.Fatalf("names=%v want [first]", got)
+	}
+	if diag.DedupByID != 1 || diag.IDConflicts != 1 {
+		t.Fatalf("unexpected diag: %+v", diag)
+	}
+
+	_, diag, err = NewAdvanced().MergeRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diag.IDConflicts != 0 {
+		t.Fatalf("non-strict mode should not flag conflicts: %+v", diag)
+	}
+}
+
+func Test_MergeRequest_IDPropertyFallback(t *testing.T) {
+	mk := func(name, gid, x string) json.RawMessage {
+		return json.RawMessage(`{"type":"Feature","geometry":{"type":"Point","coordinates":[` + x + `,55]},"properties":{"gid":` + gid + `,"name":"` + name + `"}}`)
+	}
+	req := Request{
+		Query: Query{IDProperty: "gid"},
+		Shards: []ShardPage{
+			{Features: []json.RawMessage{mk("a", "7", "12"), mk("b", "8", "14")}},
+			{Features: []json.RawMessage{mk("a-moved", "7", "13")}},
+		},
+	}
+
+	out, diag, err := NewAdvanced().MergeRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := featureNames(t, parseOut(t, out).Features); !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("names=%v want [a b]", got)
+	}
+	if diag.DedupByID != 1 {
+		t.Fatalf("unexpected diag: %+v", diag)
+	}
+
+	req.Query.IDProperty = ""
+	if _, diag, _ = NewAdvanced().MergeRequest(req); diag.DedupByID != 0 || diag.TotalOut != 3 {
+		t.Fatalf("without IDProperty features should stay distinct: %+v", diag)
+	}
+}
+
+func Test_MergeRequest_CreatedRangeFilter(t *testing.T) {
+	mk := func(name, x, ts string) json.RawMessage {
+		props := `"name":"` + name + `"`
+		if ts != "" {
+			props += `,"created_at":` + ts
+		}
+		return json.RawMessage(`{"type":"Feature","id":"` + name + `","geometry":{"type":"Point","coordinates":[` + x + `,55]},"properties":{` + props + `}}`)
+	}
+	req := Request{
+		Query: Query{
+			TimeProperty:  "created_at",
+			CreatedAfter:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			CreatedBefore: time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC),
+			Limit:         2,
+		},
+		Shards: []ShardPage{
+			{Features: []json.RawMessage{
+				mk("old", "10", `"2023-12-31T23:59:59Z"`),
+				mk("jan", "11", `"2024-01-01T00:00:00Z"`),
+				mk("none", "12", ""),
+			}},
+			{Features: []json.RawMessage{
+				mk("bad", "13", `"yesterday"`),
+				mk("mar", "14", `"2024-03-15T12:00:00+02:00"`),
+				mk("late", "15", `"2024-07-01T00:00:00Z"`),
+				mk("jun", "16", `"2024-06-29T00:00:00Z"`),
+			}},
+		},
+	}
+
+	out, diag, err := NewAdvanced().MergeRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := featureNames(t, parseOut(t, out).Features); !slices.Equal(got, []string{"jan", "mar"}) {
+		t.Fatalf("names=%v want [jan mar] (limit applies after the range filter)", got)
+	}
+	if diag.TimeFiltered != 4 {
+		t.Fatalf("TimeFiltered=%d want 4: %+v", diag.TimeFiltered, diag)
+	}
+
+	req.Query.TimeProperty = ""
+	if _, diag, _ = NewAdvanced().MergeRequest(req); diag.TimeFiltered != 0 {
+		t.Fatalf("without TimeProperty nothing should be filtered: %+v", diag)
+	}
+}
+
+func Test_MergeRequest_ParseWorkersMatchSerial(t *testing.T) {
+	base := cellShards(40, 30)
+	// a feature without id whose geometry repeats another shard's, and a malformed one
+	base.Shards[3].Features = append(base.Shards[3].Features,
+		json.RawMessage(`{"type":"Feature","geometry":{"type":"Point","coordinates":[18.0001,59.0001]},"properties":{"rank":-1}}`),
+		json.RawMessage(`{"type":"Feature",`),
+	)
+
+	for _, q := range []Query{
+		{},
+		{Sort: []SortKey{{Property: "rank", Direction: Desc}}},
+		{Limit: 50, StartIndex: 7},
+	} {
+		req := base
+		req.Query = q
+
+		serial := NewAdvanced()
+		serial.SkipMalformed = true
+		want, wantDiag, err := serial.MergeRequest(req)
+		if err != nil {
+			t.Fatalf("serial: %v", err)
+		}
+
+		par := NewAdvanced()
+		par.SkipMalformed = true
+		par.ParseWorkers = 8
+		got, gotDiag, err := par.MergeRequest(req)
+		if err != nil {
+			t.Fatalf("parallel: %v", err)
+		}
+		if string(got) != string(want) {
+			t.Fatalf("query %+v: parallel output differs from serial", q)
+		}
+		if gotDiag != wantDiag {
+			t.Fatalf("query %+v: diag %+v want %+v", q, gotDiag, wantDiag)
+		}
+		if wantDiag.DedupByID == 0 || wantDiag.DedupByGH == 0 || wantDiag.SkippedMalformed != 1 {
+			t.Fatalf("fixture should exercise both dedup paths and a skip: %+v", wantDiag)
+		}
+	}
+
+	strict := NewAdvanced()
+	strict.ParseWorkers = 8
+	if _, _, err := strict.MergeRequest(base); err == nil {
+		t.Fatalf("malformed feature should fail the parallel merge without SkipMalformed")
+	}
+}
+
+func Test_CanonicalGeometryHash_RingStartVertex(t *testing.T) {
+	// the same square with a hole, each ring starting at a different vertex
+	a := json.RawMessage(`{"type":"Polygon","coordinates":[[[0,0],[4,0],[4,4],[0,4],[0,0]],[[1,1],[1,2],[2,2],[2,1],[1,1]]]}`)
+	b := json.RawMessage(`{"type":"Polygon","coordinates":[[[4,4],[0,4],[0,0],[4,0],[4,4]],[[2,2],[2,1],[1,1],[1,2],[2,2]]]}`)
+
+	ga, _ := GeometryHash(a, DefaultGeomPrecision)
+	gb, _ := GeometryHash(b, DefaultGeomPrecision)
+	if ga == gb {
+		t.Fatalf("plain hash should still depend on the starting vertex")
+	}
+	ca, err := CanonicalGeometryHash(a, DefaultGeomPrecision)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cb, err := CanonicalGeometryHash(b, DefaultGeomPrecision)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca != cb {
+		t.Fatalf("canonical hashes differ: %s vs %s", ca, cb)
+	}
+	other, _ := CanonicalGeometryHash(json.RawMessage(`{"type":"Polygon","coordinates":[[[0,0],[5,0],[5,5],[0,5],[0,0]]]}`), DefaultGeomPrecision)
+	if other == ca {
+		t.Fatalf("different polygons must not collide")
+	}
+
+	feat := func(name string, g json.RawMessage) json.RawMessage {
+		return json.RawMessage(`{"type":"Feature","geometry":` + string(g) + `,"properties":{"name":"` + name + `"}}`)
+	}
+	req := Request{Shards: []ShardPage{
+		{Features: []json.RawMessage{feat("a", a)}},
+		{Features: []json.RawMessage{feat("b", b)}},
+	}}
+	agg := NewAdvanced()
+	if _, diag, _ := agg.MergeRequest(req); diag.TotalOut != 2 {
+		t.Fatalf("without CanonicalRings both features should survive: %+v", diag)
+	}
+	agg.CanonicalRings = true
+	if _, diag, _ := agg.MergeRequest(req); diag.TotalOut != 1 || diag.DedupByGH != 1 {
+		t.Fatalf("with CanonicalRings the rings should dedup: %+v", diag)
+	}
+}
+
+func Test_MergeRequest_NumberMatchedWithLimit(t *testing.T) {
+	pt := func(id, x string) json.RawMessage {
+		return json.RawMessage(`{"type":"Feature","id":"` + id + `","geometry":{"type":"Point","coordinates":[` + x + `,55]},"properties":{}}`)
+	}
+	req := Request{
+		Query: Query{Limit: 2},
+		Shards: []ShardPage{
+			{Features: []json.RawMessage{pt("a", "1"), pt("b", "2")}, NumberMatched: 5},
+			{Features: []json.RawMessage{pt("b", "2"), pt("c", "3")}},
+		},
+	}
+
+	out, diag, err := NewAdvanced().MergeRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fc struct {
+		Features       []json.RawMessage `json:"features"`
+		NumberMatched  *int              `json:"numberMatched"`
+		NumberReturned *int              `json:"numberReturned"`
+	}
+	if err := json.Unmarshal(out, &fc); err != nil {
+		t.Fatal(err)
+	}
+	// 3 distinct features seen plus 3 the first shard's upstream didn't return
+	if fc.NumberMatched == nil || *fc.NumberMatched != 6 || diag.Matched != 6 {
+		t.Fatalf("numberMatched=%v diag=%+v want 6", fc.NumberMatched, diag)
+	}
+	if fc.NumberReturned == nil || *fc.NumberReturned != 2 || len(fc.Features) != 2 {
+		t.Fatalf("numberReturned=%v features=%d want 2", fc.NumberReturned, len(fc.Features))
+	}
+
+	req.Query.Limit = 0
+	out, _, _ = NewAdvanced().MergeRequest(req)
+	if strings.Contains(string(out), "numberMatched") {
+		t.Fatalf("unpaged output should not carry counts: %s", out)
+	}
+}
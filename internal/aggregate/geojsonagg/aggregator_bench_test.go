@@ -83,3 +83,38 @@ func BenchmarkMergeRequest_KWay(b *testing.B) {
 		}
 	}
 }
+
+// builds a full-hit request of cells shards, each with perCell point features;
+// neighbouring cells share a third of their features to exercise dedup
+func cellShards(cells, perCell int) Request {
+	req := Request{Shards: make([]ShardPage, cells)}
+	for c := range cells {
+		req.Shards[c] = ShardPage{Meta: ShardMeta{FromCache: true, ID: fmt.Sprintf("c%d", c)}}
+		for i := range perCell {
+			n := c*perCell + i
+			if i < perCell/3 && c > 0 {
+				n -= perCell // shared with the previous cell
+			}
+			feat := fmt.Sprintf(`{"type":"Feature","id":"f%d","geometry":{"type":"Point","coordinates":[%.6f,%.6f]},"properties":{"rank":%d}}`,
+				n, 18+float64(n)/1e4, 59+float64(n)/1e4, n)
+			req.Shards[c].Features = append(req.Shards[c].Features, json.RawMessage(feat))
+		}
+	}
+	return req
+}
+
+func BenchmarkMergeRequest_100Cells10k(b *testing.B) {
+	req := cellShards(100, 100)
+	for _, workers := range []int{0, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			agg := NewAdvanced()
+			agg.ParseWorkers = workers
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, _, err := agg.MergeRequest(req); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
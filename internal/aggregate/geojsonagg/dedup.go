@@ -0,0 +1,85 @@
+package geojsonagg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
+)
+
+// Deduper applies MergeRequest's dedup rules to features one at a time, for
+// callers streaming a single upstream body that can't be held as a shard.
+// Only the seen ids and geometry hashes are kept in memory
+type Deduper struct {
+	a      *Aggregator
+	idProp string
+	seenID map[string]struct{}
+	seenGH map[string]struct{}
+	Diag   Diagnostics
+}
+
+// NewDeduper starts a dedup pass; idProp names the property used as the id
+// of features without a top-level one, like Query.IDProperty
+func (a *Aggregator) NewDeduper(idProp string) *Deduper {
+	return &Deduper{
+		a:      a,
+		idProp: idProp,
+		seenID: map[string]struct{}{},
+		seenGH: map[string]struct{}{},
+	}
+}
+
+// Keep reports whether f is the first feature seen with its id and its
+// geometry. Malformed features are dropped with SkipMalformed and are an
+// error otherwise
+func (d *Deduper) Keep(f json.RawMessage) (bool, error) {
+	var obj map[string]json.RawMessage
+	err := json.Unmarshal(f, &obj)
+	if err == nil && obj == nil {
+		err = errors.New("feature is null")
+	}
+	if err != nil {
+		observability.IncSpatialAggError("parse")
+		if d.a.SkipMalformed {
+			d.Diag.SkippedMalformed++
+			return false, nil
+		}
+		return false, fmt.Errorf("feature parse idx=%d: %w", d.Diag.TotalIn+d.Diag.SkippedMalformed, err)
+	}
+	d.Diag.TotalIn++
+	if !d.a.EnableDedup {
+		d.Diag.TotalOut++
+		return true, nil
+	}
+
+	idRaw := obj["id"]
+	if len(idRaw) == 0 && d.idProp != "" {
+		idRaw = PropertyID(obj["properties"], d.idProp)
+	}
+	key := ""
+	if len(idRaw) > 0 {
+		if key, err = canonicalIDKey(idRaw); err != nil {
+			return false, fmt.Errorf("invalid feature id: %w", err)
+		}
+		if _, ok := d.seenID[key]; ok {
+			d.Diag.DedupByID++
+			return false, nil
+		}
+	}
+
+	gh, err := d.a.hashGeometry(obj["geometry"], d.a.GeomPrecision)
+	if err != nil {
+		return false, fmt.Errorf("geom hash: %w", err)
+	}
+	if key != "" {
+		d.seenID[key] = struct{}{}
+	}
+	if _, ok := d.seenGH[gh]; ok {
+		d.Diag.DedupByGH++
+		return false, nil
+	}
+	d.seenGH[gh] = struct{}{}
+	d.Diag.TotalOut++
+	return true, nil
+}
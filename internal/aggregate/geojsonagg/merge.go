@@ -3,16 +3,33 @@ package geojsonagg
 import (
 	"container/heap"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
 )
 
 type Aggregator struct {
 	EnableDedup   bool
 	GeomPrecision int
 	Prefetch      int
+	// ParseWorkers > 1 parses shards up front across that many goroutines
+	// before the merge; output is identical to the serial path
+	ParseWorkers int
+	// CanonicalRings hashes geometries with CanonicalGeometryHash so rings
+	// differing only in starting vertex dedup; stored shard hashes must match
+	CanonicalRings bool
+	// SkipMalformed drops features that fail to parse instead of failing the merge
+	SkipMalformed bool
+	// DedupStrict flags features that share an ID but differ in geometry; the
+	// first one is still kept
+	DedupStrict bool
 }
 
 const DefaultGeomPrecision = 7
@@ -48,27 +65,65 @@ func (a *Aggregator) MergeRequest(req Request) ([]byte, Diagnostics, error) {
 		diag.HitClass = PartialHit
 	}
 
+	// precomputed shard hashes are only valid at the aggregator's own precision
+	precision := a.GeomPrecision
+	useStoredHashes := true
+	if p := req.Query.GeomPrecision; p > 0 && p != precision {
+		precision = p
+		useStoredHashes = false
+	}
+
+	hash := func(g json.RawMessage) (string, error) { return a.hashGeometry(g, precision) }
+
 	iters := make([]*featIter, 0, len(req.Shards))
 	for si := range req.Shards {
+		var hashes []string
+		if useStoredHashes {
+			hashes = req.Shards[si].GeomHashes
+		}
 		it := &featIter{
 			shardIdx:   si,
 			features:   req.Shards[si].Features,
-			geomHashes: req.Shards[si].GeomHashes,
+			geomHashes: hashes,
 			pos:        0,
 			getCmp:     func(f featureParsed) []cmpValue { return extractSortTuple(f, req.Query.Sort) },
+			idProp:     req.Query.IDProperty,
+			skipBad:    a.SkipMalformed,
 		}
 		iters = append(iters, it)
 	}
 
+	if a.ParseWorkers > 1 && len(iters) > 1 {
+		var pre func(json.RawMessage) (string, error)
+		if a.EnableDedup {
+			pre = hash
+		}
+		if err := preloadAll(iters, req.Query.Sort, pre, a.ParseWorkers); err != nil {
+			return nil, diag, err
+		}
+	} else if len(req.Query.Sort) > 0 {
+		for _, it := range iters {
+			if err := it.preload(req.Query.Sort, nil); err != nil {
+				return nil, diag, err
+			}
+		}
+	}
+
 	h := &featHeap{sort: req.Query.Sort}
 	heap.Init(h)
-	for _, it := range iters {
+	advance := func(it *featIter) error {
 		if f, ok := it.next(); ok {
 			heap.Push(h, f)
 		}
+		return it.err
+	}
+	for _, it := range iters {
+		if err := advance(it); err != nil {
+			return nil, diag, err
+		}
 	}
 
-	seenID := map[string]struct{}{}
+	seenID := map[string]string{}
 	seenGH := map[string]struct{}{}
 	var outFeatures []json.RawMessage
 	outFeatures = make([]json.RawMessage, 0, 128)
@@ -77,6 +132,7 @@ func (a *Aggregator) MergeRequest(req Request) ([]byte, Diagnostics, error) {
 	emitted := 0
 	start := req.Query.StartIndex
 	limit := max(req.Query.Limit, 0)
+	timeRange := req.Query.TimeProperty != "" && (!req.Query.CreatedAfter.IsZero() || !req.Query.CreatedBefore.IsZero())
 	if start < 0 {
 		start = 0
 	}
@@ -92,19 +148,30 @@ func (a *Aggregator) MergeRequest(req Request) ([]byte, Diagnostics, error) {
 					return nil, diag, fmt.Errorf("invalid feature id: %w", idErr)
 				}
 				if key != "" {
-					if _, ok := seenID[key]; ok {
+					if a.DedupStrict && fp.geomHash == "" {
+						gh, err := hash(fp.geomRaw)
+						if err != nil {
+							return nil, diag, fmt.Errorf("geom hash: %w", err)
+						}
+						fp.geomHash = gh
+					}
+					if firstGH, ok := seenID[key]; ok {
 						diag.DedupByID++
-						if f, ok := fp.iter.next(); ok {
-							heap.Push(h, f)
+						if a.DedupStrict && firstGH != fp.geomHash {
+							diag.IDConflicts++
+							observability.IncSpatialAggError("id_conflict")
+						}
+						if err := advance(fp.iter); err != nil {
+							return nil, diag, err
 						}
 						continue
 					}
-					seenID[key] = struct{}{}
+					seenID[key] = fp.geomHash
 				}
 			}
 
 			if fp.geomHash == "" {
-				gh, err := GeometryHash(fp.geomRaw, a.GeomPrecision)
+				gh, err := hash(fp.geomRaw)
 				if err != nil {
 					return nil, diag, fmt.Errorf("geom hash: %w", err)
 				}
@@ -112,14 +179,23 @@ func (a *Aggregator) MergeRequest(req Request) ([]byte, Diagnostics, error) {
 			}
 			if _, ok := seenGH[fp.geomHash]; ok {
 				diag.DedupByGH++
-				if f, ok := fp.iter.next(); ok {
-					heap.Push(h, f)
+				if err := advance(fp.iter); err != nil {
+					return nil, diag, err
 				}
 				continue
 			}
 			seenGH[fp.geomHash] = struct{}{}
 		}
 
+		if timeRange && !inTimeRange(fp.raw, req.Query) {
+			diag.TimeFiltered++
+			if err := advance(fp.iter); err != nil {
+				return nil, diag, err
+			}
+			continue
+		}
+
+		diag.Matched++
 		switch {
 		case skipped < start:
 			skipped++
@@ -128,19 +204,30 @@ func (a *Aggregator) MergeRequest(req Request) ([]byte, Diagnostics, error) {
 			emitted++
 		}
 
-		if f, ok := fp.iter.next(); ok {
-			heap.Push(h, f)
+		if err := advance(fp.iter); err != nil {
+			return nil, diag, err
 		}
 	}
 	diag.TotalOut = len(outFeatures)
+	for _, it := range iters {
+		diag.SkippedMalformed += it.skipped
+	}
+	diag.Matched += unreturned(req.Shards)
 
 	out := struct {
-		Type     string            `json:"type"`
-		Features []json.RawMessage `json:"features"`
+		Type           string            `json:"type"`
+		Features       []json.RawMessage `json:"features"`
+		NumberMatched  *int              `json:"numberMatched,omitempty"`
+		NumberReturned *int              `json:"numberReturned,omitempty"`
 	}{
 		Type:     "FeatureCollection",
 		Features: outFeatures,
 	}
+	// counts are only reported when paging, so unpaged output is unchanged
+	if limit > 0 || start > 0 {
+		out.NumberMatched = &diag.Matched
+		out.NumberReturned = &diag.TotalOut
+	}
 	buf, err := json.Marshal(out)
 	if err != nil {
 		return nil, diag, fmt.Errorf("marshal output: %w", err)
@@ -148,6 +235,23 @@ func (a *Aggregator) MergeRequest(req Request) ([]byte, Diagnostics, error) {
 	return buf, diag, nil
 }
 
+// counts features upstream shards matched but did not return; those were
+// never seen so they can't be deduped, and the total is an upper bound
+func unreturned(shards []ShardPage) int {
+	n := 0
+	for _, s := range shards {
+		n += max(s.NumberMatched-len(s.Features), 0)
+	}
+	return n
+}
+
+func (a *Aggregator) hashGeometry(g json.RawMessage, precision int) (string, error) {
+	if a.CanonicalRings {
+		return CanonicalGeometryHash(g, precision)
+	}
+	return GeometryHash(g, precision)
+}
+
 type featureParsed struct {
 	raw      json.RawMessage
 	idRaw    json.RawMessage
@@ -165,19 +269,112 @@ type featIter struct {
 	geomHashes []string
 	pos        int
 	getCmp     func(featureParsed) []cmpValue
+	parsed     []featureParsed
+	skipBad    bool
+	skipped    int
+	idProp     string
+	err        error
+}
+
+// parses the whole shard up front and orders it by the sort keys, so the
+// k-way merge stays correct even when shards arrive unsorted. A non-nil hash
+// also precomputes missing geometry hashes; a failed hash is left for the
+// merge to recompute and report
+func (it *featIter) preload(keys []SortKey, hash func(json.RawMessage) (string, error)) error {
+	buf := make([]featureParsed, 0, len(it.features))
+	for {
+		fp, ok := it.next()
+		if !ok {
+			break
+		}
+		if hash != nil && fp.geomHash == "" {
+			if gh, err := hash(fp.geomRaw); err == nil {
+				fp.geomHash = gh
+			}
+		}
+		buf = append(buf, fp)
+	}
+	if it.err != nil {
+		return it.err
+	}
+	if len(keys) > 0 {
+		sort.SliceStable(buf, func(i, j int) bool {
+			return compareTuples(buf[i].sortVals, buf[j].sortVals, keys) < 0
+		})
+	}
+	it.parsed = buf
+	it.pos = 0
+	return nil
+}
+
+// preloads every iterator across workers goroutines; each shard keeps its own
+// order, and the first error by shard index is returned so failures stay
+// deterministic
+func preloadAll(iters []*featIter, keys []SortKey, hash func(json.RawMessage) (string, error), workers int) error {
+	next := make(chan *featIter)
+	var wg sync.WaitGroup
+	for range min(workers, len(iters)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for it := range next {
+				_ = it.preload(keys, hash)
+			}
+		}()
+	}
+	for _, it := range iters {
+		next <- it
+	}
+	close(next)
+	wg.Wait()
+
+	for _, it := range iters {
+		if it.err != nil {
+			return it.err
+		}
+	}
+	return nil
 }
 
-// returns the next featureParsed from the iterator
+// returns the next featureParsed from the iterator; on a malformed feature it
+// either skips it (skipBad) or stops and records the error in it.err
 func (it *featIter) next() (featureParsed, bool) {
-	if it.pos >= len(it.features) {
+	if it.parsed != nil {
+		if it.pos >= len(it.parsed) {
+			return featureParsed{}, false
+		}
+		fp := it.parsed[it.pos]
+		it.pos++
+		return fp, true
+	}
+	if it.err != nil {
 		return featureParsed{}, false
 	}
-	raw := it.features[it.pos]
-	it.pos++
 
+	var raw json.RawMessage
 	var obj map[string]json.RawMessage
-	if err := json.Unmarshal(raw, &obj); err != nil {
-		panic(fmt.Errorf("feature parse shard=%d idx=%d: %w", it.shardIdx, it.pos-1, err))
+	for {
+		if it.pos >= len(it.features) {
+			return featureParsed{}, false
+		}
+		raw = it.features[it.pos]
+		it.pos++
+
+		obj = nil
+		err := json.Unmarshal(raw, &obj)
+		if err == nil && obj != nil {
+			break
+		}
+		if err == nil {
+			err = errors.New("feature is null")
+		}
+		observability.IncSpatialAggError("parse")
+		if it.skipBad {
+			it.skipped++
+			continue
+		}
+		it.err = fmt.Errorf("feature parse shard=%d idx=%d: %w", it.shardIdx, it.pos-1, err)
+		return featureParsed{}, false
 	}
 	fp := featureParsed{
 		raw:      raw,
@@ -187,6 +384,9 @@ func (it *featIter) next() (featureParsed, bool) {
 		localIdx: it.pos - 1,
 		iter:     it,
 	}
+	if len(fp.idRaw) == 0 && it.idProp != "" {
+		fp.idRaw = PropertyID(obj["properties"], it.idProp)
+	}
 
 	if len(it.geomHashes) > 0 && fp.localIdx < len(it.geomHashes) {
 		fp.geomHash = it.geomHashes[fp.localIdx]
@@ -246,7 +446,8 @@ func extractSortTuple(fp featureParsed, keys []SortKey) []cmpValue {
 	return out
 }
 
-// represents a value for comparison during sorting
+// represents a value for comparison during sorting; a declared hint is
+// honored strictly, values that cannot be coerced to it compare as null
 func coerceCmpValue(v any, hint string) cmpValue {
 	if v == nil {
 		return cmpValue{kind: kindNull, null: true}
@@ -256,12 +457,20 @@ func coerceCmpValue(v any, hint string) cmpValue {
 		if f, ok := toFloat(v); ok {
 			return cmpValue{kind: kindNumber, n: f}
 		}
-		return cmpValue{kind: kindString, s: fmt.Sprintf("%v", v)}
+		if s, ok := v.(string); ok {
+			if f, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil && !math.IsNaN(f) {
+				return cmpValue{kind: kindNumber, n: f}
+			}
+		}
+		return cmpValue{kind: kindNull, null: true}
 	case "time":
 		if t, ok := toTime(v); ok {
 			return cmpValue{kind: kindTime, t: t}
 		}
-		return cmpValue{kind: kindString, s: fmt.Sprintf("%v", v)}
+		if f, ok := toFloat(v); ok {
+			return cmpValue{kind: kindTime, t: time.Unix(0, int64(f*float64(time.Second))).UTC()}
+		}
+		return cmpValue{kind: kindNull, null: true}
 	case "string":
 		return cmpValue{kind: kindString, s: fmt.Sprintf("%v", v)}
 	}
@@ -289,6 +498,28 @@ func toFloat(v any) (float64, bool) {
 	}
 }
 
+// reports whether the feature's q.TimeProperty lies within the inclusive
+// [CreatedAfter, CreatedBefore] range; missing or unparseable timestamps are out
+func inTimeRange(raw json.RawMessage, q Query) bool {
+	var obj struct {
+		Properties map[string]any `json:"properties"`
+	}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return false
+	}
+	t, ok := toTime(obj.Properties[q.TimeProperty])
+	if !ok {
+		return false
+	}
+	if !q.CreatedAfter.IsZero() && t.Before(q.CreatedAfter) {
+		return false
+	}
+	if !q.CreatedBefore.IsZero() && t.After(q.CreatedBefore) {
+		return false
+	}
+	return true
+}
+
 func toTime(v any) (time.Time, bool) {
 	switch t := v.(type) {
 	case string:
@@ -448,3 +679,20 @@ func canonicalIDKey(idRaw json.RawMessage) (string, error) {
 func CanonicalIDKey(idRaw json.RawMessage) (string, error) {
 	return canonicalIDKey(idRaw)
 }
+
+// PropertyID returns properties[name] when it is usable as a feature id
+// (a string or number), otherwise nil
+func PropertyID(propsRaw json.RawMessage, name string) json.RawMessage {
+	if len(propsRaw) == 0 || name == "" {
+		return nil
+	}
+	var props map[string]json.RawMessage
+	if err := json.Unmarshal(propsRaw, &props); err != nil {
+		return nil
+	}
+	v := props[name]
+	if _, err := canonicalIDKey(v); err != nil || len(v) == 0 {
+		return nil
+	}
+	return v
+}
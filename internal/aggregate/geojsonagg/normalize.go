@@ -11,6 +11,17 @@ import (
 
 // GeometryHash computes a hash of the given GeoJSON geometry
 func GeometryHash(geomRaw json.RawMessage, precision int) (string, error) {
+	return geometryHash(geomRaw, precision, false)
+}
+
+// CanonicalGeometryHash is GeometryHash with every polygon ring also rotated to
+// start at its lexicographically smallest vertex, so rings that differ only in
+// their starting vertex hash alike. It costs an extra pass over each ring.
+func CanonicalGeometryHash(geomRaw json.RawMessage, precision int) (string, error) {
+	return geometryHash(geomRaw, precision, true)
+}
+
+func geometryHash(geomRaw json.RawMessage, precision int, canonical bool) (string, error) {
 	if len(bytes.TrimSpace(geomRaw)) == 0 || bytes.Equal(geomRaw, []byte("null")) {
 		return "gh:null", nil
 	}
@@ -18,7 +29,7 @@ func GeometryHash(geomRaw json.RawMessage, precision int) (string, error) {
 	if err := json.Unmarshal(geomRaw, &g); err != nil {
 		return "", fmt.Errorf("parse geometry: %w", err)
 	}
-	normalized, err := normalizeGeometry(g, precision)
+	normalized, err := normalizeGeometry(g, precision, canonical)
 	if err != nil {
 		return "", fmt.Errorf("normalize geometry: %w", err)
 	}
@@ -30,7 +41,7 @@ func GeometryHash(geomRaw json.RawMessage, precision int) (string, error) {
 	return fmt.Sprintf("gh:%x", sum[:]), nil
 }
 
-func normalizeGeometry(g any, precision int) (any, error) {
+func normalizeGeometry(g any, precision int, canonical bool) (any, error) {
 	m, ok := g.(map[string]any)
 	if !ok {
 		return nil, fmt.Errorf("geometry must be object")
@@ -49,11 +60,17 @@ func normalizeGeometry(g any, precision int) (any, error) {
 	case "Polygon":
 		rings := roundPosArray2(coords, precision)
 		rings = orientPolygonRings(rings)
+		if canonical {
+			rotateRings(rings)
+		}
 		return map[string]any{"type": "Polygon", "coordinates": rings}, nil
 	case "MultiPolygon":
 		mp := roundPosArray3(coords, precision)
 		for i := range mp {
 			mp[i] = orientPolygonRings(mp[i])
+			if canonical {
+				rotateRings(mp[i])
+			}
 		}
 		sort.Slice(mp, func(i, j int) bool { return lex3(mp[i], mp[j]) < 0 })
 		return map[string]any{"type": "MultiPolygon", "coordinates": mp}, nil
@@ -61,7 +78,7 @@ func normalizeGeometry(g any, precision int) (any, error) {
 		arr, _ := m["geometries"].([]any)
 		out := make([]any, 0, len(arr))
 		for _, gi := range arr {
-			ng, err := normalizeGeometry(gi, precision)
+			ng, err := normalizeGeometry(gi, precision, canonical)
 			if err != nil {
 				return nil, err
 			}
@@ -172,6 +189,46 @@ func reverseRing(r [][]any) [][]any {
 	return out
 }
 
+// rotates each closed ring in place to start at its smallest vertex, ordered
+// by x then y; run after orientation, which may reverse the ring
+func rotateRings(rings [][][]any) {
+	for i, r := range rings {
+		n := len(r)
+		if n < 4 || !samePos(r[0], r[n-1]) {
+			continue
+		}
+		open := r[:n-1]
+		start := 0
+		for j := 1; j < len(open); j++ {
+			if lessPos(open[j], open[start]) {
+				start = j
+			}
+		}
+		if start == 0 {
+			continue
+		}
+		out := make([][]any, 0, n)
+		out = append(out, open[start:]...)
+		out = append(out, open[:start]...)
+		rings[i] = append(out, open[start])
+	}
+}
+
+func lessPos(a, b []any) bool {
+	for k := 0; k < len(a) && k < len(b); k++ {
+		x, _ := a[k].(float64)
+		y, _ := b[k].(float64)
+		if x != y {
+			return x < y
+		}
+	}
+	return len(a) < len(b)
+}
+
+func samePos(a, b []any) bool {
+	return !lessPos(a, b) && !lessPos(b, a)
+}
+
 func lex3(a, b [][][]any) int {
 	ba, _ := json.Marshal(a)
 	bb, _ := json.Marshal(b)
@@ -77,6 +77,15 @@ type Query struct {
 	Sort       []SortKey      `json:"sort,omitempty"`
 	Limit      int            `json:"limit,omitempty"`
 	StartIndex int            `json:"startIndex,omitempty"`
+	// GeomPrecision overrides Aggregator.GeomPrecision for this request when > 0
+	GeomPrecision int `json:"geomPrecision,omitempty"`
+	// IDProperty names the property used as feature id when "id" is absent
+	IDProperty string `json:"idProperty,omitempty"`
+	// TimeProperty names the timestamp property checked against CreatedAfter
+	// and CreatedBefore; a zero bound is open
+	TimeProperty  string    `json:"timeProperty,omitempty"`
+	CreatedAfter  time.Time `json:"createdAfter,omitzero"`
+	CreatedBefore time.Time `json:"createdBefore,omitzero"`
 }
 
 type HitClass string
@@ -96,6 +105,9 @@ type ShardPage struct {
 	Meta       ShardMeta         `json:"meta"`
 	Features   []json.RawMessage `json:"features"`
 	GeomHashes []string          `json:"geomHashes,omitempty"`
+	// NumberMatched is the upstream's reported match count when it exceeds
+	// len(Features), i.e. the upstream capped the page; zero means unknown
+	NumberMatched int `json:"numberMatched,omitempty"`
 }
 
 type Request struct {
@@ -109,6 +121,15 @@ type Diagnostics struct {
 	TotalOut  int      `json:"total_out"`
 	DedupByID int      `json:"dedup_by_id"`
 	DedupByGH int      `json:"dedup_by_geom"`
+	// SkippedMalformed counts features dropped because they failed to parse
+	SkippedMalformed int `json:"skipped_malformed,omitempty"`
+	// IDConflicts counts same-ID features with differing geometry (DedupStrict)
+	IDConflicts int `json:"id_conflicts,omitempty"`
+	// TimeFiltered counts features dropped by the created_after/created_before range
+	TimeFiltered int `json:"time_filtered,omitempty"`
+	// Matched is the total after dedup and filtering, before offset/limit,
+	// plus any features upstream shards reported but did not return
+	Matched int `json:"matched"`
 }
 
 type valueKind int
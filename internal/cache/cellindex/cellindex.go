@@ -2,9 +2,11 @@
 package cellindex
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/keys"
@@ -21,9 +23,70 @@ type CellIndex interface {
 
 	MGetIDs(ctx context.Context, layer string, res int, cells []string, filters model.Filters) (map[string][]string, error)
 
+	// DelCells deletes the cells' entries for filters; empty filters deletes
+	// every filter variant of the cells
 	DelCells(ctx context.Context, layer string, res int, cells []string, filters model.Filters) error
 }
 
+// EmptyMarkerCounter is implemented by indexes that can report how many cell
+// entries hold only the empty marker; sample bounds the work per call
+type EmptyMarkerCounter interface {
+	CountEmptyMarkers(ctx context.Context, sample int) (int64, error)
+}
+
+// IDDropper is implemented by indexes that can delete every entry of layer
+// referencing one of ids, across resolutions, filters and header scopes.
+// There is no reverse index, so this walks the layer's keys in batches
+type IDDropper interface {
+	DropIDs(ctx context.Context, layer string, ids []string) (int, error)
+}
+
+// Inspector is implemented by indexes that can report a single entry with
+// its remaining TTL: ids is nil when the entry is missing, and ttl is
+// negative when it never expires
+type Inspector interface {
+	Inspect(ctx context.Context, layer string, res int, cell string, filters model.Filters) (ids []string, ttl time.Duration, err error)
+}
+
+// Validator is what a cell's last upstream response offered for conditional
+// GETs, with the ids the cell index got from it and the reported
+// numberMatched, so a 304 can rebuild the entry from cached features
+type Validator struct {
+	ETag         string   `json:"etag,omitempty"`
+	LastModified string   `json:"last_modified,omitempty"`
+	IDs          []string `json:"ids"`
+	Matched      int      `json:"matched,omitempty"`
+}
+
+// ValidatorStore is implemented by indexes that can keep a cell's upstream
+// validators apart from its entry, so they outlive it and an expired cell
+// can be revalidated instead of refetched. ok is false when none are stored
+type ValidatorStore interface {
+	GetValidator(ctx context.Context, layer string, res int, cell string, filters model.Filters) (v Validator, ok bool, err error)
+	SetValidator(ctx context.Context, layer string, res int, cell string, filters model.Filters, v Validator, ttl time.Duration) error
+}
+
+// ScopeLister is implemented by stores that can list the header scopes
+// (keys.ScopedLayer values) holding entries of layer, so invalidation can
+// reach every localized copy. The bare layer is not included
+type ScopeLister interface {
+	Scopes(ctx context.Context, layer string) ([]string, error)
+}
+
+// encoded form of an index entry holding only EmptyMarkerID
+var emptyMarkerPayload, _ = json.Marshal([]string{EmptyMarkerID})
+
+func isEmptyMarker(raw []byte) bool {
+	return bytes.Equal(raw, emptyMarkerPayload)
+}
+
+// delBatch bounds the keys per DEL when a cell has many filter variants, and
+// readBatch the keys per MGET when DropIDs walks a layer's index
+const (
+	delBatch  = 1000
+	readBatch = 500
+)
+
 type redisCellIndex struct {
 	cli *redisstore.Client
 }
@@ -75,21 +138,14 @@ func (ci *redisCellIndex) SetIDs(
 		return nil
 	}
 
-	uniq := make([]string, 0, len(ids))
-	seen := make(map[string]struct{}, len(ids))
-	for _, id := range ids {
-		if _, ok := seen[id]; ok {
-			continue
-		}
-		seen[id] = struct{}{}
-		uniq = append(uniq, id)
-	}
-
-	payload, err := json.Marshal(uniq)
+	payload, err := encodeIDs(ids)
 	if err != nil {
-		return fmt.Errorf("cellindex encode ids: %w", err)
+		return err
 	}
 
+	if err := ci.register(ctx, layer, res, filters, ttl); err != nil {
+		return err
+	}
 	if err := ci.cli.Set(ctx, key, payload, ttl); err != nil {
 		return fmt.Errorf("cellindex redis SET %q: %w", key, err)
 	}
@@ -139,6 +195,111 @@ func (ci *redisCellIndex) MGetIDs(
 	return out, nil
 }
 
+func (ci *redisCellIndex) Inspect(ctx context.Context, layer string, res int, cell string, filters model.Filters) ([]string, time.Duration, error) {
+	ids, err := ci.GetIDs(ctx, layer, res, cell, filters)
+	if err != nil || ids == nil {
+		return nil, 0, err
+	}
+	ttl, err := ci.cli.TTL(ctx, keys.CellIndexKey(layer, res, cell, filters))
+	if err != nil {
+		return nil, 0, fmt.Errorf("cellindex ttl: %w", err)
+	}
+	if ttl == -2 {
+		// expired between the two reads
+		return nil, 0, nil
+	}
+	return ids, ttl, nil
+}
+
+func (ci *redisCellIndex) GetValidator(ctx context.Context, layer string, res int, cell string, filters model.Filters) (Validator, bool, error) {
+	key := keys.CellValidatorKey(layer, res, cell, filters)
+	rawMap, err := ci.cli.MGet(ctx, []string{key})
+	if err != nil {
+		return Validator{}, false, fmt.Errorf("cellindex redis MGET %q: %w", key, err)
+	}
+	return decodeValidator(rawMap[key])
+}
+
+func (ci *redisCellIndex) SetValidator(ctx context.Context, layer string, res int, cell string, filters model.Filters, v Validator, ttl time.Duration) error {
+	key := keys.CellValidatorKey(layer, res, cell, filters)
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("cellindex encode validator: %w", err)
+	}
+	if err := ci.register(ctx, layer, res, filters, ttl); err != nil {
+		return err
+	}
+	if err := ci.cli.Set(ctx, key, payload, ttl); err != nil {
+		return fmt.Errorf("cellindex redis SET %q: %w", key, err)
+	}
+	return nil
+}
+
+// register records filters as a variant of layer at res, and a header-scoped
+// layer as a scope of its base layer, before an entry under them is written,
+// so DelCells and Scopes can find the entry without scanning
+func (ci *redisCellIndex) register(ctx context.Context, layer string, res int, filters model.Filters, ttl time.Duration) error {
+	if filters != "" {
+		if err := ci.cli.SAdd(ctx, keys.CellFiltersKey(layer, res), ttl, string(filters)); err != nil {
+			return fmt.Errorf("cellindex register filters: %w", err)
+		}
+	}
+	if base, ok := keys.ScopeBase(layer); ok {
+		if err := ci.cli.SAdd(ctx, keys.LayerScopesKey(base), ttl, layer); err != nil {
+			return fmt.Errorf("cellindex register scope: %w", err)
+		}
+	}
+	return nil
+}
+
+// decodeValidator treats a missing payload, or one with nothing to validate
+// against, as no validator
+func decodeValidator(raw []byte) (Validator, bool, error) {
+	if len(raw) == 0 {
+		return Validator{}, false, nil
+	}
+	var v Validator
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return Validator{}, false, fmt.Errorf("cellindex decode validator: %w", err)
+	}
+	if (v.ETag == "" && v.LastModified == "") || len(v.IDs) == 0 {
+		return Validator{}, false, nil
+	}
+	return v, true, nil
+}
+
+// Scopes reads the scopes registered for layer; a scope stays listed until
+// the set expires, after its longest-lived entry
+func (ci *redisCellIndex) Scopes(ctx context.Context, layer string) ([]string, error) {
+	out, err := ci.cli.SMembers(ctx, keys.LayerScopesKey(layer))
+	if err != nil {
+		return nil, fmt.Errorf("cellindex scopes: %w", err)
+	}
+	return out, nil
+}
+
+// CountEmptyMarkers estimates empty-marker keys by SCAN sampling and scaling
+// the sampled share by the total key count; exact when the sample covers all keys
+func (ci *redisCellIndex) CountEmptyMarkers(ctx context.Context, sample int) (int64, error) {
+	vals, scanned, total, err := ci.cli.Sample(ctx, sample, "idx:")
+	if err != nil {
+		return 0, fmt.Errorf("cellindex sample: %w", err)
+	}
+	if scanned == 0 {
+		return 0, nil
+	}
+	var empty int64
+	for _, raw := range vals {
+		if isEmptyMarker(raw) {
+			empty++
+		}
+	}
+	if int64(scanned) >= total {
+		return empty, nil
+	}
+	return empty * total / int64(scanned), nil
+}
+
 func (ci *redisCellIndex) DelCells(
 	ctx context.Context,
 	layer string,
@@ -150,13 +311,122 @@ func (ci *redisCellIndex) DelCells(
 		return nil
 	}
 
-	keysToDel := make([]string, 0, len(cells))
-	for _, cell := range cells {
-		keysToDel = append(keysToDel, keys.CellIndexKey(layer, res, cell, filters))
+	variants := []model.Filters{filters}
+	if filters == "" {
+		registered, err := ci.cli.SMembers(ctx, keys.CellFiltersKey(layer, res))
+		if err != nil {
+			return fmt.Errorf("cellindex filter variants: %w", err)
+		}
+		for _, f := range registered {
+			variants = append(variants, model.Filters(f))
+		}
 	}
 
-	if err := ci.cli.Del(ctx, keysToDel...); err != nil {
-		return fmt.Errorf("cellindex redis DEL %d keys: %w", len(keysToDel), err)
+	keysToDel := make([]string, 0, 2*len(cells)*len(variants))
+	for _, f := range variants {
+		keysToDel = append(keysToDel, cellKeys(layer, res, cells, f)...)
+	}
+	for chunk := range slices.Chunk(keysToDel, delBatch) {
+		if err := ci.cli.Del(ctx, chunk...); err != nil {
+			return fmt.Errorf("cellindex redis DEL %d keys: %w", len(chunk), err)
+		}
 	}
 	return nil
 }
+
+func (ci *redisCellIndex) DropIDs(ctx context.Context, layer string, ids []string) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	all, err := ci.cli.ScanKeys(ctx, keys.CellIndexLayerPattern(layer))
+	if err != nil {
+		return 0, fmt.Errorf("cellindex redis scan layer: %w", err)
+	}
+	inLayer := all[:0]
+	for _, k := range all {
+		if keys.CellIndexInLayer(k, layer) {
+			inLayer = append(inLayer, k)
+		}
+	}
+	want := idSet(ids)
+	var dropped []string
+	for chunk := range slices.Chunk(inLayer, readBatch) {
+		vals, err := ci.cli.MGet(ctx, chunk)
+		if err != nil {
+			return 0, fmt.Errorf("cellindex redis MGET %d keys: %w", len(chunk), err)
+		}
+		dropped = append(dropped, entriesReferencing(vals, want)...)
+	}
+	if len(dropped) == 0 {
+		return 0, nil
+	}
+	keysToDel := withValidators(dropped)
+	if err := ci.cli.Del(ctx, keysToDel...); err != nil {
+		return 0, fmt.Errorf("cellindex redis DEL %d keys: %w", len(keysToDel), err)
+	}
+	return len(dropped), nil
+}
+
+func idSet(ids []string) map[string]struct{} {
+	want := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		want[id] = struct{}{}
+	}
+	return want
+}
+
+// entriesReferencing returns the keys whose encoded id list holds any id in
+// want; undecodable entries are skipped like they are on reads
+func entriesReferencing(vals map[string][]byte, want map[string]struct{}) []string {
+	var out []string
+	for k, raw := range vals {
+		var entry []string
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			continue
+		}
+		for _, id := range entry {
+			if _, ok := want[id]; ok {
+				out = append(out, k)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// cellKeys lists the index and validator keys of cells under filters
+func cellKeys(layer string, res int, cells []string, filters model.Filters) []string {
+	out := make([]string, 0, 2*len(cells))
+	for _, cell := range cells {
+		out = append(out, keys.CellIndexKey(layer, res, cell, filters), keys.CellValidatorKey(layer, res, cell, filters))
+	}
+	return out
+}
+
+// withValidators adds the validator key of each index key
+func withValidators(indexKeys []string) []string {
+	out := make([]string, 0, 2*len(indexKeys))
+	for _, k := range indexKeys {
+		out = append(out, k, keys.ValidatorKeyOf(k))
+	}
+	return out
+}
+
+// encodeIDs dedups ids (keeping first-seen order) and JSON-encodes them
+func encodeIDs(ids []string) ([]byte, error) {
+	uniq := make([]string, 0, len(ids))
+	seen := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		uniq = append(uniq, id)
+	}
+
+	payload, err := json.Marshal(uniq)
+	if err != nil {
+		return nil, fmt.Errorf("cellindex encode ids: %w", err)
+	}
+	return payload, nil
+}
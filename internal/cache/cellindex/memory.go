@@ -0,0 +1,217 @@
+package cellindex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/keys"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/memstore"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+)
+
+type memoryCellIndex struct {
+	st *memstore.Store
+}
+
+// NewMemoryIndex keeps cell indexes in-process using the same keys and encoding as Redis
+func NewMemoryIndex(st *memstore.Store) CellIndex {
+	return &memoryCellIndex{st: st}
+}
+
+func (ci *memoryCellIndex) GetIDs(ctx context.Context, layer string, res int, cell string, filters model.Filters) ([]string, error) {
+	out, err := ci.MGetIDs(ctx, layer, res, []string{cell}, filters)
+	if err != nil {
+		return nil, err
+	}
+	return out[cell], nil
+}
+
+func (ci *memoryCellIndex) SetIDs(ctx context.Context, layer string, res int, cell string, filters model.Filters, ids []string, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("cellindex memory SET: %w", err)
+	}
+	key := keys.CellIndexKey(layer, res, cell, filters)
+
+	if len(ids) == 0 {
+		if err := ci.st.Del(key); err != nil {
+			return fmt.Errorf("cellindex memory DEL %q: %w", key, err)
+		}
+		return nil
+	}
+
+	payload, err := encodeIDs(ids)
+	if err != nil {
+		return err
+	}
+	if err := ci.register(layer, res, filters, ttl); err != nil {
+		return err
+	}
+	if err := ci.st.Set(key, payload, ttl); err != nil {
+		return fmt.Errorf("cellindex memory SET %q: %w", key, err)
+	}
+	return nil
+}
+
+func (ci *memoryCellIndex) MGetIDs(ctx context.Context, layer string, res int, cells []string, filters model.Filters) (map[string][]string, error) {
+	if len(cells) == 0 {
+		return map[string][]string{}, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("cellindex memory MGET: %w", err)
+	}
+
+	keysSlice := make([]string, len(cells))
+	for i, cell := range cells {
+		keysSlice[i] = keys.CellIndexKey(layer, res, cell, filters)
+	}
+	rawMap, err := ci.st.MGet(keysSlice)
+	if err != nil {
+		return nil, fmt.Errorf("cellindex memory MGET %d keys: %w", len(keysSlice), err)
+	}
+
+	out := make(map[string][]string, len(rawMap))
+	for i, cell := range cells {
+		raw, ok := rawMap[keysSlice[i]]
+		if !ok || len(raw) == 0 {
+			continue
+		}
+		var ids []string
+		if err := json.Unmarshal(raw, &ids); err != nil {
+			continue
+		}
+		out[cell] = ids
+	}
+	return out, nil
+}
+
+func (ci *memoryCellIndex) Inspect(ctx context.Context, layer string, res int, cell string, filters model.Filters) ([]string, time.Duration, error) {
+	ids, err := ci.GetIDs(ctx, layer, res, cell, filters)
+	if err != nil || ids == nil {
+		return nil, 0, err
+	}
+	ttl := ci.st.TTL(keys.CellIndexKey(layer, res, cell, filters))
+	if ttl == -2 {
+		return nil, 0, nil
+	}
+	return ids, ttl, nil
+}
+
+func (ci *memoryCellIndex) GetValidator(ctx context.Context, layer string, res int, cell string, filters model.Filters) (Validator, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return Validator{}, false, fmt.Errorf("cellindex memory GET validator: %w", err)
+	}
+	key := keys.CellValidatorKey(layer, res, cell, filters)
+	rawMap, err := ci.st.MGet([]string{key})
+	if err != nil {
+		return Validator{}, false, fmt.Errorf("cellindex memory MGET %q: %w", key, err)
+	}
+	return decodeValidator(rawMap[key])
+}
+
+func (ci *memoryCellIndex) SetValidator(ctx context.Context, layer string, res int, cell string, filters model.Filters, v Validator, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("cellindex memory SET validator: %w", err)
+	}
+	key := keys.CellValidatorKey(layer, res, cell, filters)
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("cellindex encode validator: %w", err)
+	}
+	if err := ci.register(layer, res, filters, ttl); err != nil {
+		return err
+	}
+	if err := ci.st.Set(key, payload, ttl); err != nil {
+		return fmt.Errorf("cellindex memory SET %q: %w", key, err)
+	}
+	return nil
+}
+
+func (ci *memoryCellIndex) DelCells(ctx context.Context, layer string, res int, cells []string, filters model.Filters) error {
+	if len(cells) == 0 {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("cellindex memory DEL: %w", err)
+	}
+	variants := []model.Filters{filters}
+	if filters == "" {
+		registered, err := ci.st.SMembers(keys.CellFiltersKey(layer, res))
+		if err != nil {
+			return fmt.Errorf("cellindex memory filter variants: %w", err)
+		}
+		for _, f := range registered {
+			variants = append(variants, model.Filters(f))
+		}
+	}
+	keysToDel := make([]string, 0, 2*len(cells)*len(variants))
+	for _, f := range variants {
+		keysToDel = append(keysToDel, cellKeys(layer, res, cells, f)...)
+	}
+	if err := ci.st.Del(keysToDel...); err != nil {
+		return fmt.Errorf("cellindex memory DEL %d keys: %w", len(keysToDel), err)
+	}
+	return nil
+}
+
+func (ci *memoryCellIndex) DropIDs(ctx context.Context, layer string, ids []string) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("cellindex memory drop ids: %w", err)
+	}
+	vals := map[string][]byte{}
+	ci.st.Range(func(key string, val []byte) bool {
+		if keys.CellIndexInLayer(key, layer) {
+			vals[key] = val
+		}
+		return true
+	})
+	dropped := entriesReferencing(vals, idSet(ids))
+	keysToDel := withValidators(dropped)
+	if err := ci.st.Del(keysToDel...); err != nil {
+		return 0, fmt.Errorf("cellindex memory DEL %d keys: %w", len(keysToDel), err)
+	}
+	return len(dropped), nil
+}
+
+func (ci *memoryCellIndex) Scopes(ctx context.Context, layer string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("cellindex memory scopes: %w", err)
+	}
+	out, err := ci.st.SMembers(keys.LayerScopesKey(layer))
+	if err != nil {
+		return nil, fmt.Errorf("cellindex memory scopes: %w", err)
+	}
+	return out, nil
+}
+
+// register is the in-process counterpart of redisCellIndex.register
+func (ci *memoryCellIndex) register(layer string, res int, filters model.Filters, ttl time.Duration) error {
+	if filters != "" {
+		if err := ci.st.SAdd(keys.CellFiltersKey(layer, res), ttl, string(filters)); err != nil {
+			return fmt.Errorf("cellindex memory register filters: %w", err)
+		}
+	}
+	if base, ok := keys.ScopeBase(layer); ok {
+		if err := ci.st.SAdd(keys.LayerScopesKey(base), ttl, layer); err != nil {
+			return fmt.Errorf("cellindex memory register scope: %w", err)
+		}
+	}
+	return nil
+}
+
+// CountEmptyMarkers counts exactly; sample is ignored since the walk is in-process
+func (ci *memoryCellIndex) CountEmptyMarkers(_ context.Context, _ int) (int64, error) {
+	var n int64
+	ci.st.Range(func(key string, val []byte) bool {
+		if strings.HasPrefix(key, "idx:") && isEmptyMarker(val) {
+			n++
+		}
+		return true
+	})
+	return n, nil
+}
@@ -0,0 +1,156 @@
+package cellindex
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/keys"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/memstore"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+)
+
+func newMem(t *testing.T) *memstore.Store {
+	t.Helper()
+	st := memstore.New(0)
+	t.Cleanup(func() { _ = st.Close() })
+	return st
+}
+
+func TestMemoryCellIndex_RoundTrip_AndDedup(t *testing.T) {
+	st := newMem(t)
+	idx := NewMemoryIndex(st)
+	ctx := context.Background()
+
+	layer := "demo:NR_polygon"
+	res := 8
+	cell := "892a100d2b3ffff"
+	filters := model.Filters("status = 'active'")
+	ttl := 2 * time.Minute
+
+	if err := idx.SetIDs(ctx, layer, res, cell, filters, []string{"A", "B", "A", "C", "B"}, ttl); err != nil {
+		t.Fatalf("SetIDs: %v", err)
+	}
+	got, err := idx.GetIDs(ctx, layer, res, cell, filters)
+	if err != nil {
+		t.Fatalf("GetIDs: %v", err)
+	}
+	if want := []string{"A", "B", "C"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("GetIDs got=%v want=%v", got, want)
+	}
+
+	k := keys.CellIndexKey(layer, res, cell, filters)
+	if tt := st.TTL(k); tt <= 0 || tt > ttl {
+		t.Fatalf("unexpected TTL for key %q: %v", k, tt)
+	}
+}
+
+func TestMemoryCellIndex_GetIDs_MissingKeyReturnsNil(t *testing.T) {
+	idx := NewMemoryIndex(newMem(t))
+	ids, err := idx.GetIDs(context.Background(), "demo:layer", 7, "892a100d2b3ffff", model.Filters(""))
+	if err != nil {
+		t.Fatalf("GetIDs: %v", err)
+	}
+	if ids != nil {
+		t.Fatalf("expected nil ids for missing key, got=%v", ids)
+	}
+}
+
+func TestMemoryCellIndex_EmptyIDs_DeletesKey(t *testing.T) {
+	st := newMem(t)
+	idx := NewMemoryIndex(st)
+	ctx := context.Background()
+
+	layer, res, cell, filters := "demo:layer", 7, "892a100d2b3ffff", model.Filters("a=1")
+	if err := idx.SetIDs(ctx, layer, res, cell, filters, []string{"X"}, time.Minute); err != nil {
+		t.Fatalf("SetIDs initial: %v", err)
+	}
+	k := keys.CellIndexKey(layer, res, cell, filters)
+	if st.TTL(k) == -2 {
+		t.Fatalf("expected key %q to exist after initial SetIDs", k)
+	}
+	if err := idx.SetIDs(ctx, layer, res, cell, filters, nil, time.Minute); err != nil {
+		t.Fatalf("SetIDs empty: %v", err)
+	}
+	if st.TTL(k) != -2 {
+		t.Fatalf("expected key %q to be deleted after empty SetIDs", k)
+	}
+}
+
+func TestMemoryCellIndex_MGetIDs_AndDelCells(t *testing.T) {
+	idx := NewMemoryIndex(newMem(t))
+	ctx := context.Background()
+
+	layer, filters := "demo:layer", model.Filters("")
+	if err := idx.SetIDs(ctx, layer, 8, "c1", filters, []string{"A"}, time.Minute); err != nil {
+		t.Fatalf("SetIDs c1: %v", err)
+	}
+	if err := idx.SetIDs(ctx, layer, 8, "c2", filters, []string{EmptyMarkerID}, time.Minute); err != nil {
+		t.Fatalf("SetIDs c2: %v", err)
+	}
+
+	got, err := idx.MGetIDs(ctx, layer, 8, []string{"c1", "c2", "c3"}, filters)
+	if err != nil {
+		t.Fatalf("MGetIDs: %v", err)
+	}
+	want := map[string][]string{"c1": {"A"}, "c2": {EmptyMarkerID}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("MGetIDs got=%v want=%v", got, want)
+	}
+
+	if err := idx.DelCells(ctx, layer, 8, []string{"c1"}, filters); err != nil {
+		t.Fatalf("DelCells: %v", err)
+	}
+	got, _ = idx.MGetIDs(ctx, layer, 8, []string{"c1", "c2"}, filters)
+	if _, ok := got["c1"]; ok || len(got) != 1 {
+		t.Fatalf("expected only c2 after DelCells, got %v", got)
+	}
+}
+
+func TestMemoryCellIndex_CountEmptyMarkers(t *testing.T) {
+	idx := NewMemoryIndex(newMem(t))
+	ctx := context.Background()
+
+	_ = idx.SetIDs(ctx, "demo:layer", 8, "c1", "", []string{EmptyMarkerID}, time.Minute)
+	_ = idx.SetIDs(ctx, "demo:layer", 8, "c2", "", []string{EmptyMarkerID}, time.Minute)
+	_ = idx.SetIDs(ctx, "demo:layer", 8, "c3", "", []string{"A"}, time.Minute)
+
+	n, err := idx.(EmptyMarkerCounter).CountEmptyMarkers(ctx, 0)
+	if err != nil {
+		t.Fatalf("CountEmptyMarkers: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("CountEmptyMarkers=%d want 2", n)
+	}
+}
+
+func TestMemoryCellIndex_DelCells_EmptyFiltersRemovesAllVariants(t *testing.T) {
+	st := newMem(t)
+	idx := NewMemoryIndex(st)
+	ctx := context.Background()
+
+	layer, cell := "demo:layer", "892a100d2b3ffff"
+	sv := keys.ScopedLayer(layer, map[string]string{"Accept-Language": "sv"})
+	for _, f := range []model.Filters{"", "a=1", "name='x y'"} {
+		if err := idx.SetIDs(ctx, layer, 8, cell, f, []string{"A"}, time.Minute); err != nil {
+			t.Fatalf("SetIDs %q: %v", f, err)
+		}
+	}
+	if err := idx.SetIDs(ctx, sv, 8, cell, "a=1", []string{"A"}, time.Minute); err != nil {
+		t.Fatalf("SetIDs scoped: %v", err)
+	}
+
+	if err := idx.DelCells(ctx, layer, 8, []string{cell}, ""); err != nil {
+		t.Fatalf("DelCells: %v", err)
+	}
+	for _, f := range []model.Filters{"", "a=1", "name='x y'"} {
+		if got, _ := st.MGet([]string{keys.CellIndexKey(layer, 8, cell, f)}); len(got) != 0 {
+			t.Fatalf("variant %q should be deleted", f)
+		}
+	}
+	scopes, err := idx.(ScopeLister).Scopes(ctx, layer)
+	if err != nil || !reflect.DeepEqual(scopes, []string{sv}) {
+		t.Fatalf("Scopes=%v err=%v want [%s]", scopes, err, sv)
+	}
+}
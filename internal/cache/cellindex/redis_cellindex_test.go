@@ -2,6 +2,7 @@ package cellindex
 
 import (
 	"context"
+	"fmt"
 	"reflect"
 	"testing"
 	"time"
@@ -262,3 +263,190 @@ func TestRedisCellIndex_DelCells_RemovesEntries(t *testing.T) {
 		t.Fatalf("GetIDs after DelCells = %v (len=%d), want nil/empty", got2, len(got2))
 	}
 }
+
+func TestRedisCellIndex_DelCells_EmptyFiltersRemovesAllVariants(t *testing.T) {
+	cli, mr := newMini(t)
+	idx := NewRedisIndex(cli)
+	ctx := context.Background()
+
+	layer, cell, other := "demo:layer", "892a100d2b3ffff", "892a100d2b7ffff"
+	for _, f := range []model.Filters{"", "a=1", "name='x y'"} {
+		if err := idx.SetIDs(ctx, layer, 8, cell, f, []string{"A"}, time.Minute); err != nil {
+			t.Fatalf("SetIDs %q: %v", f, err)
+		}
+	}
+	if err := idx.SetIDs(ctx, layer, 8, other, "a=1", []string{"B"}, time.Minute); err != nil {
+		t.Fatalf("SetIDs other: %v", err)
+	}
+	if err := idx.SetIDs(ctx, layer, 9, cell, "a=1", []string{"C"}, time.Minute); err != nil {
+		t.Fatalf("SetIDs res 9: %v", err)
+	}
+
+	if err := idx.DelCells(ctx, layer, 8, []string{cell}, ""); err != nil {
+		t.Fatalf("DelCells: %v", err)
+	}
+	for _, f := range []model.Filters{"", "a=1", "name='x y'"} {
+		if mr.Exists(keys.CellIndexKey(layer, 8, cell, f)) {
+			t.Fatalf("variant %q should be deleted", f)
+		}
+	}
+	if !mr.Exists(keys.CellIndexKey(layer, 8, other, "a=1")) {
+		t.Fatalf("other cell should be untouched")
+	}
+	if !mr.Exists(keys.CellIndexKey(layer, 9, cell, "a=1")) {
+		t.Fatalf("other resolution should be untouched")
+	}
+}
+
+func TestRedisCellIndex_FilterRegistryOutlivesEntries(t *testing.T) {
+	cli, mr := newMini(t)
+	idx := NewRedisIndex(cli)
+	ctx := context.Background()
+
+	layer, cell := "demo:layer", "892a100d2b3ffff"
+	reg := keys.CellFiltersKey(layer, 8)
+	if err := idx.SetIDs(ctx, layer, 8, cell, "", []string{"A"}, time.Minute); err != nil {
+		t.Fatalf("SetIDs: %v", err)
+	}
+	if mr.Exists(reg) {
+		t.Fatalf("unfiltered entries need no registry")
+	}
+	if err := idx.(ValidatorStore).SetValidator(ctx, layer, 8, cell, "a=1", Validator{ETag: `"v1"`, IDs: []string{"A"}}, 10*time.Minute); err != nil {
+		t.Fatalf("SetValidator: %v", err)
+	}
+	if err := idx.SetIDs(ctx, layer, 8, cell, "a=1", []string{"A"}, time.Minute); err != nil {
+		t.Fatalf("SetIDs: %v", err)
+	}
+	if got := mr.TTL(reg); got != 10*time.Minute {
+		t.Fatalf("registry ttl=%v want the longest entry ttl 10m", got)
+	}
+
+	mr.FastForward(2 * time.Minute)
+	if err := idx.DelCells(ctx, layer, 8, []string{cell}, ""); err != nil {
+		t.Fatalf("DelCells: %v", err)
+	}
+	if mr.Exists(keys.CellValidatorKey(layer, 8, cell, "a=1")) {
+		t.Fatalf("filtered validator should be deleted after its entry expired")
+	}
+}
+
+func TestRedisCellIndex_ValidatorOutlivesEntry(t *testing.T) {
+	cli, mr := newMini(t)
+	idx := NewRedisIndex(cli)
+	vs, ok := idx.(ValidatorStore)
+	if !ok {
+		t.Fatalf("redis index does not store validators")
+	}
+	ctx := context.Background()
+	const layer, res, cell = "demo:NR_polygon", 8, "892a100d2b3ffff"
+
+	if _, ok, err := vs.GetValidator(ctx, layer, res, cell, ""); err != nil || ok {
+		t.Fatalf("missing validator: ok=%v err=%v", ok, err)
+	}
+	want := Validator{ETag: `"v1"`, LastModified: "Mon, 02 Jan 2006 15:04:05 GMT", IDs: []string{"s:a", "s:b"}, Matched: 2}
+	if err := vs.SetValidator(ctx, layer, res, cell, "", want, time.Hour); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if err := idx.SetIDs(ctx, layer, res, cell, "", want.IDs, time.Minute); err != nil {
+		t.Fatalf("set ids: %v", err)
+	}
+
+	// the entry expires; the validator stays
+	mr.FastForward(2 * time.Minute)
+	if ids, _ := idx.GetIDs(ctx, layer, res, cell, ""); len(ids) != 0 {
+		t.Fatalf("entry outlived its ttl: %v", ids)
+	}
+	got, ok, err := vs.GetValidator(ctx, layer, res, cell, "")
+	if err != nil || !ok || !reflect.DeepEqual(got, want) {
+		t.Fatalf("validator=%+v ok=%v err=%v want %+v", got, ok, err, want)
+	}
+	if ttl := mr.TTL(keys.CellValidatorKey(layer, res, cell, "")); ttl <= 0 || ttl > time.Hour {
+		t.Fatalf("validator ttl=%v", ttl)
+	}
+
+	// invalidating the cell drops its validator with it, under any filter
+	if err := vs.SetValidator(ctx, layer, res, cell, "pop > 1", want, time.Hour); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if err := idx.DelCells(ctx, layer, res, []string{cell}, ""); err != nil {
+		t.Fatalf("del cells: %v", err)
+	}
+	for _, f := range []model.Filters{"", "pop > 1"} {
+		if _, ok, _ := vs.GetValidator(ctx, layer, res, cell, f); ok {
+			t.Fatalf("validator for filters %q survived DelCells", f)
+		}
+	}
+	if err := vs.SetValidator(ctx, layer, res, cell, "", want, time.Hour); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if err := idx.SetIDs(ctx, layer, res, cell, "", want.IDs, time.Minute); err != nil {
+		t.Fatalf("set ids: %v", err)
+	}
+	if n, err := idx.(IDDropper).DropIDs(ctx, layer, []string{"s:b"}); err != nil || n != 1 {
+		t.Fatalf("DropIDs: n=%d err=%v", n, err)
+	}
+	if _, ok, _ := vs.GetValidator(ctx, layer, res, cell, ""); ok {
+		t.Fatalf("validator survived DropIDs")
+	}
+
+	// validators with nothing to send are as good as none
+	if err := vs.SetValidator(ctx, layer, res, cell, "", Validator{IDs: want.IDs}, time.Hour); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if _, ok, _ := vs.GetValidator(ctx, layer, res, cell, ""); ok {
+		t.Fatalf("validator without ETag or Last-Modified reported")
+	}
+}
+
+func TestRedisCellIndex_DropIDs_AcrossReadBatches(t *testing.T) {
+	cli, mr := newMini(t)
+	idx := NewRedisIndex(cli)
+	ctx := context.Background()
+
+	const layer = "demo:layer"
+	n := 2*readBatch + 10
+	for i := range n {
+		ids := []string{"s:other"}
+		if i == 3 || i == n-1 {
+			ids = append(ids, "s:gone")
+		}
+		if err := idx.SetIDs(ctx, layer, 8, fmt.Sprintf("cell%04d", i), "", ids, time.Minute); err != nil {
+			t.Fatalf("SetIDs: %v", err)
+		}
+	}
+
+	dropped, err := idx.(IDDropper).DropIDs(ctx, layer, []string{"s:gone"})
+	if err != nil || dropped != 2 {
+		t.Fatalf("DropIDs: n=%d err=%v want 2", dropped, err)
+	}
+	for _, i := range []int{3, n - 1} {
+		if mr.Exists(keys.CellIndexKey(layer, 8, fmt.Sprintf("cell%04d", i), "")) {
+			t.Fatalf("entry %d still references the dropped id", i)
+		}
+	}
+	if len(mr.Keys()) != n-2 {
+		t.Fatalf("keys=%d want %d untouched entries", len(mr.Keys()), n-2)
+	}
+}
+
+func TestRedisCellIndex_ScopesFromRegistry(t *testing.T) {
+	cli, mr := newMini(t)
+	idx := NewRedisIndex(cli)
+	ctx := context.Background()
+
+	layer, cell := "demo:layer", "892a100d2b3ffff"
+	sv := keys.ScopedLayer(layer, map[string]string{"Accept-Language": "sv"})
+	if err := idx.SetIDs(ctx, layer, 8, cell, "", []string{"A"}, time.Minute); err != nil {
+		t.Fatalf("SetIDs: %v", err)
+	}
+	if err := idx.SetIDs(ctx, sv, 8, cell, "", []string{"A"}, time.Minute); err != nil {
+		t.Fatalf("SetIDs scoped: %v", err)
+	}
+	got, err := idx.(ScopeLister).Scopes(ctx, layer)
+	if err != nil || !reflect.DeepEqual(got, []string{sv}) {
+		t.Fatalf("Scopes=%v err=%v want [%s]", got, err, sv)
+	}
+	if ttl := mr.TTL(keys.LayerScopesKey(layer)); ttl != time.Minute {
+		t.Fatalf("scope registry ttl=%v want 1m", ttl)
+	}
+}
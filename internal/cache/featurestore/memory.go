@@ -0,0 +1,101 @@
+package featurestore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/memstore"
+)
+
+type memoryFeatureStore struct {
+	st         *memstore.Store
+	defaultTTL time.Duration
+}
+
+// NewMemoryStore keeps features in-process using the same key layout as Redis
+func NewMemoryStore(st *memstore.Store, defaultTTL time.Duration) FeatureStore {
+	return &memoryFeatureStore{st: st, defaultTTL: defaultTTL}
+}
+
+func (s *memoryFeatureStore) MGetFeatures(ctx context.Context, layer string, ids []string) (map[string][]byte, error) {
+	if len(ids) == 0 {
+		return map[string][]byte{}, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("featurestore memory MGET: %w", err)
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = featureKey(layer, id)
+	}
+	raw, err := s.st.MGet(keys)
+	if err != nil {
+		return nil, fmt.Errorf("featurestore memory MGET %d keys: %w", len(keys), err)
+	}
+
+	out := make(map[string][]byte, len(raw))
+	for i, id := range ids {
+		if v, ok := raw[keys[i]]; ok {
+			out[id] = v
+		}
+	}
+	return out, nil
+}
+
+func (s *memoryFeatureStore) PutFeatures(ctx context.Context, layer string, feats map[string][]byte, ttl time.Duration) error {
+	if len(feats) == 0 {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("featurestore memory MSET: %w", err)
+	}
+
+	t := ttl
+	if t <= 0 {
+		t = s.defaultTTL
+	}
+	kv := make(map[string][]byte, len(feats))
+	for id, body := range feats {
+		kv[featureKey(layer, id)] = body
+	}
+	if err := registerMemoryScope(s.st, layer, t); err != nil {
+		return err
+	}
+	if err := s.st.MSetWithTTL(kv, t); err != nil {
+		return fmt.Errorf("featurestore memory MSET %d keys: %w", len(kv), err)
+	}
+	return nil
+}
+
+func (s *memoryFeatureStore) DelFeatures(ctx context.Context, layer string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("featurestore memory DEL: %w", err)
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = featureKey(layer, id)
+	}
+	if err := s.st.Del(keys...); err != nil {
+		return fmt.Errorf("featurestore memory DEL %d keys: %w", len(keys), err)
+	}
+	return nil
+}
+
+func (s *memoryFeatureStore) PatchProperties(ctx context.Context, layer, id string, props map[string]json.RawMessage) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, fmt.Errorf("featurestore memory patch: %w", err)
+	}
+	ok, err := s.st.Update(featureKey(layer, id), func(old []byte) ([]byte, error) {
+		return patchProperties(old, props)
+	})
+	if err != nil {
+		return ok, fmt.Errorf("featurestore memory patch %q: %w", id, err)
+	}
+	return ok, nil
+}
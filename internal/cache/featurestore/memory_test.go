@@ -0,0 +1,118 @@
+package featurestore
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/memstore"
+)
+
+func newMem(t *testing.T) *memstore.Store {
+	t.Helper()
+	st := memstore.New(0)
+	t.Cleanup(func() { _ = st.Close() })
+	return st
+}
+
+func TestMemoryFeatureStore_RoundTrip_HitsAndMisses(t *testing.T) {
+	st := newMem(t)
+	fs := NewMemoryStore(st, 10*time.Minute)
+	ctx := context.Background()
+
+	layer := "demo:NR_polygon"
+	feats := map[string][]byte{
+		"A":       []byte(`{"id":"A"}`),
+		"foo-123": []byte(`{"id":"foo-123"}`),
+		"42":      []byte(`{"id":"42"}`),
+	}
+	ttl := 2 * time.Minute
+
+	if err := fs.PutFeatures(ctx, layer, feats, ttl); err != nil {
+		t.Fatalf("PutFeatures: %v", err)
+	}
+
+	got, err := fs.MGetFeatures(ctx, layer, []string{"A", "foo-123", "42", "missing"})
+	if err != nil {
+		t.Fatalf("MGetFeatures: %v", err)
+	}
+	if len(got) != len(feats) {
+		t.Fatalf("MGetFeatures size=%d want %d", len(got), len(feats))
+	}
+	for id, want := range feats {
+		if string(got[id]) != string(want) {
+			t.Fatalf("body mismatch for id=%q got=%q want=%q", id, got[id], want)
+		}
+	}
+
+	for id := range feats {
+		k := featureKey(layer, id)
+		if tt := st.TTL(k); tt <= 0 || tt > ttl {
+			t.Fatalf("unexpected TTL for key %q: %v", k, tt)
+		}
+	}
+}
+
+func TestMemoryFeatureStore_EmptyIDs_ReturnsEmptyMap(t *testing.T) {
+	fs := NewMemoryStore(newMem(t), 5*time.Minute)
+	got, err := fs.MGetFeatures(context.Background(), "demo:layer", nil)
+	if err != nil {
+		t.Fatalf("MGetFeatures(nil): %v", err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("expected empty result map, got len=%d", len(got))
+	}
+}
+
+func TestMemoryFeatureStore_DefaultTTLUsedWhenZeroTTL(t *testing.T) {
+	st := newMem(t)
+	defaultTTL := 3 * time.Minute
+	fs := NewMemoryStore(st, defaultTTL)
+
+	if err := fs.PutFeatures(context.Background(), "demo:NR_polygon", map[string][]byte{"B": []byte(`{"id":"B"}`)}, 0); err != nil {
+		t.Fatalf("PutFeatures(defaultTTL): %v", err)
+	}
+	k := featureKey("demo:NR_polygon", "B")
+	if tt := st.TTL(k); tt <= 0 || tt > defaultTTL {
+		t.Fatalf("unexpected TTL for defaultTTL key %q: %v", k, tt)
+	}
+}
+
+func TestMemoryFeatureStore_PatchProperties(t *testing.T) {
+	st := newMem(t)
+	fs := NewMemoryStore(st, 10*time.Minute).(Patcher)
+	ctx := context.Background()
+
+	layer := "demo:NR_polygon"
+	if err := NewMemoryStore(st, 0).PutFeatures(ctx, layer, map[string][]byte{
+		"s:a": []byte(`{"type":"Feature","id":"a","geometry":null,"properties":{"k":1,"gone":true}}`),
+		"s:b": []byte(`{"type":"Feature","id":"b","geometry":null,"properties":null}`),
+	}, time.Minute); err != nil {
+		t.Fatalf("PutFeatures: %v", err)
+	}
+
+	patch := map[string]json.RawMessage{"k": json.RawMessage(`2`), "new": json.RawMessage(`"x"`), "gone": json.RawMessage(`null`)}
+	for _, id := range []string{"s:a", "s:b"} {
+		if ok, err := fs.PatchProperties(ctx, layer, id, patch); err != nil || !ok {
+			t.Fatalf("patch %s: ok=%v err=%v", id, ok, err)
+		}
+	}
+	if ok, err := fs.PatchProperties(ctx, layer, "s:missing", patch); err != nil || ok {
+		t.Fatalf("patch missing: ok=%v err=%v, want false", ok, err)
+	}
+	if _, err := fs.PatchProperties(ctx, layer, "s:a", map[string]json.RawMessage{"k": json.RawMessage(`{`)}); err == nil {
+		t.Fatalf("invalid JSON value patched without error")
+	}
+
+	got, _ := fs.(FeatureStore).MGetFeatures(ctx, layer, []string{"s:a", "s:b"})
+	if want := `{"geometry":null,"id":"a","properties":{"k":2,"new":"x"},"type":"Feature"}`; string(got["s:a"]) != want {
+		t.Fatalf("s:a=%s want %s", got["s:a"], want)
+	}
+	if want := `{"geometry":null,"id":"b","properties":{"k":2,"new":"x"},"type":"Feature"}`; string(got["s:b"]) != want {
+		t.Fatalf("s:b=%s want %s", got["s:b"], want)
+	}
+	if ttl := st.TTL(featureKey(layer, "s:a")); ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("patched ttl=%v, want the original minute kept", ttl)
+	}
+}
@@ -0,0 +1,50 @@
+package featurestore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// patchProperties merges props into a GeoJSON feature's "properties" member:
+// each key is set to its value, and a JSON null removes it. The feature's
+// other members keep their values, though members are re-encoded in key order
+func patchProperties(feature []byte, props map[string]json.RawMessage) ([]byte, error) {
+	var f map[string]json.RawMessage
+	if err := json.Unmarshal(feature, &f); err != nil {
+		return nil, fmt.Errorf("decode feature: %w", err)
+	}
+	if f == nil {
+		return nil, errors.New("feature is not a JSON object")
+	}
+	var cur map[string]json.RawMessage
+	if raw, ok := f["properties"]; ok && !bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		if err := json.Unmarshal(raw, &cur); err != nil {
+			return nil, fmt.Errorf("decode properties: %w", err)
+		}
+	}
+	if cur == nil {
+		cur = make(map[string]json.RawMessage, len(props))
+	}
+	for k, v := range props {
+		if len(v) == 0 || bytes.Equal(bytes.TrimSpace(v), []byte("null")) {
+			delete(cur, k)
+			continue
+		}
+		if !json.Valid(v) {
+			return nil, fmt.Errorf("property %q: invalid JSON value", k)
+		}
+		cur[k] = v
+	}
+	raw, err := json.Marshal(cur)
+	if err != nil {
+		return nil, fmt.Errorf("encode properties: %w", err)
+	}
+	f["properties"] = raw
+	out, err := json.Marshal(f)
+	if err != nil {
+		return nil, fmt.Errorf("encode feature: %w", err)
+	}
+	return out, nil
+}
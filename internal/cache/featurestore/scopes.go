@@ -0,0 +1,57 @@
+package featurestore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/keys"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/memstore"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/redisstore"
+)
+
+// Scopes lists the header scopes (keys.ScopedLayer values) features of layer
+// were written under, from the set PutFeatures keeps; the bare layer is not
+// included
+func (s *redisFeatureStore) Scopes(ctx context.Context, layer string) ([]string, error) {
+	out, err := s.cli.SMembers(ctx, keys.LayerScopesKey(layer))
+	if err != nil {
+		return nil, fmt.Errorf("featurestore redis scopes: %w", err)
+	}
+	return out, nil
+}
+
+func (s *memoryFeatureStore) Scopes(ctx context.Context, layer string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("featurestore memory scopes: %w", err)
+	}
+	out, err := s.st.SMembers(keys.LayerScopesKey(layer))
+	if err != nil {
+		return nil, fmt.Errorf("featurestore memory scopes: %w", err)
+	}
+	return out, nil
+}
+
+// registerScope records a header-scoped layer as a scope of its base layer,
+// before features under it are written, so Scopes needs no scan
+func registerScope(ctx context.Context, cli *redisstore.Client, layer string, ttl time.Duration) error {
+	base, ok := keys.ScopeBase(layer)
+	if !ok {
+		return nil
+	}
+	if err := cli.SAdd(ctx, keys.LayerScopesKey(base), ttl, layer); err != nil {
+		return fmt.Errorf("featurestore register scope: %w", err)
+	}
+	return nil
+}
+
+func registerMemoryScope(st *memstore.Store, layer string, ttl time.Duration) error {
+	base, ok := keys.ScopeBase(layer)
+	if !ok {
+		return nil
+	}
+	if err := st.SAdd(keys.LayerScopesKey(base), ttl, layer); err != nil {
+		return fmt.Errorf("featurestore memory register scope: %w", err)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package featurestore
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
@@ -17,6 +18,18 @@ type FeatureStore interface {
 	PutFeatures(ctx context.Context, layer string, feats map[string][]byte, ttl time.Duration) error
 }
 
+// Deleter is implemented by stores that can evict features by id
+type Deleter interface {
+	DelFeatures(ctx context.Context, layer string, ids []string) error
+}
+
+// Patcher is implemented by stores that can rewrite a cached feature's
+// properties in place. PatchProperties reports false when the feature isn't
+// cached, leaving the caller to evict instead
+type Patcher interface {
+	PatchProperties(ctx context.Context, layer, id string, props map[string]json.RawMessage) (bool, error)
+}
+
 type redisFeatureStore struct {
 	cli        *redisstore.Client
 	defaultTTL time.Duration
@@ -83,6 +96,10 @@ func (s *redisFeatureStore) PutFeatures(
 		kv[k] = body
 	}
 
+	if err := registerScope(ctx, s.cli, layer, t); err != nil {
+		return err
+	}
+
 	// Implemented in redisstore.Client; currently uses existing Set in a loop.
 	// You can optimize this later with a real Redis pipeline if you expose the underlying client.
 	if err := s.cli.MSetWithTTL(ctx, kv, t); err != nil {
@@ -91,6 +108,30 @@ func (s *redisFeatureStore) PutFeatures(
 	return nil
 }
 
+func (s *redisFeatureStore) DelFeatures(ctx context.Context, layer string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = featureKey(layer, id)
+	}
+	if err := s.cli.Del(ctx, keys...); err != nil {
+		return fmt.Errorf("featurestore redis DEL %d keys: %w", len(keys), err)
+	}
+	return nil
+}
+
+func (s *redisFeatureStore) PatchProperties(ctx context.Context, layer, id string, props map[string]json.RawMessage) (bool, error) {
+	ok, err := s.cli.Update(ctx, featureKey(layer, id), func(old []byte) ([]byte, error) {
+		return patchProperties(old, props)
+	})
+	if err != nil {
+		return ok, fmt.Errorf("featurestore redis patch %q: %w", id, err)
+	}
+	return ok, nil
+}
+
 func featureKey(layer, id string) string {
 	layerKey := sanitizeLayer(strings.TrimSpace(layer))
 	normID := strings.TrimSpace(id)
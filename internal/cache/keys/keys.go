@@ -4,6 +4,7 @@ package keys
 import (
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 	"unicode"
 
@@ -28,6 +29,28 @@ func Key(layer string, res int, cell, filters string) string {
 	return fmt.Sprintf("%s:%d:%s:filters=%s:f=%016x", layerNorm, res, cell, filterSafe, sum)
 }
 
+// ScopedLayer namespaces layer by passthrough header values (e.g. Accept-Language)
+// so localized upstream responses get distinct index and feature keys
+func ScopedLayer(layer string, headers map[string]string) string {
+	if len(headers) == 0 {
+		return layer
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, k := range names {
+		b.WriteString(strings.ToLower(strings.TrimSpace(k)))
+		b.WriteByte('=')
+		b.WriteString(collapseASCIIWhitespace(headers[k]))
+		b.WriteByte('\n')
+	}
+	return fmt.Sprintf("%s:hdr-%016x", layer, xxhash.Sum64String(b.String()))
+}
+
 // normalize spacing around operators
 func normalizeFilters(s string) string {
 	if s == "" {
@@ -119,3 +142,62 @@ func CellIndexKey(layer string, res int, cell string, filters model.Filters) str
 	base := Key(layer, res, cell, string(filters))
 	return "idx:" + base
 }
+
+// CellValidatorKey holds the upstream validators of a cell index entry; it
+// sits outside "idx:" so index scans and samples never see it
+func CellValidatorKey(layer string, res int, cell string, filters model.Filters) string {
+	return "val:" + Key(layer, res, cell, string(filters))
+}
+
+// ValidatorKeyOf returns the validator key kept next to a cell index key
+func ValidatorKeyOf(indexKey string) string {
+	return "val:" + strings.TrimPrefix(indexKey, "idx:")
+}
+
+// CellFiltersKey is the set of filters that cell index or validator entries
+// of layer at res were written under, so every filter variant of a cell can
+// be deleted without scanning; it sits outside "idx:" so index scans and
+// samples never see it
+func CellFiltersKey(layer string, res int) string {
+	return fmt.Sprintf("idxf:%s:%d", sanitizeLayer(strings.TrimSpace(layer)), res)
+}
+
+// CellIndexLayerPattern is a SCAN glob for every cell index key of layer, at
+// any resolution and header scope; filter keys with CellIndexInLayer
+func CellIndexLayerPattern(layer string) string {
+	return "idx:" + sanitizeLayer(strings.TrimSpace(layer)) + ":*"
+}
+
+// CellIndexInLayer reports whether key is a cell index key of layer rather than
+// of another layer sharing its prefix (e.g. demo:roads vs demo:roads:v2)
+func CellIndexInLayer(key, layer string) bool {
+	rest, ok := strings.CutPrefix(key, "idx:"+sanitizeLayer(strings.TrimSpace(layer))+":")
+	if !ok || rest == "" {
+		return false
+	}
+	return strings.HasPrefix(rest, "hdr-") || (rest[0] >= '0' && rest[0] <= '9')
+}
+
+// LayerScopesKey is the set of header scopes (ScopedLayer values) entries of
+// layer were written under, so invalidation can reach every localized copy
+// without scanning; it sits outside "idx:" and "feat:" so scans and samples
+// never see it
+func LayerScopesKey(layer string) string {
+	return "scopes:" + sanitizeLayer(strings.TrimSpace(layer))
+}
+
+// ScopeBase returns the layer a ScopedLayer value was built from; ok is false
+// for a bare layer
+func ScopeBase(scoped string) (layer string, ok bool) {
+	i := strings.LastIndex(scoped, ":hdr-")
+	const hashLen = 16
+	if i <= 0 || len(scoped)-i-len(":hdr-") != hashLen {
+		return "", false
+	}
+	for _, c := range scoped[i+len(":hdr-"):] {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return "", false
+		}
+	}
+	return scoped[:i], true
+}
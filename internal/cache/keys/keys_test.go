@@ -60,3 +60,32 @@ func TestUnicodeSafety_NoPanicAndHashSuffixPresent(t *testing.T) {
 		t.Fatalf("missing filters= segment in key: %s", k)
 	}
 }
+
+func TestScopedLayer_HeaderVariants(t *testing.T) {
+	if got := ScopedLayer("demo:NR_polygon", nil); got != "demo:NR_polygon" {
+		t.Fatalf("no headers should keep layer, got %s", got)
+	}
+	sv := ScopedLayer("demo:NR_polygon", map[string]string{"Accept-Language": "sv"})
+	en := ScopedLayer("demo:NR_polygon", map[string]string{"Accept-Language": "en"})
+	if sv == en {
+		t.Fatalf("expected distinct scoped layers, both %s", sv)
+	}
+	if again := ScopedLayer("demo:NR_polygon", map[string]string{"Accept-Language": " sv "}); again != sv {
+		t.Fatalf("expected whitespace-insensitive scope: %s vs %s", again, sv)
+	}
+	if Key(sv, 8, "892a100d2b3ffff", "") == Key(en, 8, "892a100d2b3ffff", "") {
+		t.Fatalf("expected distinct keys per language")
+	}
+}
+
+func TestScopeBase_RecoversLayer(t *testing.T) {
+	sv := ScopedLayer("demo:NR_polygon", map[string]string{"Accept-Language": "sv"})
+	if got, ok := ScopeBase(sv); !ok || got != "demo:NR_polygon" {
+		t.Fatalf("ScopeBase(%s)=%q,%v want demo:NR_polygon", sv, got, ok)
+	}
+	for _, l := range []string{"demo:NR_polygon", "demo:NR_polygon:hdr-zz", "demo:hdr-0123456789abcdef0"} {
+		if got, ok := ScopeBase(l); ok {
+			t.Fatalf("ScopeBase(%s)=%q, want no scope", l, got)
+		}
+	}
+}
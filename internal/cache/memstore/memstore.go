@@ -0,0 +1,238 @@
+// Package memstore provides an in-process key/value store with TTLs for
+// single-node and development deployments that run without Redis.
+package memstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	val []byte
+	exp time.Time // zero means no expiry
+}
+
+// Store is a concurrency-safe map of byte values; expired entries are hidden
+// on read and swept by a background janitor
+type Store struct {
+	mu   sync.RWMutex
+	data map[string]entry
+	now  func() time.Time
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// New starts a store whose janitor sweeps expired keys every interval;
+// interval <= 0 disables the janitor (expiry is still enforced on read)
+func New(interval time.Duration) *Store {
+	s := &Store{
+		data: make(map[string]entry),
+		now:  time.Now,
+		stop: make(chan struct{}),
+	}
+	if interval > 0 {
+		go s.janitor(interval)
+	}
+	return s
+}
+
+func (s *Store) janitor(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			s.DeleteExpired()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Close stops the janitor; the store stays readable
+func (s *Store) Close() error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	return nil
+}
+
+func (s *Store) expired(e entry, now time.Time) bool {
+	return !e.exp.IsZero() && !now.Before(e.exp)
+}
+
+func (s *Store) MGet(keys []string) (map[string][]byte, error) {
+	out := make(map[string][]byte, len(keys))
+	if len(keys) == 0 {
+		return out, nil
+	}
+	now := s.now()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, k := range keys {
+		if e, ok := s.data[k]; ok && !s.expired(e, now) {
+			out[k] = e.val
+		}
+	}
+	return out, nil
+}
+
+// Set stores a copy of val; ttl <= 0 keeps the key until deleted
+func (s *Store) Set(key string, val []byte, ttl time.Duration) error {
+	e := entry{val: append([]byte(nil), val...)}
+	if ttl > 0 {
+		e.exp = s.now().Add(ttl)
+	}
+	s.mu.Lock()
+	s.data[key] = e
+	s.mu.Unlock()
+	return nil
+}
+
+// MSetWithTTL stores all pairs with the same ttl
+func (s *Store) MSetWithTTL(kv map[string][]byte, ttl time.Duration) error {
+	var exp time.Time
+	if ttl > 0 {
+		exp = s.now().Add(ttl)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, v := range kv {
+		s.data[k] = entry{val: append([]byte(nil), v...), exp: exp}
+	}
+	return nil
+}
+
+// Update replaces key's value with fn(old) under the store lock, keeping its
+// expiry; it reports false, without calling fn, when key is missing
+func (s *Store) Update(key string, fn func(old []byte) ([]byte, error)) (bool, error) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.data[key]
+	if !ok || s.expired(e, now) {
+		return false, nil
+	}
+	val, err := fn(e.val)
+	if err != nil {
+		return true, err
+	}
+	s.data[key] = entry{val: append([]byte(nil), val...), exp: e.exp}
+	return true, nil
+}
+
+// SAdd adds members to the set at key, kept as a JSON array, and extends its
+// expiry to at least ttl like Redis EXPIRE NX then GT; ttl <= 0 leaves the
+// expiry as it is
+func (s *Store) SAdd(key string, ttl time.Duration, members ...string) error {
+	if len(members) == 0 {
+		return nil
+	}
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.data[key]
+	if ok && s.expired(e, now) {
+		e, ok = entry{}, false
+	}
+	var set []string
+	if ok {
+		if err := json.Unmarshal(e.val, &set); err != nil {
+			return fmt.Errorf("memstore SADD %q: not a set: %w", key, err)
+		}
+	}
+	for _, m := range members {
+		if !slices.Contains(set, m) {
+			set = append(set, m)
+		}
+	}
+	val, err := json.Marshal(set)
+	if err != nil {
+		return fmt.Errorf("memstore SADD %q: %w", key, err)
+	}
+	exp := e.exp
+	if ttl > 0 {
+		if want := now.Add(ttl); exp.IsZero() || want.After(exp) {
+			exp = want
+		}
+	}
+	s.data[key] = entry{val: val, exp: exp}
+	return nil
+}
+
+// SMembers returns the members of the set at key; none when it is missing
+func (s *Store) SMembers(key string) ([]string, error) {
+	raw, err := s.MGet([]string{key})
+	if err != nil || raw[key] == nil {
+		return nil, err
+	}
+	var set []string
+	if err := json.Unmarshal(raw[key], &set); err != nil {
+		return nil, fmt.Errorf("memstore SMEMBERS %q: not a set: %w", key, err)
+	}
+	return set, nil
+}
+
+func (s *Store) Del(keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, k := range keys {
+		delete(s.data, k)
+	}
+	return nil
+}
+
+// TTL mirrors Redis semantics: -2 if missing, -1 if no expiry
+func (s *Store) TTL(key string) time.Duration {
+	now := s.now()
+	s.mu.RLock()
+	e, ok := s.data[key]
+	s.mu.RUnlock()
+	switch {
+	case !ok || s.expired(e, now):
+		return -2
+	case e.exp.IsZero():
+		return -1
+	default:
+		return e.exp.Sub(now)
+	}
+}
+
+// Len reports stored keys, including expired ones not yet swept
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.data)
+}
+
+// DeleteExpired removes expired keys and returns how many were dropped
+func (s *Store) DeleteExpired() int {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for k, e := range s.data {
+		if s.expired(e, now) {
+			delete(s.data, k)
+			n++
+		}
+	}
+	return n
+}
+
+// Range calls fn for every live key until fn returns false
+func (s *Store) Range(fn func(key string, val []byte) bool) {
+	now := s.now()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for k, e := range s.data {
+		if s.expired(e, now) {
+			continue
+		}
+		if !fn(k, e.val) {
+			return
+		}
+	}
+}
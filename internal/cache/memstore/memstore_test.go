@@ -0,0 +1,150 @@
+package memstore
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.t = c.t.Add(d)
+	c.mu.Unlock()
+}
+
+func newTestStore(t *testing.T) (*Store, *fakeClock) {
+	t.Helper()
+	clk := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	s := New(0)
+	s.now = clk.now
+	t.Cleanup(func() { _ = s.Close() })
+	return s, clk
+}
+
+func TestStore_RoundTrip_HitsAndMisses(t *testing.T) {
+	s, _ := newTestStore(t)
+
+	if err := s.Set("a", []byte("1"), time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := s.MSetWithTTL(map[string][]byte{"b": []byte("2"), "c": []byte("3")}, 0); err != nil {
+		t.Fatalf("MSetWithTTL: %v", err)
+	}
+
+	got, err := s.MGet([]string{"a", "b", "c", "missing"})
+	if err != nil {
+		t.Fatalf("MGet: %v", err)
+	}
+	if len(got) != 3 || string(got["a"]) != "1" || string(got["b"]) != "2" || string(got["c"]) != "3" {
+		t.Fatalf("unexpected MGet result: %v", got)
+	}
+	if _, ok := got["missing"]; ok {
+		t.Fatalf("unexpected entry for missing key")
+	}
+
+	if err := s.Del("a", "b"); err != nil {
+		t.Fatalf("Del: %v", err)
+	}
+	got, _ = s.MGet([]string{"a", "b", "c"})
+	if len(got) != 1 {
+		t.Fatalf("expected only c after Del, got %v", got)
+	}
+}
+
+func TestStore_SetCopiesValue(t *testing.T) {
+	s, _ := newTestStore(t)
+	buf := []byte("abc")
+	_ = s.Set("k", buf, 0)
+	buf[0] = 'X'
+	got, _ := s.MGet([]string{"k"})
+	if string(got["k"]) != "abc" {
+		t.Fatalf("stored value aliased caller buffer: %q", got["k"])
+	}
+}
+
+func TestStore_TTL_ExpiresAndJanitorSweeps(t *testing.T) {
+	s, clk := newTestStore(t)
+
+	_ = s.Set("short", []byte("x"), 10*time.Second)
+	_ = s.Set("forever", []byte("y"), 0)
+
+	if ttl := s.TTL("short"); ttl <= 0 || ttl > 10*time.Second {
+		t.Fatalf("unexpected TTL: %v", ttl)
+	}
+	if ttl := s.TTL("forever"); ttl != -1 {
+		t.Fatalf("expected -1 for no expiry, got %v", ttl)
+	}
+
+	clk.advance(11 * time.Second)
+
+	got, _ := s.MGet([]string{"short", "forever"})
+	if _, ok := got["short"]; ok {
+		t.Fatalf("expired key still readable")
+	}
+	if _, ok := got["forever"]; !ok {
+		t.Fatalf("non-expiring key missing")
+	}
+	if ttl := s.TTL("short"); ttl != -2 {
+		t.Fatalf("expected -2 for expired key, got %v", ttl)
+	}
+	if s.Len() != 2 {
+		t.Fatalf("expired key should linger until swept; len=%d", s.Len())
+	}
+	if n := s.DeleteExpired(); n != 1 || s.Len() != 1 {
+		t.Fatalf("DeleteExpired removed %d, len=%d", n, s.Len())
+	}
+}
+
+func TestStore_BackgroundJanitor(t *testing.T) {
+	s := New(5 * time.Millisecond)
+	defer func() { _ = s.Close() }()
+
+	_ = s.Set("k", []byte("v"), time.Millisecond)
+	deadline := time.Now().Add(time.Second)
+	for s.Len() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("janitor did not sweep expired key")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStore_SAdd_ExtendsExpiryToLongestTTL(t *testing.T) {
+	s, clk := newTestStore(t)
+
+	if err := s.SAdd("set", 10*time.Minute, "a"); err != nil {
+		t.Fatalf("SAdd: %v", err)
+	}
+	if err := s.SAdd("set", time.Minute, "b", "a"); err != nil {
+		t.Fatalf("SAdd: %v", err)
+	}
+	if got := s.TTL("set"); got != 10*time.Minute {
+		t.Fatalf("ttl=%v want the longest 10m", got)
+	}
+	got, err := s.SMembers("set")
+	if err != nil || len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Fatalf("SMembers=%v err=%v want [a b]", got, err)
+	}
+
+	clk.advance(10 * time.Minute)
+	if got, _ := s.SMembers("set"); got != nil {
+		t.Fatalf("expired set should read empty, got %v", got)
+	}
+	if err := s.Set("plain", []byte("x"), 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if _, err := s.SMembers("plain"); err == nil {
+		t.Fatalf("expected an error for a non-set value")
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -13,38 +15,75 @@ import (
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
 )
 
-type Option func(*redis.Options)
+// dialOptions are the go-redis options plus how dialing retries
+type dialOptions struct {
+	redis.Options
+	attempts int
+	interval time.Duration
+}
+
+type Option func(*dialOptions)
 
 func WithPoolSize(n int) Option {
-	return func(o *redis.Options) { o.PoolSize = n }
+	return func(o *dialOptions) { o.PoolSize = n }
 }
 
 func WithMinIdleConns(n int) Option {
-	return func(o *redis.Options) { o.MinIdleConns = n }
+	return func(o *dialOptions) { o.MinIdleConns = n }
 }
 
 func WithDialTimeout(d time.Duration) Option {
-	return func(o *redis.Options) { o.DialTimeout = d }
+	return func(o *dialOptions) { o.DialTimeout = d }
 }
 
 func WithReadTimeout(d time.Duration) Option {
-	return func(o *redis.Options) { o.ReadTimeout = d }
+	return func(o *dialOptions) { o.ReadTimeout = d }
 }
 
 func WithWriteTimeout(d time.Duration) Option {
-	return func(o *redis.Options) { o.WriteTimeout = d }
+	return func(o *dialOptions) { o.WriteTimeout = d }
+}
+
+// WithDB selects the logical database on every node
+func WithDB(n int) Option {
+	return func(o *dialOptions) { o.DB = n }
+}
+
+// WithStartupRetry makes the first ping retry up to attempts times, waiting
+// interval and then doubling it (capped at maxStartupBackoff), so a service
+// started before Redis waits for it instead of failing
+func WithStartupRetry(attempts int, interval time.Duration) Option {
+	return func(o *dialOptions) {
+		o.attempts = attempts
+		o.interval = interval
+	}
 }
 
+// longest wait between startup pings
+const maxStartupBackoff = 10 * time.Second
+
+// Client talks to one Redis node, or to several standalone nodes when built
+// with NewSharded; in that case rdb is the first shard
 type Client struct {
-	rdb *redis.Client
+	rdb    *redis.Client
+	shards []*redis.Client
+	ring   *ring
 }
 
 func New(ctx context.Context, addr string, opts ...Option) (*Client, error) {
+	rdb, err := dial(ctx, addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{rdb: rdb}, nil
+}
+
+func dial(ctx context.Context, addr string, opts ...Option) (*redis.Client, error) {
 	if addr == "" {
 		return nil, errors.New("redis address is required")
 	}
 
-	ro := &redis.Options{
+	do := &dialOptions{Options: redis.Options{
 		Addr:         addr,
 		PoolSize:     64,
 		MinIdleConns: 4,
@@ -54,45 +93,82 @@ func New(ctx context.Context, addr string, opts ...Option) (*Client, error) {
 		MaintNotificationsConfig: &maintnotifications.Config{
 			Mode: maintnotifications.ModeDisabled,
 		},
-	}
+	}}
 	for _, f := range opts {
-		f(ro)
+		f(do)
 	}
 
-	rdb := redis.NewClient(ro)
+	rdb := redis.NewClient(&do.Options)
 
-	start := time.Now()
-	err := rdb.Ping(ctx).Err()
-	observability.ObserveCacheOp("ping", err, time.Since(start).Seconds())
-	if err != nil {
-		_ = rdb.Close()
-		return nil, fmt.Errorf("redis ping: %w", err)
+	attempts, wait := max(do.attempts, 1), do.interval
+	var err error
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		err = rdb.Ping(ctx).Err()
+		observability.ObserveCacheOp("ping", err, time.Since(start).Seconds())
+		if err == nil {
+			if attempt > 1 {
+				slog.Info("redis reachable", "addr", addr, "attempt", attempt)
+			}
+			return rdb, nil
+		}
+		if attempt >= attempts || ctx.Err() != nil {
+			break
+		}
+		slog.Warn("redis not reachable yet, retrying",
+			"addr", addr,
+			"attempt", attempt,
+			"of", attempts,
+			"wait", wait.String(),
+			"err", err,
+		)
+		select {
+		case <-ctx.Done():
+		case <-time.After(wait):
+		}
+		wait = min(wait*2, maxStartupBackoff)
 	}
-	return &Client{rdb: rdb}, nil
+	_ = rdb.Close()
+	return nil, fmt.Errorf("redis ping %s: %w", addr, err)
 }
 
-// MGet returns a map of found keys to their values
+// MGet returns a map of found keys to their values. Reads aren't counted as
+// cache hits or misses here: the cache engine counts those per cell, so
+// internal reads (validators, invalidation, inspection) stay out of them
 func (c *Client) MGet(ctx context.Context, keys []string) (map[string][]byte, error) {
 	start := time.Now()
-	defer func() { /* metrics recorded in the return below */ }()
 	if len(keys) == 0 {
 		observability.ObserveCacheOp("mget", nil, time.Since(start).Seconds())
 		return map[string][]byte{}, nil
 	}
 
-	vals, err := c.rdb.MGet(ctx, keys...).Result()
+	var (
+		out map[string][]byte
+		err error
+	)
+	if c.ring == nil {
+		out = make(map[string][]byte, len(keys))
+		err = mgetInto(ctx, c.rdb, keys, out)
+	} else {
+		out, err = c.mgetSharded(ctx, keys)
+	}
 	observability.ObserveCacheOp("mget", err, time.Since(start).Seconds())
 	if err != nil {
 		return nil, fmt.Errorf("redis MGET %d keys: %w", len(keys), err)
 	}
+	return out, nil
+}
 
-	out := make(map[string][]byte, len(vals))
-	hits := 0
+// mgetInto copies the found values of keys into out
+func mgetInto(ctx context.Context, rdb *redis.Client, keys []string, out map[string][]byte) error {
+	vals, err := rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return fmt.Errorf("node %s: %w", rdb.Options().Addr, err)
+	}
 	for i, v := range vals {
 		if v == nil {
 			continue // missing key
 		}
-		hits++
 		switch t := v.(type) {
 		case string:
 			out[keys[i]] = []byte(t)
@@ -102,20 +178,12 @@ func (c *Client) MGet(ctx context.Context, keys []string) (map[string][]byte, er
 			out[keys[i]] = fmt.Append(nil, t)
 		}
 	}
-	if miss := len(keys) - hits; hits > 0 {
-		observability.AddCacheHits(hits)
-		if miss > 0 {
-			observability.AddCacheMisses(miss)
-		}
-	} else if len(keys) > 0 {
-		observability.AddCacheMisses(len(keys))
-	}
-	return out, nil
+	return nil
 }
 
 func (c *Client) Set(ctx context.Context, key string, val []byte, ttl time.Duration) error {
 	start := time.Now()
-	err := c.rdb.Set(ctx, key, val, ttl).Err()
+	err := c.node(key).Set(ctx, key, val, ttl).Err()
 	observability.ObserveCacheOp("set", err, time.Since(start).Seconds())
 	if err != nil {
 		return fmt.Errorf("redis SET %q: %w", key, err)
@@ -125,7 +193,16 @@ func (c *Client) Set(ctx context.Context, key string, val []byte, ttl time.Durat
 
 func (c *Client) Del(ctx context.Context, keys ...string) error {
 	start := time.Now()
-	err := c.rdb.Del(ctx, keys...).Err()
+	var err error
+	if c.ring == nil {
+		err = c.rdb.Del(ctx, keys...).Err()
+	} else {
+		for i, part := range c.ring.group(keys) {
+			if e := c.shards[i].Del(ctx, part...).Err(); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
 	observability.ObserveCacheOp("del", err, time.Since(start).Seconds())
 	if err != nil {
 		return fmt.Errorf("redis DEL %d keys: %w", len(keys), err)
@@ -133,8 +210,147 @@ func (c *Client) Del(ctx context.Context, keys ...string) error {
 	return nil
 }
 
+// TTL reports key's remaining time to live like memstore.Store.TTL: -2 if
+// the key is missing, -1 if it has no expiry
+func (c *Client) TTL(ctx context.Context, key string) (time.Duration, error) {
+	start := time.Now()
+	ms, err := c.node(key).Do(ctx, "PTTL", key).Int64()
+	observability.ObserveCacheOp("ttl", err, time.Since(start).Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("redis PTTL %q: %w", key, err)
+	}
+	if ms < 0 {
+		return time.Duration(ms), nil
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// maxUpdateAttempts bounds Update's optimistic retries when key keeps
+// changing under it
+const maxUpdateAttempts = 5
+
+// Update replaces key's value with fn(old) atomically: the read and write run
+// under WATCH and are retried if another client writes key in between. The
+// key keeps its TTL. It reports false, without calling fn, when key is missing
+func (c *Client) Update(ctx context.Context, key string, fn func(old []byte) ([]byte, error)) (bool, error) {
+	start := time.Now()
+	found := false
+	txf := func(tx *redis.Tx) error {
+		old, err := tx.Get(ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			found = false
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		found = true
+		val, err := fn(old)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			p.Set(ctx, key, val, redis.KeepTTL)
+			return nil
+		})
+		return err
+	}
+	var err error
+	for range maxUpdateAttempts {
+		if err = c.node(key).Watch(ctx, txf, key); !errors.Is(err, redis.TxFailedErr) {
+			break
+		}
+	}
+	observability.ObserveCacheOp("update", err, time.Since(start).Seconds())
+	if err != nil {
+		return found, fmt.Errorf("redis update %q: %w", key, err)
+	}
+	return found, nil
+}
+
+// SAdd adds members to the set at key and extends the set's expiry to ttl if
+// it would otherwise expire sooner, so the set outlives every entry it lists
+func (c *Client) SAdd(ctx context.Context, key string, ttl time.Duration, members ...string) error {
+	if len(members) == 0 {
+		return nil
+	}
+	args := make([]any, len(members))
+	for i, m := range members {
+		args[i] = m
+	}
+	start := time.Now()
+	_, err := c.node(key).Pipelined(ctx, func(p redis.Pipeliner) error {
+		p.SAdd(ctx, key, args...)
+		if ttl > 0 {
+			p.ExpireNX(ctx, key, ttl)
+			p.ExpireGT(ctx, key, ttl)
+		}
+		return nil
+	})
+	observability.ObserveCacheOp("sadd", err, time.Since(start).Seconds())
+	if err != nil {
+		return fmt.Errorf("redis SADD %q: %w", key, err)
+	}
+	return nil
+}
+
+// SMembers returns the members of the set at key; none when it is missing
+func (c *Client) SMembers(ctx context.Context, key string) ([]string, error) {
+	start := time.Now()
+	out, err := c.node(key).SMembers(ctx, key).Result()
+	observability.ObserveCacheOp("smembers", err, time.Since(start).Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("redis SMEMBERS %q: %w", key, err)
+	}
+	return out, nil
+}
+
+// ScanKeys returns every key matching the glob pattern across all nodes
+func (c *Client) ScanKeys(ctx context.Context, pattern string) ([]string, error) {
+	nodes := c.shards
+	if c.ring == nil {
+		nodes = []*redis.Client{c.rdb}
+	}
+	var out []string
+	start := time.Now()
+	err := func() error {
+		for _, rdb := range nodes {
+			var cursor uint64
+			for {
+				batch, next, err := rdb.Scan(ctx, cursor, pattern, 500).Result()
+				if err != nil {
+					return fmt.Errorf("redis SCAN %s: %w", rdb.Options().Addr, err)
+				}
+				out = append(out, batch...)
+				cursor = next
+				if cursor == 0 {
+					break
+				}
+			}
+		}
+		return nil
+	}()
+	observability.ObserveCacheOp("scan", err, time.Since(start).Seconds())
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *Client) Close() error {
-	if err := c.rdb.Close(); err != nil {
+	if c.ring == nil {
+		if err := c.rdb.Close(); err != nil {
+			return fmt.Errorf("redis close: %w", err)
+		}
+		return nil
+	}
+	var errs []error
+	for _, s := range c.shards {
+		if err := s.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
 		return fmt.Errorf("redis close: %w", err)
 	}
 	return nil
@@ -151,7 +367,24 @@ func (c *Client) MSetWithTTL(
 		return nil
 	}
 
-	_, err := c.rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+	var err error
+	if c.ring == nil {
+		err = msetPipelined(ctx, c.rdb, kv, ttl)
+	} else {
+		err = c.msetSharded(ctx, kv, ttl)
+	}
+
+	observability.ObserveCacheOp("mset", err, time.Since(start).Seconds())
+	if err != nil {
+		return fmt.Errorf("redis MSET %d keys (pipeline): %w", len(kv), err)
+	}
+	return nil
+}
+
+// msetPipelined writes kv in one MULTI/EXEC, so a dropped connection leaves a
+// node with all of its keys or none rather than a partial batch
+func msetPipelined(ctx context.Context, rdb *redis.Client, kv map[string][]byte, ttl time.Duration) error {
+	_, err := rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
 		for k, v := range kv {
 			if err := p.Set(ctx, k, v, ttl).Err(); err != nil {
 				return fmt.Errorf("redis MSET pipeline SET %q: %w", k, err)
@@ -159,10 +392,65 @@ func (c *Client) MSetWithTTL(
 		}
 		return nil
 	})
-
-	observability.ObserveCacheOp("mset", err, time.Since(start).Seconds())
 	if err != nil {
-		return fmt.Errorf("redis MSET %d keys (pipeline): %w", len(kv), err)
+		return fmt.Errorf("node %s: %w", rdb.Options().Addr, err)
 	}
 	return nil
 }
+
+// Sample SCANs up to limit keys spread across all nodes and returns the values
+// of those starting with prefix, the number of keys scanned, and the total key
+// count (DBSIZE summed over nodes); it does not count toward cache hit metrics
+func (c *Client) Sample(ctx context.Context, limit int, prefix string) (map[string][]byte, int, int64, error) {
+	nodes := c.shards
+	if c.ring == nil {
+		nodes = []*redis.Client{c.rdb}
+	}
+	per := max(limit/len(nodes), 1)
+
+	out := make(map[string][]byte)
+	scanned := 0
+	var total int64
+	start := time.Now()
+	err := func() error {
+		for _, rdb := range nodes {
+			n, err := rdb.DBSize(ctx).Result()
+			if err != nil {
+				return fmt.Errorf("redis DBSIZE %s: %w", rdb.Options().Addr, err)
+			}
+			total += n
+
+			var cursor uint64
+			got := 0
+			for got < per {
+				batch, next, err := rdb.Scan(ctx, cursor, "", int64(min(per-got, 500))).Result()
+				if err != nil {
+					return fmt.Errorf("redis SCAN %s: %w", rdb.Options().Addr, err)
+				}
+				got += len(batch)
+				matched := batch[:0]
+				for _, k := range batch {
+					if strings.HasPrefix(k, prefix) {
+						matched = append(matched, k)
+					}
+				}
+				if len(matched) > 0 {
+					if err := mgetInto(ctx, rdb, matched, out); err != nil {
+						return err
+					}
+				}
+				cursor = next
+				if cursor == 0 {
+					break
+				}
+			}
+			scanned += got
+		}
+		return nil
+	}()
+	observability.ObserveCacheOp("scan", err, time.Since(start).Seconds())
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return out, scanned, total, nil
+}
@@ -2,6 +2,7 @@ package redisstore
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -112,3 +113,106 @@ func TestMetrics_Incremented(t *testing.T) {
 		t.Fatalf("missing redis_operation_duration_seconds histogram; got:\n%s", body)
 	}
 }
+
+func TestWithDB_IsolatesKeys(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("miniredis: %v", err)
+	}
+	t.Cleanup(mr.Close)
+	ctx := context.Background()
+
+	a, err := New(ctx, mr.Addr(), WithDB(1))
+	if err != nil {
+		t.Fatalf("New db1: %v", err)
+	}
+	t.Cleanup(func() { _ = a.Close() })
+	b, err := New(ctx, mr.Addr(), WithDB(2))
+	if err != nil {
+		t.Fatalf("New db2: %v", err)
+	}
+	t.Cleanup(func() { _ = b.Close() })
+
+	if err := a.Set(ctx, "k", []byte("from-a"), time.Minute); err != nil {
+		t.Fatalf("Set a: %v", err)
+	}
+	if err := b.Set(ctx, "k", []byte("from-b"), time.Minute); err != nil {
+		t.Fatalf("Set b: %v", err)
+	}
+
+	got, err := a.MGet(ctx, []string{"k"})
+	if err != nil || string(got["k"]) != "from-a" {
+		t.Fatalf("db1 sees %q (err=%v), want from-a", got["k"], err)
+	}
+	if err := b.Del(ctx, "k"); err != nil {
+		t.Fatalf("Del b: %v", err)
+	}
+	if got, _ := a.MGet(ctx, []string{"k"}); string(got["k"]) != "from-a" {
+		t.Fatalf("delete in db2 leaked into db1: %q", got["k"])
+	}
+	if mr.DB(0).Exists("k") {
+		t.Fatalf("key written to db0")
+	}
+}
+
+func TestNew_StartupRetryWaitsForRedis(t *testing.T) {
+	// reserve a free address, then bring Redis up on it only after the first
+	// pings have failed
+	probe, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("miniredis: %v", err)
+	}
+	addr := probe.Addr()
+	probe.Close()
+
+	mr := miniredis.NewMiniRedis()
+	t.Cleanup(mr.Close)
+	started := make(chan error, 1)
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		started <- mr.StartAddr(addr)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	rc, err := New(ctx, addr, WithStartupRetry(20, 50*time.Millisecond))
+	if serr := <-started; serr != nil {
+		t.Fatalf("start miniredis: %v", serr)
+	}
+	if err != nil {
+		t.Fatalf("New with retry: %v", err)
+	}
+	_ = rc.Close()
+}
+
+func TestNew_StartupRetryGivesUp(t *testing.T) {
+	// a listener that hangs up on every connection fails each ping quickly
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer func() { _ = ln.Close() }()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = c.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	start := time.Now()
+	if _, err := New(ctx, ln.Addr().String(), WithStartupRetry(3, 20*time.Millisecond)); err == nil {
+		t.Fatalf("New succeeded against a server that never answers")
+	}
+	if ctx.Err() != nil {
+		t.Fatalf("gave up on the context, not on the attempt budget")
+	}
+	// 20ms + 40ms of backoff between the three pings
+	if d := time.Since(start); d < 60*time.Millisecond {
+		t.Fatalf("gave up after %v, before the backoff ran", d)
+	}
+}
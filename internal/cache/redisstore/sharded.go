@@ -0,0 +1,180 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// virtual nodes per shard; enough to keep the key spread within a few percent
+const ringReplicas = 160
+
+// ring is a consistent-hash ring mapping keys onto shard indexes
+type ring struct {
+	points []uint64
+	owner  map[uint64]int
+	n      int
+}
+
+func newRing(addrs []string) *ring {
+	r := &ring{
+		points: make([]uint64, 0, len(addrs)*ringReplicas),
+		owner:  make(map[uint64]int, len(addrs)*ringReplicas),
+		n:      len(addrs),
+	}
+	for i, addr := range addrs {
+		for v := range ringReplicas {
+			h := xxhash.Sum64String(addr + "#" + strconv.Itoa(v))
+			if _, dup := r.owner[h]; dup {
+				continue
+			}
+			r.owner[h] = i
+			r.points = append(r.points, h)
+		}
+	}
+	sort.Slice(r.points, func(a, b int) bool { return r.points[a] < r.points[b] })
+	return r
+}
+
+// shard returns the index of the shard owning key
+func (r *ring) shard(key string) int {
+	h := xxhash.Sum64String(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owner[r.points[i]]
+}
+
+// group splits keys by owning shard, preserving order within each shard
+func (r *ring) group(keys []string) map[int][]string {
+	out := make(map[int][]string, r.n)
+	for _, k := range keys {
+		i := r.shard(k)
+		out[i] = append(out[i], k)
+	}
+	return out
+}
+
+// NewSharded connects to several standalone Redis nodes and consistent-hashes
+// keys across them; a single address behaves exactly like New
+func NewSharded(ctx context.Context, addrs []string, opts ...Option) (*Client, error) {
+	switch len(addrs) {
+	case 0:
+		return nil, errors.New("redis address is required")
+	case 1:
+		return New(ctx, addrs[0], opts...)
+	}
+
+	shards := make([]*redis.Client, 0, len(addrs))
+	for _, addr := range addrs {
+		rdb, err := dial(ctx, addr, opts...)
+		if err != nil {
+			for _, s := range shards {
+				_ = s.Close()
+			}
+			return nil, err
+		}
+		shards = append(shards, rdb)
+	}
+	return &Client{rdb: shards[0], shards: shards, ring: newRing(addrs)}, nil
+}
+
+// node returns the Redis client that owns key
+func (c *Client) node(key string) *redis.Client {
+	if c.ring == nil {
+		return c.rdb
+	}
+	return c.shards[c.ring.shard(key)]
+}
+
+// ShardFor reports which shard owns key (always 0 when unsharded)
+func (c *Client) ShardFor(key string) int {
+	if c.ring == nil {
+		return 0
+	}
+	return c.ring.shard(key)
+}
+
+// mgetSharded fans MGET out to every shard owning some of keys and merges the results
+func (c *Client) mgetSharded(ctx context.Context, keys []string) (map[string][]byte, error) {
+	groups := c.ring.group(keys)
+	out := make(map[string][]byte, len(keys))
+	if len(groups) == 1 {
+		for i, part := range groups {
+			if err := mgetInto(ctx, c.shards[i], part, out); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs []error
+	)
+	for i, part := range groups {
+		wg.Add(1)
+		go func(rdb *redis.Client, part []string) {
+			defer wg.Done()
+			local := make(map[string][]byte, len(part))
+			err := mgetInto(ctx, rdb, part, local)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			for k, v := range local {
+				out[k] = v
+			}
+		}(c.shards[i], part)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("sharded mget: %w", err)
+	}
+	return out, nil
+}
+
+// msetSharded pipelines each shard's share of kv concurrently
+func (c *Client) msetSharded(ctx context.Context, kv map[string][]byte, ttl time.Duration) error {
+	parts := make(map[int]map[string][]byte, len(c.shards))
+	for k, v := range kv {
+		i := c.ring.shard(k)
+		if parts[i] == nil {
+			parts[i] = make(map[string][]byte)
+		}
+		parts[i][k] = v
+	}
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs []error
+	)
+	for i, part := range parts {
+		wg.Add(1)
+		go func(rdb *redis.Client, part map[string][]byte) {
+			defer wg.Done()
+			if err := msetPipelined(ctx, rdb, part, ttl); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}(c.shards[i], part)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("sharded mset: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package redisstore
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+)
+
+func newShardedMini(t *testing.T) (*Client, []*miniredis.Miniredis) {
+	t.Helper()
+	mrs := make([]*miniredis.Miniredis, 2)
+	addrs := make([]string, 2)
+	for i := range mrs {
+		mr, err := miniredis.Run()
+		if err != nil {
+			t.Fatalf("miniredis: %v", err)
+		}
+		t.Cleanup(mr.Close)
+		mrs[i] = mr
+		addrs[i] = mr.Addr()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	t.Cleanup(cancel)
+
+	rc, err := NewSharded(ctx, addrs)
+	if err != nil {
+		t.Fatalf("NewSharded: %v", err)
+	}
+	t.Cleanup(func() { _ = rc.Close() })
+	return rc, mrs
+}
+
+func TestSharded_KeysDistribute_AndMGetReassembles(t *testing.T) {
+	rc, mrs := newShardedMini(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	const n = 200
+	kv := make(map[string][]byte, n)
+	keys := make([]string, 0, n+1)
+	for i := range n {
+		k := fmt.Sprintf("feat:demo:%d", i)
+		kv[k] = []byte(fmt.Sprintf("v%d", i))
+		keys = append(keys, k)
+	}
+	if err := rc.MSetWithTTL(ctx, kv, time.Minute); err != nil {
+		t.Fatalf("MSetWithTTL: %v", err)
+	}
+	if err := rc.Set(ctx, "idx:demo:cell", []byte("ids"), time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	keys = append(keys, "idx:demo:cell", "missing")
+
+	for i, mr := range mrs {
+		got := len(mr.Keys())
+		if got < n/4 {
+			t.Fatalf("shard %d holds %d keys; expected a reasonable share of %d", i, got, n+1)
+		}
+	}
+	if total := len(mrs[0].Keys()) + len(mrs[1].Keys()); total != n+1 {
+		t.Fatalf("keys duplicated or lost across shards: total=%d want %d", total, n+1)
+	}
+	for k := range kv {
+		if !mrs[rc.ShardFor(k)].Exists(k) {
+			t.Fatalf("key %q not stored on its owning shard %d", k, rc.ShardFor(k))
+		}
+	}
+
+	got, err := rc.MGet(ctx, keys)
+	if err != nil {
+		t.Fatalf("MGet: %v", err)
+	}
+	if len(got) != n+1 {
+		t.Fatalf("MGet size=%d want %d", len(got), n+1)
+	}
+	for k, want := range kv {
+		if string(got[k]) != string(want) {
+			t.Fatalf("MGet %q=%q want %q", k, got[k], want)
+		}
+	}
+	if string(got["idx:demo:cell"]) != "ids" {
+		t.Fatalf("MGet idx key=%q", got["idx:demo:cell"])
+	}
+	if _, ok := got["missing"]; ok {
+		t.Fatalf("unexpected entry for missing key")
+	}
+
+	if err := rc.Del(ctx, keys...); err != nil {
+		t.Fatalf("Del: %v", err)
+	}
+	if len(mrs[0].Keys())+len(mrs[1].Keys()) != 0 {
+		t.Fatalf("expected all keys deleted across shards")
+	}
+}
+
+func TestRing_StableAndMinimalRemap(t *testing.T) {
+	two := newRing([]string{"a:6379", "b:6379"})
+	three := newRing([]string{"a:6379", "b:6379", "c:6379"})
+
+	moved := 0
+	const n = 2000
+	for i := range n {
+		k := fmt.Sprintf("k%d", i)
+		if two.shard(k) != two.shard(k) {
+			t.Fatalf("ring lookup not deterministic for %q", k)
+		}
+		if s := three.shard(k); s != 2 && s != two.shard(k) {
+			moved++
+		}
+	}
+	if moved != 0 {
+		t.Fatalf("adding a shard moved %d keys between existing shards", moved)
+	}
+}
@@ -0,0 +1,83 @@
+package v2
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/cellindex"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/featurestore"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/memstore"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/redisstore"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+)
+
+// Backend opens the stores for one CACHE_BACKEND value
+type Backend func(cfg config.Config) (*Store, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = map[string]Backend{}
+)
+
+// RegisterBackend makes b selectable with CACHE_BACKEND=name, replacing any
+// backend already registered under that name
+func RegisterBackend(name string, b Backend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	backends[strings.ToLower(name)] = b
+}
+
+// Open builds the stores for cfg.CacheBackend; empty selects redis
+func Open(cfg config.Config) (*Store, error) {
+	name := cfg.CacheBackend
+	if name == "" {
+		name = "redis"
+	}
+	backendsMu.RLock()
+	b, ok := backends[strings.ToLower(name)]
+	names := make([]string, 0, len(backends))
+	for n := range backends {
+		names = append(names, n)
+	}
+	backendsMu.RUnlock()
+	if !ok {
+		slices.Sort(names)
+		return nil, fmt.Errorf("unknown CACHE_BACKEND %q (want one of %s)", cfg.CacheBackend, strings.Join(names, ", "))
+	}
+	st, err := b(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("open %s backend: %w", name, err)
+	}
+	return st, nil
+}
+
+// NewStore bundles stores from a backend outside this package. keys may be
+// nil; such a store has no /admin/stats key counts and no orphan janitor
+func NewStore(features featurestore.FeatureStore, cells cellindex.CellIndex, keys KeyCounter) *Store {
+	return &Store{Features: features, Cells: cells, Keys: keys}
+}
+
+// janitor cadence for the in-memory backend
+const memoryJanitorInterval = 30 * time.Second
+
+func init() {
+	RegisterBackend("redis", func(cfg config.Config) (*Store, error) {
+		addrs := cfg.RedisShards
+		if len(addrs) == 0 {
+			addrs = []string{cfg.RedisAddr}
+		}
+		rc, err := redisstore.NewSharded(context.Background(), addrs, redisstore.WithDB(cfg.RedisDB),
+			redisstore.WithStartupRetry(cfg.RedisStartupAttempts, cfg.RedisStartupInterval))
+		if err != nil {
+			return nil, fmt.Errorf("redis client: %w", err)
+		}
+		return NewRedisStore(rc, cfg.CacheTTLDefault), nil
+	})
+	RegisterBackend("memory", func(cfg config.Config) (*Store, error) {
+		return NewMemoryStore(memstore.New(memoryJanitorInterval), cfg.CacheTTLDefault), nil
+	})
+}
@@ -0,0 +1,189 @@
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/cellindex"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/featurestore"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+)
+
+// Mirror returns a store that reads from primary and applies every write and
+// delete to primary and each of mirrors, so one invalidation consumer keeps
+// several backends (such as a shadow engine's Redis DB) consistent. Nil
+// mirrors are dropped; with none left primary is returned as is
+func Mirror(primary *Store, mirrors ...*Store) *Store {
+	all := []*Store{primary}
+	for _, m := range mirrors {
+		if m != nil && m != primary {
+			all = append(all, m)
+		}
+	}
+	if len(all) == 1 {
+		return primary
+	}
+
+	fs := make(mirrorFeatures, 0, len(all))
+	idx := make(mirrorCells, 0, len(all))
+	var space mirrorKeyspace
+	for _, s := range all {
+		fs = append(fs, s.Features)
+		idx = append(idx, s.Cells)
+		if s.space != nil {
+			space = append(space, s.space)
+		}
+	}
+	out := &Store{Features: fs, Cells: idx, Keys: primary.Keys}
+	if len(space) > 0 {
+		out.space = space
+	}
+	return out
+}
+
+type mirrorFeatures []featurestore.FeatureStore
+
+func (m mirrorFeatures) MGetFeatures(ctx context.Context, layer string, ids []string) (map[string][]byte, error) {
+	return m[0].MGetFeatures(ctx, layer, ids)
+}
+
+func (m mirrorFeatures) PutFeatures(ctx context.Context, layer string, feats map[string][]byte, ttl time.Duration) error {
+	var errs []error
+	for _, fs := range m {
+		errs = append(errs, fs.PutFeatures(ctx, layer, feats, ttl))
+	}
+	return errors.Join(errs...)
+}
+
+func (m mirrorFeatures) DelFeatures(ctx context.Context, layer string, ids []string) error {
+	var errs []error
+	for _, fs := range m {
+		if d, ok := fs.(featurestore.Deleter); ok {
+			errs = append(errs, d.DelFeatures(ctx, layer, ids))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// PatchProperties patches every store that can and evicts id from those that
+// can't; found reports whether any store held the feature
+func (m mirrorFeatures) PatchProperties(ctx context.Context, layer, id string, props map[string]json.RawMessage) (bool, error) {
+	found := false
+	for _, fs := range m {
+		if p, ok := fs.(featurestore.Patcher); ok {
+			ok, err := p.PatchProperties(ctx, layer, id, props)
+			if err != nil {
+				return false, fmt.Errorf("mirror patch: %w", err)
+			}
+			found = found || ok
+			continue
+		}
+		if d, ok := fs.(featurestore.Deleter); ok {
+			if err := d.DelFeatures(ctx, layer, []string{id}); err != nil {
+				return false, fmt.Errorf("mirror patch evict: %w", err)
+			}
+		}
+	}
+	return found, nil
+}
+
+func (m mirrorFeatures) Scopes(ctx context.Context, layer string) ([]string, error) {
+	srcs := make([]any, len(m))
+	for i, fs := range m {
+		srcs[i] = fs
+	}
+	return mirrorScopes(ctx, layer, srcs)
+}
+
+type mirrorCells []cellindex.CellIndex
+
+func (m mirrorCells) GetIDs(ctx context.Context, layer string, res int, cell string, filters model.Filters) ([]string, error) {
+	return m[0].GetIDs(ctx, layer, res, cell, filters)
+}
+
+func (m mirrorCells) MGetIDs(ctx context.Context, layer string, res int, cells []string, filters model.Filters) (map[string][]string, error) {
+	return m[0].MGetIDs(ctx, layer, res, cells, filters)
+}
+
+func (m mirrorCells) SetIDs(ctx context.Context, layer string, res int, cell string, filters model.Filters, ids []string, ttl time.Duration) error {
+	var errs []error
+	for _, idx := range m {
+		errs = append(errs, idx.SetIDs(ctx, layer, res, cell, filters, ids, ttl))
+	}
+	return errors.Join(errs...)
+}
+
+func (m mirrorCells) DelCells(ctx context.Context, layer string, res int, cells []string, filters model.Filters) error {
+	var errs []error
+	for _, idx := range m {
+		errs = append(errs, idx.DelCells(ctx, layer, res, cells, filters))
+	}
+	return errors.Join(errs...)
+}
+
+func (m mirrorCells) DropIDs(ctx context.Context, layer string, ids []string) (int, error) {
+	total := 0
+	var errs []error
+	for _, idx := range m {
+		d, ok := idx.(cellindex.IDDropper)
+		if !ok {
+			continue
+		}
+		n, err := d.DropIDs(ctx, layer, ids)
+		total += n
+		errs = append(errs, err)
+	}
+	return total, errors.Join(errs...)
+}
+
+func (m mirrorCells) Scopes(ctx context.Context, layer string) ([]string, error) {
+	srcs := make([]any, len(m))
+	for i, idx := range m {
+		srcs[i] = idx
+	}
+	return mirrorScopes(ctx, layer, srcs)
+}
+
+// mirrorScopes unions the scopes of every source that can list them; a
+// failing source is reported but the scopes found elsewhere are kept
+func mirrorScopes(ctx context.Context, layer string, srcs []any) ([]string, error) {
+	seen := map[string]struct{}{}
+	var out []string
+	var errs []error
+	for _, src := range srcs {
+		sl, ok := src.(cellindex.ScopeLister)
+		if !ok {
+			continue
+		}
+		found, err := sl.Scopes(ctx, layer)
+		errs = append(errs, err)
+		for _, sc := range found {
+			if _, dup := seen[sc]; !dup {
+				seen[sc] = struct{}{}
+				out = append(out, sc)
+			}
+		}
+	}
+	return out, errors.Join(errs...)
+}
+
+type mirrorKeyspace []keyspace
+
+func (m mirrorKeyspace) keysWithPrefix(ctx context.Context, prefix string) ([]string, error) {
+	return m[0].keysWithPrefix(ctx, prefix)
+}
+
+func (m mirrorKeyspace) mget(ctx context.Context, keys []string) (map[string][]byte, error) {
+	return m[0].mget(ctx, keys)
+}
+
+func (m mirrorKeyspace) del(ctx context.Context, keys ...string) error {
+	var errs []error
+	for _, ks := range m {
+		errs = append(errs, ks.del(ctx, keys...))
+	}
+	return errors.Join(errs...)
+}
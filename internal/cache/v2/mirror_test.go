@@ -0,0 +1,59 @@
+package v2
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/cellindex"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/featurestore"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/memstore"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/redisstore"
+)
+
+func TestMirror_InvalidatesEveryStore(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	cli, err := redisstore.New(ctx, mr.Addr())
+	if err != nil {
+		t.Fatalf("redisstore: %v", err)
+	}
+	t.Cleanup(func() { _ = cli.Close() })
+	st := memstore.New(0)
+	t.Cleanup(func() { _ = st.Close() })
+
+	primary := NewRedisStore(cli, time.Minute)
+	shadow := NewMemoryStore(st, time.Minute)
+	if m := Mirror(primary, nil); m != primary {
+		t.Fatalf("Mirror without mirrors should return primary")
+	}
+	m := Mirror(primary, shadow)
+
+	const layer, cell = "demo:NR_polygon", "892a100d2b3ffff"
+	for _, s := range []*Store{primary, shadow} {
+		if err := s.Features.PutFeatures(ctx, layer, map[string][]byte{"s:a": []byte(`{}`)}, time.Minute); err != nil {
+			t.Fatalf("PutFeatures: %v", err)
+		}
+		if err := s.Cells.SetIDs(ctx, layer, 8, cell, "", []string{"s:a"}, time.Minute); err != nil {
+			t.Fatalf("SetIDs: %v", err)
+		}
+	}
+
+	if err := m.Features.(featurestore.Deleter).DelFeatures(ctx, layer, []string{"s:a"}); err != nil {
+		t.Fatalf("DelFeatures: %v", err)
+	}
+	n, err := m.Cells.(cellindex.IDDropper).DropIDs(ctx, layer, []string{"s:a"})
+	if err != nil || n != 2 {
+		t.Fatalf("DropIDs: n=%d err=%v, want 2", n, err)
+	}
+	for name, s := range map[string]*Store{"primary": primary, "shadow": shadow} {
+		if got, _ := s.Features.MGetFeatures(ctx, layer, []string{"s:a"}); len(got) != 0 {
+			t.Errorf("%s still holds the feature: %v", name, got)
+		}
+		if ids, _ := s.Cells.GetIDs(ctx, layer, 8, cell, ""); ids != nil {
+			t.Errorf("%s still holds the cell: %v", name, ids)
+		}
+	}
+}
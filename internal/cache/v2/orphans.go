@@ -0,0 +1,188 @@
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/cellindex"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/memstore"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/redisstore"
+)
+
+// keyspace is the raw key access the orphan janitor needs from a backend
+type keyspace interface {
+	keysWithPrefix(ctx context.Context, prefix string) ([]string, error)
+	mget(ctx context.Context, keys []string) (map[string][]byte, error)
+	del(ctx context.Context, keys ...string) error
+}
+
+type redisKeyspace struct {
+	cli *redisstore.Client
+}
+
+func (k redisKeyspace) keysWithPrefix(ctx context.Context, prefix string) ([]string, error) {
+	out, err := k.cli.ScanKeys(ctx, prefix+"*")
+	if err != nil {
+		return nil, fmt.Errorf("scan %s*: %w", prefix, err)
+	}
+	return out, nil
+}
+
+func (k redisKeyspace) mget(ctx context.Context, keys []string) (map[string][]byte, error) {
+	out, err := k.cli.MGet(ctx, keys)
+	if err != nil {
+		return nil, fmt.Errorf("mget %d keys: %w", len(keys), err)
+	}
+	return out, nil
+}
+
+func (k redisKeyspace) del(ctx context.Context, keys ...string) error {
+	if err := k.cli.Del(ctx, keys...); err != nil {
+		return fmt.Errorf("del %d keys: %w", len(keys), err)
+	}
+	return nil
+}
+
+type memoryKeyspace struct {
+	st *memstore.Store
+}
+
+func (k memoryKeyspace) keysWithPrefix(_ context.Context, prefix string) ([]string, error) {
+	var out []string
+	k.st.Range(func(key string, _ []byte) bool {
+		if strings.HasPrefix(key, prefix) {
+			out = append(out, key)
+		}
+		return true
+	})
+	return out, nil
+}
+
+func (k memoryKeyspace) mget(_ context.Context, keys []string) (map[string][]byte, error) {
+	out, err := k.st.MGet(keys)
+	if err != nil {
+		return nil, fmt.Errorf("mget %d keys: %w", len(keys), err)
+	}
+	return out, nil
+}
+
+func (k memoryKeyspace) del(_ context.Context, keys ...string) error {
+	if err := k.st.Del(keys...); err != nil {
+		return fmt.Errorf("del %d keys: %w", len(keys), err)
+	}
+	return nil
+}
+
+// OrphanJanitor deletes feature keys that no cell index entry references, e.g.
+// after their indexes expired first. A key is only deleted once it has stayed
+// orphaned across sweeps for at least Grace, which covers fills that write
+// features just before their index entry. Features cached only through the
+// by-id endpoint have no index entry either and are collected the same way
+type OrphanJanitor struct {
+	ks    keyspace
+	grace time.Duration
+	// maxDeletes bounds deletions per sweep; 0 is unlimited
+	maxDeletes int
+	// orphaned holds when each currently orphaned key was first seen
+	orphaned map[string]time.Time
+}
+
+// NewOrphanJanitor returns a janitor over s's backend, or nil when the backend
+// has no raw key access (see NewStore); it is not safe for concurrent sweeps
+func (s *Store) NewOrphanJanitor(grace time.Duration, maxDeletes int) *OrphanJanitor {
+	if s.space == nil {
+		return nil
+	}
+	return &OrphanJanitor{
+		ks:         s.space,
+		grace:      max(grace, 0),
+		maxDeletes: max(maxDeletes, 0),
+		orphaned:   map[string]time.Time{},
+	}
+}
+
+// Sweep walks every feature and cell index key once and deletes the features
+// that have been orphaned for the grace period as of now; it returns how many
+// it deleted
+func (j *OrphanJanitor) Sweep(ctx context.Context, now time.Time) (int, error) {
+	idxKeys, err := j.ks.keysWithPrefix(ctx, cellIndexPrefix)
+	if err != nil {
+		return 0, fmt.Errorf("orphan sweep: %w", err)
+	}
+	referenced := make(map[string]struct{})
+	if len(idxKeys) > 0 {
+		entries, err := j.ks.mget(ctx, idxKeys)
+		if err != nil {
+			return 0, fmt.Errorf("orphan sweep: %w", err)
+		}
+		for k, raw := range entries {
+			addReferences(referenced, k, raw)
+		}
+	}
+
+	featKeys, err := j.ks.keysWithPrefix(ctx, featurePrefix)
+	if err != nil {
+		return 0, fmt.Errorf("orphan sweep: %w", err)
+	}
+	live := make(map[string]time.Time, len(j.orphaned))
+	var expired []string
+	for _, k := range featKeys {
+		if _, ok := referenced[k]; ok {
+			continue
+		}
+		first, ok := j.orphaned[k]
+		if !ok {
+			first = now
+		}
+		if now.Sub(first) >= j.grace && (j.maxDeletes == 0 || len(expired) < j.maxDeletes) {
+			expired = append(expired, k)
+			continue
+		}
+		live[k] = first
+	}
+	// keys that were referenced again or vanished drop out of tracking
+	j.orphaned = live
+
+	if len(expired) == 0 {
+		return 0, nil
+	}
+	if err := j.ks.del(ctx, expired...); err != nil {
+		for _, k := range expired {
+			j.orphaned[k] = now
+		}
+		return 0, fmt.Errorf("orphan sweep: %w", err)
+	}
+	return len(expired), nil
+}
+
+// addReferences records the feature keys an index entry points at; index keys
+// are idx:<layer>:<res>:<cell>:filters=... and features live at feat:<layer>:<id>
+func addReferences(into map[string]struct{}, idxKey string, raw []byte) {
+	rest := strings.TrimPrefix(idxKey, cellIndexPrefix)
+	i := strings.Index(rest, ":filters=")
+	if i < 0 {
+		return
+	}
+	head := rest[:i]
+	// drop :<res>:<cell> to leave the (possibly colon-bearing) layer
+	for range 2 {
+		j := strings.LastIndexByte(head, ':')
+		if j < 0 {
+			return
+		}
+		head = head[:j]
+	}
+	var ids []string
+	if err := json.Unmarshal(raw, &ids); err != nil {
+		return
+	}
+	for _, id := range ids {
+		if id == cellindex.EmptyMarkerID {
+			continue
+		}
+		into[featurePrefix+head+":"+id] = struct{}{}
+	}
+}
@@ -0,0 +1,81 @@
+package v2
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/memstore"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/redisstore"
+)
+
+func TestOrphanJanitor_CollectsUnreferencedFeatures(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	cli, err := redisstore.New(ctx, mr.Addr())
+	if err != nil {
+		t.Fatalf("redisstore: %v", err)
+	}
+	t.Cleanup(func() { _ = cli.Close() })
+	st := memstore.New(0)
+	t.Cleanup(func() { _ = st.Close() })
+
+	for name, s := range map[string]*Store{
+		"redis":  NewRedisStore(cli, time.Minute),
+		"memory": NewMemoryStore(st, time.Minute),
+	} {
+		t.Run(name, func(t *testing.T) {
+			const layer, cell = "demo:NR_polygon", "892a100d2b3ffff"
+			feats := map[string][]byte{"s:kept": []byte(`{}`), "s:orphan": []byte(`{}`), "n:1": []byte(`{}`)}
+			if err := s.Features.PutFeatures(ctx, layer, feats, time.Minute); err != nil {
+				t.Fatalf("PutFeatures: %v", err)
+			}
+			if err := s.Cells.SetIDs(ctx, layer, 8, cell, "", []string{"s:kept"}, time.Minute); err != nil {
+				t.Fatalf("SetIDs: %v", err)
+			}
+
+			j := s.NewOrphanJanitor(time.Minute, 1)
+			now := time.Now()
+			if n, err := j.Sweep(ctx, now); err != nil || n != 0 {
+				t.Fatalf("first sweep only notes orphans: n=%d err=%v", n, err)
+			}
+			// n:1 gets referenced before the grace period is up
+			if err := s.Cells.SetIDs(ctx, layer, 8, cell, "pop > 1", []string{"n:1"}, time.Minute); err != nil {
+				t.Fatalf("SetIDs: %v", err)
+			}
+			if n, err := j.Sweep(ctx, now.Add(time.Minute)); err != nil || n != 1 {
+				t.Fatalf("sweep after grace: n=%d err=%v, want 1", n, err)
+			}
+
+			got, err := s.Features.MGetFeatures(ctx, layer, []string{"s:kept", "s:orphan", "n:1"})
+			if err != nil {
+				t.Fatalf("MGetFeatures: %v", err)
+			}
+			if _, ok := got["s:orphan"]; ok || len(got) != 2 {
+				t.Fatalf("want only s:orphan collected, left %v", got)
+			}
+		})
+	}
+}
+
+func TestOrphanJanitor_MaxDeletesPerSweep(t *testing.T) {
+	ctx := context.Background()
+	st := memstore.New(0)
+	t.Cleanup(func() { _ = st.Close() })
+	s := NewMemoryStore(st, time.Minute)
+
+	feats := map[string][]byte{"s:a": []byte(`{}`), "s:b": []byte(`{}`), "s:c": []byte(`{}`)}
+	if err := s.Features.PutFeatures(ctx, "demo:roads", feats, time.Minute); err != nil {
+		t.Fatalf("PutFeatures: %v", err)
+	}
+	j := s.NewOrphanJanitor(0, 2)
+	now := time.Now()
+	if n, _ := j.Sweep(ctx, now); n != 2 {
+		t.Fatalf("first sweep deleted %d, want the cap of 2", n)
+	}
+	if n, _ := j.Sweep(ctx, now); n != 1 {
+		t.Fatalf("second sweep deleted %d, want the remaining 1", n)
+	}
+}
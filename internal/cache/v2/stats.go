@@ -0,0 +1,77 @@
+package v2
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/memstore"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/redisstore"
+)
+
+const (
+	cellIndexPrefix = "idx:"
+	featurePrefix   = "feat:"
+)
+
+// KeyCounts summarizes the keys held by a store
+type KeyCounts struct {
+	CellIndex int64
+	Features  int64
+	// Bytes estimates key plus value size; it ignores backend overhead
+	Bytes int64
+	// Sampled is set when the counts were scaled up from a partial scan
+	Sampled bool
+}
+
+// KeyCounter reports key counts; sample bounds how many keys a backend may scan
+type KeyCounter interface {
+	CountKeys(ctx context.Context, sample int) (KeyCounts, error)
+}
+
+type redisKeyCounter struct {
+	cli *redisstore.Client
+}
+
+// CountKeys SCAN-samples up to sample keys and scales by the total key count
+func (c redisKeyCounter) CountKeys(ctx context.Context, sample int) (KeyCounts, error) {
+	vals, scanned, total, err := c.cli.Sample(ctx, sample, "")
+	if err != nil {
+		return KeyCounts{}, fmt.Errorf("count keys: %w", err)
+	}
+	var out KeyCounts
+	for k, v := range vals {
+		out.add(k, v)
+	}
+	if scanned > 0 && int64(scanned) < total {
+		out.CellIndex = out.CellIndex * total / int64(scanned)
+		out.Features = out.Features * total / int64(scanned)
+		out.Bytes = out.Bytes * total / int64(scanned)
+		out.Sampled = true
+	}
+	return out, nil
+}
+
+type memoryKeyCounter struct {
+	st *memstore.Store
+}
+
+// CountKeys counts exactly; sample is ignored since the walk is in-process
+func (c memoryKeyCounter) CountKeys(_ context.Context, _ int) (KeyCounts, error) {
+	var out KeyCounts
+	c.st.Range(func(key string, val []byte) bool {
+		out.add(key, val)
+		return true
+	})
+	return out, nil
+}
+
+func (kc *KeyCounts) add(key string, val []byte) {
+	switch {
+	case strings.HasPrefix(key, cellIndexPrefix):
+		kc.CellIndex++
+	case strings.HasPrefix(key, featurePrefix):
+		kc.Features++
+	}
+	kc.Bytes += int64(len(key) + len(val))
+}
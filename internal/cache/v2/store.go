@@ -2,21 +2,51 @@
 package v2
 
 import (
+	"context"
+	"fmt"
 	"time"
 
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/cellindex"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/featurestore"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/memstore"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/redisstore"
 )
 
 type Store struct {
 	Features featurestore.FeatureStore
 	Cells    cellindex.CellIndex
+	Keys     KeyCounter
+
+	space keyspace
 }
 
 func NewRedisStore(cli *redisstore.Client, defaultTTL time.Duration) *Store {
 	return &Store{
 		Features: featurestore.NewRedisStore(cli, defaultTTL),
 		Cells:    cellindex.NewRedisIndex(cli),
+		Keys:     redisKeyCounter{cli: cli},
+		space:    redisKeyspace{cli: cli},
+	}
+}
+
+func NewMemoryStore(st *memstore.Store, defaultTTL time.Duration) *Store {
+	return &Store{
+		Features: featurestore.NewMemoryStore(st, defaultTTL),
+		Cells:    cellindex.NewMemoryIndex(st),
+		Keys:     memoryKeyCounter{st: st},
+		space:    memoryKeyspace{st: st},
+	}
+}
+
+// Del removes raw keys from the backend, for keys outside the feature store
+// and cell index such as legacy per-cell entries. A store from NewStore has
+// no keyspace and deletes nothing
+func (s *Store) Del(ctx context.Context, keys ...string) error {
+	if s.space == nil || len(keys) == 0 {
+		return nil
+	}
+	if err := s.space.del(ctx, keys...); err != nil {
+		return fmt.Errorf("store del: %w", err)
 	}
+	return nil
 }
@@ -17,21 +17,38 @@ func NewGeoJSONV2Adapter(agg *geojsonagg.Aggregator) *GeoJSONV2Adapter {
 }
 
 func (a *GeoJSONV2Adapter) MergeWithQuery(
-	_ context.Context,
+	ctx context.Context,
 	q QueryParams,
 	pages []ShardPage,
 ) ([]byte, error) {
+	out, _, err := a.MergeWithDiagnostics(ctx, q, pages)
+	return out, err
+}
+
+// MergeWithDiagnostics merges pages and reports the aggregator's dedup counts
+func (a *GeoJSONV2Adapter) MergeWithDiagnostics(
+	_ context.Context,
+	q QueryParams,
+	pages []ShardPage,
+) ([]byte, Diagnostics, error) {
 	req := geojsonagg.Request{
 		Query: geojsonagg.Query{
-			StartIndex: q.Offset,
-			Limit:      q.Limit,
-			Sort:       convertSortKeys(q.Sort),
+			StartIndex:    q.Offset,
+			Limit:         q.Limit,
+			Sort:          convertSortKeys(q.Sort, q.PropertyTypes),
+			GeomPrecision: q.GeomPrecision,
+			IDProperty:    q.IDProperty,
+			TimeProperty:  q.TimeProperty,
+			CreatedAfter:  q.CreatedAfter,
+			CreatedBefore: q.CreatedBefore,
 		},
 		Shards: make([]geojsonagg.ShardPage, 0, len(pages)),
 	}
 
 	type fcRoot struct {
-		Features []json.RawMessage `json:"features"`
+		Features      []json.RawMessage `json:"features"`
+		NumberMatched json.RawMessage   `json:"numberMatched"`
+		TotalFeatures json.RawMessage   `json:"totalFeatures"`
 	}
 
 	for i, page := range pages {
@@ -49,23 +66,29 @@ func (a *GeoJSONV2Adapter) MergeWithQuery(
 			}
 
 			req.Shards = append(req.Shards, geojsonagg.ShardPage{
-				Meta:       geojsonagg.ShardMeta{FromCache: fromCache, ID: fmt.Sprintf("part-%d", i)},
-				Features:   feats,
-				GeomHashes: hashes,
+				Meta:          geojsonagg.ShardMeta{FromCache: fromCache, ID: fmt.Sprintf("part-%d", i)},
+				Features:      feats,
+				GeomHashes:    hashes,
+				NumberMatched: page.NumberMatched,
 			})
 
 		case len(page.Body) > 0:
 			var root fcRoot
 			if err := json.Unmarshal(page.Body, &root); err != nil {
-				return nil, fmt.Errorf("part %d: parse json: %w", i, err)
+				return nil, Diagnostics{}, fmt.Errorf("part %d: parse json: %w", i, err)
 			}
 			if root.Features == nil {
-				return nil, fmt.Errorf(`part %d: missing required member "features"`, i)
+				return nil, Diagnostics{}, fmt.Errorf(`part %d: missing required member "features"`, i)
 			}
 
+			matched := page.NumberMatched
+			if matched == 0 {
+				matched = UpstreamMatched(root.NumberMatched, root.TotalFeatures)
+			}
 			req.Shards = append(req.Shards, geojsonagg.ShardPage{
-				Meta:     geojsonagg.ShardMeta{FromCache: fromCache, ID: fmt.Sprintf("part-%d", i)},
-				Features: root.Features,
+				Meta:          geojsonagg.ShardMeta{FromCache: fromCache, ID: fmt.Sprintf("part-%d", i)},
+				Features:      root.Features,
+				NumberMatched: matched,
 			})
 
 		default:
@@ -73,14 +96,32 @@ func (a *GeoJSONV2Adapter) MergeWithQuery(
 		}
 	}
 
-	out, _, err := a.Agg.MergeRequest(req)
+	out, d, err := a.Agg.MergeRequest(req)
 	if err != nil {
-		return nil, fmt.Errorf("geojsonagg merge: %w", err)
+		return nil, Diagnostics{}, fmt.Errorf("geojsonagg merge: %w", err)
 	}
-	return out, nil
+	return out, Diagnostics{
+		FeaturesIn:      d.TotalIn,
+		FeaturesOut:     d.TotalOut,
+		DedupByID:       d.DedupByID,
+		DedupByGeom:     d.DedupByGH,
+		FeaturesMatched: d.Matched,
+	}, nil
 }
 
-func convertSortKeys(in []SortKey) []geojsonagg.SortKey {
+// UpstreamMatched reads a WFS numberMatched, falling back to GeoServer's
+// totalFeatures; both may be "unknown" or absent, which yields 0
+func UpstreamMatched(numberMatched, totalFeatures json.RawMessage) int {
+	for _, raw := range []json.RawMessage{numberMatched, totalFeatures} {
+		var n int
+		if err := json.Unmarshal(raw, &n); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 0
+}
+
+func convertSortKeys(in []SortKey, types map[string]string) []geojsonagg.SortKey {
 	if len(in) == 0 {
 		return nil
 	}
@@ -90,9 +131,19 @@ func convertSortKeys(in []SortKey) []geojsonagg.SortKey {
 		if in[i].Desc {
 			dir = geojsonagg.Desc
 		}
+		nulls := geojsonagg.NullsLast
+		if in[i].NullsFirst {
+			nulls = geojsonagg.NullsFirst
+		}
+		hint := in[i].TypeHint
+		if t, ok := types[in[i].Property]; ok {
+			hint = t
+		}
 		out[i] = geojsonagg.SortKey{
 			Property:  in[i].Property,
 			Direction: dir,
+			Nulls:     nulls,
+			TypeHint:  hint,
 		}
 	}
 	return out
@@ -3,6 +3,8 @@ package composer
 import (
 	"context"
 	"encoding/json"
+	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/aggregate/geojsonagg"
@@ -152,3 +154,136 @@ func Test_GeoJSONV2Adapter_UsesFeaturesSlice(t *testing.T) {
 		t.Fatalf("scores in output = %#v, want {1,2}", scores)
 	}
 }
+
+func Test_GeoJSONV2Adapter_NullsPlacement(t *testing.T) {
+	shard := []byte(`{"type":"FeatureCollection","features":[
+	 {"type":"Feature","geometry":{"type":"Point","coordinates":[0,0]},"properties":{"name":"b","ts":"2020-01-02T00:00:00Z"}},
+	 {"type":"Feature","geometry":{"type":"Point","coordinates":[0,1]},"properties":{"name":"none"}},
+	 {"type":"Feature","geometry":{"type":"Point","coordinates":[0,2]},"properties":{"name":"a","ts":"2020-01-01T00:00:00Z"}}
+	]}`)
+
+	names := func(nullsFirst bool) []string {
+		t.Helper()
+		a := NewGeoJSONV2Adapter(geojsonagg.NewAdvanced())
+		q := QueryParams{Sort: []SortKey{{Property: "ts", TypeHint: "time", NullsFirst: nullsFirst}}}
+		out, err := a.MergeWithQuery(context.Background(), q, []ShardPage{{Body: shard}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fc struct {
+			Features []struct {
+				Properties map[string]any `json:"properties"`
+			} `json:"features"`
+		}
+		if err := json.Unmarshal(out, &fc); err != nil {
+			t.Fatalf("parse output: %v", err)
+		}
+		got := make([]string, 0, len(fc.Features))
+		for _, f := range fc.Features {
+			got = append(got, f.Properties["name"].(string))
+		}
+		return got
+	}
+
+	if got := names(false); strings.Join(got, ",") != "a,b,none" {
+		t.Fatalf("nulls last order=%v", got)
+	}
+	if got := names(true); strings.Join(got, ",") != "none,a,b" {
+		t.Fatalf("nulls first order=%v", got)
+	}
+}
+
+func Test_Compose_DiagnosticHeaders_MultiShardDedup(t *testing.T) {
+	eng := Engine{V2: NewGeoJSONV2Adapter(geojsonagg.NewAdvanced())}
+
+	shard1 := []byte(`{"type":"FeatureCollection","features":[
+	 {"type":"Feature","id":"a","geometry":{"type":"Point","coordinates":[0,0]},"properties":{}},
+	 {"type":"Feature","geometry":{"type":"Point","coordinates":[5,5]},"properties":{}}
+	]}`)
+	shard2 := []byte(`{"type":"FeatureCollection","features":[
+	 {"type":"Feature","id":"a","geometry":{"type":"Point","coordinates":[0,0]},"properties":{}},
+	 {"type":"Feature","geometry":{"type":"Point","coordinates":[5,5]},"properties":{}},
+	 {"type":"Feature","id":"c","geometry":{"type":"Point","coordinates":[9,9]},"properties":{}}
+	]}`)
+
+	res, err := Compose(context.Background(), eng, Request{
+		Pages: []ShardPage{
+			{Body: shard1, CacheStatus: CacheHit},
+			{Body: shard2, CacheStatus: CacheMiss},
+		},
+		AcceptHeader: "application/geo+json",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Diagnostics == nil {
+		t.Fatalf("expected diagnostics from the v2 adapter")
+	}
+
+	h := http.Header{}
+	SetDiagnosticHeaders(h, res.Diagnostics)
+	want := map[string]string{
+		HeaderFeaturesIn:  "5",
+		HeaderFeaturesOut: "3",
+		HeaderDedupID:     "1",
+		HeaderDedupGeom:   "1",
+	}
+	for k, v := range want {
+		if got := h.Get(k); got != v {
+			t.Fatalf("%s=%q want %q", k, got, v)
+		}
+	}
+
+	h = http.Header{}
+	SetDiagnosticHeaders(h, nil)
+	if len(h) != 0 {
+		t.Fatalf("nil diagnostics should set no headers, got %v", h)
+	}
+}
+
+func Test_GeoJSONV2Adapter_PropertyTypesOverrideSortHint(t *testing.T) {
+	// mixed timestamp encodings: offsets, Z and epoch seconds
+	shard := []byte(`{"type":"FeatureCollection","features":[
+	 {"type":"Feature","id":"a","geometry":{"type":"Point","coordinates":[0,0]},"properties":{"updated":"2024-03-01T00:00:00Z"}},
+	 {"type":"Feature","id":"b","geometry":{"type":"Point","coordinates":[1,0]},"properties":{"updated":1717200000}},
+	 {"type":"Feature","id":"c","geometry":{"type":"Point","coordinates":[2,0]},"properties":{"updated":"2024-02-01T00:00:00Z"}},
+	 {"type":"Feature","id":"d","geometry":{"type":"Point","coordinates":[3,0]},"properties":{"updated":"2024-01-15T00:00:00Z"}},
+	 {"type":"Feature","id":"e","geometry":{"type":"Point","coordinates":[4,0]},"properties":{"updated":"2024-03-01T01:00:00+02:00"}}
+	]}`)
+	eng := Engine{V2: NewGeoJSONV2Adapter(geojsonagg.NewAdvanced())}
+
+	ids := func(types map[string]string) string {
+		t.Helper()
+		res, err := Compose(context.Background(), eng, Request{
+			Query: QueryParams{
+				Sort:          []SortKey{{Property: "updated", TypeHint: "string"}},
+				PropertyTypes: types,
+			},
+			Pages: []ShardPage{{Body: shard, CacheStatus: CacheMiss}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out struct {
+			Features []struct {
+				ID string `json:"id"`
+			} `json:"features"`
+		}
+		if err := json.Unmarshal(res.Body, &out); err != nil {
+			t.Fatalf("parse output: %v", err)
+		}
+		got := make([]string, 0, len(out.Features))
+		for _, f := range out.Features {
+			got = append(got, f.ID)
+		}
+		return strings.Join(got, ",")
+	}
+
+	if got := ids(map[string]string{"updated": "time"}); got != "d,c,e,a,b" {
+		t.Fatalf("declared time order=%s want d,c,e,a,b", got)
+	}
+	// the request's string hint alone sorts lexically
+	if got := ids(nil); got != "b,d,c,a,e" {
+		t.Fatalf("string hint order=%s want b,d,c,a,e", got)
+	}
+}
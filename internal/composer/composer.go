@@ -11,19 +11,49 @@ import (
 	"time"
 
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/aggregate"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
 )
 
 type SortKey struct {
-	Property string
-	Desc     bool
+	Property   string
+	Desc       bool
+	TypeHint   string
+	NullsFirst bool
+}
+
+// SortKeysFromModel converts parsed sortby keys into composer sort keys
+func SortKeysFromModel(in []model.SortKey) []SortKey {
+	if len(in) == 0 {
+		return nil
+	}
+	out := make([]SortKey, len(in))
+	for i, k := range in {
+		out[i] = SortKey{Property: k.Property, Desc: k.Desc, TypeHint: k.TypeHint, NullsFirst: k.NullsFirst}
+	}
+	return out
 }
 
 type QueryParams struct {
-	FiltersRaw []byte
-	Sort       []SortKey
-	Limit      int
-	Offset     int
+	FiltersRaw    []byte
+	Sort          []SortKey
+	Limit         int
+	Offset        int
+	GeomPrecision int
+	IDProperty    string
+	// TimeProperty is matched against CreatedAfter/CreatedBefore after dedup;
+	// zero bounds are open
+	TimeProperty  string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// PropertyTypes are the layer's declared property types; a sort key on a
+	// declared property uses its type instead of the request's hint
+	PropertyTypes map[string]string
+	// StripProperties are removed from each merged feature's properties
+	StripProperties []string
+	// Provenance adds a top-level "provenance" member mapping feature ids to
+	// the cells they were served from
+	Provenance bool
 }
 
 type CacheStatus int
@@ -38,6 +68,12 @@ type ShardPage struct {
 	CacheStatus CacheStatus
 	Features    []json.RawMessage
 	GeomHashes  []string
+	// NumberMatched is the upstream's match count for this page; zero means
+	// unknown. Body pages fall back to its numberMatched/totalFeatures members
+	NumberMatched int
+	// Cell is the H3 cell the page was read or fetched for; empty when the
+	// page doesn't belong to a single cell
+	Cell string
 }
 
 type HitClass string
@@ -48,6 +84,30 @@ const (
 	HitClassMiss    HitClass = "miss"
 )
 
+// HeaderXCache reports to clients how a response was served
+const HeaderXCache = "X-Cache"
+
+// XCacheBypass marks responses that never consulted the cache
+const XCacheBypass = "BYPASS"
+
+// XCacheBypassTiny marks footprints too small to cover any cell, fetched directly
+const XCacheBypassTiny = "BYPASS-TINY"
+
+// XCacheMissReadOnly marks misses served upstream without filling the cache
+const XCacheMissReadOnly = "MISS-READONLY"
+
+// XCacheValue maps a hit class onto its X-Cache header value
+func XCacheValue(hc HitClass) string {
+	switch hc {
+	case HitClassFull:
+		return "HIT"
+	case HitClassPartial:
+		return "PARTIAL"
+	default:
+		return "MISS"
+	}
+}
+
 func classifyHit(pages []ShardPage) HitClass {
 	if len(pages) == 0 {
 		return HitClassMiss
@@ -89,6 +149,18 @@ type Negotiation struct {
 	ContentType string
 }
 
+// NativeOutputFormat reports whether an outputFormat value is one the composer
+// can produce itself (GeoJSON or GML); empty means "negotiate from Accept"
+func NativeOutputFormat(outputFormat string) bool {
+	of := strings.ToLower(strings.TrimSpace(outputFormat))
+	return of == "" ||
+		strings.HasPrefix(of, "application/geo+json") ||
+		of == "geojson" ||
+		of == "json" ||
+		strings.HasPrefix(of, "application/json") ||
+		strings.Contains(of, "gml")
+}
+
 // NegotiateFormat determines the output format and content type
 func NegotiateFormat(in NegotiationInput) Negotiation {
 	of := strings.ToLower(strings.TrimSpace(in.OutputFormat))
@@ -164,19 +236,61 @@ type AggregatorV2 interface {
 
 type AggregatorV1 = aggregate.Interface
 
+// Diagnostics summarizes how a merge deduplicated its input
+type Diagnostics struct {
+	FeaturesIn  int
+	FeaturesOut int
+	DedupByID   int
+	DedupByGeom int
+	// FeaturesMatched is the total before offset/limit, see geojsonagg.Diagnostics.Matched
+	FeaturesMatched int
+}
+
+// DiagnosticsMerger is implemented by V2 aggregators that report merge diagnostics
+type DiagnosticsMerger interface {
+	MergeWithDiagnostics(ctx context.Context, q QueryParams, pages []ShardPage) ([]byte, Diagnostics, error)
+}
+
+// Debug headers carrying merge diagnostics
+const (
+	HeaderFeaturesIn  = "X-Features-In"
+	HeaderFeaturesOut = "X-Features-Out"
+	HeaderDedupID     = "X-Dedup-ID"
+	HeaderDedupGeom   = "X-Dedup-Geom"
+)
+
+// SetDiagnosticHeaders writes d as debug headers; nil d is a no-op
+func SetDiagnosticHeaders(h http.Header, d *Diagnostics) {
+	if d == nil {
+		return
+	}
+	h.Set(HeaderFeaturesIn, strconv.Itoa(d.FeaturesIn))
+	h.Set(HeaderFeaturesOut, strconv.Itoa(d.FeaturesOut))
+	h.Set(HeaderDedupID, strconv.Itoa(d.DedupByID))
+	h.Set(HeaderDedupGeom, strconv.Itoa(d.DedupByGeom))
+}
+
 type Engine struct {
 	V2 AggregatorV2
 	V1 AggregatorV1
 }
 
-// merges the given parts using the configured aggregator
-func (e Engine) merge(ctx context.Context, q QueryParams, pages []ShardPage) ([]byte, error) {
+// merges the given parts using the configured aggregator; diagnostics are nil
+// when the aggregator doesn't report them
+func (e Engine) merge(ctx context.Context, q QueryParams, pages []ShardPage) ([]byte, *Diagnostics, error) {
+	if dm, ok := e.V2.(DiagnosticsMerger); ok {
+		b, d, err := dm.MergeWithDiagnostics(ctx, q, pages)
+		if err != nil {
+			return nil, nil, fmt.Errorf("aggregator v2 merge: %w", err)
+		}
+		return b, &d, nil
+	}
 	if e.V2 != nil {
 		b, err := e.V2.MergeWithQuery(ctx, q, pages)
 		if err != nil {
-			return nil, fmt.Errorf("aggregator v2 merge: %w", err)
+			return nil, nil, fmt.Errorf("aggregator v2 merge: %w", err)
 		}
-		return b, nil
+		return b, nil, nil
 	}
 	if e.V1 != nil {
 		parts := make([][]byte, 0, len(pages))
@@ -185,11 +299,11 @@ func (e Engine) merge(ctx context.Context, q QueryParams, pages []ShardPage) ([]
 		}
 		b, err := e.V1.Merge(parts)
 		if err != nil {
-			return nil, fmt.Errorf("aggregator v1 merge: %w", err)
+			return nil, nil, fmt.Errorf("aggregator v1 merge: %w", err)
 		}
-		return b, nil
+		return b, nil, nil
 	}
-	return nil, errors.New("no aggregator provided")
+	return nil, nil, errors.New("no aggregator provided")
 }
 
 type Request struct {
@@ -204,6 +318,8 @@ type Result struct {
 	Body        []byte
 	ContentType string
 	HitClass    HitClass
+	// Diagnostics is set when the aggregator reports merge diagnostics
+	Diagnostics *Diagnostics
 }
 
 // Compose merges the given shard pages into a single response
@@ -216,7 +332,7 @@ func Compose(ctx context.Context, eng Engine, req Request) (Result, error) {
 			DefaultFormat: FormatGeoJSON,
 		})
 		empty := []byte(`{"type":"FeatureCollection","features":[]}`)
-		observability.ObserveSpatialResponse(string(HitClassMiss), formatString(neg.Format), time.Since(t0).Seconds())
+		observeResponse(ctx, HitClassMiss, neg.Format, t0)
 		return Result{StatusCode: http.StatusOK, Body: empty, ContentType: neg.ContentType, HitClass: HitClassMiss}, nil
 	}
 
@@ -226,20 +342,33 @@ func Compose(ctx context.Context, eng Engine, req Request) (Result, error) {
 		DefaultFormat: FormatGeoJSON,
 	})
 
-	merged, err := eng.merge(ctx, req.Query, req.Pages)
+	merged, diag, err := eng.merge(ctx, req.Query, req.Pages)
 	if err != nil {
 		return Result{}, fmt.Errorf("aggregate merge: %w", err)
 	}
 
 	switch neg.Format {
 	case FormatGeoJSON:
+		if req.Query.Provenance {
+			merged, err = withProvenance(merged, req.Query.IDProperty, req.Pages)
+			if err != nil {
+				return Result{}, fmt.Errorf("provenance: %w", err)
+			}
+		}
+		if len(req.Query.StripProperties) > 0 {
+			merged, err = stripProperties(merged, req.Query.StripProperties)
+			if err != nil {
+				return Result{}, fmt.Errorf("strip properties: %w", err)
+			}
+		}
 		res := Result{
 			StatusCode:  http.StatusOK,
 			Body:        merged,
 			ContentType: neg.ContentType,
 			HitClass:    classifyHit(req.Pages),
+			Diagnostics: diag,
 		}
-		observability.ObserveSpatialResponse(string(res.HitClass), formatString(neg.Format), time.Since(t0).Seconds())
+		observeResponse(ctx, res.HitClass, neg.Format, t0)
 		return res, nil
 
 	case FormatGML32:
@@ -249,6 +378,13 @@ func Compose(ctx context.Context, eng Engine, req Request) (Result, error) {
 	}
 }
 
+// shadow replays are recorded by the shadow runner instead
+func observeResponse(ctx context.Context, hc HitClass, f Format, t0 time.Time) {
+	if !observability.IsShadow(ctx) {
+		observability.ObserveSpatialResponse(ctx, string(hc), formatString(f), time.Since(t0).Seconds())
+	}
+}
+
 func BuildFeatureCollectionShard(features [][]byte) ([]byte, error) {
 	type fc struct {
 		Type     string            `json:"type"`
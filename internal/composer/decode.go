@@ -0,0 +1,102 @@
+package composer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// DecodeFeatures reads a GeoJSON FeatureCollection from r one feature at a
+// time, without first buffering the whole document
+func DecodeFeatures(r io.Reader) ([]json.RawMessage, error) {
+	feats := make([]json.RawMessage, 0, 256)
+	_, err := DecodeFeatureStream(r, func(f json.RawMessage) error {
+		feats = append(feats, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return feats, nil
+}
+
+// DecodeFeatureStream is DecodeFeatures handing each feature to fn as soon as
+// it is read; it also returns the collection's match count (see UpstreamMatched)
+func DecodeFeatureStream(r io.Reader, fn func(json.RawMessage) error) (int, error) {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return 0, err
+	}
+
+	var numberMatched, totalFeatures json.RawMessage
+	found := false
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return 0, fmt.Errorf("read member name: %w", err)
+		}
+		name, _ := tok.(string)
+		if name != "features" {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return 0, fmt.Errorf("skip %q: %w", name, err)
+			}
+			switch name {
+			case "numberMatched":
+				numberMatched = raw
+			case "totalFeatures":
+				totalFeatures = raw
+			}
+			continue
+		}
+
+		found = true
+		if err := expectDelim(dec, '['); err != nil {
+			return 0, fmt.Errorf(`"features": %w`, err)
+		}
+		for i := 0; dec.More(); i++ {
+			var f json.RawMessage
+			if err := dec.Decode(&f); err != nil {
+				return 0, fmt.Errorf("feature %d: %w", i, err)
+			}
+			if err := fn(f); err != nil {
+				return 0, err
+			}
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return 0, fmt.Errorf(`"features": %w`, err)
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, errors.New(`missing required member "features"`)
+	}
+	return UpstreamMatched(numberMatched, totalFeatures), nil
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("read token: %w", err)
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return fmt.Errorf("expected %q, got %v", want, tok)
+	}
+	return nil
+}
+
+// SanitizeUTF8 replaces invalid UTF-8 in a decoded feature with U+FFFD and
+// reports whether it had to. The JSON scanner only lets such bytes through
+// inside strings, so the result is still valid JSON, and one bad property
+// from upstream can't fail composition after headers are written
+func SanitizeUTF8(f json.RawMessage) (json.RawMessage, bool) {
+	if utf8.Valid(f) {
+		return f, false
+	}
+	return bytes.ToValidUTF8(f, []byte("\uFFFD")), true
+}
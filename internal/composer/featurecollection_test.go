@@ -2,6 +2,7 @@ package composer
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/aggregate/geojsonagg"
@@ -108,3 +109,20 @@ func TestBuildFeatureCollectionShard_RoundTripViaGeoJSONAgg(t *testing.T) {
 		t.Fatalf("merged features len=%d want 2", got)
 	}
 }
+
+func TestDecodeFeatures_SkipsOtherMembers(t *testing.T) {
+	in := `{"type":"FeatureCollection","crs":{"type":"name","properties":{"name":"EPSG:4326"}},` +
+		`"features":[{"type":"Feature","geometry":null,"properties":{"name":"a"}},{"type":"Feature","geometry":null,"properties":{}}],` +
+		`"numberMatched":2}`
+	feats, err := DecodeFeatures(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(feats) != 2 {
+		t.Fatalf("features=%d want 2", len(feats))
+	}
+
+	if _, err := DecodeFeatures(strings.NewReader(`{"type":"FeatureCollection"}`)); err == nil {
+		t.Fatalf("expected error for missing features")
+	}
+}
@@ -0,0 +1,99 @@
+package composer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Fixture is one served query as ?capture=true records it: what was asked,
+// the cells it mapped to, how the cache decided, and the exact composer input
+// and output, so a production anomaly can become a golden test
+type Fixture struct {
+	Captured time.Time `json:"captured"`
+	// Params are the request's raw query parameters
+	Params     url.Values      `json:"params"`
+	Layer      string          `json:"layer"`
+	Resolution int             `json:"resolution"`
+	Cells      []string        `json:"cells"`
+	Decision   FixtureDecision `json:"decision"`
+	// Request is the composer input; Replay runs it again
+	Request  Request         `json:"request"`
+	Response FixtureResponse `json:"response"`
+}
+
+// FixtureDecision is the cache's decision for the captured query
+type FixtureDecision struct {
+	HitClass HitClass `json:"hit_class"`
+	// Adaptive is the decider's choice, "" when adaptivity was off; Applied
+	// is false for dry runs
+	Adaptive   string `json:"adaptive,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	Resolution int    `json:"resolution,omitempty"`
+	TTL        string `json:"ttl,omitempty"`
+	Applied    bool   `json:"applied"`
+	// MissingCells were fetched from the upstream for this response
+	MissingCells []string `json:"missing_cells,omitempty"`
+}
+
+// FixtureResponse is the composed response as it was written
+type FixtureResponse struct {
+	StatusCode  int             `json:"status"`
+	ContentType string          `json:"content_type"`
+	Body        json.RawMessage `json:"body"`
+}
+
+// NewFixtureResponse records res, keeping its body verbatim
+func NewFixtureResponse(res Result) FixtureResponse {
+	return FixtureResponse{StatusCode: res.StatusCode, ContentType: res.ContentType, Body: json.RawMessage(res.Body)}
+}
+
+// WriteFixture writes f as JSON to a new file in dir and returns its path.
+// The encoding stays compact and unescaped so the recorded body is
+// byte-for-byte the one served
+func WriteFixture(dir string, f Fixture) (string, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(f); err != nil {
+		return "", fmt.Errorf("marshal fixture: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", fmt.Errorf("fixture dir: %w", err)
+	}
+	out, err := os.CreateTemp(dir, "query-"+f.Captured.UTC().Format("20060102T150405")+"-*.json")
+	if err != nil {
+		return "", fmt.Errorf("create fixture: %w", err)
+	}
+	if _, err := out.Write(b.Bytes()); err != nil {
+		_ = out.Close()
+		return "", fmt.Errorf("write fixture: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return "", fmt.Errorf("close fixture: %w", err)
+	}
+	return filepath.Clean(out.Name()), nil
+}
+
+// ReadFixture loads a fixture written by WriteFixture
+func ReadFixture(path string) (Fixture, error) {
+	b, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return Fixture{}, fmt.Errorf("read fixture: %w", err)
+	}
+	var f Fixture
+	if err := json.Unmarshal(b, &f); err != nil {
+		return Fixture{}, fmt.Errorf("decode fixture %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// Replay composes the captured request again with eng
+func (f Fixture) Replay(ctx context.Context, eng Engine) (Result, error) {
+	return Compose(ctx, eng, f.Request)
+}
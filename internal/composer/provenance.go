@@ -0,0 +1,97 @@
+package composer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/aggregate/geojsonagg"
+)
+
+// ProvenanceEntry is one cell a feature was served from; Cache is "hit" or
+// "miss". Cell is empty for features fetched for the whole query (bypass,
+// read-only and tiny-footprint responses)
+type ProvenanceEntry struct {
+	Cell  string `json:"cell,omitempty"`
+	Cache string `json:"cache"`
+}
+
+// withProvenance appends a "provenance" member to the merged collection,
+// keyed by the id of each returned feature. A feature seen in several cells
+// lists all of them in page order; one that came only from a page without a
+// cell gets a single cell-less entry. Features without an id are left out
+func withProvenance(merged []byte, idProp string, pages []ShardPage) ([]byte, error) {
+	byID := make(map[string][]ProvenanceEntry)
+	var uncelled *ProvenanceEntry
+	for _, p := range pages {
+		status := "miss"
+		if p.CacheStatus == CacheHit {
+			status = "hit"
+		}
+		if p.Cell == "" {
+			uncelled = &ProvenanceEntry{Cache: status}
+			continue
+		}
+		for _, f := range p.Features {
+			id, ok := provenanceID(f, idProp)
+			if !ok {
+				continue
+			}
+			byID[id] = append(byID[id], ProvenanceEntry{Cell: p.Cell, Cache: status})
+		}
+	}
+
+	var root struct {
+		Features []json.RawMessage `json:"features"`
+	}
+	if err := json.Unmarshal(merged, &root); err != nil {
+		return nil, fmt.Errorf("parse merged collection: %w", err)
+	}
+	out := make(map[string][]ProvenanceEntry, len(root.Features))
+	for _, f := range root.Features {
+		if id, ok := provenanceID(f, idProp); ok {
+			if entries, ok := byID[id]; ok {
+				out[id] = entries
+			} else if uncelled != nil {
+				out[id] = []ProvenanceEntry{*uncelled}
+			}
+		}
+	}
+	prov, err := json.Marshal(out)
+	if err != nil {
+		return nil, fmt.Errorf("marshal provenance: %w", err)
+	}
+
+	// splice the member in before the closing brace so the collection keeps
+	// its member order
+	body := bytes.TrimRight(merged, " \t\r\n")
+	if len(body) == 0 || body[len(body)-1] != '}' {
+		return nil, fmt.Errorf("merged collection is not a JSON object")
+	}
+	buf := make([]byte, 0, len(body)+len(prov)+16)
+	buf = append(buf, body[:len(body)-1]...)
+	buf = append(buf, `,"provenance":`...)
+	buf = append(buf, prov...)
+	return append(buf, '}'), nil
+}
+
+// provenanceID returns the feature's id as clients see it: strings verbatim,
+// numbers in their JSON form
+func provenanceID(f json.RawMessage, idProp string) (string, bool) {
+	var obj struct {
+		ID         json.RawMessage `json:"id"`
+		Properties json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(f, &obj); err != nil {
+		return "", false
+	}
+	raw := obj.ID
+	if len(raw) == 0 {
+		raw = geojsonagg.PropertyID(obj.Properties, idProp)
+	}
+	key, err := geojsonagg.CanonicalIDKey(raw)
+	if err != nil || len(key) < 2 {
+		return "", false
+	}
+	return key[2:], true
+}
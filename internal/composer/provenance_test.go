@@ -0,0 +1,82 @@
+package composer
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/aggregate/geojsonagg"
+)
+
+func TestCompose_ProvenanceMapsFeaturesToCells(t *testing.T) {
+	eng := Engine{V2: NewGeoJSONV2Adapter(geojsonagg.NewAdvanced())}
+	feat := func(s string) json.RawMessage { return json.RawMessage(s) }
+
+	// "b" straddles the boundary of both cells and is deduped in the output
+	pages := []ShardPage{
+		{CacheStatus: CacheHit, Cell: "891f1d48177ffff", Features: []json.RawMessage{
+			feat(`{"type":"Feature","id":"a","geometry":{"type":"Point","coordinates":[0,0]},"properties":{}}`),
+			feat(`{"type":"Feature","id":"b","geometry":{"type":"Point","coordinates":[1,1]},"properties":{}}`),
+		}},
+		{CacheStatus: CacheMiss, Cell: "891f1d4817bffff", Features: []json.RawMessage{
+			feat(`{"type":"Feature","id":"b","geometry":{"type":"Point","coordinates":[1,1]},"properties":{}}`),
+			feat(`{"type":"Feature","geometry":{"type":"Point","coordinates":[2,2]},"properties":{"fid":7}}`),
+			feat(`{"type":"Feature","geometry":{"type":"Point","coordinates":[3,3]},"properties":{}}`),
+		}},
+	}
+	req := Request{Query: QueryParams{IDProperty: "fid", Provenance: true}, Pages: pages}
+
+	res, err := Compose(context.Background(), eng, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(res.Body), `{"type":"FeatureCollection"`) {
+		t.Fatalf("member order changed: %.40s", res.Body)
+	}
+	var fc struct {
+		Features   []json.RawMessage            `json:"features"`
+		Provenance map[string][]ProvenanceEntry `json:"provenance"`
+	}
+	if err := json.Unmarshal(res.Body, &fc); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(fc.Features) != 4 {
+		t.Fatalf("features=%d want 4", len(fc.Features))
+	}
+	want := map[string][]ProvenanceEntry{
+		"a": {{Cell: "891f1d48177ffff", Cache: "hit"}},
+		"b": {{Cell: "891f1d48177ffff", Cache: "hit"}, {Cell: "891f1d4817bffff", Cache: "miss"}},
+		"7": {{Cell: "891f1d4817bffff", Cache: "miss"}},
+	}
+	if !reflect.DeepEqual(fc.Provenance, want) {
+		t.Fatalf("provenance=%v want %v", fc.Provenance, want)
+	}
+
+	// a page fetched for the whole query has no cell to report
+	whole := Request{Query: QueryParams{Provenance: true}, Pages: []ShardPage{{CacheStatus: CacheMiss, Body: []byte(
+		`{"type":"FeatureCollection","features":[{"type":"Feature","id":"c","geometry":{"type":"Point","coordinates":[0,0]},"properties":{}}]}`,
+	)}}}
+	res, err = Compose(context.Background(), eng, whole)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc.Provenance = nil
+	if err := json.Unmarshal(res.Body, &fc); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if want := map[string][]ProvenanceEntry{"c": {{Cache: "miss"}}}; !reflect.DeepEqual(fc.Provenance, want) {
+		t.Fatalf("whole-query provenance=%v want %v", fc.Provenance, want)
+	}
+
+	// off by default
+	req.Query.Provenance = false
+	res, err = Compose(context.Background(), eng, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(res.Body), `"provenance"`) {
+		t.Fatalf("provenance present without the flag: %s", res.Body)
+	}
+}
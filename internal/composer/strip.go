@@ -0,0 +1,95 @@
+package composer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// stripProperties removes the denied keys from each feature's properties in
+// the merged collection. Other members keep their order and features without
+// a denied key are left byte-for-byte as merged
+func stripProperties(merged []byte, deny []string) ([]byte, error) {
+	start, end, ok := memberSpan(merged, "features")
+	if !ok {
+		return merged, nil
+	}
+	var features []json.RawMessage
+	if err := json.Unmarshal(merged[start:end], &features); err != nil {
+		return nil, fmt.Errorf("parse features: %w", err)
+	}
+	changed := false
+	for i, f := range features {
+		out, err := stripFeature(f, deny)
+		if err != nil {
+			return nil, fmt.Errorf("feature %d: %w", i, err)
+		}
+		if out != nil {
+			features[i] = out
+			changed = true
+		}
+	}
+	if !changed {
+		return merged, nil
+	}
+	arr, err := json.Marshal(features)
+	if err != nil {
+		return nil, fmt.Errorf("marshal features: %w", err)
+	}
+	buf := make([]byte, 0, len(merged)-(end-start)+len(arr))
+	buf = append(buf, merged[:start]...)
+	buf = append(buf, arr...)
+	return append(buf, merged[end:]...), nil
+}
+
+// stripFeature returns f with the denied properties removed, or nil when it
+// has none of them
+func stripFeature(f json.RawMessage, deny []string) (json.RawMessage, error) {
+	start, end, ok := memberSpan(f, "properties")
+	if !ok {
+		return nil, nil
+	}
+	// null or non-object properties have nothing to strip
+	var props map[string]json.RawMessage
+	if json.Unmarshal(f[start:end], &props) != nil || props == nil {
+		return nil, nil
+	}
+	n := len(props)
+	for _, k := range deny {
+		delete(props, k)
+	}
+	if len(props) == n {
+		return nil, nil
+	}
+	b, err := json.Marshal(props)
+	if err != nil {
+		return nil, fmt.Errorf("marshal properties: %w", err)
+	}
+	out := make([]byte, 0, len(f)-(end-start)+len(b))
+	out = append(out, f[:start]...)
+	out = append(out, b...)
+	return append(out, f[end:]...), nil
+}
+
+// memberSpan locates the value of the top-level member name in a JSON object
+func memberSpan(obj []byte, name string) (start, end int, ok bool) {
+	dec := json.NewDecoder(bytes.NewReader(obj))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return 0, 0, false
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return 0, 0, false
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return 0, 0, false
+		}
+		if key, _ := tok.(string); key == name {
+			end := int(dec.InputOffset())
+			return end - len(raw), end, true
+		}
+	}
+	return 0, 0, false
+}
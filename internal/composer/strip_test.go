@@ -0,0 +1,50 @@
+package composer
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/aggregate/geojsonagg"
+)
+
+func TestCompose_StripPropertiesRemovesDeniedKeys(t *testing.T) {
+	eng := Engine{V2: NewGeoJSONV2Adapter(geojsonagg.NewAdvanced())}
+	pages := []ShardPage{{CacheStatus: CacheHit, Features: []json.RawMessage{
+		json.RawMessage(`{"type":"Feature","id":"a","geometry":{"type":"Point","coordinates":[0,0]},"properties":{"name":"x","@id":"upstream/1","_etag":"v3"}}`),
+		json.RawMessage(`{"type":"Feature","id":"b","geometry":{"type":"Point","coordinates":[1,1]},"properties":{"name":"y"}}`),
+	}}}
+	req := Request{Query: QueryParams{StripProperties: []string{"@id", "_etag"}}, Pages: pages}
+
+	res, err := Compose(context.Background(), eng, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(res.Body), `{"type":"FeatureCollection"`) {
+		t.Fatalf("member order changed: %.40s", res.Body)
+	}
+	var fc struct {
+		Features []struct {
+			ID         string         `json:"id"`
+			Properties map[string]any `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(res.Body, &fc); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(fc.Features) != 2 {
+		t.Fatalf("features=%d want 2", len(fc.Features))
+	}
+	for _, f := range fc.Features {
+		if _, ok := f.Properties["@id"]; ok {
+			t.Fatalf("feature %s still has @id: %v", f.ID, f.Properties)
+		}
+		if _, ok := f.Properties["_etag"]; ok {
+			t.Fatalf("feature %s still has _etag: %v", f.ID, f.Properties)
+		}
+		if f.Properties["name"] == nil {
+			t.Fatalf("feature %s lost an allowed property: %v", f.ID, f.Properties)
+		}
+	}
+}
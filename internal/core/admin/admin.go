@@ -0,0 +1,177 @@
+// Package admin exposes operational endpoints used between experiment phases.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/hotness"
+)
+
+// HotnessProvider is implemented by scenarios that track cell hotness
+type HotnessProvider interface {
+	Hotness() interface{ Reset(...string) }
+}
+
+type hotnessResetRequest struct {
+	Cells []string `json:"cells"`
+}
+
+type hotnessResetResponse struct {
+	Reset int `json:"reset"`
+}
+
+// HotnessReset resets the given cells, or every tracked cell when the body
+// is empty or lists none
+func HotnessReset(p HotnessProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hot := p.Hotness()
+		if hot == nil {
+			http.Error(w, "hotness tracking not enabled", http.StatusNotFound)
+			return
+		}
+
+		var in hotnessResetRequest
+		if r.Body != nil {
+			if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&in); err != nil && !errors.Is(err, io.EOF) {
+				http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		cells := make([]string, 0, len(in.Cells))
+		seen := make(map[string]struct{}, len(in.Cells))
+		for _, c := range in.Cells {
+			c = strings.TrimSpace(c)
+			if c == "" {
+				continue
+			}
+			if _, ok := seen[c]; ok {
+				continue
+			}
+			seen[c] = struct{}{}
+			cells = append(cells, c)
+		}
+
+		var n int
+		if len(cells) == 0 {
+			c, ok := hot.(hotness.Clearer)
+			if !ok {
+				http.Error(w, "hotness tracker cannot reset all cells", http.StatusNotImplemented)
+				return
+			}
+			n = c.ResetAll()
+		} else {
+			hot.Reset(cells...)
+			n = len(cells)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(hotnessResetResponse{Reset: n})
+	}
+}
+
+type halfLifeRequest struct {
+	HalfLife string `json:"half_life"`
+}
+
+type halfLifeResponse struct {
+	HalfLife string `json:"half_life"`
+}
+
+// HotnessHalfLife changes the hotness decay half-life without a restart
+func HotnessHalfLife(p HotnessProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hot := p.Hotness()
+		if hot == nil {
+			http.Error(w, "hotness tracking not enabled", http.StatusNotFound)
+			return
+		}
+		s, ok := hot.(hotness.HalfLifeSetter)
+		if !ok {
+			http.Error(w, "hotness tracker has no adjustable half-life", http.StatusNotImplemented)
+			return
+		}
+
+		var in halfLifeRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&in); err != nil {
+			http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(in.HalfLife))
+		if err != nil || d <= 0 {
+			http.Error(w, "half_life must be a positive duration", http.StatusBadRequest)
+			return
+		}
+		s.SetHalfLife(d)
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(halfLifeResponse{HalfLife: d.String()})
+	}
+}
+
+// Stats is the at-a-glance cache view served by GET /admin/stats
+type Stats struct {
+	CellIndexKeys  int64               `json:"cell_index_keys"`
+	FeatureKeys    int64               `json:"feature_keys"`
+	KeysSampled    bool                `json:"keys_sampled"`
+	MemoryBytesEst int64               `json:"memory_bytes_estimate"`
+	Hits           int64               `json:"hits"`
+	Misses         int64               `json:"misses"`
+	HotCells       []hotness.CellScore `json:"hot_cells"`
+	Uptime         string              `json:"uptime"`
+}
+
+// StatsProvider is implemented by scenarios that can summarize their cache
+type StatsProvider interface {
+	AdminStats(ctx context.Context, topN int) (Stats, error)
+}
+
+// hot cells listed when ?top is absent, and the most a caller may ask for
+const (
+	defaultStatsTop = 10
+	maxStatsTop     = 1000
+)
+
+// CacheStats serves key counts, hit/miss counters since start and the hottest
+// cells. The counts are repeated as X-Cache-* headers; HEAD sends only those
+// and skips the hot cells
+func CacheStats(p StatsProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		top := defaultStatsTop
+		if v := strings.TrimSpace(r.URL.Query().Get("top")); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "top must be a non-negative integer", http.StatusBadRequest)
+				return
+			}
+			top = min(n, maxStatsTop)
+		}
+		if r.Method == http.MethodHead {
+			top = 0
+		}
+
+		st, err := p.AdminStats(r.Context(), top)
+		if err != nil {
+			http.Error(w, "stats unavailable: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if st.HotCells == nil {
+			st.HotCells = []hotness.CellScore{}
+		}
+
+		h := w.Header()
+		h.Set("X-Cache-Index-Keys", strconv.FormatInt(st.CellIndexKeys, 10))
+		h.Set("X-Cache-Feature-Keys", strconv.FormatInt(st.FeatureKeys, 10))
+		h.Set("X-Cache-Memory-Bytes", strconv.FormatInt(st.MemoryBytesEst, 10))
+		h.Set("X-Cache-Hits", strconv.FormatInt(st.Hits, 10))
+		h.Set("X-Cache-Misses", strconv.FormatInt(st.Misses, 10))
+		writeJSON(w, r, http.StatusOK, st)
+	}
+}
@@ -0,0 +1,103 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	h3 "github.com/uber/h3-go/v4"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/router"
+)
+
+// headers carrying GET /admin/cell's answer, so HEAD can be used alone
+const (
+	HeaderCacheTTL      = "X-Cache-TTL" // remaining seconds; absent when the entry never expires
+	HeaderCacheFeatures = "X-Cache-Features"
+)
+
+// CellInfo is one cell's cell index entry. TTL is negative when the entry
+// never expires
+type CellInfo struct {
+	Cached   bool
+	Empty    bool // cached as known to hold no features
+	Features int
+	TTL      time.Duration
+}
+
+// CellInspector is implemented by scenarios that can look up a single cached
+// cell without fetching or filling anything
+type CellInspector interface {
+	InspectCell(ctx context.Context, q model.QueryRequest, cell string) (CellInfo, error)
+}
+
+// CellResponse is served by GET /admin/cell
+type CellResponse struct {
+	Layer      string   `json:"layer"`
+	Res        int      `json:"res"`
+	Cell       string   `json:"cell"`
+	Cached     bool     `json:"cached"`
+	Empty      bool     `json:"empty,omitempty"`
+	Features   int      `json:"features"`
+	TTLSeconds *float64 `json:"ttl_seconds,omitempty"`
+}
+
+// CellStatus reports whether ?cell is cached for ?layer (and ?filters):
+// 200 when it is, 404 when not. The feature count and remaining TTL are sent
+// as headers too, so HEAD answers without a body
+func CellStatus(cfg config.Config, p CellInspector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, _, err := router.ParseQueryRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var c h3.Cell
+		raw := strings.TrimSpace(r.URL.Query().Get("cell"))
+		if err := c.UnmarshalText([]byte(raw)); err != nil || !c.IsValid() {
+			http.Error(w, fmt.Sprintf("invalid h3 cell %q", raw), http.StatusBadRequest)
+			return
+		}
+		q.Layer = config.ResolveLayer(cfg.LayerAliases, q.Layer)
+		if !config.LayerAllowed(cfg.LayersAllow, cfg.LayersDeny, q.Layer) {
+			http.Error(w, fmt.Sprintf("layer %q is not allowed", q.Layer), http.StatusForbidden)
+			return
+		}
+		q.H3Res = c.Resolution()
+
+		info, err := p.InspectCell(r.Context(), q, c.String())
+		if err != nil {
+			http.Error(w, "cell lookup failed: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		out := CellResponse{Layer: q.Layer, Res: q.H3Res, Cell: c.String(), Cached: info.Cached, Empty: info.Empty, Features: info.Features}
+		status := http.StatusNotFound
+		if info.Cached {
+			status = http.StatusOK
+			w.Header().Set(HeaderCacheFeatures, strconv.Itoa(info.Features))
+			if info.TTL >= 0 {
+				s := info.TTL.Seconds()
+				out.TTLSeconds = &s
+				w.Header().Set(HeaderCacheTTL, strconv.FormatInt(int64(info.TTL.Round(time.Second)/time.Second), 10))
+			}
+		}
+		writeJSON(w, r, status, out)
+	}
+}
+
+// writeJSON sends v with status; HEAD gets the status and headers only
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,113 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/router"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/mapper"
+)
+
+// Boundarier is implemented by mappers that can outline a cell
+type Boundarier interface {
+	Boundary(cell string) ([][2]float64, error)
+}
+
+// maxListedCells caps the cells (and boundaries) GET /admin/cells lists;
+// Count still reports them all
+const maxListedCells = 10000
+
+// CellsResponse is the mapper output served by GET /admin/cells
+type CellsResponse struct {
+	Res        int                     `json:"res"`
+	Count      int                     `json:"count"`
+	Cells      []string                `json:"cells"`
+	Truncated  bool                    `json:"truncated,omitempty"`
+	Boundaries map[string][][2]float64 `json:"boundaries,omitempty"`
+}
+
+// Cells shows which cells the mapper covers a bbox or polygon with, the same
+// way /query would; res defaults to H3_RES and is clamped to the configured
+// range, and the footprint is held to /query's vertex and extent limits.
+// X-H3-Resolution and X-H3-Cell-Count carry the summary, which is all HEAD
+// sends
+func Cells(cfg config.Config, m mapper.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		qv := r.URL.Query()
+		res := cfg.H3Res
+		if v := strings.TrimSpace(qv.Get("res")); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				http.Error(w, "res must be an integer", http.StatusBadRequest)
+				return
+			}
+			res = n
+		}
+		res = min(max(res, cfg.H3ResMin), cfg.H3ResMax)
+
+		var q model.QueryRequest
+		rawBBox := strings.TrimSpace(qv.Get("bbox"))
+		rawPoly := strings.TrimSpace(qv.Get("polygon"))
+		switch {
+		case rawPoly != "":
+			poly, perr := router.ParsePolygon(rawPoly)
+			if perr != nil {
+				http.Error(w, "invalid polygon: "+perr.Error(), http.StatusBadRequest)
+				return
+			}
+			q.Polygon = &poly
+		case rawBBox != "":
+			bb, perr := router.ParseBBOX(rawBBox)
+			if perr != nil {
+				http.Error(w, "invalid bbox: "+perr.Error(), http.StatusBadRequest)
+				return
+			}
+			q.BBox = &bb
+		default:
+			http.Error(w, "bbox or polygon is required", http.StatusBadRequest)
+			return
+		}
+		if qerr := router.CheckFootprint(w, cfg, &q); qerr != nil {
+			http.Error(w, qerr.Msg, qerr.Status)
+			return
+		}
+
+		var cells model.Cells
+		var err error
+		if q.Polygon != nil {
+			cells, err = m.CellsForPolygon(*q.Polygon, res)
+		} else {
+			cells, err = m.CellsForBBox(*q.BBox, res)
+		}
+		if err != nil {
+			http.Error(w, "map cells: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("X-H3-Resolution", strconv.Itoa(res))
+		w.Header().Set("X-H3-Cell-Count", strconv.Itoa(len(cells)))
+		out := CellsResponse{Res: res, Count: len(cells), Cells: []string(cells)}
+		if len(out.Cells) > maxListedCells {
+			out.Cells, out.Truncated = out.Cells[:maxListedCells], true
+		}
+		if out.Cells == nil {
+			out.Cells = []string{}
+		}
+		if b, ok := m.(Boundarier); ok && len(out.Cells) > 0 && r.Method != http.MethodHead {
+			out.Boundaries = make(map[string][][2]float64, len(out.Cells))
+			for _, c := range out.Cells {
+				ring, err := b.Boundary(c)
+				if err != nil {
+					http.Error(w, "cell boundary: "+err.Error(), http.StatusInternalServerError)
+					return
+				}
+				out.Boundaries[c] = ring
+			}
+		}
+
+		writeJSON(w, r, http.StatusOK, out)
+	}
+}
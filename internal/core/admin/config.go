@@ -0,0 +1,111 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// redactedValue replaces secrets in the /admin/config output
+const redactedValue = "[REDACTED]"
+
+// Config serves the resolved runtime configuration, one JSON member per
+// section. Durations are rendered like "5m0s", secret-named fields are
+// redacted and passwords embedded in URLs are masked
+func Config(sections map[string]any) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		out := make(map[string]any, len(sections))
+		for name, v := range sections {
+			out[name] = configValue(reflect.ValueOf(v), "")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+	}
+}
+
+var durationType = reflect.TypeFor[time.Duration]()
+
+// configValue converts v to plain JSON values; field is the name of the
+// struct field v came from, used to spot secrets
+func configValue(v reflect.Value, field string) any {
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return configValue(v.Elem(), field)
+	case reflect.Struct:
+		out := make(map[string]any, v.NumField())
+		for i := range v.NumField() {
+			f := v.Type().Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			out[f.Name] = configValue(v.Field(i), f.Name)
+		}
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		out := make(map[string]any, v.Len())
+		for it := v.MapRange(); it.Next(); {
+			out[fmt.Sprint(it.Key().Interface())] = configValue(it.Value(), field)
+		}
+		return out
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return []any{}
+		}
+		out := make([]any, v.Len())
+		for i := range v.Len() {
+			out[i] = configValue(v.Index(i), field)
+		}
+		return out
+	case reflect.String:
+		s := v.String()
+		if s != "" && isSecretField(field) {
+			return redactedValue
+		}
+		return redactURL(s)
+	default:
+		return v.Interface()
+	}
+}
+
+// isSecretField reports whether a field name suggests a credential
+func isSecretField(name string) bool {
+	n := strings.ToLower(name)
+	for _, s := range []string{"password", "secret", "token", "apikey", "credential"} {
+		if strings.Contains(n, s) && !strings.HasSuffix(n, "url") {
+			return true
+		}
+	}
+	return false
+}
+
+// redactURL masks the password of a URL with userinfo; other strings pass
+// through unchanged
+func redactURL(s string) string {
+	if !strings.Contains(s, "://") || !strings.Contains(s, "@") {
+		return s
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	if _, ok := u.User.Password(); !ok {
+		return s
+	}
+	return u.Redacted()
+}
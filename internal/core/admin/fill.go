@@ -0,0 +1,69 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/router"
+)
+
+// FillSummary reports what POST /admin/fill did: Hits were already indexed,
+// Misses were fetched upstream and Bytes is the feature JSON they stored
+type FillSummary struct {
+	Res    int    `json:"res"`
+	Cells  int    `json:"cells"`
+	Hits   int    `json:"hits"`
+	Misses int    `json:"misses"`
+	Bytes  int64  `json:"bytes"`
+	Failed int    `json:"failed,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ErrReadOnly is returned by a Filler whose cache doesn't accept writes
+var ErrReadOnly = errors.New("cache is read-only")
+
+// Filler is implemented by scenarios that can populate the cache for a query
+// footprint without composing a response
+type Filler interface {
+	FillQuery(ctx context.Context, q model.QueryRequest) (FillSummary, error)
+}
+
+// CacheFill synchronously fills the missing cells of the layer and
+// bbox/polygon given as query parameters, answering with a summary only. The
+// query is held to the same layer, res and footprint limits as /query
+func CacheFill(cfg config.Config, p Filler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, _, err := router.ParseQueryRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if q.BBox == nil && q.Polygon == nil {
+			http.Error(w, "bbox or polygon is required", http.StatusBadRequest)
+			return
+		}
+		if qerr := router.CheckQuery(w, cfg, &q); qerr != nil {
+			http.Error(w, qerr.Msg, qerr.Status)
+			return
+		}
+		q.GeometryProperty = config.GeometryPropertyFor(cfg.GeometryProperties, q.Layer)
+		q.CQLSRID = config.CQLSRIDFor(cfg.CQLSRIDs, q.Layer)
+
+		sum, err := p.FillQuery(r.Context(), q)
+		if errors.Is(err, ErrReadOnly) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err != nil {
+			// the summary still says how much was stored before the failure
+			sum.Error = err.Error()
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		_ = json.NewEncoder(w).Encode(sum)
+	}
+}
@@ -2,7 +2,10 @@
 package config
 
 import (
+	"net/http"
 	"os"
+	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -16,16 +19,80 @@ type InvalidationCfg struct {
 	GroupID string
 }
 
+type ServerCfg struct {
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	H2C               bool
+	// MaxConcurrent caps /query requests running at once; 0 is unlimited.
+	// Up to MaxQueue more wait up to QueueWait for a slot (0 waits until the
+	// client gives up) before a 503
+	MaxConcurrent int
+	MaxQueue      int
+	QueueWait     time.Duration
+}
+
 type Features struct {
 	GMLStreaming           bool
 	BaselineStreamUpstream bool
+	BaselineStreamDecode   bool
+	BaselineStreamDedup    bool // with BaselineStreamUpstream, dedup the proxied features as they stream through
+	BaselinePassthroughRaw bool // return the upstream body byte-for-byte, skipping composition
+	RequestCoalescing      bool
+	DebugHeaders           bool // expose merge diagnostics and H3 cell info as X-Features-*/X-Dedup-*/X-H3-* headers
+	// ConditionalFetch keeps each cell's upstream ETag/Last-Modified and
+	// refetches with If-None-Match/If-Modified-Since, rebuilding the cell from
+	// cached features on a 304
+	ConditionalFetch bool
+	// CaptureFixtures lets ?capture=true write the query, its cells, the
+	// cache decision and the composed response to CaptureDir
+	CaptureFixtures bool
+}
+
+// ShadowCfg configures replaying served /query requests through a second
+// engine, off the response path, to compare two configurations on live traffic
+type ShadowCfg struct {
+	Enabled  bool
+	Name     string // shadow label on the spatial_shadow_* metrics
+	Scenario string
+	H3Res    int
+	// RedisDB defaults to the DB after REDIS_DB so the shadow has its own
+	// keyspace; Kafka invalidation only reaches the primary's, so shadow
+	// entries live until their TTL
+	RedisDB     int
+	MaxInFlight int // replays running at once; further queries are not replayed
+	Timeout     time.Duration
+}
+
+// LayerResCfg configures the layer analyzer, which moves a layer's base H3
+// resolution when its window of cell misses and features per cell calls for it
+type LayerResCfg struct {
+	Enabled     bool
+	Apply       bool // move the resolution; otherwise only log and count suggestions
+	Window      time.Duration
+	Interval    time.Duration
+	MinCells    int     // cells a window needs before it is judged
+	MissRate    float64 // at or above, suggest coarser
+	MaxFeatures float64 // average features per cell above which to suggest finer; 0 disables
+	MaxLayers   int     // layers tracked at once
 }
 
 type Config struct {
 	Addr                     string
+	Server                   ServerCfg
 	LogLevel                 string
+	LogSampleN               int           // keep 1 in N logs; request logs only when SlowRequestThreshold is set
+	SlowRequestThreshold     time.Duration // requests at least this slow always log at warn
+	TracingEnabled           bool          // tag latency histograms with trace-id exemplars, served as OpenMetrics
 	GeoServerURL             string
 	RedisAddr                string
+	RedisShards              []string      // standalone nodes to consistent-hash across; overrides RedisAddr
+	RedisDB                  int           // logical database, so scenarios can share a Redis without colliding
+	RedisStartupAttempts     int           // pings before startup gives up on Redis; 1 fails on the first error
+	RedisStartupInterval     time.Duration // wait after the first failed ping, doubling per attempt
+	CacheBackend             string        // "redis" (default), "memory", or a registered backend
 	KafkaBrokers             string
 	H3Res                    int
 	Scenario                 string
@@ -34,22 +101,91 @@ type Config struct {
 	H3ResMin                 int
 	H3ResMax                 int
 	CacheOpTimeout           time.Duration
+	CacheMGetTimeout         time.Duration
+	CacheSetTimeout          time.Duration
 	CacheTTLDefault          time.Duration
 	CacheTTLOvr              map[string]time.Duration
+	CacheTTLMin              time.Duration // floor for every cell TTL the cache applies; 0 disables
+	FeatureTTL               time.Duration // feature body TTL when longer than the cell index TTL; 0 reuses the index TTL
 	CacheFillMaxWorkers      int
+	CacheFillPoolWorkers     int // long-lived fill workers shared by all requests; 0 starts CacheFillMaxWorkers per request
+	UpstreamMaxConcurrency   int // process-wide cap on in-flight per-cell upstream calls; 0 is unlimited
+	UpstreamMaxIdleConns     int // idle GeoServer conns kept across hosts; 0 is unlimited
+	UpstreamMaxConnsPerHost  int // GeoServer conns per host, idle or not; 0 is unlimited
+	UpstreamIdleTimeout      time.Duration
 	CacheFillQueue           int
+	CacheFillQueueWait       time.Duration // longest a query waits to queue a fill before a 503; 0 waits indefinitely
+	WarmManifest             string        // cells/bboxes filled before /health/ready reports ready; "" disables
+	CacheEmptySampleInterval time.Duration // how often to estimate empty-marker keys; 0 disables
+	CacheOrphanSweepInterval time.Duration // how often to delete unreferenced feature keys; 0 disables
+	CacheOrphanGrace         time.Duration // how long a feature must stay unreferenced before deletion
+	CacheOrphanMaxDeletes    int           // cap on orphan deletions per sweep; 0 is unlimited
+	CacheReadOnly            bool          // serve misses upstream without writing to the cache
+	CacheStaleGraceWindow    time.Duration // fills this close before an invalidation still count as fresh
+	GeomPrecision            int
+	AggParseWorkers          int  // >1 parses cached shards concurrently before merging
+	GeomCanonicalRings       bool // rotate polygon rings to a canonical start before geometry hashing
+	AggDedupStrict           bool // count same-id features whose geometries differ as id conflicts
 	Invalidation             InvalidationCfg
 	AdaptiveEnabled          bool
 	AdaptiveDryRun           bool
+	AdaptiveDryRunCellSample int // in dry-run, log the would-be decision for 1 in N cells; 0 disables
 	AdaptiveSeed             uint64
 	AdaptiveServeOnlyIfFresh bool
 	AdaptiveTTLCold          time.Duration
 	AdaptiveTTLWarm          time.Duration
 	AdaptiveTTLHot           time.Duration
+	CacheHotTTLTier          bool // without the adaptive decider, give cells over HotThreshold AdaptiveTTLHot
 	Features                 Features
 	HitEventsEnabled         bool
 	HitEventsTopic           string
 	HitEventsBrokers         []string
+	CORSAllowedOrigins       []string
+	// PassthroughHeaders are copied from the client to GeoServer and scope cache keys
+	PassthroughHeaders []string
+	// PassthroughFormats are non-GeoJSON/GML outputFormats forwarded straight to GeoServer
+	PassthroughFormats []string
+	// IDProperties maps layer to the property used as feature id when "id" is absent
+	IDProperties map[string]string
+	// TimeProperty is the timestamp property created_after/created_before filter on
+	TimeProperty string
+	// GeometryProperties maps layer to its geometry column in INTERSECTS filters
+	GeometryProperties map[string]string
+	// CQLSRIDs maps layer to the SRID its INTERSECTS literals are labelled with
+	CQLSRIDs map[string]string
+	// SRIDCheckEmptyCells is how many cells of a layer in a row must come back
+	// empty before their bbox is probed for features the INTERSECTS filter
+	// missed, a sign of a CRS mismatch; 0 disables
+	SRIDCheckEmptyCells int
+	// CaptureDir receives the fixtures written by ?capture=true
+	CaptureDir string
+	// PropertyTypes maps layer to property types that fix how sort values are
+	// coerced, overriding sortby hints
+	PropertyTypes map[string]map[string]string
+	// StripProperties are removed from every returned feature's properties
+	StripProperties []string
+	// MaxFeatures caps features per composed response; 0 is unlimited
+	MaxFeatures int
+	// MaxPolygonVertices rejects polygon queries with more vertices; 0 is unlimited
+	MaxPolygonVertices int
+	// MaxQueryExtent rejects footprints whose bbox or polygon envelope covers
+	// more square degrees; 0 is unlimited. With MaxQueryExtentClamp a bbox is
+	// shrunk around its center instead
+	MaxQueryExtent      float64
+	MaxQueryExtentClamp bool
+	// QueryTimeout is the /query deadline when the client sends no
+	// X-Request-Timeout; 0 leaves requests unbounded. QueryTimeoutMax caps the
+	// header, so clients can shorten or lengthen their budget only up to it
+	QueryTimeout    time.Duration
+	QueryTimeoutMax time.Duration
+	// LayersAllow and LayersDeny are layer globs (e.g. "demo:*"); see LayerAllowed
+	LayersAllow []string
+	LayersDeny  []string
+	// LayerAliases maps friendly layer names to workspace-qualified typeNames;
+	// see ResolveLayer
+	LayerAliases map[string]string
+	Shadow       ShadowCfg
+	LayerRes     LayerResCfg
 }
 
 func FromEnv() Config {
@@ -68,25 +204,66 @@ func FromEnv() Config {
 	}
 
 	ttlDefault := getduration("CACHE_TTL_DEFAULT", 60*time.Second)
+	opTimeout := getduration("CACHE_OP_TIMEOUT", 250*time.Millisecond)
 
 	return Config{
-		Addr:         getenv("ADDR", ":8090"),
-		LogLevel:     getenv("LOG_LEVEL", "info"),
-		GeoServerURL: getenv("GEOSERVER_URL", "http://localhost:8080/geoserver"),
-		RedisAddr:    getenv("REDIS_ADDR", "localhost:6379"),
-		KafkaBrokers: getenv("KAFKA_BROKERS", "localhost:9092"),
-		H3Res:        res,
-		Scenario:     getenv("SCENARIO", "baseline"),
-		HotThreshold: getfloat("HOT_THRESHOLD", 10.0),
-		HotHalfLife:  getduration("HOT_HALF_LIFE", time.Minute),
-		H3ResMin:     minRes,
-		H3ResMax:     maxRes,
-
-		CacheOpTimeout:      getduration("CACHE_OP_TIMEOUT", 250*time.Millisecond),
-		CacheTTLDefault:     ttlDefault,
-		CacheTTLOvr:         parseDurationMap(getenv("CACHE_TTL_OVERRIDES", "")),
-		CacheFillMaxWorkers: getint("CACHE_FILL_MAX_WORKERS", 8),
-		CacheFillQueue:      getint("CACHE_FILL_QUEUE", 64),
+		Addr: getenv("ADDR", ":8090"),
+		Server: ServerCfg{
+			ReadHeaderTimeout: getduration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second),
+			ReadTimeout:       getduration("HTTP_READ_TIMEOUT", 15*time.Second),
+			WriteTimeout:      getduration("HTTP_WRITE_TIMEOUT", 60*time.Second),
+			IdleTimeout:       getduration("HTTP_IDLE_TIMEOUT", 60*time.Second),
+			MaxHeaderBytes:    getint("HTTP_MAX_HEADER_BYTES", 1<<20),
+			H2C:               getbool("HTTP_H2C"),
+			MaxConcurrent:     max(getint("HTTP_MAX_CONCURRENT", 0), 0),
+			MaxQueue:          max(getint("HTTP_MAX_QUEUE", 0), 0),
+			QueueWait:         max(getduration("HTTP_QUEUE_WAIT", time.Second), 0),
+		},
+		LogLevel:             getenv("LOG_LEVEL", "info"),
+		LogSampleN:           getint("LOG_SAMPLE_N", 0),
+		SlowRequestThreshold: getduration("SLOW_REQUEST_THRESHOLD", 0),
+		TracingEnabled:       getbool("TRACING_ENABLED"),
+		GeoServerURL:         getenv("GEOSERVER_URL", "http://localhost:8080/geoserver"),
+		RedisAddr:            getenv("REDIS_ADDR", "localhost:6379"),
+		RedisShards:          splitCSV(getenv("REDIS_SHARDS", "")),
+		RedisDB:              getint("REDIS_DB", 0),
+		RedisStartupAttempts: max(getint("REDIS_STARTUP_ATTEMPTS", 1), 1),
+		RedisStartupInterval: max(getduration("REDIS_STARTUP_INTERVAL", 500*time.Millisecond), 0),
+		CacheBackend:         strings.ToLower(strings.TrimSpace(getenv("CACHE_BACKEND", "redis"))),
+		KafkaBrokers:         getenv("KAFKA_BROKERS", "localhost:9092"),
+		H3Res:                res,
+		Scenario:             getenv("SCENARIO", "baseline"),
+		HotThreshold:         getfloat("HOT_THRESHOLD", 10.0),
+		HotHalfLife:          getduration("HOT_HALF_LIFE", time.Minute),
+		H3ResMin:             minRes,
+		H3ResMax:             maxRes,
+
+		CacheOpTimeout:           opTimeout,
+		CacheMGetTimeout:         getduration("CACHE_MGET_TIMEOUT", opTimeout),
+		CacheSetTimeout:          getduration("CACHE_SET_TIMEOUT", opTimeout),
+		CacheTTLDefault:          ttlDefault,
+		CacheTTLOvr:              parseDurationMap(getenv("CACHE_TTL_OVERRIDES", "")),
+		CacheTTLMin:              max(getduration("CACHE_TTL_MIN", 0), 0),
+		FeatureTTL:               max(getduration("FEATURE_TTL", 0), 0),
+		CacheFillMaxWorkers:      getint("CACHE_FILL_MAX_WORKERS", 8),
+		CacheFillPoolWorkers:     max(getint("CACHE_FILL_POOL_WORKERS", 0), 0),
+		UpstreamMaxConcurrency:   max(getint("UPSTREAM_MAX_CONCURRENCY", 0), 0),
+		UpstreamMaxIdleConns:     max(getint("UPSTREAM_MAX_IDLE_CONNS", 256), 0),
+		UpstreamMaxConnsPerHost:  max(getint("UPSTREAM_MAX_CONNS_PER_HOST", 0), 0),
+		UpstreamIdleTimeout:      getduration("UPSTREAM_IDLE_TIMEOUT", 90*time.Second),
+		CacheFillQueue:           getint("CACHE_FILL_QUEUE", 64),
+		CacheFillQueueWait:       getduration("CACHE_FILL_QUEUE_WAIT", 0),
+		WarmManifest:             strings.TrimSpace(getenv("WARM_MANIFEST", "")),
+		CacheEmptySampleInterval: getduration("CACHE_EMPTY_SAMPLE_INTERVAL", time.Minute),
+		CacheOrphanSweepInterval: getduration("CACHE_ORPHAN_SWEEP_INTERVAL", 0),
+		CacheOrphanGrace:         getduration("CACHE_ORPHAN_GRACE", 10*time.Minute),
+		CacheOrphanMaxDeletes:    getint("CACHE_ORPHAN_MAX_DELETES", 1000),
+		CacheReadOnly:            getbool("CACHE_READONLY"),
+		CacheStaleGraceWindow:    getduration("CACHE_STALE_GRACE_WINDOW", 0),
+		GeomPrecision:            geomPrecision(),
+		AggParseWorkers:          getint("AGG_PARSE_WORKERS", 0),
+		GeomCanonicalRings:       getbool("GEOM_CANONICAL_RINGS"),
+		AggDedupStrict:           getbool("AGG_DEDUP_STRICT"),
 
 		Invalidation: InvalidationCfg{
 			Enabled: strings.ToLower(getenv("INVALIDATION_ENABLED", "false")) == "true",
@@ -98,14 +275,23 @@ func FromEnv() Config {
 
 		AdaptiveEnabled:          getbool("ADAPTIVE_ENABLED"),
 		AdaptiveDryRun:           getbool("ADAPTIVE_DRY_RUN"),
+		AdaptiveDryRunCellSample: max(getint("ADAPTIVE_DRY_RUN_CELL_SAMPLE_N", 0), 0),
 		AdaptiveSeed:             getuint64("ADAPTIVE_SEED", 1),
 		AdaptiveServeOnlyIfFresh: getbool("ADAPTIVE_SERVE_ONLY_IF_FRESH"),
 		AdaptiveTTLCold:          getduration("ADAPTIVE_TTL_COLD", ttlDefault/2),
 		AdaptiveTTLWarm:          getduration("ADAPTIVE_TTL_WARM", ttlDefault),
 		AdaptiveTTLHot:           getduration("ADAPTIVE_TTL_HOT", 2*ttlDefault),
+		CacheHotTTLTier:          getbool("CACHE_HOT_TTL_TIER"),
 		Features: Features{
 			GMLStreaming:           getbool("FEATURES_GML_STREAMING"),
 			BaselineStreamUpstream: getbool("FEATURES_BASELINE_STREAM_UPSTREAM"),
+			BaselineStreamDecode:   getbool("FEATURES_BASELINE_STREAM_DECODE"),
+			BaselineStreamDedup:    getbool("FEATURES_BASELINE_STREAM_DEDUP"),
+			BaselinePassthroughRaw: getbool("BASELINE_PASSTHROUGH_RAW"),
+			RequestCoalescing:      getbool("FEATURES_REQUEST_COALESCING"),
+			DebugHeaders:           getbool("FEATURES_DEBUG_HEADERS"),
+			ConditionalFetch:       getbool("FEATURES_CONDITIONAL_FETCH"),
+			CaptureFixtures:        getbool("FEATURES_CAPTURE_FIXTURES"),
 		},
 
 		HitEventsEnabled: getbool("HIT_EVENTS_ENABLED"),
@@ -117,9 +303,92 @@ func FromEnv() Config {
 			}
 			return splitCSV(raw)
 		}(),
+
+		CORSAllowedOrigins:  splitCSV(getenv("CORS_ALLOWED_ORIGINS", "")),
+		PassthroughHeaders:  passthroughHeaders(),
+		PassthroughFormats:  splitCSV(getenv("OUTPUT_FORMAT_PASSTHROUGH", "")),
+		IDProperties:        parseStringMap(getenv("ID_PROPERTY", "")),
+		TimeProperty:        getenv("TIME_PROPERTY", "created_at"),
+		GeometryProperties:  parseStringMap(getenv("GEOMETRY_PROPERTY", "")),
+		CQLSRIDs:            parseStringMap(getenv("CQL_SRID", "")),
+		SRIDCheckEmptyCells: max(getint("SRID_CHECK_EMPTY_CELLS", 100), 0),
+		CaptureDir:          getenv("CAPTURE_DIR", filepath.Join(os.TempDir(), "h3-spatial-cache-fixtures")),
+		PropertyTypes:       propertyTypesFromEnv(),
+		StripProperties:     splitCSV(getenv("STRIP_PROPERTIES", "")),
+		MaxFeatures:         max(getint("MAX_FEATURES", 0), 0),
+		MaxPolygonVertices:  max(getint("MAX_POLYGON_VERTICES", 10000), 0),
+		MaxQueryExtent:      max(getfloat("MAX_QUERY_EXTENT", 0), 0),
+		MaxQueryExtentClamp: getbool("MAX_QUERY_EXTENT_CLAMP"),
+		QueryTimeout:        max(getduration("QUERY_TIMEOUT", 0), 0),
+		QueryTimeoutMax:     max(getduration("QUERY_TIMEOUT_MAX", time.Minute), 0),
+		LayersAllow:         splitCSV(getenv("LAYERS_ALLOW", "")),
+		LayersDeny:          splitCSV(getenv("LAYERS_DENY", "")),
+		LayerAliases:        parseStringMap(getenv("LAYER_ALIASES", "")),
+		Shadow: ShadowCfg{
+			Enabled:     getbool("SHADOW_ENABLED"),
+			Name:        getenv("SHADOW_NAME", "shadow"),
+			Scenario:    getenv("SHADOW_SCENARIO", "cache"),
+			H3Res:       min(max(getint("SHADOW_H3_RES", res), 0), 15),
+			RedisDB:     getint("SHADOW_REDIS_DB", (getint("REDIS_DB", 0)+1)%16),
+			MaxInFlight: max(getint("SHADOW_MAX_IN_FLIGHT", 32), 1),
+			Timeout:     getduration("SHADOW_TIMEOUT", 10*time.Second),
+		},
+		LayerRes: LayerResCfg{
+			Enabled:     getbool("LAYER_RES_ENABLED"),
+			Apply:       getbool("LAYER_RES_APPLY"),
+			Window:      getduration("LAYER_RES_WINDOW", 5*time.Minute),
+			Interval:    getduration("LAYER_RES_INTERVAL", 30*time.Second),
+			MinCells:    max(getint("LAYER_RES_MIN_CELLS", 200), 1),
+			MissRate:    getfloat("LAYER_RES_MISS_RATE", 0.8),
+			MaxFeatures: max(getfloat("LAYER_RES_MAX_FEATURES", 0), 0),
+			MaxLayers:   max(getint("LAYER_RES_MAX_LAYERS", 1000), 1),
+		},
 	}
 }
 
+// ShadowConfig is the configuration the shadow engine runs with: c with the
+// SHADOW_* overrides applied and its background jobs and fixture capture off,
+// since the primary already runs them
+func (c Config) ShadowConfig() Config {
+	s := c
+	s.Scenario = c.Shadow.Scenario
+	s.H3Res = c.Shadow.H3Res
+	s.H3ResMin = min(c.H3ResMin, s.H3Res)
+	s.H3ResMax = max(c.H3ResMax, s.H3Res)
+	s.RedisDB = c.Shadow.RedisDB
+	s.CacheEmptySampleInterval = 0
+	s.CacheOrphanSweepInterval = 0
+	s.Shadow = ShadowCfg{}
+	s.LayerRes.Enabled = false
+	s.Features.CaptureFixtures = false
+	return s
+}
+
+// UPSTREAM_PASSTHROUGH_HEADERS as canonical header names; "none" disables
+func passthroughHeaders() []string {
+	raw := getenv("UPSTREAM_PASSTHROUGH_HEADERS", "Accept-Language")
+	if strings.EqualFold(strings.TrimSpace(raw), "none") {
+		return nil
+	}
+	out := splitCSV(raw)
+	for i, h := range out {
+		out[i] = http.CanonicalHeaderKey(h)
+	}
+	return out
+}
+
+// GEOM_PRECISION, clamped to [1,15] decimal places
+func geomPrecision() int {
+	p := getint("GEOM_PRECISION", 7)
+	if p < 1 {
+		return 1
+	}
+	if p > 15 {
+		return 15
+	}
+	return p
+}
+
 func getenv(k, def string) string {
 	if v := os.Getenv(k); v != "" {
 		return v
@@ -204,6 +473,74 @@ func parseDurationMap(s string) map[string]time.Duration {
 	return out
 }
 
+// parse "layer=gid,*=fid" into map
+func parseStringMap(s string) map[string]string {
+	out := map[string]string{}
+	for p := range strings.SplitSeq(s, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if !ok || k == "" || v == "" {
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// GeometryPropertyFor resolves the geometry column for layer the same way as
+// IDPropertyFor; "" leaves the default
+func GeometryPropertyFor(props map[string]string, layer string) string {
+	return IDPropertyFor(props, layer)
+}
+
+// CQLSRIDFor resolves the INTERSECTS literal SRID for layer the same way as
+// IDPropertyFor; "" means the default
+func CQLSRIDFor(srids map[string]string, layer string) string {
+	return IDPropertyFor(srids, layer)
+}
+
+// IDPropertyFor resolves the id property for layer: exact name, then the name
+// without workspace prefix, then the "*" wildcard
+func IDPropertyFor(props map[string]string, layer string) string {
+	if p, ok := props[layer]; ok {
+		return p
+	}
+	if _, name, ok := strings.Cut(layer, ":"); ok {
+		if p, ok := props[name]; ok {
+			return p
+		}
+	}
+	return props["*"]
+}
+
+// ResolveLayer returns the typeName aliased to layer, or layer itself when no
+// alias matches
+func ResolveLayer(aliases map[string]string, layer string) string {
+	if t, ok := aliases[layer]; ok {
+		return t
+	}
+	return layer
+}
+
+// LayerAllowed reports whether layer may be queried: it must match no deny
+// glob and, when allow is non-empty, at least one allow glob
+func LayerAllowed(allow, deny []string, layer string) bool {
+	if matchLayer(deny, layer) {
+		return false
+	}
+	return len(allow) == 0 || matchLayer(allow, layer)
+}
+
+// globs use path.Match syntax, so "demo:*" covers every layer in the demo workspace
+func matchLayer(globs []string, layer string) bool {
+	for _, g := range globs {
+		if ok, err := path.Match(g, layer); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
 func splitCSV(s string) []string {
 	out := make([]string, 0)
 	s = strings.TrimSpace(s)
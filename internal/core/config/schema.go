@@ -0,0 +1,78 @@
+package config
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// property types understood by the composer's sort coercion
+var propertyTypes = map[string]bool{"number": true, "time": true, "string": true}
+
+// propertyTypesFromEnv loads PROPERTY_TYPES_FILE, a JSON object of
+// {"layer": {"property": "number|time|string"}}, then applies PROPERTY_TYPES
+// entries "layer/property=type,..." over it; unknown types are dropped
+func propertyTypesFromEnv() map[string]map[string]string {
+	out := map[string]map[string]string{}
+	set := func(layer, prop, typ string) {
+		layer, prop, typ = strings.TrimSpace(layer), strings.TrimSpace(prop), strings.ToLower(strings.TrimSpace(typ))
+		if layer == "" || prop == "" || !propertyTypes[typ] {
+			return
+		}
+		if out[layer] == nil {
+			out[layer] = map[string]string{}
+		}
+		out[layer][prop] = typ
+	}
+
+	if path := strings.TrimSpace(getenv("PROPERTY_TYPES_FILE", "")); path != "" {
+		var file map[string]map[string]string
+		b, err := os.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(b, &file)
+		}
+		if err != nil {
+			slog.Warn("ignoring PROPERTY_TYPES_FILE", "path", path, "err", err)
+		}
+		for layer, props := range file {
+			for prop, typ := range props {
+				set(layer, prop, typ)
+			}
+		}
+	}
+
+	for p := range strings.SplitSeq(getenv("PROPERTY_TYPES", ""), ",") {
+		lp, typ, ok := strings.Cut(p, "=")
+		if !ok {
+			continue
+		}
+		layer, prop, ok := strings.Cut(lp, "/")
+		if !ok {
+			continue
+		}
+		set(layer, prop, typ)
+	}
+	return out
+}
+
+// PropertyTypesFor merges the declared property types that apply to layer:
+// "*", then the name without workspace prefix, then the exact name, later
+// ones winning; nil when none apply
+func PropertyTypesFor(types map[string]map[string]string, layer string) map[string]string {
+	var out map[string]string
+	add := func(m map[string]string) {
+		for k, v := range m {
+			if out == nil {
+				out = make(map[string]string)
+			}
+			out[k] = v
+		}
+	}
+	add(types["*"])
+	if _, name, ok := strings.Cut(layer, ":"); ok {
+		add(types[name])
+	}
+	add(types[layer])
+	return out
+}
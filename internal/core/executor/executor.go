@@ -23,6 +23,12 @@ type Interface interface {
 	ForwardGetFeatureFormat(w http.ResponseWriter, r *http.Request, q model.QueryRequest, accept string)
 }
 
+// StreamFetcher is implemented by executors that can hand back the upstream
+// body unread, so callers can decode it incrementally
+type StreamFetcher interface {
+	OpenGetFeature(ctx context.Context, q model.QueryRequest) (io.ReadCloser, string, error)
+}
+
 type Executor struct {
 	logger   *slog.Logger
 	client   *http.Client
@@ -64,19 +70,26 @@ func (e *Executor) ForwardWFS(_ context.Context, w http.ResponseWriter, r *http.
 			p.Out.URL.RawQuery = params.Encode()
 			p.Out.Host = e.owsURL.Host
 			p.Out.Header.Set("Accept", "application/json")
+			setPassthrough(p.Out.Header, q)
 			p.SetXForwarded()
 		},
 
 		ModifyResponse: func(resp *http.Response) error {
+			if kind := observability.ClassifyUpstreamStatus(resp.StatusCode); kind != "" {
+				observability.IncUpstreamError(resp.Request.Context(), "geoserver", kind)
+			}
 			dur := time.Since(start)
 			e.logger.Debug("forward done",
 				"status", resp.StatusCode,
 				"duration", dur.String())
-			observability.ObserveUpstreamLatency("geoserver", dur.Seconds())
+			observability.ObserveUpstreamLatency(resp.Request.Context(), "geoserver", dur.Seconds())
 			return nil
 		},
 
-		ErrorHandler: func(w http.ResponseWriter, _ *http.Request, err error) {
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			if kind := observability.ClassifyUpstreamError(req.Context(), err); kind != "" {
+				observability.IncUpstreamError(req.Context(), "geoserver", kind)
+			}
 			e.logger.Error("reverse proxy error", "err", err)
 			http.Error(w, "upstream proxy error: "+err.Error(), http.StatusBadGateway)
 		},
@@ -115,15 +128,22 @@ func (e *Executor) ForwardWFSWithFormat(_ context.Context, w http.ResponseWriter
 			p.Out.URL.RawQuery = params.Encode()
 			p.Out.Host = e.owsURL.Host
 			p.Out.Header.Set("Accept", accept)
+			setPassthrough(p.Out.Header, q)
 			p.SetXForwarded()
 		},
 		ModifyResponse: func(resp *http.Response) error {
+			if kind := observability.ClassifyUpstreamStatus(resp.StatusCode); kind != "" {
+				observability.IncUpstreamError(resp.Request.Context(), "geoserver", kind)
+			}
 			dur := time.Since(start)
 			e.logger.Debug("forward done", "status", resp.StatusCode, "duration", dur.String())
-			observability.ObserveUpstreamLatency("geoserver", dur.Seconds())
+			observability.ObserveUpstreamLatency(resp.Request.Context(), "geoserver", dur.Seconds())
 			return nil
 		},
-		ErrorHandler: func(w http.ResponseWriter, _ *http.Request, err error) {
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			if kind := observability.ClassifyUpstreamError(req.Context(), err); kind != "" {
+				observability.IncUpstreamError(req.Context(), "geoserver", kind)
+			}
 			e.logger.Error("reverse proxy error", "err", err)
 			http.Error(w, "upstream proxy error: "+err.Error(), http.StatusBadGateway)
 		},
@@ -139,6 +159,22 @@ func (e *Executor) ForwardGetFeatureFormat(w http.ResponseWriter, r *http.Reques
 }
 
 func (e *Executor) FetchGetFeature(ctx context.Context, q model.QueryRequest) ([]byte, string, error) {
+	body, ct, err := e.OpenGetFeature(ctx, q)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() { _ = body.Close() }()
+
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return nil, "", fmt.Errorf("read body: %w", err)
+	}
+	return b, ct, nil
+}
+
+// OpenGetFeature issues the GetFeature request and returns the unread body;
+// the caller must close it
+func (e *Executor) OpenGetFeature(ctx context.Context, q model.QueryRequest) (io.ReadCloser, string, error) {
 	params := ogc.BuildGetFeatureParams(q)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.owsURL.String(), nil)
@@ -150,25 +186,32 @@ func (e *Executor) FetchGetFeature(ctx context.Context, q model.QueryRequest) ([
 	req.URL = &u
 	req.Host = e.owsURL.Host
 	req.Header.Set("Accept", "application/json")
+	setPassthrough(req.Header, q)
 
 	start := e.startNow()
 	resp, err := e.client.Do(req)
 	if err != nil {
+		if kind := observability.ClassifyUpstreamError(ctx, err); kind != "" {
+			observability.IncUpstreamError(ctx, "geoserver", kind)
+		}
 		return nil, "", fmt.Errorf("do request: %w", err)
 	}
-	defer func() { _ = resp.Body.Close() }()
 
 	dur := time.Since(start)
-	observability.ObserveUpstreamLatency("geoserver", dur.Seconds())
+	observability.ObserveUpstreamLatency(ctx, "geoserver", dur.Seconds())
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		observability.IncUpstreamError(ctx, "geoserver", observability.ClassifyUpstreamStatus(resp.StatusCode))
 		b, _ := io.ReadAll(io.LimitReader(resp.Body, 8<<10))
+		_ = resp.Body.Close()
 		return nil, "", fmt.Errorf("upstream status %d: %s", resp.StatusCode, string(b))
 	}
+	return resp.Body, resp.Header.Get("Content-Type"), nil
+}
 
-	b, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, "", fmt.Errorf("read body: %w", err)
+// setPassthrough copies the client headers selected by the router onto an upstream request
+func setPassthrough(h http.Header, q model.QueryRequest) {
+	for k, v := range q.Headers {
+		h.Set(k, v)
 	}
-	return b, resp.Header.Get("Content-Type"), nil
 }
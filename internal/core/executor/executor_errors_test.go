@@ -0,0 +1,109 @@
+package executor
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
+)
+
+func scrapeUpstreamErrors(t *testing.T, r *prometheus.Registry) string {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	promhttp.HandlerFor(r, promhttp.HandlerOpts{}).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	return rr.Body.String()
+}
+
+func TestFetchGetFeature_UpstreamErrorTaxonomy(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer slow.Close()
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	refusedURL := closed.URL
+	closed.Close()
+
+	status := func(code int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			http.Error(w, "nope", code)
+		}))
+	}
+	notFound := status(http.StatusNotFound)
+	defer notFound.Close()
+	unavailable := status(http.StatusServiceUnavailable)
+	defer unavailable.Close()
+
+	dnsClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(_ context.Context, _, addr string) (net.Conn, error) {
+			host, _, _ := net.SplitHostPort(addr)
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		},
+	}}
+
+	cases := []struct {
+		name   string
+		client *http.Client
+		url    string
+		kind   string
+	}{
+		{"timeout", &http.Client{Timeout: 50 * time.Millisecond}, slow.URL, observability.UpstreamErrTimeout},
+		{"conn_refused", &http.Client{}, refusedURL, observability.UpstreamErrConnRefused},
+		{"dns", dnsClient, "http://geoserver.invalid", observability.UpstreamErrDNS},
+		{"4xx", &http.Client{}, notFound.URL, observability.UpstreamErr4xx},
+		{"5xx", &http.Client{}, unavailable.URL, observability.UpstreamErr5xx},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			observability.Init(reg, true)
+
+			exec, err := New(slog.Default(), tc.client, tc.url)
+			if err != nil {
+				t.Fatalf("executor init: %v", err)
+			}
+			if _, _, err := exec.FetchGetFeature(context.Background(), model.QueryRequest{Layer: "roads"}); err == nil {
+				t.Fatalf("expected error")
+			}
+			want := `upstream_errors_total{kind="` + tc.kind + `",upstream="geoserver"} 1`
+			if body := scrapeUpstreamErrors(t, reg); !strings.Contains(body, want) {
+				t.Fatalf("missing %s:\n%s", want, body)
+			}
+		})
+	}
+}
+
+func TestForwardGetFeature_RecordsUpstreamStatusError(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "down", http.StatusBadGateway)
+	}))
+	defer up.Close()
+
+	reg := prometheus.NewRegistry()
+	observability.Init(reg, true)
+
+	exec, err := New(slog.Default(), &http.Client{}, up.URL)
+	if err != nil {
+		t.Fatalf("executor init: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	exec.ForwardGetFeature(rr, httptest.NewRequest(http.MethodGet, "/query", nil), model.QueryRequest{Layer: "roads"})
+
+	want := `upstream_errors_total{kind="5xx",upstream="geoserver"} 1`
+	if body := scrapeUpstreamErrors(t, reg); !strings.Contains(body, want) {
+		t.Fatalf("missing %s:\n%s", want, body)
+	}
+}
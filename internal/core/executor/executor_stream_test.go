@@ -45,3 +45,25 @@ func TestForwardGetFeature_StripsHopByHop_AndForwardsVary(t *testing.T) {
 		t.Fatalf("expected Content-Type to be forwarded")
 	}
 }
+
+func TestOpenGetFeature_ForwardsPassthroughHeaders(t *testing.T) {
+	var got string
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Accept-Language")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"type":"FeatureCollection","features":[]}`))
+	}))
+	defer up.Close()
+
+	exec, err := New(slog.Default(), httpclient.NewOutbound(), up.URL)
+	if err != nil {
+		t.Fatalf("executor init: %v", err)
+	}
+	q := model.QueryRequest{Layer: "roads", Headers: map[string]string{"Accept-Language": "sv-SE"}}
+	if _, _, err := exec.FetchGetFeature(t.Context(), q); err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if got != "sv-SE" {
+		t.Fatalf("Accept-Language upstream=%q want sv-SE", got)
+	}
+}
@@ -1,6 +1,7 @@
 package health
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -24,3 +25,34 @@ func TestLiveness_Handler(t *testing.T) {
 		t.Fatalf("body=%q want ok", got)
 	}
 }
+
+func TestVersion_Handler(t *testing.T) {
+	info := VersionInfo{
+		Version:   "1.2.3",
+		Revision:  "abc123",
+		Branch:    "main",
+		BuildDate: "2024-01-01T00:00:00Z",
+		Scenario:  "cache",
+		H3Res:     8,
+		H3ResMin:  7,
+		H3ResMax:  9,
+	}
+	req := httptest.NewRequest(http.MethodGet, "/version", nil)
+	rr := httptest.NewRecorder()
+
+	Version(info)(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d want 200", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("content-type=%q want application/json", ct)
+	}
+	var got VersionInfo
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got != info {
+		t.Fatalf("got %+v want %+v", got, info)
+	}
+}
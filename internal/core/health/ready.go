@@ -28,3 +28,35 @@ func Readiness(rr ReadinessReporter) http.HandlerFunc {
 		_ = json.NewEncoder(w).Encode(out)
 	}
 }
+
+// All is ready once every non-nil reporter is, reporting their partitions
+// together; it returns nil when there is nothing to report on
+func All(rs ...ReadinessReporter) ReadinessReporter {
+	var live all
+	for _, r := range rs {
+		if r != nil {
+			live = append(live, r)
+		}
+	}
+	switch len(live) {
+	case 0:
+		return nil
+	case 1:
+		return live[0]
+	}
+	return live
+}
+
+type all []ReadinessReporter
+
+func (a all) Readiness() (bool, []int32) {
+	var parts []int32
+	for _, r := range a {
+		ready, p := r.Readiness()
+		if !ready {
+			return false, nil
+		}
+		parts = append(parts, p...)
+	}
+	return true, parts
+}
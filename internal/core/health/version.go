@@ -0,0 +1,25 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// VersionInfo is the payload served by /version
+type VersionInfo struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision"`
+	Branch    string `json:"branch"`
+	BuildDate string `json:"build_date"`
+	Scenario  string `json:"scenario"`
+	H3Res     int    `json:"h3_res"`
+	H3ResMin  int    `json:"h3_res_min"`
+	H3ResMax  int    `json:"h3_res_max"`
+}
+
+func Version(info VersionInfo) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(info)
+	}
+}
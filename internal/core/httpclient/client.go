@@ -5,21 +5,64 @@ import (
 	"net"
 	"net/http"
 	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
 )
 
+// Pool sizes the outbound connection pool
+type Pool struct {
+	MaxIdleConns    int           // idle conns kept across all hosts; 0 is unlimited
+	MaxConnsPerHost int           // dialing, active and idle conns per host; 0 is unlimited
+	IdleTimeout     time.Duration // idle conns are closed after this; 0 keeps them
+}
+
+// defaultIdlePerHost applies when MaxConnsPerHost is unlimited
+const defaultIdlePerHost = 128
+
+// DefaultPool is the pool NewOutbound uses
+func DefaultPool() Pool {
+	return Pool{MaxIdleConns: 256, IdleTimeout: 90 * time.Second}
+}
+
+// PoolFromConfig reads the UPSTREAM_* pool settings
+func PoolFromConfig(cfg config.Config) Pool {
+	return Pool{
+		MaxIdleConns:    cfg.UpstreamMaxIdleConns,
+		MaxConnsPerHost: cfg.UpstreamMaxConnsPerHost,
+		IdleTimeout:     cfg.UpstreamIdleTimeout,
+	}
+}
+
 // NewOutbound creates a new outbound http client
 func NewOutbound() *http.Client {
+	return NewOutboundPool(DefaultPool())
+}
+
+// NewOutboundPool is NewOutbound with the given pool sizes; its connections
+// are counted in PoolStats
+func NewOutboundPool(p Pool) *http.Client {
+	// a per-host cap also bounds how many idle conns are worth keeping for it
+	idlePerHost := defaultIdlePerHost
+	if p.MaxConnsPerHost > 0 {
+		idlePerHost = p.MaxConnsPerHost
+	}
+	if p.MaxIdleConns > 0 {
+		idlePerHost = min(idlePerHost, p.MaxIdleConns)
+	}
+
+	dialer := &net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second}
 	transport := &http.Transport{
 		Proxy:                 http.ProxyFromEnvironment,
-		DialContext:           (&net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
-		MaxIdleConns:          256,
-		MaxIdleConnsPerHost:   128,
-		IdleConnTimeout:       90 * time.Second,
+		DialContext:           countingDial(dialer.DialContext),
+		MaxIdleConns:          p.MaxIdleConns,
+		MaxIdleConnsPerHost:   idlePerHost,
+		MaxConnsPerHost:       p.MaxConnsPerHost,
+		IdleConnTimeout:       p.IdleTimeout,
 		TLSHandshakeTimeout:   5 * time.Second,
 		ExpectContinueTimeout: 1 * time.Second,
 	}
 	return &http.Client{
-		Transport: transport,
+		Transport: &countingTransport{base: transport},
 		Timeout:   30 * time.Second,
 	}
 }
@@ -0,0 +1,76 @@
+package httpclient
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+)
+
+func transportOf(t *testing.T, c *http.Client) *http.Transport {
+	t.Helper()
+	ct, ok := c.Transport.(*countingTransport)
+	if !ok {
+		t.Fatalf("transport is %T, want *countingTransport", c.Transport)
+	}
+	tr, ok := ct.base.(*http.Transport)
+	if !ok {
+		t.Fatalf("base transport is %T, want *http.Transport", ct.base)
+	}
+	return tr
+}
+
+func TestNewOutboundPool_AppliesConfig(t *testing.T) {
+	cfg := config.Config{
+		UpstreamMaxIdleConns:    64,
+		UpstreamMaxConnsPerHost: 32,
+		UpstreamIdleTimeout:     15 * time.Second,
+	}
+	tr := transportOf(t, NewOutboundPool(PoolFromConfig(cfg)))
+	if tr.MaxIdleConns != 64 || tr.MaxConnsPerHost != 32 || tr.IdleConnTimeout != 15*time.Second {
+		t.Fatalf("pool not applied: idle=%d perHost=%d timeout=%v", tr.MaxIdleConns, tr.MaxConnsPerHost, tr.IdleConnTimeout)
+	}
+	if tr.MaxIdleConnsPerHost != 32 {
+		t.Fatalf("MaxIdleConnsPerHost=%d want the per-host cap 32", tr.MaxIdleConnsPerHost)
+	}
+
+	// defaults match the previous fixed transport
+	tr = transportOf(t, NewOutbound())
+	if tr.MaxIdleConns != 256 || tr.MaxIdleConnsPerHost != 128 || tr.MaxConnsPerHost != 0 || tr.IdleConnTimeout != 90*time.Second {
+		t.Fatalf("defaults: idle=%d idlePerHost=%d perHost=%d timeout=%v",
+			tr.MaxIdleConns, tr.MaxIdleConnsPerHost, tr.MaxConnsPerHost, tr.IdleConnTimeout)
+	}
+}
+
+func TestPoolStats_CountsIdleAndInUse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	c := NewOutboundPool(Pool{MaxIdleConns: 4, IdleTimeout: time.Minute})
+	idle0, busy0 := PoolStats()
+
+	resp, err := c.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if _, busy := PoolStats(); busy != busy0+1 {
+		t.Fatalf("in use while the body is open: %d want %d", busy, busy0+1)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	idle, busy := PoolStats()
+	if busy != busy0 || idle != idle0+1 {
+		t.Fatalf("after close: idle=%d in_use=%d want %d/%d", idle, busy, idle0+1, busy0)
+	}
+
+	c.CloseIdleConnections()
+	if idle, _ := PoolStats(); idle != idle0 {
+		t.Fatalf("idle after CloseIdleConnections: %d want %d", idle, idle0)
+	}
+}
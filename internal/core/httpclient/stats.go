@@ -0,0 +1,107 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
+)
+
+// PoolSampleInterval is how often StartPoolSampler publishes PoolStats
+const PoolSampleInterval = 5 * time.Second
+
+// process-wide across every client built by NewOutboundPool
+var (
+	openConns  atomic.Int64
+	inUseConns atomic.Int64
+)
+
+// PoolStats reports outbound connections currently open and how many of those
+// are carrying a request; idle is the difference. Over HTTP/2 several requests
+// share a conn, so in-use can exceed open and idle then reads 0
+func PoolStats() (idle, inUse int) {
+	open, busy := openConns.Load(), inUseConns.Load()
+	return int(max(open-busy, 0)), int(busy)
+}
+
+// StartPoolSampler publishes PoolStats as upstream_pool_conns every interval
+// until ctx is done
+func StartPoolSampler(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = PoolSampleInterval
+	}
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				observability.SetUpstreamPool(PoolStats())
+			}
+		}
+	}()
+}
+
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+func countingDial(dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		c, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		openConns.Add(1)
+		return &countedConn{Conn: c}, nil
+	}
+}
+
+type countedConn struct {
+	net.Conn
+	once sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() { openConns.Add(-1) })
+	return c.Conn.Close()
+}
+
+// countingTransport counts a request as in use from RoundTrip until its
+// response body is closed
+type countingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	inUseConns.Add(1)
+	resp, err := t.base.RoundTrip(r)
+	if err != nil {
+		inUseConns.Add(-1)
+		return nil, err
+	}
+	resp.Body = &countedBody{ReadCloser: resp.Body}
+	return resp, nil
+}
+
+// CloseIdleConnections keeps http.Client.CloseIdleConnections working through the wrapper
+func (t *countingTransport) CloseIdleConnections() {
+	if ci, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		ci.CloseIdleConnections()
+	}
+}
+
+type countedBody struct {
+	io.ReadCloser
+	once sync.Once
+}
+
+func (b *countedBody) Close() error {
+	b.once.Do(func() { inUseConns.Add(-1) })
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/problem"
+)
+
+// Admit caps the requests running at once through every handler it wraps at
+// maxInFlight. Up to maxQueue more wait for a free slot, each for at most wait
+// (0 waits until the request is canceled); the rest are shed with a 503 and
+// Retry-After. maxInFlight <= 0 disables the middleware
+func Admit(maxInFlight, maxQueue int, wait time.Duration) func(http.Handler) http.Handler {
+	if maxInFlight <= 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	return newAdmission(maxInFlight, maxQueue, wait).wrap
+}
+
+type admission struct {
+	slots    chan struct{}
+	maxQueue int64
+	wait     time.Duration
+	queued   atomic.Int64
+}
+
+func newAdmission(maxInFlight, maxQueue int, wait time.Duration) *admission {
+	return &admission{
+		slots:    make(chan struct{}, maxInFlight),
+		maxQueue: int64(max(maxQueue, 0)),
+		wait:     wait,
+	}
+}
+
+func (a *admission) report() {
+	observability.SetQueryAdmission(len(a.slots), int(a.queued.Load()))
+}
+
+func (a *admission) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch reason := a.acquire(r); reason {
+		case "":
+		case "admission_canceled":
+			problem.Error(w, r, "request canceled", http.StatusRequestTimeout)
+			return
+		default:
+			observability.IncQueryReject(reason)
+			w.Header().Set("Retry-After", a.retryAfter())
+			problem.Error(w, r, "server is at its concurrent request limit; retry later", http.StatusServiceUnavailable)
+			return
+		}
+		defer func() {
+			<-a.slots
+			a.report()
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// acquire takes a slot, queueing when none is free; it returns "" once the
+// slot is held, or why the request was turned away
+func (a *admission) acquire(r *http.Request) string {
+	select {
+	case a.slots <- struct{}{}:
+		a.report()
+		return ""
+	default:
+	}
+
+	if a.queued.Add(1) > a.maxQueue {
+		a.queued.Add(-1)
+		return "admission_queue_full"
+	}
+	a.report()
+	defer func() {
+		a.queued.Add(-1)
+		a.report()
+	}()
+
+	var expired <-chan time.Time
+	if a.wait > 0 {
+		t := time.NewTimer(a.wait)
+		defer t.Stop()
+		expired = t.C
+	}
+	select {
+	case a.slots <- struct{}{}:
+		return ""
+	case <-r.Context().Done():
+		return "admission_canceled"
+	case <-expired:
+		return "admission_wait"
+	}
+}
+
+// retryAfter is the queue wait rounded up to seconds, at least one
+func (a *admission) retryAfter() string {
+	return strconv.Itoa(max(int(math.Ceil(a.wait.Seconds())), 1))
+}
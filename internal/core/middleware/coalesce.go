@@ -0,0 +1,211 @@
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/problem"
+)
+
+// Coalesce shares one handler run between identical concurrent GET requests.
+// Requests are identical when method, path, query (order-insensitive) and the
+// vary headers match; Cache-Control/Pragma no-cache requests always run alone.
+// The first request streams as usual while its response is buffered and
+// replayed to requests that arrived while it was in flight, unless it timed
+// out or was canceled, in which case a waiter runs it again. Only headers the
+// handler wrote are replayed; what outer middleware such as CORS set stays the
+// waiter's own. shared, when non-nil, is called for every replayed response
+// so waiters still count in metrics and hotness.
+func Coalesce(vary []string, shared func(r *http.Request, status int, elapsed time.Duration)) func(http.Handler) http.Handler {
+	c := newCoalescer(vary)
+	c.shared = shared
+	return c.wrap
+}
+
+type coalescedResponse struct {
+	done   chan struct{}
+	status int
+	// header holds only what the handler wrote, without what outer
+	// middleware had set for the leader
+	header http.Header
+	body   bytes.Buffer
+	ok     bool
+	// retry is set when the leader's answer came from its own deadline or
+	// cancellation (408, 504), which waiters may not share
+	retry bool
+	dups  int
+}
+
+type coalescer struct {
+	vary   []string
+	shared func(r *http.Request, status int, elapsed time.Duration)
+	mu     sync.Mutex
+	calls  map[string]*coalescedResponse
+}
+
+func newCoalescer(vary []string) *coalescer {
+	vs := make([]string, 0, len(vary))
+	for _, h := range vary {
+		if h = strings.TrimSpace(h); h != "" {
+			vs = append(vs, http.CanonicalHeaderKey(h))
+		}
+	}
+	sort.Strings(vs)
+	return &coalescer{vary: vs, calls: make(map[string]*coalescedResponse)}
+}
+
+// signature canonicalizes the parts of r that can change the response
+func (c *coalescer) signature(r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(r.Method)
+	b.WriteByte(' ')
+	b.WriteString(r.URL.Path)
+	b.WriteByte('?')
+	b.WriteString(r.URL.Query().Encode())
+	for _, h := range c.vary {
+		b.WriteByte('\n')
+		b.WriteString(h)
+		b.WriteByte(':')
+		b.WriteString(strings.Join(r.Header.Values(h), ","))
+	}
+	return b.String()
+}
+
+func noCache(r *http.Request) bool {
+	for _, v := range r.Header.Values("Cache-Control") {
+		for d := range strings.SplitSeq(v, ",") {
+			if d = strings.ToLower(strings.TrimSpace(d)); d == "no-cache" || d == "no-store" {
+				return true
+			}
+		}
+	}
+	return strings.EqualFold(strings.TrimSpace(r.Header.Get("Pragma")), "no-cache")
+}
+
+// waiting reports requests currently parked behind an in-flight leader
+func (c *coalescer) waiting() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, call := range c.calls {
+		n += call.dups
+	}
+	return n
+}
+
+func (c *coalescer) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || noCache(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		key := c.signature(r)
+
+		for {
+			c.mu.Lock()
+			call, ok := c.calls[key]
+			if !ok {
+				break
+			}
+			call.dups++
+			c.mu.Unlock()
+			select {
+			case <-call.done:
+			case <-r.Context().Done():
+				return
+			}
+			if call.retry {
+				// the leader ran out of its own time; run again, or wait
+				// on whichever waiter got there first
+				continue
+			}
+			if !call.ok {
+				problem.Error(w, r, "coalesced request failed", http.StatusBadGateway)
+				return
+			}
+			for k, v := range call.header {
+				if k == "X-Request-Id" {
+					continue
+				}
+				w.Header()[k] = append(w.Header()[k], v...)
+			}
+			w.WriteHeader(call.status)
+			_, _ = w.Write(call.body.Bytes())
+			if c.shared != nil {
+				c.shared(r, call.status, time.Since(start))
+			}
+			return
+		}
+		call := &coalescedResponse{done: make(chan struct{})}
+		c.calls[key] = call
+		c.mu.Unlock()
+
+		defer func() {
+			c.mu.Lock()
+			delete(c.calls, key)
+			c.mu.Unlock()
+			close(call.done)
+		}()
+
+		tw := &teeWriter{ResponseWriter: w, call: call, pre: w.Header().Clone()}
+		next.ServeHTTP(tw, r)
+		if call.header == nil {
+			tw.WriteHeader(http.StatusOK)
+		}
+		call.ok = true
+		call.retry = r.Context().Err() != nil ||
+			call.status == http.StatusRequestTimeout || call.status == http.StatusGatewayTimeout
+	})
+}
+
+// teeWriter streams to the leader's client while keeping a copy for waiters
+type teeWriter struct {
+	http.ResponseWriter
+	call *coalescedResponse
+	pre  http.Header
+}
+
+// WriteHeader records the headers the handler added on top of pre, the ones
+// outer middleware had already set for the leader
+func (t *teeWriter) WriteHeader(code int) {
+	if t.call.header == nil {
+		t.call.status = code
+		t.call.header = make(http.Header)
+		for k, v := range t.Header() {
+			if before, ok := t.pre[k]; ok {
+				if len(v) < len(before) {
+					continue
+				}
+				v = v[len(before):]
+			}
+			if len(v) > 0 {
+				t.call.header[k] = append([]string(nil), v...)
+			}
+		}
+	}
+	t.ResponseWriter.WriteHeader(code)
+}
+
+func (t *teeWriter) Write(p []byte) (int, error) {
+	if t.call.header == nil {
+		t.WriteHeader(http.StatusOK)
+	}
+	t.call.body.Write(p)
+	n, err := t.ResponseWriter.Write(p)
+	if err != nil {
+		return n, fmt.Errorf("write response: %w", err)
+	}
+	return n, nil
+}
+
+func (t *teeWriter) Flush() {
+	if f, ok := t.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -4,6 +4,7 @@ package middleware
 import (
 	"log/slog"
 	"net/http"
+	"strings"
 
 	mylog "github.com/mohammed-shakir/h3-spatial-cache/internal/logger"
 )
@@ -17,6 +18,7 @@ func Logging(l *slog.Logger) func(http.Handler) http.Handler {
 				w.Header().Set("X-Request-ID", reqID)
 			}
 			ctx := mylog.WithRequestID(r.Context(), reqID)
+			ctx = mylog.WithTraceID(ctx, traceIDFromParent(r.Header.Get("traceparent")))
 			ctx = mylog.WithComponent(ctx, "http")
 			l.LogAttrs(ctx, slog.LevelDebug, "http request",
 				slog.String("method", r.Method),
@@ -28,6 +30,21 @@ func Logging(l *slog.Logger) func(http.Handler) http.Handler {
 	}
 }
 
+// traceIDFromParent returns the trace id of a W3C traceparent header
+// ("00-<32 hex trace id>-<16 hex parent id>-<2 hex flags>"), or "" when the
+// header is missing or malformed
+func traceIDFromParent(h string) string {
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 {
+		return ""
+	}
+	id := strings.ToLower(parts[1])
+	if strings.Trim(id, "0123456789abcdef") != "" || strings.Trim(id, "0") == "" {
+		return ""
+	}
+	return id
+}
+
 // Recover basic panic recovery middleware
 func Recover() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -44,14 +61,51 @@ func Recover() func(http.Handler) http.Handler {
 	}
 }
 
-// CORS minimal cors placeholder
-func CORS() func(http.Handler) http.Handler {
+// CORS allows browser clients from the given origins; "*" allows any origin
+// and an empty allowlist disables the middleware
+func CORS(allowed []string) func(http.Handler) http.Handler {
+	anyOrigin := false
+	set := make(map[string]struct{}, len(allowed))
+	for _, o := range allowed {
+		o = strings.TrimRight(strings.TrimSpace(o), "/")
+		if o == "*" {
+			anyOrigin = true
+			continue
+		}
+		if o != "" {
+			set[strings.ToLower(o)] = struct{}{}
+		}
+	}
+
 	return func(next http.Handler) http.Handler {
+		if !anyOrigin && len(set) == 0 {
+			return next
+		}
 		fn := func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-			if r.Method == http.MethodOptions {
-				w.Header().Set("Access-Control-Allow-Methods", "GET,OPTIONS")
-				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Add("Vary", "Origin")
+
+			_, ok := set[strings.ToLower(origin)]
+			if !ok && !anyOrigin {
+				if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Add("Vary", "Access-Control-Request-Method")
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Authorization")
+				w.Header().Set("Access-Control-Max-Age", "600")
 				w.WriteHeader(http.StatusNoContent)
 				return
 			}
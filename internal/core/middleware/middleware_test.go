@@ -0,0 +1,380 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func corsTarget() http.Handler {
+	return CORS([]string{"https://maps.example.com"})(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func TestCORS_AllowedOrigin(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/query", nil)
+	req.Header.Set("Origin", "https://maps.example.com")
+	rr := httptest.NewRecorder()
+	corsTarget().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d want 200", rr.Code)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "https://maps.example.com" {
+		t.Fatalf("Allow-Origin=%q", got)
+	}
+	if got := rr.Header().Get("Vary"); got != "Origin" {
+		t.Fatalf("Vary=%q want Origin", got)
+	}
+}
+
+func TestCORS_DisallowedOrigin(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/query", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	rr := httptest.NewRecorder()
+	corsTarget().ServeHTTP(rr, req)
+
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Fatalf("Allow-Origin=%q want empty", got)
+	}
+
+	pre := httptest.NewRequest(http.MethodOptions, "/query", nil)
+	pre.Header.Set("Origin", "https://evil.example.com")
+	pre.Header.Set("Access-Control-Request-Method", "GET")
+	rr = httptest.NewRecorder()
+	corsTarget().ServeHTTP(rr, pre)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("preflight status=%d want 403", rr.Code)
+	}
+}
+
+func TestCORS_Preflight(t *testing.T) {
+	req := httptest.NewRequest(http.MethodOptions, "/query", nil)
+	req.Header.Set("Origin", "https://maps.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "Content-Type")
+	rr := httptest.NewRecorder()
+	corsTarget().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("status=%d want 204", rr.Code)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Methods"); got != "GET, POST, OPTIONS" {
+		t.Fatalf("Allow-Methods=%q", got)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Headers"); got != "Accept, Content-Type, Authorization" {
+		t.Fatalf("Allow-Headers=%q", got)
+	}
+}
+
+func TestCORS_DisabledByDefault(t *testing.T) {
+	h := CORS(nil)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/query", nil)
+	req.Header.Set("Origin", "https://maps.example.com")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Fatalf("Allow-Origin=%q want empty", got)
+	}
+}
+
+func TestCoalesce_ConcurrentIdenticalRequests_SingleCompose(t *testing.T) {
+	var composes atomic.Int64
+	release := make(chan struct{})
+	c := newCoalescer([]string{"Accept"})
+	h := c.wrap(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		composes.Add(1)
+		<-release
+		w.Header().Set("Content-Type", "application/geo+json")
+		w.Header().Set("X-Cache", "MISS")
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[]}`)
+	}))
+
+	const n = 5
+	var wg sync.WaitGroup
+	recs := make([]*httptest.ResponseRecorder, n)
+	for i := range n {
+		recs[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func(rr *httptest.ResponseRecorder) {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodGet, "/query?layer=roads&bbox=1,2,3,4,EPSG:4326", nil)
+			h.ServeHTTP(rr, req)
+		}(recs[i])
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for c.waiting() != n-1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("waiters=%d want %d", c.waiting(), n-1)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if got := composes.Load(); got != 1 {
+		t.Fatalf("composes=%d want 1", got)
+	}
+	for i, rr := range recs {
+		if rr.Code != http.StatusOK || rr.Body.String() != `{"type":"FeatureCollection","features":[]}` {
+			t.Fatalf("recorder %d: status=%d body=%q", i, rr.Code, rr.Body.String())
+		}
+		if rr.Header().Get("X-Cache") != "MISS" || rr.Header().Get("Content-Type") != "application/geo+json" {
+			t.Fatalf("recorder %d: headers not replayed: %v", i, rr.Header())
+		}
+	}
+}
+
+func TestCoalesce_WaitersKeepTheirOwnCORSHeadersAndAreObserved(t *testing.T) {
+	release := make(chan struct{})
+	var shared atomic.Int64
+	c := newCoalescer([]string{"Accept"})
+	c.shared = func(_ *http.Request, status int, _ time.Duration) {
+		if status == http.StatusOK {
+			shared.Add(1)
+		}
+	}
+	h := CORS([]string{"https://a.example.com", "https://b.example.com"})(c.wrap(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		<-release
+		w.Header().Add("Vary", "Accept")
+		w.Header().Set("X-Cache", "HIT")
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	origins := []string{"https://a.example.com", "https://b.example.com", ""}
+	recs := make([]*httptest.ResponseRecorder, len(origins))
+	var wg sync.WaitGroup
+	for i, origin := range origins {
+		recs[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func(rr *httptest.ResponseRecorder) {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodGet, "/query?layer=roads", nil)
+			if origin != "" {
+				req.Header.Set("Origin", origin)
+			}
+			h.ServeHTTP(rr, req)
+		}(recs[i])
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for c.waiting() != len(origins)-1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("waiters=%d want %d", c.waiting(), len(origins)-1)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	for i, rr := range recs {
+		if got := rr.Header().Get("Access-Control-Allow-Origin"); got != origins[i] {
+			t.Fatalf("recorder %d: Allow-Origin=%q want %q", i, got, origins[i])
+		}
+		wantVary := []string{"Origin", "Accept"}
+		if origins[i] == "" {
+			wantVary = []string{"Accept"}
+		}
+		if got := rr.Header().Values("Vary"); strings.Join(got, ",") != strings.Join(wantVary, ",") {
+			t.Fatalf("recorder %d: Vary=%v want %v", i, got, wantVary)
+		}
+		if rr.Header().Get("X-Cache") != "HIT" {
+			t.Fatalf("recorder %d: handler headers not replayed: %v", i, rr.Header())
+		}
+	}
+	if got := shared.Load(); got != int64(len(origins)-1) {
+		t.Fatalf("shared observed %d waiters, want %d", got, len(origins)-1)
+	}
+}
+
+func TestCoalesce_LeaderTimeoutIsNotReplayed(t *testing.T) {
+	var runs atomic.Int64
+	release := make(chan struct{})
+	c := newCoalescer([]string{"Accept", "X-Request-Timeout"})
+	h := c.wrap(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if runs.Add(1) == 1 {
+			<-release
+			http.Error(w, "query timed out", http.StatusGatewayTimeout)
+			return
+		}
+		// the waiter that took over holds the rerun until the other joins it
+		for deadline := time.Now().Add(2 * time.Second); c.waiting() < 1 && time.Now().Before(deadline); {
+			time.Sleep(time.Millisecond)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	const n = 3
+	var wg sync.WaitGroup
+	recs := make([]*httptest.ResponseRecorder, n)
+	for i := range n {
+		recs[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func(rr *httptest.ResponseRecorder) {
+			defer wg.Done()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/query?layer=roads", nil))
+		}(recs[i])
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for c.waiting() != n-1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("waiters=%d want %d", c.waiting(), n-1)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	timeouts := 0
+	for _, rr := range recs {
+		if rr.Code == http.StatusGatewayTimeout {
+			timeouts++
+		}
+	}
+	if timeouts != 1 || runs.Load() != 2 {
+		t.Fatalf("timeouts=%d runs=%d: only the leader should see its 504, one waiter should rerun", timeouts, runs.Load())
+	}
+
+	a := httptest.NewRequest(http.MethodGet, "/query?layer=roads", nil)
+	b := httptest.NewRequest(http.MethodGet, "/query?layer=roads", nil)
+	b.Header.Set("X-Request-Timeout", "30s")
+	if c.signature(a) == c.signature(b) {
+		t.Fatalf("X-Request-Timeout should be part of the signature")
+	}
+}
+
+func TestCoalesce_NoCacheAndDistinctRequestsBypass(t *testing.T) {
+	var composes atomic.Int64
+	c := newCoalescer([]string{"Accept"})
+	h := c.wrap(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		composes.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/query?layer=roads", nil)
+	req.Header.Set("Cache-Control", "no-cache")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if len(c.calls) != 0 || composes.Load() != 1 {
+		t.Fatalf("no-cache request should bypass coalescing")
+	}
+
+	a := httptest.NewRequest(http.MethodGet, "/query?layer=roads&bbox=1,2,3,4", nil)
+	b := httptest.NewRequest(http.MethodGet, "/query?bbox=1,2,3,4&layer=roads", nil)
+	b.Header.Set("Accept", "application/gml+xml")
+	if c.signature(a) == c.signature(b) {
+		t.Fatalf("Accept should be part of the signature")
+	}
+	b.Header.Del("Accept")
+	if c.signature(a) != c.signature(b) {
+		t.Fatalf("query parameter order should not change the signature")
+	}
+}
+
+func TestTraceIDFromParent(t *testing.T) {
+	cases := map[string]string{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01": "4bf92f3577b34da6a3ce929d0e0e4736",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01": "4bf92f3577b34da6a3ce929d0e0e4736",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01": "",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01": "",
+		"00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01": "",
+		"00-4bf92f35-00f067aa0ba902b7-01":                         "",
+		"":                                                        "",
+	}
+	for in, want := range cases {
+		if got := traceIDFromParent(in); got != want {
+			t.Errorf("traceIDFromParent(%q)=%q want %q", in, got, want)
+		}
+	}
+}
+
+func TestAdmit_CapsInFlightAndShedsExcess(t *testing.T) {
+	var running, peak atomic.Int64
+	release := make(chan struct{})
+	a := newAdmission(2, 1, time.Minute)
+	h := a.wrap(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		n := running.Add(1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		<-release
+		running.Add(-1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func(rr *httptest.ResponseRecorder, wg *sync.WaitGroup) {
+		defer wg.Done()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/query?layer=roads", nil))
+	}
+	waitFor := func(what string, ok func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !ok() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// two run, one queues
+	var wg sync.WaitGroup
+	recs := make([]*httptest.ResponseRecorder, 3)
+	for i := range recs {
+		recs[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go serve(recs[i], &wg)
+	}
+	waitFor("2 running, 1 queued", func() bool { return running.Load() == 2 && a.queued.Load() == 1 })
+
+	// the queue is full, so the next one is shed straight away
+	shed := httptest.NewRecorder()
+	h.ServeHTTP(shed, httptest.NewRequest(http.MethodGet, "/query?layer=roads", nil))
+	if shed.Code != http.StatusServiceUnavailable || shed.Header().Get("Retry-After") != "60" {
+		t.Fatalf("shed: status=%d retry-after=%q", shed.Code, shed.Header().Get("Retry-After"))
+	}
+
+	close(release)
+	wg.Wait()
+	for i, rr := range recs {
+		if rr.Code != http.StatusOK {
+			t.Fatalf("recorder %d: status=%d want 200", i, rr.Code)
+		}
+	}
+	if p := peak.Load(); p != 2 {
+		t.Fatalf("peak in flight=%d want 2", p)
+	}
+	if len(a.slots) != 0 || a.queued.Load() != 0 {
+		t.Fatalf("slots=%d queued=%d after drain", len(a.slots), a.queued.Load())
+	}
+}
+
+func TestAdmit_QueueWaitExpires(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	h := Admit(1, 4, 20*time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		close(started)
+		<-release
+	}))
+	go h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/query", nil))
+	<-started
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/query", nil))
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") != "1" {
+		t.Fatalf("queued past wait: status=%d retry-after=%q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+
+	// a disabled limit passes everything through
+	rr = httptest.NewRecorder()
+	Admit(0, 0, 0)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {})).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/query", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("disabled: status=%d", rr.Code)
+	}
+}
@@ -1,7 +1,10 @@
 // Package model defines core domain types shared across the service.
 package model
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 type BBox struct {
 	X1, Y1 float64
@@ -16,17 +19,57 @@ func (b BBox) String() string {
 
 type Polygon struct {
 	GeoJSON string
+	// Vertices counts positions across all rings, closing vertices included
+	Vertices int
 }
 
 type Cells []string
 
+// SortKey is one sortby entry; TypeHint is "", "number", "time" or "string".
+// Features missing the property sort last unless NullsFirst is set.
+type SortKey struct {
+	Property   string
+	Desc       bool
+	TypeHint   string
+	NullsFirst bool
+}
+
 type QueryRequest struct {
 	Layer   string
 	BBox    *BBox
 	Polygon *Polygon
 	Filters string
+	Sort    []SortKey
 	H3Res   int
 	Cells   Cells
+	// GeomPrecision overrides the dedup precision when > 0
+	GeomPrecision int
+	// CreatedAfter and CreatedBefore bound the feature timestamp; zero is open
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// Headers are client headers passed through to the upstream, keyed by canonical name
+	Headers map[string]string
+	// Provenance asks for the cell and cache status behind each feature
+	Provenance bool
+	// StrictConsistency revalidates a full cache hit against an upstream
+	// count before serving it
+	StrictConsistency bool
+	// GeometryProperty is the layer's geometry column in INTERSECTS filters;
+	// empty means the default "geom"
+	GeometryProperty string
+	// CQLSRID labels the EPSG:4326 coordinates of INTERSECTS literals for
+	// upstreams that read them differently; empty means "4326", "0" drops
+	// the SRID prefix
+	CQLSRID string
+	// Capture asks for the served query to be written out as a fixture
+	Capture bool
+}
+
+// FeatureRequest asks for specific features of a layer by id
+type FeatureRequest struct {
+	Layer   string
+	IDs     []string
+	Headers map[string]string
 }
 
 type Filters string
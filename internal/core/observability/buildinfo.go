@@ -0,0 +1,31 @@
+package observability
+
+import "sync/atomic"
+
+// BuildInfo describes the running binary
+type BuildInfo struct {
+	Version   string
+	Revision  string
+	Branch    string
+	BuildDate string
+}
+
+var buildInfoV atomic.Value
+
+// SetBuildInfo records build metadata for the /version endpoint
+func SetBuildInfo(bi BuildInfo) { buildInfoV.Store(bi) }
+
+// GetBuildInfo returns the recorded build metadata
+func GetBuildInfo() BuildInfo {
+	bi, _ := buildInfoV.Load().(BuildInfo)
+	return bi
+}
+
+// ExposeBuildInfo records version unless SetBuildInfo already provided one
+func ExposeBuildInfo(version string) {
+	bi := GetBuildInfo()
+	if bi.Version == "" {
+		bi.Version = version
+		SetBuildInfo(bi)
+	}
+}
@@ -0,0 +1,49 @@
+package observability
+
+import (
+	"context"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	mylog "github.com/mohammed-shakir/h3-spatial-cache/internal/logger"
+)
+
+// exemplarLabel names the trace id on exemplars, matching what Grafana's
+// exemplar-to-trace links look for
+const exemplarLabel = "trace_id"
+
+var exemplarsOn atomic.Bool
+
+// EnableExemplars turns on exemplars for the latency histograms; they only
+// reach Prometheus when /metrics is served in the OpenMetrics format
+func EnableExemplars(on bool) { exemplarsOn.Store(on) }
+
+// traceID is the id an exemplar is tagged with: the request's trace id, or
+// its request id when it carried no trace context
+func traceID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if id := mylog.TraceID(ctx); id != "" {
+		return id
+	}
+	return mylog.RequestID(ctx)
+}
+
+// observe records v on o, attaching ctx's trace id as an exemplar when
+// exemplars are on
+func observe(ctx context.Context, o prometheus.Observer, v float64) {
+	if exemplarsOn.Load() {
+		// exemplar labels are capped at 128 runes; a client-chosen request id
+		// could be longer, and ObserveWithExemplar panics on invalid labels
+		id := traceID(ctx)
+		if eo, ok := o.(prometheus.ExemplarObserver); ok && id != "" &&
+			utf8.ValidString(id) && utf8.RuneCountInString(exemplarLabel+id) <= prometheus.ExemplarMaxRunes {
+			eo.ObserveWithExemplar(v, prometheus.Labels{exemplarLabel: id})
+			return
+		}
+	}
+	o.Observe(v)
+}
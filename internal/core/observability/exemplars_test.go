@@ -0,0 +1,73 @@
+package observability
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	mylog "github.com/mohammed-shakir/h3-spatial-cache/internal/logger"
+)
+
+// exemplarIDs returns the trace ids on the exemplars of a histogram family
+func exemplarIDs(t *testing.T, r *prometheus.Registry, name string) []string {
+	t.Helper()
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	var ids []string
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, b := range m.GetHistogram().GetBucket() {
+				for _, lp := range b.GetExemplar().GetLabel() {
+					if lp.GetName() == exemplarLabel {
+						ids = append(ids, lp.GetValue())
+					}
+				}
+			}
+		}
+	}
+	return ids
+}
+
+func TestExemplars_AttachTraceID(t *testing.T) {
+	r := prometheus.NewRegistry()
+	Init(r, true)
+	SetScenario("cache")
+	t.Cleanup(func() { EnableExemplars(false) })
+
+	ctx := mylog.WithRequestID(context.Background(), "req-1")
+	traced := mylog.WithTraceID(ctx, "4bf92f3577b34da6a3ce929d0e0e4736")
+
+	// off: plain observations
+	ObserveSpatialResponse(traced, "full_hit", "geojson", 0.012)
+	if ids := exemplarIDs(t, r, "spatial_response_duration_seconds"); len(ids) != 0 {
+		t.Fatalf("exemplars %v with exemplars disabled", ids)
+	}
+
+	EnableExemplars(true)
+	ObserveSpatialResponse(traced, "full_hit", "geojson", 0.012)
+	if ids := exemplarIDs(t, r, "spatial_response_duration_seconds"); len(ids) != 1 || ids[0] != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("response exemplars=%v want the trace id", ids)
+	}
+
+	// without trace context the request id stands in
+	ObserveUpstreamLatency(ctx, "geoserver_cell", 0.2)
+	if ids := exemplarIDs(t, r, "upstream_latency_seconds"); len(ids) != 1 || ids[0] != "req-1" {
+		t.Fatalf("upstream exemplars=%v want the request id", ids)
+	}
+
+	// an id too long for an exemplar is dropped rather than panicking
+	long := mylog.WithRequestID(context.Background(), strings.Repeat("x", 200))
+	ObserveUpstreamLatency(long, "geoserver_features", 0.2)
+	for _, id := range exemplarIDs(t, r, "upstream_latency_seconds") {
+		if len(id) > 128 {
+			t.Fatalf("oversized exemplar id recorded")
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package observability
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HitRatioRefresh is how often StartHitRatioUpdater recomputes spatial_hit_ratio
+const HitRatioRefresh = 5 * time.Second
+
+type hitMiss struct {
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// in-process mirror of spatial_cache_{hits,misses}_total, keyed by scenario
+var hitMissByScenario sync.Map
+
+func hitMissFor(scenario string) *hitMiss {
+	v, ok := hitMissByScenario.Load(scenario)
+	if !ok {
+		v, _ = hitMissByScenario.LoadOrStore(scenario, &hitMiss{})
+	}
+	hm, _ := v.(*hitMiss)
+	return hm
+}
+
+func resetHitRatio() {
+	hitMissByScenario.Clear()
+}
+
+// RefreshHitRatio sets spatial_hit_ratio for every scenario that has recorded
+// a hit or a miss; scenarios with no lookups yet are left unset
+func RefreshHitRatio() {
+	if !enabled.Load() || spatialHitRatio == nil {
+		return
+	}
+	hitMissByScenario.Range(func(k, v any) bool {
+		scenario, _ := k.(string)
+		hm, _ := v.(*hitMiss)
+		hits, misses := hm.hits.Load(), hm.misses.Load()
+		if total := hits + misses; total > 0 {
+			spatialHitRatio.WithLabelValues(scenario).Set(float64(hits) / float64(total))
+		}
+		return true
+	})
+}
+
+// StartHitRatioUpdater refreshes spatial_hit_ratio every interval until ctx is done
+func StartHitRatioUpdater(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = HitRatioRefresh
+	}
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				RefreshHitRatio()
+			}
+		}
+	}()
+}
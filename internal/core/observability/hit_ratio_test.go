@@ -0,0 +1,38 @@
+package observability
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestHitRatioGauge_TracksCounters(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	Init(reg, true)
+	SetScenario("cache")
+	t.Cleanup(func() { SetScenario("baseline") })
+
+	AddCacheHits(3)
+	AddCacheMisses(1)
+	RefreshHitRatio()
+	if got := testutil.ToFloat64(spatialHitRatio.WithLabelValues("cache")); got != 0.75 {
+		t.Fatalf("hit ratio=%v want 0.75", got)
+	}
+
+	// the gauge only moves on refresh, then follows the counters
+	AddCacheMisses(4)
+	if got := testutil.ToFloat64(spatialHitRatio.WithLabelValues("cache")); got != 0.75 {
+		t.Fatalf("hit ratio before refresh=%v want 0.75", got)
+	}
+	RefreshHitRatio()
+	if got := testutil.ToFloat64(spatialHitRatio.WithLabelValues("cache")); got != 3.0/8 {
+		t.Fatalf("hit ratio=%v want %v", got, 3.0/8)
+	}
+
+	hits := testutil.ToFloat64(spatialCacheHitsTotal.WithLabelValues("cache"))
+	misses := testutil.ToFloat64(spatialCacheMissesTotal.WithLabelValues("cache"))
+	if hits != 3 || misses != 5 {
+		t.Fatalf("raw counters hits=%v misses=%v want 3 and 5", hits, misses)
+	}
+}
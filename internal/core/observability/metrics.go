@@ -23,9 +23,11 @@ func Init(r prometheus.Registerer, isEnabled bool) {
 		scenarioV.Store("baseline")
 	}
 	if !isEnabled || r == nil {
+		setSnapshotSource(nil)
 		return
 	}
 	initCollectors(r)
+	setSnapshotSource(r)
 }
 
 func Enabled() bool { return enabled.Load() }
@@ -72,6 +74,27 @@ var (
 	adaptiveDecisionsTotal         *prometheus.CounterVec
 	hotnessValueGauge              *prometheus.GaugeVec
 	spatialHitsTotal               *prometheus.CounterVec
+	upstreamErrorsTotal            *prometheus.CounterVec
+	spatialCellsRequestedTotal     *prometheus.CounterVec
+	spatialEmptyCellsTotal         *prometheus.CounterVec
+	spatialEmptyMarkerKeys         prometheus.Gauge
+	upstreamSemSaturation          prometheus.Gauge
+	upstreamSemWaitsTotal          prometheus.Counter
+	fillQueueRejectsTotal          prometheus.Counter
+	upstreamPoolConns              *prometheus.GaugeVec
+	orphanFeaturesDeletedTotal     prometheus.Counter
+	invalidUTF8FeaturesTotal       prometheus.Counter
+	spatialHitRatio                *prometheus.GaugeVec
+	queryRejectsTotal              *prometheus.CounterVec
+	queryAdmission                 *prometheus.GaugeVec
+	conditionalFetchTotal          *prometheus.CounterVec
+	sridMismatchTotal              *prometheus.CounterVec
+	shadowResponseTotal            *prometheus.CounterVec
+	shadowResponseDuration         *prometheus.HistogramVec
+	shadowDroppedTotal             *prometheus.CounterVec
+	consistencyChecksTotal         *prometheus.CounterVec
+	layerResChangesTotal           *prometheus.CounterVec
+	layerResolution                *prometheus.GaugeVec
 )
 
 var lastLayerInvalidationTS sync.Map
@@ -96,7 +119,7 @@ func initCollectors(r prometheus.Registerer) {
 	spatialInvalidationTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "spatial_invalidation_total",
-			Help: "Invalidations by source (ttl|kafka) and action (delete|skip_version).",
+			Help: "Invalidations by source (ttl|kafka) and action (delete|skip_version|mark_stale).",
 		},
 		[]string{"source", "action"},
 	)
@@ -133,6 +156,10 @@ func initCollectors(r prometheus.Registerer) {
 		prometheus.HistogramOpts{Name: "spatial_response_duration_seconds", Help: "End-to-end latency to compose a spatial response (seconds).", Buckets: prometheus.ExponentialBuckets(0.005, 2, 12)},
 		[]string{"scenario", "hit_class"},
 	)
+	upstreamErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{Name: "upstream_errors_total", Help: "Upstream request failures by upstream and error kind (timeout, conn_refused, dns, 4xx, 5xx, other)."},
+		[]string{"upstream", "kind"},
+	)
 	spatialAggregationErrorsTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{Name: "spatial_aggregation_errors_total", Help: "Count of errors in the spatial aggregation/composition pipeline by stage."},
 		[]string{"stage"},
@@ -195,6 +222,93 @@ func initCollectors(r prometheus.Registerer) {
 		[]string{"scenario", "layer", "lon", "lat"},
 	)
 
+	spatialCellsRequestedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{Name: "spatial_cells_requested_total", Help: "H3 cells looked up in the cell index by the feature-centric path."},
+		[]string{"scenario", "layer"},
+	)
+	spatialEmptyCellsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{Name: "spatial_empty_cells_total", Help: "H3 cells served from an empty marker (known to have no features)."},
+		[]string{"scenario", "layer"},
+	)
+	spatialEmptyMarkerKeys = prometheus.NewGauge(
+		prometheus.GaugeOpts{Name: "spatial_empty_marker_keys", Help: "Estimated number of empty-marker cell index keys (SCAN sampled)."},
+	)
+
+	upstreamSemSaturation = prometheus.NewGauge(
+		prometheus.GaugeOpts{Name: "upstream_semaphore_saturation", Help: "Fraction of the process-wide upstream concurrency limit in use (0-1)."},
+	)
+	upstreamSemWaitsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{Name: "upstream_semaphore_waits_total", Help: "Upstream calls that had to wait for a free slot in the concurrency limit."},
+	)
+
+	fillQueueRejectsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{Name: "spatial_fill_queue_rejects_total", Help: "Queries answered 503 because the cell fill queue stayed full past CACHE_FILL_QUEUE_WAIT."},
+	)
+
+	consistencyChecksTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{Name: "spatial_consistency_checks_total", Help: "consistency=strict full hits revalidated against an upstream count, by result (match, mismatch, error)."},
+		[]string{"result"},
+	)
+	layerResChangesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{Name: "spatial_layer_res_changes_total", Help: "Layer base-resolution changes suggested by the layer analyzer, by direction (finer, coarser) and whether they were applied."},
+		[]string{"layer", "direction", "applied"},
+	)
+	layerResolution = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{Name: "spatial_layer_resolution", Help: "Base H3 resolution the layer analyzer last applied per layer."},
+		[]string{"layer"},
+	)
+
+	upstreamPoolConns = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{Name: "upstream_pool_conns", Help: "Outbound upstream connections by state (idle, in_use), sampled periodically."},
+		[]string{"state"},
+	)
+
+	orphanFeaturesDeletedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{Name: "spatial_orphan_features_deleted_total", Help: "Feature keys deleted by the orphan janitor because no cell index referenced them."},
+	)
+
+	invalidUTF8FeaturesTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{Name: "spatial_invalid_utf8_features_total", Help: "Upstream features with invalid UTF-8, repaired with U+FFFD before caching."},
+	)
+
+	spatialHitRatio = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{Name: "spatial_hit_ratio", Help: "Cache hits over hits plus misses since start, refreshed periodically from the hit/miss counters."},
+		[]string{"scenario"},
+	)
+	resetHitRatio()
+
+	queryRejectsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{Name: "spatial_query_rejects_total", Help: "Queries rejected by router limits before reaching the scenario, by reason."},
+		[]string{"reason"},
+	)
+	queryAdmission = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{Name: "spatial_query_admission", Help: "Queries admitted and running (in_flight) or waiting for a slot (queued) under HTTP_MAX_CONCURRENT."},
+		[]string{"state"},
+	)
+
+	conditionalFetchTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{Name: "spatial_conditional_fetch_total", Help: "Cell refetches sent with stored upstream validators, by result (not_modified, modified, evicted)."},
+		[]string{"result"},
+	)
+
+	sridMismatchTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{Name: "spatial_srid_mismatch_suspected_total", Help: "Runs of empty cell fetches whose bbox still held features, suggesting the layer's CRS doesn't match the CQL SRID."},
+		[]string{"layer"},
+	)
+
+	shadowResponseTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{Name: "spatial_shadow_response_total", Help: "Queries replayed through the shadow engine by shadow name and hit class."},
+		[]string{"shadow", "hit_class"},
+	)
+	shadowResponseDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{Name: "spatial_shadow_response_duration_seconds", Help: "Shadow engine latency per replayed query (seconds).", Buckets: prometheus.ExponentialBuckets(0.005, 2, 12)},
+		[]string{"shadow", "hit_class"},
+	)
+	shadowDroppedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{Name: "spatial_shadow_dropped_total", Help: "Queries not replayed because the shadow engine was at its in-flight limit."},
+		[]string{"shadow"},
+	)
+
 	// register all
 	r.MustRegister(
 		spatialReadsTotal, spatialInvalidationTotal, spatialFreshRejectsTotal, invalidationLagSeconds,
@@ -207,11 +321,18 @@ func initCollectors(r prometheus.Registerer) {
 		kafkaConsumerErrorsTotal,
 		adaptiveDecisionsTotal, hotnessValueGauge,
 		spatialHitsTotal,
+		upstreamErrorsTotal,
+		spatialCellsRequestedTotal, spatialEmptyCellsTotal, spatialEmptyMarkerKeys,
+		upstreamSemSaturation, upstreamSemWaitsTotal, fillQueueRejectsTotal, upstreamPoolConns,
+		orphanFeaturesDeletedTotal, invalidUTF8FeaturesTotal,
+		spatialHitRatio,
+		queryRejectsTotal, queryAdmission, conditionalFetchTotal, sridMismatchTotal,
+		shadowResponseTotal, shadowResponseDuration, shadowDroppedTotal,
+		consistencyChecksTotal,
+		layerResChangesTotal, layerResolution,
 	)
 }
 
-func ExposeBuildInfo(_ string) {}
-
 // ObserveHTTP HTTP request metric
 func ObserveHTTP(method, route string, status int, durationSeconds float64) {
 	if !enabled.Load() || httpRequestsTotal == nil {
@@ -223,11 +344,15 @@ func ObserveHTTP(method, route string, status int, durationSeconds float64) {
 	httpRequestDurationSeconds.WithLabelValues(method, route, st, s).Observe(durationSeconds)
 }
 
-func ObserveUpstreamLatency(upstream string, durationSeconds float64) {
-	if !enabled.Load() || upstreamLatencySeconds == nil {
+// ObserveUpstreamLatency records one upstream call; ctx supplies the exemplar
+// trace id
+// ObserveUpstreamLatency records one upstream call; shadow replays are left
+// out so they can't skew the primary's upstream view
+func ObserveUpstreamLatency(ctx context.Context, upstream string, durationSeconds float64) {
+	if !enabled.Load() || upstreamLatencySeconds == nil || IsShadow(ctx) {
 		return
 	}
-	upstreamLatencySeconds.WithLabelValues(upstream, getScenario()).Observe(durationSeconds)
+	observe(ctx, upstreamLatencySeconds.WithLabelValues(upstream, getScenario()), durationSeconds)
 }
 
 func IncDecision(outcome string) {
@@ -280,13 +405,27 @@ func ObserveInvalidation(op, layer string, keys int, dur time.Duration, err erro
 	invLatency.WithLabelValues(op, layer).Observe(dur.Seconds())
 }
 
-func ObserveSpatialResponse(hitClass, format string, durSeconds float64) {
+// ObserveSpatialResponse records one composed response; ctx supplies the
+// exemplar trace id
+func ObserveSpatialResponse(ctx context.Context, hitClass, format string, durSeconds float64) {
 	if !enabled.Load() || spatialResponseTotal == nil {
 		return
 	}
 	s := getScenario()
 	spatialResponseTotal.WithLabelValues(hitClass, format, s).Inc()
-	spatialResponseDurationSeconds.WithLabelValues(s, hitClass).Observe(durSeconds)
+	observe(ctx, spatialResponseDurationSeconds.WithLabelValues(s, hitClass), durSeconds)
+}
+
+// IncUpstreamError counts a failed upstream call; like ObserveUpstreamLatency
+// it skips shadow replays
+func IncUpstreamError(ctx context.Context, upstream, kind string) {
+	if !enabled.Load() || upstreamErrorsTotal == nil || IsShadow(ctx) {
+		return
+	}
+	if kind == "" {
+		kind = UpstreamErrOther
+	}
+	upstreamErrorsTotal.WithLabelValues(upstream, kind).Inc()
 }
 
 func IncSpatialAggError(stage string) {
@@ -303,14 +442,18 @@ func AddCacheHits(n int) {
 	if !enabled.Load() || spatialCacheHitsTotal == nil || n <= 0 {
 		return
 	}
-	spatialCacheHitsTotal.WithLabelValues(getScenario()).Add(float64(n))
+	s := getScenario()
+	spatialCacheHitsTotal.WithLabelValues(s).Add(float64(n))
+	hitMissFor(s).hits.Add(uint64(n))
 }
 
 func AddCacheMisses(n int) {
 	if !enabled.Load() || spatialCacheMissesTotal == nil || n <= 0 {
 		return
 	}
-	spatialCacheMissesTotal.WithLabelValues(getScenario()).Add(float64(n))
+	s := getScenario()
+	spatialCacheMissesTotal.WithLabelValues(s).Add(float64(n))
+	hitMissFor(s).misses.Add(uint64(n))
 }
 
 func SetHotKeysGauge(tier string, n int) {
@@ -323,6 +466,129 @@ func SetHotKeysGauge(tier string, n int) {
 	spatialCacheHotKeys.WithLabelValues(getScenario(), tier).Set(float64(n))
 }
 
+// ObserveCellLookup records cells looked up and how many hit an empty marker
+func ObserveCellLookup(layer string, requested, empty int) {
+	if !enabled.Load() || spatialCellsRequestedTotal == nil || spatialEmptyCellsTotal == nil {
+		return
+	}
+	s := getScenario()
+	spatialCellsRequestedTotal.WithLabelValues(s, layer).Add(float64(requested))
+	if empty > 0 {
+		spatialEmptyCellsTotal.WithLabelValues(s, layer).Add(float64(empty))
+	}
+}
+
+func SetEmptyMarkerKeys(n int64) {
+	if !enabled.Load() || spatialEmptyMarkerKeys == nil {
+		return
+	}
+	spatialEmptyMarkerKeys.Set(float64(n))
+}
+
+// SetUpstreamSaturation records the in-use fraction of the upstream concurrency limit
+func SetUpstreamSaturation(ratio float64) {
+	if !enabled.Load() || upstreamSemSaturation == nil {
+		return
+	}
+	upstreamSemSaturation.Set(ratio)
+}
+
+// SetUpstreamPool records the sampled idle and in-use outbound connections
+func SetUpstreamPool(idle, inUse int) {
+	if !enabled.Load() || upstreamPoolConns == nil {
+		return
+	}
+	upstreamPoolConns.WithLabelValues("idle").Set(float64(idle))
+	upstreamPoolConns.WithLabelValues("in_use").Set(float64(inUse))
+}
+
+// IncUpstreamSemaphoreWait counts an upstream call that blocked on the concurrency limit
+func IncUpstreamSemaphoreWait() {
+	if !enabled.Load() || upstreamSemWaitsTotal == nil {
+		return
+	}
+	upstreamSemWaitsTotal.Inc()
+}
+
+// IncFillQueueReject counts a query turned away because the fill queue was saturated
+func IncFillQueueReject() {
+	if !enabled.Load() || fillQueueRejectsTotal == nil {
+		return
+	}
+	fillQueueRejectsTotal.Inc()
+}
+
+// IncQueryReject counts a query refused by a router limit (e.g. "polygon_vertices")
+func IncQueryReject(reason string) {
+	if !enabled.Load() || queryRejectsTotal == nil {
+		return
+	}
+	queryRejectsTotal.WithLabelValues(reason).Inc()
+}
+
+// SetQueryAdmission records the queries running and waiting under the
+// concurrency cap
+func SetQueryAdmission(inFlight, queued int) {
+	if !enabled.Load() || queryAdmission == nil {
+		return
+	}
+	queryAdmission.WithLabelValues("in_flight").Set(float64(inFlight))
+	queryAdmission.WithLabelValues("queued").Set(float64(queued))
+}
+
+// IncConditionalFetch counts a cell refetch sent with stored validators:
+// "not_modified" was served from cached features, "modified" got a new body
+// and "evicted" got a 304 after the cached features were gone
+func IncConditionalFetch(result string) {
+	if !enabled.Load() || conditionalFetchTotal == nil {
+		return
+	}
+	conditionalFetchTotal.WithLabelValues(result).Inc()
+}
+
+// IncSRIDMismatchSuspected counts a run of empty cells on layer whose bbox
+// the upstream says isn't empty
+func IncSRIDMismatchSuspected(layer string) {
+	if !enabled.Load() || sridMismatchTotal == nil {
+		return
+	}
+	sridMismatchTotal.WithLabelValues(layer).Inc()
+}
+
+// IncConsistencyCheck counts a strict-consistency revalidation by result:
+// "match", "mismatch" or "error"
+func IncConsistencyCheck(result string) {
+	if !enabled.Load() || consistencyChecksTotal == nil {
+		return
+	}
+	consistencyChecksTotal.WithLabelValues(result).Inc()
+}
+
+// IncLayerResChange counts a layer resolution suggestion; direction is
+// "finer" or "coarser"
+func IncLayerResChange(layer, direction string, applied bool) {
+	if !enabled.Load() || layerResChangesTotal == nil {
+		return
+	}
+	layerResChangesTotal.WithLabelValues(layer, direction, strconv.FormatBool(applied)).Inc()
+}
+
+// SetLayerResolution records the base resolution applied to layer
+func SetLayerResolution(layer string, res int) {
+	if !enabled.Load() || layerResolution == nil {
+		return
+	}
+	layerResolution.WithLabelValues(layer).Set(float64(res))
+}
+
+// AddOrphanFeaturesDeleted counts feature keys removed by the orphan janitor
+func AddOrphanFeaturesDeleted(n int) {
+	if !enabled.Load() || orphanFeaturesDeletedTotal == nil || n <= 0 {
+		return
+	}
+	orphanFeaturesDeletedTotal.Add(float64(n))
+}
+
 func IncKafkaConsumerError(kind string) {
 	if !enabled.Load() || kafkaConsumerErrorsTotal == nil {
 		return
@@ -453,3 +719,12 @@ func ObserveSpatialHit(layer string, lon, lat float64) {
 	latStr := strconv.FormatFloat(lat, 'f', 4, 64)
 	spatialHitsTotal.WithLabelValues(getScenario(), layer, lonStr, latStr).Inc()
 }
+
+// IncInvalidUTF8Feature counts an upstream feature repaired by
+// composer.SanitizeUTF8
+func IncInvalidUTF8Feature() {
+	if !enabled.Load() || invalidUTF8FeaturesTotal == nil {
+		return
+	}
+	invalidUTF8FeaturesTotal.Inc()
+}
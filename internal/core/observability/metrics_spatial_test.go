@@ -1,6 +1,7 @@
 package observability
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -14,8 +15,8 @@ func TestSpatialMetrics_RegistrationAndLabels(t *testing.T) {
 	r := prometheus.NewRegistry()
 	Init(r, true)
 	SetScenario("baseline")
-	ObserveSpatialResponse("full_hit", "geojson", 0.012)
-	ObserveSpatialResponse("miss", "geojson", 0.250)
+	ObserveSpatialResponse(context.Background(), "full_hit", "geojson", 0.012)
+	ObserveSpatialResponse(context.Background(), "miss", "geojson", 0.250)
 	IncSpatialAggError("merge")
 
 	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
@@ -0,0 +1,35 @@
+package observability
+
+import "context"
+
+type shadowKey struct{}
+
+// WithShadow marks ctx as a shadow replay. Scenarios skip their per-request
+// metrics for it, so a shadow engine doesn't count against the primary's
+// hit ratio, response histograms or upstream latency and errors
+func WithShadow(ctx context.Context) context.Context {
+	return context.WithValue(ctx, shadowKey{}, true)
+}
+
+// IsShadow reports whether ctx was marked by WithShadow
+func IsShadow(ctx context.Context) bool {
+	v, _ := ctx.Value(shadowKey{}).(bool)
+	return v
+}
+
+// ObserveShadowResponse records one shadow replay
+func ObserveShadowResponse(shadow, hitClass string, durSeconds float64) {
+	if !enabled.Load() || shadowResponseTotal == nil {
+		return
+	}
+	shadowResponseTotal.WithLabelValues(shadow, hitClass).Inc()
+	shadowResponseDuration.WithLabelValues(shadow, hitClass).Observe(durSeconds)
+}
+
+// IncShadowDropped counts a query the shadow engine had no room to replay
+func IncShadowDropped(shadow string) {
+	if !enabled.Load() || shadowDroppedTotal == nil {
+		return
+	}
+	shadowDroppedTotal.WithLabelValues(shadow).Inc()
+}
@@ -0,0 +1,73 @@
+package observability
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// the registry Init registered into, when it can also be gathered
+var (
+	snapshotMu  sync.Mutex
+	snapshotSrc prometheus.Gatherer
+)
+
+func setSnapshotSource(r prometheus.Registerer) {
+	g, _ := r.(prometheus.Gatherer)
+	snapshotMu.Lock()
+	snapshotSrc = g
+	snapshotMu.Unlock()
+}
+
+// Snapshot returns the current value of every sample in the registry passed
+// to Init, so tests can assert on numbers instead of scraping text. Keys read
+// like the exposition format: the bare name, or name{k="v",...} with labels
+// sorted by name. Histograms and summaries contribute name_count and
+// name_sum. It is empty when metrics are disabled or the registry can't be
+// gathered
+func Snapshot() map[string]float64 {
+	snapshotMu.Lock()
+	g := snapshotSrc
+	snapshotMu.Unlock()
+
+	out := map[string]float64{}
+	if g == nil || !enabled.Load() {
+		return out
+	}
+	// a partial gather still carries every family that could be collected
+	mfs, _ := g.Gather()
+	for _, mf := range mfs {
+		name := mf.GetName()
+		for _, m := range mf.GetMetric() {
+			labels := snapshotLabels(m.GetLabel())
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				out[name+labels] = m.GetCounter().GetValue()
+			case dto.MetricType_GAUGE:
+				out[name+labels] = m.GetGauge().GetValue()
+			case dto.MetricType_UNTYPED:
+				out[name+labels] = m.GetUntyped().GetValue()
+			case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+				out[name+"_count"+labels] = float64(m.GetHistogram().GetSampleCount())
+				out[name+"_sum"+labels] = m.GetHistogram().GetSampleSum()
+			case dto.MetricType_SUMMARY:
+				out[name+"_count"+labels] = float64(m.GetSummary().GetSampleCount())
+				out[name+"_sum"+labels] = m.GetSummary().GetSampleSum()
+			}
+		}
+	}
+	return out
+}
+
+func snapshotLabels(pairs []*dto.LabelPair) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	kv := make([]string, 0, len(pairs))
+	for _, p := range pairs {
+		kv = append(kv, p.GetName()+`="`+p.GetValue()+`"`)
+	}
+	return "{" + strings.Join(kv, ",") + "}"
+}
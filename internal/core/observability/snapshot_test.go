@@ -0,0 +1,44 @@
+package observability
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestSnapshot_SpatialReads(t *testing.T) {
+	Init(prometheus.NewRegistry(), true)
+	SetScenario("cache")
+
+	ObserveSpatialRead("hit", true)
+	ObserveSpatialRead("miss", false)
+	ObserveSpatialRead("miss", false)
+	ObserveSpatialResponse(context.Background(), "full_hit", "geojson", 0.25)
+
+	snap := Snapshot()
+	want := map[string]float64{
+		`spatial_reads_total{cache="hit",scenario="cache",stale="true"}`:                 1,
+		`spatial_reads_total{cache="miss",scenario="cache",stale="false"}`:               2,
+		`spatial_response_duration_seconds_count{hit_class="full_hit",scenario="cache"}`: 1,
+		`spatial_response_duration_seconds_sum{hit_class="full_hit",scenario="cache"}`:   0.25,
+	}
+	for k, v := range want {
+		if got, ok := snap[k]; !ok || got != v {
+			t.Fatalf("%s=%v (present=%v) want %v", k, got, ok, v)
+		}
+	}
+	if _, ok := snap[`spatial_reads_total{cache="hit",scenario="cache",stale="false"}`]; ok {
+		t.Fatalf("unrecorded series in snapshot")
+	}
+
+	// a fresh registry starts from zero; disabled metrics snapshot nothing
+	Init(prometheus.NewRegistry(), true)
+	if got := Snapshot()[`spatial_reads_total{cache="hit",scenario="cache",stale="true"}`]; got != 0 {
+		t.Fatalf("new registry carried %v reads over", got)
+	}
+	Init(nil, false)
+	if snap := Snapshot(); len(snap) != 0 {
+		t.Fatalf("disabled snapshot=%v", snap)
+	}
+}
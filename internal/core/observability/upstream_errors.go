@@ -0,0 +1,60 @@
+package observability
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+)
+
+// upstream error kinds used as the "kind" label of upstream_errors_total
+const (
+	UpstreamErrTimeout     = "timeout"
+	UpstreamErrConnRefused = "conn_refused"
+	UpstreamErrDNS         = "dns"
+	UpstreamErr4xx         = "4xx"
+	UpstreamErr5xx         = "5xx"
+	UpstreamErrBadBody     = "bad_body" // 2xx body that isn't a GeoJSON FeatureCollection
+	UpstreamErrOther       = "other"
+)
+
+// ClassifyUpstreamError maps a transport-level error onto an error kind. ctx
+// is the caller's context, not the per-call one: when it is done the client
+// went away or its own deadline (QUERY_TIMEOUT, X-Request-Timeout) ran out,
+// which says nothing about the upstream, so "" is returned and nothing should
+// be counted. A deadline only counts as a timeout when it came from the
+// per-call timeout
+func ClassifyUpstreamError(ctx context.Context, err error) string {
+	if err == nil || (ctx != nil && ctx.Err() != nil) {
+		return ""
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return UpstreamErrDNS
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return UpstreamErrConnRefused
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return UpstreamErrTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return UpstreamErrTimeout
+	}
+	return UpstreamErrOther
+}
+
+// ClassifyUpstreamStatus maps a non-2xx status onto an error kind; "" for success
+func ClassifyUpstreamStatus(code int) string {
+	switch {
+	case code >= 200 && code < 400:
+		return ""
+	case code >= 400 && code < 500:
+		return UpstreamErr4xx
+	case code >= 500:
+		return UpstreamErr5xx
+	default:
+		return UpstreamErrOther
+	}
+}
@@ -0,0 +1,101 @@
+package observability
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string   { return "i/o timeout" }
+func (timeoutErr) Timeout() bool   { return true }
+func (timeoutErr) Temporary() bool { return true }
+
+func TestClassifyUpstreamError(t *testing.T) {
+	wrap := func(err error) error {
+		return &url.Error{Op: "Get", URL: "http://geoserver/wfs", Err: err}
+	}
+	cases := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"nil", nil, ""},
+		{"deadline", wrap(context.DeadlineExceeded), UpstreamErrTimeout},
+		{"net_timeout", wrap(&net.OpError{Op: "read", Net: "tcp", Err: timeoutErr{}}), UpstreamErrTimeout},
+		{"refused", wrap(&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}), UpstreamErrConnRefused},
+		{"dns", wrap(&net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "geoserver", IsNotFound: true}}), UpstreamErrDNS},
+		{"dns_timeout", wrap(&net.DNSError{Err: "timeout", Name: "geoserver", IsTimeout: true}), UpstreamErrDNS},
+		{"other", fmt.Errorf("boom: %w", errors.New("eof")), UpstreamErrOther},
+	}
+	for _, tc := range cases {
+		if got := ClassifyUpstreamError(context.Background(), tc.err); got != tc.want {
+			t.Fatalf("%s: got %q want %q", tc.name, got, tc.want)
+		}
+	}
+
+	// the caller giving up is not an upstream failure, whether it canceled
+	// or ran out of its own (client-picked) deadline
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if got := ClassifyUpstreamError(canceled, wrap(context.Canceled)); got != "" {
+		t.Fatalf("caller canceled: got %q want none", got)
+	}
+	expired, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	<-expired.Done()
+	if got := ClassifyUpstreamError(expired, wrap(context.DeadlineExceeded)); got != "" {
+		t.Fatalf("caller deadline: got %q want none", got)
+	}
+}
+
+func TestClassifyUpstreamStatus(t *testing.T) {
+	cases := map[int]string{200: "", 204: "", 304: "", 400: UpstreamErr4xx, 404: UpstreamErr4xx, 500: UpstreamErr5xx, 503: UpstreamErr5xx, 100: UpstreamErrOther}
+	for code, want := range cases {
+		if got := ClassifyUpstreamStatus(code); got != want {
+			t.Fatalf("status %d: got %q want %q", code, got, want)
+		}
+	}
+}
+
+func TestUpstreamErrorsTotal_Labels(t *testing.T) {
+	r := prometheus.NewRegistry()
+	Init(r, true)
+	ctx := context.Background()
+	IncUpstreamError(ctx, "geoserver", UpstreamErrTimeout)
+	IncUpstreamError(ctx, "geoserver_cell", UpstreamErr5xx)
+	IncUpstreamError(ctx, "geoserver", "")
+	// shadow replays stay out of the primary's upstream metrics
+	IncUpstreamError(WithShadow(ctx), "geoserver", UpstreamErrTimeout)
+	ObserveUpstreamLatency(WithShadow(ctx), "geoserver_shadow_probe", 0.1)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rr := httptest.NewRecorder()
+	promhttp.HandlerFor(r, promhttp.HandlerOpts{}).ServeHTTP(rr, req)
+	body := rr.Body.String()
+
+	for _, want := range []string{
+		`upstream_errors_total{kind="timeout",upstream="geoserver"} 1`,
+		`upstream_errors_total{kind="5xx",upstream="geoserver_cell"} 1`,
+		`upstream_errors_total{kind="other",upstream="geoserver"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("missing %s:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "geoserver_shadow_probe") {
+		t.Fatalf("shadow upstream latency recorded:\n%s", body)
+	}
+}
@@ -0,0 +1,215 @@
+package ogc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// cql2MaxDepth bounds how deeply logical operators may nest
+const cql2MaxDepth = 32
+
+var cql2PropertyPattern = regexp.MustCompile(`^[A-Za-z_]\w*$`)
+
+var cql2Comparisons = map[string]string{
+	"=": "=", "<>": "<>", "<": "<", "<=": "<=", ">": ">", ">=": ">=",
+}
+
+type cql2Node struct {
+	Op   string            `json:"op"`
+	Args []json.RawMessage `json:"args"`
+}
+
+// CQL2JSONToText translates an OGC CQL2-JSON filter into the CQL text sent
+// to GeoServer as cql_filter. It covers and/or/not, the comparisons, like,
+// between, in and isNull over property references and literals; the output
+// is deterministic, so equal filters share cache keys
+func CQL2JSONToText(raw json.RawMessage) (string, error) {
+	return cql2Expr(raw, 0)
+}
+
+func cql2Expr(raw json.RawMessage, depth int) (string, error) {
+	if depth > cql2MaxDepth {
+		return "", fmt.Errorf("filter nests deeper than %d", cql2MaxDepth)
+	}
+	var n cql2Node
+	if err := json.Unmarshal(raw, &n); err != nil {
+		return "", fmt.Errorf("expression: %w", err)
+	}
+	if n.Op == "" {
+		return "", errors.New(`expression without "op"`)
+	}
+	arity := func(want int) error {
+		if len(n.Args) != want {
+			return fmt.Errorf("%q takes %d args, got %d", n.Op, want, len(n.Args))
+		}
+		return nil
+	}
+
+	switch op := n.Op; op {
+	case "and", "or":
+		if len(n.Args) < 2 {
+			return "", fmt.Errorf("%q takes at least 2 args, got %d", op, len(n.Args))
+		}
+		parts := make([]string, len(n.Args))
+		for i, a := range n.Args {
+			s, err := cql2Expr(a, depth+1)
+			if err != nil {
+				return "", err
+			}
+			parts[i] = "(" + s + ")"
+		}
+		return strings.Join(parts, " "+strings.ToUpper(op)+" "), nil
+	case "not":
+		if err := arity(1); err != nil {
+			return "", err
+		}
+		s, err := cql2Expr(n.Args[0], depth+1)
+		if err != nil {
+			return "", err
+		}
+		return "NOT (" + s + ")", nil
+	case "like":
+		if err := arity(2); err != nil {
+			return "", err
+		}
+		return cql2Binary(n.Args, "LIKE")
+	case "between":
+		if err := arity(3); err != nil {
+			return "", err
+		}
+		p, err := cql2Property(n.Args[0])
+		if err != nil {
+			return "", err
+		}
+		lo, err := cql2Literal(n.Args[1])
+		if err != nil {
+			return "", err
+		}
+		hi, err := cql2Literal(n.Args[2])
+		if err != nil {
+			return "", err
+		}
+		return p + " BETWEEN " + lo + " AND " + hi, nil
+	case "in":
+		if err := arity(2); err != nil {
+			return "", err
+		}
+		p, err := cql2Property(n.Args[0])
+		if err != nil {
+			return "", err
+		}
+		var list []json.RawMessage
+		if err := json.Unmarshal(n.Args[1], &list); err != nil || len(list) == 0 {
+			return "", errors.New(`"in" takes a non-empty array of literals`)
+		}
+		vals := make([]string, len(list))
+		for i, v := range list {
+			if vals[i], err = cql2Literal(v); err != nil {
+				return "", err
+			}
+		}
+		return p + " IN (" + strings.Join(vals, ", ") + ")", nil
+	case "isNull":
+		if err := arity(1); err != nil {
+			return "", err
+		}
+		p, err := cql2Property(n.Args[0])
+		if err != nil {
+			return "", err
+		}
+		return p + " IS NULL", nil
+	default:
+		cmp, ok := cql2Comparisons[op]
+		if !ok {
+			return "", fmt.Errorf("unsupported op %q", op)
+		}
+		if err := arity(2); err != nil {
+			return "", err
+		}
+		return cql2Binary(n.Args, cmp)
+	}
+}
+
+// cql2Binary renders "property OP literal"
+func cql2Binary(args []json.RawMessage, op string) (string, error) {
+	p, err := cql2Property(args[0])
+	if err != nil {
+		return "", err
+	}
+	v, err := cql2Literal(args[1])
+	if err != nil {
+		return "", err
+	}
+	return p + " " + op + " " + v, nil
+}
+
+func cql2Property(raw json.RawMessage) (string, error) {
+	var ref struct {
+		Property string `json:"property"`
+	}
+	if err := json.Unmarshal(raw, &ref); err != nil || ref.Property == "" {
+		return "", fmt.Errorf("want a {\"property\": ...} reference, got %s", raw)
+	}
+	if !cql2PropertyPattern.MatchString(ref.Property) {
+		return "", fmt.Errorf("invalid property name %q", ref.Property)
+	}
+	return ref.Property, nil
+}
+
+// cql2Literal renders a string, number, boolean or timestamp/date literal
+func cql2Literal(raw json.RawMessage) (string, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return "", errors.New("empty literal")
+	}
+	switch raw[0] {
+	case '"':
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return "", fmt.Errorf("string literal: %w", err)
+		}
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'", nil
+	case 't', 'f':
+		var b bool
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return "", fmt.Errorf("boolean literal: %w", err)
+		}
+		return strings.ToUpper(string(raw)), nil
+	case '{':
+		var tv struct {
+			Timestamp string `json:"timestamp"`
+			Date      string `json:"date"`
+		}
+		if err := json.Unmarshal(raw, &tv); err != nil {
+			return "", fmt.Errorf("temporal literal: %w", err)
+		}
+		switch {
+		case tv.Timestamp != "":
+			t, err := time.Parse(time.RFC3339Nano, tv.Timestamp)
+			if err != nil {
+				return "", fmt.Errorf("timestamp literal: %w", err)
+			}
+			return t.UTC().Format(time.RFC3339Nano), nil
+		case tv.Date != "":
+			t, err := time.Parse(time.DateOnly, tv.Date)
+			if err != nil {
+				return "", fmt.Errorf("date literal: %w", err)
+			}
+			return t.Format(time.DateOnly), nil
+		}
+		return "", fmt.Errorf("unsupported literal %s", raw)
+	default:
+		var num json.Number
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		if err := dec.Decode(&num); err != nil || num == "" {
+			return "", fmt.Errorf("unsupported literal %s", raw)
+		}
+		return num.String(), nil
+	}
+}
@@ -0,0 +1,40 @@
+package ogc
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCQL2JSONToText(t *testing.T) {
+	for in, want := range map[string]string{
+		`{"op":"=","args":[{"property":"name"},"it's"]}`:                                                         `name = 'it''s'`,
+		`{"op":"<=","args":[{"property":"pop"},1.5e3]}`:                                                          `pop <= 1.5e3`,
+		`{"op":"not","args":[{"op":"isNull","args":[{"property":"kind"}]}]}`:                                     `NOT (kind IS NULL)`,
+		`{"op":"in","args":[{"property":"kind"},["a","b"]]}`:                                                     `kind IN ('a', 'b')`,
+		`{"op":"between","args":[{"property":"pop"},10,20]}`:                                                     `pop BETWEEN 10 AND 20`,
+		`{"op":"like","args":[{"property":"name"},"Sto%"]}`:                                                      `name LIKE 'Sto%'`,
+		`{"op":">","args":[{"property":"t"},{"timestamp":"2024-01-01T01:00:00+01:00"}]}`:                         `t > 2024-01-01T00:00:00Z`,
+		`{"op":"or","args":[{"op":"=","args":[{"property":"a"},true]},{"op":"<>","args":[{"property":"b"},0]}]}`: `(a = TRUE) OR (b <> 0)`,
+	} {
+		got, err := CQL2JSONToText(json.RawMessage(in))
+		if err != nil {
+			t.Fatalf("%s: %v", in, err)
+		}
+		if got != want {
+			t.Fatalf("%s:\n got %q\nwant %q", in, got, want)
+		}
+	}
+
+	for _, in := range []string{
+		`{"op":"s_intersects","args":[{"property":"geom"},{"type":"Point","coordinates":[0,0]}]}`,
+		`{"op":"=","args":[{"property":"a) OR (1=1"},1]}`,
+		`{"op":"=","args":[{"property":"a"}]}`,
+		`{"op":"=","args":[{"property":"a"},null]}`,
+		`{"op":"in","args":[{"property":"a"},[]]}`,
+		`{"args":[]}`,
+	} {
+		if got, err := CQL2JSONToText(json.RawMessage(in)); err == nil {
+			t.Fatalf("%s: want an error, got %q", in, got)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package ogc
 import (
 	"fmt"
 	"net/url"
+	"regexp"
 	"strings"
 
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
@@ -12,6 +13,41 @@ func OWSEndpoint(geoServerBase string) string {
 	return strings.TrimRight(geoServerBase, "/") + "/ows"
 }
 
+// DefaultGeometryProperty is the geometry column INTERSECTS filters reference
+// when a layer has no GEOMETRY_PROPERTY
+const DefaultGeometryProperty = "geom"
+
+var geometryPropertyPattern = regexp.MustCompile(`^[A-Za-z_][\w.:\-]*$`)
+
+// geometryProperty returns q's geometry column, or the default when it is
+// unset or not a plain property name
+func geometryProperty(q model.QueryRequest) string {
+	if p := strings.TrimSpace(q.GeometryProperty); geometryPropertyPattern.MatchString(p) {
+		return p
+	}
+	return DefaultGeometryProperty
+}
+
+// DefaultCQLSRID is the SRID INTERSECTS literals are labelled with when a
+// layer has no CQL_SRID; GeoJSONToWKT always writes lon/lat coordinates
+const DefaultCQLSRID = "4326"
+
+var cqlSRIDPattern = regexp.MustCompile(`^[0-9]{1,9}$`)
+
+// withCQLSRID relabels an EWKT literal from GeoJSONToWKT with q's SRID; "0"
+// leaves plain WKT for upstreams that reject the prefix
+func withCQLSRID(q model.QueryRequest, ewkt string) string {
+	srid := strings.TrimSpace(q.CQLSRID)
+	if !cqlSRIDPattern.MatchString(srid) {
+		srid = DefaultCQLSRID
+	}
+	wkt := strings.TrimPrefix(ewkt, "SRID="+DefaultCQLSRID+";")
+	if strings.Trim(srid, "0") == "" {
+		return wkt
+	}
+	return "SRID=" + srid + ";" + wkt
+}
+
 func BuildGetFeatureParams(q model.QueryRequest) url.Values {
 	return BuildGetFeatureParamsFormat(q, "application/json")
 }
@@ -32,7 +68,7 @@ func BuildGetFeatureParamsFormat(q model.QueryRequest, outputFormat string) url.
 				params.Set("cql_filter", q.Filters)
 			}
 		} else {
-			cql := fmt.Sprintf("INTERSECTS(geom, %s)", wkt)
+			cql := fmt.Sprintf("INTERSECTS(%s, %s)", geometryProperty(q), withCQLSRID(q, wkt))
 			if q.Filters != "" {
 				cql = fmt.Sprintf("(%s) AND (%s)", q.Filters, cql)
 			}
@@ -47,3 +83,15 @@ func BuildGetFeatureParamsFormat(q model.QueryRequest, outputFormat string) url.
 	params.Set("outputFormat", outputFormat)
 	return params
 }
+
+// BuildGetFeatureByIDParams builds a GeoJSON GetFeature for the given feature ids
+func BuildGetFeatureByIDParams(layer string, ids []string) url.Values {
+	params := url.Values{}
+	params.Set("service", "WFS")
+	params.Set("version", "2.0.0")
+	params.Set("request", "GetFeature")
+	params.Set("typeNames", layer)
+	params.Set("featureID", strings.Join(ids, ","))
+	params.Set("outputFormat", "application/json")
+	return params
+}
@@ -42,6 +42,43 @@ func TestBuildGetFeatureParams_WithPolygon(t *testing.T) {
 	}
 }
 
+func TestBuildGetFeatureParams_GeometryProperty(t *testing.T) {
+	poly := `{"type":"Polygon","coordinates":[[[11,55],[12,55],[12,56],[11,56],[11,55]]]}`
+	for prop, want := range map[string]string{
+		"the_geom":   "INTERSECTS(the_geom, SRID=4326;POLYGON",
+		"":           "INTERSECTS(geom, SRID=4326;POLYGON",
+		"geom) OR (": "INTERSECTS(geom, SRID=4326;POLYGON",
+	} {
+		q := model.QueryRequest{
+			Layer:            "demo:NR_polygon",
+			Polygon:          &model.Polygon{GeoJSON: poly},
+			GeometryProperty: prop,
+		}
+		if cql := BuildGetFeatureParams(q).Get("cql_filter"); !strings.HasPrefix(cql, want) {
+			t.Fatalf("property %q: cql_filter=%q want prefix %q", prop, cql, want)
+		}
+	}
+}
+
+func TestBuildGetFeatureParams_CQLSRID(t *testing.T) {
+	poly := `{"type":"Polygon","coordinates":[[[11,55],[12,55],[12,56],[11,56],[11,55]]]}`
+	for srid, want := range map[string]string{
+		"":        "INTERSECTS(geom, SRID=4326;POLYGON",
+		"4258":    "INTERSECTS(geom, SRID=4258;POLYGON",
+		"0":       "INTERSECTS(geom, POLYGON",
+		"3006;--": "INTERSECTS(geom, SRID=4326;POLYGON",
+	} {
+		q := model.QueryRequest{
+			Layer:   "demo:NR_polygon",
+			Polygon: &model.Polygon{GeoJSON: poly},
+			CQLSRID: srid,
+		}
+		if cql := BuildGetFeatureParams(q).Get("cql_filter"); !strings.HasPrefix(cql, want) {
+			t.Fatalf("srid %q: cql_filter=%q want prefix %q", srid, cql, want)
+		}
+	}
+}
+
 func TestOWSEndpoint(t *testing.T) {
 	base := "http://localhost:8080/geoserver"
 	want := "http://localhost:8080/geoserver/ows"
@@ -0,0 +1,2 @@
+// Package problem writes error responses as RFC 7807 problem details.
+package problem
@@ -0,0 +1,67 @@
+package problem
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+
+	mylog "github.com/mohammed-shakir/h3-spatial-cache/internal/logger"
+)
+
+// ContentType is the media type of problem responses
+const ContentType = "application/problem+json"
+
+// Details is an RFC 7807 problem; RequestID matches the X-Request-ID of the
+// request and is omitted when there is none
+type Details struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Error replies to r with a problem for status, like http.Error. Clients that
+// prefer text/plain get detail as plain text instead
+func Error(w http.ResponseWriter, r *http.Request, detail string, status int) {
+	if r != nil && wantsText(r.Header.Get("Accept")) {
+		http.Error(w, detail, status)
+		return
+	}
+	p := Details{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+	if r != nil {
+		p.RequestID = mylog.RequestID(r.Context())
+	}
+	body, _ := json.Marshal(p)
+
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", ContentType)
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_, _ = w.Write(append(body, '\n'))
+}
+
+// wantsText reports whether text/plain comes before any JSON or wildcard
+// range in accept; the client's q-values are not weighed
+func wantsText(accept string) bool {
+	for part := range strings.SplitSeq(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || params["q"] == "0" {
+			continue
+		}
+		switch {
+		case mt == "text/plain":
+			return true
+		case mt == "*/*", mt == "application/*", strings.HasSuffix(mt, "json"):
+			return false
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/problem"
+)
+
+// maxFeatureIDs bounds a single /features request
+const maxFeatureIDs = 500
+
+// FeatureHandler is implemented by handlers that can serve features by id
+type FeatureHandler interface {
+	HandleFeatures(ctx context.Context, w http.ResponseWriter, r *http.Request, q model.FeatureRequest)
+}
+
+// HandleFeatures validates /features params and calls the handler
+func HandleFeatures(logger *slog.Logger, cfg config.Config, h FeatureHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+
+		q, err := ParseFeatureRequest(r)
+		if err != nil {
+			logger.Debug("invalid features request", "err", err)
+			problem.Error(sw, r, err.Error(), http.StatusBadRequest)
+			observability.ObserveHTTP(r.Method, "/features", http.StatusBadRequest, time.Since(start).Seconds())
+			return
+		}
+		q.Layer = config.ResolveLayer(cfg.LayerAliases, q.Layer)
+		if !config.LayerAllowed(cfg.LayersAllow, cfg.LayersDeny, q.Layer) {
+			problem.Error(sw, r, fmt.Sprintf("layer %q is not allowed", q.Layer), http.StatusForbidden)
+			observability.ObserveHTTP(r.Method, "/features", http.StatusForbidden, time.Since(start).Seconds())
+			return
+		}
+		q.Headers = passthroughHeaders(r, cfg.PassthroughHeaders)
+
+		h.HandleFeatures(r.Context(), sw, r, q)
+		observability.ObserveHTTP(r.Method, "/features", sw.code, time.Since(start).Seconds())
+	}
+}
+
+// ParseFeatureRequest reads layer and the comma-separated ids, dropping
+// blanks and duplicates while keeping order
+func ParseFeatureRequest(r *http.Request) (model.FeatureRequest, error) {
+	layer := strings.TrimSpace(r.URL.Query().Get("layer"))
+	if layer == "" {
+		return model.FeatureRequest{}, errors.New("missing required parameter: layer")
+	}
+
+	raw := strings.Split(r.URL.Query().Get("ids"), ",")
+	ids := make([]string, 0, len(raw))
+	seen := make(map[string]struct{}, len(raw))
+	for _, id := range raw {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return model.FeatureRequest{}, errors.New("missing required parameter: ids")
+	}
+	if len(ids) > maxFeatureIDs {
+		return model.FeatureRequest{}, fmt.Errorf("too many ids: %d (max %d)", len(ids), maxFeatureIDs)
+	}
+	return model.FeatureRequest{Layer: layer, IDs: ids}, nil
+}
@@ -2,15 +2,21 @@ package router
 
 import (
 	"context"
+	"encoding/json"
 	"io"
 	"log/slog"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/problem"
+	mylog "github.com/mohammed-shakir/h3-spatial-cache/internal/logger"
 )
 
 type fakeHandler struct {
@@ -45,3 +51,341 @@ func TestHandleQuery_SeamDispatch(t *testing.T) {
 		t.Fatalf("handler did not receive parsed query correctly: %+v", h.lastQ)
 	}
 }
+
+func TestHandleQuery_OutputFormatPassthrough(t *testing.T) {
+	cfg := config.FromEnv()
+	cfg.PassthroughFormats = []string{"KML"}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	serve := func(h QueryHandler, format string) *httptest.ResponseRecorder {
+		q := url.Values{}
+		q.Set("layer", "demo:NR_polygon")
+		q.Set("bbox", "11.0,55.0,12.0,56.0,EPSG:4326")
+		q.Set("outputFormat", format)
+		req := httptest.NewRequest(http.MethodGet, "/query?"+q.Encode(), nil)
+		rr := httptest.NewRecorder()
+		HandleQuery(logger, cfg, h)(rr, req)
+		return rr
+	}
+
+	// geojson stays on the normal path
+	h := &fakeHandler{}
+	if rr := serve(h, "application/json"); rr.Code != http.StatusNoContent {
+		t.Fatalf("native format: status=%d want 204", rr.Code)
+	}
+
+	// allowlisted but the handler can't forward
+	if rr := serve(h, "kml"); rr.Code != http.StatusNotAcceptable {
+		t.Fatalf("non-forwarding handler: status=%d want 406", rr.Code)
+	}
+
+	fwd := &forwardingHandler{}
+	rr := serve(fwd, "kml")
+	if rr.Code != http.StatusOK || fwd.format != "kml" {
+		t.Fatalf("allowlisted format: status=%d forwarded=%q", rr.Code, fwd.format)
+	}
+	if got := rr.Header().Get("X-Cache"); got != "BYPASS" {
+		t.Fatalf("X-Cache=%q want BYPASS", got)
+	}
+	if rr := serve(fwd, "SHAPE-ZIP"); rr.Code != http.StatusNotAcceptable {
+		t.Fatalf("format outside allowlist: status=%d want 406", rr.Code)
+	}
+}
+
+type forwardingHandler struct {
+	fakeHandler
+	format string
+}
+
+func (f *forwardingHandler) ForwardGetFeatureFormat(w http.ResponseWriter, _ *http.Request, _ model.QueryRequest, format string) {
+	f.format = format
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestHandleQuery_ResOverrideRange(t *testing.T) {
+	cfg := config.FromEnv()
+	cfg.H3Res, cfg.H3ResMin, cfg.H3ResMax = 8, 7, 9
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	serve := func(res string) (*httptest.ResponseRecorder, *fakeHandler) {
+		h := &fakeHandler{}
+		req := httptest.NewRequest(http.MethodGet, "/query?layer=demo&bbox=11,55,12,56,EPSG:4326&res="+res, nil)
+		rr := httptest.NewRecorder()
+		HandleQuery(logger, cfg, h)(rr, req)
+		return rr, h
+	}
+
+	rr, h := serve("9")
+	if rr.Code != http.StatusNoContent || h.lastQ.H3Res != 9 {
+		t.Fatalf("in-range res: status=%d H3Res=%d", rr.Code, h.lastQ.H3Res)
+	}
+	for _, res := range []string{"6", "10", "abc"} {
+		if rr, _ := serve(res); rr.Code != http.StatusBadRequest {
+			t.Fatalf("res=%s: status=%d want 400", res, rr.Code)
+		}
+	}
+}
+
+func TestHandleQuery_LayerAllowDeny(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	status := func(cfg config.Config, layer string) int {
+		req := httptest.NewRequest(http.MethodGet, "/query?layer="+url.QueryEscape(layer)+"&bbox=11,55,12,56,EPSG:4326", nil)
+		rr := httptest.NewRecorder()
+		HandleQuery(logger, cfg, &fakeHandler{})(rr, req)
+		return rr.Code
+	}
+
+	cases := []struct {
+		name        string
+		allow, deny []string
+		want        map[string]int
+	}{
+		{
+			name:  "allow only",
+			allow: []string{"demo:*", "public:roads"},
+			want:  map[string]int{"demo:places": 204, "public:roads": 204, "public:parcels": 403},
+		},
+		{
+			name: "deny only",
+			deny: []string{"heavy:*", "demo:parcels"},
+			want: map[string]int{"demo:places": 204, "demo:parcels": 403, "heavy:lidar": 403},
+		},
+		{
+			name:  "combined, deny wins",
+			allow: []string{"demo:*"},
+			deny:  []string{"demo:parcels"},
+			want:  map[string]int{"demo:places": 204, "demo:parcels": 403, "other:roads": 403},
+		},
+	}
+	for _, tc := range cases {
+		cfg := config.FromEnv()
+		cfg.LayersAllow, cfg.LayersDeny = tc.allow, tc.deny
+		for layer, want := range tc.want {
+			if got := status(cfg, layer); got != want {
+				t.Fatalf("%s: layer %q status=%d want %d", tc.name, layer, got, want)
+			}
+		}
+	}
+}
+
+func TestHandleQuery_ProbeNeedsProber(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := &fakeHandler{}
+	req := httptest.NewRequest(http.MethodHead, "/query?layer=demo&bbox=11,55,12,56,EPSG:4326", nil)
+	rr := httptest.NewRecorder()
+	HandleQuery(logger, config.FromEnv(), h)(rr, req)
+	if rr.Code != http.StatusNotImplemented || h.lastQ.Layer != "" {
+		t.Fatalf("probe on a non-prober: status=%d dispatched=%v", rr.Code, h.lastQ.Layer != "")
+	}
+}
+
+func TestHandleQuery_MaxPolygonVertices(t *testing.T) {
+	cfg := config.FromEnv()
+	cfg.MaxPolygonVertices = 5
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	serve := func(poly string) (*httptest.ResponseRecorder, *fakeHandler) {
+		h := &fakeHandler{}
+		req := httptest.NewRequest(http.MethodGet, "/query?layer=demo&polygon="+url.QueryEscape(poly), nil)
+		rr := httptest.NewRecorder()
+		HandleQuery(logger, cfg, h)(rr, req)
+		return rr, h
+	}
+
+	square := `{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,1],[0,0]]]}`
+	if rr, h := serve(square); rr.Code != http.StatusNoContent || h.lastQ.Polygon == nil {
+		t.Fatalf("polygon at the limit: status=%d", rr.Code)
+	}
+	hexagon := `{"type":"Polygon","coordinates":[[[0,0],[2,0],[3,1],[2,2],[0,2],[-1,1],[0,0]]]}`
+	rr, h := serve(hexagon)
+	if rr.Code != http.StatusBadRequest || h.lastQ.Layer != "" {
+		t.Fatalf("over-limit polygon: status=%d dispatched=%v", rr.Code, h.lastQ.Layer != "")
+	}
+
+	cfg.MaxPolygonVertices = 0
+	if rr, _ := serve(hexagon); rr.Code != http.StatusNoContent {
+		t.Fatalf("unlimited: status=%d want 204", rr.Code)
+	}
+}
+
+func TestHandleQuery_MaxQueryExtent(t *testing.T) {
+	cfg := config.FromEnv()
+	cfg.MaxQueryExtent = 1
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	serve := func(param, value string) (*httptest.ResponseRecorder, *fakeHandler) {
+		h := &fakeHandler{}
+		req := httptest.NewRequest(http.MethodGet, "/query?layer=demo&"+param+"="+url.QueryEscape(value), nil)
+		rr := httptest.NewRecorder()
+		HandleQuery(logger, cfg, h)(rr, req)
+		return rr, h
+	}
+
+	if rr, h := serve("bbox", "11,55,12,56,EPSG:4326"); rr.Code != http.StatusNoContent || h.lastQ.BBox == nil {
+		t.Fatalf("bbox at the limit: status=%d", rr.Code)
+	}
+	rr, h := serve("bbox", "10,54,14,56,EPSG:4326")
+	if rr.Code != http.StatusBadRequest || h.lastQ.Layer != "" {
+		t.Fatalf("oversized bbox: status=%d dispatched=%v", rr.Code, h.lastQ.Layer != "")
+	}
+	poly := `{"type":"Polygon","coordinates":[[[0,0],[3,0],[0,3],[0,0]]]}`
+	if rr, h := serve("polygon", poly); rr.Code != http.StatusBadRequest || h.lastQ.Layer != "" {
+		t.Fatalf("oversized polygon envelope: status=%d dispatched=%v", rr.Code, h.lastQ.Layer != "")
+	}
+
+	// clamping keeps the center and aspect ratio of the requested bbox
+	cfg.MaxQueryExtentClamp = true
+	rr, h = serve("bbox", "10,54,14,56,EPSG:4326")
+	if rr.Code != http.StatusNoContent || h.lastQ.BBox == nil {
+		t.Fatalf("clamped bbox: status=%d", rr.Code)
+	}
+	bb := *h.lastQ.BBox
+	w, ht := bb.X2-bb.X1, bb.Y2-bb.Y1
+	if math.Abs(w*ht-1) > 1e-9 || math.Abs(w/ht-2) > 1e-9 || (bb.X1+bb.X2)/2 != 12 || (bb.Y1+bb.Y2)/2 != 55 {
+		t.Fatalf("clamped bbox=%+v, want area 1, aspect 2, centered on 12,55", bb)
+	}
+	if warn := rr.Header().Get("Warning"); !strings.Contains(warn, "clamped") {
+		t.Fatalf("Warning=%q want a clamp warning", warn)
+	}
+	if rr, _ := serve("polygon", poly); rr.Code != http.StatusBadRequest {
+		t.Fatalf("polygons are not clamped: status=%d want 400", rr.Code)
+	}
+}
+
+func TestHandleQuery_BadRequestIsProblemJSON(t *testing.T) {
+	hdl := HandleQuery(slog.New(slog.NewTextHandler(io.Discard, nil)), config.FromEnv(), &fakeHandler{})
+
+	req := httptest.NewRequest(http.MethodGet, "/query?bbox=11,55,12,56,EPSG:4326", nil)
+	req = req.WithContext(mylog.WithRequestID(req.Context(), "req-42"))
+	rr := httptest.NewRecorder()
+	hdl(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("status=%d want 400", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != problem.ContentType {
+		t.Fatalf("content-type=%q want %q", ct, problem.ContentType)
+	}
+	var p problem.Details
+	if err := json.Unmarshal(rr.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode problem: %v (%q)", err, rr.Body.String())
+	}
+	want := problem.Details{
+		Type:      "about:blank",
+		Title:     "Bad Request",
+		Status:    http.StatusBadRequest,
+		Detail:    "missing required parameter: layer",
+		RequestID: "req-42",
+	}
+	if p != want {
+		t.Fatalf("problem=%+v want %+v", p, want)
+	}
+
+	// text/plain clients keep the plain message
+	req = httptest.NewRequest(http.MethodGet, "/query?bbox=11,55,12,56,EPSG:4326", nil)
+	req.Header.Set("Accept", "text/plain")
+	rr = httptest.NewRecorder()
+	hdl(rr, req)
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Fatalf("text client content-type=%q", ct)
+	}
+	if got := strings.TrimSpace(rr.Body.String()); got != "missing required parameter: layer" {
+		t.Fatalf("text body=%q", got)
+	}
+}
+
+// slowHandler waits for its upstream, or gives up with a 502 when the request
+// context ends first, the way the scenarios report upstream failures
+type slowHandler struct{ upstream time.Duration }
+
+func (s slowHandler) HandleQuery(ctx context.Context, w http.ResponseWriter, r *http.Request, _ model.QueryRequest) {
+	select {
+	case <-time.After(s.upstream):
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[]}`)
+	case <-ctx.Done():
+		problem.Error(w, r, "upstream error: "+ctx.Err().Error(), http.StatusBadGateway)
+	}
+}
+
+func TestHandleQuery_RequestTimeoutHeader(t *testing.T) {
+	cfg := config.FromEnv()
+	cfg.QueryTimeout = time.Minute
+	cfg.QueryTimeoutMax = 2 * time.Minute
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	hdl := HandleQuery(logger, cfg, slowHandler{upstream: 200 * time.Millisecond})
+
+	serve := func(timeout string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/query?layer=demo:NR_polygon&bbox=11,55,12,56,EPSG:4326", nil)
+		if timeout != "" {
+			req.Header.Set(HeaderRequestTimeout, timeout)
+		}
+		rr := httptest.NewRecorder()
+		hdl(rr, req)
+		return rr
+	}
+
+	start := time.Now()
+	rr := serve("20ms")
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Fatalf("short timeout: status=%d body=%s, want 504", rr.Code, rr.Body.String())
+	}
+	if el := time.Since(start); el > 150*time.Millisecond {
+		t.Fatalf("short timeout took %v; the header deadline was not applied", el)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != problem.ContentType || strings.Contains(rr.Body.String(), "upstream error") {
+		t.Fatalf("504 should replace the handler's error: content-type=%q body=%s", ct, rr.Body.String())
+	}
+
+	for _, timeout := range []string{"", "1s", "0.5"} {
+		if rr := serve(timeout); rr.Code != http.StatusOK {
+			t.Fatalf("timeout %q: status=%d body=%s", timeout, rr.Code, rr.Body.String())
+		}
+	}
+	for _, bad := range []string{"soon", "-1s", "0"} {
+		if rr := serve(bad); rr.Code != http.StatusBadRequest {
+			t.Fatalf("timeout %q: status=%d, want 400", bad, rr.Code)
+		}
+	}
+}
+
+func TestRequestTimeout_Clamps(t *testing.T) {
+	for raw, want := range map[string]time.Duration{
+		"":      5 * time.Second,
+		"250ms": 250 * time.Millisecond,
+		"1.5":   1500 * time.Millisecond,
+		"1h":    30 * time.Second,
+		"1e300": 30 * time.Second,
+		"1ns":   minRequestTimeout,
+	} {
+		got, err := requestTimeout(raw, 5*time.Second, 30*time.Second)
+		if err != nil || got != want {
+			t.Fatalf("requestTimeout(%q)=%v,%v want %v", raw, got, err, want)
+		}
+	}
+}
+
+type hitRecordingHandler struct {
+	fakeHandler
+	hits []model.QueryRequest
+}
+
+func (h *hitRecordingHandler) RecordHit(_ context.Context, q model.QueryRequest) {
+	h.hits = append(h.hits, q)
+}
+
+func TestRecordCoalesced_RecordsSuccessfulReplays(t *testing.T) {
+	cfg := config.FromEnv()
+	cfg.LayerAliases = map[string]string{"roads": "demo:roads"}
+	h := &hitRecordingHandler{}
+	record := RecordCoalesced(cfg, h)
+
+	req := httptest.NewRequest(http.MethodGet, "/query?layer=roads&bbox=11.0,55.0,12.0,56.0,EPSG:4326", nil)
+	record(req, http.StatusOK, time.Millisecond)
+	record(req, http.StatusBadGateway, time.Millisecond)
+
+	if len(h.hits) != 1 {
+		t.Fatalf("hits=%d want 1, failed replays are not hits", len(h.hits))
+	}
+	if h.hits[0].Layer != "demo:roads" || h.hits[0].BBox == nil {
+		t.Fatalf("recorded query=%+v", h.hits[0])
+	}
+}
@@ -2,20 +2,27 @@
 package router
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"math"
 	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/composer"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/ogc"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/problem"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/hitevents"
 )
 
@@ -24,22 +31,120 @@ type QueryHandler interface {
 	HandleQuery(ctx context.Context, w http.ResponseWriter, r *http.Request, q model.QueryRequest)
 }
 
+// FormatForwarder is implemented by handlers that can proxy a GetFeature in an
+// arbitrary GeoServer outputFormat, bypassing composition and the cache
+type FormatForwarder interface {
+	ForwardGetFeatureFormat(w http.ResponseWriter, r *http.Request, q model.QueryRequest, format string)
+}
+
+// Prober is implemented by handlers that can report a query's cache warmth
+// from the cell index alone, without touching the upstream or composing a body
+type Prober interface {
+	ProbeQuery(ctx context.Context, w http.ResponseWriter, r *http.Request, q model.QueryRequest)
+}
+
+// Shadower replays a query the primary handler served somewhere else; it must
+// not block, since it runs on the response path
+type Shadower interface {
+	Shadow(r *http.Request, q model.QueryRequest)
+}
+
+// HitRecorder is implemented by handlers that track query popularity; it
+// counts a query that was answered without reaching the handler, such as a
+// coalesced duplicate
+type HitRecorder interface {
+	RecordHit(ctx context.Context, q model.QueryRequest)
+}
+
+// RecordCoalesced accounts for a /query answered by replaying another
+// request's response: it observes the request and its spatial hit like
+// HandleQuery would and, for a successful reply, records the hit with h when
+// h is a HitRecorder
+func RecordCoalesced(cfg config.Config, h QueryHandler) func(r *http.Request, status int, elapsed time.Duration) {
+	return func(r *http.Request, status int, elapsed time.Duration) {
+		observability.ObserveHTTP(r.Method, "/query", status, elapsed.Seconds())
+		if status != http.StatusOK || isProbe(r) {
+			return
+		}
+		q, _, err := ParseQueryRequest(r)
+		if err != nil {
+			return
+		}
+		q.Layer = config.ResolveLayer(cfg.LayerAliases, q.Layer)
+		switch {
+		case q.BBox != nil:
+			observability.ObserveSpatialHit(q.Layer, (q.BBox.X1+q.BBox.X2)/2.0, (q.BBox.Y1+q.BBox.Y2)/2.0)
+		case q.Polygon != nil:
+			observability.ObserveSpatialHit(q.Layer, 0, 0)
+		}
+		hr, ok := h.(HitRecorder)
+		if !ok {
+			return
+		}
+		q.Headers = passthroughHeaders(r, cfg.PassthroughHeaders)
+		q.GeometryProperty = config.GeometryPropertyFor(cfg.GeometryProperties, q.Layer)
+		q.CQLSRID = config.CQLSRIDFor(cfg.CQLSRIDs, q.Layer)
+		hr.RecordHit(r.Context(), q)
+	}
+}
+
 // HandleQuery validates input query params and calls the handler
 func HandleQuery(logger *slog.Logger, cfg config.Config, h QueryHandler) http.HandlerFunc {
+	return HandleQueryShadowed(logger, cfg, h, nil)
+}
+
+// HandleQueryShadowed is HandleQuery that also hands every query h served to
+// sh; probes and forwarded outputFormats are not replayed
+func HandleQueryShadowed(logger *slog.Logger, cfg config.Config, h QueryHandler, sh Shadower) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
 
+		timeout, err := requestTimeout(r.Header.Get(HeaderRequestTimeout), cfg.QueryTimeout, cfg.QueryTimeoutMax)
+		if err != nil {
+			problem.Error(sw, r, err.Error(), http.StatusBadRequest)
+			observability.ObserveHTTP(r.Method, "/query", http.StatusBadRequest, time.Since(start).Seconds())
+			return
+		}
+		if timeout > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+			sw.deadline = r
+		}
+
 		q, warn, err := ParseQueryRequest(r)
 		if warn != "" {
 			logger.Warn(warn)
 		}
 		if err != nil {
-			http.Error(sw, err.Error(), http.StatusBadRequest)
+			problem.Error(sw, r, err.Error(), http.StatusBadRequest)
 			observability.ObserveHTTP(r.Method, "/query", http.StatusBadRequest, time.Since(start).Seconds())
 			return
 		}
 
+		if qerr := CheckQuery(sw, cfg, &q); qerr != nil {
+			problem.Error(sw, r, qerr.Msg, qerr.Status)
+			observability.ObserveHTTP(r.Method, "/query", qerr.Status, time.Since(start).Seconds())
+			return
+		}
+
+		q.Headers = passthroughHeaders(r, cfg.PassthroughHeaders)
+		q.GeometryProperty = config.GeometryPropertyFor(cfg.GeometryProperties, q.Layer)
+		q.CQLSRID = config.CQLSRIDFor(cfg.CQLSRIDs, q.Layer)
+
+		// probes sample warmth for monitors, so they stay out of hit accounting
+		if isProbe(r) {
+			p, ok := h.(Prober)
+			if !ok {
+				problem.Error(sw, r, "probe not supported by this scenario", http.StatusNotImplemented)
+			} else {
+				p.ProbeQuery(r.Context(), sw, r, q)
+			}
+			observability.ObserveHTTP(r.Method, "/query", sw.code, time.Since(start).Seconds())
+			return
+		}
+
 		var lon, lat float64
 		hitRecorded := false
 
@@ -65,21 +170,197 @@ func HandleQuery(logger *slog.Logger, cfg config.Config, h QueryHandler) http.Ha
 			}
 		}
 
+		if of := strings.TrimSpace(r.URL.Query().Get("outputFormat")); !composer.NativeOutputFormat(of) {
+			fwd, ok := h.(FormatForwarder)
+			if !ok || !formatAllowed(cfg.PassthroughFormats, of) {
+				problem.Error(sw, r, fmt.Sprintf("outputFormat %q not supported", of), http.StatusNotAcceptable)
+				observability.ObserveHTTP(r.Method, "/query", sw.code, time.Since(start).Seconds())
+				return
+			}
+			sw.Header().Set(composer.HeaderXCache, composer.XCacheBypass)
+			fwd.ForwardGetFeatureFormat(sw, r, q, of)
+			observability.ObserveHTTP(r.Method, "/query", sw.code, time.Since(start).Seconds())
+			return
+		}
+
 		h.HandleQuery(r.Context(), sw, r, q)
+		sw.finish()
 		observability.ObserveHTTP(r.Method, "/query", sw.code, time.Since(start).Seconds())
+		if sh != nil {
+			sh.Shadow(r, q)
+		}
+	}
+}
+
+// HEAD /query and GET /query?probe=true only report the hit class
+func isProbe(r *http.Request) bool {
+	if r.Method == http.MethodHead {
+		return true
+	}
+	probe, _ := strconv.ParseBool(r.URL.Query().Get("probe"))
+	return probe
+}
+
+func formatAllowed(allowed []string, format string) bool {
+	for _, a := range allowed {
+		if strings.EqualFold(strings.TrimSpace(a), format) {
+			return true
+		}
+	}
+	return false
+}
+
+// passthroughHeaders collects the configured client headers that are present
+// on r, normalized so equivalent values share one cache scope and upstream
+// request
+func passthroughHeaders(r *http.Request, names []string) map[string]string {
+	var out map[string]string
+	for _, name := range names {
+		name = http.CanonicalHeaderKey(name)
+		v := strings.TrimSpace(r.Header.Get(name))
+		if name == "Accept-Language" {
+			v = preferredLanguage(v)
+		}
+		if v == "" {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]string, len(names))
+		}
+		out[name] = v
 	}
+	return out
+}
+
+// preferredLanguage reduces an Accept-Language value to its highest-weighted
+// tag, lowercased, taking the first on ties; "" when no tag is acceptable or
+// the best is "*", which asks for nothing in particular
+func preferredLanguage(v string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(v, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		for _, p := range strings.Split(params, ";") {
+			k, val, ok := strings.Cut(strings.TrimSpace(p), "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(k), "q") {
+				continue
+			}
+			f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+			if err != nil || f < 0 || f > 1 {
+				f = 0
+			}
+			q = f
+		}
+		if q > bestQ {
+			best, bestQ = tag, q
+		}
+	}
+	if best == "*" {
+		return ""
+	}
+	return best
 }
 
 type statusWriter struct {
 	http.ResponseWriter
 	code int
+
+	// deadline, when set, is the request whose context carries the query
+	// timeout; an error written after it expired is replaced by a 504
+	deadline *http.Request
+	wrote    bool
+	timedOut bool
 }
 
 func (w *statusWriter) WriteHeader(code int) {
+	if w.wrote {
+		return
+	}
+	w.wrote = true
+	if code >= http.StatusBadRequest && w.expired() {
+		w.timeout()
+		return
+	}
 	w.code = code
 	w.ResponseWriter.WriteHeader(code)
 }
 
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.timedOut {
+		return len(b), nil
+	}
+	n, err := w.ResponseWriter.Write(b)
+	if err != nil {
+		return n, fmt.Errorf("write response: %w", err)
+	}
+	return n, nil
+}
+
+// finish answers 504 when the handler gave up on an expired deadline without
+// writing anything
+func (w *statusWriter) finish() {
+	if !w.wrote && w.expired() {
+		w.wrote = true
+		w.timeout()
+	}
+}
+
+func (w *statusWriter) expired() bool {
+	return w.deadline != nil && errors.Is(w.deadline.Context().Err(), context.DeadlineExceeded)
+}
+
+// timeout swaps the handler's error for a 504; the handler's body is dropped
+func (w *statusWriter) timeout() {
+	w.timedOut = true
+	w.code = http.StatusGatewayTimeout
+	h := w.ResponseWriter.Header()
+	for _, k := range []string{"Content-Length", "Content-Encoding", "Retry-After"} {
+		h.Del(k)
+	}
+	problem.Error(w.ResponseWriter, w.deadline, "query exceeded its timeout", http.StatusGatewayTimeout)
+}
+
+// HeaderRequestTimeout lets a client pick its own /query deadline, as a Go
+// duration ("2s") or in seconds ("0.5"), bounded by QUERY_TIMEOUT_MAX
+const HeaderRequestTimeout = "X-Request-Timeout"
+
+// shortest deadline a client can ask for; anything below is raised to it
+const minRequestTimeout = 10 * time.Millisecond
+
+// requestTimeout resolves the deadline for one query: the header when given,
+// clamped into [minRequestTimeout, maxTimeout], else def
+func requestTimeout(raw string, def, maxTimeout time.Duration) (time.Duration, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		secs, ferr := strconv.ParseFloat(raw, 64)
+		if ferr != nil || math.IsNaN(secs) || math.IsInf(secs, 0) {
+			return 0, fmt.Errorf("invalid %s %q: want a duration such as 2s or a number of seconds", HeaderRequestTimeout, raw)
+		}
+		d = time.Duration(math.MaxInt64)
+		if secs < float64(d)/float64(time.Second) {
+			d = time.Duration(secs * float64(time.Second))
+		}
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be positive", HeaderRequestTimeout, raw)
+	}
+	if maxTimeout > 0 {
+		d = min(d, maxTimeout)
+	}
+	return max(d, minRequestTimeout), nil
+}
+
 func ParseQueryRequest(r *http.Request) (model.QueryRequest, string, error) {
 	var warn string
 
@@ -92,6 +373,29 @@ func ParseQueryRequest(r *http.Request) (model.QueryRequest, string, error) {
 	rawPoly := strings.TrimSpace(r.URL.Query().Get("polygon"))
 	filters := strings.TrimSpace(r.URL.Query().Get("filters"))
 
+	if r.Method == http.MethodPost {
+		body, err := parseQueryBody(r)
+		if err != nil {
+			return model.QueryRequest{}, "", err
+		}
+		if body.filter != "" && filters != "" {
+			return model.QueryRequest{}, "", errors.New("supply either filters or a CQL2-JSON filter body, not both")
+		}
+		if body.filter != "" {
+			filters = body.filter
+		}
+		if body.polygon != "" && rawPoly != "" {
+			return model.QueryRequest{}, "", errors.New("supply either polygon or a polygon body, not both")
+		}
+		if body.polygon != "" {
+			rawPoly = body.polygon
+		}
+	}
+	// a CQL2-JSON body is held to the same limits once translated
+	if filters != "" && !isSafeCQL(filters) {
+		return model.QueryRequest{}, "", errors.New("invalid or disallowed cql_filter")
+	}
+
 	// drop bbox if polygon is given (polygon wins)
 	if rawBBox != "" && rawPoly != "" {
 		warn = "both bbox and polygon supplied; preferring polygon"
@@ -100,7 +404,7 @@ func ParseQueryRequest(r *http.Request) (model.QueryRequest, string, error) {
 
 	var bbox *model.BBox
 	if rawBBox != "" {
-		bb, err := parseBBOX(rawBBox)
+		bb, err := ParseBBOX(rawBBox)
 		if err != nil {
 			return model.QueryRequest{}, warn, fmt.Errorf("invalid bbox: %w", err)
 		}
@@ -109,26 +413,365 @@ func ParseQueryRequest(r *http.Request) (model.QueryRequest, string, error) {
 
 	var poly *model.Polygon
 	if rawPoly != "" {
-		p, err := parsePolygon(rawPoly)
+		p, err := ParsePolygon(rawPoly)
 		if err != nil {
 			return model.QueryRequest{}, warn, fmt.Errorf("invalid polygon: %w", err)
 		}
 		poly = &p
 	}
 
-	if filters != "" && !isSafeCQL(filters) {
-		return model.QueryRequest{}, warn, errors.New("invalid or disallowed cql_filter")
+	sortKeys, err := parseSortBy(r.URL.Query().Get("sortby"))
+	if err != nil {
+		return model.QueryRequest{}, warn, fmt.Errorf("invalid sortby: %w", err)
+	}
+
+	var precision int
+	if raw := strings.TrimSpace(r.URL.Query().Get("geomPrecision")); raw != "" {
+		p, err := strconv.Atoi(raw)
+		if err != nil || p < 1 || p > 15 {
+			return model.QueryRequest{}, warn, errors.New("invalid geomPrecision: must be an integer in [1,15]")
+		}
+		precision = p
+	}
+
+	var res int
+	if raw := strings.TrimSpace(r.URL.Query().Get("res")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > 15 {
+			return model.QueryRequest{}, warn, errors.New("invalid res: must be an integer in [1,15]")
+		}
+		res = n
+	}
+
+	after, err := parseTimeBound(r.URL.Query().Get("created_after"))
+	if err != nil {
+		return model.QueryRequest{}, warn, fmt.Errorf("invalid created_after: %w", err)
+	}
+	before, err := parseTimeBound(r.URL.Query().Get("created_before"))
+	if err != nil {
+		return model.QueryRequest{}, warn, fmt.Errorf("invalid created_before: %w", err)
+	}
+	if !after.IsZero() && !before.IsZero() && before.Before(after) {
+		return model.QueryRequest{}, warn, errors.New("created_before is earlier than created_after")
+	}
+
+	var provenance bool
+	if raw := strings.TrimSpace(r.URL.Query().Get("provenance")); raw != "" {
+		provenance, err = strconv.ParseBool(raw)
+		if err != nil {
+			return model.QueryRequest{}, warn, errors.New("invalid provenance: must be a boolean")
+		}
+	}
+
+	var capture bool
+	if raw := strings.TrimSpace(r.URL.Query().Get("capture")); raw != "" {
+		capture, err = strconv.ParseBool(raw)
+		if err != nil {
+			return model.QueryRequest{}, warn, errors.New("invalid capture: must be a boolean")
+		}
+	}
+
+	var strict bool
+	switch raw := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("consistency"))); raw {
+	case "", "default":
+	case "strict":
+		strict = true
+	default:
+		return model.QueryRequest{}, warn, fmt.Errorf("invalid consistency %q: must be strict or default", raw)
 	}
 
 	return model.QueryRequest{
-		Layer:   layer,
-		BBox:    bbox,
-		Polygon: poly,
-		Filters: filters,
+		Layer:             layer,
+		BBox:              bbox,
+		Polygon:           poly,
+		Filters:           filters,
+		Sort:              sortKeys,
+		H3Res:             res,
+		GeomPrecision:     precision,
+		CreatedAfter:      after,
+		CreatedBefore:     before,
+		Provenance:        provenance,
+		StrictConsistency: strict,
+		Capture:           capture,
 	}, warn, nil
 }
 
-func parseBBOX(bboxParam string) (model.BBox, error) {
+// QueryError is a query refused by CheckQuery or CheckFootprint, with the
+// status to answer it with
+type QueryError struct {
+	Status int
+	Msg    string
+}
+
+func (e *QueryError) Error() string { return e.Msg }
+
+// CheckQuery resolves q's layer alias and applies the limits /query enforces:
+// the layer allow/deny lists, the configured res range and CheckFootprint
+func CheckQuery(w http.ResponseWriter, cfg config.Config, q *model.QueryRequest) *QueryError {
+	q.Layer = config.ResolveLayer(cfg.LayerAliases, q.Layer)
+	if !config.LayerAllowed(cfg.LayersAllow, cfg.LayersDeny, q.Layer) {
+		return &QueryError{Status: http.StatusForbidden, Msg: fmt.Sprintf("layer %q is not allowed", q.Layer)}
+	}
+	if q.H3Res > 0 && (q.H3Res < cfg.H3ResMin || q.H3Res > cfg.H3ResMax) {
+		msg := fmt.Sprintf("res %d outside the configured range [%d,%d]", q.H3Res, cfg.H3ResMin, cfg.H3ResMax)
+		return &QueryError{Status: http.StatusBadRequest, Msg: msg}
+	}
+	return CheckFootprint(w, cfg, q)
+}
+
+// CheckFootprint applies MAX_POLYGON_VERTICES and MAX_QUERY_EXTENT to q's
+// bbox or polygon, clamping the bbox when MAX_QUERY_EXTENT_CLAMP is set;
+// refusals are counted in spatial_query_rejects_total
+func CheckFootprint(w http.ResponseWriter, cfg config.Config, q *model.QueryRequest) *QueryError {
+	if q.Polygon != nil && cfg.MaxPolygonVertices > 0 && q.Polygon.Vertices > cfg.MaxPolygonVertices {
+		observability.IncQueryReject("polygon_vertices")
+		msg := fmt.Sprintf("polygon has %d vertices (max %d)", q.Polygon.Vertices, cfg.MaxPolygonVertices)
+		return &QueryError{Status: http.StatusBadRequest, Msg: msg}
+	}
+	if cfg.MaxQueryExtent > 0 {
+		if msg, ok := limitExtent(w, q, cfg.MaxQueryExtent, cfg.MaxQueryExtentClamp); !ok {
+			observability.IncQueryReject("extent")
+			return &QueryError{Status: http.StatusBadRequest, Msg: msg}
+		}
+	}
+	return nil
+}
+
+// limitExtent enforces the footprint cap: an oversized bbox is shrunk around
+// its center, keeping its aspect ratio, when clamp is set; anything else over
+// the cap is refused with the returned message
+func limitExtent(w http.ResponseWriter, q *model.QueryRequest, maxArea float64, clamp bool) (string, bool) {
+	switch {
+	case q.BBox != nil:
+		bb := *q.BBox
+		area := (bb.X2 - bb.X1) * (bb.Y2 - bb.Y1)
+		if area <= maxArea {
+			return "", true
+		}
+		if !clamp {
+			return fmt.Sprintf("bbox covers %g square degrees (max %g)", area, maxArea), false
+		}
+		k := math.Sqrt(maxArea / area)
+		cx, cy := (bb.X1+bb.X2)/2, (bb.Y1+bb.Y2)/2
+		hw, hh := (bb.X2-bb.X1)*k/2, (bb.Y2-bb.Y1)*k/2
+		bb.X1, bb.X2, bb.Y1, bb.Y2 = cx-hw, cx+hw, cy-hh, cy+hh
+		q.BBox = &bb
+		w.Header().Set("Warning", fmt.Sprintf(`299 - "bbox clamped to %s (max %g square degrees)"`, bb.String(), maxArea))
+		return "", true
+	case q.Polygon != nil:
+		area, err := envelopeArea(q.Polygon.GeoJSON)
+		if err != nil {
+			return "invalid polygon: " + err.Error(), false
+		}
+		if area > maxArea {
+			return fmt.Sprintf("polygon envelope covers %g square degrees (max %g)", area, maxArea), false
+		}
+	}
+	return "", true
+}
+
+// envelopeArea is the area of a Polygon or MultiPolygon's bounding box
+func envelopeArea(raw string) (float64, error) {
+	var g struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	}
+	if err := json.Unmarshal([]byte(raw), &g); err != nil {
+		return 0, fmt.Errorf("parse json: %w", err)
+	}
+	var polys [][][][]float64
+	if g.Type == "Polygon" {
+		var rings [][][]float64
+		if err := json.Unmarshal(g.Coordinates, &rings); err != nil {
+			return 0, fmt.Errorf("parse coordinates: %w", err)
+		}
+		polys = [][][][]float64{rings}
+	} else if err := json.Unmarshal(g.Coordinates, &polys); err != nil {
+		return 0, fmt.Errorf("parse coordinates: %w", err)
+	}
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, rings := range polys {
+		for _, ring := range rings {
+			for _, pt := range ring {
+				if len(pt) < 2 {
+					return 0, errors.New("position with fewer than 2 coordinates")
+				}
+				minX, maxX = min(minX, pt[0]), max(maxX, pt[0])
+				minY, maxY = min(minY, pt[1]), max(maxY, pt[1])
+			}
+		}
+	}
+	if minX > maxX {
+		return 0, nil
+	}
+	return (maxX - minX) * (maxY - minY), nil
+}
+
+// maxQueryBody caps a POST /query body after decompression
+const maxQueryBody = 4 << 20
+
+// queryBody is what a POST /query body adds to the query parameters
+type queryBody struct {
+	filter  string // CQL text translated from the CQL2-JSON filter
+	polygon string // raw GeoJSON Polygon or MultiPolygon
+}
+
+// parseQueryBody reads a {"filter": <CQL2-JSON>, "filter-lang": "cql2-json",
+// "polygon": <GeoJSON>} body, gzip-compressed when Content-Encoding says so;
+// an empty body adds nothing
+func parseQueryBody(r *http.Request) (queryBody, error) {
+	if r.Body == nil {
+		return queryBody{}, nil
+	}
+	raw, err := readQueryBody(r)
+	if err != nil {
+		return queryBody{}, err
+	}
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return queryBody{}, nil
+	}
+	var body struct {
+		Filter     json.RawMessage `json:"filter"`
+		FilterLang string          `json:"filter-lang"`
+		Polygon    json.RawMessage `json:"polygon"`
+	}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return queryBody{}, fmt.Errorf("invalid body: parse json: %w", err)
+	}
+	var out queryBody
+	if len(body.Polygon) > 0 && string(body.Polygon) != "null" {
+		out.polygon = string(body.Polygon)
+	}
+	if lang := strings.TrimSpace(body.FilterLang); lang != "" && !strings.EqualFold(lang, "cql2-json") {
+		return queryBody{}, fmt.Errorf("invalid filter: unsupported filter-lang %q (want cql2-json)", lang)
+	}
+	if len(body.Filter) == 0 || string(body.Filter) == "null" {
+		return out, nil
+	}
+	cql, err := ogc.CQL2JSONToText(body.Filter)
+	if err != nil {
+		return queryBody{}, fmt.Errorf("invalid filter: cql2-json: %w", err)
+	}
+	out.filter = cql
+	return out, nil
+}
+
+// readQueryBody returns the decoded body, refusing anything that inflates
+// past maxQueryBody so a small gzip bomb can't exhaust memory
+func readQueryBody(r *http.Request) ([]byte, error) {
+	var src io.Reader = r.Body
+	switch enc := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); enc {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(io.LimitReader(r.Body, maxQueryBody))
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid body: malformed gzip: %w", err)
+		}
+		defer func() { _ = zr.Close() }()
+		src = zr
+	default:
+		return nil, fmt.Errorf("invalid body: unsupported Content-Encoding %q", enc)
+	}
+	raw, err := io.ReadAll(io.LimitReader(src, maxQueryBody+1))
+	if err != nil {
+		if src != r.Body {
+			return nil, fmt.Errorf("invalid body: malformed gzip: %w", err)
+		}
+		return nil, fmt.Errorf("invalid body: read: %w", err)
+	}
+	if len(raw) > maxQueryBody {
+		return nil, fmt.Errorf("invalid body: exceeds %d bytes", maxQueryBody)
+	}
+	return raw, nil
+}
+
+// parses an RFC 3339 timestamp; empty means unbounded
+func parseTimeBound(raw string) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("want RFC 3339 timestamp: %w", err)
+	}
+	return t, nil
+}
+
+var sortPropertyPattern = regexp.MustCompile(`^[A-Za-z_][\w.\-]*$`)
+
+// parses sortby=[+|-]prop[:hint][:nulls][ ASC|DESC],... where hint is number,
+// time or string and nulls is nullsfirst or nullslast (default nullslast)
+func parseSortBy(raw string) ([]model.SortKey, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	parts := strings.Split(raw, ",")
+	out := make([]model.SortKey, 0, len(parts))
+	for _, part := range parts {
+		item := strings.TrimSpace(part)
+		if item == "" {
+			return nil, errors.New("empty sort key")
+		}
+
+		var k model.SortKey
+		switch item[0] {
+		case '-':
+			k.Desc = true
+			item = item[1:]
+		case '+':
+			item = item[1:]
+		}
+
+		if fields := strings.Fields(item); len(fields) == 2 {
+			switch strings.ToUpper(fields[1]) {
+			case "A", "ASC":
+				k.Desc = false
+			case "D", "DESC":
+				k.Desc = true
+			default:
+				return nil, fmt.Errorf("invalid direction %q", fields[1])
+			}
+			item = fields[0]
+		} else if len(fields) != 1 {
+			return nil, fmt.Errorf("malformed sort key %q", part)
+		}
+
+		segs := strings.Split(item, ":")
+		k.Property = segs[0]
+		if !sortPropertyPattern.MatchString(k.Property) {
+			return nil, fmt.Errorf("invalid property %q", k.Property)
+		}
+		nullsSet := false
+		for _, seg := range segs[1:] {
+			switch strings.ToLower(seg) {
+			case "nullsfirst", "nullslast":
+				if nullsSet {
+					return nil, fmt.Errorf("duplicate nulls directive for %q", k.Property)
+				}
+				nullsSet = true
+				k.NullsFirst = strings.EqualFold(seg, "nullsfirst")
+			case "number", "time", "string":
+				if k.TypeHint != "" {
+					return nil, fmt.Errorf("duplicate type hint for %q", k.Property)
+				}
+				k.TypeHint = strings.ToLower(seg)
+			default:
+				return nil, fmt.Errorf("unknown type hint %q for %q", seg, k.Property)
+			}
+		}
+		out = append(out, k)
+	}
+	return out, nil
+}
+
+// ParseBBOX parses a "x1,y1,x2,y2,EPSG:4326" bbox parameter
+func ParseBBOX(bboxParam string) (model.BBox, error) {
 	parts := strings.Split(bboxParam, ",")
 	if len(parts) != 5 {
 		return model.BBox{}, errors.New("expected 5 comma-separated values: x1,y1,x2,y2,EPSG:4326")
@@ -184,18 +827,38 @@ func isSafeCQL(s string) bool {
 	return safeCQLPattern.MatchString(s)
 }
 
-func parsePolygon(raw string) (model.Polygon, error) {
+// ParsePolygon parses a GeoJSON Polygon or MultiPolygon parameter
+func ParsePolygon(raw string) (model.Polygon, error) {
 	var tmp struct {
-		Type string `json:"type"`
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
 	}
 	if err := json.Unmarshal([]byte(raw), &tmp); err != nil {
 		return model.Polygon{}, fmt.Errorf("parse json: %w", err)
 	}
 	t := strings.TrimSpace(tmp.Type)
+	var n int
 	switch t {
-	case "Polygon", "MultiPolygon":
-		return model.Polygon{GeoJSON: raw}, nil
+	case "Polygon":
+		var rings [][]json.RawMessage
+		if err := json.Unmarshal(tmp.Coordinates, &rings); err != nil {
+			return model.Polygon{}, fmt.Errorf("parse coordinates: %w", err)
+		}
+		for _, ring := range rings {
+			n += len(ring)
+		}
+	case "MultiPolygon":
+		var polys [][][]json.RawMessage
+		if err := json.Unmarshal(tmp.Coordinates, &polys); err != nil {
+			return model.Polygon{}, fmt.Errorf("parse coordinates: %w", err)
+		}
+		for _, rings := range polys {
+			for _, ring := range rings {
+				n += len(ring)
+			}
+		}
 	default:
 		return model.Polygon{}, fmt.Errorf(`unsupported GeoJSON "type": %q (must be Polygon or MultiPolygon)`, t)
 	}
+	return model.Polygon{GeoJSON: raw, Vertices: n}, nil
 }
@@ -1,10 +1,15 @@
 package router
 
 import (
+	"bytes"
+	"compress/gzip"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/keys"
 )
 
 func TestParseQueryRequest_PolygonPrecedence(t *testing.T) {
@@ -45,7 +50,219 @@ func TestParseQueryRequest_InvalidFilters(t *testing.T) {
 }
 
 func TestParseBBOX_InvalidGeometry(t *testing.T) {
-	if _, err := parseBBOX("11,55,11,56,EPSG:4326"); err == nil {
+	if _, err := ParseBBOX("11,55,11,56,EPSG:4326"); err == nil {
 		t.Fatalf("expected error for non-increasing bbox coordinates")
 	}
 }
+
+func TestParseQueryRequest_SortByTypeHints(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/query", nil)
+	q := url.Values{}
+	q.Set("layer", "demo:NR_polygon")
+	q.Set("sortby", "-score:number,ts:time,name")
+	req.URL.RawQuery = q.Encode()
+
+	got, _, err := ParseQueryRequest(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got.Sort) != 3 {
+		t.Fatalf("sort keys=%d want 3", len(got.Sort))
+	}
+	if k := got.Sort[0]; k.Property != "score" || !k.Desc || k.TypeHint != "number" {
+		t.Fatalf("key0=%+v", k)
+	}
+	if k := got.Sort[1]; k.Property != "ts" || k.Desc || k.TypeHint != "time" {
+		t.Fatalf("key1=%+v", k)
+	}
+	if k := got.Sort[2]; k.Property != "name" || k.TypeHint != "" {
+		t.Fatalf("key2=%+v", k)
+	}
+}
+
+func TestParseQueryRequest_SortByUnknownHint(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/query", nil)
+	q := url.Values{}
+	q.Set("layer", "demo:NR_polygon")
+	q.Set("sortby", "score:decimal")
+	req.URL.RawQuery = q.Encode()
+
+	if _, _, err := ParseQueryRequest(req); err == nil {
+		t.Fatalf("expected error for unknown type hint")
+	}
+}
+
+func TestParseQueryRequest_SortByNullsDirective(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/query", nil)
+	q := url.Values{}
+	q.Set("layer", "demo:NR_polygon")
+	q.Set("sortby", "ts:time:nullsfirst,score:nullslast:number,name")
+	req.URL.RawQuery = q.Encode()
+
+	got, _, err := ParseQueryRequest(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if k := got.Sort[0]; !k.NullsFirst || k.TypeHint != "time" {
+		t.Fatalf("key0=%+v", k)
+	}
+	if k := got.Sort[1]; k.NullsFirst || k.TypeHint != "number" {
+		t.Fatalf("key1=%+v", k)
+	}
+	if got.Sort[2].NullsFirst {
+		t.Fatalf("default should be nulls last, got %+v", got.Sort[2])
+	}
+}
+
+func TestParseQueryRequest_GeomPrecision(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/query?layer=demo&geomPrecision=8", nil)
+	got, _, err := ParseQueryRequest(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.GeomPrecision != 8 {
+		t.Fatalf("GeomPrecision=%d want 8", got.GeomPrecision)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/query?layer=demo&geomPrecision=42", nil)
+	if _, _, err := ParseQueryRequest(req); err == nil {
+		t.Fatalf("expected error for out-of-range geomPrecision")
+	}
+}
+
+func TestParseQueryRequest_CreatedRange(t *testing.T) {
+	parse := func(after, before string) error {
+		req := httptest.NewRequest(http.MethodGet, "/query", nil)
+		q := url.Values{}
+		q.Set("layer", "demo:NR_polygon")
+		if after != "" {
+			q.Set("created_after", after)
+		}
+		if before != "" {
+			q.Set("created_before", before)
+		}
+		req.URL.RawQuery = q.Encode()
+		got, _, err := ParseQueryRequest(req)
+		if err == nil && after != "" && got.CreatedAfter.IsZero() {
+			t.Fatalf("CreatedAfter not set for %q", after)
+		}
+		return err
+	}
+
+	if err := parse("2024-01-01T00:00:00Z", "2024-06-30T00:00:00+02:00"); err != nil {
+		t.Fatalf("valid range: %v", err)
+	}
+	if err := parse("2024-01-01", ""); err == nil {
+		t.Fatalf("expected error for non-RFC 3339 created_after")
+	}
+	if err := parse("2024-06-30T00:00:00Z", "2024-01-01T00:00:00Z"); err == nil {
+		t.Fatalf("expected error for inverted range")
+	}
+}
+
+func TestParseQueryRequest_GzipPolygonBody(t *testing.T) {
+	var ring strings.Builder
+	ring.WriteString("[11,55]")
+	for i := 1; i < 2000; i++ {
+		ring.WriteString(",[11.5,55.5]")
+	}
+	ring.WriteString(",[11,55]")
+	body := `{"polygon":{"type":"Polygon","coordinates":[[` + ring.String() + `]]}}`
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write([]byte(body))
+	_ = zw.Close()
+
+	post := func(payload []byte, enc string) error {
+		req := httptest.NewRequest(http.MethodPost, "/query?layer=demo:NR_polygon", bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Encoding", enc)
+		_, _, err := ParseQueryRequest(req)
+		return err
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/query?layer=demo:NR_polygon", bytes.NewReader(gz.Bytes()))
+	req.Header.Set("Content-Encoding", "gzip")
+	got, _, err := ParseQueryRequest(req)
+	if err != nil {
+		t.Fatalf("gzip body: %v", err)
+	}
+	if got.Polygon == nil || got.Polygon.Vertices != 2001 {
+		t.Fatalf("polygon=%+v want 2001 vertices", got.Polygon)
+	}
+
+	if err := post([]byte("not gzip"), "gzip"); err == nil || !strings.Contains(err.Error(), "malformed gzip") {
+		t.Fatalf("malformed gzip: err=%v", err)
+	}
+	if err := post(gz.Bytes()[:gz.Len()/2], "gzip"); err == nil {
+		t.Fatalf("expected error for truncated gzip")
+	}
+	if err := post([]byte(body), "br"); err == nil {
+		t.Fatalf("expected error for unsupported Content-Encoding")
+	}
+
+	// a tiny gzip that inflates past the cap is refused
+	var bomb bytes.Buffer
+	zw = gzip.NewWriter(&bomb)
+	_, _ = zw.Write(bytes.Repeat([]byte(" "), maxQueryBody+1))
+	_ = zw.Close()
+	if err := post(bomb.Bytes(), "gzip"); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Fatalf("oversized body: err=%v", err)
+	}
+}
+
+func TestParseQueryRequest_CQL2JSONBodyIsVetted(t *testing.T) {
+	post := func(body string) (string, error) {
+		req := httptest.NewRequest(http.MethodPost, "/query?layer=demo:NR_polygon", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		got, _, err := ParseQueryRequest(req)
+		return got.Filters, err
+	}
+
+	got, err := post(`{"filter-lang":"cql2-json","filter":{"op":"=","args":[{"property":"name"},"Stockholm"]}}`)
+	if err != nil || got != "name = 'Stockholm'" {
+		t.Fatalf("filters=%q err=%v", got, err)
+	}
+
+	// LIKE wildcards are rejected on GET, so the body can't smuggle them in
+	if _, err := post(`{"filter":{"op":"like","args":[{"property":"name"},"Stock%"]}}`); err == nil {
+		t.Fatalf("expected disallowed characters to be rejected")
+	}
+
+	vals := make([]string, 200)
+	for i := range vals {
+		vals[i] = `"value"`
+	}
+	long := `{"filter":{"op":"in","args":[{"property":"name"},[` + strings.Join(vals, ",") + `]]}}`
+	if _, err := post(long); err == nil {
+		t.Fatalf("expected a translated filter over 500 chars to be rejected")
+	}
+}
+
+func TestPassthroughHeaders_EquivalentAcceptLanguageSharesScope(t *testing.T) {
+	scope := func(v string) (string, map[string]string) {
+		req := httptest.NewRequest(http.MethodGet, "/query", nil)
+		req.Header.Set("Accept-Language", v)
+		h := passthroughHeaders(req, []string{"accept-language"})
+		return keys.ScopedLayer("demo:NR_polygon", h), h
+	}
+
+	base, h := scope("en-US,en;q=0.9")
+	if h["Accept-Language"] != "en-us" {
+		t.Fatalf("forwarded Accept-Language=%q want en-us", h["Accept-Language"])
+	}
+	for _, v := range []string{"en-US,en;q=0.8", "en-us", " EN-US ; q=1 , sv;q=0.5", "sv;q=0.4, en-US;q=0.7"} {
+		if got, _ := scope(v); got != base {
+			t.Fatalf("%q scoped to %s, want %s", v, got, base)
+		}
+	}
+	if got, _ := scope("sv,en-US;q=0.9"); got == base {
+		t.Fatalf("a different preferred language should get its own scope")
+	}
+	for _, v := range []string{"*", "en;q=0", "en;q=abc"} {
+		if _, h := scope(v); h != nil {
+			t.Fatalf("%q should forward no Accept-Language, got %v", v, h)
+		}
+	}
+}
@@ -7,7 +7,7 @@ import (
 )
 
 func TestParseBBOX_Valid(t *testing.T) {
-	bb, err := parseBBOX("11.0,55.0,12.0,56.0,EPSG:4326")
+	bb, err := ParseBBOX("11.0,55.0,12.0,56.0,EPSG:4326")
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
@@ -18,7 +18,7 @@ func TestParseBBOX_Valid(t *testing.T) {
 }
 
 func TestParseBBOX_InvalidSRID(t *testing.T) {
-	_, err := parseBBOX("11,55,12,56,EPSG:3857")
+	_, err := ParseBBOX("11,55,12,56,EPSG:3857")
 	if err == nil {
 		t.Fatal("expected error for SRID")
 	}
@@ -26,19 +26,22 @@ func TestParseBBOX_InvalidSRID(t *testing.T) {
 
 func TestParsePolygon_TypeChecks(t *testing.T) {
 	// valid polygon
-	_, err := parsePolygon(`{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,1],[0,0]]]}`)
+	_, err := ParsePolygon(`{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,1],[0,0]]]}`)
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
 
 	// valid multipolygon
-	_, err = parsePolygon(`{"type":"MultiPolygon","coordinates":[[[[0,0],[1,0],[1,1],[0,1],[0,0]]]]}`)
+	p, err := ParsePolygon(`{"type":"MultiPolygon","coordinates":[[[[0,0],[1,0],[1,1],[0,1],[0,0]]],[[[2,2],[3,2],[3,3],[2,2]]]]}`)
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
+	if p.Vertices != 9 {
+		t.Fatalf("Vertices=%d want 9", p.Vertices)
+	}
 
 	// invalid type
-	_, err = parsePolygon(`{"type":"LineString","coordinates":[[0,0],[1,1]]}`)
+	_, err = ParsePolygon(`{"type":"LineString","coordinates":[[0,0],[1,1]]}`)
 	if err == nil {
 		t.Fatal("expected error for non-polygon type")
 	}
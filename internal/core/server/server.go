@@ -11,38 +11,68 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/admin"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/health"
 	middleware "github.com/mohammed-shakir/h3-spatial-cache/internal/core/middleware"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/router"
+	h3mapper "github.com/mohammed-shakir/h3-spatial-cache/internal/mapper/h3"
+	invkafka "github.com/mohammed-shakir/h3-spatial-cache/pkg/invalidation/kafka"
 )
 
-// Run sets up http and starts serving
-func Run(ctx context.Context, cfg config.Config, logger *slog.Logger, handler router.QueryHandler, rr health.ReadinessReporter) error {
+// Run sets up http and starts serving; sh, when non-nil, replays /query
+// requests through a shadow engine
+func Run(ctx context.Context, cfg config.Config, logger *slog.Logger, handler router.QueryHandler, sh router.Shadower, rr health.ReadinessReporter) error {
 	r := chi.NewRouter()
 	r.Use(middleware.Recover())
 	r.Use(middleware.Logging(logger))
-	r.Use(middleware.CORS())
+	r.Use(middleware.CORS(cfg.CORSAllowedOrigins))
 
 	r.Get("/healthz", health.Liveness())
 	if rr != nil {
 		r.Get("/health/ready", health.Readiness(rr))
 	}
 	r.Get("/metrics", promhttp.Handler().ServeHTTP)
-	r.Get("/query", router.HandleQuery(logger, cfg, handler))
+	r.Get("/version", health.Version(versionInfo(cfg)))
+	// one admission limit shared by every /query method
+	admit := middleware.Admit(cfg.Server.MaxConcurrent, cfg.Server.MaxQueue, cfg.Server.QueueWait)
+	r.Method(http.MethodGet, "/query", queryHandler(logger, cfg, handler, sh, admit))
+	r.Method(http.MethodHead, "/query", admit(router.HandleQuery(logger, cfg, handler)))
+	// POST carries a CQL2-JSON filter body, which the coalescing signature can't see
+	r.Method(http.MethodPost, "/query", admit(router.HandleQueryShadowed(logger, cfg, handler, sh)))
 
-	srv := &http.Server{
-		Addr:              cfg.Addr,
-		Handler:           r,
-		ReadHeaderTimeout: 5 * time.Second,
-		ReadTimeout:       15 * time.Second,
-		WriteTimeout:      60 * time.Second,
-		IdleTimeout:       60 * time.Second,
+	if fh, ok := handler.(router.FeatureHandler); ok {
+		r.Get("/features", router.HandleFeatures(logger, cfg, fh))
+	}
+
+	if hp, ok := handler.(admin.HotnessProvider); ok {
+		r.Post("/admin/hotness/reset", admin.HotnessReset(hp))
+		r.Post("/admin/hotness/half-life", admin.HotnessHalfLife(hp))
+	}
+	if sp, ok := handler.(admin.StatsProvider); ok {
+		r.Get("/admin/stats", admin.CacheStats(sp))
+		r.Head("/admin/stats", admin.CacheStats(sp))
 	}
+	if ci, ok := handler.(admin.CellInspector); ok {
+		r.Get("/admin/cell", admin.CellStatus(cfg, ci))
+		r.Head("/admin/cell", admin.CellStatus(cfg, ci))
+	}
+	if fp, ok := handler.(admin.Filler); ok {
+		r.Post("/admin/fill", admin.CacheFill(cfg, fp))
+	}
+	r.Get("/admin/cells", admin.Cells(cfg, h3mapper.New()))
+	r.Head("/admin/cells", admin.Cells(cfg, h3mapper.New()))
+	r.Get("/admin/config", admin.Config(map[string]any{
+		"config":       cfg,
+		"invalidation": invkafka.FromEnv(),
+	}))
+
+	srv := newHTTPServer(cfg, r)
 
 	errCh := make(chan error, 1)
 	go func() {
-		logger.Info("http listen", "addr", cfg.Addr)
+		logger.Info("http listen", "addr", cfg.Addr, "h2c", cfg.Server.H2C)
 		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
 			errCh <- err
 		}
@@ -58,3 +88,53 @@ func Run(ctx context.Context, cfg config.Config, logger *slog.Logger, handler ro
 		return err
 	}
 }
+
+// builds the http server from config; h2c additionally accepts cleartext HTTP/2
+func newHTTPServer(cfg config.Config, h http.Handler) *http.Server {
+	sc := cfg.Server
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           h,
+		ReadHeaderTimeout: sc.ReadHeaderTimeout,
+		ReadTimeout:       sc.ReadTimeout,
+		WriteTimeout:      sc.WriteTimeout,
+		IdleTimeout:       sc.IdleTimeout,
+		MaxHeaderBytes:    sc.MaxHeaderBytes,
+	}
+	if sc.H2C {
+		var p http.Protocols
+		p.SetHTTP1(true)
+		p.SetUnencryptedHTTP2(true)
+		srv.Protocols = &p
+	}
+	return srv
+}
+
+// combines recorded build metadata with the active scenario settings
+func versionInfo(cfg config.Config) health.VersionInfo {
+	bi := observability.GetBuildInfo()
+	return health.VersionInfo{
+		Version:   bi.Version,
+		Revision:  bi.Revision,
+		Branch:    bi.Branch,
+		BuildDate: bi.BuildDate,
+		Scenario:  cfg.Scenario,
+		H3Res:     cfg.H3Res,
+		H3ResMin:  cfg.H3ResMin,
+		H3ResMax:  cfg.H3ResMax,
+	}
+}
+
+// queryHandler wraps /query with request coalescing when enabled; Accept, the
+// passthrough headers and X-Request-Timeout select the response so they are
+// part of the signature.
+// admit sits inside coalescing so requests waiting on a leader hold no slot,
+// and waiters are still observed and counted toward hotness
+func queryHandler(logger *slog.Logger, cfg config.Config, handler router.QueryHandler, sh router.Shadower, admit func(http.Handler) http.Handler) http.Handler {
+	h := admit(router.HandleQueryShadowed(logger, cfg, handler, sh))
+	if !cfg.Features.RequestCoalescing {
+		return h
+	}
+	vary := append([]string{"Accept", "X-Request-Timeout"}, cfg.PassthroughHeaders...)
+	return middleware.Coalesce(vary, router.RecordCoalesced(cfg, handler))(h)
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+)
+
+func TestNewHTTPServer_AppliesConfiguredTimeouts(t *testing.T) {
+	cfg := config.Config{
+		Addr: ":0",
+		Server: config.ServerCfg{
+			ReadHeaderTimeout: 2 * time.Second,
+			ReadTimeout:       3 * time.Second,
+			WriteTimeout:      5 * time.Minute,
+			IdleTimeout:       7 * time.Second,
+			MaxHeaderBytes:    4096,
+		},
+	}
+	srv := newHTTPServer(cfg, http.NotFoundHandler())
+
+	if srv.ReadHeaderTimeout != 2*time.Second || srv.ReadTimeout != 3*time.Second {
+		t.Fatalf("read timeouts not applied: %v/%v", srv.ReadHeaderTimeout, srv.ReadTimeout)
+	}
+	if srv.WriteTimeout != 5*time.Minute {
+		t.Fatalf("WriteTimeout=%v want 5m", srv.WriteTimeout)
+	}
+	if srv.IdleTimeout != 7*time.Second || srv.MaxHeaderBytes != 4096 {
+		t.Fatalf("idle/max header not applied: %v/%d", srv.IdleTimeout, srv.MaxHeaderBytes)
+	}
+	if srv.Protocols != nil {
+		t.Fatalf("h2c should be off by default")
+	}
+}
+
+func TestNewHTTPServer_H2C(t *testing.T) {
+	cfg := config.Config{Server: config.ServerCfg{H2C: true, ReadHeaderTimeout: time.Second}}
+	srv := newHTTPServer(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Proto)
+	}))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	var p http.Protocols
+	p.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: &p}, Timeout: 5 * time.Second}
+
+	resp, err := client.Get("http://" + ln.Addr().String() + "/")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "HTTP/2.0" {
+		t.Fatalf("proto=%q want HTTP/2.0", body)
+	}
+}
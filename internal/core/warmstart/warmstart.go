@@ -0,0 +1,134 @@
+// Package warmstart preloads the cache from a manifest before the service
+// reports ready, so benchmark runs don't start from a cold cache.
+package warmstart
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	h3 "github.com/uber/h3-go/v4"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/health"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/router"
+)
+
+// Entry is one unit of warm-up work. Cells lists explicit H3 cells at
+// Query.H3Res; without cells Query.BBox is filled like POST /admin/fill
+type Entry struct {
+	Query model.QueryRequest
+	Cells []string
+	Line  int // manifest line the entry starts on
+}
+
+// Warmer is implemented by scenarios that can preload their cache
+type Warmer interface {
+	Warm(ctx context.Context, entries []Entry) error
+}
+
+// Load reads the manifest at path; see Parse
+func Load(path string, cfg config.Config) ([]Entry, error) {
+	f, err := os.Open(path) // #nosec G304 -- operator-supplied manifest path
+	if err != nil {
+		return nil, fmt.Errorf("open warm manifest: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	return Parse(f, cfg)
+}
+
+// Parse reads a manifest with one "<layer> <res> <target>" entry per line,
+// where target is an H3 cell at res or a /query-style "x1,y1,x2,y2,SRID"
+// bbox (res 0 uses the base resolution). Blank lines and "#" comments are
+// skipped.
+// Layers go through LAYER_ALIASES and the allow/deny lists like /query, and
+// consecutive cell lines for the same layer and res are merged into one
+// entry so they fill concurrently
+func Parse(r io.Reader, cfg config.Config) ([]Entry, error) {
+	var out []Entry
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("warm manifest line %d: want \"<layer> <res> <cell|bbox>\", got %d fields", n, len(fields))
+		}
+		layer := config.ResolveLayer(cfg.LayerAliases, fields[0])
+		if !config.LayerAllowed(cfg.LayersAllow, cfg.LayersDeny, layer) {
+			return nil, fmt.Errorf("warm manifest line %d: layer %q is not allowed", n, layer)
+		}
+		res, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("warm manifest line %d: res %q: %w", n, fields[1], err)
+		}
+		if res != 0 && (res < cfg.H3ResMin || res > cfg.H3ResMax) {
+			return nil, fmt.Errorf("warm manifest line %d: res %d outside the configured range [%d,%d]", n, res, cfg.H3ResMin, cfg.H3ResMax)
+		}
+		q := model.QueryRequest{
+			Layer:            layer,
+			H3Res:            res,
+			GeometryProperty: config.GeometryPropertyFor(cfg.GeometryProperties, layer),
+			CQLSRID:          config.CQLSRIDFor(cfg.CQLSRIDs, layer),
+		}
+
+		target := fields[2]
+		if strings.Contains(target, ",") {
+			bb, err := router.ParseBBOX(target)
+			if err != nil {
+				return nil, fmt.Errorf("warm manifest line %d: bbox: %w", n, err)
+			}
+			q.BBox = &bb
+			out = append(out, Entry{Query: q, Line: n})
+			continue
+		}
+
+		var c h3.Cell
+		if err := c.UnmarshalText([]byte(target)); err != nil || !c.IsValid() {
+			return nil, fmt.Errorf("warm manifest line %d: invalid h3 cell %q", n, target)
+		}
+		if c.Resolution() != res {
+			return nil, fmt.Errorf("warm manifest line %d: cell %s is res %d, not %d", n, target, c.Resolution(), res)
+		}
+		if k := len(out) - 1; k >= 0 && len(out[k].Cells) > 0 && out[k].Query.Layer == layer && out[k].Query.H3Res == res {
+			out[k].Cells = append(out[k].Cells, c.String())
+			continue
+		}
+		out = append(out, Entry{Query: q, Cells: []string{c.String()}, Line: n})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read warm manifest: %w", err)
+	}
+	return out, nil
+}
+
+// Start warms w from entries in the background. The returned reporter is
+// not ready until every entry has been tried; failures are logged and don't
+// hold readiness back, since a half-warm cache still serves correctly
+func Start(ctx context.Context, w Warmer, entries []Entry, logger *slog.Logger) health.ReadinessReporter {
+	g := &gate{}
+	go func() {
+		start := time.Now()
+		if err := w.Warm(ctx, entries); err != nil {
+			logger.Error("warm start incomplete", "entries", len(entries), "duration", time.Since(start).String(), "err", err)
+		} else {
+			logger.Info("warm start complete", "entries", len(entries), "duration", time.Since(start).String())
+		}
+		g.done.Store(true)
+	}()
+	return g
+}
+
+type gate struct{ done atomic.Bool }
+
+func (g *gate) Readiness() (bool, []int32) { return g.done.Load(), nil }
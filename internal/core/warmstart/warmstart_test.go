@@ -0,0 +1,56 @@
+package warmstart
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+)
+
+func TestParse(t *testing.T) {
+	cfg := config.Config{H3ResMin: 7, H3ResMax: 9, LayerAliases: map[string]string{"nr": "demo:NR_polygon"}}
+	manifest := `
+# cells merge while layer and res stay the same
+nr 8 881f1d4887fffff
+demo:NR_polygon 8 881f1d4881fffff  # trailing comment
+demo:NR_polygon 9 891f1d48877ffff
+demo:NR_polygon 0 18.0,59.3,18.1,59.4,EPSG:4326
+demo:NR_polygon 8 881f1d4887fffff
+`
+	entries, err := Parse(strings.NewReader(manifest), cfg)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("entries=%d want 4: %+v", len(entries), entries)
+	}
+	if e := entries[0]; e.Query.Layer != "demo:NR_polygon" || e.Query.H3Res != 8 || len(e.Cells) != 2 || e.Line != 3 {
+		t.Fatalf("first entry=%+v", e)
+	}
+	if e := entries[1]; e.Query.H3Res != 9 || len(e.Cells) != 1 {
+		t.Fatalf("res 9 entry=%+v", e)
+	}
+	if e := entries[2]; e.Query.BBox == nil || len(e.Cells) != 0 || e.Query.H3Res != 0 {
+		t.Fatalf("bbox entry=%+v", e)
+	}
+	if e := entries[3]; len(e.Cells) != 1 || e.Line != 7 {
+		t.Fatalf("cells after a bbox start a new entry: %+v", e)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	cfg := config.Config{H3ResMin: 7, H3ResMax: 9, LayersDeny: []string{"secret:*"}}
+	for name, line := range map[string]string{
+		"fields":       "demo:NR_polygon 881f1d4887fffff",
+		"res":          "demo:NR_polygon eight 881f1d4887fffff",
+		"range":        "demo:NR_polygon 12 18.0,59.3,18.1,59.4,EPSG:4326",
+		"cell":         "demo:NR_polygon 8 not-a-cell",
+		"cell res":     "demo:NR_polygon 9 881f1d4887fffff",
+		"bbox":         "demo:NR_polygon 8 18.0,59.3,18.1",
+		"denied layer": "secret:x 8 881f1d4887fffff",
+	} {
+		if _, err := Parse(strings.NewReader(line), cfg); err == nil {
+			t.Errorf("%s: %q parsed without error", name, line)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+// Package layerres watches each layer's cell miss rate and features per cell
+// over a sliding window and suggests moving the layer's base H3 resolution,
+// closing the loop at the layer level where the adaptive decider works per
+// request.
+package layerres
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
+)
+
+// buckets per window; observations older than the window drop out a bucket
+// at a time
+const buckets = 10
+
+// an H3 cell has 7 children, so a parent holds roughly 7x the features
+const aperture = 7
+
+type Config struct {
+	BaseRes, MinRes, MaxRes int
+	Window                  time.Duration
+	Interval                time.Duration // how often layers are evaluated
+	MinCells                int           // cells a window must hold before it is judged
+	// MissRate at or above which the layer's cells are too fine to be reused
+	// and a coarser resolution is suggested
+	MissRate float64
+	// MaxFeatures per cell above which cells are too heavy and a finer
+	// resolution is suggested; 0 disables. A coarser move is held back when
+	// it would land above it
+	MaxFeatures float64
+	// Apply moves the layer's base resolution; otherwise suggestions are only
+	// logged and counted
+	Apply bool
+	// MaxLayers bounds the layers tracked at once; observations of further
+	// layers are dropped until idle ones are evicted. 0 means 1000
+	MaxLayers int
+}
+
+// Suggestion is one resolution move for a layer and the window behind it
+type Suggestion struct {
+	Layer       string
+	From, To    int
+	MissRate    float64
+	AvgFeatures float64
+	Cells       int
+	Applied     bool
+}
+
+// Direction is "finer" or "coarser"
+func (s Suggestion) Direction() string {
+	if s.To > s.From {
+		return "finer"
+	}
+	return "coarser"
+}
+
+type bucket struct {
+	start                   time.Time
+	cells, misses, features int
+}
+
+type layerState struct {
+	res     int
+	buckets []bucket
+	// last suggestion made, so a standing condition isn't reported every tick
+	suggested int
+}
+
+type Analyzer struct {
+	cfg    Config
+	logger *slog.Logger
+	now    func() time.Time
+
+	mu     sync.Mutex
+	layers map[string]*layerState
+}
+
+func New(cfg Config, logger *slog.Logger) *Analyzer {
+	if cfg.Window <= 0 {
+		cfg.Window = 5 * time.Minute
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = cfg.Window / buckets
+	}
+	if cfg.MaxLayers <= 0 {
+		cfg.MaxLayers = 1000
+	}
+	return &Analyzer{
+		cfg:    cfg,
+		logger: logger,
+		now:    time.Now,
+		layers: map[string]*layerState{},
+	}
+}
+
+// Res is the base resolution for layer: the last applied move, or BaseRes
+func (a *Analyzer) Res(layer string) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if st, ok := a.layers[layer]; ok {
+		return st.res
+	}
+	return a.cfg.BaseRes
+}
+
+// Observe records one served query: cells looked up at res, how many of them
+// missed, and the features they held. Observations at any resolution other
+// than the layer's current base (pinned or adaptive requests) are ignored so
+// a window only ever describes one resolution
+func (a *Analyzer) Observe(layer string, res, cells, misses, features int) {
+	if cells <= 0 {
+		return
+	}
+	now := a.now()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	st, ok := a.layers[layer]
+	if !ok {
+		if len(a.layers) >= a.cfg.MaxLayers {
+			return
+		}
+		st = &layerState{res: a.cfg.BaseRes}
+		a.layers[layer] = st
+	}
+	if res != st.res {
+		return
+	}
+	width := a.cfg.Window / buckets
+	if n := len(st.buckets); n == 0 || now.Sub(st.buckets[n-1].start) >= width {
+		st.buckets = append(st.buckets, bucket{start: now})
+	}
+	b := &st.buckets[len(st.buckets)-1]
+	b.cells += cells
+	b.misses += misses
+	b.features += features
+}
+
+// Evaluate judges every layer's window as of now and returns the moves it
+// suggests, in layer order. Applied moves reset the layer's window, since
+// what was seen at the old resolution says nothing about the new one. Layers
+// with an empty window still at BaseRes are evicted: nothing is lost by
+// forgetting them
+func (a *Analyzer) Evaluate() []Suggestion {
+	now := a.now()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	names := make([]string, 0, len(a.layers))
+	for name := range a.layers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var out []Suggestion
+	for _, name := range names {
+		st := a.layers[name]
+		st.buckets = slices.DeleteFunc(st.buckets, func(b bucket) bool { return now.Sub(b.start) >= a.cfg.Window })
+		var cells, misses, features int
+		for _, b := range st.buckets {
+			cells += b.cells
+			misses += b.misses
+			features += b.features
+		}
+		if len(st.buckets) == 0 && st.res == a.cfg.BaseRes {
+			delete(a.layers, name)
+			continue
+		}
+		if cells == 0 || cells < a.cfg.MinCells {
+			st.suggested = st.res
+			continue
+		}
+		s := Suggestion{
+			Layer:       name,
+			From:        st.res,
+			To:          st.res,
+			MissRate:    float64(misses) / float64(cells),
+			AvgFeatures: float64(features) / float64(cells),
+			Cells:       cells,
+		}
+		switch {
+		case a.cfg.MaxFeatures > 0 && s.AvgFeatures > a.cfg.MaxFeatures && st.res < a.cfg.MaxRes:
+			s.To = st.res + 1
+		case a.cfg.MissRate > 0 && s.MissRate >= a.cfg.MissRate && st.res > a.cfg.MinRes &&
+			(a.cfg.MaxFeatures <= 0 || s.AvgFeatures*aperture <= a.cfg.MaxFeatures):
+			s.To = st.res - 1
+		}
+		if s.To == st.res {
+			st.suggested = st.res
+			continue
+		}
+		if !a.cfg.Apply && st.suggested == s.To {
+			continue
+		}
+		st.suggested = s.To
+		if a.cfg.Apply {
+			s.Applied = true
+			st.res = s.To
+			st.buckets = nil
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// Run evaluates every Interval until ctx is done, logging and counting each
+// suggestion
+func (a *Analyzer) Run(ctx context.Context) {
+	t := time.NewTicker(a.cfg.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		for _, s := range a.Evaluate() {
+			observability.IncLayerResChange(s.Layer, s.Direction(), s.Applied)
+			if s.Applied {
+				observability.SetLayerResolution(s.Layer, s.To)
+			}
+			a.logger.Info("layer resolution change",
+				"layer", s.Layer,
+				"from", s.From,
+				"to", s.To,
+				"direction", s.Direction(),
+				"applied", s.Applied,
+				"miss_rate", s.MissRate,
+				"avg_features", s.AvgFeatures,
+				"cells", s.Cells,
+				"window", a.cfg.Window.String(),
+			)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package layerres
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func newTestAnalyzer(cfg Config) (*Analyzer, *time.Time) {
+	a := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	now := time.Unix(1_700_000_000, 0)
+	a.now = func() time.Time { return now }
+	return a, &now
+}
+
+func TestAnalyzer_HighMissRateSuggestsCoarser(t *testing.T) {
+	a, now := newTestAnalyzer(Config{
+		BaseRes: 8, MinRes: 6, MaxRes: 10,
+		Window: time.Minute, MinCells: 100, MissRate: 0.8, MaxFeatures: 500,
+	})
+
+	// 90% of cells miss on "roads", 20% on "parks"
+	for range 20 {
+		a.Observe("roads", 8, 10, 9, 50)
+		a.Observe("parks", 8, 10, 2, 50)
+		*now = now.Add(time.Second)
+	}
+	got := a.Evaluate()
+	if len(got) != 1 {
+		t.Fatalf("suggestions=%+v want one for roads", got)
+	}
+	s := got[0]
+	if s.Layer != "roads" || s.From != 8 || s.To != 7 || s.Direction() != "coarser" || s.Applied {
+		t.Fatalf("suggestion=%+v", s)
+	}
+	if s.MissRate != 0.9 || s.AvgFeatures != 5 || s.Cells != 200 {
+		t.Fatalf("window stats=%+v", s)
+	}
+	if a.Res("roads") != 8 {
+		t.Fatalf("suggest-only analyzer moved roads to %d", a.Res("roads"))
+	}
+
+	// a standing condition is reported once, not every tick
+	if again := a.Evaluate(); len(again) != 0 {
+		t.Fatalf("repeat suggestions=%+v", again)
+	}
+
+	// once the misses age out of the window there is nothing left to judge
+	*now = now.Add(time.Minute)
+	a.Observe("roads", 8, 10, 1, 50)
+	if got := a.Evaluate(); len(got) != 0 {
+		t.Fatalf("stale window still suggested %+v", got)
+	}
+}
+
+func TestAnalyzer_HeavyCellsSuggestFiner(t *testing.T) {
+	a, _ := newTestAnalyzer(Config{
+		BaseRes: 8, MinRes: 6, MaxRes: 9,
+		Window: time.Minute, MinCells: 10, MissRate: 0.8, MaxFeatures: 100,
+	})
+	// heavy cells win over the miss rate: coarser would only make them heavier
+	a.Observe("buildings", 8, 10, 10, 5000)
+	got := a.Evaluate()
+	if len(got) != 1 || got[0].To != 9 || got[0].Direction() != "finer" {
+		t.Fatalf("suggestions=%+v want finer", got)
+	}
+
+	// a coarser move that would land over MaxFeatures is held back
+	b, _ := newTestAnalyzer(Config{
+		BaseRes: 8, MinRes: 6, MaxRes: 9,
+		Window: time.Minute, MinCells: 10, MissRate: 0.8, MaxFeatures: 100,
+	})
+	b.Observe("buildings", 8, 10, 10, 200)
+	if got := b.Evaluate(); len(got) != 0 {
+		t.Fatalf("suggestions=%+v want none (20 per cell, ~140 coarser)", got)
+	}
+}
+
+func TestAnalyzer_ApplyMovesResolutionAndResetsWindow(t *testing.T) {
+	a, now := newTestAnalyzer(Config{
+		BaseRes: 8, MinRes: 7, MaxRes: 9,
+		Window: time.Minute, MinCells: 10, MissRate: 0.5, Apply: true,
+	})
+	a.Observe("roads", 8, 20, 20, 0)
+	got := a.Evaluate()
+	if len(got) != 1 || !got[0].Applied || a.Res("roads") != 7 {
+		t.Fatalf("suggestions=%+v res=%d want applied move to 7", got, a.Res("roads"))
+	}
+
+	// observations at the old resolution no longer count
+	a.Observe("roads", 8, 20, 20, 0)
+	if got := a.Evaluate(); len(got) != 0 {
+		t.Fatalf("old-res observations produced %+v", got)
+	}
+
+	// MinRes bounds further moves
+	*now = now.Add(time.Second)
+	a.Observe("roads", 7, 20, 20, 0)
+	if got := a.Evaluate(); len(got) != 0 || a.Res("roads") != 7 {
+		t.Fatalf("moved below MinRes: %+v res=%d", got, a.Res("roads"))
+	}
+	if a.Res("unseen") != 8 {
+		t.Fatalf("unseen layer res=%d want base", a.Res("unseen"))
+	}
+}
+
+func TestAnalyzer_BoundsTrackedLayers(t *testing.T) {
+	a, now := newTestAnalyzer(Config{
+		BaseRes: 8, MinRes: 7, MaxRes: 9,
+		Window: time.Minute, MinCells: 10, MissRate: 0.5, Apply: true, MaxLayers: 2,
+	})
+	a.Observe("roads", 8, 20, 20, 0)
+	a.Observe("parks", 8, 1, 0, 0)
+	a.Observe("rivers", 8, 1, 0, 0)
+	if len(a.layers) != 2 {
+		t.Fatalf("tracked %d layers, want the cap of 2", len(a.layers))
+	}
+	if got := a.Evaluate(); len(got) != 1 || a.Res("roads") != 7 {
+		t.Fatalf("suggestions=%+v res=%d want roads moved to 7", got, a.Res("roads"))
+	}
+
+	// once their windows empty, unmoved layers are evicted; moved ones keep
+	// their resolution
+	*now = now.Add(time.Minute)
+	a.Evaluate()
+	if _, ok := a.layers["parks"]; ok || a.Res("roads") != 7 {
+		t.Fatalf("layers=%v roads res=%d", a.layers, a.Res("roads"))
+	}
+	a.Observe("rivers", 8, 1, 0, 0)
+	if _, ok := a.layers["rivers"]; !ok {
+		t.Fatalf("rivers not tracked after eviction freed room")
+	}
+}
@@ -2,6 +2,11 @@
 package simple
 
 import (
+	"slices"
+	"strconv"
+
+	xx "github.com/cespare/xxhash/v2"
+
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/decision"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/hotness"
 	h3mapper "github.com/mohammed-shakir/h3-spatial-cache/internal/mapper/h3"
@@ -13,6 +18,8 @@ type Engine struct {
 	BaseRes        int
 	MinRes, MaxRes int
 	Mapper         *h3mapper.Mapper
+	// Seed breaks exact ties, so equal inputs give equal decisions run to run
+	Seed uint64
 }
 
 var _ decision.Interface = (*Engine)(nil)
@@ -48,15 +55,39 @@ func (e *Engine) SelectResolution(_ decision.LoadStats) int {
 	return e.BaseRes
 }
 
+// Candidate is one resolution EffectiveResolution weighed. Score is the signal
+// compared against Need: the largest parent score sum for the coarser level,
+// the fraction of hot children for the finer one, the hottest cell for the base
+type Candidate struct {
+	Res   int
+	Score float64
+	Need  float64
+}
+
 func (e *Engine) EffectiveResolution(cells []string) int {
+	res, _ := e.sweep(cells, false)
+	return res
+}
+
+// ResolutionSweep is EffectiveResolution that also reports every resolution
+// it weighed, coarsest first, even those a winner made moot
+func (e *Engine) ResolutionSweep(cells []string) (int, []Candidate) {
+	return e.sweep(cells, true)
+}
+
+func (e *Engine) sweep(cells []string, all bool) (int, []Candidate) {
 	if e.Mapper == nil || len(cells) == 0 {
-		return e.BaseRes
+		return e.BaseRes, nil
 	}
+	// work on a sorted, de-duplicated copy: neither the caller's order nor a
+	// repeated cell may change the outcome
+	cells = slices.Compact(slices.Sorted(slices.Values(cells)))
 	base := e.BaseRes
 	if e.MinRes > e.MaxRes {
-		return base
+		return base, nil
 	}
-
+	chosen := base
+	var out []Candidate
 	// try coarser by aggregating parents at BaseRes-1.
 	if base-1 >= e.MinRes {
 		parentSum := make(map[string]float64, len(cells))
@@ -67,13 +98,27 @@ func (e *Engine) EffectiveResolution(cells []string) int {
 			}
 			parentSum[p] += e.Hot.Score(p)
 		}
+		best := 0.0
 		for _, s := range parentSum {
-			if s >= 2*e.Threshold {
-				return base - 1
+			best = max(best, s)
+		}
+		if best >= 2*e.Threshold {
+			if !all {
+				return base - 1, nil
 			}
+			chosen = base - 1
+		}
+		if all {
+			out = append(out, Candidate{Res: base - 1, Score: best, Need: 2 * e.Threshold})
 		}
 	}
-
+	if all {
+		hottest := 0.0
+		for _, c := range cells {
+			hottest = max(hottest, e.Hot.Score(c))
+		}
+		out = append(out, Candidate{Res: base, Score: hottest, Need: e.Threshold})
+	}
 	// try finer by sampling children at BaseRes+1.
 	if base+1 <= e.MaxRes {
 		seen := make(map[string]struct{})
@@ -94,11 +139,31 @@ func (e *Engine) EffectiveResolution(cells []string) int {
 				}
 			}
 		}
-		// go finer if majority of sampled children are hot
-		if total > 0 && hot*2 >= total {
-			return base + 1
+		// go finer if a majority of sampled children are hot; exactly half
+		// is a tie, settled by the seed
+		if total > 0 && chosen == base && (hot*2 > total || hot*2 == total && e.tieFiner(cells)) {
+			chosen = base + 1
+		}
+		if all {
+			frac := 0.0
+			if total > 0 {
+				frac = float64(hot) / float64(total)
+			}
+			out = append(out, Candidate{Res: base + 1, Score: frac, Need: 0.5})
 		}
 	}
+	return chosen, out
+}
 
-	return base
+// tieFiner settles an exact tie over the sorted cells: the same seed and
+// cells always settle it the same way, while different seeds spread ties
+// across both outcomes
+func (e *Engine) tieFiner(cells []string) bool {
+	d := xx.New()
+	_, _ = d.WriteString(strconv.FormatUint(e.Seed, 10))
+	for _, c := range cells {
+		_, _ = d.WriteString(":")
+		_, _ = d.WriteString(c)
+	}
+	return d.Sum64()&1 == 0
 }
@@ -3,7 +3,9 @@ package expdecay
 
 import (
 	"math"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cespare/xxhash/v2"
@@ -14,7 +16,8 @@ import (
 const numShards = 64
 
 type Tracker struct {
-	HalfLife time.Duration
+	// halfLife is stored as nanoseconds so it can change while scoring
+	halfLife atomic.Int64
 
 	now func() time.Time
 
@@ -37,13 +40,43 @@ func New(halfLife time.Duration) *Tracker {
 	if halfLife <= 0 {
 		halfLife = time.Minute
 	}
-	t := &Tracker{HalfLife: halfLife, now: time.Now}
+	t := &Tracker{now: time.Now}
+	t.halfLife.Store(int64(halfLife))
 	for i := range t.shards {
 		t.shards[i].m = make(map[string]*counter)
 	}
 	return t
 }
 
+// HalfLife returns the current decay half-life
+func (t *Tracker) HalfLife() time.Duration {
+	return time.Duration(t.halfLife.Load())
+}
+
+// SetHalfLife changes the decay half-life. Every score is first decayed to now
+// under the old half-life and re-anchored, so scores don't jump and only
+// decay from here on follows the new rate. Non-positive values are ignored.
+func (t *Tracker) SetHalfLife(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	for i := range t.shards {
+		t.shards[i].mu.Lock()
+	}
+	n := t.now()
+	old := t.HalfLife().Seconds()
+	for i := range t.shards {
+		for _, c := range t.shards[i].m {
+			c.score = decay(c.score, n.Sub(c.last).Seconds(), old)
+			c.last = n
+		}
+	}
+	t.halfLife.Store(int64(d))
+	for i := range t.shards {
+		t.shards[i].mu.Unlock()
+	}
+}
+
 func (t *Tracker) Inc(cell string) {
 	if cell == "" {
 		return
@@ -61,7 +94,7 @@ func (t *Tracker) Inc(cell string) {
 	}
 	dt := n.Sub(c.last).Seconds()
 	// apply exponential decay to the existing score before incrementing
-	c.score = decay(c.score, dt, t.HalfLife.Seconds()) + 1.0
+	c.score = decay(c.score, dt, t.HalfLife().Seconds()) + 1.0
 	c.last = n
 }
 
@@ -78,12 +111,12 @@ func (t *Tracker) Score(cell string) float64 {
 		s.mu.RUnlock()
 		return 0
 	}
-	score, last := c.score, c.last
+	score, last, hl := c.score, c.last, t.HalfLife()
 	s.mu.RUnlock()
 
 	// apply exponential decay to the existing score
 	dt := n.Sub(last).Seconds()
-	return decay(score, dt, t.HalfLife.Seconds())
+	return decay(score, dt, hl.Seconds())
 }
 
 func (t *Tracker) Reset(cells ...string) {
@@ -98,6 +131,47 @@ func (t *Tracker) Reset(cells ...string) {
 	}
 }
 
+// ResetAll drops every tracked cell and returns how many were cleared
+func (t *Tracker) ResetAll() int {
+	total := 0
+	for i := range t.shards {
+		s := &t.shards[i]
+		s.mu.Lock()
+		total += len(s.m)
+		s.m = make(map[string]*counter)
+		s.mu.Unlock()
+	}
+	return total
+}
+
+// Top returns up to n cells ordered by decayed score, hottest first
+func (t *Tracker) Top(n int) []hotness.CellScore {
+	if n <= 0 {
+		return nil
+	}
+	now := t.now()
+	hl := t.HalfLife().Seconds()
+	var out []hotness.CellScore
+	for i := range t.shards {
+		s := &t.shards[i]
+		s.mu.RLock()
+		for cell, c := range s.m {
+			out = append(out, hotness.CellScore{Cell: cell, Score: decay(c.score, now.Sub(c.last).Seconds(), hl)})
+		}
+		s.mu.RUnlock()
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].Cell < out[j].Cell
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
 func decay(score, dt, halfLife float64) float64 {
 	if score == 0 || dt <= 0 || halfLife <= 0 {
 		return score
@@ -85,6 +85,32 @@ func TestHalfLife_DecaysByHalf(t *testing.T) {
 	almostEq(t, got, 0.25, 1e-6)
 }
 
+func TestSetHalfLife_ReanchorsAndDecaysAtNewRate(t *testing.T) {
+	fc := &fakeClock{}
+	fc.Set(time.Unix(0, 0).UTC())
+	tr := newTrackerForTest(2*time.Second, fc)
+
+	cell := "892a100d2b3ffff"
+	tr.Inc(cell)
+	fc.Add(2 * time.Second)
+	almostEq(t, tr.Score(cell), 0.5, 1e-6)
+
+	tr.SetHalfLife(8 * time.Second)
+	if tr.HalfLife() != 8*time.Second {
+		t.Fatalf("half-life=%v want 8s", tr.HalfLife())
+	}
+	// no jump at the switch
+	almostEq(t, tr.Score(cell), 0.5, 1e-6)
+
+	fc.Add(8 * time.Second)
+	almostEq(t, tr.Score(cell), 0.25, 1e-6)
+
+	tr.SetHalfLife(0)
+	if tr.HalfLife() != 8*time.Second {
+		t.Fatalf("non-positive half-life should be ignored, got %v", tr.HalfLife())
+	}
+}
+
 func TestConcurrency_ManyIncSameCell(t *testing.T) {
 	fc := &fakeClock{}
 	fc.Set(time.Unix(0, 0).UTC())
@@ -132,6 +158,29 @@ func TestReset_OnlySelectedCells(t *testing.T) {
 	}
 }
 
+func TestTop_OrdersByScoreAndLimits(t *testing.T) {
+	tr := newTrackerForTest(30*time.Second, nil)
+
+	for range 3 {
+		tr.Inc("cell-A")
+	}
+	tr.Inc("cell-B")
+	for range 2 {
+		tr.Inc("cell-C")
+	}
+
+	top := tr.Top(2)
+	if len(top) != 2 {
+		t.Fatalf("len(top)=%d want 2", len(top))
+	}
+	if top[0].Cell != "cell-A" || top[1].Cell != "cell-C" {
+		t.Fatalf("order=%v want cell-A, cell-C", top)
+	}
+	if tr.Top(0) != nil {
+		t.Fatalf("Top(0) should be nil")
+	}
+}
+
 func TestDecayHelper_Edges(t *testing.T) {
 	if got := decay(0, 10, 60); got != 0 {
 		t.Fatalf("expected 0, got %g", got)
@@ -1,8 +1,31 @@
 // Package hotness tracks request hotness and cache temperature metrics.
 package hotness
 
+import "time"
+
 type Interface interface {
 	Inc(cell string)
 	Score(cell string) float64
 	Reset(cells ...string)
 }
+
+// Clearer is implemented by trackers that can drop every tracked cell at once
+type Clearer interface {
+	ResetAll() int
+}
+
+// HalfLifeSetter is implemented by decaying trackers whose half-life can change live
+type HalfLifeSetter interface {
+	SetHalfLife(d time.Duration)
+}
+
+// CellScore is a cell with its current decayed score
+type CellScore struct {
+	Cell  string  `json:"cell"`
+	Score float64 `json:"score"`
+}
+
+// Ranker is implemented by trackers that can list their hottest cells
+type Ranker interface {
+	Top(n int) []CellScore
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	xx "github.com/cespare/xxhash/v2"
 
@@ -74,6 +75,34 @@ func (w *WithMetrics) Reset(cells ...string) {
 	}
 }
 
+// ResetAll clears the inner tracker when it supports it; returns cells cleared
+func (w *WithMetrics) ResetAll() int {
+	c, ok := w.inner.(hotness.Clearer)
+	if !ok {
+		return 0
+	}
+	n := c.ResetAll()
+	if s, ok := w.inner.(Sizer); ok {
+		observability.SetHotKeysGauge(w.tier, s.Size())
+	}
+	return n
+}
+
+// SetHalfLife forwards to the inner tracker when it supports live half-life changes
+func (w *WithMetrics) SetHalfLife(d time.Duration) {
+	if s, ok := w.inner.(hotness.HalfLifeSetter); ok {
+		s.SetHalfLife(d)
+	}
+}
+
+// Top forwards to the inner tracker when it can rank cells
+func (w *WithMetrics) Top(n int) []hotness.CellScore {
+	if r, ok := w.inner.(hotness.Ranker); ok {
+		return r.Top(n)
+	}
+	return nil
+}
+
 func shouldLog(sample float64, key string) bool {
 	if sample <= 0 {
 		return false
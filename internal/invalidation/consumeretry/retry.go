@@ -0,0 +1,117 @@
+// Package consumeretry is the on-error strategy shared by the invalidation
+// consumers' group handlers, so a failed message is treated the same way
+// whichever consumer reads it.
+package consumeretry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
+)
+
+// Strategies for a message whose processing fails
+const (
+	// FailClaim returns the error from ConsumeClaim, ending the claim
+	FailClaim = "fail-claim"
+	// RetryInline retries the same message with backoff inside the claim
+	RetryInline = "retry-inline"
+)
+
+// ParseStrategy reads a KAFKA_CONSUMER_ON_ERROR value; anything but
+// RetryInline is FailClaim
+func ParseStrategy(s string) string {
+	if strings.EqualFold(strings.TrimSpace(s), RetryInline) {
+		return RetryInline
+	}
+	return FailClaim
+}
+
+// permanentError marks a message that can never be applied, such as one that
+// doesn't decode or has no footprint; retrying it would only stall the
+// partition
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as one retrying can't fix
+func Permanent(err error) error { return permanentError{err: err} }
+
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// Policy is how a group handler treats a message whose processing fails
+type Policy struct {
+	// RetryInline keeps retrying a failed message with backoff instead of
+	// failing the claim (and triggering a rebalance); permanent failures are
+	// logged and committed instead
+	RetryInline bool
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	Logger      *slog.Logger
+}
+
+// Handle runs process on msg once, or with RetryInline until it succeeds or
+// ctx ends; with RetryInline a permanent failure is skipped rather than
+// retried. A nil error means msg can be marked
+func (p Policy) Handle(ctx context.Context, msg *sarama.ConsumerMessage, process func(context.Context, *sarama.ConsumerMessage) error) error {
+	err := process(ctx, msg)
+	if err == nil || !p.RetryInline {
+		return err
+	}
+
+	wait := p.Backoff
+	if wait <= 0 {
+		wait = 200 * time.Millisecond
+	}
+	for attempt := 2; err != nil && !IsPermanent(err); attempt++ {
+		if p.Logger != nil {
+			p.Logger.Warn("invalidation failed, retrying inline",
+				"topic", msg.Topic,
+				"partition", msg.Partition,
+				"offset", msg.Offset,
+				"attempt", attempt,
+				"backoff", wait.String(),
+				"err", err,
+			)
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return fmt.Errorf("retry aborted: %w", ctx.Err())
+		case <-t.C:
+		}
+		wait *= 2
+		if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+			wait = p.MaxBackoff
+		}
+		err = process(ctx, msg)
+	}
+	if err != nil {
+		p.skip(msg, err)
+	}
+	return nil
+}
+
+// skip gives up on a message that failed permanently, so it is committed
+func (p Policy) skip(msg *sarama.ConsumerMessage, err error) {
+	observability.IncKafkaConsumerError("skipped")
+	if p.Logger != nil {
+		p.Logger.Error("invalidation message can't be applied, skipping",
+			"topic", msg.Topic,
+			"partition", msg.Partition,
+			"offset", msg.Offset,
+			"err", err,
+		)
+	}
+}
@@ -16,6 +16,8 @@ type Event struct {
 	Source    string          `json:"source,omitempty"`
 	BBox      *BBox           `json:"bbox,omitempty"`
 	Geometry  json.RawMessage `json:"geometry,omitempty"`
+	// Filters targets entries cached under this cql_filter; empty means every filter variant
+	Filters string `json:"filters,omitempty"`
 }
 
 type BBox struct {
@@ -18,6 +18,7 @@ import (
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
 	obs "github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/invalidation"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/invalidation/consumeretry"
 	mylog "github.com/mohammed-shakir/h3-spatial-cache/internal/logger"
 )
 
@@ -92,6 +93,12 @@ func (c *Consumer) Start(ctx context.Context) error {
 
 	handler := &groupHandler{
 		process: c.ProcessOne,
+		retry: consumeretry.Policy{
+			RetryInline: c.cfg.OnError == OnErrorRetryInline,
+			Backoff:     c.cfg.RetryBackoff,
+			MaxBackoff:  c.cfg.RetryMaxBackoff,
+			Logger:      c.logger,
+		},
 		setup: func(sess sarama.ConsumerGroupSession) {
 			claims := sess.Claims()
 			c.assignMu.Lock()
@@ -113,7 +120,7 @@ func (c *Consumer) Start(ctx context.Context) error {
 	}
 
 	c.logger.Info("kafka invalidation consumer starting",
-		"brokers", c.cfg.Brokers, "topic", c.cfg.Topic, "group", c.cfg.GroupID)
+		"brokers", c.cfg.Brokers, "topics", c.cfg.topicList(), "group", c.cfg.GroupID)
 
 	for {
 		select {
@@ -121,11 +128,11 @@ func (c *Consumer) Start(ctx context.Context) error {
 			c.logger.Info("kafka invalidation consumer shutting down")
 			return nil
 		default:
-			if err := group.Consume(ctx, []string{c.cfg.Topic}, handler); err != nil {
+			if err := group.Consume(ctx, c.cfg.topicList(), handler); err != nil {
 				c.logger.Error("consumer error", "err", err)
 				c.zlog.Error().Err(err).
 					Strs("brokers", c.cfg.Brokers).
-					Str("topic", c.cfg.Topic).
+					Strs("topics", c.cfg.topicList()).
 					Msg("kafka consumer error")
 				time.Sleep(2 * time.Second)
 			}
@@ -153,7 +160,7 @@ func (c *Consumer) ProcessOne(ctx context.Context, msg *sarama.ConsumerMessage)
 	var ev invalidation.Event
 	if err := json.Unmarshal(msg.Value, &ev); err != nil {
 		obs.IncKafkaConsumerError("decode")
-		obs.ObserveUpstreamLatency("kafka_decode", time.Since(start).Seconds())
+		obs.ObserveUpstreamLatency(ctx, "kafka_decode", time.Since(start).Seconds())
 
 		mylog.FromContext(ctx, c.zlog).Error().
 			Str("kind", "decode").
@@ -162,7 +169,7 @@ func (c *Consumer) ProcessOne(ctx context.Context, msg *sarama.ConsumerMessage)
 			Int64("offset", msg.Offset).
 			Msg("kafka error")
 
-		return fmt.Errorf("json decode: %w", err)
+		return consumeretry.Permanent(fmt.Errorf("json decode: %w", err))
 	}
 
 	if !ev.TS.IsZero() {
@@ -172,7 +179,7 @@ func (c *Consumer) ProcessOne(ctx context.Context, msg *sarama.ConsumerMessage)
 	cells, err := c.cellsForEvent(ev)
 	if err != nil {
 		obs.ObserveInvalidation(ev.Op, ev.Layer, 0, time.Since(start), err)
-		return fmt.Errorf("derive cells: %w", err)
+		return consumeretry.Permanent(fmt.Errorf("derive cells: %w", err))
 	}
 	if len(cells) == 0 {
 		obs.ObserveInvalidation(ev.Op, ev.Layer, 0, time.Since(start), nil)
@@ -183,7 +190,7 @@ func (c *Consumer) ProcessOne(ctx context.Context, msg *sarama.ConsumerMessage)
 	delKeys := make([]string, 0, len(cells)*len(c.resRange))
 	for _, res := range c.resRange {
 		for _, cell := range cells {
-			delKeys = append(delKeys, keys.Key(ev.Layer, res, cell, ""))
+			delKeys = append(delKeys, keys.Key(ev.Layer, res, cell, ev.Filters))
 		}
 	}
 
@@ -4,16 +4,31 @@ import (
 	"os"
 	"strings"
 	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/invalidation/consumeretry"
+)
+
+// Strategies for a message whose processing fails
+const (
+	// OnErrorFailClaim returns the error from ConsumeClaim, ending the claim
+	OnErrorFailClaim = consumeretry.FailClaim
+	// OnErrorRetryInline retries the same message with backoff inside the claim
+	OnErrorRetryInline = consumeretry.RetryInline
 )
 
 type Config struct {
 	Brokers             []string
 	Topic               string
+	Topics              []string // consumed by one group; empty means just Topic
 	GroupID             string
 	SessionTimeout      time.Duration
 	Heartbeat           time.Duration
 	RebalanceTimeout    time.Duration
 	InitialOffsetOldest bool
+	// OnError is OnErrorFailClaim (default) or OnErrorRetryInline
+	OnError         string
+	RetryBackoff    time.Duration
+	RetryMaxBackoff time.Duration
 }
 
 func FromEnv() Config {
@@ -25,6 +40,10 @@ func FromEnv() Config {
 	if topic == "" {
 		topic = "spatial-invalidation"
 	}
+	topics := splitCSV(os.Getenv("KAFKA_TOPICS"))
+	if len(topics) == 0 {
+		topics = []string{topic}
+	}
 	group := os.Getenv("KAFKA_GROUP_ID")
 	if group == "" {
 		group = "cache-invalidator"
@@ -32,13 +51,31 @@ func FromEnv() Config {
 
 	return Config{
 		Brokers:             splitCSV(brokers),
-		Topic:               topic,
+		Topic:               topics[0],
+		Topics:              topics,
 		GroupID:             group,
 		SessionTimeout:      30 * time.Second,
 		Heartbeat:           3 * time.Second,
 		RebalanceTimeout:    30 * time.Second,
 		InitialOffsetOldest: true,
+		OnError:             consumeretry.ParseStrategy(os.Getenv("KAFKA_CONSUMER_ON_ERROR")),
+		RetryBackoff:        envDuration("KAFKA_CONSUMER_RETRY_BACKOFF", 200*time.Millisecond),
+		RetryMaxBackoff:     envDuration("KAFKA_CONSUMER_RETRY_MAX_BACKOFF", 10*time.Second),
+	}
+}
+
+func (c Config) topicList() []string {
+	if len(c.Topics) > 0 {
+		return c.Topics
+	}
+	return []string{c.Topic}
+}
+
+func envDuration(k string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(strings.TrimSpace(os.Getenv(k))); err == nil && d > 0 {
+		return d
 	}
+	return def
 }
 
 func splitCSV(s string) []string {
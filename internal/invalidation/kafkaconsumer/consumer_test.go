@@ -15,6 +15,7 @@ import (
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/invalidation"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/invalidation/consumeretry"
 )
 
 type fakeCache struct {
@@ -183,3 +184,91 @@ func TestMultiPartition_Parallel_NoCrossOrdering(t *testing.T) {
 		t.Fatalf("expected 4 marks total; got %v", s.marked)
 	}
 }
+
+func TestRetryInline_KeepsClaimAndMarksAfterSuccess(t *testing.T) {
+	fc := &fakeCache{}
+	fc.failFirst.Store(true)
+	c := newConsumerForTest(fc, &fakeHot{})
+
+	msg := func() *sarama.ConsumerMessage {
+		return &sarama.ConsumerMessage{Topic: "spatial-updates", Partition: 0, Offset: 7, Value: eventBytesBBox()}
+	}
+
+	// default strategy: the failure ends the claim without marking
+	s := &sess{ctx: t.Context()}
+	ch := make(chan *sarama.ConsumerMessage, 1)
+	ch <- msg()
+	close(ch)
+	if err := (&groupHandler{process: c.ProcessOne}).ConsumeClaim(s, &claim{msgs: ch}); err == nil {
+		t.Fatalf("fail-claim: expected ConsumeClaim error")
+	}
+	if len(s.marked) != 0 {
+		t.Fatalf("fail-claim: marked=%v want none", s.marked)
+	}
+
+	fc.failFirst.Store(true)
+	g := &groupHandler{
+		process: c.ProcessOne,
+		retry:   consumeretry.Policy{RetryInline: true, Backoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond},
+	}
+	s = &sess{ctx: t.Context()}
+	ch = make(chan *sarama.ConsumerMessage, 2)
+	ch <- msg()
+	ch <- &sarama.ConsumerMessage{Topic: "spatial-updates", Partition: 0, Offset: 8, Value: eventBytesBBox()}
+	close(ch)
+	if err := g.ConsumeClaim(s, &claim{msgs: ch}); err != nil {
+		t.Fatalf("retry-inline: ConsumeClaim: %v", err)
+	}
+	if len(s.marked) != 2 || s.marked[0] != 7 || s.marked[1] != 8 {
+		t.Fatalf("retry-inline: marked=%v want [7 8]", s.marked)
+	}
+}
+
+func TestRetryInline_StopsOnContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	g := &groupHandler{
+		process: func(context.Context, *sarama.ConsumerMessage) error {
+			cancel()
+			return errors.New("redis down")
+		},
+		retry: consumeretry.Policy{RetryInline: true, Backoff: time.Hour},
+	}
+	s := &sess{ctx: ctx}
+	ch := make(chan *sarama.ConsumerMessage, 1)
+	ch <- &sarama.ConsumerMessage{Topic: "t", Offset: 1}
+	if err := g.ConsumeClaim(s, &claim{msgs: ch}); err == nil {
+		t.Fatalf("expected error once the session ends")
+	}
+	if len(s.marked) != 0 {
+		t.Fatalf("marked=%v want none", s.marked)
+	}
+}
+
+func TestRetryInline_SkipsPermanentFailures(t *testing.T) {
+	fc := &fakeCache{}
+	c := newConsumerForTest(fc, &fakeHot{})
+	g := &groupHandler{
+		process: c.ProcessOne,
+		retry:   consumeretry.Policy{RetryInline: true, Backoff: time.Hour},
+	}
+	s := &sess{ctx: t.Context()}
+	ch := make(chan *sarama.ConsumerMessage, 3)
+	ch <- &sarama.ConsumerMessage{Topic: "spatial-updates", Offset: 1, Value: []byte("{not json")}
+	ch <- &sarama.ConsumerMessage{Topic: "spatial-updates", Offset: 2, Value: []byte(`{"op":"update","layer":"demo:x"}`)}
+	ch <- &sarama.ConsumerMessage{Topic: "spatial-updates", Offset: 3, Value: eventBytesBBox()}
+	close(ch)
+
+	done := make(chan error, 1)
+	go func() { done <- g.ConsumeClaim(s, &claim{msgs: ch}) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("ConsumeClaim: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("undecodable or footprint-less message was retried instead of skipped")
+	}
+	if len(s.marked) != 3 {
+		t.Fatalf("marked=%v want all 3 offsets committed", s.marked)
+	}
+}
@@ -3,9 +3,10 @@ package kafkaconsumer
 import (
 	"context"
 	"fmt"
-	"time"
 
 	"github.com/IBM/sarama"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/invalidation/consumeretry"
 )
 
 type messageProcessor func(context.Context, *sarama.ConsumerMessage) error
@@ -14,6 +15,7 @@ type groupHandler struct {
 	process messageProcessor
 	setup   func(sarama.ConsumerGroupSession)
 	cleanup func(sarama.ConsumerGroupSession)
+	retry   consumeretry.Policy
 }
 
 func (h *groupHandler) Setup(s sarama.ConsumerGroupSession) error {
@@ -40,9 +42,7 @@ func (h *groupHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sara
 			if !ok {
 				return nil
 			}
-			start := time.Now()
-			if err := h.process(ctx, msg); err != nil {
-				_ = start
+			if err := h.retry.Handle(ctx, msg, h.process); err != nil {
 				return fmt.Errorf("process failed (topic=%s, part=%d, off=%d): %w",
 					msg.Topic, msg.Partition, msg.Offset, err)
 			}
@@ -15,17 +15,21 @@ import (
 )
 
 type Config struct {
-	Level     string
-	Console   bool
-	SampleN   int
-	Scenario  string
-	Component string
+	Level   string
+	Console bool
+	SampleN int
+	// SlowRequestThreshold > 0 moves SampleN from all logs to fast request
+	// logs only (see RequestSampler), so slow-request warnings are never dropped
+	SlowRequestThreshold time.Duration
+	Scenario             string
+	Component            string
 }
 
 type ctxKey string
 
 const (
 	ctxReqIDKey  ctxKey = "request_id"
+	ctxTraceID   ctxKey = "trace_id"
 	ctxHitClass  ctxKey = "hit_class"
 	ctxComponent ctxKey = "component"
 	ctxScenario  ctxKey = "scenario"
@@ -38,6 +42,27 @@ func WithRequestID(ctx context.Context, reqID string) context.Context {
 	return context.WithValue(ctx, ctxReqIDKey, reqID)
 }
 
+// RequestID returns the id set by WithRequestID, or ""
+func RequestID(ctx context.Context) string {
+	s, _ := ctx.Value(ctxReqIDKey).(string)
+	return s
+}
+
+// WithTraceID records the trace the request belongs to; an empty id leaves
+// ctx unchanged
+func WithTraceID(ctx context.Context, traceID string) context.Context {
+	if traceID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, ctxTraceID, traceID)
+}
+
+// TraceID returns the id set by WithTraceID, or ""
+func TraceID(ctx context.Context) string {
+	s, _ := ctx.Value(ctxTraceID).(string)
+	return s
+}
+
 func WithHitClass(ctx context.Context, hit string) context.Context {
 	if hit == "" {
 		return ctx
@@ -91,7 +116,7 @@ func Build(cfg Config, out io.Writer) zerolog.Logger {
 
 	base := zerolog.New(out)
 
-	if cfg.SampleN > 0 {
+	if cfg.SampleN > 0 && cfg.SlowRequestThreshold <= 0 {
 		n := safeUint32(cfg.SampleN)
 		if n > 0 {
 			base = base.Sample(&zerolog.BasicSampler{N: n})
@@ -134,6 +159,9 @@ func FromContext(ctx context.Context, parent *zerolog.Logger) *zerolog.Logger {
 			w = w.Str("request_id", s)
 		}
 	}
+	if s := TraceID(ctx); s != "" {
+		w = w.Str("trace_id", s)
+	}
 	if v := ctx.Value(ctxScenario); v != nil {
 		if s, ok := v.(string); ok && s != "" {
 			w = w.Str("scenario", s)
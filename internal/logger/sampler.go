@@ -0,0 +1,35 @@
+package logger
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// RequestSampler decides which per-request logs to emit. Requests at or over
+// the slow threshold always log at warn; faster ones keep 1 in sampleN. With
+// no threshold every request logs at info and sampling is left to Build.
+type RequestSampler struct {
+	slow    time.Duration
+	sampleN uint32
+	counter atomic.Uint32
+}
+
+func NewRequestSampler(slow time.Duration, sampleN int) *RequestSampler {
+	return &RequestSampler{slow: slow, sampleN: safeUint32(sampleN)}
+}
+
+// Level returns the level for a request that took d, or false to drop its log
+func (s *RequestSampler) Level(d time.Duration) (slog.Level, bool) {
+	if s == nil || s.slow <= 0 {
+		return slog.LevelInfo, true
+	}
+	if d >= s.slow {
+		return slog.LevelWarn, true
+	}
+	if s.sampleN <= 1 {
+		return slog.LevelInfo, true
+	}
+	// same cadence as zerolog.BasicSampler: the first of every sampleN is kept
+	return slog.LevelInfo, s.counter.Add(1)%s.sampleN == 1
+}
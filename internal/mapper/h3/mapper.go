@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"sort"
 
 	h3 "github.com/uber/h3-go/v4"
@@ -11,6 +12,11 @@ import (
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
 )
 
+// bboxPrecision is the number of decimals bbox corners are rounded to before
+// polyfill (about 1cm), so clients formatting the same box with different
+// precision land on the same cells
+const bboxPrecision = 7
+
 type Mapper struct{}
 
 func New() *Mapper { return &Mapper{} }
@@ -19,6 +25,7 @@ func (m *Mapper) CellsForBBox(bb model.BBox, res int) (model.Cells, error) {
 	if err := validateRes(res); err != nil {
 		return nil, err
 	}
+	bb = canonicalBBox(bb)
 	// convert bbox to rectangular GeoLoop for H3 polyfill
 	outer := h3.GeoLoop{
 		{Lat: bb.Y1, Lng: bb.X1},
@@ -117,6 +124,13 @@ func (m *Mapper) CellsForPolygon(poly model.Polygon, res int) (model.Cells, erro
 	}
 }
 
+func canonicalBBox(bb model.BBox) model.BBox {
+	scale := math.Pow10(bboxPrecision)
+	round := func(v float64) float64 { return math.Round(v*scale) / scale }
+	bb.X1, bb.Y1, bb.X2, bb.Y2 = round(bb.X1), round(bb.Y1), round(bb.X2), round(bb.Y2)
+	return bb
+}
+
 func validateRes(res int) error {
 	if res < 0 || res > 15 {
 		return fmt.Errorf("invalid H3 resolution %d (must be 0..15)", res)
@@ -171,3 +185,20 @@ func polyfillOne(outer h3.GeoLoop, holes []h3.GeoLoop, res int) (model.Cells, er
 	sort.Strings(out)
 	return out, nil
 }
+
+// Boundary returns the cell's vertices as [lng, lat] pairs, GeoJSON order
+func (m *Mapper) Boundary(cell string) ([][2]float64, error) {
+	var c h3.Cell
+	if err := c.UnmarshalText([]byte(cell)); err != nil || !c.IsValid() {
+		return nil, fmt.Errorf("invalid h3 cell %q", cell)
+	}
+	b, err := c.Boundary()
+	if err != nil {
+		return nil, fmt.Errorf("h3 boundary: %w", err)
+	}
+	out := make([][2]float64, len(b))
+	for i, ll := range b {
+		out[i] = [2]float64{ll.Lng, ll.Lat}
+	}
+	return out, nil
+}
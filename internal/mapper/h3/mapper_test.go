@@ -5,6 +5,8 @@ import (
 	"sort"
 	"testing"
 
+	h3 "github.com/uber/h3-go/v4"
+
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
 )
 
@@ -91,3 +93,33 @@ func hasDups(s []string) bool {
 	}
 	return false
 }
+
+func TestBBox_NearlyIdenticalBoxesShareCells(t *testing.T) {
+	m := New()
+	const res = 12
+	cell, err := h3.LatLngToCell(h3.LatLng{Lat: 59.3325, Lng: 18.055}, res)
+	if err != nil {
+		t.Fatalf("LatLngToCell: %v", err)
+	}
+	c, err := cell.LatLng()
+	if err != nil {
+		t.Fatalf("cell center: %v", err)
+	}
+
+	// the west edges differ at the 9th decimal and straddle the cell's center,
+	// so unrounded polyfill would include the cell for one box and not the other
+	a := model.BBox{X1: c.Lng - 2e-9, Y1: 59.33, X2: 18.06, Y2: 59.335, SRID: "EPSG:4326"}
+	b := model.BBox{X1: c.Lng + 2e-9, Y1: 59.33, X2: 18.06, Y2: 59.335, SRID: "EPSG:4326"}
+
+	ca, err := m.CellsForBBox(a, res)
+	if err != nil {
+		t.Fatalf("a: %v", err)
+	}
+	cb, err := m.CellsForBBox(b, res)
+	if err != nil {
+		t.Fatalf("b: %v", err)
+	}
+	if !reflect.DeepEqual(ca, cb) {
+		t.Fatalf("bboxes differing at the 9th decimal map to different cells (%d vs %d)", len(ca), len(cb))
+	}
+}
@@ -17,15 +17,17 @@ type BuildInfo struct {
 }
 
 type Config struct {
-	Enabled bool
-	Addr    string
-	Path    string
-	Build   BuildInfo
+	Enabled     bool
+	Addr        string
+	Path        string
+	Build       BuildInfo
+	OpenMetrics bool // offer the OpenMetrics format, which carries exemplars
 }
 
 type Provider struct {
-	reg       *prometheus.Registry
-	buildInfo *prometheus.GaugeVec
+	reg         *prometheus.Registry
+	buildInfo   *prometheus.GaugeVec
+	openMetrics bool
 }
 
 func Init(cfg Config) *Provider {
@@ -50,11 +52,11 @@ func Init(cfg Config) *Provider {
 	}
 	build.WithLabelValues(v.Version, v.Revision, v.Branch, v.BuildDate).Set(1)
 
-	return &Provider{reg: reg, buildInfo: build}
+	return &Provider{reg: reg, buildInfo: build, openMetrics: cfg.OpenMetrics}
 }
 
 func (p *Provider) Handler() http.Handler {
-	return promhttp.HandlerFor(p.reg, promhttp.HandlerOpts{})
+	return promhttp.HandlerFor(p.reg, promhttp.HandlerOpts{EnableOpenMetrics: p.openMetrics})
 }
 
 func (p *Provider) Register(cs ...prometheus.Collector) {
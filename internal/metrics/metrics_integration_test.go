@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -37,8 +38,8 @@ func Test_AppMetrics_CustomRegistry_Smoke(t *testing.T) {
 	observability.ExposeBuildInfo("test")
 
 	start := time.Now()
-	observability.ObserveSpatialResponse("miss", "geojson", time.Since(start).Seconds())
-	observability.ObserveSpatialResponse("full_hit", "geojson", 0.010)
+	observability.ObserveSpatialResponse(context.Background(), "miss", "geojson", time.Since(start).Seconds())
+	observability.ObserveSpatialResponse(context.Background(), "full_hit", "geojson", 0.010)
 
 	observability.AddCacheHits(3)
 	observability.AddCacheMisses(1)
@@ -3,9 +3,13 @@ package baseline
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"sort"
+	"time"
 
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/aggregate/geojsonagg"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/composer"
@@ -13,6 +17,7 @@ import (
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/executor"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/problem"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/router"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/decision"
 	simpledec "github.com/mohammed-shakir/h3-spatial-cache/internal/decision/simple"
@@ -31,7 +36,17 @@ type Engine struct {
 	dec            decision.Interface
 	thr            float64
 	eng            composer.Engine
+	agg            *geojsonagg.Aggregator
 	streamUpstream bool
+	streamDedup    bool
+	streamDecode   bool
+	passthroughRaw bool
+	debugHeaders   bool
+	idProps        map[string]string
+	timeProp       string
+	propTypes      map[string]map[string]string
+	stripProps     []string
+	maxFeatures    int
 }
 
 func init() {
@@ -42,6 +57,13 @@ func newBaseline(cfg config.Config, logger *slog.Logger, exec executor.Interface
 	hot := expdecay.New(cfg.HotHalfLife)
 	dec := simpledec.New(hot, cfg.HotThreshold, cfg.H3Res, cfg.H3ResMin, cfg.H3ResMax, h3mapper.New())
 
+	agg := geojsonagg.NewAdvanced()
+	if cfg.GeomPrecision > 0 {
+		agg.GeomPrecision = cfg.GeomPrecision
+	}
+	agg.CanonicalRings = cfg.GeomCanonicalRings
+	agg.DedupStrict = cfg.AggDedupStrict
+
 	// collects hotness metrics
 	return &Engine{
 		logger: logger,
@@ -53,9 +75,19 @@ func newBaseline(cfg config.Config, logger *slog.Logger, exec executor.Interface
 		dec: dec,
 		thr: cfg.HotThreshold,
 		eng: composer.Engine{
-			V2: composer.NewGeoJSONV2Adapter(geojsonagg.NewAdvanced()),
+			V2: composer.NewGeoJSONV2Adapter(agg),
 		},
+		agg:            agg,
 		streamUpstream: cfg.Features.BaselineStreamUpstream,
+		streamDedup:    cfg.Features.BaselineStreamDedup,
+		streamDecode:   cfg.Features.BaselineStreamDecode,
+		passthroughRaw: cfg.Features.BaselinePassthroughRaw,
+		debugHeaders:   cfg.Features.DebugHeaders,
+		idProps:        cfg.IDProperties,
+		timeProp:       cfg.TimeProperty,
+		propTypes:      cfg.PropertyTypes,
+		stripProps:     cfg.StripProperties,
+		maxFeatures:    cfg.MaxFeatures,
 	}, nil
 }
 
@@ -82,9 +114,13 @@ func (e *Engine) HandleQuery(ctx context.Context, w http.ResponseWriter, r *http
 
 	should := e.dec.ShouldCache(cells)
 
-	if should {
+	// shadow replays stay out of the primary's per-request metrics
+	shadow := observability.IsShadow(ctx)
+	switch {
+	case shadow:
+	case should:
 		observability.IncDecision("cache")
-	} else {
+	default:
 		observability.IncDecision("nocache")
 	}
 
@@ -118,31 +154,48 @@ func (e *Engine) HandleQuery(ctx context.Context, w http.ResponseWriter, r *http
 	q.H3Res = e.res
 	q.Cells = cells
 
+	w.Header().Set(composer.HeaderXCache, composer.XCacheBypass)
 	if e.streamUpstream {
+		if sf, ok := e.exec.(executor.StreamFetcher); ok && e.streamDedup && e.agg != nil {
+			e.serveStreamDeduped(ctx, w, r, q, sf)
+			return
+		}
 		e.exec.ForwardGetFeature(w, r, q)
-		observability.ObserveSpatialRead("miss", false)
+		if !shadow {
+			observability.ObserveSpatialRead("miss", false)
+		}
+		return
+	}
+	if e.passthroughRaw {
+		e.serveRaw(ctx, w, r, q)
 		return
 	}
 
-	body, _, err := e.exec.FetchGetFeature(ctx, q)
+	page, err := e.fetchPage(ctx, q)
 	if err != nil {
 		e.logger.Error("baseline upstream error",
 			"scenario", "baseline",
 			"layer", q.Layer,
 			"err", err,
 		)
-		http.Error(w, "upstream error: "+err.Error(), http.StatusBadGateway)
+		problem.Error(w, r, "upstream error: "+err.Error(), http.StatusBadGateway)
 		return
 	}
 
 	req := composer.Request{
 		Query: composer.QueryParams{
-			Limit:  0,
-			Offset: 0,
-		},
-		Pages: []composer.ShardPage{
-			{Body: body, CacheStatus: composer.CacheMiss},
+			Sort:            composer.SortKeysFromModel(q.Sort),
+			Limit:           e.maxFeatures,
+			Offset:          0,
+			GeomPrecision:   q.GeomPrecision,
+			IDProperty:      config.IDPropertyFor(e.idProps, q.Layer),
+			TimeProperty:    e.timeProp,
+			PropertyTypes:   config.PropertyTypesFor(e.propTypes, q.Layer),
+			StripProperties: e.stripProps,
+			CreatedAfter:    q.CreatedAfter,
+			CreatedBefore:   q.CreatedBefore,
 		},
+		Pages:        []composer.ShardPage{page},
 		AcceptHeader: r.Header.Get("Accept"),
 		OutputFormat: r.URL.Query().Get("outputFormat"),
 	}
@@ -154,11 +207,147 @@ func (e *Engine) HandleQuery(ctx context.Context, w http.ResponseWriter, r *http
 			"layer", q.Layer,
 			"err", err,
 		)
-		http.Error(w, "compose error: "+err.Error(), http.StatusInternalServerError)
+		problem.Error(w, r, "compose error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", res.ContentType)
+	if e.debugHeaders {
+		composer.SetDiagnosticHeaders(w.Header(), res.Diagnostics)
+	}
 	w.WriteHeader(res.StatusCode)
 	_, _ = w.Write(res.Body)
-	observability.ObserveSpatialRead("miss", false)
+	if !shadow {
+		observability.ObserveSpatialRead("miss", false)
+	}
+}
+
+// serveRaw writes the buffered upstream body as-is, so comparing it with the
+// composed path isolates the cost of dedup, sort and re-encoding
+func (e *Engine) serveRaw(ctx context.Context, w http.ResponseWriter, r *http.Request, q model.QueryRequest) {
+	body, ct, err := e.exec.FetchGetFeature(ctx, q)
+	if err != nil {
+		e.logger.Error("baseline upstream error",
+			"scenario", "baseline",
+			"layer", q.Layer,
+			"err", err,
+		)
+		problem.Error(w, r, "upstream error: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	t0 := time.Now()
+	if ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+	if !observability.IsShadow(ctx) {
+		observability.ObserveSpatialResponse(ctx, string(composer.HitClassMiss), "raw", time.Since(t0).Seconds())
+		observability.ObserveSpatialRead("miss", false)
+	}
+}
+
+// serveStreamDeduped proxies the upstream body feature by feature, dropping
+// duplicates the way the cache's merge does, without holding the body in
+// memory. Nothing is written until the first feature survives, so an upstream
+// that fails early still gets a problem response; a failure after that can
+// only cut the body short
+func (e *Engine) serveStreamDeduped(ctx context.Context, w http.ResponseWriter, r *http.Request, q model.QueryRequest, sf executor.StreamFetcher) {
+	fail := func(err error) {
+		e.logger.Error("baseline upstream error",
+			"scenario", "baseline",
+			"layer", q.Layer,
+			"err", err,
+		)
+	}
+	body, _, err := sf.OpenGetFeature(ctx, q)
+	if err != nil {
+		fail(err)
+		problem.Error(w, r, "upstream error: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer func() { _ = body.Close() }()
+
+	t0 := time.Now()
+	d := e.agg.NewDeduper(config.IDPropertyFor(e.idProps, q.Layer))
+	started := false
+	start := func() {
+		started = true
+		w.Header().Set("Content-Type", "application/geo+json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[`)
+	}
+	_, err = composer.DecodeFeatureStream(body, func(f json.RawMessage) error {
+		keep, err := d.Keep(f)
+		if err != nil || !keep {
+			return err
+		}
+		if started {
+			_, _ = io.WriteString(w, ",")
+		} else {
+			start()
+		}
+		if _, err := w.Write(f); err != nil {
+			return fmt.Errorf("write response: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		fail(err)
+		if !started {
+			problem.Error(w, r, "upstream error: "+err.Error(), http.StatusBadGateway)
+		}
+		return
+	}
+	if !started {
+		start()
+	}
+	_, _ = io.WriteString(w, "]}")
+	e.logger.Debug("baseline stream dedup",
+		"layer", q.Layer,
+		"in", d.Diag.TotalIn,
+		"out", d.Diag.TotalOut,
+		"dedup_id", d.Diag.DedupByID,
+		"dedup_geom", d.Diag.DedupByGH,
+	)
+	if !observability.IsShadow(ctx) {
+		observability.ObserveSpatialResponse(ctx, string(composer.HitClassMiss), "geojson", time.Since(t0).Seconds())
+		observability.ObserveSpatialRead("miss", false)
+	}
+}
+
+// fetches the upstream page; with streamDecode the body is decoded feature by
+// feature instead of being read into memory whole first
+func (e *Engine) fetchPage(ctx context.Context, q model.QueryRequest) (composer.ShardPage, error) {
+	if sf, ok := e.exec.(executor.StreamFetcher); ok && e.streamDecode {
+		body, _, err := sf.OpenGetFeature(ctx, q)
+		if err != nil {
+			return composer.ShardPage{}, fmt.Errorf("open upstream: %w", err)
+		}
+		defer func() { _ = body.Close() }()
+
+		feats, err := composer.DecodeFeatures(body)
+		if err != nil {
+			return composer.ShardPage{}, fmt.Errorf("decode upstream: %w", err)
+		}
+		return composer.ShardPage{Features: feats, CacheStatus: composer.CacheMiss}, nil
+	}
+
+	body, _, err := e.exec.FetchGetFeature(ctx, q)
+	if err != nil {
+		return composer.ShardPage{}, fmt.Errorf("fetch upstream: %w", err)
+	}
+	return composer.ShardPage{Body: body, CacheStatus: composer.CacheMiss}, nil
+}
+
+// Hotness exposes the tracker so operators can reset it between phases
+func (e *Engine) Hotness() interface{ Reset(...string) } {
+	if e == nil || e.hot == nil {
+		return nil
+	}
+	return e.hot
+}
+
+// ForwardGetFeatureFormat proxies GeoServer-native outputFormats unchanged
+func (e *Engine) ForwardGetFeatureFormat(w http.ResponseWriter, r *http.Request, q model.QueryRequest, format string) {
+	e.exec.ForwardGetFeatureFormat(w, r, q, format)
 }
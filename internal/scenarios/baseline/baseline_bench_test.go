@@ -0,0 +1,95 @@
+package baseline
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/aggregate/geojsonagg"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/composer"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	simpledec "github.com/mohammed-shakir/h3-spatial-cache/internal/decision/simple"
+	h3mapper "github.com/mohammed-shakir/h3-spatial-cache/internal/mapper/h3"
+)
+
+// serves one large FeatureCollection either buffered or as a reader
+type largeExec struct{ body []byte }
+
+func (l *largeExec) FetchGetFeature(_ context.Context, _ model.QueryRequest) ([]byte, string, error) {
+	return bytes.Clone(l.body), "application/json", nil
+}
+
+func (l *largeExec) OpenGetFeature(_ context.Context, _ model.QueryRequest) (io.ReadCloser, string, error) {
+	return io.NopCloser(bytes.NewReader(l.body)), "application/json", nil
+}
+
+func (l *largeExec) ForwardGetFeature(http.ResponseWriter, *http.Request, model.QueryRequest) {}
+
+func (l *largeExec) ForwardGetFeatureFormat(http.ResponseWriter, *http.Request, model.QueryRequest, string) {
+}
+
+func largeFC(n int) []byte {
+	var b bytes.Buffer
+	b.WriteString(`{"type":"FeatureCollection","features":[`)
+	for i := range n {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `{"type":"Feature","id":"f%d","geometry":{"type":"Point","coordinates":[%d.5,59.3]},"properties":{"name":"n%d"}}`, i, i%180, i)
+	}
+	b.WriteString(`],"numberMatched":`)
+	fmt.Fprintf(&b, "%d}", n)
+	return b.Bytes()
+}
+
+func newLargeEngine(decode bool, exec *largeExec) *Engine {
+	return &Engine{
+		logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+		exec:         exec,
+		res:          8,
+		hot:          noHot{},
+		dec:          simpledec.New(noHot{}, 0, 8, 8, 8, h3mapper.New()),
+		eng:          composer.Engine{V2: composer.NewGeoJSONV2Adapter(geojsonagg.NewAdvanced())},
+		streamDecode: decode,
+	}
+}
+
+func TestBaselineStreamDecode_MatchesBuffered(t *testing.T) {
+	exec := &largeExec{body: largeFC(50)}
+	run := func(decode bool) string {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/query", nil)
+		newLargeEngine(decode, exec).HandleQuery(context.Background(), w, r, model.QueryRequest{Layer: "roads"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("decode=%v status=%d body=%s", decode, w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+	if buf, dec := run(false), run(true); buf != dec {
+		t.Fatalf("stream-decoded output differs from buffered output")
+	}
+}
+
+func benchLargeUpstream(b *testing.B, decode bool) {
+	exec := &largeExec{body: largeFC(20000)}
+	e := newLargeEngine(decode, exec)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(exec.body)))
+	b.ResetTimer()
+	for b.Loop() {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/query", nil)
+		e.HandleQuery(context.Background(), w, r, model.QueryRequest{Layer: "roads"})
+		if w.Code != http.StatusOK {
+			b.Fatalf("status=%d", w.Code)
+		}
+	}
+}
+
+func BenchmarkBaseline_LargeUpstream_Buffered(b *testing.B)     { benchLargeUpstream(b, false) }
+func BenchmarkBaseline_LargeUpstream_StreamDecode(b *testing.B) { benchLargeUpstream(b, true) }
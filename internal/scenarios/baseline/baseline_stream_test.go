@@ -1,13 +1,17 @@
 package baseline
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/aggregate/geojsonagg"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/composer"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/router"
@@ -109,4 +113,115 @@ func TestBaselineStreaming_Off_UsesBuffered(t *testing.T) {
 	if ct := w.Header().Get("Content-Type"); ct == "" {
 		t.Fatalf("expected Content-Type on buffered baseline response")
 	}
+	if xc := w.Header().Get("X-Cache"); xc != "BYPASS" {
+		t.Fatalf("X-Cache=%q want BYPASS", xc)
+	}
+}
+
+type rawExec struct {
+	streamExec
+	body []byte
+}
+
+func (f *rawExec) FetchGetFeature(_ context.Context, _ model.QueryRequest) ([]byte, string, error) {
+	return f.body, "application/json;charset=UTF-8", nil
+}
+
+func TestBaselinePassthroughRaw_ReturnsUpstreamBytes(t *testing.T) {
+	// duplicate ids, odd spacing and key order would all be rewritten by composition
+	upstream := []byte(`{"type":"FeatureCollection", "totalFeatures":2,"features":[` +
+		`{"type":"Feature","id":"b","properties":{"n":2},"geometry":null},` +
+		`{"type":"Feature","id":"a","properties":{"n":1},"geometry":null},` +
+		`{"type":"Feature","id":"a","properties":{"n":1},"geometry":null}]}` + "\n")
+	fx := &rawExec{body: upstream}
+	h := &Engine{
+		logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+		exec:           fx,
+		res:            8,
+		hot:            noHot{},
+		dec:            simpledec.New(noHot{}, 0, 8, 8, 8, h3mapper.New()),
+		eng:            composerEngine(),
+		passthroughRaw: true,
+	}
+
+	w := httptest.NewRecorder()
+	h.HandleQuery(context.Background(), w, httptest.NewRequest(http.MethodGet, "/query", nil), model.QueryRequest{Layer: "roads"})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d want 200", w.Code)
+	}
+	if !bytes.Equal(w.Body.Bytes(), upstream) {
+		t.Fatalf("raw passthrough changed the body:\n got %s\nwant %s", w.Body.Bytes(), upstream)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json;charset=UTF-8" {
+		t.Fatalf("Content-Type=%q want upstream's", ct)
+	}
+	if fx.forwardCalled {
+		t.Fatalf("raw passthrough should buffer, not proxy")
+	}
+}
+
+type openExec struct {
+	streamExec
+	body string
+}
+
+func (f *openExec) OpenGetFeature(_ context.Context, _ model.QueryRequest) (io.ReadCloser, string, error) {
+	return io.NopCloser(strings.NewReader(f.body)), "application/json", nil
+}
+
+func TestBaselineStreaming_Dedup_RemovesDuplicates(t *testing.T) {
+	// "a" repeats by id; "c" has no id but the same geometry as "b"
+	fx := &openExec{body: `{"type":"FeatureCollection","totalFeatures":4,"features":[` +
+		`{"type":"Feature","id":"a","properties":{"n":1},"geometry":{"type":"Point","coordinates":[18.01,59.33]}},` +
+		`{"type":"Feature","id":"b","properties":{"n":2},"geometry":{"type":"Point","coordinates":[18.02,59.33]}},` +
+		`{"type":"Feature","id":"a","properties":{"n":1},"geometry":{"type":"Point","coordinates":[18.01,59.33]}},` +
+		`{"type":"Feature","properties":{"n":3},"geometry":{"type":"Point","coordinates":[18.02,59.33]}}]}`}
+	h := newTestHandler(true, nil)
+	h.(*Engine).exec = fx
+	h.(*Engine).agg = geojsonagg.NewAdvanced()
+	h.(*Engine).streamDedup = true
+
+	w := httptest.NewRecorder()
+	h.HandleQuery(context.Background(), w, httptest.NewRequest(http.MethodGet, "/query", nil), model.QueryRequest{Layer: "roads"})
+
+	if fx.forwardCalled {
+		t.Fatalf("dedup streaming should not fall back to the raw proxy")
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+	var fc struct {
+		Type     string `json:"type"`
+		Features []struct {
+			ID string `json:"id"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &fc); err != nil {
+		t.Fatalf("decode: %v\n%s", err, w.Body.String())
+	}
+	if fc.Type != "FeatureCollection" || len(fc.Features) != 2 || fc.Features[0].ID != "a" || fc.Features[1].ID != "b" {
+		t.Fatalf("features=%+v want a, b", fc.Features)
+	}
+
+	// with the option off the same executor is proxied untouched
+	h.(*Engine).streamDedup = false
+	h.HandleQuery(context.Background(), httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/query", nil), model.QueryRequest{Layer: "roads"})
+	if !fx.forwardCalled {
+		t.Fatalf("expected the raw proxy with dedup off")
+	}
+}
+
+func TestBaselineStreaming_Dedup_UpstreamErrorBeforeFirstFeature(t *testing.T) {
+	fx := &openExec{body: `{"type":"FeatureCollection","features":[{"type":`}
+	h := newTestHandler(true, nil)
+	h.(*Engine).exec = fx
+	h.(*Engine).agg = geojsonagg.NewAdvanced()
+	h.(*Engine).streamDedup = true
+
+	w := httptest.NewRecorder()
+	h.HandleQuery(context.Background(), w, httptest.NewRequest(http.MethodGet, "/query", nil), model.QueryRequest{Layer: "roads"})
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("status=%d want 502", w.Code)
+	}
 }
@@ -0,0 +1,63 @@
+package baseline
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
+)
+
+// conflictExec answers with two features sharing an id but not a geometry
+type conflictExec struct{ streamExec }
+
+func (conflictExec) FetchGetFeature(_ context.Context, _ model.QueryRequest) ([]byte, string, error) {
+	return []byte(`{"type":"FeatureCollection","features":[` +
+			`{"type":"Feature","id":"a","properties":{},"geometry":{"type":"Point","coordinates":[18,59]}},` +
+			`{"type":"Feature","id":"a","properties":{},"geometry":{"type":"Point","coordinates":[19,60]}}]}`),
+		"application/geo+json", nil
+}
+
+func TestBaseline_AggDedupStrict_CountsIDConflicts(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	observability.Init(reg, true)
+
+	cfg := config.FromEnv()
+	cfg.AggDedupStrict = true
+	h, err := newBaseline(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), &conflictExec{})
+	if err != nil {
+		t.Fatalf("baseline: %v", err)
+	}
+
+	bb := model.BBox{X1: 18, Y1: 59, X2: 19, Y2: 60, SRID: "EPSG:4326"}
+	r := httptest.NewRequest(http.MethodGet, "/query", nil)
+	w := httptest.NewRecorder()
+	h.HandleQuery(r.Context(), w, r, model.QueryRequest{Layer: "demo:places", BBox: &bb})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%q", w.Code, w.Body.String())
+	}
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != "spatial_aggregation_errors_total" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "stage" && l.GetValue() == "id_conflict" && m.GetCounter().GetValue() == 1 {
+					return
+				}
+			}
+		}
+	}
+	t.Fatalf("want one id_conflict aggregation error")
+}
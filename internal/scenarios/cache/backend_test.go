@@ -0,0 +1,149 @@
+package cache_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cachev2 "github.com/mohammed-shakir/h3-spatial-cache/internal/cache/v2"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/scenarios"
+)
+
+// mapBackend is a plain-map FeatureStore and CellIndex with no Redis or
+// memstore underneath, standing in for an alternative backend
+type mapBackend struct {
+	mu    sync.Mutex
+	feats map[string][]byte
+	cells map[string][]string
+	puts  int
+	sets  int
+}
+
+func newMapBackend() *mapBackend {
+	return &mapBackend{feats: map[string][]byte{}, cells: map[string][]string{}}
+}
+
+func cellKey(layer string, res int, cell string, f model.Filters) string {
+	return fmt.Sprintf("%s|%d|%s|%s", layer, res, cell, f)
+}
+
+func (b *mapBackend) MGetFeatures(_ context.Context, layer string, ids []string) (map[string][]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make(map[string][]byte, len(ids))
+	for _, id := range ids {
+		if v, ok := b.feats[layer+"|"+id]; ok {
+			out[id] = v
+		}
+	}
+	return out, nil
+}
+
+func (b *mapBackend) PutFeatures(_ context.Context, layer string, feats map[string][]byte, _ time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.puts++
+	for id, v := range feats {
+		b.feats[layer+"|"+id] = v
+	}
+	return nil
+}
+
+func (b *mapBackend) GetIDs(ctx context.Context, layer string, res int, cell string, f model.Filters) ([]string, error) {
+	m, err := b.MGetIDs(ctx, layer, res, []string{cell}, f)
+	return m[cell], err
+}
+
+func (b *mapBackend) SetIDs(_ context.Context, layer string, res int, cell string, f model.Filters, ids []string, _ time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sets++
+	b.cells[cellKey(layer, res, cell, f)] = append([]string(nil), ids...)
+	return nil
+}
+
+func (b *mapBackend) MGetIDs(_ context.Context, layer string, res int, cells []string, f model.Filters) (map[string][]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make(map[string][]string, len(cells))
+	for _, c := range cells {
+		if ids, ok := b.cells[cellKey(layer, res, c, f)]; ok {
+			out[c] = ids
+		}
+	}
+	return out, nil
+}
+
+func (b *mapBackend) DelCells(_ context.Context, layer string, res int, cells []string, f model.Filters) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, c := range cells {
+		delete(b.cells, cellKey(layer, res, c, f))
+	}
+	return nil
+}
+
+func TestCache_PluggableBackend_MissThenHit(t *testing.T) {
+	gs := &gsDouble{}
+	srv := httptest.NewServer(http.HandlerFunc(gs.handler))
+	defer srv.Close()
+
+	mb := newMapBackend()
+	cachev2.RegisterBackend("test-map", func(config.Config) (*cachev2.Store, error) {
+		return cachev2.NewStore(mb, mb, nil), nil
+	})
+
+	cfg := config.FromEnv()
+	cfg.Scenario = "cache"
+	cfg.CacheBackend = "test-map"
+	cfg.RedisAddr = "127.0.0.1:1" // must not be dialed
+	cfg.GeoServerURL = strings.TrimRight(srv.URL, "/")
+	cfg.CacheTTLDefault = 30 * time.Second
+	cfg.CacheOrphanSweepInterval = time.Hour // unsupported without a KeyCounter; must not fail setup
+	cfg.AdaptiveEnabled = false
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h, err := scenarios.New("cache", cfg, logger, nil)
+	if err != nil {
+		t.Fatalf("scenario: %v", err)
+	}
+
+	bb := model.BBox{X1: 18.00, Y1: 59.32, X2: 18.02, Y2: 59.34, SRID: "EPSG:4326"}
+	serve := func() string {
+		req := httptest.NewRequest(http.MethodGet, "/query", nil)
+		rr := httptest.NewRecorder()
+		h.HandleQuery(req.Context(), rr, req, model.QueryRequest{Layer: "demo:NR_polygon", BBox: &bb})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status=%d body=%q", rr.Code, rr.Body.String())
+		}
+		return rr.Header().Get("X-Cache")
+	}
+
+	if xc := serve(); xc != "MISS" {
+		t.Fatalf("first request X-Cache=%q want MISS", xc)
+	}
+	mb.mu.Lock()
+	puts, sets := mb.puts, mb.sets
+	mb.mu.Unlock()
+	if puts == 0 || sets == 0 {
+		t.Fatalf("fill bypassed the registered backend: puts=%d sets=%d", puts, sets)
+	}
+
+	calls := atomic.LoadInt64(&gs.calls)
+	if xc := serve(); xc != "HIT" {
+		t.Fatalf("second request X-Cache=%q want HIT", xc)
+	}
+	if got := atomic.LoadInt64(&gs.calls); got != calls {
+		t.Fatalf("expected no upstream calls on hit, %d -> %d", calls, got)
+	}
+}
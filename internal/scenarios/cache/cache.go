@@ -9,20 +9,22 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"mime"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/cespare/xxhash/v2"
 	h3 "github.com/uber/h3-go/v4"
 
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/aggregate/geojsonagg"
-	cacheiface "github.com/mohammed-shakir/h3-spatial-cache/internal/cache"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/cellindex"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/featurestore"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/keys"
-	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/redisstore"
 	cachev2 "github.com/mohammed-shakir/h3-spatial-cache/internal/cache/v2"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/composer"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
@@ -31,9 +33,12 @@ import (
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/ogc"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/problem"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/router"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/decision/layerres"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/hotness/expdecay"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/hotness/metricswrap"
+	mylog "github.com/mohammed-shakir/h3-spatial-cache/internal/logger"
 	h3mapper "github.com/mohammed-shakir/h3-spatial-cache/internal/mapper/h3"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/scenarios"
 	"github.com/mohammed-shakir/h3-spatial-cache/pkg/adaptive"
@@ -47,43 +52,105 @@ type Engine struct {
 	maxRes          int
 	mapr            *h3mapper.Mapper
 	eng             composer.Engine
-	store           cacheiface.Interface
 	fs              featurestore.FeatureStore
 	idx             cellindex.CellIndex
+	keys            cachev2.KeyCounter
+	store           *cachev2.Store
 	owsURL          *url.URL
 	http            *http.Client
 	exec            executor.Interface
 	ttlDefault      time.Duration
 	ttlMap          map[string]time.Duration
+	ttlMin          time.Duration // floor for every cell TTL; 0 disables
+	ttlSeed         uint64
+	idProps         map[string]string
+	timeProp        string
+	propTypes       map[string]map[string]string
+	stripProps      []string
+	maxFeatures     int
 	maxWorkers      int
+	fill            *fillPool // shared fill workers; nil starts maxWorkers per request
+	upstream        *upstreamLimiter
 	queueSize       int
+	queueWait       time.Duration // 0 waits indefinitely for room in the fill queue
 	opTimeout       time.Duration
+	mgetTimeout     time.Duration
+	setTimeout      time.Duration
 	adaptiveEnabled bool
 	adaptiveDryRun  bool
+	dryRunCellN     int // log 1 in N cells' would-be decisions in dry-run; 0 disables
 	serveFreshOnly  bool
+	staleGrace      time.Duration
+	readOnly        bool
 	gmlStreaming    bool
+	debugHeaders    bool
+	geomPrecision   int
+	canonicalRings  bool
 	decider         adaptive.Decider
 	hot             *metricswrap.WithMetrics
+	hotThreshold    float64
+	hotTTL          time.Duration      // non-adaptive tier TTL for hot cells; 0 disables
+	layerRes        *layerres.Analyzer // per-layer base resolution; nil uses res for every layer
+	featureTTL      time.Duration      // floor for feature body TTLs; 0 uses the cell TTL
+	condFetch       bool               // refetch cells with their stored upstream validators
+	emptyRuns       *emptyRuns         // per-layer runs of empty cell fetches; nil disables the SRID check
+	capture         bool               // honour ?capture=true
+	captureDir      string
 	runID           string
+	reqLog          *mylog.RequestSampler
+
+	// life ends the engine's background jobs; stop, via Close, cancels it
+	life context.Context
+	stop context.CancelFunc
+
+	// since-start counters for /admin/stats; Prometheus keeps its own
+	hits    atomic.Int64
+	misses  atomic.Int64
+	started time.Time
+
+	// cells considered for dry-run logging, driving the 1-in-dryRunCellN cadence
+	dryRunCellSeen atomic.Uint64
+
+	// cell index key -> time.Time of this process's last fill of that entry
+	filledAt sync.Map
+
+	// "source:layer" keys whose TTL was raised to ttlMin, so each is warned
+	// about once
+	ttlFloored sync.Map
 }
 
 func init() {
 	scenarios.Register("cache", newCache)
 }
 
-// creates cache scenario query handler
+// creates cache scenario query handler over the CACHE_BACKEND stores
 func newCache(cfg config.Config, logger *slog.Logger, ex executor.Interface) (router.QueryHandler, error) {
-	rc, err := redisstore.New(context.Background(), cfg.RedisAddr)
+	return newCacheWithBackend(cfg, logger, ex, cachev2.Open)
+}
+
+// newCacheWithBackend builds the engine over the stores open returns; the
+// engine itself only talks to the FeatureStore and CellIndex interfaces
+func newCacheWithBackend(cfg config.Config, logger *slog.Logger, ex executor.Interface, open cachev2.Backend) (*Engine, error) {
+	v2store, err := open(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("redis client: %w", err)
+		return nil, err
 	}
-	v2store := cachev2.NewRedisStore(rc, cfg.CacheTTLDefault)
 	ows := ogc.OWSEndpoint(cfg.GeoServerURL)
 	u, err := url.Parse(ows)
 	if err != nil {
 		return nil, fmt.Errorf("parse ows url: %w", err)
 	}
 
+	// cached features may be corrupt; drop them rather than failing the request
+	agg := geojsonagg.NewAdvanced()
+	agg.SkipMalformed = true
+	if cfg.GeomPrecision > 0 {
+		agg.GeomPrecision = cfg.GeomPrecision
+	}
+	agg.ParseWorkers = cfg.AggParseWorkers
+	agg.CanonicalRings = cfg.GeomCanonicalRings
+	agg.DedupStrict = cfg.AggDedupStrict
+
 	e := &Engine{
 		logger: logger,
 		res:    cfg.H3Res,
@@ -92,31 +159,58 @@ func newCache(cfg config.Config, logger *slog.Logger, ex executor.Interface) (ro
 
 		mapr: h3mapper.New(),
 		eng: composer.Engine{
-			V2: composer.NewGeoJSONV2Adapter(geojsonagg.NewAdvanced()),
+			V2: composer.NewGeoJSONV2Adapter(agg),
 		},
 
-		store: newCacheAdapter(rc, cfg.CacheOpTimeout),
-
-		fs:  v2store.Features,
-		idx: v2store.Cells,
+		fs:    v2store.Features,
+		idx:   v2store.Cells,
+		keys:  v2store.Keys,
+		store: v2store,
 
 		owsURL: u,
-		http:   httpclient.NewOutbound(),
+		http:   httpclient.NewOutboundPool(httpclient.PoolFromConfig(cfg)),
 		exec:   ex,
 
-		ttlDefault: cfg.CacheTTLDefault,
-		ttlMap:     cfg.CacheTTLOvr,
+		ttlDefault:  cfg.CacheTTLDefault,
+		featureTTL:  cfg.FeatureTTL,
+		ttlMap:      cfg.CacheTTLOvr,
+		ttlMin:      cfg.CacheTTLMin,
+		ttlSeed:     cfg.AdaptiveSeed,
+		idProps:     cfg.IDProperties,
+		timeProp:    cfg.TimeProperty,
+		propTypes:   cfg.PropertyTypes,
+		stripProps:  cfg.StripProperties,
+		maxFeatures: cfg.MaxFeatures,
 
 		maxWorkers: cfg.CacheFillMaxWorkers,
+		fill:       newFillPool(cfg.CacheFillPoolWorkers, cfg.CacheFillQueue),
+		upstream:   newUpstreamLimiter(cfg.UpstreamMaxConcurrency),
 		queueSize:  cfg.CacheFillQueue,
+		queueWait:  cfg.CacheFillQueueWait,
 		opTimeout:  cfg.CacheOpTimeout,
 
+		mgetTimeout: cfg.CacheMGetTimeout,
+		setTimeout:  cfg.CacheSetTimeout,
+
 		adaptiveEnabled: cfg.AdaptiveEnabled,
 		adaptiveDryRun:  cfg.AdaptiveDryRun,
+		dryRunCellN:     cfg.AdaptiveDryRunCellSample,
 		serveFreshOnly:  cfg.AdaptiveServeOnlyIfFresh,
+		staleGrace:      cfg.CacheStaleGraceWindow,
+		readOnly:        cfg.CacheReadOnly,
 		gmlStreaming:    cfg.Features.GMLStreaming,
+		debugHeaders:    cfg.Features.DebugHeaders,
+		condFetch:       cfg.Features.ConditionalFetch,
+		emptyRuns:       newEmptyRuns(cfg.SRIDCheckEmptyCells),
+		capture:         cfg.Features.CaptureFixtures,
+		captureDir:      cfg.CaptureDir,
+		geomPrecision:   cfg.GeomPrecision,
+		canonicalRings:  cfg.GeomCanonicalRings,
 		runID:           fmt.Sprintf("%016x", cfg.AdaptiveSeed),
+		reqLog:          mylog.NewRequestSampler(cfg.SlowRequestThreshold, cfg.LogSampleN),
+		started:         time.Now(),
 	}
+	e.life, e.stop = context.WithCancel(context.Background())
 
 	// Adaptive: construct hotness tracker and decider (but respect feature flag).
 	if e.adaptiveEnabled {
@@ -136,66 +230,188 @@ func newCache(cfg config.Config, logger *slog.Logger, ex executor.Interface) (ro
 			hotReadOnly{w: e.hot},
 			e.mapr,
 		)
+	} else if cfg.CacheHotTTLTier && cfg.AdaptiveTTLHot > 0 {
+		// no decider; hotness only picks the TTL tier
+		e.hot = metricswrap.New(expdecay.New(cfg.HotHalfLife), "topN")
+		e.hotThreshold = cfg.HotThreshold
+		e.hotTTL = cfg.AdaptiveTTLHot
+	}
+
+	if lr := cfg.LayerRes; lr.Enabled {
+		e.layerRes = layerres.New(layerres.Config{
+			BaseRes:     cfg.H3Res,
+			MinRes:      cfg.H3ResMin,
+			MaxRes:      cfg.H3ResMax,
+			Window:      lr.Window,
+			Interval:    lr.Interval,
+			MinCells:    lr.MinCells,
+			MissRate:    lr.MissRate,
+			MaxFeatures: lr.MaxFeatures,
+			Apply:       lr.Apply,
+			MaxLayers:   lr.MaxLayers,
+		}, logger)
+		go e.layerRes.Run(e.life)
+	}
+
+	if c, ok := e.idx.(cellindex.EmptyMarkerCounter); ok && cfg.CacheEmptySampleInterval > 0 {
+		go e.sampleEmptyMarkers(e.life, c, cfg.CacheEmptySampleInterval)
+	}
+	if cfg.CacheOrphanSweepInterval > 0 {
+		if j := v2store.NewOrphanJanitor(cfg.CacheOrphanGrace, cfg.CacheOrphanMaxDeletes); j != nil {
+			go e.sweepOrphans(e.life, j, cfg.CacheOrphanSweepInterval)
+		} else {
+			logger.Warn("orphan sweep not supported by cache backend", "backend", cfg.CacheBackend)
+		}
 	}
 
 	return e, nil
 }
 
-type cacheAdapter struct {
-	cli     *redisstore.Client
-	timeout time.Duration
+// Close stops the engine's background jobs; the engine keeps serving
+func (e *Engine) Close() error {
+	if e.stop != nil {
+		e.stop()
+	}
+	return nil
 }
 
-func newCacheAdapter(c *redisstore.Client, t time.Duration) cacheiface.Interface {
-	return &cacheAdapter{cli: c, timeout: t}
+// baseRes is layer's base resolution: the layer analyzer's, when it runs
+func (e *Engine) baseRes(layer string) int {
+	if e.layerRes != nil {
+		return e.layerRes.Res(layer)
+	}
+	return e.res
 }
 
-// returns context with timeout if set
-func (a *cacheAdapter) withTimeout() (context.Context, context.CancelFunc) {
-	if a.timeout <= 0 {
-		return context.WithCancel(context.Background())
+// observeLayer feeds a served query to the layer analyzer
+func (e *Engine) observeLayer(ctx context.Context, layer string, res, cells, misses int, pages []composer.ShardPage) {
+	if e.layerRes == nil || observability.IsShadow(ctx) {
+		return
+	}
+	features := 0
+	for _, p := range pages {
+		features += len(p.Features)
 	}
-	return context.WithTimeout(context.Background(), a.timeout)
+	e.layerRes.Observe(layer, res, cells, misses, features)
 }
 
-func (a *cacheAdapter) MGet(ks []string) (map[string][]byte, error) {
-	ctx, cancel := a.withTimeout()
-	defer cancel()
-	m, err := a.cli.MGet(ctx, ks)
-	if err != nil {
-		return nil, fmt.Errorf("cache mget: %w", err)
+// keys SCANned per empty-marker estimate
+const emptyMarkerSample = 1000
+
+// sampleEmptyMarkers periodically publishes the estimated empty-marker key
+// count until life ends
+func (e *Engine) sampleEmptyMarkers(life context.Context, c cellindex.EmptyMarkerCounter, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-life.Done():
+			return
+		case <-t.C:
+		}
+		ctx, cancel := withTimeout(life, max(e.readTimeout(), time.Second))
+		n, err := c.CountEmptyMarkers(ctx, emptyMarkerSample)
+		cancel()
+		if err != nil {
+			e.logger.Debug("empty marker sample failed", "err", err)
+			continue
+		}
+		observability.SetEmptyMarkerKeys(n)
 	}
-	return m, nil
 }
 
-func (a *cacheAdapter) Set(key string, val []byte, ttl time.Duration) error {
-	ctx, cancel := a.withTimeout()
-	defer cancel()
-	if err := a.cli.Set(ctx, key, val, ttl); err != nil {
-		return fmt.Errorf("cache set %q: %w", key, err)
+// sweepOrphans periodically deletes feature keys no cell index references;
+// each sweep may take up to one interval and is cut short when life ends
+func (e *Engine) sweepOrphans(life context.Context, j *cachev2.OrphanJanitor, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		var now time.Time
+		select {
+		case <-life.Done():
+			return
+		case now = <-t.C:
+		}
+		ctx, cancel := context.WithTimeout(life, every)
+		n, err := j.Sweep(ctx, now)
+		cancel()
+		if err != nil {
+			e.logger.Warn("orphan feature sweep failed", "err", err)
+			continue
+		}
+		observability.AddOrphanFeaturesDeleted(n)
+		if n > 0 {
+			e.logger.Info("orphan feature sweep", "deleted", n)
+		}
 	}
-	return nil
 }
 
-func (a *cacheAdapter) Del(ks ...string) error {
-	ctx, cancel := a.withTimeout()
-	defer cancel()
-	if err := a.cli.Del(ctx, ks...); err != nil {
-		return fmt.Errorf("cache del %d keys: %w", len(ks), err)
+// returns context with timeout if set
+func withTimeout(parent context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(parent)
 	}
-	return nil
+	return context.WithTimeout(parent, d)
+}
+
+// ForwardGetFeatureFormat proxies GeoServer-native outputFormats, bypassing the cache
+func (e *Engine) ForwardGetFeatureFormat(w http.ResponseWriter, r *http.Request, q model.QueryRequest, format string) {
+	if e.exec == nil {
+		problem.Error(w, r, "upstream executor not configured", http.StatusBadGateway)
+		return
+	}
+	e.exec.ForwardGetFeatureFormat(w, r, q, format)
 }
 
 type result struct {
 	cell string
 	key  string
-	body []byte
-	err  error
+	// features are the cell's upstream features, in response order
+	features []json.RawMessage
+	err      error
+	// matched is the upstream's numberMatched for the cell, 0 if unreported
+	matched int
+	// notModified is set when the upstream answered 304 to stored validators
+	notModified bool
+}
+
+// recordHotness counts a query against each of its cells when adaptivity or
+// hot TTLs need the scores
+func (e *Engine) recordHotness(ctx context.Context, cells model.Cells, adaptiveOn bool) {
+	if (!adaptiveOn && e.hotTTL <= 0) || e.hot == nil {
+		return
+	}
+	for _, c := range cells {
+		e.hot.Inc(c)
+		if !observability.IsShadow(ctx) {
+			observability.ObserveHotnessValueSample(c, e.hot.Score(c))
+		}
+	}
 }
 
+// RecordHit counts a query served without HandleQuery, such as a coalesced
+// duplicate, toward the hotness of its cells
+func (e *Engine) RecordHit(ctx context.Context, q model.QueryRequest) {
+	baseRes := e.baseRes(q.Layer)
+	if q.H3Res > 0 {
+		baseRes = q.H3Res
+	}
+	cells, err := e.cellsForRes(q, baseRes)
+	if err != nil {
+		return
+	}
+	e.recordHotness(ctx, cells, e.adaptiveEnabled && q.H3Res <= 0)
+}
+
+var _ router.HitRecorder = (*Engine)(nil)
+
 func (e *Engine) HandleQuery(ctx context.Context, w http.ResponseWriter, r *http.Request, q model.QueryRequest) {
 	start := time.Now()
 
+	// cached features are stored as GeoJSON only, whatever was asked for, so
+	// the format is never part of a key; GML bypasses the cache instead of
+	// being converted, and Vary keeps shared caches from crossing the two
+	w.Header().Add("Vary", "Accept")
 	neg := composer.NegotiateFormat(composer.NegotiationInput{
 		AcceptHeader:  r.Header.Get("Accept"),
 		OutputFormat:  r.URL.Query().Get("outputFormat"),
@@ -204,62 +420,82 @@ func (e *Engine) HandleQuery(ctx context.Context, w http.ResponseWriter, r *http
 	if neg.Format == composer.FormatGML32 {
 		if e.gmlStreaming && e.exec != nil {
 			const gml32 = "application/gml+xml; version=3.2"
+			w.Header().Set(composer.HeaderXCache, composer.XCacheBypass)
 			e.exec.ForwardGetFeatureFormat(w, r, q, gml32)
 			return
 		}
-		w.Header().Set("Vary", "Accept")
-		http.Error(w, "gml not enabled; request GeoJSON or enable features.gml_streaming", http.StatusNotAcceptable)
+		problem.Error(w, r, "gml not enabled; request GeoJSON or enable features.gml_streaming", http.StatusNotAcceptable)
 		return
 	}
 
-	cells, err := e.cellsForRes(q, e.res)
+	// an explicit res pins the resolution for this request, bypassing adaptivity
+	baseRes := e.baseRes(q.Layer)
+	pinned := q.H3Res > 0
+	if pinned {
+		baseRes = q.H3Res
+	}
+
+	cells, err := e.cellsForRes(q, baseRes)
 	if err != nil {
 		e.logger.Error("h3 mapping failed", "err", err)
-		http.Error(w, "failed to map query footprint", http.StatusBadRequest)
+		problem.Error(w, r, "failed to map query footprint", http.StatusBadRequest)
+		return
+	}
+	if len(cells) == 0 && e.exec != nil && hasExtent(q) {
+		e.serveTiny(ctx, w, r, q, baseRes, start)
 		return
 	}
 	if len(cells) == 0 {
 		req := composer.Request{
-			Query:        composer.QueryParams{Limit: 0, Offset: 0},
+			Query:        e.composeParams(q),
 			Pages:        nil,
 			AcceptHeader: r.Header.Get("Accept"),
 			OutputFormat: r.URL.Query().Get("outputFormat"),
 		}
-		res, err := composer.Compose(r.Context(), e.eng, req)
+		res, err := composer.Compose(ctx, e.eng, req)
 		if err != nil {
-			http.Error(w, "compose error: "+err.Error(), http.StatusInternalServerError)
+			problem.Error(w, r, "compose error: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
 		w.Header().Set("Content-Type", res.ContentType)
+		e.setDiagnostics(w, res.Diagnostics)
+		w.Header().Set(composer.HeaderXCache, composer.XCacheValue(res.HitClass))
 		w.WriteHeader(res.StatusCode)
 		_, _ = w.Write(res.Body)
 		return
 	}
 
-	if e.adaptiveEnabled && e.hot != nil {
-		for _, c := range cells {
-			e.hot.Inc(c)
-			observability.ObserveHotnessValueSample(c, e.hot.Score(c))
-		}
-	}
+	adaptiveOn := e.adaptiveEnabled && !pinned
+	e.recordHotness(ctx, cells, adaptiveOn)
 
-	dec := adaptive.Decision{Type: adaptive.DecisionFill, Resolution: e.res, TTL: e.ttlFor(q.Layer)}
+	dec := adaptive.Decision{Type: adaptive.DecisionFill, Resolution: baseRes, TTL: e.ttlFor(q.Layer)}
 	reason := adaptive.ReasonDefaultFill
-	applyDecision := e.adaptiveEnabled && !e.adaptiveDryRun && e.decider != nil
+	// read-only mode never acts on decisions, so the decider effectively runs dry
+	applyDecision := adaptiveOn && !e.adaptiveDryRun && !e.readOnly && e.decider != nil
+	decided := adaptiveOn && e.decider != nil
 
-	if e.adaptiveEnabled && e.decider != nil {
+	if decided {
 		decideStart := time.Now()
-		d, r := e.decider.Decide(adaptive.Query{
+		aq := adaptive.Query{
 			Layer:   q.Layer,
 			Cells:   cells,
-			BaseRes: e.res,
+			BaseRes: baseRes,
 			MinRes:  e.minRes,
 			MaxRes:  e.maxRes,
-		}, hotReadOnly{w: e.hot})
-		dec, reason = d, r
+		}
+		// the candidate sweep costs an extra pass over the neighbouring
+		// resolutions, so it is only taken when debug logs would show it
+		var sweep []adaptive.Candidate
+		if sd, ok := e.decider.(adaptive.SweepDecider); ok && e.logger.Enabled(ctx, slog.LevelDebug) {
+			dec, reason, sweep = sd.DecideWithSweep(aq, hotReadOnly{w: e.hot})
+		} else {
+			dec, reason = e.decider.Decide(aq, hotReadOnly{w: e.hot})
+		}
 
-		observability.ObserveAdaptiveDecision(decisionLabel(dec.Type), string(reason))
-		e.logger.Info("adaptive_decision",
+		if !observability.IsShadow(ctx) {
+			observability.ObserveAdaptiveDecision(decisionLabel(dec.Type), string(reason))
+		}
+		args := []any{
 			"run_id", e.runID,
 			"layer", q.Layer,
 			"decision", decisionLabel(dec.Type),
@@ -267,28 +503,38 @@ func (e *Engine) HandleQuery(ctx context.Context, w http.ResponseWriter, r *http
 			"resolution", dec.Resolution,
 			"ttl", dec.TTL.String(),
 			"cells", len(cells),
-			"dry_run", e.adaptiveDryRun,
+			"dry_run", e.adaptiveDryRun || e.readOnly,
 			"dur", time.Since(decideStart).String(),
-		)
+		}
+		if sweep != nil {
+			args = append(args, "candidates", sweep)
+		}
+		e.logger.Info("adaptive_decision", args...)
+		if !applyDecision {
+			e.logDryRunCells(q, cells, baseRes)
+			e.setDryRunHeaders(w, q.Layer, dec, reason)
+		}
 	}
 
-	resToUse := e.res
+	resToUse := baseRes
 	if applyDecision {
 		resToUse = dec.Resolution
 	}
 	ttl := e.ttlFor(q.Layer)
 	if applyDecision && dec.TTL > 0 {
-		ttl = dec.TTL
+		ttl = e.floorTTL(q.Layer, "adaptive", dec.TTL)
 	}
 
-	if resToUse != e.res {
+	if resToUse != baseRes {
 		cells, err = e.cellsForRes(q, resToUse)
 		if err != nil {
-			http.Error(w, "failed to compute cells for adaptive resolution", http.StatusBadRequest)
+			problem.Error(w, r, "failed to compute cells for adaptive resolution", http.StatusBadRequest)
 			return
 		}
 	}
 
+	e.setCellHeaders(w, resToUse, cells)
+
 	if applyDecision && dec.Type == adaptive.DecisionBypass {
 		body, _, err := e.exec.FetchGetFeature(ctx, q)
 		if err != nil {
@@ -302,15 +548,12 @@ func (e *Engine) HandleQuery(ctx context.Context, w http.ResponseWriter, r *http
 				"run_id", e.runID,
 				"err", err,
 			)
-			http.Error(w, "upstream error: "+err.Error(), http.StatusBadGateway)
+			problem.Error(w, r, "upstream error: "+err.Error(), http.StatusBadGateway)
 			return
 		}
 
 		req := composer.Request{
-			Query: composer.QueryParams{
-				Limit:  0,
-				Offset: 0,
-			},
+			Query: e.composeParams(q),
 			Pages: []composer.ShardPage{
 				{Body: body, CacheStatus: composer.CacheMiss},
 			},
@@ -330,17 +573,20 @@ func (e *Engine) HandleQuery(ctx context.Context, w http.ResponseWriter, r *http
 				"run_id", e.runID,
 				"err", err,
 			)
-			http.Error(w, "compose error: "+err.Error(), http.StatusBadGateway)
+			problem.Error(w, r, "compose error: "+err.Error(), http.StatusBadGateway)
 			return
 		}
 
+		e.captureFixture(w, r, q, resToUse, cells, fixtureDecision(dec, reason, decided, applyDecision, nil), req, res)
 		w.Header().Set("Content-Type", res.ContentType)
+		e.setDiagnostics(w, res.Diagnostics)
+		w.Header().Set(composer.HeaderXCache, composer.XCacheValue(res.HitClass))
 		w.WriteHeader(res.StatusCode)
 		_, _ = w.Write(res.Body)
 
-		observability.ObserveSpatialRead("miss", false)
+		observeRead(ctx, "miss", false)
 
-		e.logger.Info("cache bypass",
+		e.logRequest(ctx, "cache bypass", time.Since(start),
 			"layer", q.Layer,
 			"res_to_use", resToUse,
 			"cells", len(cells),
@@ -366,10 +612,8 @@ func (e *Engine) HandleQuery(ctx context.Context, w http.ResponseWriter, r *http
 		missing = append(missing, cells...)
 
 		if serveOnlyIfFresh && len(missing) > 0 {
-			observability.IncFreshReject("miss")
-			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-			w.WriteHeader(http.StatusPreconditionFailed)
-			_, _ = w.Write([]byte("fresh content required"))
+			incFreshReject(ctx, "miss")
+			problem.Error(w, r, "fresh content required", http.StatusPreconditionFailed)
 			return
 		}
 	} else {
@@ -380,7 +624,9 @@ func (e *Engine) HandleQuery(ctx context.Context, w http.ResponseWriter, r *http
 		allIDsSet := make(map[string]struct{}, len(cells)*4)
 		allIDs = allIDs[:0]
 
-		idsByCell, err := e.idx.MGetIDs(ctx, q.Layer, resToUse, cells, model.Filters(q.Filters))
+		mgetCtx, cancelMGet := withTimeout(ctx, e.readTimeout())
+		idsByCell, err := e.idx.MGetIDs(mgetCtx, keys.ScopedLayer(q.Layer, q.Headers), resToUse, cells, model.Filters(q.Filters))
+		cancelMGet()
 		if err != nil {
 			e.logger.Warn("cell index mget error, treating all cells as miss",
 				"layer", q.Layer,
@@ -391,6 +637,7 @@ func (e *Engine) HandleQuery(ctx context.Context, w http.ResponseWriter, r *http
 			missingCells = append(missingCells, cells...)
 			indexMissCount += len(cells)
 		} else {
+			emptyCells := 0
 			for _, cell := range cells {
 				ids, ok := idsByCell[cell]
 				if !ok || len(ids) == 0 {
@@ -401,6 +648,7 @@ func (e *Engine) HandleQuery(ctx context.Context, w http.ResponseWriter, r *http
 
 				if len(ids) == 1 && ids[0] == cellindex.EmptyMarkerID {
 					indexHitCount++
+					emptyCells++
 					continue
 				}
 
@@ -416,13 +664,18 @@ func (e *Engine) HandleQuery(ctx context.Context, w http.ResponseWriter, r *http
 					allIDs = append(allIDs, id)
 				}
 			}
+			if !observability.IsShadow(ctx) {
+				observability.ObserveCellLookup(q.Layer, len(cells), emptyCells)
+			}
 		}
 
 		featsByID := make(map[string][]byte, len(allIDs))
 		var featsFound, featsMissing int
 
 		if len(allIDs) > 0 {
-			m, err := e.fs.MGetFeatures(ctx, q.Layer, allIDs)
+			mgetCtx, cancelMGet := withTimeout(ctx, e.readTimeout())
+			m, err := e.fs.MGetFeatures(mgetCtx, keys.ScopedLayer(q.Layer, q.Headers), allIDs)
+			cancelMGet()
 			if err != nil {
 				e.logger.Warn("feature store mget error, treating as miss for affected cells",
 					"layer", q.Layer,
@@ -449,6 +702,7 @@ func (e *Engine) HandleQuery(ctx context.Context, w http.ResponseWriter, r *http
 			}
 		}
 
+		pageCells := make([]string, 0, len(cellsWithIndexHit))
 		for _, cell := range cellsWithIndexHit {
 			ids := cellToIDs[cell]
 			if len(ids) == 0 {
@@ -481,13 +735,15 @@ func (e *Engine) HandleQuery(ctx context.Context, w http.ResponseWriter, r *http
 				CacheStatus: composer.CacheHit,
 				Features:    feats,
 				GeomHashes:  hashes,
+				Cell:        cell,
 			})
+			pageCells = append(pageCells, cell)
 		}
 
 		staleAny := false
 		lastInv := observability.GetLayerInvalidatedAtUnix(q.Layer)
 		if lastInv > 0 && len(pages) > 0 {
-			staleAny = true
+			staleAny = e.anyStale(q, resToUse, pageCells, time.Unix(lastInv, 0))
 		}
 
 		if serveOnlyIfFresh && (staleAny || len(missingCells) > 0) {
@@ -495,22 +751,27 @@ func (e *Engine) HandleQuery(ctx context.Context, w http.ResponseWriter, r *http
 			if staleAny {
 				reasonStr = "stale"
 			}
-			observability.IncFreshReject(reasonStr)
-			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-			w.WriteHeader(http.StatusPreconditionFailed)
-			_, _ = w.Write([]byte("fresh content required"))
+			incFreshReject(ctx, reasonStr)
+			problem.Error(w, r, "fresh content required", http.StatusPreconditionFailed)
 			return
 		}
 
+		// consistency=strict trades an upstream count for a full hit that is
+		// known to match; a mismatch refetches every cell
+		if len(missingCells) == 0 && q.StrictConsistency && !e.revalidateHit(ctx, q, resToUse, cells, len(allIDs)) {
+			missingCells = append(missingCells, cells...)
+			pages = pages[:0]
+		}
+
 		if len(missingCells) == 0 {
 			req := composer.Request{
-				Query:        composer.QueryParams{Limit: 0, Offset: 0},
+				Query:        e.composeParams(q),
 				Pages:        pages,
 				AcceptHeader: r.Header.Get("Accept"),
 				OutputFormat: r.URL.Query().Get("outputFormat"),
 			}
 
-			res, err := composer.Compose(r.Context(), e.eng, req)
+			res, err := composer.Compose(ctx, e.eng, req)
 			if err != nil {
 				e.logger.Error("cache compose error on full-hit (feature-centric)",
 					"scenario", "cache",
@@ -528,17 +789,23 @@ func (e *Engine) HandleQuery(ctx context.Context, w http.ResponseWriter, r *http
 					"run_id", e.runID,
 					"err", err,
 				)
-				http.Error(w, "compose error: "+err.Error(), http.StatusBadGateway)
+				problem.Error(w, r, "compose error: "+err.Error(), http.StatusBadGateway)
 				return
 			}
 			w.Header().Set("Content-Type", res.ContentType)
+			e.setDiagnostics(w, res.Diagnostics)
+			w.Header().Set(composer.HeaderXCache, composer.XCacheValue(res.HitClass))
+			e.captureFixture(w, r, q, resToUse, cells, fixtureDecision(dec, reason, decided, applyDecision, nil), req, res)
 			w.WriteHeader(res.StatusCode)
 			_, _ = w.Write(res.Body)
 
-			observability.ObserveSpatialRead("hit", staleAny)
-			observability.AddCacheHits(len(pages))
+			observeRead(ctx, "hit", staleAny)
+			e.addHits(ctx, len(pages))
+			if !pinned {
+				e.observeLayer(ctx, q.Layer, resToUse, len(cells), 0, pages)
+			}
 
-			e.logger.Info("cache full-hit (feature-centric)",
+			e.logRequest(ctx, "cache full-hit (feature-centric)", time.Since(start),
 				"layer", q.Layer,
 				"res_to_use", resToUse,
 				"cells", len(cells),
@@ -556,75 +823,49 @@ func (e *Engine) HandleQuery(ctx context.Context, w http.ResponseWriter, r *http
 			return
 		}
 
-		observability.AddCacheHits(len(pages))
+		e.addHits(ctx, len(pages))
 		missing = missingCells
 	}
 
+	if e.readOnly {
+		e.serveReadOnly(ctx, w, r, q, resToUse, cells, fixtureDecision(dec, reason, decided, applyDecision, missing), start)
+		return
+	}
+
 	fillStart := time.Now()
 
 	if len(missing) == 0 {
 		missing = nil
 	}
 
-	jobs := make(chan string, e.queueSize)
-	results := make(chan result, len(missing))
-
-	workerN := e.maxWorkers
-	if workerN <= 0 {
-		workerN = 8
-	}
-	var wg sync.WaitGroup
-	wg.Add(workerN)
-
-	for range workerN {
-		go func() {
-			defer wg.Done()
-			for cell := range jobs {
-				select {
-				case <-ctx.Done():
-					return
-				default:
-				}
-				res := e.fetchCell(ctx, q, cell, resToUse, ttl)
-				select {
-				case results <- res:
-				case <-ctx.Done():
-					return
-				}
-			}
-		}()
+	results, err := e.fillCells(ctx, missing, func(ctx context.Context, cell string) result {
+		return e.fetchCell(ctx, q, cell, resToUse, e.staggerTTL(e.tierTTL(ttl, cell), resToUse, cell))
+	})
+	if errors.Is(err, errFillQueueFull) {
+		observability.IncFillQueueReject()
+		w.Header().Set("Retry-After", e.fillRetryAfter())
+		problem.Error(w, r, "cache fill queue is saturated; retry later", http.StatusServiceUnavailable)
+		return
 	}
-
-	for _, c := range missing {
-		select {
-		case jobs <- c:
-		case <-ctx.Done():
-			close(jobs)
-			wg.Wait()
-			http.Error(w, "request canceled", http.StatusRequestTimeout)
-			return
-		}
+	if err != nil {
+		problem.Error(w, r, "request canceled", http.StatusRequestTimeout)
+		return
 	}
-	close(jobs)
-	wg.Wait()
-	close(results)
 
-	fetched := make([][]byte, 0, len(missing))
+	fetched := make([]result, 0, len(missing))
 	var errs []error
-	for rres := range results {
+	for _, rres := range results {
 		if rres.err != nil {
 			errs = append(errs, rres.err)
 			continue
 		}
-		if len(rres.body) > 0 {
-			fetched = append(fetched, rres.body)
-		}
+		fetched = append(fetched, rres)
 	}
 
-	observability.AddCacheMisses(len(missing))
+	e.addMisses(ctx, len(missing))
 
-	for _, b := range fetched {
-		pages = append(pages, composer.ShardPage{Body: b, CacheStatus: composer.CacheMiss})
+	for _, f := range fetched {
+		pages = append(pages, composer.ShardPage{Features: f.features, CacheStatus: composer.CacheMiss, NumberMatched: f.matched, Cell: f.cell})
 	}
 
 	if len(errs) > 0 {
@@ -652,17 +893,17 @@ func (e *Engine) HandleQuery(ctx context.Context, w http.ResponseWriter, r *http
 			"sample_err", errs[0].Error(),
 		)
 
-		http.Error(w, msg.String(), http.StatusBadGateway)
+		problem.Error(w, r, msg.String(), http.StatusBadGateway)
 		return
 	}
 
 	req := composer.Request{
-		Query:        composer.QueryParams{Limit: 0, Offset: 0},
+		Query:        e.composeParams(q),
 		Pages:        pages,
 		AcceptHeader: r.Header.Get("Accept"),
 		OutputFormat: r.URL.Query().Get("outputFormat"),
 	}
-	res, err := composer.Compose(r.Context(), e.eng, req)
+	res, err := composer.Compose(ctx, e.eng, req)
 	if err != nil {
 		e.logger.Error("cache compose error on partial-miss (feature-centric)",
 			"scenario", "cache",
@@ -678,15 +919,21 @@ func (e *Engine) HandleQuery(ctx context.Context, w http.ResponseWriter, r *http
 			"run_id", e.runID,
 			"err", err,
 		)
-		http.Error(w, "compose error: "+err.Error(), http.StatusBadGateway)
+		problem.Error(w, r, "compose error: "+err.Error(), http.StatusBadGateway)
 		return
 	}
 	w.Header().Set("Content-Type", res.ContentType)
+	e.setDiagnostics(w, res.Diagnostics)
+	w.Header().Set(composer.HeaderXCache, composer.XCacheValue(res.HitClass))
+	e.captureFixture(w, r, q, resToUse, cells, fixtureDecision(dec, reason, decided, applyDecision, missing), req, res)
 	w.WriteHeader(res.StatusCode)
 	_, _ = w.Write(res.Body)
 
-	observability.ObserveSpatialRead("miss", false)
-	e.logger.Info("cache partial-miss (feature-centric)",
+	observeRead(ctx, "miss", false)
+	if !pinned {
+		e.observeLayer(ctx, q.Layer, resToUse, len(cells), len(missing), pages)
+	}
+	e.logRequest(ctx, "cache partial-miss (feature-centric)", time.Since(start),
 		"layer", q.Layer,
 		"res_to_use", resToUse,
 		"cells", len(cells),
@@ -703,6 +950,220 @@ func (e *Engine) HandleQuery(ctx context.Context, w http.ResponseWriter, r *http
 	)
 }
 
+// serveReadOnly answers a miss with one upstream GetFeature for the whole query
+// and writes nothing to the feature store or cell index
+func (e *Engine) serveReadOnly(
+	ctx context.Context,
+	w http.ResponseWriter,
+	r *http.Request,
+	q model.QueryRequest,
+	res int,
+	cells model.Cells,
+	d composer.FixtureDecision,
+	start time.Time,
+) {
+	missing := len(d.MissingCells)
+	if e.exec == nil {
+		problem.Error(w, r, "upstream executor not configured", http.StatusBadGateway)
+		return
+	}
+	body, _, err := e.exec.FetchGetFeature(ctx, q)
+	if err != nil {
+		e.logger.Error("cache read-only upstream error",
+			"scenario", "cache",
+			"layer", q.Layer,
+			"res_to_use", res,
+			"missing_cells", missing,
+			"run_id", e.runID,
+			"err", err,
+		)
+		problem.Error(w, r, "upstream error: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	req := composer.Request{
+		Query: e.composeParams(q),
+		Pages: []composer.ShardPage{
+			{Body: body, CacheStatus: composer.CacheMiss},
+		},
+		AcceptHeader: r.Header.Get("Accept"),
+		OutputFormat: r.URL.Query().Get("outputFormat"),
+	}
+	out, err := composer.Compose(ctx, e.eng, req)
+	if err != nil {
+		e.logger.Error("cache compose error on read-only miss",
+			"scenario", "cache",
+			"layer", q.Layer,
+			"res_to_use", res,
+			"run_id", e.runID,
+			"err", err,
+		)
+		problem.Error(w, r, "compose error: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	e.captureFixture(w, r, q, res, cells, d, req, out)
+	w.Header().Set("Content-Type", out.ContentType)
+	e.setDiagnostics(w, out.Diagnostics)
+	w.Header().Set(composer.HeaderXCache, composer.XCacheMissReadOnly)
+	w.WriteHeader(out.StatusCode)
+	_, _ = w.Write(out.Body)
+
+	e.addMisses(ctx, missing)
+	observeRead(ctx, "miss", false)
+	e.logRequest(ctx, "cache read-only miss", time.Since(start),
+		"layer", q.Layer,
+		"res_to_use", res,
+		"cells", len(cells),
+		"missing_cells", missing,
+		"run_id", e.runID,
+		"dur", time.Since(start).String(),
+	)
+}
+
+// serveTiny fetches a footprint that maps to no cells at res straight from
+// upstream; nothing is cached since there is no cell to key it under
+func (e *Engine) serveTiny(ctx context.Context, w http.ResponseWriter, r *http.Request, q model.QueryRequest, res int, start time.Time) {
+	body, _, err := e.exec.FetchGetFeature(ctx, q)
+	if err != nil {
+		e.logger.Error("cache tiny-footprint upstream error",
+			"scenario", "cache",
+			"layer", q.Layer,
+			"res", res,
+			"run_id", e.runID,
+			"err", err,
+		)
+		problem.Error(w, r, "upstream error: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	req := composer.Request{
+		Query: e.composeParams(q),
+		Pages: []composer.ShardPage{
+			{Body: body, CacheStatus: composer.CacheMiss},
+		},
+		AcceptHeader: r.Header.Get("Accept"),
+		OutputFormat: r.URL.Query().Get("outputFormat"),
+	}
+	out, err := composer.Compose(ctx, e.eng, req)
+	if err != nil {
+		e.logger.Error("cache compose error on tiny footprint",
+			"scenario", "cache",
+			"layer", q.Layer,
+			"res", res,
+			"run_id", e.runID,
+			"err", err,
+		)
+		problem.Error(w, r, "compose error: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	e.captureFixture(w, r, q, res, nil, composer.FixtureDecision{}, req, out)
+	w.Header().Set("Content-Type", out.ContentType)
+	e.setDiagnostics(w, out.Diagnostics)
+	w.Header().Set(composer.HeaderXCache, composer.XCacheBypassTiny)
+	w.WriteHeader(out.StatusCode)
+	_, _ = w.Write(out.Body)
+
+	observeRead(ctx, "miss", false)
+	e.logRequest(ctx, "cache tiny-footprint bypass", time.Since(start),
+		"layer", q.Layer,
+		"res", res,
+		"run_id", e.runID,
+		"dur", time.Since(start).String(),
+	)
+}
+
+// reports whether q has a footprint with area, i.e. one that can hold features
+// even when polyfill finds no cell centers inside it
+func hasExtent(q model.QueryRequest) bool {
+	switch {
+	case q.Polygon != nil:
+		return true
+	case q.BBox != nil:
+		return q.BBox.X2 > q.BBox.X1 && q.BBox.Y2 > q.BBox.Y1
+	default:
+		return false
+	}
+}
+
+// logRequest writes a per-request log at the level the latency sampler picks,
+// or not at all when a fast request is sampled out
+func (e *Engine) logRequest(ctx context.Context, msg string, dur time.Duration, args ...any) {
+	lvl, ok := e.reqLog.Level(dur)
+	if !ok {
+		return
+	}
+	e.logger.Log(ctx, lvl, msg, args...)
+}
+
+// composeParams is the composer query for q, shared by every compose path so
+// none of them drops a field such as Provenance
+func (e *Engine) composeParams(q model.QueryRequest) composer.QueryParams {
+	return composer.QueryParams{
+		Sort:            composer.SortKeysFromModel(q.Sort),
+		Limit:           e.maxFeatures,
+		Offset:          0,
+		GeomPrecision:   q.GeomPrecision,
+		IDProperty:      config.IDPropertyFor(e.idProps, q.Layer),
+		TimeProperty:    e.timeProp,
+		PropertyTypes:   config.PropertyTypesFor(e.propTypes, q.Layer),
+		StripProperties: e.stripProps,
+		CreatedAfter:    q.CreatedAfter,
+		CreatedBefore:   q.CreatedBefore,
+		Provenance:      q.Provenance,
+	}
+}
+
+func (e *Engine) setDiagnostics(w http.ResponseWriter, d *composer.Diagnostics) {
+	if e.debugHeaders {
+		composer.SetDiagnosticHeaders(w.Header(), d)
+	}
+}
+
+// Debug headers describing the cells a query was served from
+const (
+	HeaderH3Resolution = "X-H3-Resolution"
+	HeaderH3CellCount  = "X-H3-Cell-Count"
+	HeaderH3Cell       = "X-H3-Cell"
+)
+
+// setCellHeaders reports the resolution actually used and the cell count;
+// single-cell probes also get the cell token
+func (e *Engine) setCellHeaders(w http.ResponseWriter, res int, cells model.Cells) {
+	if !e.debugHeaders {
+		return
+	}
+	h := w.Header()
+	h.Set(HeaderH3Resolution, strconv.Itoa(res))
+	h.Set(HeaderH3CellCount, strconv.Itoa(len(cells)))
+	if len(cells) == 1 {
+		h.Set(HeaderH3Cell, cells[0])
+	}
+}
+
+// Headers reporting the decision a dry run would have applied
+const (
+	HeaderAdaptiveDecision   = "X-Adaptive-Decision"
+	HeaderAdaptiveReason     = "X-Adaptive-Reason"
+	HeaderAdaptiveResolution = "X-Adaptive-Resolution"
+	HeaderAdaptiveTTL        = "X-Adaptive-TTL" // seconds
+)
+
+// setDryRunHeaders reports the decision the decider made but that wasn't
+// applied, so dry runs can be checked against live traffic without the logs.
+// TTL is the one the fill would have used: the decision's, or the layer's,
+// raised to CACHE_TTL_MIN
+func (e *Engine) setDryRunHeaders(w http.ResponseWriter, layer string, dec adaptive.Decision, reason adaptive.Reason) {
+	ttl := e.floorTTL(layer, "adaptive", dec.TTL)
+	if ttl <= 0 {
+		ttl = e.ttlFor(layer)
+	}
+	h := w.Header()
+	h.Set(HeaderAdaptiveDecision, decisionLabel(dec.Type))
+	h.Set(HeaderAdaptiveReason, string(reason))
+	h.Set(HeaderAdaptiveResolution, strconv.Itoa(dec.Resolution))
+	h.Set(HeaderAdaptiveTTL, strconv.FormatInt(int64(ttl.Round(time.Second)/time.Second), 10))
+}
+
 func (e *Engine) cellsForRes(q model.QueryRequest, res int) (model.Cells, error) {
 	switch {
 	case q.Polygon != nil:
@@ -723,6 +1184,11 @@ func (e *Engine) cellsForRes(q model.QueryRequest, res int) (model.Cells, error)
 }
 
 func (e *Engine) ttlFor(layer string) time.Duration {
+	return e.floorTTL(layer, "layer", e.layerTTL(layer))
+}
+
+// layerTTL is the configured TTL for layer: its override, or the default
+func (e *Engine) layerTTL(layer string) time.Duration {
 	if layer == "" {
 		return e.ttlDefault
 	}
@@ -738,8 +1204,106 @@ func (e *Engine) ttlFor(layer string) time.Duration {
 	return e.ttlDefault
 }
 
+// floorTTL raises a positive ttl below CACHE_TTL_MIN to the floor; source
+// says where it came from. The first raise per layer and source is a
+// warning, since it usually means a misconfigured override or adaptive tier
+func (e *Engine) floorTTL(layer, source string, ttl time.Duration) time.Duration {
+	if e.ttlMin <= 0 || ttl <= 0 || ttl >= e.ttlMin {
+		return ttl
+	}
+	lvl := slog.LevelDebug
+	if _, seen := e.ttlFloored.LoadOrStore(source+":"+layer, struct{}{}); !seen {
+		lvl = slog.LevelWarn
+	}
+	e.logger.Log(context.Background(), lvl, "cache ttl raised to floor",
+		"layer", layer,
+		"source", source,
+		"ttl", ttl.String(),
+		"floor", e.ttlMin.String(),
+	)
+	return e.ttlMin
+}
+
+// tierTTL raises ttl to the hot tier for cells at or over the hotness
+// threshold when tiering runs without the adaptive decider
+func (e *Engine) tierTTL(ttl time.Duration, cell string) time.Duration {
+	if e.hotTTL <= ttl || e.hot == nil {
+		return ttl
+	}
+	if e.hot.Score(cell) >= e.hotThreshold {
+		return e.hotTTL
+	}
+	return ttl
+}
+
+// TTL fractions: trimmed per resolution level, and max jitter (kept below one
+// level so coarser resolutions always outlive finer ones)
+const (
+	ttlStaggerDiv = 64
+	ttlJitterDiv  = 128
+)
+
+// staggerTTL trims ttl by resolution plus a per-cell jitter seeded from
+// AdaptiveSeed, so coarse and fine entries over one area don't expire together;
+// it never exceeds the configured ttl, nor trims it below CACHE_TTL_MIN
+func (e *Engine) staggerTTL(ttl time.Duration, res int, cell string) time.Duration {
+	if ttl <= 0 {
+		return ttl
+	}
+	offset := ttl * time.Duration(res) / ttlStaggerDiv
+	span := uint64(ttl / ttlJitterDiv)
+	if span == 0 {
+		return max(ttl-offset, min(e.ttlMin, ttl))
+	}
+	h := xxhash.Sum64String(fmt.Sprintf("%d:%d:%s", e.ttlSeed, res, cell))
+	return max(ttl-offset-time.Duration(h%span), min(e.ttlMin, ttl))
+}
+
+// isXMLContentType reports whether ct names an XML representation such as
+// GML or an OWS exception report
+func isXMLContentType(ct string) bool {
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	return strings.HasSuffix(mt, "/xml") || strings.HasSuffix(mt, "+xml")
+}
+
 func (e *Engine) fetchCell(ctx context.Context, q model.QueryRequest, cell string, res int, ttl time.Duration) result {
-	key := keys.Key(q.Layer, res, cell, q.Filters)
+	r := e.fetchCellConditional(ctx, q, cell, res, ttl)
+	if r.err == nil {
+		e.checkEmptyRun(ctx, q, cell, len(r.features))
+	}
+	return r
+}
+
+// fetchCellConditional sends the cell's stored validators when there are any
+// and rebuilds it from cached features on a 304
+func (e *Engine) fetchCellConditional(ctx context.Context, q model.QueryRequest, cell string, res int, ttl time.Duration) result {
+	prev, ok := e.cellValidator(ctx, q, res, cell)
+	if !ok {
+		return e.fetchCellWith(ctx, q, cell, res, ttl, nil)
+	}
+	r := e.fetchCellWith(ctx, q, cell, res, ttl, &prev)
+	if !r.notModified {
+		if r.err == nil {
+			observability.IncConditionalFetch("modified")
+		}
+		return r
+	}
+	if rr, ok := e.revalidateCell(ctx, q, cell, res, ttl, prev); ok {
+		observability.IncConditionalFetch("not_modified")
+		return rr
+	}
+	// the features the validators vouch for are gone; fetch the body after all
+	observability.IncConditionalFetch("evicted")
+	return e.fetchCellWith(ctx, q, cell, res, ttl, nil)
+}
+
+// fetchCellWith fetches and indexes one cell. With prev the request is
+// conditional, and a 304 comes back as a result with notModified set
+func (e *Engine) fetchCellWith(ctx context.Context, q model.QueryRequest, cell string, res int, ttl time.Duration, prev *cellindex.Validator) result {
+	key := keys.Key(keys.ScopedLayer(q.Layer, q.Headers), res, cell, q.Filters)
 
 	if e.http == nil || e.owsURL == nil {
 		return result{
@@ -755,12 +1319,20 @@ func (e *Engine) fetchCell(ctx context.Context, q model.QueryRequest, cell strin
 	}
 
 	perQ := model.QueryRequest{
-		Layer:   q.Layer,
-		Polygon: &model.Polygon{GeoJSON: cellPolyJSON},
-		Filters: q.Filters,
+		Layer:            q.Layer,
+		Polygon:          &model.Polygon{GeoJSON: cellPolyJSON},
+		Filters:          q.Filters,
+		GeometryProperty: q.GeometryProperty,
+		CQLSRID:          q.CQLSRID,
 	}
 	params := ogc.BuildGetFeatureParams(perQ)
 
+	// wait for a global slot first so queueing doesn't eat into opTimeout
+	if err := e.upstream.acquire(ctx); err != nil {
+		return result{cell: cell, key: key, err: fmt.Errorf("cell %s: %w", cell, err)}
+	}
+	defer e.upstream.release()
+
 	ctxReq, cancel := context.WithTimeout(ctx, e.opTimeout)
 	defer cancel()
 	u := *e.owsURL
@@ -768,13 +1340,27 @@ func (e *Engine) fetchCell(ctx context.Context, q model.QueryRequest, cell strin
 
 	req, _ := http.NewRequestWithContext(ctxReq, http.MethodGet, u.String(), nil)
 	req.Header.Set("Accept", "application/json")
+	for k, v := range q.Headers {
+		req.Header.Set(k, v)
+	}
+	if prev != nil {
+		if prev.ETag != "" {
+			req.Header.Set("If-None-Match", prev.ETag)
+		}
+		if prev.LastModified != "" {
+			req.Header.Set("If-Modified-Since", prev.LastModified)
+		}
+	}
 
 	start := time.Now()
 	resp, err := e.http.Do(req)
 	dur := time.Since(start)
-	observability.ObserveUpstreamLatency("geoserver_cell", dur.Seconds())
+	observability.ObserveUpstreamLatency(ctx, "geoserver_cell", dur.Seconds())
 
 	if err != nil {
+		if kind := observability.ClassifyUpstreamError(ctx, err); kind != "" {
+			observability.IncUpstreamError(ctx, "geoserver_cell", kind)
+		}
 		return result{cell: cell, key: key, err: fmt.Errorf("cell %s fetch: %w", cell, err)}
 	}
 	defer func() {
@@ -782,155 +1368,183 @@ func (e *Engine) fetchCell(ctx context.Context, q model.QueryRequest, cell strin
 			e.logger.Warn("close response body", "err", cerr)
 		}
 	}()
+	if resp.StatusCode == http.StatusNotModified && prev != nil {
+		return result{cell: cell, key: key, notModified: true}
+	}
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		observability.IncUpstreamError(ctx, "geoserver_cell", observability.ClassifyUpstreamStatus(resp.StatusCode))
 		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
 		return result{cell: cell, key: key, err: fmt.Errorf("cell %s status=%d body=%q", cell, resp.StatusCode, strings.TrimSpace(string(b)))}
 	}
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return result{cell: cell, key: key, err: fmt.Errorf("cell %s read: %w", cell, err)}
+	// fills always ask for JSON; a misconfigured upstream answering in GML
+	// must not land in a cache that only ever serves GeoJSON
+	if ct := resp.Header.Get("Content-Type"); isXMLContentType(ct) {
+		observability.IncUpstreamError(ctx, "geoserver_cell", observability.UpstreamErrBadBody)
+		return result{cell: cell, key: key, err: fmt.Errorf("cell %s: upstream answered %q to a JSON request", cell, ct)}
 	}
-
-	if e.fs != nil && e.idx != nil {
-		var root map[string]json.RawMessage
-		if err := json.Unmarshal(body, &root); err != nil {
-			e.logger.Warn("cache v2: parse FeatureCollection root failed",
+	// features are decoded one at a time straight off the wire, so the raw
+	// body is never held alongside its parsed form
+	indexing := e.fs != nil && e.idx != nil
+	idProp := config.IDPropertyFor(e.idProps, q.Layer)
+	var (
+		feats    []json.RawMessage
+		featsMap map[string][]byte
+		ids      []string
+	)
+	if indexing {
+		featsMap = make(map[string][]byte)
+	}
+	matched, err := composer.DecodeFeatureStream(resp.Body, func(fr json.RawMessage) error {
+		if clean, fixed := composer.SanitizeUTF8(fr); fixed {
+			observability.IncInvalidUTF8Feature()
+			e.logger.Warn("cache v2: replaced invalid UTF-8 in upstream feature",
 				"layer", q.Layer,
 				"res", res,
 				"cell", cell,
-				"err", err,
 			)
-		} else {
-			featuresRaw, ok := root["features"]
-			if !ok {
-				e.logger.Warn("cache v2: FeatureCollection missing features array",
+			fr = clean
+		}
+		i := len(feats)
+		feats = append(feats, fr)
+		if !indexing {
+			return nil
+		}
+		normID, ok := e.featureID(q, res, cell, i, fr, idProp)
+		if !ok {
+			return nil
+		}
+		if _, exists := featsMap[normID]; !exists {
+			featsMap[normID] = fr
+		}
+		ids = append(ids, normID)
+		return nil
+	})
+	if err != nil {
+		// nothing from a body that isn't a FeatureCollection is cached or served
+		observability.IncUpstreamError(ctx, "geoserver_cell", observability.UpstreamErrBadBody)
+		return result{cell: cell, key: key, err: fmt.Errorf("cell %s: upstream body is not a FeatureCollection (content-type %q): %w",
+			cell, resp.Header.Get("Content-Type"), err)}
+	}
+
+	if indexing {
+		t := max(ttl, 0)
+
+		val := cellindex.Validator{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified"), Matched: matched}
+		if len(feats) == 0 {
+			if err := e.setIDs(ctx, q, res, cell, []string{cellindex.EmptyMarkerID}, t); err != nil {
+				e.logger.Warn("cache v2: cell index set empty failed",
 					"layer", q.Layer,
 					"res", res,
 					"cell", cell,
+					"err", err,
 				)
 			} else {
-				var feats []json.RawMessage
-				if err := json.Unmarshal(featuresRaw, &feats); err != nil {
-					e.logger.Warn("cache v2: decode features array failed",
-						"layer", q.Layer,
-						"res", res,
-						"cell", cell,
-						"err", err,
-					)
-				} else {
-					t := max(ttl, 0)
-
-					if len(feats) == 0 {
-						if err := e.idx.SetIDs(ctx, q.Layer, res, cell, model.Filters(q.Filters),
-							[]string{cellindex.EmptyMarkerID}, t); err != nil {
-							e.logger.Warn("cache v2: cell index set empty failed",
-								"layer", q.Layer,
-								"res", res,
-								"cell", cell,
-								"err", err,
-							)
-						} else {
-							e.logger.Debug("cache v2 marked empty cell",
-								"layer", q.Layer,
-								"res", res,
-								"cell", cell,
-							)
-						}
-					} else {
-						featsMap := make(map[string][]byte, len(feats))
-						ids := make([]string, 0, len(feats))
-
-						type minimalFeature struct {
-							ID       json.RawMessage `json:"id"`
-							Geometry json.RawMessage `json:"geometry"`
-						}
-
-						for i, fr := range feats {
-							var f minimalFeature
-							if err := json.Unmarshal(fr, &f); err != nil {
-								e.logger.Warn("cache v2: feature parse failed",
-									"layer", q.Layer,
-									"res", res,
-									"cell", cell,
-									"idx", i,
-									"err", err,
-								)
-								continue
-							}
-
-							var normID string
-
-							if len(bytes.TrimSpace(f.ID)) > 0 {
-								cid, err := geojsonagg.CanonicalIDKey(f.ID)
-								if err != nil {
-									e.logger.Warn("cache v2: invalid feature id, skipping id-based key",
-										"layer", q.Layer,
-										"res", res,
-										"cell", cell,
-										"idx", i,
-										"err", err,
-									)
-								} else {
-									normID = cid
-								}
-							}
-
-							if normID == "" {
-								gh, err := geojsonagg.GeometryHash(f.Geometry, geojsonagg.DefaultGeomPrecision)
-								if err != nil {
-									e.logger.Warn("cache v2: geometry hash failed, skipping feature",
-										"layer", q.Layer,
-										"res", res,
-										"cell", cell,
-										"idx", i,
-										"err", err,
-									)
-									continue
-								}
-								normID = gh
-							}
-
-							if _, exists := featsMap[normID]; !exists {
-								featsMap[normID] = fr
-							}
-							ids = append(ids, normID)
-						}
-
-						if len(featsMap) > 0 && len(ids) > 0 {
-							if err := e.fs.PutFeatures(ctx, q.Layer, featsMap, t); err != nil {
-								e.logger.Warn("cache v2: feature store put failed",
-									"layer", q.Layer,
-									"res", res,
-									"cell", cell,
-									"err", err,
-								)
-							} else if err := e.idx.SetIDs(ctx, q.Layer, res, cell, model.Filters(q.Filters), ids, t); err != nil {
-								e.logger.Warn("cache v2: cell index set failed",
-									"layer", q.Layer,
-									"res", res,
-									"cell", cell,
-									"err", err,
-								)
-							} else {
-								e.logger.Debug("cache v2 filled cell",
-									"layer", q.Layer,
-									"res", res,
-									"cell", cell,
-									"feature_count", len(featsMap),
-									"index_ids", len(ids),
-								)
-							}
-						}
-					}
-				}
+				e.logger.Debug("cache v2 marked empty cell",
+					"layer", q.Layer,
+					"res", res,
+					"cell", cell,
+				)
+				val.IDs = []string{cellindex.EmptyMarkerID}
+				e.setCellValidator(ctx, q, res, cell, val, t)
+			}
+		} else if len(featsMap) > 0 && len(ids) > 0 {
+			if err := e.putFeatures(ctx, keys.ScopedLayer(q.Layer, q.Headers), featsMap, e.featureTTLFor(t)); err != nil {
+				e.logger.Warn("cache v2: feature store put failed",
+					"layer", q.Layer,
+					"res", res,
+					"cell", cell,
+					"err", err,
+				)
+			} else if err := e.setIDs(ctx, q, res, cell, ids, t); err != nil {
+				e.logger.Warn("cache v2: cell index set failed",
+					"layer", q.Layer,
+					"res", res,
+					"cell", cell,
+					"err", err,
+				)
+			} else {
+				e.logger.Debug("cache v2 filled cell",
+					"layer", q.Layer,
+					"res", res,
+					"cell", cell,
+					"feature_count", len(featsMap),
+					"index_ids", len(ids),
+				)
+				val.IDs = ids
+				e.setCellValidator(ctx, q, res, cell, val, t)
+			}
+		}
+	}
+
+	return result{cell: cell, key: key, features: feats, matched: matched}
+}
+
+// featureID derives the cache id of one upstream feature: its canonical id,
+// then the layer's id property, then a geometry hash; false skips the feature
+func (e *Engine) featureID(q model.QueryRequest, res int, cell string, i int, fr json.RawMessage, idProp string) (string, bool) {
+	type minimalFeature struct {
+		ID         json.RawMessage `json:"id"`
+		Geometry   json.RawMessage `json:"geometry"`
+		Properties json.RawMessage `json:"properties"`
+	}
+	var f minimalFeature
+	if err := json.Unmarshal(fr, &f); err != nil {
+		e.logger.Warn("cache v2: feature parse failed",
+			"layer", q.Layer,
+			"res", res,
+			"cell", cell,
+			"idx", i,
+			"err", err,
+		)
+		return "", false
+	}
+
+	if len(bytes.TrimSpace(f.ID)) > 0 {
+		cid, err := geojsonagg.CanonicalIDKey(f.ID)
+		if err == nil {
+			return cid, true
+		}
+		e.logger.Warn("cache v2: invalid feature id, skipping id-based key",
+			"layer", q.Layer,
+			"res", res,
+			"cell", cell,
+			"idx", i,
+			"err", err,
+		)
+	}
+
+	if idProp != "" {
+		if raw := geojsonagg.PropertyID(f.Properties, idProp); raw != nil {
+			if cid, _ := geojsonagg.CanonicalIDKey(raw); cid != "" {
+				return cid, true
 			}
 		}
 	}
 
-	return result{cell: cell, key: key, body: body, err: nil}
+	gh, err := e.geometryHash(f.Geometry)
+	if err != nil {
+		e.logger.Warn("cache v2: geometry hash failed, skipping feature",
+			"layer", q.Layer,
+			"res", res,
+			"cell", cell,
+			"idx", i,
+			"err", err,
+		)
+		return "", false
+	}
+	return gh, true
 }
 
 func cellPolygonGeoJSON(cellStr string) (string, error) {
+	ring, err := cellRingJSON(cellStr)
+	if err != nil {
+		return "", err
+	}
+	return `{"type":"Polygon","coordinates":[` + ring + `]}`, nil
+}
+
+// cellRingJSON renders the cell boundary as a closed GeoJSON linear ring
+func cellRingJSON(cellStr string) (string, error) {
 	var c h3.Cell
 	if err := c.UnmarshalText([]byte(cellStr)); err != nil {
 		return "", fmt.Errorf("parse cell: %w", err)
@@ -950,11 +1564,20 @@ func cellPolygonGeoJSON(cellStr string) (string, error) {
 		coords = append(coords, fmt.Sprintf("[%.8f,%.8f]", ll.Lng, ll.Lat))
 	}
 	coords = append(coords, coords[0])
-	return `{"type":"Polygon","coordinates":[[` + strings.Join(coords, ",") + `]]}`, nil
+	return "[" + strings.Join(coords, ",") + "]", nil
 }
 
 type hotReadOnly struct{ w *metricswrap.WithMetrics }
 
+// CacheStore is the store the engine caches in, so invalidation can work on
+// the same backend and connections
+func (e *Engine) CacheStore() *cachev2.Store {
+	if e == nil {
+		return nil
+	}
+	return e.store
+}
+
 func (e *Engine) Hotness() interface{ Reset(...string) } {
 	if e == nil || e.hot == nil {
 		return nil
@@ -969,6 +1592,103 @@ func (h hotReadOnly) Score(cell string) float64 {
 	return h.w.Score(cell)
 }
 
+// cache read timeout, falling back to the global op timeout
+func (e *Engine) readTimeout() time.Duration {
+	if e.mgetTimeout > 0 {
+		return e.mgetTimeout
+	}
+	return e.opTimeout
+}
+
+// cache write timeout, falling back to the global op timeout
+func (e *Engine) writeTimeout() time.Duration {
+	if e.setTimeout > 0 {
+		return e.setTimeout
+	}
+	return e.opTimeout
+}
+
+// putFeaturesAttempts bounds retries of a failed feature put; puts overwrite by
+// id, so repeating one that partially landed is safe
+const putFeaturesAttempts = 2
+
+// putFeatures succeeds only once every feature is stored; callers write the
+// cell index after it so the index never points at features that never landed
+func (e *Engine) putFeatures(ctx context.Context, layer string, feats map[string][]byte, ttl time.Duration) error {
+	var err error
+	for attempt := 1; attempt <= putFeaturesAttempts; attempt++ {
+		putCtx, cancel := withTimeout(ctx, e.writeTimeout())
+		err = e.fs.PutFeatures(putCtx, layer, feats, ttl)
+		cancel()
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+		e.logger.Debug("cache v2: feature put failed, retrying",
+			"layer", layer,
+			"features", len(feats),
+			"attempt", attempt,
+			"err", err,
+		)
+	}
+	if err != nil {
+		return fmt.Errorf("put features: %w", err)
+	}
+	return nil
+}
+
+// featureTTLFor stretches a cell TTL to FEATURE_TTL for feature bodies, so
+// they outlive the index entries that reference them; 0 (no expiry) stays
+func (e *Engine) featureTTLFor(cellTTL time.Duration) time.Duration {
+	if cellTTL <= 0 {
+		return cellTTL
+	}
+	return max(cellTTL, e.featureTTL)
+}
+
+func (e *Engine) setIDs(ctx context.Context, q model.QueryRequest, res int, cell string, ids []string, ttl time.Duration) error {
+	ctx, cancel := withTimeout(ctx, e.writeTimeout())
+	defer cancel()
+	layer := keys.ScopedLayer(q.Layer, q.Headers)
+	if err := e.idx.SetIDs(ctx, layer, res, cell, model.Filters(q.Filters), ids, ttl); err != nil {
+		return fmt.Errorf("set ids: %w", err)
+	}
+	e.filledAt.Store(keys.CellIndexKey(layer, res, cell, model.Filters(q.Filters)), time.Now())
+	return nil
+}
+
+// anyStale reports whether any served cell predates the layer's last
+// invalidation by more than the grace window. Cells this process did not
+// fill have no known fill time and count as stale.
+func (e *Engine) anyStale(q model.QueryRequest, res int, cells []string, invalidatedAt time.Time) bool {
+	layer := keys.ScopedLayer(q.Layer, q.Headers)
+	for _, cell := range cells {
+		v, ok := e.filledAt.Load(keys.CellIndexKey(layer, res, cell, model.Filters(q.Filters)))
+		if !ok {
+			return true
+		}
+		if v.(time.Time).Add(e.staleGrace).Before(invalidatedAt) {
+			return true
+		}
+	}
+	return false
+}
+
+// geometryHash hashes like the aggregator does, so stored gh: IDs dedup in merges
+func (e *Engine) geometryHash(g json.RawMessage) (string, error) {
+	if e.canonicalRings {
+		return geojsonagg.CanonicalGeometryHash(g, e.hashPrecision())
+	}
+	return geojsonagg.GeometryHash(g, e.hashPrecision())
+}
+
+// precision used for geometry-hash IDs; must match the aggregator's dedup precision
+func (e *Engine) hashPrecision() int {
+	if e.geomPrecision > 0 {
+		return e.geomPrecision
+	}
+	return geojsonagg.DefaultGeomPrecision
+}
+
 func decisionLabel(t adaptive.DecisionType) string {
 	switch t {
 	case adaptive.DecisionBypass:
@@ -979,3 +1699,37 @@ func decisionLabel(t adaptive.DecisionType) string {
 		return "fill"
 	}
 }
+
+// logDryRunCells records what the decider would do for each sampled cell on
+// its own, so dry runs show per-cell granularity the aggregate decision hides
+func (e *Engine) logDryRunCells(q model.QueryRequest, cells []string, baseRes int) {
+	if e.dryRunCellN <= 0 || e.decider == nil {
+		return
+	}
+	n := uint64(e.dryRunCellN)
+	hot := hotReadOnly{w: e.hot}
+	for _, c := range cells {
+		// the first of every n cells is kept, as with request log sampling
+		if n > 1 && e.dryRunCellSeen.Add(1)%n != 1 {
+			continue
+		}
+		d, reason := e.decider.Decide(adaptive.Query{
+			Layer:   q.Layer,
+			Cells:   []string{c},
+			BaseRes: baseRes,
+			MinRes:  e.minRes,
+			MaxRes:  e.maxRes,
+		}, hot)
+		e.logger.Info("adaptive_dry_run_cell",
+			"run_id", e.runID,
+			"layer", q.Layer,
+			"cell", c,
+			"score", hot.Score(c),
+			"decision", decisionLabel(d.Type),
+			"reason", string(reason),
+			"base_res", baseRes,
+			"resolution", d.Resolution,
+			"ttl", d.TTL.String(),
+		)
+	}
+}
@@ -3,23 +3,33 @@ package cache_test
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/keys"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/redisstore"
 	cachev2 "github.com/mohammed-shakir/h3-spatial-cache/internal/cache/v2"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/executor"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/httpclient"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/ogc"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/problem"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/router"
 	h3mapper "github.com/mohammed-shakir/h3-spatial-cache/internal/mapper/h3"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/scenarios"
 	_ "github.com/mohammed-shakir/h3-spatial-cache/internal/scenarios/baseline"
@@ -153,6 +163,9 @@ func TestCache_FullHit_NoUpstreamCalls(t *testing.T) {
 	if gs.calls != 0 {
 		t.Fatalf("expected zero upstream calls on full hit; got %d", gs.calls)
 	}
+	if got := rr.Header().Get("X-Cache"); got != "HIT" {
+		t.Fatalf("X-Cache=%q want HIT", got)
+	}
 	var out struct {
 		Type     string            `json:"type"`
 		Features []json.RawMessage `json:"features"`
@@ -279,6 +292,9 @@ func TestCache_PartialMiss_FetchesOnlyMissing_BoundedConcurrency(t *testing.T) {
 	if len(rr.Body.Bytes()) == 0 {
 		t.Fatalf("expected non-empty body on partial miss")
 	}
+	if got := rr.Header().Get("X-Cache"); got != "PARTIAL" {
+		t.Fatalf("X-Cache=%q want PARTIAL", got)
+	}
 	var out struct {
 		Type     string            `json:"type"`
 		Features []json.RawMessage `json:"features"`
@@ -379,8 +395,66 @@ func TestCache_BackendErrorOnMiss_ReturnsErrorBody(t *testing.T) {
 	if rr.Code != http.StatusBadGateway {
 		t.Fatalf("status=%d want 502 Bad Gateway", rr.Code)
 	}
-	if len(rr.Body.Bytes()) == 0 {
-		t.Fatalf("expected non-empty error body on upstream failure")
+	if ct := rr.Header().Get("Content-Type"); ct != problem.ContentType {
+		t.Fatalf("content-type=%q want %q", ct, problem.ContentType)
+	}
+	var p problem.Details
+	if err := json.Unmarshal(rr.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode problem: %v (%q)", err, rr.Body.String())
+	}
+	if p.Type != "about:blank" || p.Title != "Bad Gateway" || p.Status != http.StatusBadGateway {
+		t.Fatalf("problem=%+v", p)
+	}
+	if !strings.Contains(p.Detail, "upstream errors") {
+		t.Fatalf("detail=%q want the upstream failure", p.Detail)
+	}
+}
+
+func TestCache_HTMLOn200_IsUpstreamErrorNotCached(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	observability.Init(reg, true)
+	t.Cleanup(func() { observability.Init(nil, false) })
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = io.WriteString(w, "<html><body>Service exception: layer misconfigured</body></html>")
+	}))
+	defer srv.Close()
+
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+
+	cfg := config.FromEnv()
+	cfg.Scenario = "cache"
+	cfg.RedisAddr = mr.Addr()
+	cfg.GeoServerURL = strings.TrimRight(srv.URL, "/")
+	cfg.CacheTTLDefault = 30 * time.Second
+	cfg.AdaptiveEnabled = false
+
+	h, err := scenarios.New("cache", cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), nil)
+	if err != nil {
+		t.Fatalf("scenario: %v", err)
+	}
+
+	bb := model.BBox{X1: 18.00, Y1: 59.32, X2: 18.02, Y2: 59.34, SRID: "EPSG:4326"}
+	req := httptest.NewRequest(http.MethodGet, "/query", nil)
+	rr := httptest.NewRecorder()
+	h.HandleQuery(req.Context(), rr, req, model.QueryRequest{Layer: "demo:NR_polygon", BBox: &bb})
+
+	if rr.Code != http.StatusBadGateway {
+		t.Fatalf("status=%d want 502 body=%q", rr.Code, rr.Body.String())
+	}
+	if strings.Contains(rr.Body.String(), "<html>") {
+		t.Fatalf("upstream HTML leaked into the response: %q", rr.Body.String())
+	}
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Fatalf("nothing should be cached from an HTML body, got %v", keys)
+	}
+
+	mrr := httptest.NewRecorder()
+	promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(mrr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if want := `upstream_errors_total{kind="bad_body",upstream="geoserver_cell"}`; !strings.Contains(mrr.Body.String(), want) {
+		t.Fatalf("missing %s:\n%s", want, mrr.Body.String())
 	}
 }
 
@@ -505,3 +579,258 @@ func TestCache_MultiResolution_WarmCoarseReadFine_FeaturesReused(t *testing.T) {
 		t.Fatalf("unexpectedly many feature keys=%d vs upstream calls=%d", featKeys, callsAfterFine)
 	}
 }
+
+func TestCache_CQL2JSONBodyFilter_ReachesUpstreamAndKeysCache(t *testing.T) {
+	var mu sync.Mutex
+	var upstream []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		upstream = append(upstream, r.URL.Query().Get("cql_filter"))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[]}`)
+	}))
+	defer srv.Close()
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+
+	cfg := config.FromEnv()
+	cfg.Scenario = "cache"
+	cfg.RedisAddr = mr.Addr()
+	cfg.GeoServerURL = strings.TrimRight(srv.URL, "/")
+	cfg.H3Res, cfg.H3ResMin, cfg.H3ResMax = 8, 8, 8
+	cfg.AdaptiveEnabled = false
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h, err := scenarios.New("cache", cfg, logger, nil)
+	if err != nil {
+		t.Fatalf("scenario: %v", err)
+	}
+	handle := router.HandleQuery(logger, cfg, h)
+
+	const body = `{"filter-lang":"cql2-json","filter":{"op":"and","args":[` +
+		`{"op":">","args":[{"property":"pop"},1000]},` +
+		`{"op":"=","args":[{"property":"name"},"O'Hare"]}]}}`
+	const want = `(pop > 1000) AND (name = 'O''Hare')`
+	post := func() {
+		req := httptest.NewRequest(http.MethodPost, "/query?layer=demo:NR_polygon&bbox=18.00,59.32,18.02,59.34,EPSG:4326", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		handle(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+		}
+	}
+
+	post()
+	mu.Lock()
+	calls := len(upstream)
+	for _, f := range upstream {
+		if !strings.HasPrefix(f, "("+want+") AND (INTERSECTS(") {
+			t.Fatalf("upstream cql_filter=%q, want the translated filter %q", f, want)
+		}
+	}
+	mu.Unlock()
+	if calls == 0 {
+		t.Fatalf("no upstream calls")
+	}
+	for _, k := range mr.Keys() {
+		if strings.HasPrefix(k, "idx:") && !strings.Contains(k, "pop") {
+			t.Fatalf("index key %q does not carry the filter", k)
+		}
+	}
+
+	// the same filter is served from the entries it filled
+	post()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(upstream) != calls {
+		t.Fatalf("repeat query went upstream: calls %d -> %d", calls, len(upstream))
+	}
+}
+
+func TestCache_LayerAlias_ResolvesForKeysAndUpstream(t *testing.T) {
+	var mu sync.Mutex
+	var typeNames []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		typeNames = append(typeNames, r.URL.Query().Get("typeNames"))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[]}`)
+	}))
+	defer srv.Close()
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+
+	cfg := config.FromEnv()
+	cfg.Scenario = "cache"
+	cfg.RedisAddr = mr.Addr()
+	cfg.GeoServerURL = strings.TrimRight(srv.URL, "/")
+	cfg.H3Res, cfg.H3ResMin, cfg.H3ResMax = 8, 8, 8
+	cfg.AdaptiveEnabled = false
+	cfg.LayerAliases = map[string]string{"roads": "demo:NR_roads"}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h, err := scenarios.New("cache", cfg, logger, nil)
+	if err != nil {
+		t.Fatalf("scenario: %v", err)
+	}
+	handle := router.HandleQuery(logger, cfg, h)
+
+	get := func(layer string) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		handle(rr, httptest.NewRequest(http.MethodGet, "/query?layer="+layer+"&bbox=18.00,59.32,18.02,59.34,EPSG:4326", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("layer %s: status=%d body=%s", layer, rr.Code, rr.Body.String())
+		}
+	}
+
+	get("roads")
+	mu.Lock()
+	calls := len(typeNames)
+	for _, tn := range typeNames {
+		if tn != "demo:NR_roads" {
+			t.Fatalf("upstream typeNames=%q want demo:NR_roads", tn)
+		}
+	}
+	mu.Unlock()
+	if calls == 0 {
+		t.Fatalf("no upstream calls")
+	}
+	idx := 0
+	for _, k := range mr.Keys() {
+		if !strings.HasPrefix(k, "idx:") {
+			continue
+		}
+		idx++
+		if !strings.Contains(k, "demo:NR_roads") {
+			t.Fatalf("index key %q not keyed by the aliased typeName", k)
+		}
+	}
+	if idx == 0 {
+		t.Fatalf("no index keys written")
+	}
+
+	// the qualified name shares the alias's entries, unknown names pass through
+	get("demo:NR_roads")
+	get("demo:places")
+	mu.Lock()
+	defer mu.Unlock()
+	if len(typeNames) == calls {
+		t.Fatalf("unaliased layer was not fetched")
+	}
+	for _, tn := range typeNames[calls:] {
+		if tn != "demo:places" {
+			t.Fatalf("typeNames=%q after the alias was cached, want only demo:places", tn)
+		}
+	}
+}
+
+func TestCache_StrictConsistency_RefetchesWhenUpstreamCountDiverges(t *testing.T) {
+	var mu sync.Mutex
+	var fetches, counts int
+	total := 2
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("resultType") == "hits" {
+			counts++
+			_, _ = fmt.Fprintf(w, `{"type":"FeatureCollection","totalFeatures":%d,"features":[]}`, total)
+			return
+		}
+		fetches++
+		feats := make([]string, 0, total)
+		for i := range total {
+			feats = append(feats, fmt.Sprintf(`{"type":"Feature","id":"f%d","geometry":{"type":"Point","coordinates":[18.0%d,59.33]},"properties":{}}`, i, i))
+		}
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[`+strings.Join(feats, ",")+`]}`)
+	}))
+	defer srv.Close()
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+
+	cfg := config.FromEnv()
+	cfg.Scenario = "cache"
+	cfg.RedisAddr = mr.Addr()
+	cfg.GeoServerURL = strings.TrimRight(srv.URL, "/")
+	cfg.H3Res, cfg.H3ResMin, cfg.H3ResMax = 8, 8, 8
+	cfg.AdaptiveEnabled = false
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h, err := scenarios.New("cache", cfg, logger, nil)
+	if err != nil {
+		t.Fatalf("scenario: %v", err)
+	}
+	handle := router.HandleQuery(logger, cfg, h)
+
+	get := func(params string) *httptest.ResponseRecorder {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		handle(rr, httptest.NewRequest(http.MethodGet, "/query?layer=demo:places&bbox=18.00,59.32,18.02,59.34,EPSG:4326"+params, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+		}
+		return rr
+	}
+	snapshot := func() (int, int) {
+		mu.Lock()
+		defer mu.Unlock()
+		return fetches, counts
+	}
+
+	get("")
+	filled, _ := snapshot()
+	if filled == 0 {
+		t.Fatalf("no cell fetches on the cold query")
+	}
+
+	// counts agree: served from cache after a single count request
+	if rr := get("&consistency=strict"); rr.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("X-Cache=%q want HIT", rr.Header().Get("X-Cache"))
+	}
+	if f, c := snapshot(); f != filled || c != 1 {
+		t.Fatalf("matching count: fetches %d->%d, counts=%d; want no refetch and one count", filled, f, c)
+	}
+
+	// upstream gained a feature the cache has not seen
+	mu.Lock()
+	total = 3
+	mu.Unlock()
+	if rr := get(""); rr.Header().Get("X-Cache") != "HIT" || strings.Contains(rr.Body.String(), `"f2"`) {
+		t.Fatalf("default consistency should serve the cached entries, X-Cache=%q", rr.Header().Get("X-Cache"))
+	}
+	rr := get("&consistency=strict")
+	if f, _ := snapshot(); f != 2*filled {
+		t.Fatalf("diverged count: fetches=%d want a refetch of all %d cells", f, filled)
+	}
+	if !strings.Contains(rr.Body.String(), `"f2"`) {
+		t.Fatalf("refetched response misses the new feature: %s", rr.Body.String())
+	}
+	if rr := get(""); !strings.Contains(rr.Body.String(), `"f2"`) || rr.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("cache not refreshed by the strict refetch: X-Cache=%q", rr.Header().Get("X-Cache"))
+	}
+
+	// a read-only replica serves a diverged strict query from the upstream
+	// but leaves the shared index alone
+	roCfg := cfg
+	roCfg.CacheReadOnly = true
+	exec, err := executor.New(logger, httpclient.NewOutbound(), ogc.OWSEndpoint(roCfg.GeoServerURL))
+	if err != nil {
+		t.Fatalf("executor: %v", err)
+	}
+	ro, err := scenarios.New("cache", roCfg, logger, exec)
+	if err != nil {
+		t.Fatalf("read-only scenario: %v", err)
+	}
+	handle = router.HandleQuery(logger, roCfg, ro)
+	mu.Lock()
+	total = 4
+	mu.Unlock()
+	before := mr.Keys()
+	rr = get("&consistency=strict")
+	if rr.Header().Get("X-Cache") != "MISS-READONLY" || !strings.Contains(rr.Body.String(), `"f3"`) {
+		t.Fatalf("read-only strict: X-Cache=%q body=%s", rr.Header().Get("X-Cache"), rr.Body.String())
+	}
+	if after := mr.Keys(); strings.Join(after, ",") != strings.Join(before, ",") {
+		t.Fatalf("read-only strict query changed the keyspace:\nbefore %v\nafter  %v", before, after)
+	}
+}
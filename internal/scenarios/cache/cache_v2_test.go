@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"errors"
 	"io"
 	"log/slog"
 	"net/http"
@@ -14,6 +15,8 @@ import (
 	"time"
 
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/aggregate/geojsonagg"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/memstore"
+	cachev2 "github.com/mohammed-shakir/h3-spatial-cache/internal/cache/v2"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
 )
 
@@ -189,8 +192,8 @@ func TestFetchCell_PopulatesFeatureStoreAndIndex_WithIDs(t *testing.T) {
 	if r.err != nil {
 		t.Fatalf("fetchCell err: %v", r.err)
 	}
-	if len(r.body) == 0 {
-		t.Fatalf("expected non-empty body from fetchCell")
+	if len(r.features) != 2 {
+		t.Fatalf("fetchCell features=%d want 2", len(r.features))
 	}
 
 	if len(fs.calls) != 1 {
@@ -343,3 +346,151 @@ func TestFetchCell_MultiResolution_SafeReuseOfFeatures(t *testing.T) {
 			idx.calls[0].ids, idx.calls[1].ids)
 	}
 }
+
+// partialFeatureStore lands only the first half of a put and fails for its
+// first fail calls, like a pipeline dropping mid-batch
+type partialFeatureStore struct {
+	recordingFeatureStore
+	fail  int
+	puts  int
+	saved map[string][]byte
+}
+
+func (p *partialFeatureStore) PutFeatures(ctx context.Context, layer string, feats map[string][]byte, ttl time.Duration) error {
+	p.mu.Lock()
+	p.puts++
+	failing := p.puts <= p.fail
+	if p.saved == nil {
+		p.saved = map[string][]byte{}
+	}
+	ids := keysOf(feats)
+	if failing {
+		ids = ids[:len(ids)/2]
+	}
+	for _, id := range ids {
+		p.saved[id] = feats[id]
+	}
+	p.mu.Unlock()
+	if failing {
+		return errors.New("connection reset mid-pipeline")
+	}
+	return nil
+}
+
+func TestFetchCell_PartialFeaturePut_SkipsIndex(t *testing.T) {
+	body := `{"type":"FeatureCollection","features":[` +
+		`{"type":"Feature","id":"a","geometry":null,"properties":{}},` +
+		`{"type":"Feature","id":"b","geometry":null,"properties":{}},` +
+		`{"type":"Feature","id":"c","geometry":null,"properties":{}},` +
+		`{"type":"Feature","id":"d","geometry":null,"properties":{}}` +
+		`]}`
+	q := model.QueryRequest{Layer: "demo:layer"}
+	const cell = "892a100d2b3ffff"
+
+	// every attempt lands partially: the index must not point at missing features
+	idx := &recordingCellIndex{}
+	e := newTestEngineForV2(t, body, &recordingFeatureStore{}, idx)
+	fs := &partialFeatureStore{fail: putFeaturesAttempts}
+	e.fs = fs
+	if r := e.fetchCell(context.Background(), q, cell, 7, time.Minute); r.err != nil || len(r.features) != 4 {
+		t.Fatalf("fetchCell should still serve the features: err=%v features=%d", r.err, len(r.features))
+	}
+	if fs.puts != putFeaturesAttempts {
+		t.Fatalf("puts=%d want %d attempts", fs.puts, putFeaturesAttempts)
+	}
+	if len(idx.calls) != 0 {
+		t.Fatalf("cell index written after a partial feature put: %+v", idx.calls)
+	}
+
+	// a retry that completes the put lets the index through
+	idx = &recordingCellIndex{}
+	e = newTestEngineForV2(t, body, &recordingFeatureStore{}, idx)
+	fs = &partialFeatureStore{fail: 1}
+	e.fs = fs
+	if r := e.fetchCell(context.Background(), q, cell, 7, time.Minute); r.err != nil {
+		t.Fatalf("fetchCell err: %v", r.err)
+	}
+	if len(fs.saved) != 4 {
+		t.Fatalf("retry left %d of 4 features stored", len(fs.saved))
+	}
+	if len(idx.calls) != 1 || len(idx.calls[0].ids) != 4 {
+		t.Fatalf("index after a successful retry: %+v", idx.calls)
+	}
+}
+
+type countingEmptyMarkers struct{ calls chan struct{} }
+
+func (c countingEmptyMarkers) CountEmptyMarkers(context.Context, int) (int64, error) {
+	select {
+	case c.calls <- struct{}{}:
+	default:
+	}
+	return 0, nil
+}
+
+func TestEngineClose_StopsEmptyMarkerSampler(t *testing.T) {
+	e := &Engine{logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	e.life, e.stop = context.WithCancel(context.Background())
+
+	c := countingEmptyMarkers{calls: make(chan struct{}, 1)}
+	done := make(chan struct{})
+	go func() {
+		e.sampleEmptyMarkers(e.life, c, time.Millisecond)
+		close(done)
+	}()
+
+	select {
+	case <-c.calls:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("sampler never ran")
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("sampler still running after Close")
+	}
+}
+
+func TestEngineClose_StopsOrphanSweep(t *testing.T) {
+	ctx := context.Background()
+	st := memstore.New(0)
+	t.Cleanup(func() { _ = st.Close() })
+	s := cachev2.NewMemoryStore(st, time.Minute)
+	if err := s.Features.PutFeatures(ctx, "demo:roads", map[string][]byte{"s:a": []byte(`{}`)}, time.Minute); err != nil {
+		t.Fatalf("PutFeatures: %v", err)
+	}
+
+	e := &Engine{logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	e.life, e.stop = context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.sweepOrphans(e.life, s.NewOrphanJanitor(0, 0), time.Millisecond)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got, err := s.Features.MGetFeatures(ctx, "demo:roads", []string{"s:a"})
+		if err != nil {
+			t.Fatalf("MGetFeatures: %v", err)
+		}
+		if len(got) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("orphan sweep never ran")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("orphan sweep still running after Close")
+	}
+}
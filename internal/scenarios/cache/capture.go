@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/composer"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/pkg/adaptive"
+)
+
+// HeaderCaptureFile names the fixture a ?capture=true query was written to,
+// relative to CAPTURE_DIR so the server's filesystem layout stays private
+const HeaderCaptureFile = "X-Capture-File"
+
+// fixtureDecision records the adaptive decision behind a response; decided
+// is false when no decider ran
+func fixtureDecision(dec adaptive.Decision, reason adaptive.Reason, decided, applied bool, missing []string) composer.FixtureDecision {
+	fd := composer.FixtureDecision{Applied: applied, MissingCells: missing}
+	if decided {
+		fd.Adaptive = decisionLabel(dec.Type)
+		fd.Reason = string(reason)
+		fd.Resolution = dec.Resolution
+		fd.TTL = dec.TTL.String()
+	}
+	return fd
+}
+
+// captureFixture writes a composed response out as a composer fixture when
+// capture is enabled and q asked for it. It runs before the status is written
+// so the file can be named in a header; a failed write only logs
+func (e *Engine) captureFixture(w http.ResponseWriter, r *http.Request, q model.QueryRequest, res int, cells model.Cells, d composer.FixtureDecision, req composer.Request, out composer.Result) {
+	if !e.capture || !q.Capture {
+		return
+	}
+	d.HitClass = out.HitClass
+	path, err := composer.WriteFixture(e.captureDir, composer.Fixture{
+		Captured:   time.Now(),
+		Params:     r.URL.Query(),
+		Layer:      q.Layer,
+		Resolution: res,
+		Cells:      cells,
+		Decision:   d,
+		Request:    req,
+		Response:   composer.NewFixtureResponse(out),
+	})
+	if err != nil {
+		e.logger.Warn("query capture failed",
+			"layer", q.Layer,
+			"dir", e.captureDir,
+			"err", err,
+		)
+		return
+	}
+	w.Header().Set(HeaderCaptureFile, filepath.Base(path))
+	e.logger.Info("query captured",
+		"layer", q.Layer,
+		"res", res,
+		"cells", len(cells),
+		"hit_class", string(out.HitClass),
+		"path", path,
+	)
+}
@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/aggregate/geojsonagg"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/composer"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/executor"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/ogc"
+)
+
+func TestCapture_WritesReplayableFixture(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[`+
+			`{"type":"Feature","id":"a","geometry":{"type":"Point","coordinates":[18.01,59.33]},"properties":{"v":1}}]}`)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	dir := t.TempDir()
+	e := newEngineForTest()
+	e.serveFreshOnly = false
+	e.owsURL = u
+	e.http = srv.Client()
+	e.capture = true
+	e.captureDir = dir
+
+	q := model.QueryRequest{
+		Layer:   "ns:cap",
+		BBox:    &model.BBox{X1: 18.00, Y1: 59.32, X2: 18.02, Y2: 59.34, SRID: "EPSG:4326"},
+		Capture: true,
+	}
+	serve := func(q model.QueryRequest) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		e.HandleQuery(context.Background(), rr, httptest.NewRequest("GET", "/query?layer=ns:cap&capture=true", nil), q)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+		}
+		return rr
+	}
+
+	rr := serve(q)
+	name := rr.Header().Get(HeaderCaptureFile)
+	if name == "" || filepath.Base(name) != name {
+		t.Fatalf("%s=%q, want a bare file name", HeaderCaptureFile, name)
+	}
+	f, err := composer.ReadFixture(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Layer != q.Layer || f.Resolution != 8 || len(f.Cells) == 0 || f.Params.Get("capture") != "true" {
+		t.Fatalf("fixture request: layer=%q res=%d cells=%d params=%v", f.Layer, f.Resolution, len(f.Cells), f.Params)
+	}
+	if f.Decision.HitClass != composer.HitClassMiss || len(f.Decision.MissingCells) != len(f.Cells) || f.Decision.Adaptive != "" {
+		t.Fatalf("fixture decision: %+v", f.Decision)
+	}
+	if !bytes.Equal(f.Response.Body, rr.Body.Bytes()) {
+		t.Fatalf("recorded body differs from the served one:\n%s\n%s", f.Response.Body, rr.Body.Bytes())
+	}
+
+	// a fresh composer, as a golden test would build, reproduces the response
+	out, err := f.Replay(context.Background(), composer.Engine{V2: composer.NewGeoJSONV2Adapter(geojsonagg.NewAdvanced())})
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if out.StatusCode != f.Response.StatusCode || out.ContentType != f.Response.ContentType || !bytes.Equal(out.Body, f.Response.Body) {
+		t.Fatalf("replay=%d %q %s, want %d %q %s", out.StatusCode, out.ContentType, out.Body,
+			f.Response.StatusCode, f.Response.ContentType, f.Response.Body)
+	}
+
+	// the warm repeat is captured as a full hit
+	f2, err := composer.ReadFixture(filepath.Join(dir, serve(q).Header().Get(HeaderCaptureFile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f2.Decision.HitClass != composer.HitClassFull || len(f2.Decision.MissingCells) != 0 {
+		t.Fatalf("warm fixture decision: %+v", f2.Decision)
+	}
+
+	// a read-only miss, served by one whole-query fetch, is captured too
+	exec, err := executor.New(slog.New(slog.NewTextHandler(io.Discard, nil)), srv.Client(), ogc.OWSEndpoint(srv.URL))
+	if err != nil {
+		t.Fatalf("executor: %v", err)
+	}
+	e.exec = exec
+	e.readOnly = true
+	ro := q
+	ro.Layer = "ns:cap-ro"
+	rr = serve(ro)
+	f3, err := composer.ReadFixture(filepath.Join(dir, rr.Header().Get(HeaderCaptureFile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f3.Layer != ro.Layer || len(f3.Decision.MissingCells) != len(f3.Cells) || !bytes.Equal(f3.Response.Body, rr.Body.Bytes()) {
+		t.Fatalf("read-only fixture: layer=%q decision=%+v", f3.Layer, f3.Decision)
+	}
+	e.readOnly = false
+
+	// neither an uncaptured query nor a disabled flag writes anything
+	q.Capture = false
+	if got := serve(q).Header().Get(HeaderCaptureFile); got != "" {
+		t.Fatalf("uncaptured query wrote %q", got)
+	}
+	q.Capture = true
+	e.capture = false
+	if got := serve(q).Header().Get(HeaderCaptureFile); got != "" {
+		t.Fatalf("capture disabled but wrote %q", got)
+	}
+	if ents, _ := os.ReadDir(dir); len(ents) != 3 {
+		t.Fatalf("fixtures in dir=%d want 3", len(ents))
+	}
+}
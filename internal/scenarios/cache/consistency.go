@@ -0,0 +1,137 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/keys"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/ogc"
+)
+
+// revalidateHit backs consistency=strict: it compares the number of distinct
+// features cached for cells with an upstream count over the same cells. On a
+// mismatch, or when the count can't be had, the cells' index entries are
+// dropped (kept in read-only mode) and false is returned so the caller
+// refetches them
+func (e *Engine) revalidateHit(ctx context.Context, q model.QueryRequest, res int, cells []string, cached int) bool {
+	n, err := e.upstreamCount(ctx, q, cells)
+	switch {
+	case err != nil:
+		observability.IncConsistencyCheck("error")
+		e.logger.Warn("strict consistency: upstream count failed, refetching",
+			"layer", q.Layer,
+			"res", res,
+			"cells", len(cells),
+			"err", err,
+		)
+	case n == cached:
+		observability.IncConsistencyCheck("match")
+		return true
+	default:
+		observability.IncConsistencyCheck("mismatch")
+		e.logger.Info("strict consistency: cached count differs from upstream, refetching",
+			"layer", q.Layer,
+			"res", res,
+			"cells", len(cells),
+			"cached", cached,
+			"upstream", n,
+		)
+	}
+
+	if e.readOnly {
+		return false
+	}
+	delCtx, cancel := withTimeout(ctx, e.writeTimeout())
+	defer cancel()
+	if err := e.idx.DelCells(delCtx, keys.ScopedLayer(q.Layer, q.Headers), res, cells, model.Filters(q.Filters)); err != nil {
+		e.logger.Warn("strict consistency: index delete failed", "layer", q.Layer, "res", res, "err", err)
+	}
+	return false
+}
+
+// upstreamCount asks the upstream how many features of q's layer and filters
+// intersect the union of cells, using a WFS resultType=hits GetFeature
+func (e *Engine) upstreamCount(ctx context.Context, q model.QueryRequest, cells []string) (int, error) {
+	if e.http == nil || e.owsURL == nil {
+		return 0, errors.New("http client or owsURL not configured")
+	}
+	rings := make([]string, 0, len(cells))
+	for _, c := range cells {
+		ring, err := cellRingJSON(c)
+		if err != nil {
+			return 0, fmt.Errorf("cell %s ring: %w", c, err)
+		}
+		rings = append(rings, "["+ring+"]")
+	}
+	params := ogc.BuildGetFeatureParams(model.QueryRequest{
+		Layer:            q.Layer,
+		Polygon:          &model.Polygon{GeoJSON: `{"type":"MultiPolygon","coordinates":[` + strings.Join(rings, ",") + `]}`},
+		Filters:          q.Filters,
+		GeometryProperty: q.GeometryProperty,
+		CQLSRID:          q.CQLSRID,
+	})
+	params.Set("resultType", "hits")
+	return e.upstreamHits(ctx, q, params)
+}
+
+// upstreamHits runs a resultType=hits GetFeature and returns the count it
+// reports
+func (e *Engine) upstreamHits(ctx context.Context, q model.QueryRequest, params url.Values) (int, error) {
+	if err := e.upstream.acquire(ctx); err != nil {
+		return 0, fmt.Errorf("count: %w", err)
+	}
+	defer e.upstream.release()
+
+	ctxReq, cancel := context.WithTimeout(ctx, e.opTimeout)
+	defer cancel()
+	u := *e.owsURL
+	u.RawQuery = params.Encode()
+	req, err := http.NewRequestWithContext(ctxReq, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return 0, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range q.Headers {
+		req.Header.Set(k, v)
+	}
+
+	start := time.Now()
+	resp, err := e.http.Do(req)
+	observability.ObserveUpstreamLatency(ctx, "geoserver_count", time.Since(start).Seconds())
+	if err != nil {
+		if kind := observability.ClassifyUpstreamError(ctx, err); kind != "" {
+			observability.IncUpstreamError(ctx, "geoserver_count", kind)
+		}
+		return 0, fmt.Errorf("count request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		observability.IncUpstreamError(ctx, "geoserver_count", observability.ClassifyUpstreamStatus(resp.StatusCode))
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return 0, fmt.Errorf("count status=%d body=%q", resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+
+	var body struct {
+		NumberMatched json.RawMessage `json:"numberMatched"`
+		TotalFeatures json.RawMessage `json:"totalFeatures"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return 0, fmt.Errorf("decode count: %w", err)
+	}
+	for _, raw := range []json.RawMessage{body.NumberMatched, body.TotalFeatures} {
+		var n int
+		if json.Unmarshal(raw, &n) == nil && n >= 0 {
+			return n, nil
+		}
+	}
+	return 0, errors.New("count response has no numberMatched or totalFeatures")
+}
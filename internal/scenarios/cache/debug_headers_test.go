@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+
+	cachev2 "github.com/mohammed-shakir/h3-spatial-cache/internal/cache/v2"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/pkg/adaptive"
+)
+
+// fixedDecider always fills at one resolution
+type fixedDecider struct{ res int }
+
+func (d fixedDecider) Decide(adaptive.Query, adaptive.HotnessView) (adaptive.Decision, adaptive.Reason) {
+	return adaptive.Decision{Type: adaptive.DecisionFill, Resolution: d.res}, adaptive.ReasonFinerKidsHot
+}
+
+func TestHandleQuery_DebugHeadersReportChosenResolution(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[]}`)
+	}))
+	defer srv.Close()
+
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+
+	cfg := config.FromEnv()
+	cfg.Scenario = "cache"
+	cfg.RedisAddr = mr.Addr()
+	cfg.GeoServerURL = strings.TrimRight(srv.URL, "/")
+	cfg.H3Res, cfg.H3ResMin, cfg.H3ResMax = 8, 7, 9
+	cfg.AdaptiveEnabled = true
+	cfg.AdaptiveDryRun = false
+
+	serve := func(debug bool, q model.QueryRequest) *httptest.ResponseRecorder {
+		t.Helper()
+		cfg.Features.DebugHeaders = debug
+		e, err := newCacheWithBackend(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, cachev2.Open)
+		if err != nil {
+			t.Fatalf("engine: %v", err)
+		}
+		e.decider = fixedDecider{res: 9}
+		req := httptest.NewRequest(http.MethodGet, "/query", nil)
+		rr := httptest.NewRecorder()
+		e.HandleQuery(req.Context(), rr, req, q)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status=%d body=%q", rr.Code, rr.Body.String())
+		}
+		return rr
+	}
+
+	bb := model.BBox{X1: 18.00, Y1: 59.32, X2: 18.02, Y2: 59.34, SRID: "EPSG:4326"}
+	q := model.QueryRequest{Layer: "demo:NR_polygon", BBox: &bb}
+
+	rr := serve(false, q)
+	if got := rr.Header().Get(HeaderH3Resolution); got != "" {
+		t.Fatalf("%s=%q without the debug flag", HeaderH3Resolution, got)
+	}
+
+	e, err := newCacheWithBackend(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, cachev2.Open)
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	want, err := e.cellsForRes(q, 9)
+	if err != nil {
+		t.Fatalf("cells: %v", err)
+	}
+
+	rr = serve(true, q)
+	if got := rr.Header().Get(HeaderH3Resolution); got != "9" {
+		t.Fatalf("%s=%q want the decider's 9", HeaderH3Resolution, got)
+	}
+	if got := rr.Header().Get(HeaderH3CellCount); got != strconv.Itoa(len(want)) {
+		t.Fatalf("%s=%q want %d", HeaderH3CellCount, got, len(want))
+	}
+	if len(want) > 1 && rr.Header().Get(HeaderH3Cell) != "" {
+		t.Fatalf("%s set for a multi-cell query", HeaderH3Cell)
+	}
+
+	// a pinned single-cell probe reports the cell token
+	probe := model.QueryRequest{Layer: "demo:NR_polygon", H3Res: 8, BBox: &model.BBox{X1: 18.07, Y1: 59.33, X2: 18.08, Y2: 59.335, SRID: "EPSG:4326"}}
+	cells, err := e.cellsForRes(probe, 8)
+	if err != nil || len(cells) != 1 {
+		t.Fatalf("probe cells=%v err=%v, want one", cells, err)
+	}
+	rr = serve(true, probe)
+	if got := rr.Header().Get(HeaderH3Resolution); got != "8" {
+		t.Fatalf("pinned %s=%q want 8", HeaderH3Resolution, got)
+	}
+	if got := rr.Header().Get(HeaderH3Cell); got != cells[0] {
+		t.Fatalf("%s=%q want %s", HeaderH3Cell, got, cells[0])
+	}
+}
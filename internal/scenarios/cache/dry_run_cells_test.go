@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/hotness/expdecay"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/hotness/metricswrap"
+	"github.com/mohammed-shakir/h3-spatial-cache/pkg/adaptive"
+	adaptSimple "github.com/mohammed-shakir/h3-spatial-cache/pkg/adaptive/simple"
+)
+
+func TestDryRun_PerCellLogsAtSampleRate(t *testing.T) {
+	q := model.QueryRequest{
+		Layer: "ns:dry",
+		BBox:  &model.BBox{X1: 18.00, Y1: 59.32, X2: 18.02, Y2: 59.34, SRID: "EPSG:4326"},
+	}
+
+	run := func(sampleN int) (cells, logged int, out string) {
+		var buf bytes.Buffer
+		e := newEngineForTest()
+		e.serveFreshOnly = false
+		e.logger = slog.New(slog.NewTextHandler(&buf, nil))
+		e.adaptiveEnabled = true
+		e.adaptiveDryRun = true
+		e.dryRunCellN = sampleN
+		e.hot = metricswrap.New(expdecay.New(time.Minute), "topN")
+		e.decider = adaptSimple.New(adaptSimple.Config{
+			Threshold: 1, BaseRes: e.res, MinRes: e.minRes, MaxRes: e.maxRes, TTLWarm: time.Minute,
+		}, hotReadOnly{w: e.hot}, e.mapr)
+
+		c, err := e.cellsForRes(q, e.res)
+		if err != nil || len(c) == 0 {
+			t.Fatalf("cells: %v len=%d", err, len(c))
+		}
+		e.HandleQuery(context.Background(), httptest.NewRecorder(), httptest.NewRequest("GET", "/query", nil), q)
+		return len(c), strings.Count(buf.String(), "msg=adaptive_dry_run_cell"), buf.String()
+	}
+
+	cells, logged, out := run(1)
+	if logged != cells {
+		t.Fatalf("sample 1: %d per-cell entries for %d cells", logged, cells)
+	}
+	if !strings.Contains(out, "score=") || !strings.Contains(out, "resolution=8") || !strings.Contains(out, "ttl=") {
+		t.Fatalf("per-cell entry missing fields:\n%s", out)
+	}
+
+	cells, logged, _ = run(3)
+	if want := (cells + 2) / 3; logged != want {
+		t.Fatalf("sample 3: %d per-cell entries for %d cells, want %d", logged, cells, want)
+	}
+
+	if _, logged, _ = run(0); logged != 0 {
+		t.Fatalf("sampling disabled but %d per-cell entries logged", logged)
+	}
+}
+
+func TestAdaptiveDecision_DebugLogsCandidateSweep(t *testing.T) {
+	q := model.QueryRequest{
+		Layer: "ns:sweep",
+		BBox:  &model.BBox{X1: 18.00, Y1: 59.32, X2: 18.02, Y2: 59.34, SRID: "EPSG:4326"},
+	}
+	run := func(level slog.Level) string {
+		var buf bytes.Buffer
+		e := newEngineForTest()
+		e.serveFreshOnly = false
+		e.logger = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: level}))
+		e.adaptiveEnabled = true
+		e.adaptiveDryRun = true
+		e.minRes, e.maxRes = e.res-1, e.res+1
+		e.hot = metricswrap.New(expdecay.New(time.Minute), "topN")
+		e.decider = adaptSimple.New(adaptSimple.Config{
+			Threshold: 0.5, BaseRes: e.res, MinRes: e.minRes, MaxRes: e.maxRes, TTLWarm: time.Minute,
+		}, hotReadOnly{w: e.hot}, e.mapr)
+		e.HandleQuery(context.Background(), httptest.NewRecorder(), httptest.NewRequest("GET", "/query", nil), q)
+		return buf.String()
+	}
+
+	out := run(slog.LevelDebug)
+	line := ""
+	for l := range strings.SplitSeq(out, "\n") {
+		if strings.Contains(l, "msg=adaptive_decision") {
+			line = l
+		}
+	}
+	if line == "" {
+		t.Fatalf("no adaptive_decision log:\n%s", out)
+	}
+	for _, want := range []string{"candidates=", "res7=", "res8=", "res9="} {
+		if !strings.Contains(line, want) {
+			t.Fatalf("adaptive_decision missing %q: %s", want, line)
+		}
+	}
+
+	if out := run(slog.LevelInfo); !strings.Contains(out, "msg=adaptive_decision") || strings.Contains(out, "candidates=") {
+		t.Fatalf("candidates should only be logged at debug:\n%s", out)
+	}
+}
+
+// bypassDecider always bypasses at one resolution with a TTL
+type bypassDecider struct{ res int }
+
+func (d bypassDecider) Decide(adaptive.Query, adaptive.HotnessView) (adaptive.Decision, adaptive.Reason) {
+	return adaptive.Decision{Type: adaptive.DecisionBypass, Resolution: d.res, TTL: 90 * time.Second}, adaptive.ReasonColdAllCells
+}
+
+func TestDryRun_HeadersReportDeciderOutput(t *testing.T) {
+	q := model.QueryRequest{
+		Layer: "ns:dry",
+		BBox:  &model.BBox{X1: 18.00, Y1: 59.32, X2: 18.02, Y2: 59.34, SRID: "EPSG:4326"},
+	}
+	serve := func(dryRun bool, d adaptive.Decider) http.Header {
+		e := newEngineForTest()
+		e.serveFreshOnly = false
+		e.adaptiveEnabled = true
+		e.adaptiveDryRun = dryRun
+		e.decider = d
+		rr := httptest.NewRecorder()
+		e.HandleQuery(context.Background(), rr, httptest.NewRequest("GET", "/query", nil), q)
+		return rr.Header()
+	}
+
+	h := serve(true, bypassDecider{res: 7})
+	want := map[string]string{
+		HeaderAdaptiveDecision:   "bypass",
+		HeaderAdaptiveReason:     string(adaptive.ReasonColdAllCells),
+		HeaderAdaptiveResolution: "7",
+		HeaderAdaptiveTTL:        "90",
+	}
+	for k, v := range want {
+		if got := h.Get(k); got != v {
+			t.Fatalf("%s=%q want %q", k, got, v)
+		}
+	}
+
+	// without a TTL of its own the decision would fill with the layer's
+	if got := serve(true, fixedDecider{res: 9}).Get(HeaderAdaptiveTTL); got != "1" {
+		t.Fatalf("%s=%q want the 1s layer TTL", HeaderAdaptiveTTL, got)
+	}
+
+	// applied decisions don't report themselves
+	if got := serve(false, fixedDecider{res: 8}).Get(HeaderAdaptiveDecision); got != "" {
+		t.Fatalf("%s=%q outside dry-run", HeaderAdaptiveDecision, got)
+	}
+}
@@ -0,0 +1,104 @@
+package cache_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/cellindex"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/redisstore"
+	cachev2 "github.com/mohammed-shakir/h3-spatial-cache/internal/cache/v2"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
+	h3mapper "github.com/mohammed-shakir/h3-spatial-cache/internal/mapper/h3"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/scenarios"
+)
+
+func TestCache_EmptyMarkerHit_IncrementsEmptyCells(t *testing.T) {
+	ctx := context.Background()
+
+	reg := prometheus.NewRegistry()
+	observability.Init(reg, true)
+	observability.SetScenario("cache")
+
+	gs := &gsDouble{}
+	srv := httptest.NewServer(http.HandlerFunc(gs.handler))
+	defer srv.Close()
+
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+
+	cfg := config.FromEnv()
+	cfg.Scenario = "cache"
+	cfg.RedisAddr = mr.Addr()
+	cfg.GeoServerURL = strings.TrimRight(srv.URL, "/")
+	cfg.CacheTTLDefault = 30 * time.Second
+	cfg.AdaptiveEnabled = false
+	cfg.CacheEmptySampleInterval = 0
+
+	bb := model.BBox{X1: 18.00, Y1: 59.32, X2: 18.02, Y2: 59.34, SRID: "EPSG:4326"}
+	cells, err := h3mapper.New().CellsForBBox(bb, cfg.H3Res)
+	if err != nil || len(cells) == 0 {
+		t.Fatalf("h3 mapping: %v", err)
+	}
+
+	rc, err := redisstore.New(ctx, cfg.RedisAddr)
+	if err != nil {
+		t.Fatalf("redis client: %v", err)
+	}
+	v2store := cachev2.NewRedisStore(rc, cfg.CacheTTLDefault)
+	for _, c := range cells {
+		if err := v2store.Cells.SetIDs(ctx, "demo:NR_polygon", cfg.H3Res, c, "", []string{cellindex.EmptyMarkerID}, cfg.CacheTTLDefault); err != nil {
+			t.Fatalf("seed empty marker: %v", err)
+		}
+	}
+
+	h, err := scenarios.New("cache", cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), nil)
+	if err != nil {
+		t.Fatalf("scenario: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/query", nil)
+	rr := httptest.NewRecorder()
+	h.HandleQuery(req.Context(), rr, req, model.QueryRequest{Layer: "demo:NR_polygon", BBox: &bb})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	if gs.calls != 0 {
+		t.Fatalf("expected empty-marker cells to skip upstream; got %d calls", gs.calls)
+	}
+
+	mrr := httptest.NewRecorder()
+	promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(mrr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := mrr.Body.String()
+	n := len(cells)
+	for _, want := range []string{
+		`spatial_empty_cells_total{layer="demo:NR_polygon",scenario="cache"} ` + fmtInt(n),
+		`spatial_cells_requested_total{layer="demo:NR_polygon",scenario="cache"} ` + fmtInt(n),
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("missing %s:\n%s", want, body)
+		}
+	}
+
+	counter, ok := cellindex.NewRedisIndex(rc).(cellindex.EmptyMarkerCounter)
+	if !ok {
+		t.Fatalf("redis cell index should implement EmptyMarkerCounter")
+	}
+	got, err := counter.CountEmptyMarkers(ctx, 1000)
+	if err != nil {
+		t.Fatalf("CountEmptyMarkers: %v", err)
+	}
+	if got != int64(n) {
+		t.Fatalf("CountEmptyMarkers=%d want %d", got, n)
+	}
+}
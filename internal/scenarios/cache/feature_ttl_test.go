@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+
+	cachev2 "github.com/mohammed-shakir/h3-spatial-cache/internal/cache/v2"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+)
+
+func TestCache_FeatureTTL_OutlivesCellIndex(t *testing.T) {
+	var calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[{"type":"Feature","id":"f1","geometry":{"type":"Point","coordinates":[18.01,59.33]},"properties":{}}]}`)
+	}))
+	defer srv.Close()
+
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+
+	cfg := config.FromEnv()
+	cfg.Scenario = "cache"
+	cfg.RedisAddr = mr.Addr()
+	cfg.GeoServerURL = strings.TrimRight(srv.URL, "/")
+	cfg.H3Res, cfg.H3ResMin, cfg.H3ResMax = 8, 8, 8
+	cfg.CacheTTLDefault = time.Minute
+	cfg.FeatureTTL = 10 * time.Minute
+	cfg.AdaptiveEnabled = false
+
+	e, err := newCacheWithBackend(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, cachev2.Open)
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	q := model.QueryRequest{
+		Layer: "demo:NR_polygon",
+		BBox:  &model.BBox{X1: 18.00, Y1: 59.32, X2: 18.02, Y2: 59.34, SRID: "EPSG:4326"},
+	}
+	serve := func() string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/query", nil)
+		rr := httptest.NewRecorder()
+		e.HandleQuery(req.Context(), rr, req, q)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status=%d body=%q", rr.Code, rr.Body.String())
+		}
+		return rr.Header().Get("X-Cache")
+	}
+	ttls := func(prefix string) []time.Duration {
+		var out []time.Duration
+		for _, k := range mr.Keys() {
+			if strings.HasPrefix(k, prefix) {
+				out = append(out, mr.TTL(k))
+			}
+		}
+		return out
+	}
+
+	serve()
+	cells := calls.Load()
+	for _, ttl := range ttls("idx:") {
+		if ttl <= 0 || ttl > cfg.CacheTTLDefault {
+			t.Fatalf("index ttl=%v want at most %v", ttl, cfg.CacheTTLDefault)
+		}
+	}
+	feats := ttls("feat:")
+	if len(feats) != 1 || feats[0] != cfg.FeatureTTL {
+		t.Fatalf("feature ttls=%v want [%v]", feats, cfg.FeatureTTL)
+	}
+
+	// the index expires while the feature body is still live: that is a miss,
+	// and the refill writes the index again
+	mr.FastForward(2 * time.Minute)
+	if n := len(ttls("idx:")); n != 0 {
+		t.Fatalf("%d index keys survived their ttl", n)
+	}
+	if len(ttls("feat:")) != 1 {
+		t.Fatalf("feature body expired with the index")
+	}
+	if xc := serve(); xc != "MISS" {
+		t.Fatalf("X-Cache=%q after index expiry, want MISS", xc)
+	}
+	if got := calls.Load(); got != 2*cells {
+		t.Fatalf("upstream calls=%d want %d (one refill per cell)", got, 2*cells)
+	}
+	if n := len(ttls("idx:")); int64(n) != cells {
+		t.Fatalf("index keys=%d after refill, want %d", n, cells)
+	}
+	if xc := serve(); xc != "HIT" {
+		t.Fatalf("X-Cache=%q after refill, want HIT", xc)
+	}
+}
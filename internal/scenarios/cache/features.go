@@ -0,0 +1,196 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/aggregate/geojsonagg"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/keys"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/composer"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/ogc"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/problem"
+)
+
+// HandleFeatures serves features by id from the feature store, fetching any
+// missing ids from GeoServer with a featureID filter
+func (e *Engine) HandleFeatures(ctx context.Context, w http.ResponseWriter, r *http.Request, q model.FeatureRequest) {
+	start := time.Now()
+	layer := keys.ScopedLayer(q.Layer, q.Headers)
+
+	// GeoJSON ids may be strings or numbers; a numeric-looking id matches either
+	candidates := make([]string, 0, len(q.IDs)*2)
+	owner := make(map[string]string, len(q.IDs)*2)
+	for _, id := range q.IDs {
+		candidates = append(candidates, "s:"+id)
+		owner["s:"+id] = id
+		if _, err := strconv.ParseFloat(id, 64); err == nil {
+			candidates = append(candidates, "n:"+id)
+			owner["n:"+id] = id
+		}
+	}
+
+	found := make(map[string][]byte, len(q.IDs))
+	if e.fs != nil {
+		mgetCtx, cancel := withTimeout(ctx, e.readTimeout())
+		m, err := e.fs.MGetFeatures(mgetCtx, layer, candidates)
+		cancel()
+		if err != nil {
+			e.logger.Warn("feature store mget error, fetching all ids upstream",
+				"layer", q.Layer,
+				"ids", len(q.IDs),
+				"err", err,
+			)
+		}
+		for _, c := range candidates {
+			if f, ok := m[c]; ok {
+				found[owner[c]] = f
+			}
+		}
+	}
+
+	var pages []composer.ShardPage
+	hits := make([]json.RawMessage, 0, len(found))
+	missing := make([]string, 0, len(q.IDs)-len(found))
+	for _, id := range q.IDs {
+		if f, ok := found[id]; ok {
+			hits = append(hits, f)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	if len(hits) > 0 {
+		pages = append(pages, composer.ShardPage{CacheStatus: composer.CacheHit, Features: hits})
+	}
+
+	if len(missing) > 0 {
+		feats, err := e.fetchFeaturesByID(ctx, q, missing)
+		if err != nil {
+			e.logger.Error("features upstream error",
+				"layer", q.Layer,
+				"missing", len(missing),
+				"err", err,
+			)
+			problem.Error(w, r, "upstream error: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+		if len(feats) > 0 {
+			pages = append(pages, composer.ShardPage{CacheStatus: composer.CacheMiss, Features: feats})
+		}
+		if !e.readOnly {
+			e.storeFeatures(ctx, q, layer, feats)
+		}
+	}
+
+	req := composer.Request{
+		Query:        composer.QueryParams{IDProperty: config.IDPropertyFor(e.idProps, q.Layer)},
+		Pages:        pages,
+		AcceptHeader: r.Header.Get("Accept"),
+		OutputFormat: r.URL.Query().Get("outputFormat"),
+	}
+	res, err := composer.Compose(ctx, e.eng, req)
+	if err != nil {
+		problem.Error(w, r, "compose error: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", res.ContentType)
+	e.setDiagnostics(w, res.Diagnostics)
+	w.Header().Set(composer.HeaderXCache, composer.XCacheValue(res.HitClass))
+	w.WriteHeader(res.StatusCode)
+	_, _ = w.Write(res.Body)
+
+	e.logRequest(ctx, "features by id", time.Since(start),
+		"layer", q.Layer,
+		"ids", len(q.IDs),
+		"hits", len(hits),
+		"missing", len(missing),
+		"dur", time.Since(start).String(),
+	)
+}
+
+// fetchFeaturesByID runs one GetFeature for ids and returns its features
+func (e *Engine) fetchFeaturesByID(ctx context.Context, q model.FeatureRequest, ids []string) ([]json.RawMessage, error) {
+	if e.http == nil || e.owsURL == nil {
+		return nil, fmt.Errorf("cache features: http client or owsURL not configured")
+	}
+
+	ctxReq, cancel := context.WithTimeout(ctx, e.opTimeout)
+	defer cancel()
+	u := *e.owsURL
+	u.RawQuery = ogc.BuildGetFeatureByIDParams(q.Layer, ids).Encode()
+
+	req, _ := http.NewRequestWithContext(ctxReq, http.MethodGet, u.String(), nil)
+	req.Header.Set("Accept", "application/json")
+	for k, v := range q.Headers {
+		req.Header.Set(k, v)
+	}
+
+	start := time.Now()
+	resp, err := e.http.Do(req)
+	observability.ObserveUpstreamLatency(ctx, "geoserver_features", time.Since(start).Seconds())
+	if err != nil {
+		if kind := observability.ClassifyUpstreamError(ctx, err); kind != "" {
+			observability.IncUpstreamError(ctx, "geoserver_features", kind)
+		}
+		return nil, fmt.Errorf("features fetch: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		observability.IncUpstreamError(ctx, "geoserver_features", observability.ClassifyUpstreamStatus(resp.StatusCode))
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("features status=%d body=%q", resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+
+	var fc struct {
+		Features []json.RawMessage `json:"features"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&fc); err != nil {
+		observability.IncUpstreamError(ctx, "geoserver_features", observability.UpstreamErrBadBody)
+		return nil, fmt.Errorf("features decode: %w", err)
+	}
+	return fc.Features, nil
+}
+
+// storeFeatures caches fetched features under their canonical ids; features
+// without a usable id are served but not stored
+func (e *Engine) storeFeatures(ctx context.Context, q model.FeatureRequest, layer string, feats []json.RawMessage) {
+	if e.fs == nil || len(feats) == 0 {
+		return
+	}
+	idProp := config.IDPropertyFor(e.idProps, q.Layer)
+	byID := make(map[string][]byte, len(feats))
+	for _, f := range feats {
+		var mf struct {
+			ID         json.RawMessage `json:"id"`
+			Properties json.RawMessage `json:"properties"`
+		}
+		if err := json.Unmarshal(f, &mf); err != nil {
+			continue
+		}
+		raw := mf.ID
+		if len(raw) == 0 && idProp != "" {
+			raw = geojsonagg.PropertyID(mf.Properties, idProp)
+		}
+		if id, err := geojsonagg.CanonicalIDKey(raw); err == nil && id != "" {
+			byID[id] = f
+		}
+	}
+	if len(byID) == 0 {
+		return
+	}
+	if err := e.putFeatures(ctx, layer, byID, e.featureTTLFor(e.ttlFor(q.Layer))); err != nil {
+		e.logger.Warn("features store put failed",
+			"layer", q.Layer,
+			"ids", len(byID),
+			"err", err,
+		)
+	}
+}
@@ -0,0 +1,115 @@
+package cache_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/router"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/scenarios"
+)
+
+func TestCache_FeaturesByID_MixedCachedAndUncached(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		requested []string
+	)
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids := r.URL.Query().Get("featureID")
+		mu.Lock()
+		requested = append(requested, ids)
+		mu.Unlock()
+
+		feats := make([]string, 0)
+		for id := range strings.SplitSeq(ids, ",") {
+			feats = append(feats, fmt.Sprintf(`{"type":"Feature","id":%q,"geometry":{"type":"Point","coordinates":[%d,59]},"properties":{"name":%q}}`, id, int(id[len(id)-1]), id))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[`+strings.Join(feats, ",")+`]}`)
+	}))
+	defer up.Close()
+
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+
+	cfg := config.FromEnv()
+	cfg.Scenario = "cache"
+	cfg.RedisAddr = mr.Addr()
+	cfg.GeoServerURL = strings.TrimRight(up.URL, "/")
+	cfg.AdaptiveEnabled = false
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h, err := scenarios.New("cache", cfg, logger, nil)
+	if err != nil {
+		t.Fatalf("scenario: %v", err)
+	}
+	fh, ok := h.(router.FeatureHandler)
+	if !ok {
+		t.Fatalf("cache handler should serve /features")
+	}
+	handler := router.HandleFeatures(logger, cfg, fh)
+
+	get := func(ids string) (*httptest.ResponseRecorder, []string) {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/features?layer=demo:NR_polygon&ids="+ids, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("ids=%s status=%d body=%q", ids, rr.Code, rr.Body.String())
+		}
+		var fc struct {
+			Features []struct {
+				ID string `json:"id"`
+			} `json:"features"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &fc); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		got := make([]string, 0, len(fc.Features))
+		for _, f := range fc.Features {
+			got = append(got, f.ID)
+		}
+		slices.Sort(got)
+		return rr, got
+	}
+
+	if rr, got := get("a.1,b.2"); rr.Header().Get("X-Cache") != "MISS" || !slices.Equal(got, []string{"a.1", "b.2"}) {
+		t.Fatalf("first: X-Cache=%q ids=%v", rr.Header().Get("X-Cache"), got)
+	}
+
+	rr, got := get("a.1,c.3,b.2")
+	if rr.Header().Get("X-Cache") != "PARTIAL" {
+		t.Fatalf("second: X-Cache=%q want PARTIAL", rr.Header().Get("X-Cache"))
+	}
+	if !slices.Equal(got, []string{"a.1", "b.2", "c.3"}) {
+		t.Fatalf("second: ids=%v", got)
+	}
+
+	if rr, _ := get("a.1,b.2,c.3"); rr.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("third: X-Cache=%q want HIT", rr.Header().Get("X-Cache"))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"a.1,b.2", "c.3"}; !slices.Equal(requested, want) {
+		t.Fatalf("upstream featureID requests=%v want %v", requested, want)
+	}
+}
+
+func TestCache_FeaturesByID_RequiresIDs(t *testing.T) {
+	cfg := config.FromEnv()
+	rr := httptest.NewRecorder()
+	router.HandleFeatures(slog.New(slog.NewTextHandler(io.Discard, nil)), cfg, nil).
+		ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/features?layer=demo:NR_polygon&ids=,", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("status=%d want 400", rr.Code)
+	}
+}
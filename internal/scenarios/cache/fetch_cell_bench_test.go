@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"runtime/metrics"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/cellindex"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/featurestore"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/memstore"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/composer"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+)
+
+func largeCellFC(n int) []byte {
+	var b bytes.Buffer
+	b.WriteString(`{"type":"FeatureCollection","features":[`)
+	for i := range n {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `{"type":"Feature","id":"f%d","geometry":{"type":"Point","coordinates":[18.%04d,59.3]},"properties":{"name":"feature number %d"}}`, i, i, i)
+	}
+	fmt.Fprintf(&b, `],"numberMatched":%d}`, n)
+	return b.Bytes()
+}
+
+// peakHeap samples live heap bytes until stop is closed and reports the
+// highest value seen above the starting point
+func peakHeap(stop <-chan struct{}) <-chan uint64 {
+	out := make(chan uint64, 1)
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	runtime.GC()
+	metrics.Read(sample)
+	base := sample[0].Value.Uint64()
+	var peak atomic.Uint64
+	go func() {
+		t := time.NewTicker(100 * time.Microsecond)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				out <- peak.Load()
+				return
+			case <-t.C:
+				metrics.Read(sample)
+				if v := sample[0].Value.Uint64(); v > base && v-base > peak.Load() {
+					peak.Store(v - base)
+				}
+			}
+		}
+	}()
+	return out
+}
+
+func benchLargeCell(b *testing.B, run func(body []byte)) {
+	body := largeCellFC(20000)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(body)))
+	stop := make(chan struct{})
+	peak := peakHeap(stop)
+	b.ResetTimer()
+	for b.Loop() {
+		run(body)
+	}
+	b.StopTimer()
+	close(stop)
+	b.ReportMetric(float64(<-peak), "peak-heap-B")
+}
+
+func BenchmarkFetchCell_LargeResponse_Stream(b *testing.B) {
+	var body atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body.Load().([]byte))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	st := memstore.New(0)
+	e := &Engine{
+		logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		fs:        featurestore.NewMemoryStore(st, time.Minute),
+		idx:       cellindex.NewMemoryIndex(st),
+		owsURL:    u,
+		http:      srv.Client(),
+		opTimeout: 10 * time.Second,
+	}
+	q := model.QueryRequest{Layer: "demo:layer"}
+
+	benchLargeCell(b, func(raw []byte) {
+		body.Store(raw)
+		if r := e.fetchCell(context.Background(), q, "892a100d2b3ffff", 9, time.Minute); r.err != nil || len(r.features) != 20000 {
+			b.Fatalf("fetchCell err=%v features=%d", r.err, len(r.features))
+		}
+	})
+}
+
+// decode alone, streamed as fetchCell does now versus the former buffered
+// ReadAll plus root and features unmarshal
+func BenchmarkCellDecode_LargeResponse_Stream(b *testing.B) {
+	benchLargeCell(b, func(raw []byte) {
+		var feats []json.RawMessage
+		_, err := composer.DecodeFeatureStream(bytes.NewReader(raw), func(f json.RawMessage) error {
+			feats = append(feats, f)
+			return nil
+		})
+		if err != nil || len(feats) != 20000 {
+			b.Fatalf("features=%d err=%v", len(feats), err)
+		}
+	})
+}
+
+func BenchmarkCellDecode_LargeResponse_Buffered(b *testing.B) {
+	benchLargeCell(b, func(raw []byte) {
+		body, err := io.ReadAll(bytes.NewReader(raw))
+		if err != nil {
+			b.Fatal(err)
+		}
+		var root map[string]json.RawMessage
+		if err := json.Unmarshal(body, &root); err != nil {
+			b.Fatal(err)
+		}
+		var feats []json.RawMessage
+		if err := json.Unmarshal(root["features"], &feats); err != nil || len(feats) != 20000 {
+			b.Fatalf("features=%d err=%v", len(feats), err)
+		}
+	})
+}
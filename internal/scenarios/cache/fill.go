@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/keys"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/admin"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+)
+
+// FillQuery fetches and stores q's unindexed cells at the base (or requested)
+// res without composing a response. Indexed cells, empty markers included,
+// count as hits and are left alone. A read-only engine refuses with
+// admin.ErrReadOnly
+func (e *Engine) FillQuery(ctx context.Context, q model.QueryRequest) (admin.FillSummary, error) {
+	if e.readOnly {
+		return admin.FillSummary{}, admin.ErrReadOnly
+	}
+	res := e.baseRes(q.Layer)
+	if q.H3Res > 0 {
+		res = q.H3Res
+	}
+	cells, err := e.cellsForRes(q, res)
+	if err != nil {
+		return admin.FillSummary{}, fmt.Errorf("map footprint: %w", err)
+	}
+	return e.fillCellSet(ctx, q, res, cells)
+}
+
+// fillCellSet is FillQuery for an explicit set of cells at res
+func (e *Engine) fillCellSet(ctx context.Context, q model.QueryRequest, res int, cells []string) (admin.FillSummary, error) {
+	sum := admin.FillSummary{Res: res, Cells: len(cells)}
+	if len(cells) == 0 {
+		return sum, nil
+	}
+
+	missing := cells
+	if e.idx != nil {
+		mgetCtx, cancel := withTimeout(ctx, e.readTimeout())
+		idsByCell, err := e.idx.MGetIDs(mgetCtx, keys.ScopedLayer(q.Layer, q.Headers), res, cells, model.Filters(q.Filters))
+		cancel()
+		if err != nil {
+			e.logger.Warn("fill: cell index mget error, filling every cell",
+				"layer", q.Layer,
+				"res", res,
+				"cells", len(cells),
+				"err", err,
+			)
+		} else {
+			missing = make([]string, 0, len(cells))
+			for _, c := range cells {
+				if len(idsByCell[c]) == 0 {
+					missing = append(missing, c)
+				}
+			}
+		}
+	}
+	sum.Hits = len(cells) - len(missing)
+	sum.Misses = len(missing)
+	if len(missing) == 0 {
+		return sum, nil
+	}
+
+	ttl := e.ttlFor(q.Layer)
+	results, err := e.fillCells(ctx, missing, func(ctx context.Context, cell string) result {
+		return e.fetchCell(ctx, q, cell, res, e.staggerTTL(e.tierTTL(ttl, cell), res, cell))
+	})
+	if err != nil {
+		return sum, err
+	}
+	var errs []error
+	for _, r := range results {
+		if r.err != nil {
+			errs = append(errs, r.err)
+			continue
+		}
+		for _, f := range r.features {
+			sum.Bytes += int64(len(f))
+		}
+	}
+	if len(errs) > 0 {
+		sum.Failed = len(errs)
+		return sum, fmt.Errorf("%d/%d cells failed: %w", len(errs), len(missing), errors.Join(errs...))
+	}
+	return sum, nil
+}
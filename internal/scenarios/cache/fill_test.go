@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+
+	cachev2 "github.com/mohammed-shakir/h3-spatial-cache/internal/cache/v2"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/admin"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+)
+
+func TestAdminFill_PopulatesCellsAndSummarizes(t *testing.T) {
+	const feature = `{"type":"Feature","id":"f1","geometry":null,"properties":{}}`
+	var upstream atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		upstream.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[`+feature+`]}`)
+	}))
+	defer srv.Close()
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+
+	cfg := config.FromEnv()
+	cfg.Scenario = "cache"
+	cfg.RedisAddr = mr.Addr()
+	cfg.GeoServerURL = strings.TrimRight(srv.URL, "/")
+	cfg.H3Res, cfg.H3ResMin, cfg.H3ResMax = 8, 7, 8
+	cfg.CacheTTLDefault = time.Minute
+	cfg.AdaptiveEnabled = false
+	e, err := newCacheWithBackend(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, cachev2.Open)
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+
+	fill := func() (int, admin.FillSummary, string) {
+		req := httptest.NewRequest(http.MethodPost, "/admin/fill?layer=demo:NR_polygon&res=8&bbox=18.00,59.32,18.02,59.34,EPSG:4326", nil)
+		rr := httptest.NewRecorder()
+		admin.CacheFill(cfg, e)(rr, req)
+		var sum admin.FillSummary
+		if err := json.Unmarshal(rr.Body.Bytes(), &sum); err != nil {
+			t.Fatalf("decode %q: %v", rr.Body.String(), err)
+		}
+		return rr.Code, sum, rr.Body.String()
+	}
+
+	code, sum, body := fill()
+	if code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", code, body)
+	}
+	if strings.Contains(body, "features") {
+		t.Fatalf("fill returned features: %s", body)
+	}
+	if sum.Cells < 2 || sum.Hits != 0 || sum.Misses != sum.Cells || sum.Bytes != int64(sum.Cells*len(feature)) {
+		t.Fatalf("first fill summary=%+v, want every cell a miss with %d bytes each", sum, len(feature))
+	}
+	if got := upstream.Load(); got != int64(sum.Cells) {
+		t.Fatalf("upstream calls=%d want %d", got, sum.Cells)
+	}
+	idx := 0
+	for _, k := range mr.Keys() {
+		if strings.HasPrefix(k, "idx:") {
+			idx++
+		}
+	}
+	if idx != sum.Cells {
+		t.Fatalf("index keys=%d want %d", idx, sum.Cells)
+	}
+
+	code, again, body := fill()
+	if code != http.StatusOK || again.Cells != sum.Cells || again.Hits != sum.Cells || again.Misses != 0 || again.Bytes != 0 {
+		t.Fatalf("second fill status=%d summary=%+v body=%s, want all hits", code, again, body)
+	}
+	if got := upstream.Load(); got != int64(sum.Cells) {
+		t.Fatalf("second fill went upstream: calls=%d", got)
+	}
+
+	// a read-only engine refuses the fill before touching the upstream
+	e.readOnly = true
+	keysBefore := len(mr.Keys())
+	rr := httptest.NewRecorder()
+	admin.CacheFill(cfg, e)(rr, httptest.NewRequest(http.MethodPost, "/admin/fill?layer=demo:other&bbox=18.00,59.32,18.02,59.34,EPSG:4326", nil))
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("read-only fill status=%d body=%s, want 409", rr.Code, rr.Body.String())
+	}
+	if got := upstream.Load(); got != int64(sum.Cells) || len(mr.Keys()) != keysBefore {
+		t.Fatalf("read-only fill wrote: upstream calls=%d keys %d->%d", got, keysBefore, len(mr.Keys()))
+	}
+}
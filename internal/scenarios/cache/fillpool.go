@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// errFillQueueFull means a cell could not be queued within the engine's queueWait
+var errFillQueueFull = errors.New("fill queue full")
+
+// fillPool runs cell fills on long-lived workers shared by every request, so
+// a busy engine reuses goroutines instead of starting a fan-out per query.
+// A nil pool leaves each request to start its own workers
+type fillPool struct {
+	jobs chan fillJob
+}
+
+type fillJob struct {
+	ctx  context.Context
+	cell string
+	fill func(ctx context.Context, cell string) result
+	// out is buffered for the whole request, so a worker never blocks on it
+	out chan<- result
+}
+
+func newFillPool(workers, queue int) *fillPool {
+	if workers <= 0 {
+		return nil
+	}
+	p := &fillPool{jobs: make(chan fillJob, max(queue, 0))}
+	for range workers {
+		go p.work()
+	}
+	return p
+}
+
+func (p *fillPool) work() {
+	for j := range p.jobs {
+		if err := j.ctx.Err(); err != nil {
+			j.out <- result{cell: j.cell, err: fmt.Errorf("fill %s: %w", j.cell, err)}
+			continue
+		}
+		j.out <- j.fill(j.ctx, j.cell)
+	}
+}
+
+// enqueue sends job, waiting at most wait for room (forever when wait is 0)
+func enqueue[T any](ctx context.Context, jobs chan<- T, job T, wait time.Duration) error {
+	select {
+	case jobs <- job:
+		return nil
+	default:
+	}
+	var expired <-chan time.Time
+	if wait > 0 {
+		t := time.NewTimer(wait)
+		defer t.Stop()
+		expired = t.C
+	}
+	select {
+	case jobs <- job:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-expired:
+		return errFillQueueFull
+	}
+}
+
+// fillRetryAfter is the Retry-After seconds for a saturated fill queue: the
+// queue wait rounded up, at least one
+func (e *Engine) fillRetryAfter() string {
+	return strconv.Itoa(max(int(math.Ceil(e.queueWait.Seconds())), 1))
+}
+
+// fillCells fetches every cell and returns one result per cell, in completion
+// order; it fails when ctx ends or the queue stays full past queueWait before
+// all cells were queued
+func (e *Engine) fillCells(ctx context.Context, cells []string, fill func(ctx context.Context, cell string) result) ([]result, error) {
+	results := make(chan result, len(cells))
+	if e.fill != nil {
+		for i, c := range cells {
+			if err := enqueue(ctx, e.fill.jobs, fillJob{ctx: ctx, cell: c, fill: fill, out: results}, e.queueWait); err != nil {
+				// the queued jobs still report into the buffered channel
+				return nil, fmt.Errorf("queue fill %d/%d: %w", i, len(cells), err)
+			}
+		}
+		out := make([]result, 0, len(cells))
+		for range cells {
+			out = append(out, <-results)
+		}
+		return out, nil
+	}
+
+	jobs := make(chan string, e.queueSize)
+	workerN := e.maxWorkers
+	if workerN <= 0 {
+		workerN = 8
+	}
+	var wg sync.WaitGroup
+	wg.Add(workerN)
+	for range workerN {
+		go func() {
+			defer wg.Done()
+			for cell := range jobs {
+				select {
+				case <-ctx.Done():
+					return
+				default:
+				}
+				select {
+				case results <- fill(ctx, cell):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	for i, c := range cells {
+		if err := enqueue(ctx, jobs, c, e.queueWait); err != nil {
+			close(jobs)
+			wg.Wait()
+			return nil, fmt.Errorf("queue fill %d/%d: %w", i, len(cells), err)
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	close(results)
+
+	out := make([]result, 0, len(cells))
+	for r := range results {
+		out = append(out, r)
+	}
+	return out, nil
+}
@@ -0,0 +1,178 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"runtime/metrics"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus"
+
+	cachev2 "github.com/mohammed-shakir/h3-spatial-cache/internal/cache/v2"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
+)
+
+func testCells(n int) []string {
+	cells := make([]string, n)
+	for i := range cells {
+		cells[i] = fmt.Sprintf("cell-%02d", i)
+	}
+	return cells
+}
+
+func echoFill(_ context.Context, cell string) result { return result{cell: cell} }
+
+func TestFillCells_SharedPoolReturnsEveryCellPerRequest(t *testing.T) {
+	e := &Engine{maxWorkers: 2, queueSize: 1, fill: newFillPool(3, 2)}
+	cells := testCells(20)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := e.fillCells(context.Background(), cells, echoFill)
+			if err != nil {
+				errs <- err
+				return
+			}
+			seen := make([]string, 0, len(got))
+			for _, r := range got {
+				seen = append(seen, r.cell)
+			}
+			slices.Sort(seen)
+			if !slices.Equal(seen, cells) {
+				errs <- fmt.Errorf("cells=%v want %v", seen, cells)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
+
+func TestFillCells_SharedPoolStopsQueueingOnCancel(t *testing.T) {
+	e := &Engine{fill: newFillPool(1, 0)}
+	block := make(chan struct{})
+	defer close(block)
+	busy := make(chan struct{})
+	go func() {
+		_, _ = e.fillCells(context.Background(), []string{"busy"}, func(context.Context, string) result {
+			close(busy)
+			<-block
+			return result{}
+		})
+	}()
+	<-busy
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := e.fillCells(ctx, testCells(3), echoFill); err == nil {
+		t.Fatalf("want an error when the pool stays busy past the deadline")
+	}
+}
+
+// reports goroutines started per query for the per-request fan-out and the
+// shared pool; go test -bench FillCells -run ^$ ./internal/scenarios/cache
+func BenchmarkFillCells_GoroutineChurn(b *testing.B) {
+	cells := testCells(16)
+	for _, bc := range []struct {
+		name string
+		e    *Engine
+	}{
+		{"per_request", &Engine{maxWorkers: 8, queueSize: 64}},
+		{"shared_pool", &Engine{fill: newFillPool(8, 64)}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			sample := []metrics.Sample{{Name: "/sched/goroutines-created:goroutines"}}
+			metrics.Read(sample)
+			before := sample[0].Value
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := bc.e.fillCells(context.Background(), cells, echoFill); err != nil {
+						b.Error(err)
+					}
+				}
+			})
+			metrics.Read(sample)
+			if before.Kind() == metrics.KindUint64 && sample[0].Value.Kind() == metrics.KindUint64 {
+				b.ReportMetric(float64(sample[0].Value.Uint64()-before.Uint64())/float64(b.N), "goroutines/op")
+			}
+		})
+	}
+}
+
+func TestHandleQuery_SaturatedFillQueueReturns503(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	observability.Init(reg, true)
+	t.Cleanup(func() { observability.Init(nil, false) })
+
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[]}`)
+	}))
+	defer srv.Close()
+	defer close(release)
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+
+	cfg := config.FromEnv()
+	cfg.Scenario = "cache"
+	cfg.RedisAddr = mr.Addr()
+	cfg.GeoServerURL = srv.URL
+	cfg.H3Res, cfg.H3ResMin, cfg.H3ResMax = 8, 8, 8
+	cfg.AdaptiveEnabled = false
+	// one worker and no buffer: the first cell occupies the pool, the next
+	// can't be queued
+	cfg.CacheFillPoolWorkers = 1
+	cfg.CacheFillQueue = 0
+	cfg.CacheFillQueueWait = 20 * time.Millisecond
+	e, err := newCacheWithBackend(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, cachev2.Open)
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+
+	bb := model.BBox{X1: 18.00, Y1: 59.32, X2: 18.02, Y2: 59.34, SRID: "EPSG:4326"}
+	req := httptest.NewRequest(http.MethodGet, "/query", nil)
+	rr := httptest.NewRecorder()
+	start := time.Now()
+	e.HandleQuery(req.Context(), rr, req, model.QueryRequest{Layer: "demo:NR_polygon", BBox: &bb})
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status=%d body=%q, want 503", rr.Code, rr.Body.String())
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("request blocked %v on a saturated queue", d)
+	}
+	if ra := rr.Header().Get("Retry-After"); ra != "1" {
+		t.Fatalf("Retry-After=%q want 1", ra)
+	}
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	var rejects float64
+	for _, mf := range mfs {
+		if mf.GetName() == "spatial_fill_queue_rejects_total" {
+			rejects = mf.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	if rejects != 1 {
+		t.Fatalf("spatial_fill_queue_rejects_total=%v want 1", rejects)
+	}
+}
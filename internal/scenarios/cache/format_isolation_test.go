@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+
+	cachev2 "github.com/mohammed-shakir/h3-spatial-cache/internal/cache/v2"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/executor"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/httpclient"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/ogc"
+)
+
+const gmlBody = `<wfs:FeatureCollection xmlns:wfs="http://www.opengis.net/wfs/2.0"/>`
+
+func TestCache_FormatIsolation(t *testing.T) {
+	// gml is what the upstream answers with when asked for something other
+	// than JSON, or always once it is flipped to misbehave
+	var misbehave atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if misbehave.Load() || r.URL.Query().Get("outputFormat") != "application/json" {
+			w.Header().Set("Content-Type", "application/gml+xml; version=3.2")
+			_, _ = io.WriteString(w, gmlBody)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[{"type":"Feature","id":"f1","geometry":{"type":"Point","coordinates":[18.075,59.332]},"properties":{}}]}`)
+	}))
+	defer srv.Close()
+
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+
+	cfg := config.FromEnv()
+	cfg.Scenario = "cache"
+	cfg.RedisAddr = mr.Addr()
+	cfg.GeoServerURL = strings.TrimRight(srv.URL, "/")
+	cfg.H3Res, cfg.H3ResMin, cfg.H3ResMax = 8, 8, 8
+	cfg.AdaptiveEnabled = false
+	cfg.Features.GMLStreaming = true
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	exec, err := executor.New(logger, httpclient.NewOutbound(), ogc.OWSEndpoint(cfg.GeoServerURL))
+	if err != nil {
+		t.Fatalf("executor: %v", err)
+	}
+	e, err := newCacheWithBackend(cfg, logger, exec, cachev2.Open)
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	q := model.QueryRequest{
+		Layer: "demo:NR_polygon",
+		BBox:  &model.BBox{X1: 18.07, Y1: 59.33, X2: 18.08, Y2: 59.335, SRID: "EPSG:4326"},
+	}
+	serve := func(accept string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/query", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rr := httptest.NewRecorder()
+		e.HandleQuery(req.Context(), rr, req, q)
+		return rr
+	}
+	const gml = "application/gml+xml; version=3.2"
+
+	rr := serve("application/geo+json")
+	if rr.Code != http.StatusOK || rr.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("geojson fill: status=%d X-Cache=%q", rr.Code, rr.Header().Get("X-Cache"))
+	}
+	if !slices.Contains(rr.Header().Values("Vary"), "Accept") {
+		t.Fatalf("geojson response Vary=%v, want Accept", rr.Header().Values("Vary"))
+	}
+
+	// the cells are warm, yet GML is never composed from them
+	rr = serve(gml)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("gml status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	if got := rr.Header().Get("Content-Type"); !strings.HasPrefix(got, "application/gml+xml") {
+		t.Fatalf("gml Content-Type=%q", got)
+	}
+	if got := rr.Header().Get("X-Cache"); got != "BYPASS" {
+		t.Fatalf("gml X-Cache=%q want BYPASS", got)
+	}
+	if rr.Body.String() != gmlBody {
+		t.Fatalf("gml body=%q, want the upstream GML", rr.Body.String())
+	}
+
+	rr = serve("")
+	if rr.Header().Get("X-Cache") != "HIT" || !strings.HasPrefix(strings.TrimSpace(rr.Body.String()), "{") {
+		t.Fatalf("geojson after gml: X-Cache=%q body=%q", rr.Header().Get("X-Cache"), rr.Body.String())
+	}
+
+	// an upstream answering a fill in GML leaves nothing cached
+	mr.FlushAll()
+	misbehave.Store(true)
+	if rr = serve(""); rr.Code == http.StatusOK && rr.Header().Get("X-Cache") == "HIT" {
+		t.Fatalf("gml fill served as a hit")
+	}
+	if ks := mr.Keys(); len(ks) != 0 {
+		t.Fatalf("gml fill cached %v", ks)
+	}
+}
@@ -0,0 +1,88 @@
+package cache_test
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/executor"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/httpclient"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/ogc"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/router"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/scenarios"
+)
+
+const kmlDoc = `<?xml version="1.0"?><kml xmlns="http://www.opengis.net/kml/2.2"><Document/></kml>`
+
+func TestCache_OutputFormatPassthrough_KML(t *testing.T) {
+	var gotFormat string
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotFormat = r.URL.Query().Get("outputFormat")
+		w.Header().Set("Content-Type", "application/vnd.google-earth.kml+xml")
+		_, _ = io.WriteString(w, kmlDoc)
+	}))
+	defer up.Close()
+
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+
+	cfg := config.FromEnv()
+	cfg.Scenario = "cache"
+	cfg.RedisAddr = mr.Addr()
+	cfg.GeoServerURL = strings.TrimRight(up.URL, "/")
+	cfg.AdaptiveEnabled = false
+	cfg.PassthroughFormats = []string{"KML"}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	exec, err := executor.New(logger, httpclient.NewOutbound(), ogc.OWSEndpoint(cfg.GeoServerURL))
+	if err != nil {
+		t.Fatalf("executor: %v", err)
+	}
+	h, err := scenarios.New("cache", cfg, logger, exec)
+	if err != nil {
+		t.Fatalf("scenario: %v", err)
+	}
+	handler := router.HandleQuery(logger, cfg, h)
+
+	serve := func(format string) *httptest.ResponseRecorder {
+		qv := url.Values{}
+		qv.Set("layer", "demo:NR_polygon")
+		qv.Set("bbox", "18.00,59.32,18.02,59.34,EPSG:4326")
+		qv.Set("outputFormat", format)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/query?"+qv.Encode(), nil))
+		return rr
+	}
+
+	rr := serve("kml")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	if rr.Body.String() != kmlDoc {
+		t.Fatalf("body not forwarded verbatim: %q", rr.Body.String())
+	}
+	if got := rr.Header().Get("X-Cache"); got != "BYPASS" {
+		t.Fatalf("X-Cache=%q want BYPASS", got)
+	}
+	if gotFormat != "kml" {
+		t.Fatalf("upstream outputFormat=%q want kml", gotFormat)
+	}
+	if len(mr.Keys()) != 0 {
+		t.Fatalf("passthrough must not touch the cache; keys=%v", mr.Keys())
+	}
+
+	gotFormat = ""
+	if rr := serve("SHAPE-ZIP"); rr.Code != http.StatusNotAcceptable {
+		t.Fatalf("format outside allowlist: status=%d want 406", rr.Code)
+	}
+	if gotFormat != "" {
+		t.Fatalf("rejected format must not reach upstream")
+	}
+}
@@ -2,9 +2,11 @@ package cache
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"sync"
@@ -14,26 +16,14 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/aggregate/geojsonagg"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/keys"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/composer"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/problem"
 	h3mapper "github.com/mohammed-shakir/h3-spatial-cache/internal/mapper/h3"
 )
 
-type fakeStore struct{ m map[string][]byte }
-
-func (f fakeStore) MGet(keyList []string) (map[string][]byte, error) {
-	out := map[string][]byte{}
-	for _, k := range keyList {
-		if v, ok := f.m[k]; ok {
-			out[k] = v
-		}
-	}
-	return out, nil
-}
-func (f fakeStore) Set(string, []byte, time.Duration) error { return nil }
-func (f fakeStore) Del(...string) error                     { return nil }
-
 type fakeFeatureStore struct {
 	mu sync.Mutex
 	m  map[string]map[string][]byte
@@ -161,8 +151,6 @@ func newEngineForTest() *Engine {
 		mapr:   h3mapper.New(),
 		eng:    composer.Engine{V2: composer.NewGeoJSONV2Adapter(geojsonagg.NewAdvanced())},
 
-		store: fakeStore{m: map[string][]byte{}},
-
 		fs:  &fakeFeatureStore{},
 		idx: &fakeCellIndex{},
 
@@ -288,9 +276,7 @@ func TestServeOnlyIfFresh_GatingAndMetrics(t *testing.T) {
 		if rr.Code != 412 {
 			t.Fatalf("want 412, got %d body=%q", rr.Code, rr.Body.String())
 		}
-		if got := rr.Body.String(); got != "fresh content required" {
-			t.Fatalf("stable body mismatch, got %q", got)
-		}
+		assertFreshProblem(t, rr)
 		if v := gatherCounter(reg, "stale"); v < 1 {
 			t.Fatalf("expected stale reject counter to increment, got %v", v)
 		}
@@ -333,9 +319,7 @@ func TestServeOnlyIfFresh_GatingAndMetrics(t *testing.T) {
 		if rr.Code != 412 {
 			t.Fatalf("want 412, got %d", rr.Code)
 		}
-		if got := rr.Body.String(); got != "fresh content required" {
-			t.Fatalf("stable body mismatch, got %q", got)
-		}
+		assertFreshProblem(t, rr)
 		after := gatherCounter(reg, "miss")
 		if after-before < 1 {
 			t.Fatalf("expected miss reject counter to increment, got delta=%v (before=%v after=%v)", after-before, before, after)
@@ -409,3 +393,71 @@ func (f *fakeCellIndex) DelCells(
 	}
 	return nil
 }
+
+func TestServeOnlyIfFresh_StaleGraceWindow(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	observability.Init(reg, true)
+	observability.SetScenario("cache")
+
+	const featureTemplate = `{"type":"Feature","id":"%s","geometry":null,"properties":{"name":"%s"}}`
+	q := model.QueryRequest{
+		Layer: "ns:grace",
+		BBox:  &model.BBox{X1: 0, Y1: 0, X2: 0.01, Y2: 0.01, SRID: "EPSG:4326"},
+	}
+	// whole second, since layer invalidation times are kept at second precision
+	inv := time.Unix(time.Now().Unix()+60, 0)
+
+	serve := func(grace time.Duration) int {
+		e := newEngineForTest()
+		e.staleGrace = grace
+
+		cells, err := e.cellsForRes(q, e.res)
+		if err != nil || len(cells) == 0 {
+			t.Fatalf("cells: %v len=%d", err, len(cells))
+		}
+		ctx := context.Background()
+		for i, c := range cells {
+			id := "id-" + fmt.Sprint(i)
+			if err := e.fs.PutFeatures(ctx, q.Layer, map[string][]byte{id: fmt.Appendf(nil, featureTemplate, id, id)}, time.Minute); err != nil {
+				t.Fatalf("seed feature store: %v", err)
+			}
+			if err := e.setIDs(ctx, q, e.res, c, []string{id}, time.Minute); err != nil {
+				t.Fatalf("seed cell index: %v", err)
+			}
+			k := keys.CellIndexKey(q.Layer, e.res, c, model.Filters(q.Filters))
+			if _, ok := e.filledAt.Load(k); !ok {
+				t.Fatalf("setIDs did not record a fill time for %s", k)
+			}
+			// filled marginally before the invalidation, as with a skewed producer clock
+			e.filledAt.Store(k, inv.Add(-300*time.Millisecond))
+		}
+		observability.SetLayerInvalidatedAt(q.Layer, inv)
+
+		rr := httptest.NewRecorder()
+		e.HandleQuery(ctx, rr, httptest.NewRequest("GET", "/query", nil), q)
+		return rr.Code
+	}
+
+	if code := serve(time.Second); code != 200 {
+		t.Fatalf("fill within grace: want 200, got %d", code)
+	}
+	if code := serve(0); code != 412 {
+		t.Fatalf("fill before invalidation without grace: want 412, got %d", code)
+	}
+}
+
+// assertFreshProblem checks a serve-only-if-fresh rejection is a problem
+// document with a stable detail
+func assertFreshProblem(t *testing.T, rr *httptest.ResponseRecorder) {
+	t.Helper()
+	if ct := rr.Header().Get("Content-Type"); ct != problem.ContentType {
+		t.Fatalf("Content-Type=%q want %q", ct, problem.ContentType)
+	}
+	var p problem.Details
+	if err := json.Unmarshal(rr.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode problem: %v body=%q", err, rr.Body.String())
+	}
+	if p.Status != http.StatusPreconditionFailed || p.Detail != "fresh content required" {
+		t.Fatalf("problem=%+v want 412 with a stable detail", p)
+	}
+}
@@ -0,0 +1,81 @@
+package cache_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/scenarios"
+)
+
+func TestCache_IDPropertyFallback(t *testing.T) {
+	// every cell returns the same gid with a slightly different geometry
+	var n int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		x := 18.0 + float64(atomic.AddInt64(&n, 1))/1000
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"type":"FeatureCollection","features":[{"type":"Feature","geometry":{"type":"Point","coordinates":[%g,59.33]},"properties":{"gid":42}}]}`, x)
+	}))
+	defer srv.Close()
+
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+
+	cfg := config.FromEnv()
+	cfg.Scenario = "cache"
+	cfg.RedisAddr = mr.Addr()
+	cfg.GeoServerURL = strings.TrimRight(srv.URL, "/")
+	cfg.AdaptiveEnabled = false
+	cfg.IDProperties = map[string]string{"NR_polygon": "gid"}
+
+	h, err := scenarios.New("cache", cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), nil)
+	if err != nil {
+		t.Fatalf("scenario: %v", err)
+	}
+
+	bb := model.BBox{X1: 18.00, Y1: 59.32, X2: 18.02, Y2: 59.34, SRID: "EPSG:4326"}
+	serve := func() []json.RawMessage {
+		req := httptest.NewRequest(http.MethodGet, "/query", nil)
+		rr := httptest.NewRecorder()
+		h.HandleQuery(req.Context(), rr, req, model.QueryRequest{Layer: "demo:NR_polygon", BBox: &bb})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status=%d body=%q", rr.Code, rr.Body.String())
+		}
+		var fc struct {
+			Features []json.RawMessage `json:"features"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &fc); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return fc.Features
+	}
+
+	if feats := serve(); len(feats) != 1 {
+		t.Fatalf("miss: want 1 feature deduped by gid, got %d", len(feats))
+	}
+	if atomic.LoadInt64(&n) < 2 {
+		t.Fatalf("test needs several cells, upstream saw %d", n)
+	}
+	if !mr.Exists("feat:demo:NR_polygon:n:42") {
+		t.Fatalf("expected feature stored under gid, keys=%v", mr.Keys())
+	}
+	for _, k := range mr.Keys() {
+		if strings.Contains(k, "gh:") {
+			t.Fatalf("unexpected geometry-hash key %s", k)
+		}
+	}
+
+	if feats := serve(); len(feats) != 1 {
+		t.Fatalf("hit: want 1 feature, got %d", len(feats))
+	}
+}
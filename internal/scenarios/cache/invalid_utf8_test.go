@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+
+	cachev2 "github.com/mohammed-shakir/h3-spatial-cache/internal/cache/v2"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+)
+
+func TestCache_InvalidUTF8FeatureIsRepaired(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// "name" holds a lone 0xff byte, which is never valid UTF-8
+		_, _ = io.WriteString(w, "{\"type\":\"FeatureCollection\",\"features\":["+
+			"{\"type\":\"Feature\",\"id\":\"f1\",\"geometry\":{\"type\":\"Point\",\"coordinates\":[18.075,59.332]},\"properties\":{\"name\":\"G\xffteborg\"}},"+
+			"{\"type\":\"Feature\",\"id\":\"f2\",\"geometry\":{\"type\":\"Point\",\"coordinates\":[18.076,59.333]},\"properties\":{\"name\":\"Uppsala\"}}]}")
+	}))
+	defer srv.Close()
+
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+
+	cfg := config.FromEnv()
+	cfg.Scenario = "cache"
+	cfg.RedisAddr = mr.Addr()
+	cfg.GeoServerURL = strings.TrimRight(srv.URL, "/")
+	cfg.H3Res, cfg.H3ResMin, cfg.H3ResMax = 8, 8, 8
+	cfg.AdaptiveEnabled = false
+
+	e, err := newCacheWithBackend(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, cachev2.Open)
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	q := model.QueryRequest{
+		Layer: "demo:NR_polygon",
+		BBox:  &model.BBox{X1: 18.07, Y1: 59.33, X2: 18.08, Y2: 59.335, SRID: "EPSG:4326"},
+	}
+
+	for _, want := range []string{"MISS", "HIT"} {
+		req := httptest.NewRequest(http.MethodGet, "/query", nil)
+		rr := httptest.NewRecorder()
+		e.HandleQuery(req.Context(), rr, req, q)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status=%d body=%q", rr.Code, rr.Body.String())
+		}
+		if xc := rr.Header().Get("X-Cache"); xc != want {
+			t.Fatalf("X-Cache=%q want %s", xc, want)
+		}
+		body := rr.Body.Bytes()
+		if !utf8.Valid(body) {
+			t.Fatalf("%s response is not valid UTF-8: %q", want, body)
+		}
+		var fc struct {
+			Features []struct {
+				Properties struct {
+					Name string `json:"name"`
+				} `json:"properties"`
+			} `json:"features"`
+		}
+		if err := json.Unmarshal(body, &fc); err != nil {
+			t.Fatalf("%s response: %v", want, err)
+		}
+		if len(fc.Features) != 2 {
+			t.Fatalf("%s served %d features, want both", want, len(fc.Features))
+		}
+		names := fc.Features[0].Properties.Name + "," + fc.Features[1].Properties.Name
+		if !strings.Contains(names, "G�teborg") {
+			t.Fatalf("%s names=%q want the bad byte replaced", want, names)
+		}
+	}
+
+	for _, k := range mr.Keys() {
+		if v, err := mr.Get(k); err == nil && !utf8.ValidString(v) {
+			t.Fatalf("cached %s holds invalid UTF-8", k)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"golang.org/x/sync/semaphore"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/router"
+)
+
+// upstreamLimiter caps in-flight upstream calls across every request the
+// engine serves; CacheFillMaxWorkers only bounds a single request's fan-out.
+// A nil limiter never blocks
+type upstreamLimiter struct {
+	sem   *semaphore.Weighted
+	size  int64
+	inUse atomic.Int64
+}
+
+func newUpstreamLimiter(n int) *upstreamLimiter {
+	if n <= 0 {
+		return nil
+	}
+	return &upstreamLimiter{sem: semaphore.NewWeighted(int64(n)), size: int64(n)}
+}
+
+// ShareUpstreamLimit makes e draw upstream slots from other's limiter, so a
+// shadow engine stays within the primary's UPSTREAM_MAX_CONCURRENCY instead of
+// adding its own, and both report one saturation gauge. It must be called
+// before e serves; it reports false when other isn't a cache engine
+func (e *Engine) ShareUpstreamLimit(other router.QueryHandler) bool {
+	o, ok := other.(*Engine)
+	if !ok || e == nil || o == nil {
+		return false
+	}
+	e.upstream = o.upstream
+	return true
+}
+
+func (l *upstreamLimiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	if !l.sem.TryAcquire(1) {
+		observability.IncUpstreamSemaphoreWait()
+		if err := l.sem.Acquire(ctx, 1); err != nil {
+			return fmt.Errorf("upstream limiter: %w", err)
+		}
+	}
+	observability.SetUpstreamSaturation(float64(l.inUse.Add(1)) / float64(l.size))
+	return nil
+}
+
+func (l *upstreamLimiter) release() {
+	if l == nil {
+		return
+	}
+	observability.SetUpstreamSaturation(float64(l.inUse.Add(-1)) / float64(l.size))
+	l.sem.Release(1)
+}
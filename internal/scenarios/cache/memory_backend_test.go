@@ -0,0 +1,70 @@
+package cache_test
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/scenarios"
+)
+
+func TestCache_MemoryBackend_MissThenHit(t *testing.T) {
+	gs := &gsDouble{}
+	srv := httptest.NewServer(http.HandlerFunc(gs.handler))
+	defer srv.Close()
+
+	cfg := config.FromEnv()
+	cfg.Scenario = "cache"
+	cfg.CacheBackend = "memory"
+	cfg.RedisAddr = "127.0.0.1:1" // must not be dialed
+	cfg.GeoServerURL = strings.TrimRight(srv.URL, "/")
+	cfg.CacheTTLDefault = 30 * time.Second
+	cfg.AdaptiveEnabled = false
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h, err := scenarios.New("cache", cfg, logger, nil)
+	if err != nil {
+		t.Fatalf("scenario: %v", err)
+	}
+
+	bb := model.BBox{X1: 18.00, Y1: 59.32, X2: 18.02, Y2: 59.34, SRID: "EPSG:4326"}
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/query", nil)
+		rr := httptest.NewRecorder()
+		h.HandleQuery(req.Context(), rr, req, model.QueryRequest{Layer: "demo:NR_polygon", BBox: &bb})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status=%d body=%q", rr.Code, rr.Body.String())
+		}
+		return rr
+	}
+
+	if rr := serve(); rr.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("first request X-Cache=%q want MISS", rr.Header().Get("X-Cache"))
+	}
+	calls := atomic.LoadInt64(&gs.calls)
+	if calls == 0 {
+		t.Fatalf("expected upstream calls on miss")
+	}
+
+	if rr := serve(); rr.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("second request X-Cache=%q want HIT", rr.Header().Get("X-Cache"))
+	}
+	if got := atomic.LoadInt64(&gs.calls); got != calls {
+		t.Fatalf("expected no upstream calls on hit, %d -> %d", calls, got)
+	}
+}
+
+func TestCache_UnknownBackend_Errors(t *testing.T) {
+	cfg := config.FromEnv()
+	cfg.CacheBackend = "etcd"
+	if _, err := scenarios.New("cache", cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), nil); err == nil {
+		t.Fatalf("expected error for unknown backend")
+	}
+}
@@ -0,0 +1,83 @@
+package cache_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/scenarios"
+)
+
+func TestCache_MaxFeaturesReportsUpstreamNumberMatched(t *testing.T) {
+	// every cell returns one distinct feature but claims 10 matched
+	var n int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		i := atomic.AddInt64(&n, 1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"type":"FeatureCollection","numberMatched":10,"numberReturned":1,"features":[{"type":"Feature","id":"f%d","geometry":{"type":"Point","coordinates":[%g,59.33]},"properties":{}}]}`, i, 18.0+float64(i)/1000)
+	}))
+	defer srv.Close()
+
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+
+	cfg := config.FromEnv()
+	cfg.Scenario = "cache"
+	cfg.RedisAddr = mr.Addr()
+	cfg.GeoServerURL = strings.TrimRight(srv.URL, "/")
+	cfg.AdaptiveEnabled = false
+	cfg.MaxFeatures = 1
+
+	h, err := scenarios.New("cache", cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), nil)
+	if err != nil {
+		t.Fatalf("scenario: %v", err)
+	}
+
+	bb := model.BBox{X1: 18.00, Y1: 59.32, X2: 18.02, Y2: 59.34, SRID: "EPSG:4326"}
+	type counts struct {
+		Features       []json.RawMessage `json:"features"`
+		NumberMatched  int               `json:"numberMatched"`
+		NumberReturned int               `json:"numberReturned"`
+	}
+	serve := func() counts {
+		req := httptest.NewRequest(http.MethodGet, "/query", nil)
+		rr := httptest.NewRecorder()
+		h.HandleQuery(req.Context(), rr, req, model.QueryRequest{Layer: "demo:places", BBox: &bb})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status=%d body=%q", rr.Code, rr.Body.String())
+		}
+		var c counts
+		if err := json.Unmarshal(rr.Body.Bytes(), &c); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return c
+	}
+
+	miss := serve()
+	cells := int(atomic.LoadInt64(&n))
+	if cells < 2 {
+		t.Fatalf("test needs several cells, upstream saw %d", cells)
+	}
+	if len(miss.Features) != 1 || miss.NumberReturned != 1 {
+		t.Fatalf("miss: want 1 feature returned, got %d (numberReturned=%d)", len(miss.Features), miss.NumberReturned)
+	}
+	if want := 10 * cells; miss.NumberMatched != want {
+		t.Fatalf("miss: numberMatched=%d want %d from upstream counts", miss.NumberMatched, want)
+	}
+
+	// cached cells no longer carry the upstream count, so the merge counts
+	hit := serve()
+	if hit.NumberMatched != cells || len(hit.Features) != 1 {
+		t.Fatalf("hit: numberMatched=%d features=%d want %d and 1", hit.NumberMatched, len(hit.Features), cells)
+	}
+}
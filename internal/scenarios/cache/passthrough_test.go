@@ -0,0 +1,107 @@
+package cache_test
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/keys"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/router"
+	h3mapper "github.com/mohammed-shakir/h3-spatial-cache/internal/mapper/h3"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/scenarios"
+)
+
+func TestCache_AcceptLanguage_ForwardedAndScopesKeys(t *testing.T) {
+	var mu sync.Mutex
+	seen := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lang := r.Header.Get("Accept-Language")
+		mu.Lock()
+		seen[lang]++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[{"type":"Feature","id":"f1","geometry":null,"properties":{"name":"`+lang+`"}}]}`)
+	}))
+	defer srv.Close()
+
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+
+	cfg := config.FromEnv()
+	cfg.Scenario = "cache"
+	cfg.RedisAddr = mr.Addr()
+	cfg.GeoServerURL = strings.TrimRight(srv.URL, "/")
+	cfg.CacheTTLDefault = 30 * time.Second
+	cfg.AdaptiveEnabled = false
+	cfg.PassthroughHeaders = []string{"Accept-Language"}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h, err := scenarios.New("cache", cfg, logger, nil)
+	if err != nil {
+		t.Fatalf("scenario: %v", err)
+	}
+	handler := router.HandleQuery(logger, cfg, h)
+
+	bb := model.BBox{X1: 18.00, Y1: 59.32, X2: 18.02, Y2: 59.34, SRID: "EPSG:4326"}
+	cells, err := h3mapper.New().CellsForBBox(bb, cfg.H3Res)
+	if err != nil || len(cells) == 0 {
+		t.Fatalf("h3 mapping: %v", err)
+	}
+
+	query := func(lang string) string {
+		qv := url.Values{}
+		qv.Set("layer", "demo:NR_polygon")
+		qv.Set("bbox", bb.String())
+		req := httptest.NewRequest(http.MethodGet, "/query?"+qv.Encode(), nil)
+		req.Header.Set("Accept-Language", lang)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("lang=%s status=%d body=%q", lang, rr.Code, rr.Body.String())
+		}
+		return rr.Body.String()
+	}
+
+	svBody := query("sv")
+	enBody := query("en")
+	if !strings.Contains(svBody, `"name":"sv"`) || !strings.Contains(enBody, `"name":"en"`) {
+		t.Fatalf("localized bodies collided:\nsv=%s\nen=%s", svBody, enBody)
+	}
+
+	mu.Lock()
+	svCalls, enCalls := seen["sv"], seen["en"]
+	mu.Unlock()
+	if svCalls == 0 || enCalls == 0 || len(seen) != 2 {
+		t.Fatalf("expected both languages forwarded upstream, saw %v", seen)
+	}
+
+	svLayer := keys.ScopedLayer("demo:NR_polygon", map[string]string{"Accept-Language": "sv"})
+	enLayer := keys.ScopedLayer("demo:NR_polygon", map[string]string{"Accept-Language": "en"})
+	svKey := keys.CellIndexKey(svLayer, cfg.H3Res, cells[0], "")
+	enKey := keys.CellIndexKey(enLayer, cfg.H3Res, cells[0], "")
+	if svKey == enKey {
+		t.Fatalf("expected distinct cache keys, both %s", svKey)
+	}
+	if !mr.Exists(svKey) || !mr.Exists(enKey) {
+		t.Fatalf("expected index keys %s and %s; have %v", svKey, enKey, mr.Keys())
+	}
+
+	if body := query("sv"); !strings.Contains(body, `"name":"sv"`) {
+		t.Fatalf("cached sv body lost localization: %s", body)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if seen["sv"] != svCalls {
+		t.Fatalf("expected repeat sv query to be served from cache, upstream calls %d -> %d", svCalls, seen["sv"])
+	}
+}
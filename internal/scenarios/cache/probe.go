@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/cellindex"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/keys"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/composer"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/admin"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/problem"
+)
+
+// ProbeQuery reports how warm q's cells are at the base (or requested) res:
+// X-Cache carries the hit class, and the status is 200 only when every cell is
+// indexed, 204 otherwise. Nothing is fetched upstream, filled or composed
+func (e *Engine) ProbeQuery(ctx context.Context, w http.ResponseWriter, r *http.Request, q model.QueryRequest) {
+	res := e.baseRes(q.Layer)
+	if q.H3Res > 0 {
+		res = q.H3Res
+	}
+	cells, err := e.cellsForRes(q, res)
+	if err != nil {
+		problem.Error(w, r, "failed to map query footprint", http.StatusBadRequest)
+		return
+	}
+	if len(cells) == 0 {
+		w.Header().Set(composer.HeaderXCache, composer.XCacheBypassTiny)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	hits := 0
+	if e.idx != nil {
+		mgetCtx, cancel := withTimeout(ctx, e.readTimeout())
+		idsByCell, err := e.idx.MGetIDs(mgetCtx, keys.ScopedLayer(q.Layer, q.Headers), res, cells, model.Filters(q.Filters))
+		cancel()
+		if err != nil {
+			e.logger.Warn("probe: cell index mget error, reporting miss",
+				"layer", q.Layer,
+				"res", res,
+				"cells", len(cells),
+				"err", err,
+			)
+		}
+		for _, c := range cells {
+			if len(idsByCell[c]) > 0 {
+				hits++
+			}
+		}
+	}
+
+	hc := composer.HitClassMiss
+	status := http.StatusNoContent
+	switch {
+	case hits == len(cells):
+		hc = composer.HitClassFull
+		status = http.StatusOK
+	case hits > 0:
+		hc = composer.HitClassPartial
+	}
+	w.Header().Set(composer.HeaderXCache, composer.XCacheValue(hc))
+	w.WriteHeader(status)
+}
+
+var _ admin.CellInspector = (*Engine)(nil)
+
+// InspectCell looks up cell's index entry at q.H3Res for q's layer and
+// filters. Nothing is fetched or filled
+func (e *Engine) InspectCell(ctx context.Context, q model.QueryRequest, cell string) (admin.CellInfo, error) {
+	in, ok := e.idx.(cellindex.Inspector)
+	if !ok {
+		return admin.CellInfo{}, errors.New("cell index cannot inspect single entries")
+	}
+	ctx, cancel := withTimeout(ctx, e.readTimeout())
+	defer cancel()
+	ids, ttl, err := in.Inspect(ctx, keys.ScopedLayer(q.Layer, q.Headers), q.H3Res, cell, model.Filters(q.Filters))
+	if err != nil {
+		return admin.CellInfo{}, fmt.Errorf("inspect cell: %w", err)
+	}
+	if len(ids) == 0 {
+		return admin.CellInfo{}, nil
+	}
+	info := admin.CellInfo{Cached: true, TTL: ttl}
+	if len(ids) == 1 && ids[0] == cellindex.EmptyMarkerID {
+		info.Empty = true
+	} else {
+		info.Features = len(ids)
+	}
+	return info, nil
+}
@@ -0,0 +1,116 @@
+package cache_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/redisstore"
+	cachev2 "github.com/mohammed-shakir/h3-spatial-cache/internal/cache/v2"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/executor"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/httpclient"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/ogc"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/router"
+	h3mapper "github.com/mohammed-shakir/h3-spatial-cache/internal/mapper/h3"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/scenarios"
+)
+
+func TestCache_Probe_ReportsHitClassWithoutUpstream(t *testing.T) {
+	ctx := context.Background()
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[]}`)
+	}))
+	defer srv.Close()
+
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+
+	cfg := config.FromEnv()
+	cfg.Scenario = "cache"
+	cfg.RedisAddr = mr.Addr()
+	cfg.GeoServerURL = strings.TrimRight(srv.URL, "/")
+	cfg.CacheTTLDefault = 30 * time.Second
+	cfg.AdaptiveEnabled = false
+
+	bb := model.BBox{X1: 18.00, Y1: 59.32, X2: 18.02, Y2: 59.34, SRID: "EPSG:4326"}
+	cells, err := h3mapper.New().CellsForBBox(bb, cfg.H3Res)
+	if err != nil || len(cells) == 0 {
+		t.Fatalf("h3 mapping: %v", err)
+	}
+
+	rc, err := redisstore.New(ctx, cfg.RedisAddr)
+	if err != nil {
+		t.Fatalf("redis client: %v", err)
+	}
+	v2store := cachev2.NewRedisStore(rc, cfg.CacheTTLDefault)
+	for i, c := range cells {
+		id := c + ":" + fmtInt(i)
+		feat := []byte(`{"type":"Feature","id":"` + id + `","geometry":null,"properties":{}}`)
+		if err := v2store.Features.PutFeatures(ctx, "demo:warm", map[string][]byte{id: feat}, cfg.CacheTTLDefault); err != nil {
+			t.Fatalf("seed feature store: %v", err)
+		}
+		if err := v2store.Cells.SetIDs(ctx, "demo:warm", cfg.H3Res, c, "", []string{id}, cfg.CacheTTLDefault); err != nil {
+			t.Fatalf("seed cell index: %v", err)
+		}
+	}
+	keysBefore := len(mr.Keys())
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	exec, err := executor.New(logger, httpclient.NewOutbound(), ogc.OWSEndpoint(cfg.GeoServerURL))
+	if err != nil {
+		t.Fatalf("executor: %v", err)
+	}
+	h, err := scenarios.New("cache", cfg, logger, exec)
+	if err != nil {
+		t.Fatalf("scenario: %v", err)
+	}
+	hdl := router.HandleQuery(logger, cfg, h)
+
+	probe := func(method, layer, extra string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/query?layer="+layer+"&bbox="+bb.String()+extra, nil)
+		rr := httptest.NewRecorder()
+		hdl(rr, req)
+		return rr
+	}
+
+	for _, tc := range []struct {
+		method, layer, extra string
+		status               int
+		xcache               string
+	}{
+		{http.MethodHead, "demo:warm", "", http.StatusOK, "HIT"},
+		{http.MethodGet, "demo:warm", "&probe=true", http.StatusOK, "HIT"},
+		{http.MethodHead, "demo:cold", "", http.StatusNoContent, "MISS"},
+		{http.MethodGet, "demo:cold", "&probe=1", http.StatusNoContent, "MISS"},
+	} {
+		rr := probe(tc.method, tc.layer, tc.extra)
+		if rr.Code != tc.status || rr.Header().Get("X-Cache") != tc.xcache {
+			t.Fatalf("%s %s%s: status=%d X-Cache=%q want %d %q",
+				tc.method, tc.layer, tc.extra, rr.Code, rr.Header().Get("X-Cache"), tc.status, tc.xcache)
+		}
+		if rr.Body.Len() != 0 {
+			t.Fatalf("%s %s: probe returned a body: %q", tc.method, tc.layer, rr.Body.String())
+		}
+	}
+
+	if n := calls.Load(); n != 0 {
+		t.Fatalf("probes made %d upstream calls, want 0", n)
+	}
+	if n := len(mr.Keys()); n != keysBefore {
+		t.Fatalf("probes wrote to the cache: keys %d -> %d", keysBefore, n)
+	}
+}
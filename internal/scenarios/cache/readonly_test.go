@@ -0,0 +1,74 @@
+package cache_test
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/executor"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/httpclient"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/ogc"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/scenarios"
+)
+
+func TestCache_ReadOnly_MissDoesNotWrite(t *testing.T) {
+	var calls int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[{"type":"Feature","id":"f1","geometry":null,"properties":{"ok":true}}]}`)
+	}))
+	defer srv.Close()
+
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+
+	cfg := config.FromEnv()
+	cfg.Scenario = "cache"
+	cfg.RedisAddr = mr.Addr()
+	cfg.GeoServerURL = strings.TrimRight(srv.URL, "/")
+	cfg.CacheReadOnly = true
+	cfg.AdaptiveEnabled = true
+	cfg.AdaptiveDryRun = false
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	exec, err := executor.New(logger, httpclient.NewOutbound(), ogc.OWSEndpoint(cfg.GeoServerURL))
+	if err != nil {
+		t.Fatalf("executor: %v", err)
+	}
+	h, err := scenarios.New("cache", cfg, logger, exec)
+	if err != nil {
+		t.Fatalf("scenario: %v", err)
+	}
+
+	bb := model.BBox{X1: 18.00, Y1: 59.32, X2: 18.02, Y2: 59.34, SRID: "EPSG:4326"}
+	for i := range 2 {
+		req := httptest.NewRequest(http.MethodGet, "/query", nil)
+		rr := httptest.NewRecorder()
+		h.HandleQuery(req.Context(), rr, req, model.QueryRequest{Layer: "demo:NR_polygon", BBox: &bb})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("request %d: status=%d body=%q", i, rr.Code, rr.Body.String())
+		}
+		if got := rr.Header().Get("X-Cache"); got != "MISS-READONLY" {
+			t.Fatalf("request %d: X-Cache=%q want MISS-READONLY", i, got)
+		}
+		if !strings.Contains(rr.Body.String(), "FeatureCollection") {
+			t.Fatalf("request %d: expected composed FeatureCollection, got %q", i, rr.Body.String())
+		}
+	}
+
+	if got := atomic.LoadInt64(&calls); got != 2 {
+		t.Fatalf("expected one upstream call per request, got %d", got)
+	}
+	if ks := mr.Keys(); len(ks) != 0 {
+		t.Fatalf("read-only mode wrote %d keys: %v", len(ks), ks)
+	}
+}
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	mylog "github.com/mohammed-shakir/h3-spatial-cache/internal/logger"
+)
+
+func TestRequestLog_SlowAlwaysFastSampled(t *testing.T) {
+	q := model.QueryRequest{
+		Layer: "ns:logs",
+		BBox:  &model.BBox{X1: 0, Y1: 0, X2: 0.01, Y2: 0.01, SRID: "EPSG:4326"},
+	}
+	newEngine := func(buf *bytes.Buffer, rs *mylog.RequestSampler) *Engine {
+		e := newEngineForTest()
+		e.serveFreshOnly = false
+		e.logger = slog.New(slog.NewTextHandler(buf, nil))
+		e.reqLog = rs
+
+		cells, err := e.cellsForRes(q, e.res)
+		if err != nil || len(cells) == 0 {
+			t.Fatalf("cells: %v len=%d", err, len(cells))
+		}
+		ctx := context.Background()
+		for i, c := range cells {
+			id := fmt.Sprintf("id-%d", i)
+			feat := fmt.Appendf(nil, `{"type":"Feature","id":"%s","geometry":null,"properties":{}}`, id)
+			if err := e.fs.PutFeatures(ctx, q.Layer, map[string][]byte{id: feat}, time.Minute); err != nil {
+				t.Fatalf("seed feature store: %v", err)
+			}
+			if err := e.setIDs(ctx, q, e.res, c, []string{id}, time.Minute); err != nil {
+				t.Fatalf("seed cell index: %v", err)
+			}
+		}
+		return e
+	}
+	serve := func(e *Engine) {
+		rr := httptest.NewRecorder()
+		e.HandleQuery(context.Background(), rr, httptest.NewRequest("GET", "/query", nil), q)
+		if rr.Code != 200 {
+			t.Fatalf("status=%d body=%q", rr.Code, rr.Body.String())
+		}
+	}
+	const msg = `msg="cache full-hit (feature-centric)"`
+
+	var slow bytes.Buffer
+	e := newEngine(&slow, mylog.NewRequestSampler(time.Nanosecond, 1000))
+	serve(e)
+	if !strings.Contains(slow.String(), "level=WARN "+msg) {
+		t.Fatalf("slow request not logged at warn:\n%s", slow.String())
+	}
+
+	var fast bytes.Buffer
+	e = newEngine(&fast, mylog.NewRequestSampler(time.Hour, 1000))
+	for range 3 {
+		serve(e)
+	}
+	if n := strings.Count(fast.String(), msg); n != 1 {
+		t.Fatalf("fast requests: %d logged, want 1 of 3 with 1-in-1000 sampling:\n%s", n, fast.String())
+	}
+	if strings.Contains(fast.String(), "level=WARN") {
+		t.Fatalf("fast request logged at warn:\n%s", fast.String())
+	}
+}
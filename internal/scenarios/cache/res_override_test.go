@@ -0,0 +1,82 @@
+package cache_test
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/executor"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/httpclient"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/ogc"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/scenarios"
+)
+
+func TestCache_ResOverride_UsesDistinctCellKeys(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[{"type":"Feature","id":"p1","geometry":{"type":"Point","coordinates":[18.07,59.33]},"properties":{}}]}`)
+	}))
+	defer srv.Close()
+
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+
+	cfg := config.FromEnv()
+	cfg.Scenario = "cache"
+	cfg.RedisAddr = mr.Addr()
+	cfg.GeoServerURL = strings.TrimRight(srv.URL, "/")
+	cfg.H3Res, cfg.H3ResMin, cfg.H3ResMax = 8, 7, 9
+	cfg.AdaptiveEnabled = false
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	exec, err := executor.New(logger, httpclient.NewOutbound(), ogc.OWSEndpoint(cfg.GeoServerURL))
+	if err != nil {
+		t.Fatalf("executor: %v", err)
+	}
+	h, err := scenarios.New("cache", cfg, logger, exec)
+	if err != nil {
+		t.Fatalf("scenario: %v", err)
+	}
+
+	bb := model.BBox{X1: 18.06, Y1: 59.32, X2: 18.08, Y2: 59.34, SRID: "EPSG:4326"}
+	serve := func(res int) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/query", nil)
+		rr := httptest.NewRecorder()
+		h.HandleQuery(req.Context(), rr, req, model.QueryRequest{Layer: "demo:places", BBox: &bb, H3Res: res})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("res=%d: status=%d body=%q", res, rr.Code, rr.Body.String())
+		}
+	}
+	idxAt := func(res int) int {
+		n := 0
+		for _, k := range mr.Keys() {
+			if strings.HasPrefix(k, fmt.Sprintf("idx:demo:places:%d:", res)) {
+				n++
+			}
+		}
+		return n
+	}
+
+	serve(0)
+	base := idxAt(8)
+	if base == 0 || idxAt(9) != 0 {
+		t.Fatalf("default request: res8 keys=%d res9 keys=%d", base, idxAt(9))
+	}
+
+	serve(9)
+	if idxAt(9) == 0 {
+		t.Fatalf("res=9 request wrote no res-9 cell keys: %v", mr.Keys())
+	}
+	if idxAt(8) != base {
+		t.Fatalf("res=9 request touched res-8 keys: before=%d after=%d", base, idxAt(8))
+	}
+}
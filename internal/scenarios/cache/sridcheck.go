@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	h3 "github.com/uber/h3-go/v4"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/ogc"
+)
+
+// emptyRuns counts, per layer, the cells fetched in a row that came back
+// empty. An INTERSECTS literal in a CRS the layer doesn't expect matches
+// nothing without any error, so a long enough run is worth a second look
+type emptyRuns struct {
+	limit int
+
+	mu   sync.Mutex
+	runs map[string]int
+}
+
+func newEmptyRuns(limit int) *emptyRuns {
+	if limit <= 0 {
+		return nil
+	}
+	return &emptyRuns{limit: limit, runs: map[string]int{}}
+}
+
+// observe records one fetched cell and reports whether it completed a run of
+// limit empty cells; the run starts over either way
+func (r *emptyRuns) observe(layer string, features int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if features > 0 {
+		delete(r.runs, layer)
+		return false
+	}
+	r.runs[layer]++
+	if r.runs[layer] < r.limit {
+		return false
+	}
+	delete(r.runs, layer)
+	return true
+}
+
+// checkEmptyRun probes the bbox of the cell closing a run of empty cells:
+// bbox filters carry their own CRS, so features there that INTERSECTS missed
+// point at a CQL SRID the layer doesn't match
+func (e *Engine) checkEmptyRun(ctx context.Context, q model.QueryRequest, cell string, features int) {
+	if e.emptyRuns == nil || !e.emptyRuns.observe(q.Layer, features) {
+		return
+	}
+	n, err := e.cellBBoxHits(ctx, q, cell)
+	if err != nil {
+		e.logger.Debug("srid check: bbox probe failed",
+			"layer", q.Layer,
+			"cell", cell,
+			"err", err,
+		)
+		return
+	}
+	if n == 0 {
+		return
+	}
+	observability.IncSRIDMismatchSuspected(q.Layer)
+	srid := q.CQLSRID
+	if srid == "" {
+		srid = ogc.DefaultCQLSRID
+	}
+	e.logger.Warn("srid check: cells come back empty but their bbox has features; check the layer's CRS or set CQL_SRID",
+		"layer", q.Layer,
+		"cell", cell,
+		"empty_cells", e.emptyRuns.limit,
+		"bbox_features", n,
+		"cql_srid", srid,
+	)
+}
+
+// cellBBoxHits counts the features of q's layer and filters in cell's
+// bounding box
+func (e *Engine) cellBBoxHits(ctx context.Context, q model.QueryRequest, cell string) (int, error) {
+	if e.http == nil || e.owsURL == nil {
+		return 0, errors.New("http client or owsURL not configured")
+	}
+	var c h3.Cell
+	if err := c.UnmarshalText([]byte(cell)); err != nil {
+		return 0, fmt.Errorf("parse cell: %w", err)
+	}
+	b, err := c.Boundary()
+	if err != nil || len(b) == 0 {
+		return 0, fmt.Errorf("cell %s boundary: %w", cell, err)
+	}
+	bb := model.BBox{X1: b[0].Lng, Y1: b[0].Lat, X2: b[0].Lng, Y2: b[0].Lat, SRID: "EPSG:4326"}
+	for _, ll := range b[1:] {
+		bb.X1, bb.X2 = min(bb.X1, ll.Lng), max(bb.X2, ll.Lng)
+		bb.Y1, bb.Y2 = min(bb.Y1, ll.Lat), max(bb.Y2, ll.Lat)
+	}
+	params := ogc.BuildGetFeatureParams(model.QueryRequest{Layer: q.Layer, BBox: &bb, Filters: q.Filters})
+	params.Set("resultType", "hits")
+	return e.upstreamHits(ctx, q, params)
+}
@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	h3 "github.com/uber/h3-go/v4"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
+)
+
+// crsUpstream matches nothing for INTERSECTS filters, as a layer stored in
+// another CRS would, and reports bboxFeatures for bbox hit counts
+type crsUpstream struct {
+	bboxFeatures int
+
+	mu     sync.Mutex
+	probes int
+}
+
+func (u *crsUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Query().Get("resultType") == "hits" && r.URL.Query().Get("bbox") != "" {
+		u.mu.Lock()
+		u.probes++
+		u.mu.Unlock()
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","numberMatched":`+strconv.Itoa(u.bboxFeatures)+`,"features":[]}`)
+		return
+	}
+	_, _ = io.WriteString(w, `{"type":"FeatureCollection","numberMatched":0,"features":[]}`)
+}
+
+func newSRIDCheckEngine(t *testing.T, up http.Handler, limit int, logs io.Writer) *Engine {
+	t.Helper()
+	srv := httptest.NewServer(up)
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	return &Engine{
+		logger:    slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelWarn})),
+		res:       7,
+		minRes:    7,
+		maxRes:    7,
+		owsURL:    u,
+		http:      srv.Client(),
+		opTimeout: 2 * time.Second,
+		emptyRuns: newEmptyRuns(limit),
+	}
+}
+
+// populatedCells is a run of neighbouring res-7 cells over a populated bbox
+func populatedCells(t *testing.T, n int) []string {
+	t.Helper()
+	c, err := h3.LatLngToCell(h3.NewLatLng(59.33, 18.06), 7)
+	if err != nil {
+		t.Fatalf("cell: %v", err)
+	}
+	disk, err := c.GridDisk(2)
+	if err != nil || len(disk) < n {
+		t.Fatalf("grid disk: %d cells, err=%v", len(disk), err)
+	}
+	out := make([]string, 0, n)
+	for _, d := range disk[:n] {
+		out = append(out, d.String())
+	}
+	return out
+}
+
+func TestFetchCell_EmptyCellsOverPopulatedBBoxWarnSRIDMismatch(t *testing.T) {
+	observability.Init(prometheus.NewRegistry(), true)
+	t.Cleanup(func() { observability.Init(nil, false) })
+
+	const limit = 4
+	up := &crsUpstream{bboxFeatures: 12}
+	var logs bytes.Buffer
+	e := newSRIDCheckEngine(t, up, limit, &logs)
+	q := model.QueryRequest{Layer: "demo:layer"}
+	metric := `spatial_srid_mismatch_suspected_total{layer="demo:layer"}`
+
+	cells := populatedCells(t, limit)
+	for i, cell := range cells {
+		r := e.fetchCell(context.Background(), q, cell, 7, time.Minute)
+		if r.err != nil || len(r.features) != 0 {
+			t.Fatalf("cell %s: err=%v features=%d", cell, r.err, len(r.features))
+		}
+		if i < limit-1 && observability.Snapshot()[metric] != 0 {
+			t.Fatalf("warning after %d empty cells, want it after %d", i+1, limit)
+		}
+	}
+
+	if got := observability.Snapshot()[metric]; got != 1 {
+		t.Fatalf("%s = %v, want 1", metric, got)
+	}
+	if up.probes != 1 {
+		t.Fatalf("bbox probes = %d, want 1", up.probes)
+	}
+	out := logs.String()
+	if !strings.Contains(out, "level=WARN") || !strings.Contains(out, "cql_srid=4326") || !strings.Contains(out, "layer=demo:layer") {
+		t.Fatalf("warning log missing or incomplete: %q", out)
+	}
+}
+
+func TestFetchCell_EmptyCellsOverEmptyBBoxStayQuiet(t *testing.T) {
+	observability.Init(prometheus.NewRegistry(), true)
+	t.Cleanup(func() { observability.Init(nil, false) })
+
+	const limit = 3
+	up := &crsUpstream{bboxFeatures: 0}
+	var logs bytes.Buffer
+	e := newSRIDCheckEngine(t, up, limit, &logs)
+	q := model.QueryRequest{Layer: "demo:layer"}
+
+	for _, cell := range populatedCells(t, 2*limit) {
+		if r := e.fetchCell(context.Background(), q, cell, 7, time.Minute); r.err != nil {
+			t.Fatalf("cell %s: %v", cell, r.err)
+		}
+	}
+
+	if got := observability.Snapshot()[`spatial_srid_mismatch_suspected_total{layer="demo:layer"}`]; got != 0 {
+		t.Fatalf("srid mismatch counted %v times for a genuinely empty region", got)
+	}
+	if up.probes != 2 {
+		t.Fatalf("bbox probes = %d, want one per run of %d", up.probes, limit)
+	}
+	if logs.Len() != 0 {
+		t.Fatalf("unexpected warnings: %q", logs.String())
+	}
+}
+
+func TestEmptyRuns_NonEmptyCellResetsRun(t *testing.T) {
+	r := newEmptyRuns(2)
+	if r.observe("a", 0) || r.observe("a", 3) || r.observe("a", 0) {
+		t.Fatal("run completed despite a non-empty cell in between")
+	}
+	if r.observe("b", 0) {
+		t.Fatal("layers share a run")
+	}
+	if !r.observe("a", 0) {
+		t.Fatal("two empty cells in a row did not complete the run")
+	}
+	if newEmptyRuns(0) != nil {
+		t.Fatal("limit 0 should disable the check")
+	}
+}
@@ -12,7 +12,6 @@ import (
 
 	miniredis "github.com/alicebob/miniredis/v2"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
@@ -32,9 +31,6 @@ func TestDetects_StaleHit_AfterInvalidationMarker(t *testing.T) {
 	observability.Init(reg, true)
 	observability.SetScenario("cache")
 
-	metricsSrv := httptest.NewServer(promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
-	defer metricsSrv.Close()
-
 	gs := &gsOK{}
 	srv := httptest.NewServer(http.HandlerFunc(gs.handler))
 	defer srv.Close()
@@ -81,23 +77,8 @@ func TestDetects_StaleHit_AfterInvalidationMarker(t *testing.T) {
 		t.Fatalf("second status=%d want 200", rr2.Code)
 	}
 
-	resp, err := metricsSrv.Client().Get(metricsSrv.URL)
-	if err != nil {
-		t.Fatalf("metrics scrape: %v", err)
-	}
-	t.Cleanup(func() {
-		if cerr := resp.Body.Close(); cerr != nil {
-			t.Fatalf("close body: %v", cerr)
-		}
-	})
-	b, err := io.ReadAll(resp.Body)
-	if err != nil {
-		t.Fatalf("read all: %v", err)
-	}
-	out := string(b)
-
-	exp := `spatial_reads_total{cache="hit",scenario="cache",stale="true"} 1`
-	if !strings.Contains(out, exp) {
-		t.Fatalf("expected %q in metrics; got:\n%s", exp, out)
+	key := `spatial_reads_total{cache="hit",scenario="cache",stale="true"}`
+	if got := observability.Snapshot()[key]; got != 1 {
+		t.Fatalf("%s=%v want 1", key, got)
 	}
 }
@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/admin"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
+)
+
+// keys SCANned per /admin/stats key-count estimate
+const statsKeySample = 1000
+
+var _ admin.StatsProvider = (*Engine)(nil)
+
+// per-request metrics go through these so shadow replays (see
+// observability.WithShadow) stay out of the primary's numbers
+
+func (e *Engine) addHits(ctx context.Context, n int) {
+	if !observability.IsShadow(ctx) {
+		observability.AddCacheHits(n)
+	}
+	if n > 0 {
+		e.hits.Add(int64(n))
+	}
+}
+
+func (e *Engine) addMisses(ctx context.Context, n int) {
+	if !observability.IsShadow(ctx) {
+		observability.AddCacheMisses(n)
+	}
+	if n > 0 {
+		e.misses.Add(int64(n))
+	}
+}
+
+func observeRead(ctx context.Context, cache string, stale bool) {
+	if !observability.IsShadow(ctx) {
+		observability.ObserveSpatialRead(cache, stale)
+	}
+}
+
+func incFreshReject(ctx context.Context, reason string) {
+	if !observability.IsShadow(ctx) {
+		observability.IncFreshReject(reason)
+	}
+}
+
+// AdminStats summarizes store contents, hit/miss counts since start and the
+// topN hottest cells (empty when adaptive hotness tracking is off)
+func (e *Engine) AdminStats(ctx context.Context, topN int) (admin.Stats, error) {
+	st := admin.Stats{
+		Hits:   e.hits.Load(),
+		Misses: e.misses.Load(),
+		Uptime: time.Since(e.started).Round(time.Second).String(),
+	}
+	if e.keys != nil {
+		ctx, cancel := withTimeout(ctx, max(e.readTimeout(), time.Second))
+		defer cancel()
+		kc, err := e.keys.CountKeys(ctx, statsKeySample)
+		if err != nil {
+			return admin.Stats{}, fmt.Errorf("admin stats: %w", err)
+		}
+		st.CellIndexKeys = kc.CellIndex
+		st.FeatureKeys = kc.Features
+		st.KeysSampled = kc.Sampled
+		st.MemoryBytesEst = kc.Bytes
+	}
+	if e.hot != nil && topN > 0 {
+		st.HotCells = e.hot.Top(topN)
+	}
+	return st, nil
+}
@@ -0,0 +1,90 @@
+package cache_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/admin"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/scenarios"
+)
+
+func TestCache_AdminStats(t *testing.T) {
+	var n int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		i := atomic.AddInt64(&n, 1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"type":"FeatureCollection","features":[{"type":"Feature","id":"f%d","geometry":{"type":"Point","coordinates":[%g,59.33]},"properties":{}}]}`, i, 18.0+float64(i)/1000)
+	}))
+	defer srv.Close()
+
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+
+	cfg := config.FromEnv()
+	cfg.Scenario = "cache"
+	cfg.RedisAddr = mr.Addr()
+	cfg.GeoServerURL = strings.TrimRight(srv.URL, "/")
+	cfg.AdaptiveEnabled = true
+	cfg.AdaptiveDryRun = true
+
+	h, err := scenarios.New("cache", cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), nil)
+	if err != nil {
+		t.Fatalf("scenario: %v", err)
+	}
+	sp, ok := h.(admin.StatsProvider)
+	if !ok {
+		t.Fatalf("cache scenario does not implement admin.StatsProvider")
+	}
+
+	bb := model.BBox{X1: 18.00, Y1: 59.32, X2: 18.02, Y2: 59.34, SRID: "EPSG:4326"}
+	for range 2 {
+		req := httptest.NewRequest(http.MethodGet, "/query", nil)
+		rr := httptest.NewRecorder()
+		h.HandleQuery(req.Context(), rr, req, model.QueryRequest{Layer: "demo:NR_polygon", BBox: &bb})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status=%d body=%q", rr.Code, rr.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/stats?top=3", nil)
+	rr := httptest.NewRecorder()
+	admin.CacheStats(sp)(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("stats status=%d body=%q", rr.Code, rr.Body.String())
+	}
+
+	var shape map[string]json.RawMessage
+	if err := json.Unmarshal(rr.Body.Bytes(), &shape); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	for _, k := range []string{"cell_index_keys", "feature_keys", "keys_sampled", "memory_bytes_estimate", "hits", "misses", "hot_cells", "uptime"} {
+		if _, ok := shape[k]; !ok {
+			t.Fatalf("missing %q in %s", k, rr.Body.String())
+		}
+	}
+
+	var st admin.Stats
+	if err := json.Unmarshal(rr.Body.Bytes(), &st); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if st.Misses == 0 || st.Hits == 0 {
+		t.Fatalf("want hits and misses from prior queries, got hits=%d misses=%d", st.Hits, st.Misses)
+	}
+	if st.CellIndexKeys == 0 || st.FeatureKeys == 0 || st.MemoryBytesEst == 0 {
+		t.Fatalf("want non-zero key counts, got %+v", st)
+	}
+	if len(st.HotCells) == 0 || len(st.HotCells) > 3 {
+		t.Fatalf("want 1..3 hot cells, got %d", len(st.HotCells))
+	}
+}
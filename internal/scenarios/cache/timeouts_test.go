@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/aggregate/geojsonagg"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/composer"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	h3mapper "github.com/mohammed-shakir/h3-spatial-cache/internal/mapper/h3"
+)
+
+// records the remaining time budget seen by each index op
+type deadlineCellIndex struct {
+	recordingCellIndex
+	mu       sync.Mutex
+	mgetLeft time.Duration
+	setLeft  time.Duration
+}
+
+func leftOf(ctx context.Context) time.Duration {
+	dl, ok := ctx.Deadline()
+	if !ok {
+		return 0
+	}
+	return time.Until(dl)
+}
+
+func (d *deadlineCellIndex) MGetIDs(ctx context.Context, _ string, _ int, _ []string, _ model.Filters) (map[string][]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.mgetLeft = leftOf(ctx)
+	return map[string][]string{}, nil
+}
+
+func (d *deadlineCellIndex) SetIDs(ctx context.Context, _ string, _ int, _ string, _ model.Filters, _ []string, _ time.Duration) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.setLeft = leftOf(ctx)
+	return nil
+}
+
+func TestHandleQuery_MGetTimeoutIndependentOfSet(t *testing.T) {
+	idx := &deadlineCellIndex{}
+	e := newTestEngineForV2(t, `{"type":"FeatureCollection","features":[]}`, &recordingFeatureStore{}, nil)
+	e.idx = idx
+	e.mapr = h3mapper.New()
+	e.eng = composer.Engine{V2: composer.NewGeoJSONV2Adapter(geojsonagg.NewAdvanced())}
+	e.maxWorkers = 1
+	e.queueSize = 1
+	e.mgetTimeout = 5 * time.Second
+	e.setTimeout = 200 * time.Millisecond
+
+	bb := model.BBox{X1: 18.00, Y1: 59.32, X2: 18.10, Y2: 59.42, SRID: "EPSG:4326"}
+	req := httptest.NewRequest(http.MethodGet, "/query", nil)
+	rr := httptest.NewRecorder()
+	e.HandleQuery(req.Context(), rr, req, model.QueryRequest{Layer: "demo", BBox: &bb})
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.mgetLeft <= time.Second || idx.mgetLeft > 5*time.Second {
+		t.Fatalf("mget budget=%v want ~5s", idx.mgetLeft)
+	}
+	if idx.setLeft <= 0 || idx.setLeft > 200*time.Millisecond {
+		t.Fatalf("set budget=%v want <=200ms", idx.setLeft)
+	}
+}
@@ -0,0 +1,92 @@
+package cache_test
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/composer"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/executor"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/httpclient"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/ogc"
+	h3mapper "github.com/mohammed-shakir/h3-spatial-cache/internal/mapper/h3"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/scenarios"
+)
+
+func TestCache_SubCellBBox_FetchesDirectly(t *testing.T) {
+	var calls atomic.Int32
+	var gotBBox atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		gotBBox.Store(r.URL.Query().Get("bbox"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[{"type":"Feature","id":"door","geometry":{"type":"Point","coordinates":[18.00005,59.33005]},"properties":{}}]}`)
+	}))
+	defer srv.Close()
+
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+
+	cfg := config.FromEnv()
+	cfg.Scenario = "cache"
+	cfg.RedisAddr = mr.Addr()
+	cfg.GeoServerURL = strings.TrimRight(srv.URL, "/")
+	cfg.AdaptiveEnabled = false
+
+	// ~10m across, far smaller than a cell, so polyfill finds no cell centers
+	bb := model.BBox{X1: 18.0000, Y1: 59.3300, X2: 18.0001, Y2: 59.3301, SRID: "EPSG:4326"}
+	if cells, err := h3mapper.New().CellsForBBox(bb, cfg.H3Res); err != nil || len(cells) != 0 {
+		t.Fatalf("test needs a zero-cell bbox: cells=%v err=%v", cells, err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	exec, err := executor.New(logger, httpclient.NewOutbound(), ogc.OWSEndpoint(cfg.GeoServerURL))
+	if err != nil {
+		t.Fatalf("executor: %v", err)
+	}
+	h, err := scenarios.New("cache", cfg, logger, exec)
+	if err != nil {
+		t.Fatalf("scenario: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/query", nil)
+	rr := httptest.NewRecorder()
+	h.HandleQuery(req.Context(), rr, req, model.QueryRequest{Layer: "demo:places", BBox: &bb, Provenance: true})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	if got := rr.Header().Get(composer.HeaderXCache); got != composer.XCacheBypassTiny {
+		t.Fatalf("X-Cache=%q want %q", got, composer.XCacheBypassTiny)
+	}
+	var fc struct {
+		Features   []json.RawMessage                     `json:"features"`
+		Provenance map[string][]composer.ProvenanceEntry `json:"provenance"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &fc); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(fc.Features) != 1 {
+		t.Fatalf("want the upstream feature, got %d", len(fc.Features))
+	}
+	if p := fc.Provenance["door"]; len(p) != 1 || p[0] != (composer.ProvenanceEntry{Cache: "miss"}) {
+		t.Fatalf("provenance=%v want a cell-less miss for door", fc.Provenance)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("upstream calls=%d want 1", n)
+	}
+	if b, _ := gotBBox.Load().(string); !strings.HasPrefix(b, "18.000000,59.330000,18.000100,59.330100") {
+		t.Fatalf("upstream bbox=%q want the raw query bbox", b)
+	}
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Fatalf("tiny footprint should not be cached, keys=%v", keys)
+	}
+}
@@ -0,0 +1,78 @@
+package cache_test
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/scenarios"
+)
+
+func TestCache_StaggeredTTLAcrossResolutions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[{"type":"Feature","id":"f1","geometry":null,"properties":{}}]}`)
+	}))
+	defer srv.Close()
+
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+
+	bb := model.BBox{X1: 18.00, Y1: 59.32, X2: 18.02, Y2: 59.34, SRID: "EPSG:4326"}
+	fill := func(res int) {
+		cfg := config.FromEnv()
+		cfg.Scenario = "cache"
+		cfg.RedisAddr = mr.Addr()
+		cfg.GeoServerURL = strings.TrimRight(srv.URL, "/")
+		cfg.CacheTTLDefault = time.Minute
+		cfg.AdaptiveEnabled = false
+		cfg.AdaptiveSeed = 7
+		cfg.H3Res, cfg.H3ResMin, cfg.H3ResMax = res, res, res
+
+		h, err := scenarios.New("cache", cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), nil)
+		if err != nil {
+			t.Fatalf("scenario: %v", err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/query", nil)
+		rr := httptest.NewRecorder()
+		h.HandleQuery(req.Context(), rr, req, model.QueryRequest{Layer: "demo:NR_polygon", BBox: &bb})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("res %d: status=%d body=%q", res, rr.Code, rr.Body.String())
+		}
+	}
+	fill(8)
+	fill(9)
+
+	ttlByRes := map[string][]time.Duration{}
+	for _, k := range mr.Keys() {
+		if !strings.HasPrefix(k, "idx:") {
+			continue
+		}
+		for _, res := range []string{":8:", ":9:"} {
+			if strings.Contains(k, res) {
+				ttlByRes[res] = append(ttlByRes[res], mr.TTL(k))
+			}
+		}
+	}
+	if len(ttlByRes[":8:"]) == 0 || len(ttlByRes[":9:"]) == 0 {
+		t.Fatalf("expected index keys at both resolutions, got %v", mr.Keys())
+	}
+	for _, coarse := range ttlByRes[":8:"] {
+		if coarse >= time.Minute {
+			t.Fatalf("res 8 ttl=%v, want staggered below base", coarse)
+		}
+		for _, fine := range ttlByRes[":9:"] {
+			if fine >= coarse {
+				t.Fatalf("res 9 ttl=%v should expire before res 8 ttl=%v", fine, coarse)
+			}
+		}
+	}
+}
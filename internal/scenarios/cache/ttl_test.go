@@ -1,8 +1,21 @@
 package cache
 
 import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/aggregate/geojsonagg"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/composer"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	h3mapper "github.com/mohammed-shakir/h3-spatial-cache/internal/mapper/h3"
+	"github.com/mohammed-shakir/h3-spatial-cache/pkg/adaptive"
 )
 
 func TestTTLFor_PrefixFallbackAndExact(t *testing.T) {
@@ -27,3 +40,84 @@ func TestTTLFor_PrefixFallbackAndExact(t *testing.T) {
 		t.Fatalf("missing override ttl=%v", got)
 	}
 }
+
+func TestStaggerTTL_DeterministicPerSeed(t *testing.T) {
+	a := &Engine{ttlSeed: 1}
+	b := &Engine{ttlSeed: 1}
+	const cell = "882a100d2bfffff"
+
+	if a.staggerTTL(time.Minute, 8, cell) != b.staggerTTL(time.Minute, 8, cell) {
+		t.Fatalf("same seed should give the same ttl")
+	}
+	if got := a.staggerTTL(0, 8, cell); got != 0 {
+		t.Fatalf("zero ttl should stay zero, got %v", got)
+	}
+	coarse, fine := a.staggerTTL(time.Minute, 8, cell), a.staggerTTL(time.Minute, 9, cell)
+	if coarse >= time.Minute || fine >= coarse {
+		t.Fatalf("want base > res8 (%v) > res9 (%v)", coarse, fine)
+	}
+}
+
+func TestTTLFor_RaisedToFloor(t *testing.T) {
+	e := &Engine{
+		logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		ttlDefault: time.Minute,
+		ttlMap:     map[string]time.Duration{"roads": time.Second},
+		ttlMin:     15 * time.Second,
+	}
+	if got := e.ttlFor("demo:roads"); got != 15*time.Second {
+		t.Fatalf("override below floor: ttl=%v", got)
+	}
+	if got := e.ttlFor("demo:other"); got != time.Minute {
+		t.Fatalf("default above floor: ttl=%v", got)
+	}
+	if got := e.staggerTTL(15*time.Second, 12, "882a100d2bfffff"); got != 15*time.Second {
+		t.Fatalf("stagger trimmed below floor: ttl=%v", got)
+	}
+}
+
+// shortTTLDecider fills at the base resolution with a TTL under any sane floor
+type shortTTLDecider struct{ ttl time.Duration }
+
+func (d shortTTLDecider) Decide(q adaptive.Query, _ adaptive.HotnessView) (adaptive.Decision, adaptive.Reason) {
+	return adaptive.Decision{Type: adaptive.DecisionFill, Resolution: q.BaseRes, TTL: d.ttl}, adaptive.ReasonColdAllCells
+}
+
+func TestHandleQuery_AdaptiveTTLRaisedToFloorBeforeSetIDs(t *testing.T) {
+	idx := &recordingCellIndex{}
+	e := newTestEngineForV2(t, `{"type":"FeatureCollection","features":[`+
+		`{"type":"Feature","id":"a","geometry":null,"properties":{}}]}`, &recordingFeatureStore{}, idx)
+	var logs bytes.Buffer
+	e.logger = slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	e.mapr = h3mapper.New()
+	e.eng = composer.Engine{V2: composer.NewGeoJSONV2Adapter(geojsonagg.NewAdvanced())}
+	e.maxWorkers = 2
+	e.ttlDefault = time.Minute
+	e.ttlMin = 30 * time.Second
+	e.adaptiveEnabled = true
+	e.decider = shortTTLDecider{ttl: 2 * time.Second}
+
+	q := model.QueryRequest{
+		Layer: "demo:layer",
+		BBox:  &model.BBox{X1: 18.00, Y1: 59.32, X2: 18.03, Y2: 59.34, SRID: "EPSG:4326"},
+	}
+	for range 2 {
+		rr := httptest.NewRecorder()
+		e.HandleQuery(context.Background(), rr, httptest.NewRequest(http.MethodGet, "/query", nil), q)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+		}
+	}
+
+	if len(idx.calls) == 0 {
+		t.Fatal("no SetIDs calls")
+	}
+	for _, c := range idx.calls {
+		if c.ttl != e.ttlMin {
+			t.Fatalf("SetIDs(%s) ttl=%v want the %v floor", c.cell, c.ttl, e.ttlMin)
+		}
+	}
+	if n := strings.Count(logs.String(), "cache ttl raised to floor"); n != 1 {
+		t.Fatalf("floor warnings=%d want 1 per layer and source: %q", n, logs.String())
+	}
+}
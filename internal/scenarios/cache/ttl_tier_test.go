@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+
+	cachev2 "github.com/mohammed-shakir/h3-spatial-cache/internal/cache/v2"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+)
+
+func TestCache_HotTTLTier_WithoutAdaptive(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[{"type":"Feature","id":"f1","geometry":null,"properties":{}}]}`)
+	}))
+	defer srv.Close()
+
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+
+	cfg := config.FromEnv()
+	cfg.Scenario = "cache"
+	cfg.RedisAddr = mr.Addr()
+	cfg.GeoServerURL = strings.TrimRight(srv.URL, "/")
+	cfg.H3Res, cfg.H3ResMin, cfg.H3ResMax = 8, 8, 8
+	cfg.CacheTTLDefault = time.Minute
+	cfg.AdaptiveEnabled = false
+	cfg.CacheHotTTLTier = true
+	cfg.HotThreshold = 5
+	cfg.AdaptiveTTLHot = 10 * time.Minute
+
+	e, err := newCacheWithBackend(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, cachev2.Open)
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+
+	q := model.QueryRequest{
+		Layer: "demo:NR_polygon",
+		BBox:  &model.BBox{X1: 18.00, Y1: 59.32, X2: 18.02, Y2: 59.34, SRID: "EPSG:4326"},
+	}
+	cells, err := e.cellsForRes(q, 8)
+	if err != nil || len(cells) < 2 {
+		t.Fatalf("need at least two cells, got %v (err %v)", cells, err)
+	}
+	hot := cells[0]
+	for range 10 {
+		e.hot.Inc(hot)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/query", nil)
+	rr := httptest.NewRecorder()
+	e.HandleQuery(req.Context(), rr, req, q)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%q", rr.Code, rr.Body.String())
+	}
+
+	seen := 0
+	for _, k := range mr.Keys() {
+		if !strings.HasPrefix(k, "idx:") {
+			continue
+		}
+		seen++
+		ttl := mr.TTL(k)
+		if strings.Contains(k, hot) {
+			if ttl <= cfg.CacheTTLDefault {
+				t.Fatalf("hot cell %s ttl=%v, want the hot tier above %v", hot, ttl, cfg.CacheTTLDefault)
+			}
+		} else if ttl > cfg.CacheTTLDefault {
+			t.Fatalf("cold cell key %s ttl=%v, want at most the default %v", k, ttl, cfg.CacheTTLDefault)
+		}
+	}
+	if seen != len(cells) {
+		t.Fatalf("index keys=%d want %d", seen, len(cells))
+	}
+}
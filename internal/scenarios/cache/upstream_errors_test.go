@@ -0,0 +1,89 @@
+package cache_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/scenarios"
+)
+
+func TestCache_UpstreamErrors_OnlyCountUpstreamTimeouts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	run := func(t *testing.T, opTimeout, clientTimeout time.Duration) *prometheus.Registry {
+		t.Helper()
+		reg := prometheus.NewRegistry()
+		observability.Init(reg, true)
+
+		mr := miniredis.RunT(t)
+		cfg := config.FromEnv()
+		cfg.Scenario = "cache"
+		cfg.RedisAddr = mr.Addr()
+		cfg.GeoServerURL = strings.TrimRight(srv.URL, "/")
+		cfg.AdaptiveEnabled = false
+		cfg.CacheOpTimeout = opTimeout
+		h, err := scenarios.New("cache", cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), nil)
+		if err != nil {
+			t.Fatalf("scenario: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
+		defer cancel()
+		bb := model.BBox{X1: 18.00, Y1: 59.32, X2: 18.02, Y2: 59.34, SRID: "EPSG:4326"}
+		req := httptest.NewRequest(http.MethodGet, "/query", nil).WithContext(ctx)
+		h.HandleQuery(ctx, httptest.NewRecorder(), req, model.QueryRequest{Layer: "demo:places", BBox: &bb})
+		return reg
+	}
+	upstreamErrors := func(t *testing.T, reg *prometheus.Registry) map[string]float64 {
+		t.Helper()
+		mfs, err := reg.Gather()
+		if err != nil {
+			t.Fatalf("gather: %v", err)
+		}
+		out := map[string]float64{}
+		for _, mf := range mfs {
+			if mf.GetName() != "upstream_errors_total" {
+				continue
+			}
+			for _, m := range mf.GetMetric() {
+				for _, l := range m.GetLabel() {
+					if l.GetName() == "kind" {
+						out[l.GetValue()] += m.GetCounter().GetValue()
+					}
+				}
+			}
+		}
+		return out
+	}
+
+	t.Run("client deadline", func(t *testing.T) {
+		reg := run(t, 2*time.Second, 50*time.Millisecond)
+		if got := upstreamErrors(t, reg); len(got) != 0 {
+			t.Fatalf("a client-picked deadline counted as upstream errors: %v", got)
+		}
+	})
+	t.Run("op timeout", func(t *testing.T) {
+		reg := run(t, 50*time.Millisecond, 2*time.Second)
+		if got := upstreamErrors(t, reg); got[observability.UpstreamErrTimeout] == 0 {
+			t.Fatalf("an upstream past CACHE_OP_TIMEOUT should count as a timeout, got %v", got)
+		}
+	})
+}
@@ -0,0 +1,174 @@
+package cache_test
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/router"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/scenarios"
+)
+
+func TestCache_UpstreamMaxConcurrency_CapsAcrossRequests(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	observability.Init(reg, true)
+	observability.SetScenario("cache")
+
+	var inFlight, peak, calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		calls.Add(1)
+		time.Sleep(5 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[]}`)
+	}))
+	defer srv.Close()
+
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+
+	const limit = 2
+	cfg := config.FromEnv()
+	cfg.Scenario = "cache"
+	cfg.RedisAddr = mr.Addr()
+	cfg.GeoServerURL = strings.TrimRight(srv.URL, "/")
+	cfg.AdaptiveEnabled = false
+	cfg.CacheFillMaxWorkers = 8
+	cfg.UpstreamMaxConcurrency = limit
+
+	h, err := scenarios.New("cache", cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), nil)
+	if err != nil {
+		t.Fatalf("scenario: %v", err)
+	}
+
+	// distinct footprints so every request misses and fans out
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			x := 18.0 + float64(i)*0.05
+			bb := model.BBox{X1: x, Y1: 59.32, X2: x + 0.02, Y2: 59.34, SRID: "EPSG:4326"}
+			req := httptest.NewRequest(http.MethodGet, "/query", nil)
+			rr := httptest.NewRecorder()
+			h.HandleQuery(req.Context(), rr, req, model.QueryRequest{Layer: "demo:places", BBox: &bb})
+			if rr.Code != http.StatusOK {
+				t.Errorf("request %d: status=%d body=%q", i, rr.Code, rr.Body.String())
+			}
+		}()
+	}
+	wg.Wait()
+
+	if p := peak.Load(); p > limit || p == 0 {
+		t.Fatalf("peak concurrent upstream calls=%d want 1..%d (calls=%d)", p, limit, calls.Load())
+	}
+	if calls.Load() <= limit {
+		t.Fatalf("test needs more calls than the limit, got %d", calls.Load())
+	}
+	if waits := gatherValue(t, reg, "upstream_semaphore_waits_total"); waits == 0 {
+		t.Fatalf("expected acquire waits to be counted")
+	}
+	if sat := gatherValue(t, reg, "upstream_semaphore_saturation"); sat != 0 {
+		t.Fatalf("saturation=%v want 0 once idle", sat)
+	}
+}
+
+func TestCache_ShareUpstreamLimit_CapsBothEngines(t *testing.T) {
+	observability.Init(prometheus.NewRegistry(), true)
+
+	var inFlight, peak atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(5 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[]}`)
+	}))
+	defer srv.Close()
+
+	const limit = 2
+	var engines []router.QueryHandler
+	for range 2 {
+		mr := miniredis.RunT(t)
+		cfg := config.FromEnv()
+		cfg.Scenario = "cache"
+		cfg.RedisAddr = mr.Addr()
+		cfg.GeoServerURL = strings.TrimRight(srv.URL, "/")
+		cfg.AdaptiveEnabled = false
+		cfg.CacheFillMaxWorkers = 8
+		cfg.UpstreamMaxConcurrency = limit
+		h, err := scenarios.New("cache", cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), nil)
+		if err != nil {
+			t.Fatalf("scenario: %v", err)
+		}
+		engines = append(engines, h)
+	}
+	s, ok := engines[1].(interface {
+		ShareUpstreamLimit(router.QueryHandler) bool
+	})
+	if !ok || !s.ShareUpstreamLimit(engines[0]) {
+		t.Fatalf("shadow engine should adopt the primary's limiter")
+	}
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		h := engines[i%2]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			x := 18.0 + float64(i)*0.05
+			bb := model.BBox{X1: x, Y1: 59.32, X2: x + 0.02, Y2: 59.34, SRID: "EPSG:4326"}
+			req := httptest.NewRequest(http.MethodGet, "/query", nil)
+			rr := httptest.NewRecorder()
+			h.HandleQuery(req.Context(), rr, req, model.QueryRequest{Layer: "demo:places", BBox: &bb})
+			if rr.Code != http.StatusOK {
+				t.Errorf("request %d: status=%d body=%q", i, rr.Code, rr.Body.String())
+			}
+		}()
+	}
+	wg.Wait()
+
+	if p := peak.Load(); p > limit || p == 0 {
+		t.Fatalf("peak concurrent upstream calls=%d want 1..%d across both engines", p, limit)
+	}
+}
+
+func gatherValue(t *testing.T, reg *prometheus.Registry, name string) float64 {
+	t.Helper()
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			switch {
+			case m.GetCounter() != nil:
+				return m.GetCounter().GetValue()
+			case m.GetGauge() != nil:
+				return m.GetGauge().GetValue()
+			}
+		}
+	}
+	t.Fatalf("metric %s not found", name)
+	return 0
+}
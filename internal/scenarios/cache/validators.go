@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/cellindex"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/keys"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+)
+
+// cellValidator loads the validators stored for cell by its last fill; false
+// when conditional fetches are off or there are none to send
+func (e *Engine) cellValidator(ctx context.Context, q model.QueryRequest, res int, cell string) (cellindex.Validator, bool) {
+	vs, ok := e.idx.(cellindex.ValidatorStore)
+	if !e.condFetch || !ok || e.fs == nil {
+		return cellindex.Validator{}, false
+	}
+	ctx, cancel := withTimeout(ctx, e.readTimeout())
+	defer cancel()
+	v, ok, err := vs.GetValidator(ctx, keys.ScopedLayer(q.Layer, q.Headers), res, cell, model.Filters(q.Filters))
+	if err != nil {
+		e.logger.Debug("cache v2: validator read failed, fetching unconditionally",
+			"layer", q.Layer,
+			"res", res,
+			"cell", cell,
+			"err", err,
+		)
+		return cellindex.Validator{}, false
+	}
+	return v, ok
+}
+
+// setCellValidator keeps v for as long as the features it vouches for; a
+// response that offered no validators stores nothing
+func (e *Engine) setCellValidator(ctx context.Context, q model.QueryRequest, res int, cell string, v cellindex.Validator, cellTTL time.Duration) {
+	vs, ok := e.idx.(cellindex.ValidatorStore)
+	if !e.condFetch || !ok || (v.ETag == "" && v.LastModified == "") {
+		return
+	}
+	ctx, cancel := withTimeout(ctx, e.writeTimeout())
+	defer cancel()
+	if err := vs.SetValidator(ctx, keys.ScopedLayer(q.Layer, q.Headers), res, cell, model.Filters(q.Filters), v, e.featureTTLFor(cellTTL)); err != nil {
+		e.logger.Warn("cache v2: validator set failed",
+			"layer", q.Layer,
+			"res", res,
+			"cell", cell,
+			"err", err,
+		)
+	}
+}
+
+// revalidateCell rebuilds cell from the features v lists after the upstream
+// answered 304, pushing their expiry out as a fresh fill would. It reports
+// false when any of them has been evicted since, leaving a full fetch to the
+// caller
+func (e *Engine) revalidateCell(ctx context.Context, q model.QueryRequest, cell string, res int, ttl time.Duration, v cellindex.Validator) (result, bool) {
+	layer := keys.ScopedLayer(q.Layer, q.Headers)
+	r := result{cell: cell, key: keys.Key(layer, res, cell, q.Filters), matched: v.Matched}
+	t := max(ttl, 0)
+
+	if len(v.IDs) != 1 || v.IDs[0] != cellindex.EmptyMarkerID {
+		getCtx, cancel := withTimeout(ctx, e.readTimeout())
+		got, err := e.fs.MGetFeatures(getCtx, layer, v.IDs)
+		cancel()
+		if err != nil {
+			return result{}, false
+		}
+		r.features = make([]json.RawMessage, 0, len(v.IDs))
+		for _, id := range v.IDs {
+			b, ok := got[id]
+			if !ok {
+				return result{}, false
+			}
+			r.features = append(r.features, b)
+		}
+		if err := e.putFeatures(ctx, layer, got, e.featureTTLFor(t)); err != nil {
+			// the index must not outlive its features, so this cell is
+			// served but stays unindexed
+			e.logger.Warn("cache v2: feature refresh after 304 failed",
+				"layer", q.Layer,
+				"res", res,
+				"cell", cell,
+				"err", err,
+			)
+			return r, true
+		}
+	}
+
+	if err := e.setIDs(ctx, q, res, cell, v.IDs, t); err != nil {
+		e.logger.Warn("cache v2: cell index set after 304 failed",
+			"layer", q.Layer,
+			"res", res,
+			"cell", cell,
+			"err", err,
+		)
+		return r, true
+	}
+	e.setCellValidator(ctx, q, res, cell, v, t)
+	e.logger.Debug("cache v2 revalidated cell",
+		"layer", q.Layer,
+		"res", res,
+		"cell", cell,
+		"index_ids", len(v.IDs),
+	)
+	return r, true
+}
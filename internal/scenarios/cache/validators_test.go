@@ -0,0 +1,167 @@
+package cache
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/cellindex"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/featurestore"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/keys"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/memstore"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
+)
+
+// etagUpstream answers 304 when If-None-Match carries its current ETag
+type etagUpstream struct {
+	mu          sync.Mutex
+	etag        string
+	sent        []string // If-None-Match of every request, "" when absent
+	bodies      int
+	notModified int
+}
+
+func (u *etagUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	inm := r.Header.Get("If-None-Match")
+	u.sent = append(u.sent, inm)
+	w.Header().Set("ETag", u.etag)
+	if inm == u.etag {
+		u.notModified++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	u.bodies++
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = io.WriteString(w, `{"type":"FeatureCollection","numberMatched":2,"features":[`+
+		`{"type":"Feature","id":"a","geometry":null,"properties":{"v":1}},`+
+		`{"type":"Feature","id":"b","geometry":null,"properties":{"v":2}}]}`)
+}
+
+func (u *etagUpstream) counts() (bodies, notModified int, lastINM string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.bodies, u.notModified, u.sent[len(u.sent)-1]
+}
+
+func TestFetchCell_ConditionalRefetchUsesStoredValidators(t *testing.T) {
+	observability.Init(prometheus.NewRegistry(), true)
+	t.Cleanup(func() { observability.Init(nil, false) })
+
+	up := &etagUpstream{etag: `"v1"`}
+	srv := httptest.NewServer(up)
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	st := memstore.New(time.Minute)
+	defer func() { _ = st.Close() }()
+	idx := cellindex.NewMemoryIndex(st)
+	fs := featurestore.NewMemoryStore(st, time.Minute)
+	e := &Engine{
+		logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		res:        7,
+		minRes:     7,
+		maxRes:     7,
+		fs:         fs,
+		idx:        idx,
+		owsURL:     u,
+		http:       srv.Client(),
+		opTimeout:  2 * time.Second,
+		featureTTL: time.Hour,
+		condFetch:  true,
+	}
+
+	ctx := context.Background()
+	q := model.QueryRequest{Layer: "demo:layer"}
+	const cell = "892a100d2b3ffff"
+	expire := func() {
+		t.Helper()
+		if err := st.Del(keys.CellIndexKey(q.Layer, 7, cell, "")); err != nil {
+			t.Fatalf("expire cell: %v", err)
+		}
+	}
+
+	first := e.fetchCell(ctx, q, cell, 7, time.Minute)
+	if first.err != nil || len(first.features) != 2 {
+		t.Fatalf("first fetch: err=%v features=%d", first.err, len(first.features))
+	}
+	if _, _, inm := up.counts(); inm != "" {
+		t.Fatalf("first fetch sent If-None-Match %q", inm)
+	}
+
+	// the index entry expires; the features and validators outlive it
+	expire()
+	r := e.fetchCell(ctx, q, cell, 7, time.Minute)
+	bodies, notModified, inm := up.counts()
+	if inm != `"v1"` || notModified != 1 || bodies != 1 {
+		t.Fatalf("refetch: If-None-Match=%q 304s=%d bodies=%d", inm, notModified, bodies)
+	}
+	if r.err != nil || r.notModified || r.matched != 2 || len(r.features) != 2 ||
+		string(r.features[0]) != string(first.features[0]) || string(r.features[1]) != string(first.features[1]) {
+		t.Fatalf("304 result=%+v want the first fetch's features", r)
+	}
+	if ids, _ := idx.GetIDs(ctx, q.Layer, 7, cell, ""); len(ids) != 2 {
+		t.Fatalf("cell index after 304: %v", ids)
+	}
+
+	// a 304 for features evicted since falls back to an unconditional fetch
+	expire()
+	if err := fs.(featurestore.Deleter).DelFeatures(ctx, q.Layer, []string{"s:b"}); err != nil {
+		t.Fatalf("evict: %v", err)
+	}
+	r = e.fetchCell(ctx, q, cell, 7, time.Minute)
+	bodies, notModified, inm = up.counts()
+	if r.err != nil || len(r.features) != 2 || notModified != 2 || bodies != 2 || inm != "" {
+		t.Fatalf("evicted: err=%v features=%d 304s=%d bodies=%d last If-None-Match=%q", r.err, len(r.features), notModified, bodies, inm)
+	}
+
+	// a changed layer answers with a body as usual
+	expire()
+	up.mu.Lock()
+	up.etag = `"v2"`
+	up.mu.Unlock()
+	if r = e.fetchCell(ctx, q, cell, 7, time.Minute); r.err != nil || len(r.features) != 2 {
+		t.Fatalf("modified: err=%v features=%d", r.err, len(r.features))
+	}
+	if bodies, _, inm = up.counts(); bodies != 3 || inm != `"v1"` {
+		t.Fatalf("modified: bodies=%d If-None-Match=%q", bodies, inm)
+	}
+
+	snap := observability.Snapshot()
+	for result, want := range map[string]float64{"not_modified": 1, "evicted": 1, "modified": 1} {
+		if got := snap[`spatial_conditional_fetch_total{result="`+result+`"}`]; got != want {
+			t.Fatalf("spatial_conditional_fetch_total{result=%q}=%v want %v", result, got, want)
+		}
+	}
+
+	// invalidation drops the validators with the entry
+	if err := idx.DelCells(ctx, q.Layer, 7, []string{cell}, ""); err != nil {
+		t.Fatalf("DelCells: %v", err)
+	}
+	if r = e.fetchCell(ctx, q, cell, 7, time.Minute); r.err != nil {
+		t.Fatalf("after invalidation: %v", r.err)
+	}
+	if _, _, inm = up.counts(); inm != "" {
+		t.Fatalf("invalidated cell sent If-None-Match %q", inm)
+	}
+
+	// with the feature off nothing is sent or stored
+	expire()
+	e.condFetch = false
+	if r = e.fetchCell(ctx, q, cell, 7, time.Minute); r.err != nil {
+		t.Fatalf("unconditional: %v", r.err)
+	}
+	if _, _, inm = up.counts(); inm != "" {
+		t.Fatalf("disabled feature sent If-None-Match %q", inm)
+	}
+}
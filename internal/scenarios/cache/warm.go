@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/admin"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/warmstart"
+)
+
+// Warm fills the manifest entries in order, each through the fill pool like
+// POST /admin/fill, logging progress after every entry. Failed entries don't
+// stop the rest; they are returned together at the end. A read-only engine
+// skips warming, since it must not write the shared cache
+func (e *Engine) Warm(ctx context.Context, entries []warmstart.Entry) error {
+	if e.readOnly {
+		e.logger.Info("warm start skipped in read-only mode", "entries", len(entries))
+		return nil
+	}
+	start := time.Now()
+	var (
+		errs  []error
+		total admin.FillSummary
+	)
+	for i, en := range entries {
+		var (
+			sum admin.FillSummary
+			err error
+		)
+		if len(en.Cells) > 0 {
+			sum, err = e.fillCellSet(ctx, en.Query, en.Query.H3Res, en.Cells)
+		} else {
+			sum, err = e.FillQuery(ctx, en.Query)
+		}
+		total.Cells += sum.Cells
+		total.Misses += sum.Misses
+		total.Failed += sum.Failed
+		e.logger.Info("warm start progress",
+			"entry", i+1,
+			"of", len(entries),
+			"line", en.Line,
+			"layer", en.Query.Layer,
+			"res", sum.Res,
+			"cells", sum.Cells,
+			"filled", sum.Misses-sum.Failed,
+			"failed", sum.Failed,
+			"elapsed", time.Since(start).String(),
+		)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d (%s): %w", en.Line, en.Query.Layer, err))
+			if ctx.Err() != nil {
+				break
+			}
+		}
+	}
+	e.logger.Info("warm start filled",
+		"entries", len(entries),
+		"cells", total.Cells,
+		"filled", total.Misses-total.Failed,
+		"failed", total.Failed,
+	)
+	return errors.Join(errs...)
+}
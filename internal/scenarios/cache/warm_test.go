@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+
+	cachev2 "github.com/mohammed-shakir/h3-spatial-cache/internal/cache/v2"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/health"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/warmstart"
+)
+
+func TestWarm_ManifestCellsFilledBeforeReady(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[{"type":"Feature","id":"f1","geometry":{"type":"Point","coordinates":[18.01,59.33]},"properties":{}}]}`)
+	}))
+	defer srv.Close()
+
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+
+	cfg := config.FromEnv()
+	cfg.Scenario = "cache"
+	cfg.RedisAddr = mr.Addr()
+	cfg.GeoServerURL = strings.TrimRight(srv.URL, "/")
+	cfg.H3Res, cfg.H3ResMin, cfg.H3ResMax = 8, 7, 9
+	cfg.AdaptiveEnabled = false
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	e, err := newCacheWithBackend(cfg, logger, nil, cachev2.Open)
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+
+	bboxQ := model.QueryRequest{Layer: "demo:NR_polygon", BBox: &model.BBox{X1: 18.00, Y1: 59.32, X2: 18.02, Y2: 59.34, SRID: "EPSG:4326"}}
+	bboxCells, err := e.cellsForRes(bboxQ, 8)
+	if err != nil || len(bboxCells) == 0 {
+		t.Fatalf("bbox cells=%v err=%v", bboxCells, err)
+	}
+	far := model.QueryRequest{Layer: "demo:NR_polygon", BBox: &model.BBox{X1: 18.10, Y1: 59.40, X2: 18.12, Y2: 59.42, SRID: "EPSG:4326"}}
+	explicit, err := e.cellsForRes(far, 9)
+	if err != nil || len(explicit) < 2 {
+		t.Fatalf("explicit cells=%v err=%v", explicit, err)
+	}
+	explicit = explicit[:2]
+
+	manifest := fmt.Sprintf("# warm set\ndemo:NR_polygon 9 %s\ndemo:NR_polygon 9 %s\n\ndemo:NR_polygon 0 18.00,59.32,18.02,59.34,EPSG:4326\n", explicit[0], explicit[1])
+	entries, err := warmstart.Parse(strings.NewReader(manifest), cfg)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	ready := health.Readiness(warmstart.Start(context.Background(), e, entries, logger))
+	probe := func() int {
+		rr := httptest.NewRecorder()
+		ready(rr, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+		return rr.Code
+	}
+	if code := probe(); code != http.StatusServiceUnavailable {
+		t.Fatalf("ready=%d while the upstream is held, want 503", code)
+	}
+
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for probe() != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatalf("never became ready")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for res, cells := range map[int][]string{9: explicit, 8: bboxCells} {
+		ids, err := e.idx.MGetIDs(context.Background(), "demo:NR_polygon", res, cells, "")
+		if err != nil {
+			t.Fatalf("mget res %d: %v", res, err)
+		}
+		for _, c := range cells {
+			if len(ids[c]) == 0 {
+				t.Fatalf("res %d cell %s not indexed once ready", res, c)
+			}
+		}
+	}
+}
+
+func TestWarm_ReadOnlySkipsManifest(t *testing.T) {
+	var upstream atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		upstream.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[]}`)
+	}))
+	defer srv.Close()
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+
+	cfg := config.FromEnv()
+	cfg.Scenario = "cache"
+	cfg.RedisAddr = mr.Addr()
+	cfg.GeoServerURL = strings.TrimRight(srv.URL, "/")
+	cfg.H3Res, cfg.H3ResMin, cfg.H3ResMax = 8, 7, 9
+	cfg.AdaptiveEnabled = false
+	cfg.CacheReadOnly = true
+	e, err := newCacheWithBackend(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, cachev2.Open)
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	entries, err := warmstart.Parse(strings.NewReader("demo:NR_polygon 0 18.00,59.32,18.02,59.34,EPSG:4326\n"), cfg)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if err := e.Warm(context.Background(), entries); err != nil {
+		t.Fatalf("warm: %v", err)
+	}
+	if got := upstream.Load(); got != 0 || len(mr.Keys()) != 0 {
+		t.Fatalf("read-only warm went upstream %d times and wrote %v", got, mr.Keys())
+	}
+}
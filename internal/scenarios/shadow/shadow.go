@@ -0,0 +1,127 @@
+// Package shadow replays served queries through a second scenario engine off
+// the response path, so two cache configurations can be compared on live
+// traffic.
+package shadow
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/composer"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/router"
+)
+
+// Runner implements router.Shadower over a second engine
+type Runner struct {
+	name    string
+	h       router.QueryHandler
+	logger  *slog.Logger
+	timeout time.Duration
+	slots   chan struct{}
+	wg      sync.WaitGroup
+}
+
+var _ router.Shadower = (*Runner)(nil)
+
+// New replays through h, running at most maxInFlight replays at once and
+// cutting each off after timeout; name labels the spatial_shadow_* metrics
+func New(name string, h router.QueryHandler, logger *slog.Logger, maxInFlight int, timeout time.Duration) *Runner {
+	return &Runner{
+		name:    name,
+		h:       h,
+		logger:  logger,
+		timeout: timeout,
+		slots:   make(chan struct{}, max(maxInFlight, 1)),
+	}
+}
+
+// Shadow starts a replay of q and returns at once; when every slot is busy
+// the query is counted as dropped rather than queued
+func (s *Runner) Shadow(r *http.Request, q model.QueryRequest) {
+	select {
+	case s.slots <- struct{}{}:
+	default:
+		observability.IncShadowDropped(s.name)
+		return
+	}
+
+	// the client's request may be gone by the time the replay runs
+	ctx := observability.WithShadow(context.WithoutCancel(r.Context()))
+	req := r.Clone(ctx)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() { <-s.slots }()
+		defer func() {
+			if rec := recover(); rec != nil {
+				s.logger.Error("shadow replay panicked", "shadow", s.name, "panic", rec)
+			}
+		}()
+
+		ctx, cancel := context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+
+		w := &discardWriter{header: http.Header{}, code: http.StatusOK}
+		start := time.Now()
+		s.h.HandleQuery(ctx, w, req.WithContext(ctx), q)
+		hc := hitClass(w)
+		observability.ObserveShadowResponse(s.name, hc, time.Since(start).Seconds())
+		s.logger.Debug("shadow replay",
+			"shadow", s.name,
+			"layer", q.Layer,
+			"status", w.code,
+			"hit_class", hc,
+			"dur", time.Since(start).String(),
+		)
+	}()
+}
+
+// Wait blocks until all started replays have finished
+func (s *Runner) Wait() {
+	s.wg.Wait()
+}
+
+// hitClass maps the replay's X-Cache onto the composer hit classes; bypasses
+// keep their own lowercased class and failures are "error"
+func hitClass(w *discardWriter) string {
+	if w.code >= http.StatusBadRequest {
+		return "error"
+	}
+	switch v := w.header.Get(composer.HeaderXCache); v {
+	case "HIT":
+		return string(composer.HitClassFull)
+	case "PARTIAL":
+		return string(composer.HitClassPartial)
+	case "", "MISS":
+		return string(composer.HitClassMiss)
+	default:
+		return strings.ToLower(v)
+	}
+}
+
+// discardWriter keeps the status and headers of a replay and drops its body
+type discardWriter struct {
+	header http.Header
+	code   int
+	wrote  bool
+}
+
+func (w *discardWriter) Header() http.Header { return w.header }
+
+func (w *discardWriter) WriteHeader(code int) {
+	if !w.wrote {
+		w.code, w.wrote = code, true
+	}
+}
+
+func (w *discardWriter) Write(p []byte) (int, error) {
+	w.wrote = true
+	return len(p), nil
+}
@@ -0,0 +1,136 @@
+package shadow
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/composer"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/router"
+)
+
+type fixedHandler struct {
+	xcache  string
+	body    string
+	release chan struct{} // when set, HandleQuery blocks until it is closed
+	shadow  chan bool     // receives IsShadow(ctx) for each call
+}
+
+func (f *fixedHandler) HandleQuery(ctx context.Context, w http.ResponseWriter, _ *http.Request, _ model.QueryRequest) {
+	if f.shadow != nil {
+		f.shadow <- observability.IsShadow(ctx)
+	}
+	if f.release != nil {
+		<-f.release
+	}
+	w.Header().Set(composer.HeaderXCache, f.xcache)
+	w.Header().Set("X-Engine", f.body)
+	_, _ = io.WriteString(w, f.body)
+}
+
+func counterValue(t *testing.T, reg *prometheus.Registry, name string, labels map[string]string) float64 {
+	t.Helper()
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+	next:
+		for _, m := range mf.GetMetric() {
+			for _, lp := range m.GetLabel() {
+				if want, ok := labels[lp.GetName()]; ok && lp.GetValue() != want {
+					continue next
+				}
+			}
+			if h := m.GetHistogram(); h != nil {
+				return float64(h.GetSampleCount())
+			}
+			return m.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestShadow_RecordsMetricsWithoutTouchingPrimary(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	observability.Init(reg, true)
+	t.Cleanup(func() { observability.Init(nil, false) })
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	primary := &fixedHandler{xcache: "HIT", body: "primary", shadow: make(chan bool, 1)}
+	sec := &fixedHandler{xcache: "MISS", body: "shadow", release: make(chan struct{}), shadow: make(chan bool, 1)}
+	runner := New("res9", sec, logger, 1, time.Second)
+
+	h := router.HandleQueryShadowed(logger, config.FromEnv(), primary, runner)
+	serve := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h(rr, httptest.NewRequest(http.MethodGet, "/query?layer=demo&bbox=11,55,12,56,EPSG:4326", nil))
+		return rr
+	}
+
+	// the primary answers while the shadow replay is still blocked
+	rr := serve()
+	if rr.Code != http.StatusOK || rr.Body.String() != "primary" {
+		t.Fatalf("primary response: status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get(composer.HeaderXCache) != "HIT" || rr.Header().Get("X-Engine") != "primary" {
+		t.Fatalf("primary headers changed: %v", rr.Header())
+	}
+	if <-primary.shadow {
+		t.Fatalf("primary request was marked as shadow")
+	}
+	if !<-sec.shadow {
+		t.Fatalf("shadow replay ctx not marked with observability.WithShadow")
+	}
+
+	// the only slot is busy, so a second query is dropped, not queued
+	if rr := serve(); rr.Body.String() != "primary" {
+		t.Fatalf("second primary response: %q", rr.Body.String())
+	}
+	<-primary.shadow
+	if got := counterValue(t, reg, "spatial_shadow_dropped_total", map[string]string{"shadow": "res9"}); got != 1 {
+		t.Fatalf("dropped=%v want 1", got)
+	}
+
+	close(sec.release)
+	runner.Wait()
+	miss := map[string]string{"shadow": "res9", "hit_class": "miss"}
+	if got := counterValue(t, reg, "spatial_shadow_response_total", miss); got != 1 {
+		t.Fatalf("shadow responses=%v want 1", got)
+	}
+	if got := counterValue(t, reg, "spatial_shadow_response_duration_seconds", miss); got != 1 {
+		t.Fatalf("shadow latency samples=%v want 1", got)
+	}
+}
+
+func TestHitClass_FromXCache(t *testing.T) {
+	for xc, want := range map[string]string{
+		"HIT":         "full_hit",
+		"PARTIAL":     "partial_hit",
+		"MISS":        "miss",
+		"":            "miss",
+		"BYPASS-TINY": "bypass-tiny",
+	} {
+		w := &discardWriter{header: http.Header{}, code: http.StatusOK}
+		w.header.Set(composer.HeaderXCache, xc)
+		if got := hitClass(w); got != want {
+			t.Fatalf("X-Cache %q: hit class %q want %q", xc, got, want)
+		}
+	}
+	w := &discardWriter{header: http.Header{}, code: http.StatusBadGateway}
+	if got := hitClass(w); got != "error" {
+		t.Fatalf("502: hit class %q want error", got)
+	}
+}
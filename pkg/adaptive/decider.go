@@ -1,7 +1,10 @@
 // Package adaptive provides adaptive decider implementations for cache strategies.
 package adaptive
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 type HotnessView interface {
 	Score(cell string) float64
@@ -41,3 +44,22 @@ type Decision struct {
 type Decider interface {
 	Decide(q Query, metrics HotnessView) (Decision, Reason)
 }
+
+// Candidate is one resolution a decider weighed: Score is the signal it
+// compared against Need to accept that resolution
+type Candidate struct {
+	Res   int     `json:"res"`
+	Score float64 `json:"score"`
+	Need  float64 `json:"need"`
+}
+
+func (c Candidate) String() string {
+	return fmt.Sprintf("res%d=%.3g/%.3g", c.Res, c.Score, c.Need)
+}
+
+// SweepDecider is a Decider that can also report the candidate resolutions
+// behind a decision, for diagnostics
+type SweepDecider interface {
+	Decider
+	DecideWithSweep(q Query, metrics HotnessView) (Decision, Reason, []Candidate)
+}
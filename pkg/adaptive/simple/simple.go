@@ -31,6 +31,7 @@ func New(cfg Config, hv adaptive.HotnessView, mapper *h3mapper.Mapper) *SimpleDe
 	}
 	ro := &roHot{v: hv}
 	eng := decsimple.New(ro, cfg.Threshold, cfg.BaseRes, cfg.MinRes, cfg.MaxRes, mapper)
+	eng.Seed = cfg.Seed
 	return &SimpleDecider{
 		cfg:    cfg,
 		engine: eng,
@@ -38,6 +39,17 @@ func New(cfg Config, hv adaptive.HotnessView, mapper *h3mapper.Mapper) *SimpleDe
 }
 
 func (d *SimpleDecider) Decide(q adaptive.Query, view adaptive.HotnessView) (adaptive.Decision, adaptive.Reason) {
+	dec, reason, _ := d.decide(q, view, false)
+	return dec, reason
+}
+
+// DecideWithSweep is Decide that also returns the resolutions weighed for a
+// fill, coarsest first; bypass decisions weigh none
+func (d *SimpleDecider) DecideWithSweep(q adaptive.Query, view adaptive.HotnessView) (adaptive.Decision, adaptive.Reason, []adaptive.Candidate) {
+	return d.decide(q, view, true)
+}
+
+func (d *SimpleDecider) decide(q adaptive.Query, view adaptive.HotnessView, sweep bool) (adaptive.Decision, adaptive.Reason, []adaptive.Candidate) {
 	maxScore := 0.0
 	any := false
 	for _, c := range q.Cells {
@@ -48,14 +60,25 @@ func (d *SimpleDecider) Decide(q adaptive.Query, view adaptive.HotnessView) (ada
 		any = true
 	}
 	if !any {
-		return adaptive.Decision{Type: adaptive.DecisionBypass, Resolution: q.BaseRes}, adaptive.ReasonColdAllCells
+		return adaptive.Decision{Type: adaptive.DecisionBypass, Resolution: q.BaseRes}, adaptive.ReasonColdAllCells, nil
 	}
 
 	if maxScore < d.cfg.Threshold {
-		return adaptive.Decision{Type: adaptive.DecisionBypass, Resolution: q.BaseRes}, adaptive.ReasonColdAllCells
+		return adaptive.Decision{Type: adaptive.DecisionBypass, Resolution: q.BaseRes}, adaptive.ReasonColdAllCells, nil
 	}
 
-	effRes := d.engine.EffectiveResolution(q.Cells)
+	var cands []adaptive.Candidate
+	var effRes int
+	if sweep {
+		var weighed []decsimple.Candidate
+		effRes, weighed = d.engine.ResolutionSweep(q.Cells)
+		cands = make([]adaptive.Candidate, len(weighed))
+		for i, c := range weighed {
+			cands[i] = adaptive.Candidate{Res: c.Res, Score: c.Score, Need: c.Need}
+		}
+	} else {
+		effRes = d.engine.EffectiveResolution(q.Cells)
+	}
 
 	var ttl time.Duration
 	switch {
@@ -79,7 +102,7 @@ func (d *SimpleDecider) Decide(q adaptive.Query, view adaptive.HotnessView) (ada
 		Type:       adaptive.DecisionFill,
 		Resolution: effRes,
 		TTL:        ttl,
-	}, reason
+	}, reason, cands
 }
 
 type roHot struct{ v adaptive.HotnessView }
@@ -90,6 +113,4 @@ func (r *roHot) Inc(string)                {}
 func (r *roHot) Reset(...string)           {}
 func (r *roHot) Score(cell string) float64 { return r.v.Score(cell) }
 
-var _ interface {
-	Decide(adaptive.Query, adaptive.HotnessView) (adaptive.Decision, adaptive.Reason)
-} = (*SimpleDecider)(nil)
+var _ adaptive.SweepDecider = (*SimpleDecider)(nil)
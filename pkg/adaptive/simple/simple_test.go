@@ -4,6 +4,7 @@ import (
 	"testing"
 	"time"
 
+	h3mapper "github.com/mohammed-shakir/h3-spatial-cache/internal/mapper/h3"
 	"github.com/mohammed-shakir/h3-spatial-cache/pkg/adaptive"
 )
 
@@ -51,3 +52,96 @@ func TestSimpleDecider_DeterministicGivenInputs(t *testing.T) {
 		t.Fatalf("decisions should be identical; got %+v/%s vs %+v/%s", dec1, r1, dec2, r2)
 	}
 }
+
+func TestSimpleDecider_EqualScoresTieBreakBySeed(t *testing.T) {
+	m := h3mapper.New()
+	siblings, err := m.ToChildren("872a100d2ffffff", 8)
+	if err != nil || len(siblings) < 2 {
+		t.Fatalf("siblings=%v err=%v", siblings, err)
+	}
+	a, b := siblings[0], siblings[1]
+
+	// two base cells with 14 children between them, exactly half as hot as the
+	// base: neither a majority nor a minority, so the seed has to settle it
+	view := fakeView{a: 1, b: 1}
+	hot := 0
+	for _, c := range []string{a, b} {
+		kids, err := m.ToChildren(c, 9)
+		if err != nil {
+			t.Fatalf("children of %s: %v", c, err)
+		}
+		for _, k := range kids {
+			if hot < 7 {
+				view[k] = 1
+				hot++
+			}
+		}
+	}
+
+	orders := [][]string{{a, b}, {b, a}, {b, a, b, a}}
+	seen := map[int]bool{}
+	for seed := uint64(1); seed <= 32; seed++ {
+		cfg := Config{Threshold: 1, BaseRes: 8, MinRes: 7, MaxRes: 9, TTLWarm: time.Minute, Seed: seed}
+		var first adaptive.Decision
+		var firstSweep []adaptive.Candidate
+		for run, cells := range orders {
+			d := New(cfg, view, m)
+			q := adaptive.Query{Layer: "L", Cells: cells, BaseRes: 8, MinRes: 7, MaxRes: 9}
+			dec, _, sweep := d.DecideWithSweep(q, view)
+			if run == 0 {
+				first, firstSweep = dec, sweep
+				continue
+			}
+			if dec != first {
+				t.Fatalf("seed %d: cells %v decided %+v, %v decided %+v", seed, cells, dec, orders[0], first)
+			}
+			if len(sweep) != len(firstSweep) {
+				t.Fatalf("seed %d: sweep %v vs %v", seed, sweep, firstSweep)
+			}
+			for i := range sweep {
+				if sweep[i] != firstSweep[i] {
+					t.Fatalf("seed %d: sweep %v vs %v", seed, sweep, firstSweep)
+				}
+			}
+		}
+		seen[first.Resolution] = true
+	}
+	if !seen[8] || !seen[9] {
+		t.Fatalf("ties over 32 seeds resolved to %v, want both res 8 and 9", seen)
+	}
+}
+
+func TestSimpleDecider_SweepListsCandidates(t *testing.T) {
+	const cell = "882a100d2bfffff"
+	cfg := Config{Threshold: 1.0, BaseRes: 8, MinRes: 7, MaxRes: 9, TTLWarm: time.Minute}
+	view := fakeView{cell: 1.5}
+	d := New(cfg, view, nil)
+	q := adaptive.Query{Layer: "L", Cells: []string{cell}, BaseRes: 8, MinRes: 7, MaxRes: 9}
+
+	dec, reason, sweep := d.DecideWithSweep(q, view)
+	if plain, plainReason := d.Decide(q, view); plain != dec || plainReason != reason {
+		t.Fatalf("sweep changed the decision: %+v/%s vs %+v/%s", dec, reason, plain, plainReason)
+	}
+	if len(sweep) != 3 {
+		t.Fatalf("candidates=%v want res 7, 8 and 9", sweep)
+	}
+	for i, want := range []adaptive.Candidate{
+		{Res: 7, Score: 0, Need: 2},
+		{Res: 8, Score: 1.5, Need: 1},
+		{Res: 9, Score: 0, Need: 0.5},
+	} {
+		if sweep[i] != want {
+			t.Fatalf("candidate %d=%+v want %+v", i, sweep[i], want)
+		}
+	}
+	if dec.Resolution != 8 {
+		t.Fatalf("resolution=%d want 8", dec.Resolution)
+	}
+	if got := sweep[1].String(); got != "res8=1.5/1" {
+		t.Fatalf("String()=%q", got)
+	}
+
+	if _, _, sweep := d.DecideWithSweep(q, fakeView{}); sweep != nil {
+		t.Fatalf("bypass should weigh no resolutions, got %v", sweep)
+	}
+}
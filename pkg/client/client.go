@@ -0,0 +1,193 @@
+// Package client is a Go client for the middleware's /query endpoint, for
+// services that want features without hand-rolling the HTTP contract.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
+)
+
+// Request types are shared with the server so both sides agree on the contract
+type (
+	QueryRequest = model.QueryRequest
+	BBox         = model.BBox
+	Polygon      = model.Polygon
+	SortKey      = model.SortKey
+)
+
+// FeatureCollection is a decoded GeoJSON response; features are left raw
+type FeatureCollection struct {
+	Type     string            `json:"type"`
+	Features []json.RawMessage `json:"features"`
+	// Cache is the X-Cache header, e.g. HIT, MISS or PARTIAL
+	Cache string `json:"-"`
+}
+
+// StatusError is returned for non-2xx responses once retries are exhausted
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("query: status %d: %s", e.StatusCode, e.Body)
+}
+
+type Client struct {
+	base    *url.URL
+	http    *http.Client
+	retries int
+	backoff time.Duration
+}
+
+type Option func(*Client)
+
+func WithHTTPClient(h *http.Client) Option {
+	return func(c *Client) { c.http = h }
+}
+
+// WithRetries retries network errors, 429 and 5xx up to n more times,
+// doubling backoff between attempts
+func WithRetries(n int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = max(n, 0)
+		c.backoff = backoff
+	}
+}
+
+// New builds a client for the middleware at baseURL, e.g. http://localhost:8090
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("parse base url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("base url %q: scheme must be http or https", baseURL)
+	}
+	c := &Client{
+		base:    u,
+		http:    &http.Client{Timeout: 30 * time.Second},
+		retries: 2,
+		backoff: 100 * time.Millisecond,
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c, nil
+}
+
+const maxErrorBody = 4 << 10
+
+// Query runs q against /query and decodes the GeoJSON FeatureCollection
+func (c *Client) Query(ctx context.Context, q QueryRequest) (FeatureCollection, error) {
+	if strings.TrimSpace(q.Layer) == "" {
+		return FeatureCollection{}, errors.New("query: layer is required")
+	}
+	u := c.base.JoinPath("query")
+	u.RawQuery = encodeQuery(q).Encode()
+
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		fc, retry, err := c.do(ctx, u.String(), q.Headers)
+		if err == nil || !retry || attempt >= c.retries {
+			return fc, err
+		}
+		select {
+		case <-ctx.Done():
+			return FeatureCollection{}, fmt.Errorf("query: %w", ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// do makes one attempt; retry reports whether a failure is worth repeating
+func (c *Client) do(ctx context.Context, u string, headers map[string]string) (FeatureCollection, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return FeatureCollection{}, false, fmt.Errorf("query: build request: %w", err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Accept", "application/geo+json, application/json;q=0.9")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return FeatureCollection{}, ctx.Err() == nil, fmt.Errorf("query: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return FeatureCollection{}, retry, &StatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+
+	mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mt != "application/geo+json" && mt != "application/json" {
+		return FeatureCollection{}, false, fmt.Errorf("query: unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+	var fc FeatureCollection
+	if err := json.NewDecoder(resp.Body).Decode(&fc); err != nil {
+		return FeatureCollection{}, false, fmt.Errorf("query: decode response: %w", err)
+	}
+	if fc.Type != "FeatureCollection" {
+		return FeatureCollection{}, false, fmt.Errorf("query: unexpected GeoJSON type %q", fc.Type)
+	}
+	fc.Cache = resp.Header.Get("X-Cache")
+	return fc, false, nil
+}
+
+// encodeQuery renders q in the parameter syntax router.ParseQueryRequest reads
+func encodeQuery(q QueryRequest) url.Values {
+	v := url.Values{}
+	v.Set("layer", q.Layer)
+	if q.BBox != nil {
+		v.Set("bbox", q.BBox.String())
+	}
+	if q.Polygon != nil {
+		v.Set("polygon", q.Polygon.GeoJSON)
+	}
+	if q.Filters != "" {
+		v.Set("filters", q.Filters)
+	}
+	if len(q.Sort) > 0 {
+		keys := make([]string, 0, len(q.Sort))
+		for _, k := range q.Sort {
+			s := k.Property
+			if k.TypeHint != "" {
+				s += ":" + k.TypeHint
+			}
+			if k.NullsFirst {
+				s += ":nullsfirst"
+			}
+			if k.Desc {
+				s = "-" + s
+			}
+			keys = append(keys, s)
+		}
+		v.Set("sortby", strings.Join(keys, ","))
+	}
+	if q.GeomPrecision > 0 {
+		v.Set("geomPrecision", strconv.Itoa(q.GeomPrecision))
+	}
+	if !q.CreatedAfter.IsZero() {
+		v.Set("created_after", q.CreatedAfter.Format(time.RFC3339Nano))
+	}
+	if !q.CreatedBefore.IsZero() {
+		v.Set("created_before", q.CreatedBefore.Format(time.RFC3339Nano))
+	}
+	return v
+}
@@ -0,0 +1,147 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/router"
+)
+
+const fcBody = `{"type":"FeatureCollection","features":[{"type":"Feature","id":"a","geometry":null,"properties":{}}]}`
+
+// emulates /query by parsing with the server's own parser
+func queryServer(t *testing.T, got *QueryRequest, fail *atomic.Int32) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/query", func(w http.ResponseWriter, r *http.Request) {
+		if fail != nil && fail.Add(-1) >= 0 {
+			http.Error(w, "upstream down", http.StatusServiceUnavailable)
+			return
+		}
+		q, _, err := router.ParseQueryRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if got != nil {
+			*got = q
+		}
+		if !strings.Contains(r.Header.Get("Accept"), "application/geo+json") {
+			http.Error(w, "not acceptable", http.StatusNotAcceptable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/geo+json")
+		w.Header().Set("X-Cache", "HIT")
+		_, _ = w.Write([]byte(fcBody))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestQuery_RoundTripsRequest(t *testing.T) {
+	var got QueryRequest
+	srv := queryServer(t, &got, nil)
+	c, err := New(srv.URL)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	after := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	want := QueryRequest{
+		Layer:         "demo:places",
+		BBox:          WGS84BBox(11.9, 57.6, 12.1, 57.8),
+		Filters:       "name = 'x'",
+		Sort:          []SortKey{{Property: "score", Desc: true, TypeHint: "number"}, {Property: "ts", TypeHint: "time", NullsFirst: true}},
+		GeomPrecision: 5,
+		CreatedAfter:  after,
+		CreatedBefore: after.Add(time.Hour),
+	}
+	fc, err := c.Query(context.Background(), want)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(fc.Features) != 1 || fc.Cache != "HIT" {
+		t.Fatalf("got %d features, cache %q", len(fc.Features), fc.Cache)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("server parsed\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestQuery_PolygonHelper(t *testing.T) {
+	var got QueryRequest
+	srv := queryServer(t, &got, nil)
+	c, _ := New(srv.URL)
+
+	poly, err := PolygonFromRing([][2]float64{{12, 57}, {12.1, 57}, {12.1, 57.1}})
+	if err != nil {
+		t.Fatalf("PolygonFromRing: %v", err)
+	}
+	if _, err := c.Query(context.Background(), QueryRequest{Layer: "demo:places", Polygon: poly}); err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if got.Polygon == nil || got.Polygon.GeoJSON != poly.GeoJSON {
+		t.Fatalf("polygon = %+v, want %s", got.Polygon, poly.GeoJSON)
+	}
+	if _, err := PolygonFromRing([][2]float64{{0, 0}, {1, 1}}); err == nil {
+		t.Fatalf("want error for degenerate ring")
+	}
+}
+
+func TestQuery_RetriesTransientErrors(t *testing.T) {
+	var fail atomic.Int32
+	fail.Store(2)
+	srv := queryServer(t, nil, &fail)
+	c, _ := New(srv.URL, WithRetries(2, time.Millisecond))
+
+	if _, err := c.Query(context.Background(), QueryRequest{Layer: "demo:places"}); err != nil {
+		t.Fatalf("Query after two 503s: %v", err)
+	}
+
+	fail.Store(3)
+	_, err := c.Query(context.Background(), QueryRequest{Layer: "demo:places"})
+	var se *StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("want 503 StatusError once retries run out, got %v", err)
+	}
+}
+
+func TestQuery_DoesNotRetryBadRequest(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		http.Error(w, "invalid bbox", http.StatusBadRequest)
+	}))
+	t.Cleanup(srv.Close)
+	c, _ := New(srv.URL, WithRetries(3, time.Millisecond))
+
+	_, err := c.Query(context.Background(), QueryRequest{Layer: "demo:places"})
+	var se *StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusBadRequest || se.Body != "invalid bbox" {
+		t.Fatalf("want 400 StatusError, got %v", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("calls = %d, want 1", n)
+	}
+}
+
+func TestQuery_RejectsUnexpectedContentType(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html></html>"))
+	}))
+	t.Cleanup(srv.Close)
+	c, _ := New(srv.URL)
+
+	if _, err := c.Query(context.Background(), QueryRequest{Layer: "demo:places"}); err == nil || !strings.Contains(err.Error(), "content type") {
+		t.Fatalf("want content type error, got %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// WGS84BBox returns an EPSG:4326 bbox, the only SRID the server accepts
+func WGS84BBox(minLon, minLat, maxLon, maxLat float64) *BBox {
+	return &BBox{X1: minLon, Y1: minLat, X2: maxLon, Y2: maxLat, SRID: "EPSG:4326"}
+}
+
+// PolygonFromRing builds a GeoJSON Polygon from one [lon, lat] exterior ring,
+// closing it when the last point differs from the first
+func PolygonFromRing(ring [][2]float64) (*Polygon, error) {
+	if len(ring) > 0 && ring[0] != ring[len(ring)-1] {
+		ring = append(ring[:len(ring):len(ring)], ring[0])
+	}
+	if len(ring) < 4 {
+		return nil, errors.New("polygon ring needs at least 3 distinct points")
+	}
+	b, err := json.Marshal(struct {
+		Type        string         `json:"type"`
+		Coordinates [][][2]float64 `json:"coordinates"`
+	}{"Polygon", [][][2]float64{ring}})
+	if err != nil {
+		return nil, fmt.Errorf("encode polygon: %w", err)
+	}
+	return &Polygon{GeoJSON: string(b)}, nil
+}
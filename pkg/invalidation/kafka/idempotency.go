@@ -31,3 +31,13 @@ func (d *versionDedupe) shouldApply(key string, v uint64) bool {
 	d.lru.Add(key, v)
 	return true
 }
+
+// forget drops v for key if it is still the last one seen, so a message whose
+// apply failed is applied again when it is retried
+func (d *versionDedupe) forget(key string, v uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if last, ok := d.lru.Peek(key); ok && last == v {
+		d.lru.Remove(key)
+	}
+}
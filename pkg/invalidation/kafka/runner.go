@@ -6,19 +6,24 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/IBM/sarama"
 	"github.com/prometheus/client_golang/prometheus"
+	h3 "github.com/uber/h3-go/v4"
 
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/aggregate/geojsonagg"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/cellindex"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/featurestore"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/keys"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/invalidation"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/invalidation/consumeretry"
 )
 
 type HotnessResetter interface {
@@ -34,6 +39,12 @@ type CellIndex interface {
 	DelCells(ctx context.Context, layer string, res int, cells []string, filters model.Filters) error
 }
 
+// ScopeLister is implemented by cell indexes and feature stores that can list
+// the header scopes (keys.ScopedLayer values) holding entries of a layer
+type ScopeLister interface {
+	Scopes(ctx context.Context, layer string) ([]string, error)
+}
+
 type Runner struct {
 	log      *slog.Logger
 	cfg      InvalidationConfig
@@ -41,6 +52,7 @@ type Runner struct {
 	mapper   Mapper
 	resRange []int
 	idx      CellIndex
+	fs       featurestore.FeatureStore
 	ms       *metricSet
 	ver      *versionDedupe
 	assigned atomic.Bool
@@ -49,6 +61,8 @@ type Runner struct {
 	wg       sync.WaitGroup
 	cancel   context.CancelFunc
 	hot      HotnessResetter
+	rate     *layerRate
+	newGroup func(brokers []string, groupID string, cfg *sarama.Config) (sarama.ConsumerGroup, error)
 }
 
 type Options struct {
@@ -57,6 +71,8 @@ type Options struct {
 	ResRange  []int
 	Hotness   HotnessResetter
 	CellIndex cellindex.CellIndex
+	// Features lets id invalidations evict feature payloads
+	Features featurestore.FeatureStore
 }
 
 func New(cfg InvalidationConfig, c cache.Interface, m Mapper, opts Options) *Runner {
@@ -74,10 +90,17 @@ func New(cfg InvalidationConfig, c cache.Interface, m Mapper, opts Options) *Run
 		assign:   map[int32]struct{}{},
 		hot:      opts.Hotness,
 		idx:      opts.CellIndex,
+		fs:       opts.Features,
+		newGroup: sarama.NewConsumerGroup,
 	}
 	if len(r.resRange) == 0 {
 		r.resRange = []int{8}
 	}
+	window := cfg.RateWindow
+	if window <= 0 {
+		window = time.Minute
+	}
+	r.rate = newLayerRate(window)
 	return r
 }
 
@@ -105,11 +128,12 @@ func (r *Runner) Start(ctx context.Context) error {
 	}
 	cfg.Consumer.Return.Errors = true
 
-	group, err := sarama.NewConsumerGroup(r.cfg.Brokers, r.cfg.GroupID, cfg)
+	group, err := r.newGroup(r.cfg.Brokers, r.cfg.GroupID, cfg)
 	if err != nil {
 		return fmt.Errorf("consumer group: %w", err)
 	}
 
+	topics := r.cfg.topicList()
 	h := &groupHandler{
 		setup: func(sess sarama.ConsumerGroupSession) {
 			claims := sess.Claims()
@@ -130,6 +154,12 @@ func (r *Runner) Start(ctx context.Context) error {
 			r.assignMu.Unlock()
 		},
 		process: r.handleMessage,
+		retry: consumeretry.Policy{
+			RetryInline: r.cfg.OnError == OnErrorRetryInline,
+			Backoff:     r.cfg.RetryBackoff,
+			MaxBackoff:  r.cfg.RetryMaxBackoff,
+			Logger:      r.log,
+		},
 	}
 
 	r.wg.Add(1)
@@ -142,7 +172,7 @@ func (r *Runner) Start(ctx context.Context) error {
 		}()
 
 		for {
-			if err := group.Consume(ctx, []string{r.cfg.Topic}, h); err != nil {
+			if err := group.Consume(ctx, topics, h); err != nil {
 				r.log.Error("kafka consume error", "err", err)
 				select {
 				case <-time.After(2 * time.Second):
@@ -165,7 +195,7 @@ func (r *Runner) Start(ctx context.Context) error {
 	}()
 
 	r.log.Info("kafka invalidation runner started",
-		"topic", r.cfg.Topic, "group", r.cfg.GroupID, "brokers", r.cfg.Brokers)
+		"topics", topics, "group", r.cfg.GroupID, "brokers", r.cfg.Brokers)
 	return nil
 }
 
@@ -194,55 +224,123 @@ func (r *Runner) handleMessage(ctx context.Context, msg *sarama.ConsumerMessage)
 
 	if !msg.Timestamp.IsZero() {
 		lag := time.Since(msg.Timestamp).Seconds()
-		r.ms.lagGauge.Set(lag)
+		r.ms.lagGauge.WithLabelValues(msg.Topic).Set(lag)
 		observability.SetInvalidationLagSeconds(lag)
 	}
 
 	var w WireEvent
-	if err := json.Unmarshal(msg.Value, &w); err == nil && (w.Key != "" || len(w.H3Cells) > 0) {
+	if err := json.Unmarshal(msg.Value, &w); err == nil && (w.Key != "" || len(w.H3Cells) > 0 || len(w.IDs) > 0 || w.Op == OpMarkStale && w.Layer != "") {
+		w.H3Cells = r.validCells(w.Layer, w.H3Cells)
 		ts := w.TS
 		if ts.IsZero() {
 			ts = msg.Timestamp
 		}
-		err := r.applyWire(ctx, w, ts)
-		r.observe(w.Op, err, time.Since(start))
-		if err == nil && w.Layer != "" && !ts.IsZero() {
+		applied, err := r.applyWire(ctx, w, ts)
+		r.observe(msg.Topic, w.Op, err, time.Since(start))
+		// an event left with nothing to apply, after cell validation or
+		// version dedup, changes no cache entry, so it neither makes the layer
+		// stale nor counts toward its rate
+		if err != nil || !applied {
+			return err
+		}
+		// a patched feature is current again, so the layer doesn't turn stale
+		if w.Layer != "" && !ts.IsZero() && w.Op != OpPatch {
 			observability.SetLayerInvalidatedAt(w.Layer, ts)
 		}
-		return err
+		r.trackRate(w.Layer)
+		return nil
 	}
 
 	var ev invalidation.Event
 	if err := json.Unmarshal(msg.Value, &ev); err != nil {
-		r.ms.msgs.WithLabelValues("error").Inc()
-		return fmt.Errorf("decode: %w", err)
+		r.ms.msgs.WithLabelValues(msg.Topic, "error").Inc()
+		return consumeretry.Permanent(fmt.Errorf("decode: %w", err))
 	}
 	if err := ev.Validate(); err != nil {
-		r.ms.msgs.WithLabelValues("error").Inc()
-		return fmt.Errorf("validate: %w", err)
+		r.ms.msgs.WithLabelValues(msg.Topic, "error").Inc()
+		return consumeretry.Permanent(fmt.Errorf("validate: %w", err))
 	}
 	ts := msg.Timestamp
-	err := r.applySpatial(ctx, ev)
-	r.observe(ev.Op, err, time.Since(start))
-	if err == nil && ev.Layer != "" && !ts.IsZero() {
+	applied, err := r.applySpatial(ctx, ev)
+	r.observe(msg.Topic, ev.Op, err, time.Since(start))
+	if err != nil || !applied {
+		return err
+	}
+	if ev.Layer != "" && !ts.IsZero() {
 		observability.SetLayerInvalidatedAt(ev.Layer, ts)
 	}
-	return err
+	r.trackRate(ev.Layer)
+	return nil
 }
 
-func (r *Runner) observe(op string, err error, dur time.Duration) {
+// validCells keeps the cells that parse as valid H3 indexes, in canonical
+// form; producers are untrusted, so the rest are counted and dropped before
+// they can reach key building or polygon lookups
+func (r *Runner) validCells(layer string, cells []string) []string {
+	out := cells[:0]
+	for _, s := range cells {
+		var c h3.Cell
+		if err := c.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil || !c.IsValid() {
+			observability.IncKafkaConsumerError("bad_cell")
+			r.log.Debug("skipping invalid h3 cell", "layer", layer, "cell", s)
+			continue
+		}
+		out = append(out, c.String())
+	}
+	return out
+}
+
+// trackRate updates the per-layer rate gauge and warns on invalidation storms,
+// which usually mean an upstream bulk reload
+func (r *Runner) trackRate(layer string) {
+	if layer == "" {
+		return
+	}
+	now := time.Now()
+	rate := r.rate.record(layer, now)
+	r.ms.rate.WithLabelValues(layer).Set(rate)
+	if r.cfg.RateWarnPerSec > 0 && rate > r.cfg.RateWarnPerSec && r.rate.shouldWarn(layer, now) {
+		r.log.Warn("invalidation storm",
+			"layer", layer,
+			"rate_per_sec", rate,
+			"threshold", r.cfg.RateWarnPerSec,
+			"window", r.rate.window.String(),
+		)
+	}
+}
+
+func (r *Runner) observe(topic, op string, err error, dur time.Duration) {
 	if op == "" {
 		op = "unknown"
 	}
 	if err != nil {
-		r.ms.msgs.WithLabelValues("error").Inc()
+		r.ms.msgs.WithLabelValues(topic, "error").Inc()
 	} else {
-		r.ms.msgs.WithLabelValues("ok").Inc()
+		r.ms.msgs.WithLabelValues(topic, "ok").Inc()
 	}
 	r.ms.proc.WithLabelValues(op).Observe(dur.Seconds())
 }
 
-func (r *Runner) applyWire(ctx context.Context, w WireEvent, _ time.Time) error {
+// applyWire applies w and reports whether anything was applied; false means
+// every cell, key or id was invalid or already applied at w.Version
+func (r *Runner) applyWire(ctx context.Context, w WireEvent, _ time.Time) (bool, error) {
+	if w.Op == OpMarkStale {
+		return r.applyMarkStale(w), nil
+	}
+	if w.Op == OpPatch {
+		return r.applyPatch(ctx, w)
+	}
+	idsApplied := false
+	if len(w.IDs) > 0 {
+		var err error
+		if idsApplied, err = r.applyIDs(ctx, w); err != nil {
+			return false, err
+		}
+		if w.Key == "" && len(w.H3Cells) == 0 {
+			return idsApplied, nil
+		}
+	}
+
 	var keysToDel []string
 	appliedSet := make(map[string]struct{})
 
@@ -256,12 +354,12 @@ func (r *Runner) applyWire(ctx context.Context, w WireEvent, _ time.Time) error
 	} else {
 		for _, cell := range w.H3Cells {
 			for _, rr := range res {
-				keysToDel = append(keysToDel, keys.Key(w.Layer, rr, cell, ""))
+				keysToDel = append(keysToDel, keys.Key(w.Layer, rr, cell, w.Filters))
 			}
 		}
 	}
 
-	applied := 0
+	var appliedKeys []string
 	perCell := 1
 	if len(w.H3Cells) > 0 {
 		perCell = len(res)
@@ -271,7 +369,7 @@ func (r *Runner) applyWire(ctx context.Context, w WireEvent, _ time.Time) error
 			r.ms.apply.WithLabelValues("skip_version").Inc()
 			continue
 		}
-		applied++
+		appliedKeys = append(appliedKeys, k)
 		if len(w.H3Cells) > 0 {
 			cellIdx := i / perCell
 			if cellIdx >= 0 && cellIdx < len(w.H3Cells) {
@@ -279,14 +377,17 @@ func (r *Runner) applyWire(ctx context.Context, w WireEvent, _ time.Time) error
 			}
 		}
 	}
-	if applied == 0 {
-		return nil
+	if len(appliedKeys) == 0 {
+		return idsApplied, nil
 	}
 
 	if err := r.cache.Del(keysToDel...); err != nil {
-		return fmt.Errorf("redis del (%d keys): %w", len(keysToDel), err)
+		for _, k := range appliedKeys {
+			r.ver.forget(k, w.Version)
+		}
+		return false, fmt.Errorf("redis del (%d keys): %w", len(keysToDel), err)
 	}
-	r.ms.apply.WithLabelValues("delete").Add(float64(applied))
+	r.ms.apply.WithLabelValues("delete").Add(float64(len(appliedKeys)))
 
 	if r.idx != nil && len(appliedSet) > 0 && w.Layer != "" {
 		cells := make([]string, 0, len(appliedSet))
@@ -294,14 +395,16 @@ func (r *Runner) applyWire(ctx context.Context, w WireEvent, _ time.Time) error
 			cells = append(cells, c)
 		}
 
-		for _, rr := range res {
-			if err := r.idx.DelCells(ctx, w.Layer, rr, cells, ""); err != nil {
-				r.log.Warn("cell index delete failed during wire invalidation",
-					"layer", w.Layer,
-					"res", rr,
-					"cells", len(cells),
-					"err", err,
-				)
+		for _, scope := range r.scopes(ctx, w.Layer) {
+			for _, rr := range res {
+				if err := r.idx.DelCells(ctx, scope, rr, cells, model.Filters(w.Filters)); err != nil {
+					r.log.Warn("cell index delete failed during wire invalidation",
+						"layer", scope,
+						"res", rr,
+						"cells", len(cells),
+						"err", err,
+					)
+				}
 			}
 		}
 	}
@@ -313,10 +416,208 @@ func (r *Runner) applyWire(ctx context.Context, w WireEvent, _ time.Time) error
 		}
 		r.hot.Reset(uniq...)
 	}
+	return true, nil
+}
+
+// scopes returns layer followed by every header scope the cell index or
+// feature store holds entries under, so passthrough headers such as
+// Accept-Language can't keep a localized copy alive past an invalidation. A
+// store that fails to list is logged and the scopes found so far are used
+func (r *Runner) scopes(ctx context.Context, layer string) []string {
+	out := []string{layer}
+	seen := map[string]struct{}{layer: {}}
+	for _, src := range []any{r.idx, r.fs} {
+		sl, ok := src.(ScopeLister)
+		if !ok {
+			continue
+		}
+		found, err := sl.Scopes(ctx, layer)
+		if err != nil {
+			r.log.Warn("listing header scopes failed, invalidating the ones found",
+				"layer", layer,
+				"err", err,
+			)
+		}
+		for _, sc := range found {
+			if _, dup := seen[sc]; !dup {
+				seen[sc] = struct{}{}
+				out = append(out, sc)
+			}
+		}
+	}
+	return out
+}
+
+// applyMarkStale leaves every key in place; handleMessage then bumps the
+// layer invalidation timestamp, so reads of cells filled before it are served
+// and counted as stale rather than refetched cold. It reports false for an
+// event already applied at its version
+func (r *Runner) applyMarkStale(w WireEvent) bool {
+	if w.Layer == "" {
+		return false
+	}
+	if !r.ver.shouldApply("stale:"+w.Layer, w.Version) {
+		r.ms.apply.WithLabelValues("skip_version").Inc()
+		return false
+	}
+	r.ms.apply.WithLabelValues(OpMarkStale).Inc()
+	observability.IncSpatialInvalidation("kafka", OpMarkStale)
+	return true
+}
+
+// applyIDs deletes the features' payloads and every cell index entry that
+// references them, so those cells refill from upstream on the next read. It
+// reports whether any id was new at w.Version
+func (r *Runner) applyIDs(ctx context.Context, w WireEvent) (bool, error) {
+	if w.Layer == "" {
+		observability.IncKafkaConsumerError("bad_ids")
+		r.log.Warn("skipping id invalidation without a layer", "ids", len(w.IDs))
+		return false, nil
+	}
+	ids := r.newIDs(w)
+	if err := r.evictIDs(ctx, w.Layer, ids); err != nil {
+		r.forgetIDs(w.Layer, ids, w.Version)
+		return false, err
+	}
+	return len(ids) > 0, nil
+}
+
+// newIDs maps w's ids onto store ids, keeping those not yet applied at or
+// above w.Version
+func (r *Runner) newIDs(w WireEvent) []string {
+	var ids []string
+	for _, id := range storeIDs(w.IDs) {
+		if !r.ver.shouldApply("feat:"+w.Layer+":"+id, w.Version) {
+			r.ms.apply.WithLabelValues("skip_version").Inc()
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// forgetIDs releases the versions newIDs recorded for ids, so a retry of a
+// failed eviction isn't skipped as already applied
+func (r *Runner) forgetIDs(layer string, ids []string, v uint64) {
+	for _, id := range ids {
+		r.ver.forget("feat:"+layer+":"+id, v)
+	}
+}
+
+// evictIDs deletes the payloads of store ids, in every header scope, and the
+// cell index entries that reference them
+func (r *Runner) evictIDs(ctx context.Context, layer string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if d, ok := r.fs.(featurestore.Deleter); ok {
+		for _, scope := range r.scopes(ctx, layer) {
+			if err := d.DelFeatures(ctx, scope, ids); err != nil {
+				return fmt.Errorf("feature del (%d ids in %s): %w", len(ids), scope, err)
+			}
+		}
+	}
+	r.ms.apply.WithLabelValues("delete").Add(float64(len(ids)))
+
+	if d, ok := r.idx.(cellindex.IDDropper); ok {
+		if _, err := d.DropIDs(ctx, layer, ids); err != nil {
+			r.log.Warn("cell index delete failed during id invalidation",
+				"layer", layer,
+				"ids", len(ids),
+				"err", err,
+			)
+		}
+	}
 	return nil
 }
 
-func (r *Runner) applySpatial(ctx context.Context, ev invalidation.Event) error {
+// applyPatch rewrites the properties of each cached feature in w.IDs in
+// place, in every header scope, so cells referencing it keep serving from
+// cache. A feature that isn't cached under any of its id forms, or a store
+// that can't patch, falls back to eviction so no cell can go on serving the
+// old properties. It reports whether any id was new at w.Version
+func (r *Runner) applyPatch(ctx context.Context, w WireEvent) (bool, error) {
+	if w.Layer == "" || len(w.IDs) == 0 {
+		observability.IncKafkaConsumerError("bad_patch")
+		r.log.Warn("skipping patch without a layer or ids", "layer", w.Layer, "ids", len(w.IDs))
+		return false, nil
+	}
+	p, ok := r.fs.(featurestore.Patcher)
+	if !ok || len(w.Properties) == 0 {
+		return r.applyIDs(ctx, w)
+	}
+
+	scopes := r.scopes(ctx, w.Layer)
+	var evict []string
+	applied := false
+	for _, raw := range w.IDs {
+		ids := r.newIDs(WireEvent{Layer: w.Layer, IDs: []string{raw}, Version: w.Version})
+		if len(ids) == 0 {
+			continue
+		}
+		applied = true
+		patched := r.patchScopes(ctx, p, scopes, ids, w.Properties)
+		if patched {
+			r.ms.apply.WithLabelValues(OpPatch).Inc()
+			continue
+		}
+		evict = append(evict, ids...)
+	}
+	if err := r.evictIDs(ctx, w.Layer, evict); err != nil {
+		r.forgetIDs(w.Layer, evict, w.Version)
+		return false, err
+	}
+	return applied, nil
+}
+
+// patchScopes patches every id form in every header scope, reporting whether
+// any copy was patched; a failure anywhere reports false, so the feature is
+// evicted from all of them instead of some scopes serving the old properties
+func (r *Runner) patchScopes(ctx context.Context, p featurestore.Patcher, scopes, ids []string, props map[string]json.RawMessage) bool {
+	patched := false
+	for _, scope := range scopes {
+		for _, id := range ids {
+			found, err := p.PatchProperties(ctx, scope, id, props)
+			if err != nil {
+				r.log.Warn("feature patch failed, evicting",
+					"layer", scope,
+					"id", id,
+					"err", err,
+				)
+				return false
+			}
+			patched = patched || found
+		}
+	}
+	return patched
+}
+
+// storeIDs maps wire ids onto the canonical ids features are stored under;
+// already canonical ids (s:, n:, gh:) pass through, and a plain id that
+// parses as a number also yields its numeric form
+func storeIDs(raw []string) []string {
+	out := make([]string, 0, len(raw))
+	for _, id := range raw {
+		id = strings.TrimSpace(id)
+		switch {
+		case id == "":
+			continue
+		case strings.HasPrefix(id, "s:"), strings.HasPrefix(id, "n:"), strings.HasPrefix(id, "gh:"):
+			out = append(out, id)
+			continue
+		}
+		out = append(out, "s:"+id)
+		if k, err := geojsonagg.CanonicalIDKey(json.RawMessage(id)); err == nil && strings.HasPrefix(k, "n:") {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// applySpatial deletes the keys of every cell ev's footprint covers and
+// reports false when it covers none
+func (r *Runner) applySpatial(ctx context.Context, ev invalidation.Event) (bool, error) {
 	cellRes := 0
 	for _, rr := range r.resRange {
 		if rr > cellRes {
@@ -329,40 +630,42 @@ func (r *Runner) applySpatial(ctx context.Context, ev invalidation.Event) error
 		b := model.BBox{X1: ev.BBox.X1, Y1: ev.BBox.Y1, X2: ev.BBox.X2, Y2: ev.BBox.Y2, SRID: ev.BBox.SRID}
 		c, err := r.mapper.CellsForBBox(b, cellRes)
 		if err != nil {
-			return fmt.Errorf("CellsForBBox: %w", err)
+			return false, consumeretry.Permanent(fmt.Errorf("CellsForBBox: %w", err))
 		}
 		cells = c
 	default:
 		c, err := r.mapper.CellsForPolygon(model.Polygon{GeoJSON: string(ev.Geometry)}, cellRes)
 		if err != nil {
-			return fmt.Errorf("CellsForPolygon: %w", err)
+			return false, consumeretry.Permanent(fmt.Errorf("CellsForPolygon: %w", err))
 		}
 		cells = c
 	}
 	if len(cells) == 0 {
-		return nil
+		return false, nil
 	}
 
 	var ks []string
 	for _, rr := range r.resRange {
 		for _, c := range cells {
-			ks = append(ks, keys.Key(ev.Layer, rr, c, ""))
+			ks = append(ks, keys.Key(ev.Layer, rr, c, ev.Filters))
 		}
 	}
 	if err := r.cache.Del(ks...); err != nil {
-		return fmt.Errorf("redis del (%d keys): %w", len(ks), err)
+		return false, fmt.Errorf("redis del (%d keys): %w", len(ks), err)
 	}
 	r.ms.apply.WithLabelValues("delete").Add(float64(len(ks)))
 
 	if r.idx != nil && ev.Layer != "" {
-		for _, rr := range r.resRange {
-			if err := r.idx.DelCells(ctx, ev.Layer, rr, []string(cells), ""); err != nil {
-				r.log.Warn("cell index delete failed during spatial invalidation",
-					"layer", ev.Layer,
-					"res", rr,
-					"cells", len(cells),
-					"err", err,
-				)
+		for _, scope := range r.scopes(ctx, ev.Layer) {
+			for _, rr := range r.resRange {
+				if err := r.idx.DelCells(ctx, scope, rr, []string(cells), model.Filters(ev.Filters)); err != nil {
+					r.log.Warn("cell index delete failed during spatial invalidation",
+						"layer", scope,
+						"res", rr,
+						"cells", len(cells),
+						"err", err,
+					)
+				}
 			}
 		}
 	}
@@ -370,36 +673,5 @@ func (r *Runner) applySpatial(ctx context.Context, ev invalidation.Event) error
 	if r.hot != nil {
 		r.hot.Reset(cells...)
 	}
-	return nil
-}
-
-type groupHandler struct {
-	setup   func(sarama.ConsumerGroupSession)
-	cleanup func(sarama.ConsumerGroupSession)
-	process func(context.Context, *sarama.ConsumerMessage) error
-}
-
-func (h *groupHandler) Setup(sess sarama.ConsumerGroupSession) error {
-	if h.setup != nil {
-		h.setup(sess)
-	}
-	return nil
-}
-
-func (h *groupHandler) Cleanup(sess sarama.ConsumerGroupSession) error {
-	if h.cleanup != nil {
-		h.cleanup(sess)
-	}
-	return nil
-}
-
-func (h *groupHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
-	ctx := sess.Context()
-	for msg := range claim.Messages() {
-		if err := h.process(ctx, msg); err != nil {
-			return err
-		}
-		sess.MarkMessage(msg, "")
-	}
-	return nil
+	return true, nil
 }
@@ -2,8 +2,11 @@ package kafka
 
 import (
 	"os"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/invalidation/consumeretry"
 )
 
 type Driver string
@@ -13,6 +16,14 @@ const (
 	DriverKafka Driver = "kafka"
 )
 
+// Strategies for a message whose processing fails
+const (
+	// OnErrorFailClaim returns the error from ConsumeClaim, ending the claim
+	OnErrorFailClaim = consumeretry.FailClaim
+	// OnErrorRetryInline retries the same message with backoff inside the claim
+	OnErrorRetryInline = consumeretry.RetryInline
+)
+
 type TLSConfig struct {
 	Enable     bool   `yaml:"enable"`
 	CaFile     string `yaml:"ca_file"`
@@ -35,6 +46,9 @@ type InvalidationConfig struct {
 
 	Brokers []string `yaml:"brokers"`
 	Topic   string   `yaml:"topic"`
+	// Topics are consumed by one group and dispatched to the same handler;
+	// empty means just Topic
+	Topics  []string `yaml:"topics"`
 	GroupID string   `yaml:"group_id"`
 
 	SessionTimeout   time.Duration `yaml:"session_timeout"`
@@ -44,6 +58,16 @@ type InvalidationConfig struct {
 
 	TLS  TLSConfig  `yaml:"tls"`
 	SASL SASLConfig `yaml:"sasl"`
+
+	// RateWindow is the sliding window for per-layer invalidation rates;
+	// RateWarnPerSec logs a storm warning above that rate (0 disables)
+	RateWindow     time.Duration `yaml:"rate_window"`
+	RateWarnPerSec float64       `yaml:"rate_warn_per_sec"`
+
+	// OnError is OnErrorFailClaim (default) or OnErrorRetryInline
+	OnError         string        `yaml:"on_error"`
+	RetryBackoff    time.Duration `yaml:"retry_backoff"`
+	RetryMaxBackoff time.Duration `yaml:"retry_max_backoff"`
 }
 
 func FromEnv() InvalidationConfig {
@@ -60,6 +84,10 @@ func FromEnv() InvalidationConfig {
 	if topic == "" {
 		topic = "spatial-invalidation"
 	}
+	topics := split(os.Getenv("KAFKA_TOPICS"))
+	if len(topics) == 0 {
+		topics = []string{topic}
+	}
 	group := strings.TrimSpace(os.Getenv("KAFKA_GROUP_ID"))
 	if group == "" {
 		group = "cache-invalidator"
@@ -69,13 +97,41 @@ func FromEnv() InvalidationConfig {
 		Enabled:          enabled,
 		Driver:           driver,
 		Brokers:          split(brokers),
-		Topic:            topic,
+		Topic:            topics[0],
+		Topics:           topics,
 		GroupID:          group,
 		SessionTimeout:   30 * time.Second,
 		Heartbeat:        3 * time.Second,
 		RebalanceTimeout: 30 * time.Second,
 		InitialOldest:    true,
+		RateWindow:       envDuration("INVALIDATION_RATE_WINDOW", time.Minute),
+		RateWarnPerSec:   envFloat("INVALIDATION_RATE_WARN", 50),
+		OnError:          consumeretry.ParseStrategy(os.Getenv("KAFKA_CONSUMER_ON_ERROR")),
+		RetryBackoff:     envDuration("KAFKA_CONSUMER_RETRY_BACKOFF", 200*time.Millisecond),
+		RetryMaxBackoff:  envDuration("KAFKA_CONSUMER_RETRY_MAX_BACKOFF", 10*time.Second),
+	}
+}
+
+// topicList returns the topics to subscribe to
+func (c InvalidationConfig) topicList() []string {
+	if len(c.Topics) > 0 {
+		return c.Topics
+	}
+	return []string{c.Topic}
+}
+
+func envDuration(k string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(strings.TrimSpace(os.Getenv(k))); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
+
+func envFloat(k string, def float64) float64 {
+	if f, err := strconv.ParseFloat(strings.TrimSpace(os.Getenv(k)), 64); err == nil && f >= 0 {
+		return f
 	}
+	return def
 }
 
 func split(s string) []string {
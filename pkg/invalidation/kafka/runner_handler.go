@@ -0,0 +1,43 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/IBM/sarama"
+
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/invalidation/consumeretry"
+)
+
+type groupHandler struct {
+	setup   func(sarama.ConsumerGroupSession)
+	cleanup func(sarama.ConsumerGroupSession)
+	process func(context.Context, *sarama.ConsumerMessage) error
+	retry   consumeretry.Policy
+}
+
+func (h *groupHandler) Setup(sess sarama.ConsumerGroupSession) error {
+	if h.setup != nil {
+		h.setup(sess)
+	}
+	return nil
+}
+
+func (h *groupHandler) Cleanup(sess sarama.ConsumerGroupSession) error {
+	if h.cleanup != nil {
+		h.cleanup(sess)
+	}
+	return nil
+}
+
+func (h *groupHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	ctx := sess.Context()
+	for msg := range claim.Messages() {
+		if err := h.retry.Handle(ctx, msg, h.process); err != nil {
+			return fmt.Errorf("process failed (topic=%s, part=%d, off=%d): %w",
+				msg.Topic, msg.Partition, msg.Offset, err)
+		}
+		sess.MarkMessage(msg, "")
+	}
+	return nil
+}
@@ -8,7 +8,8 @@ type metricSet struct {
 	msgs     *prometheus.CounterVec
 	apply    *prometheus.CounterVec
 	proc     *prometheus.HistogramVec
-	lagGauge prometheus.Gauge
+	lagGauge *prometheus.GaugeVec
+	rate     *prometheus.GaugeVec
 }
 
 func newMetricSet(r prometheus.Registerer) *metricSet {
@@ -16,9 +17,9 @@ func newMetricSet(r prometheus.Registerer) *metricSet {
 		msgs: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "inval_msgs_total",
-				Help: "Count of invalidation messages by result.",
+				Help: "Count of invalidation messages by topic and result.",
 			},
-			[]string{"result"},
+			[]string{"topic", "result"},
 		),
 		apply: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
@@ -35,15 +36,23 @@ func newMetricSet(r prometheus.Registerer) *metricSet {
 			},
 			[]string{"op"},
 		),
-		lagGauge: prometheus.NewGauge(
+		lagGauge: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "inval_lag_seconds",
-				Help: "Approximate lag: now - message.timestamp.",
+				Help: "Approximate lag per topic: now - message.timestamp.",
 			},
+			[]string{"topic"},
+		),
+		rate: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "inval_layer_rate_per_second",
+				Help: "Invalidations applied per layer over the sliding rate window.",
+			},
+			[]string{"layer"},
 		),
 	}
 	if r != nil {
-		r.MustRegister(m.msgs, m.apply, m.proc, m.lagGauge)
+		r.MustRegister(m.msgs, m.apply, m.proc, m.lagGauge, m.rate)
 	}
 	return m
 }
@@ -0,0 +1,50 @@
+package kafka
+
+import (
+	"sync"
+	"time"
+)
+
+// layerRate keeps a sliding window of applied invalidations per layer
+type layerRate struct {
+	mu     sync.Mutex
+	window time.Duration
+	events map[string][]time.Time
+	warned map[string]time.Time
+}
+
+func newLayerRate(window time.Duration) *layerRate {
+	return &layerRate{
+		window: window,
+		events: make(map[string][]time.Time),
+		warned: make(map[string]time.Time),
+	}
+}
+
+// record adds one invalidation for layer and returns its rate (events/sec)
+// over the window ending at now
+func (l *layerRate) record(layer string, now time.Time) float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := now.Add(-l.window)
+	evs := l.events[layer]
+	i := 0
+	for i < len(evs) && !evs[i].After(cutoff) {
+		i++
+	}
+	evs = append(evs[i:], now)
+	l.events[layer] = evs
+	return float64(len(evs)) / l.window.Seconds()
+}
+
+// shouldWarn allows one storm warning per layer per window
+func (l *layerRate) shouldWarn(layer string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if last, ok := l.warned[layer]; ok && now.Sub(last) < l.window {
+		return false
+	}
+	l.warned[layer] = now
+	return true
+}
@@ -1,20 +1,39 @@
 package kafka
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/IBM/sarama"
+	miniredis "github.com/alicebob/miniredis/v2"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/cellindex"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/featurestore"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/keys"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/cache/redisstore"
+	cachev2 "github.com/mohammed-shakir/h3-spatial-cache/internal/cache/v2"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/config"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/model"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/core/observability"
 	"github.com/mohammed-shakir/h3-spatial-cache/internal/invalidation"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/invalidation/consumeretry"
+	h3mapper "github.com/mohammed-shakir/h3-spatial-cache/internal/mapper/h3"
+	"github.com/mohammed-shakir/h3-spatial-cache/internal/scenarios"
+	_ "github.com/mohammed-shakir/h3-spatial-cache/internal/scenarios/cache"
 )
 
 type fakeCellIndex struct {
@@ -237,7 +256,7 @@ func TestSpatialEvent_HotnessReset(t *testing.T) {
 		Layer: "demo:NR_polygon",
 		BBox:  &invalidation.BBox{X1: 0, Y1: 0, X2: 1, Y2: 1, SRID: "EPSG:4326"},
 	}
-	if err := r.applySpatial(context.Background(), ev); err != nil {
+	if _, err := r.applySpatial(context.Background(), ev); err != nil {
 		t.Fatalf("applySpatial: %v", err)
 	}
 	if got := mr.Count(); got != 2 {
@@ -307,6 +326,794 @@ func TestRunner_WireEvent_DeletesCellIndex(t *testing.T) {
 	}
 }
 
+func TestRunner_InvalidationStorm_Warns(t *testing.T) {
+	cfg := InvalidationConfig{
+		Enabled:        true,
+		Driver:         DriverKafka,
+		RateWindow:     time.Second,
+		RateWarnPerSec: 10,
+	}
+	reg := prometheus.NewRegistry()
+	observability.Init(reg, true)
+
+	var logs bytes.Buffer
+	r := New(cfg, &fakeCache{}, mapper{}, Options{
+		Logger:   slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{})),
+		Register: reg,
+		ResRange: []int{8},
+	})
+
+	for i := 1; i <= 30; i++ {
+		w := WireEvent{
+			Layer:   "demo:NR_polygon",
+			H3Cells: []string{"892a100d2b3ffff"},
+			Version: uint64(i),
+			TS:      time.Now().UTC(),
+			Op:      "invalidate",
+		}
+		b, _ := json.Marshal(w)
+		msg := &sarama.ConsumerMessage{Topic: "t", Offset: int64(i), Timestamp: time.Now().UTC(), Value: b}
+		if err := r.handleMessage(context.Background(), msg); err != nil {
+			t.Fatalf("handleMessage #%d: %v", i, err)
+		}
+	}
+
+	out := logs.String()
+	if n := strings.Count(out, "invalidation storm"); n != 1 {
+		t.Fatalf("want exactly one storm warning per window, got %d\n%s", n, out)
+	}
+	if !strings.Contains(out, "layer=demo:NR_polygon") {
+		t.Fatalf("storm warning missing layer: %s", out)
+	}
+	if got := testutil.ToFloat64(r.ms.rate.WithLabelValues("demo:NR_polygon")); got <= cfg.RateWarnPerSec {
+		t.Fatalf("rate gauge=%v, want > %v", got, cfg.RateWarnPerSec)
+	}
+}
+
+func TestRunner_FilteredInvalidation_EvictsMatchingIndexEntries(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("miniredis: %v", err)
+	}
+	defer mr.Close()
+	ctx := context.Background()
+	cli, err := redisstore.New(ctx, mr.Addr())
+	if err != nil {
+		t.Fatalf("redisstore: %v", err)
+	}
+	defer func() { _ = cli.Close() }()
+	idx := cellindex.NewRedisIndex(cli)
+
+	reg := prometheus.NewRegistry()
+	observability.Init(reg, true)
+	r := New(InvalidationConfig{Enabled: true, Driver: DriverKafka}, &fakeCache{}, mapper{}, Options{
+		Logger:    slogDiscard(),
+		Register:  reg,
+		ResRange:  []int{8},
+		CellIndex: idx,
+	})
+
+	const layer, cell = "demo:NR_polygon", "892a100d2b3ffff"
+	for _, f := range []model.Filters{"", "pop > 10"} {
+		if err := idx.SetIDs(ctx, layer, 8, cell, f, []string{"s:a"}, time.Minute); err != nil {
+			t.Fatalf("SetIDs %q: %v", f, err)
+		}
+	}
+	send := func(version uint64, filters string) {
+		b, _ := json.Marshal(WireEvent{Layer: layer, H3Cells: []string{cell}, Version: version, TS: time.Now().UTC(), Op: "invalidate", Filters: filters})
+		if err := r.handleMessage(ctx, &sarama.ConsumerMessage{Topic: "t", Timestamp: time.Now().UTC(), Value: b}); err != nil {
+			t.Fatalf("handleMessage: %v", err)
+		}
+	}
+
+	send(1, "pop>10")
+	if mr.Exists(keys.CellIndexKey(layer, 8, cell, "pop > 10")) {
+		t.Fatalf("filtered entry should be evicted by a matching invalidation")
+	}
+	if !mr.Exists(keys.CellIndexKey(layer, 8, cell, "")) {
+		t.Fatalf("unfiltered entry should survive a filtered invalidation")
+	}
+
+	if err := idx.SetIDs(ctx, layer, 8, cell, "pop > 10", []string{"s:a"}, time.Minute); err != nil {
+		t.Fatalf("SetIDs: %v", err)
+	}
+	send(2, "")
+	for _, k := range mr.Keys() {
+		if strings.HasPrefix(k, "idx:") || strings.HasPrefix(k, "val:") {
+			t.Fatalf("unfiltered invalidation should evict every variant, left %v", mr.Keys())
+		}
+	}
+}
+
 func slogDiscard() *slog.Logger {
 	return slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{}))
 }
+
+func TestRunner_WireEvent_SkipsInvalidCells(t *testing.T) {
+	fc := &fakeCache{}
+	reg := prometheus.NewRegistry()
+	observability.Init(reg, true)
+	idx := &fakeCellIndex{}
+
+	r := New(InvalidationConfig{Enabled: true, Driver: DriverKafka}, fc, mapper{}, Options{
+		Logger:    slogDiscard(),
+		Register:  reg,
+		ResRange:  []int{8},
+		CellIndex: idx,
+	})
+
+	w := WireEvent{
+		Layer:   "demo:NR_polygon",
+		H3Cells: []string{"892a100d2b3ffff", "not-a-cell", "", "ffffffffffffffff", "idx:evil*", " 892A100D2B7FFFF "},
+		Version: 1,
+		Op:      "invalidate",
+	}
+	b, _ := json.Marshal(w)
+	msg := &sarama.ConsumerMessage{Topic: "t", Offset: 1, Timestamp: time.Now().UTC(), Value: b}
+	if err := r.handleMessage(context.Background(), msg); err != nil {
+		t.Fatalf("handleMessage: %v", err)
+	}
+
+	want := []string{
+		keys.Key("demo:NR_polygon", 8, "892a100d2b3ffff", ""),
+		keys.Key("demo:NR_polygon", 8, "892a100d2b7ffff", ""),
+	}
+	fc.mu.Lock()
+	got := append([]string(nil), fc.del...)
+	fc.mu.Unlock()
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("deleted keys=%v want %v", got, want)
+	}
+
+	idx.mu.Lock()
+	for _, call := range idx.dels {
+		if len(call.cells) != 2 {
+			t.Fatalf("DelCells saw %d cells, want 2: %v", len(call.cells), call.cells)
+		}
+	}
+	idx.mu.Unlock()
+
+	if n := consumerErrors(t, reg, "bad_cell"); n != 4 {
+		t.Fatalf("bad_cell errors=%v want 4", n)
+	}
+}
+
+func TestRunner_NoOpEventsLeaveLayerFresh(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	observability.Init(reg, true)
+	fc := &fakeCache{}
+	r := New(InvalidationConfig{Enabled: true, Driver: DriverKafka}, fc, mapper{}, Options{
+		Logger:   slogDiscard(),
+		Register: reg,
+		ResRange: []int{8},
+	})
+	const layer = "demo:noop"
+	send := func(w WireEvent) {
+		t.Helper()
+		b, _ := json.Marshal(w)
+		if err := r.handleMessage(context.Background(), &sarama.ConsumerMessage{Topic: "t", Timestamp: time.Now().UTC(), Value: b}); err != nil {
+			t.Fatalf("handleMessage: %v", err)
+		}
+	}
+
+	send(WireEvent{Layer: layer, H3Cells: []string{"not-a-cell", "idx:evil*"}, Version: 1, Op: "invalidate"})
+	if len(fc.del) != 0 {
+		t.Fatalf("deleted %v for an event without valid cells", fc.del)
+	}
+	if got := observability.GetLayerInvalidatedAtUnix(layer); got != 0 {
+		t.Fatalf("layer invalidated at %d by an event without valid cells", got)
+	}
+
+	ts := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	send(WireEvent{Layer: layer, Op: OpMarkStale, Version: 5, TS: ts})
+	if got := observability.GetLayerInvalidatedAtUnix(layer); got != ts.Unix() {
+		t.Fatalf("mark_stale: layer invalidated at %d want %d", got, ts.Unix())
+	}
+	send(WireEvent{Layer: layer, Op: OpMarkStale, Version: 5, TS: time.Now().UTC()})
+	if got := observability.GetLayerInvalidatedAtUnix(layer); got != ts.Unix() {
+		t.Fatalf("a mark_stale skipped by version moved the layer timestamp to %d", got)
+	}
+	if got, want := testutil.ToFloat64(r.ms.rate.WithLabelValues(layer)), 1/time.Minute.Seconds(); got != want {
+		t.Fatalf("rate=%v want %v: only the applied mark_stale should count", got, want)
+	}
+}
+
+func consumerErrors(t *testing.T, reg *prometheus.Registry, kind string) float64 {
+	t.Helper()
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	var n float64
+	for _, mf := range mfs {
+		if mf.GetName() != "kafka_consumer_errors_total" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, lp := range m.GetLabel() {
+				if lp.GetName() == "kind" && lp.GetValue() == kind {
+					n += m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return n
+}
+
+func TestRunner_WireEvent_InvalidatesFeatureIDs(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("miniredis: %v", err)
+	}
+	defer mr.Close()
+	ctx := context.Background()
+	cli, err := redisstore.New(ctx, mr.Addr())
+	if err != nil {
+		t.Fatalf("redisstore: %v", err)
+	}
+	defer func() { _ = cli.Close() }()
+	idx := cellindex.NewRedisIndex(cli)
+	fs := featurestore.NewRedisStore(cli, time.Minute)
+
+	reg := prometheus.NewRegistry()
+	observability.Init(reg, true)
+	r := New(InvalidationConfig{Enabled: true, Driver: DriverKafka}, &fakeCache{}, mapper{}, Options{
+		Logger:    slogDiscard(),
+		Register:  reg,
+		ResRange:  []int{8},
+		CellIndex: idx,
+		Features:  fs,
+	})
+
+	const layer, other = "demo:NR_polygon", "demo:NR_polygon:v2"
+	const cellA, cellB = "892a100d2b3ffff", "892a100d2a7ffff"
+	seed := map[string][]string{cellA: {"s:x", "s:a1"}, cellB: {"n:7"}}
+	for cell, ids := range seed {
+		if err := idx.SetIDs(ctx, layer, 8, cell, "", ids, time.Minute); err != nil {
+			t.Fatalf("SetIDs: %v", err)
+		}
+	}
+	if err := idx.SetIDs(ctx, other, 8, cellA, "", []string{"s:x"}, time.Minute); err != nil {
+		t.Fatalf("SetIDs other layer: %v", err)
+	}
+	feats := map[string][]byte{"s:x": []byte(`{}`), "s:a1": []byte(`{}`), "n:7": []byte(`{}`)}
+	if err := fs.PutFeatures(ctx, layer, feats, time.Minute); err != nil {
+		t.Fatalf("PutFeatures: %v", err)
+	}
+	// a localized copy, as an Accept-Language request would have cached it
+	scoped := keys.ScopedLayer(layer, map[string]string{"Accept-Language": "sv"})
+	if err := fs.PutFeatures(ctx, scoped, feats, time.Minute); err != nil {
+		t.Fatalf("PutFeatures scoped: %v", err)
+	}
+	if err := idx.SetIDs(ctx, scoped, 8, cellA, "", []string{"s:x"}, time.Minute); err != nil {
+		t.Fatalf("SetIDs scoped: %v", err)
+	}
+
+	send := func(version uint64, ids ...string) {
+		b, _ := json.Marshal(WireEvent{Layer: layer, IDs: ids, Version: version, TS: time.Now().UTC(), Op: "invalidate"})
+		if err := r.handleMessage(ctx, &sarama.ConsumerMessage{Topic: "t", Timestamp: time.Now().UTC(), Value: b}); err != nil {
+			t.Fatalf("handleMessage: %v", err)
+		}
+	}
+
+	send(1, "x")
+	got, err := fs.MGetFeatures(ctx, layer, []string{"s:x", "s:a1", "n:7"})
+	if err != nil {
+		t.Fatalf("MGetFeatures: %v", err)
+	}
+	if _, ok := got["s:x"]; ok || len(got) != 2 {
+		t.Fatalf("want only s:x evicted, got %v", got)
+	}
+	got, err = fs.MGetFeatures(ctx, scoped, []string{"s:x", "s:a1", "n:7"})
+	if err != nil {
+		t.Fatalf("MGetFeatures scoped: %v", err)
+	}
+	if _, ok := got["s:x"]; ok || len(got) != 2 {
+		t.Fatalf("want s:x evicted from the scoped copy too, got %v", got)
+	}
+	if ids, _ := idx.GetIDs(ctx, scoped, 8, cellA, ""); ids != nil {
+		t.Fatalf("scoped cell referencing x should be dropped, got %v", ids)
+	}
+	if ids, _ := idx.GetIDs(ctx, layer, 8, cellA, ""); ids != nil {
+		t.Fatalf("cell referencing x should be dropped so it refills, got %v", ids)
+	}
+	if ids, _ := idx.GetIDs(ctx, layer, 8, cellB, ""); len(ids) != 1 {
+		t.Fatalf("neighbor cell should remain, got %v", ids)
+	}
+	if ids, _ := idx.GetIDs(ctx, other, 8, cellA, ""); len(ids) != 1 {
+		t.Fatalf("layer sharing the prefix should be untouched, got %v", ids)
+	}
+
+	// a plain numeric id matches the numeric stored form too
+	send(2, "7")
+	if got, _ := fs.MGetFeatures(ctx, layer, []string{"n:7"}); len(got) != 0 {
+		t.Fatalf("n:7 should be evicted, got %v", got)
+	}
+	if ids, _ := idx.GetIDs(ctx, layer, 8, cellB, ""); ids != nil {
+		t.Fatalf("cell referencing 7 should be dropped, got %v", ids)
+	}
+}
+
+// fakeGroup delivers its queued messages once, one claim per topic, then
+// blocks like a real group until the session ends
+type fakeGroup struct {
+	msgs   map[string][]*sarama.ConsumerMessage
+	once   sync.Once
+	errs   chan error
+	topics chan []string
+}
+
+func (g *fakeGroup) Consume(ctx context.Context, topics []string, h sarama.ConsumerGroupHandler) error {
+	delivered := false
+	g.once.Do(func() {
+		delivered = true
+		g.topics <- topics
+		sess := &fakeSession{ctx: ctx}
+		if err := h.Setup(sess); err != nil {
+			return
+		}
+		for _, topic := range topics {
+			ch := make(chan *sarama.ConsumerMessage, len(g.msgs[topic]))
+			for _, m := range g.msgs[topic] {
+				ch <- m
+			}
+			close(ch)
+			_ = h.ConsumeClaim(sess, &fakeClaim{topic: topic, msgs: ch})
+		}
+		_ = h.Cleanup(sess)
+	})
+	if !delivered {
+		<-ctx.Done()
+	}
+	return nil
+}
+
+func (g *fakeGroup) Errors() <-chan error      { return g.errs }
+func (g *fakeGroup) Close() error              { close(g.errs); return nil }
+func (g *fakeGroup) Pause(map[string][]int32)  {}
+func (g *fakeGroup) Resume(map[string][]int32) {}
+func (g *fakeGroup) PauseAll()                 {}
+func (g *fakeGroup) ResumeAll()                {}
+
+type fakeSession struct {
+	ctx    context.Context
+	mu     sync.Mutex
+	marked []int64
+}
+
+func (s *fakeSession) Claims() map[string][]int32               { return map[string][]int32{} }
+func (s *fakeSession) MemberID() string                         { return "m" }
+func (s *fakeSession) GenerationID() int32                      { return 1 }
+func (s *fakeSession) MarkOffset(string, int32, int64, string)  {}
+func (s *fakeSession) Commit()                                  {}
+func (s *fakeSession) ResetOffset(string, int32, int64, string) {}
+func (s *fakeSession) MarkMessage(m *sarama.ConsumerMessage, _ string) {
+	s.mu.Lock()
+	s.marked = append(s.marked, m.Offset)
+	s.mu.Unlock()
+}
+func (s *fakeSession) Context() context.Context { return s.ctx }
+
+type fakeClaim struct {
+	topic string
+	msgs  chan *sarama.ConsumerMessage
+}
+
+func (c *fakeClaim) Topic() string                            { return c.topic }
+func (c *fakeClaim) Partition() int32                         { return 0 }
+func (c *fakeClaim) InitialOffset() int64                     { return 0 }
+func (c *fakeClaim) HighWaterMarkOffset() int64               { return 0 }
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.msgs }
+
+func TestRunner_ConsumesMultipleTopics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	observability.Init(reg, true)
+	idx := &fakeCellIndex{}
+	cfg := InvalidationConfig{Enabled: true, Driver: DriverKafka, Topics: []string{"inval-a", "inval-b"}}
+	r := New(cfg, &fakeCache{}, mapper{}, Options{Logger: slogDiscard(), Register: reg, ResRange: []int{8}, CellIndex: idx})
+
+	msg := func(topic, layer string) *sarama.ConsumerMessage {
+		b, _ := json.Marshal(WireEvent{
+			Layer: layer, H3Cells: []string{"882a100d2bfffff"}, Version: 1, TS: time.Now().UTC(), Op: "update",
+		})
+		return &sarama.ConsumerMessage{Topic: topic, Timestamp: time.Now().UTC(), Value: b}
+	}
+	g := &fakeGroup{
+		msgs: map[string][]*sarama.ConsumerMessage{
+			"inval-a": {msg("inval-a", "demo:a")},
+			"inval-b": {msg("inval-b", "demo:b")},
+		},
+		errs:   make(chan error),
+		topics: make(chan []string, 1),
+	}
+	r.newGroup = func([]string, string, *sarama.Config) (sarama.ConsumerGroup, error) { return g, nil }
+
+	if err := r.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if got := <-g.topics; len(got) != 2 || got[0] != "inval-a" || got[1] != "inval-b" {
+		t.Fatalf("subscribed to %v", got)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for testutil.ToFloat64(r.ms.msgs.WithLabelValues("inval-b", "ok")) < 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	r.Stop()
+
+	for _, topic := range []string{"inval-a", "inval-b"} {
+		if got := testutil.ToFloat64(r.ms.msgs.WithLabelValues(topic, "ok")); got != 1 {
+			t.Fatalf("inval_msgs_total{topic=%q,result=ok}=%v want 1", topic, got)
+		}
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	layers := map[string]bool{}
+	for _, call := range idx.dels {
+		layers[call.layer] = true
+	}
+	if !layers["demo:a"] || !layers["demo:b"] {
+		t.Fatalf("DelCells layers=%v want both topics' layers", layers)
+	}
+}
+
+// flakyCache fails the first Del after each arm
+type flakyCache struct {
+	fakeCache
+	fail atomic.Bool
+}
+
+func (f *flakyCache) Del(keys ...string) error {
+	if f.fail.CompareAndSwap(true, false) {
+		return errors.New("redis down")
+	}
+	return f.fakeCache.Del(keys...)
+}
+
+func TestRunner_OnError_FailClaimAndRetryInline(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	observability.Init(reg, true)
+	fc := &flakyCache{}
+
+	wire := func(off int64) *sarama.ConsumerMessage {
+		b, _ := json.Marshal(WireEvent{Layer: "demo:x", H3Cells: []string{"882a100d2bfffff"}, Version: uint64(off), Op: "update"})
+		return &sarama.ConsumerMessage{Topic: "t", Offset: off, Value: b}
+	}
+	consume := func(cfg InvalidationConfig, msgs ...*sarama.ConsumerMessage) (*fakeSession, error) {
+		r := New(cfg, fc, mapper{}, Options{Logger: slogDiscard(), Register: prometheus.NewRegistry(), ResRange: []int{8}})
+		h := &groupHandler{
+			process: r.handleMessage,
+			retry: consumeretry.Policy{
+				RetryInline: cfg.OnError == OnErrorRetryInline,
+				Backoff:     cfg.RetryBackoff,
+				MaxBackoff:  cfg.RetryMaxBackoff,
+				Logger:      r.log,
+			},
+		}
+		ch := make(chan *sarama.ConsumerMessage, len(msgs))
+		for _, m := range msgs {
+			ch <- m
+		}
+		close(ch)
+		s := &fakeSession{ctx: t.Context()}
+		return s, h.ConsumeClaim(s, &fakeClaim{topic: "t", msgs: ch})
+	}
+
+	// default strategy: the failure ends the claim without marking
+	fc.fail.Store(true)
+	s, err := consume(InvalidationConfig{OnError: OnErrorFailClaim}, wire(1))
+	if err == nil {
+		t.Fatalf("fail-claim: expected ConsumeClaim error")
+	}
+	if len(s.marked) != 0 {
+		t.Fatalf("fail-claim: marked=%v want none", s.marked)
+	}
+
+	// retry-inline: the transient failure is retried, the undecodable message
+	// is skipped, and every offset is committed
+	fc.fail.Store(true)
+	cfg := InvalidationConfig{OnError: OnErrorRetryInline, RetryBackoff: time.Millisecond, RetryMaxBackoff: 2 * time.Millisecond}
+	undecodable := &sarama.ConsumerMessage{Topic: "t", Offset: 3, Value: []byte("{not json")}
+	s, err = consume(cfg, wire(2), undecodable, wire(4))
+	if err != nil {
+		t.Fatalf("retry-inline: ConsumeClaim: %v", err)
+	}
+	if !slices.Equal(s.marked, []int64{2, 3, 4}) {
+		t.Fatalf("retry-inline: marked=%v want [2 3 4]", s.marked)
+	}
+	// the retried message must really delete, not be skipped as a duplicate
+	// version
+	if want := keys.Key("demo:x", 8, "882a100d2bfffff", ""); !slices.Equal(fc.del, []string{want, want}) {
+		t.Fatalf("retry-inline: deleted=%v want %q for offsets 2 and 4", fc.del, want)
+	}
+	if got := consumerErrors(t, reg, "skipped"); got != 1 {
+		t.Fatalf(`kafka_consumer_errors_total{kind="skipped"}=%v want 1`, got)
+	}
+}
+
+func counterValue(t *testing.T, reg *prometheus.Registry, name string, labels map[string]string) float64 {
+	t.Helper()
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+	next:
+		for _, m := range mf.GetMetric() {
+			for _, lp := range m.GetLabel() {
+				if want, ok := labels[lp.GetName()]; ok && lp.GetValue() != want {
+					continue next
+				}
+			}
+			return m.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestRunner_MarkStale_KeepsKeysAndServesStale(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	observability.Init(reg, true)
+	observability.SetScenario("cache")
+	t.Cleanup(func() { observability.Init(nil, false) })
+
+	gs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[{"type":"Feature","id":"f1","geometry":null,"properties":{}}]}`)
+	}))
+	defer gs.Close()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	// a layer no other test invalidates, so its timestamp starts unset
+	const layer = "demo:mark_stale"
+	cfg := config.FromEnv()
+	cfg.Scenario = "cache"
+	cfg.RedisAddr = mr.Addr()
+	cfg.GeoServerURL = gs.URL
+	cfg.H3Res, cfg.H3ResMin, cfg.H3ResMax = 7, 7, 7
+	cfg.CacheTTLDefault = 5 * time.Minute
+	cfg.AdaptiveEnabled = false
+	h, err := scenarios.New("cache", cfg, slogDiscard(), nil)
+	if err != nil {
+		t.Fatalf("scenario: %v", err)
+	}
+	bb := model.BBox{X1: 18.00, Y1: 59.32, X2: 18.02, Y2: 59.34, SRID: "EPSG:4326"}
+	query := func() string {
+		req := httptest.NewRequest(http.MethodGet, "/query", nil)
+		rr := httptest.NewRecorder()
+		h.HandleQuery(req.Context(), rr, req, model.QueryRequest{Layer: layer, BBox: &bb})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status=%d body=%q", rr.Code, rr.Body.String())
+		}
+		return rr.Header().Get("X-Cache")
+	}
+	query()
+	before := mr.Keys()
+
+	r := New(InvalidationConfig{Enabled: true, Driver: DriverKafka}, &fakeCache{}, mapper{}, Options{
+		Logger: slogDiscard(), Register: reg, ResRange: []int{7},
+	})
+	// one second ahead so the whole-second layer timestamp is past the fill
+	ts := time.Now().Add(time.Second).UTC()
+	b, _ := json.Marshal(WireEvent{Layer: layer, Version: 1, TS: ts, Op: OpMarkStale})
+	if err := r.handleMessage(context.Background(), &sarama.ConsumerMessage{Topic: "t", Timestamp: ts, Value: b}); err != nil {
+		t.Fatalf("handleMessage: %v", err)
+	}
+
+	if after := mr.Keys(); !slices.Equal(after, before) {
+		t.Fatalf("mark_stale changed keys: before %v after %v", before, after)
+	}
+	if got := counterValue(t, reg, "spatial_invalidation_total", map[string]string{"source": "kafka", "action": OpMarkStale}); got != 1 {
+		t.Fatalf("spatial_invalidation_total{action=mark_stale}=%v want 1", got)
+	}
+	if xc := query(); xc != "HIT" {
+		t.Fatalf("read after mark_stale X-Cache=%q want HIT", xc)
+	}
+	if got := counterValue(t, reg, "spatial_reads_total", map[string]string{"cache": "hit", "stale": "true"}); got != 1 {
+		t.Fatalf("stale hits=%v want 1", got)
+	}
+}
+
+func TestRunner_Patch_RewritesCachedFeature(t *testing.T) {
+	var upstream int
+	gs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		upstream++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[{"type":"Feature","id":"f1","geometry":{"type":"Point","coordinates":[18.01,59.33]},"properties":{"status":"open","name":"Slussen"}}]}`)
+	}))
+	defer gs.Close()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	const layer = "demo:patch"
+	cfg := config.FromEnv()
+	cfg.Scenario = "cache"
+	cfg.RedisAddr = mr.Addr()
+	cfg.GeoServerURL = gs.URL
+	cfg.H3Res, cfg.H3ResMin, cfg.H3ResMax = 7, 7, 7
+	cfg.CacheTTLDefault = 5 * time.Minute
+	cfg.AdaptiveEnabled = false
+	h, err := scenarios.New("cache", cfg, slogDiscard(), nil)
+	if err != nil {
+		t.Fatalf("scenario: %v", err)
+	}
+	bb := model.BBox{X1: 18.00, Y1: 59.32, X2: 18.02, Y2: 59.34, SRID: "EPSG:4326"}
+	type props map[string]any
+	query := func(lang string) (string, props) {
+		t.Helper()
+		q := model.QueryRequest{Layer: layer, BBox: &bb}
+		if lang != "" {
+			q.Headers = map[string]string{"Accept-Language": lang}
+		}
+		req := httptest.NewRequest(http.MethodGet, "/query", nil)
+		rr := httptest.NewRecorder()
+		h.HandleQuery(req.Context(), rr, req, q)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status=%d body=%q", rr.Code, rr.Body.String())
+		}
+		var fc struct {
+			Features []struct {
+				Properties props `json:"properties"`
+			} `json:"features"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &fc); err != nil || len(fc.Features) != 1 {
+			t.Fatalf("body=%q err=%v", rr.Body.String(), err)
+		}
+		return rr.Header().Get("X-Cache"), fc.Features[0].Properties
+	}
+	query("")
+	query("sv")
+	filled := upstream
+
+	ctx := context.Background()
+	cli, err := redisstore.New(ctx, mr.Addr())
+	if err != nil {
+		t.Fatalf("redisstore: %v", err)
+	}
+	defer func() { _ = cli.Close() }()
+	fs := featurestore.NewRedisStore(cli, time.Minute)
+	ttlBefore := mr.TTL("feat:" + layer + ":s:f1")
+	r := New(InvalidationConfig{Enabled: true, Driver: DriverKafka}, &fakeCache{}, mapper{}, Options{
+		Logger: slogDiscard(), Register: prometheus.NewRegistry(), ResRange: []int{7},
+		CellIndex: cellindex.NewRedisIndex(cli), Features: fs,
+	})
+	send := func(version uint64, ids []string, p map[string]json.RawMessage) {
+		t.Helper()
+		b, _ := json.Marshal(WireEvent{Layer: layer, IDs: ids, Properties: p, Version: version, TS: time.Now().UTC(), Op: OpPatch})
+		if err := r.handleMessage(ctx, &sarama.ConsumerMessage{Topic: "t", Timestamp: time.Now().UTC(), Value: b}); err != nil {
+			t.Fatalf("handleMessage: %v", err)
+		}
+	}
+
+	send(1, []string{"f1"}, map[string]json.RawMessage{"status": json.RawMessage(`"closed"`), "name": json.RawMessage(`null`)})
+	for _, lang := range []string{"", "sv"} {
+		xc, got := query(lang)
+		if xc != "HIT" || upstream != filled {
+			t.Fatalf("lang=%q after patch X-Cache=%q upstream calls=%d, want a hit without refetching", lang, xc, upstream-filled)
+		}
+		if got["status"] != "closed" {
+			t.Fatalf("lang=%q served status=%v want closed", lang, got["status"])
+		}
+		if _, ok := got["name"]; ok {
+			t.Fatalf("lang=%q null should remove name, got %v", lang, got)
+		}
+	}
+	if ttl := mr.TTL("feat:" + layer + ":s:f1"); ttl <= 0 || ttl > ttlBefore {
+		t.Fatalf("patched feature ttl=%v, want its original %v kept", ttl, ttlBefore)
+	}
+
+	// a replayed older version is ignored
+	send(1, []string{"f1"}, map[string]json.RawMessage{"status": json.RawMessage(`"reopened"`)})
+	if _, got := query(""); got["status"] != "closed" {
+		t.Fatalf("replayed patch applied: status=%v", got["status"])
+	}
+
+	// a feature that isn't cached falls back to eviction: the feature is
+	// dropped along with the cell index entries that reference it
+	for _, k := range mr.Keys() {
+		if strings.HasPrefix(k, "feat:") {
+			mr.Del(k)
+		}
+	}
+	send(2, []string{"f1"}, map[string]json.RawMessage{"status": json.RawMessage(`"reopened"`)})
+	for _, lang := range []string{"", "sv"} {
+		if xc, got := query(lang); xc != "MISS" || got["status"] != "open" {
+			t.Fatalf("lang=%q after fallback X-Cache=%q status=%v, want a refetch", lang, xc, got["status"])
+		}
+	}
+}
+
+func TestRunner_WireEvent_InvalidatesHeaderScopes(t *testing.T) {
+	for _, backend := range []string{"redis", "memory"} {
+		t.Run(backend, func(t *testing.T) { testInvalidatesHeaderScopes(t, backend) })
+	}
+}
+
+// testInvalidatesHeaderScopes fills every Accept-Language scope of a layer and
+// checks one cell invalidation empties all of them; the runner works on the
+// engine's own store, as main wires it, whatever the backend
+func testInvalidatesHeaderScopes(t *testing.T, backend string) {
+	gs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[{"type":"Feature","id":"f1","geometry":null,"properties":{}}]}`)
+	}))
+	defer gs.Close()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	const layer = "demo:scoped"
+	cfg := config.FromEnv()
+	cfg.Scenario = "cache"
+	cfg.CacheBackend = backend
+	cfg.RedisAddr = mr.Addr()
+	cfg.GeoServerURL = gs.URL
+	cfg.H3Res, cfg.H3ResMin, cfg.H3ResMax = 7, 7, 7
+	cfg.CacheTTLDefault = 5 * time.Minute
+	cfg.AdaptiveEnabled = false
+	h, err := scenarios.New("cache", cfg, slogDiscard(), nil)
+	if err != nil {
+		t.Fatalf("scenario: %v", err)
+	}
+	sp, ok := h.(interface{ CacheStore() *cachev2.Store })
+	if !ok || sp.CacheStore() == nil {
+		t.Fatalf("cache engine does not expose its store")
+	}
+	store := sp.CacheStore()
+	bb := model.BBox{X1: 18.00, Y1: 59.32, X2: 18.02, Y2: 59.34, SRID: "EPSG:4326"}
+	query := func(lang string) string {
+		t.Helper()
+		q := model.QueryRequest{Layer: layer, BBox: &bb}
+		if lang != "" {
+			q.Headers = map[string]string{"Accept-Language": lang}
+		}
+		req := httptest.NewRequest(http.MethodGet, "/query", nil)
+		rr := httptest.NewRecorder()
+		h.HandleQuery(req.Context(), rr, req, q)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status=%d body=%q", rr.Code, rr.Body.String())
+		}
+		return rr.Header().Get("X-Cache")
+	}
+	langs := []string{"", "sv", "en-GB"}
+	for _, l := range langs {
+		query(l)
+		if xc := query(l); xc != "HIT" {
+			t.Fatalf("warm read lang=%q X-Cache=%q want HIT", l, xc)
+		}
+	}
+
+	ctx := context.Background()
+	r := New(InvalidationConfig{Enabled: true, Driver: DriverKafka}, &fakeCache{}, mapper{}, Options{
+		Logger: slogDiscard(), Register: prometheus.NewRegistry(), ResRange: []int{7},
+		CellIndex: store.Cells, Features: store.Features,
+	})
+	cells, err := h3mapper.New().CellsForBBox(bb, 7)
+	if err != nil || len(cells) == 0 {
+		t.Fatalf("cells=%v err=%v", cells, err)
+	}
+	b, _ := json.Marshal(WireEvent{Layer: layer, H3Cells: cells, Version: 1, TS: time.Now().UTC(), Op: "invalidate"})
+	if err := r.handleMessage(ctx, &sarama.ConsumerMessage{Topic: "t", Timestamp: time.Now().UTC(), Value: b}); err != nil {
+		t.Fatalf("handleMessage: %v", err)
+	}
+
+	for _, l := range langs {
+		if xc := query(l); xc != "MISS" {
+			t.Fatalf("read after invalidation lang=%q X-Cache=%q want MISS", l, xc)
+		}
+	}
+	if backend == "memory" && len(mr.Keys()) != 0 {
+		t.Fatalf("memory backend wrote to redis: %v", mr.Keys())
+	}
+}
@@ -1,6 +1,17 @@
 package kafka
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
+
+// OpMarkStale soft-purges: cached entries stay and are served as stale
+// instead of being deleted, which avoids a refetch stampede
+const OpMarkStale = "mark_stale"
+
+// OpPatch rewrites the Properties of the features in IDs where they are
+// cached, instead of evicting them; features that aren't cached are evicted
+const OpPatch = "patch"
 
 type WireEvent struct {
 	Key         string    `json:"key,omitempty"`
@@ -10,4 +21,12 @@ type WireEvent struct {
 	Version     uint64    `json:"version"`
 	TS          time.Time `json:"ts"`
 	Op          string    `json:"op,omitempty"`
+	// Filters targets entries cached under this cql_filter; empty means every filter variant
+	Filters string `json:"filters,omitempty"`
+	// IDs evicts these features of Layer wherever they are cached, without
+	// needing their geometry; plain ids match both string and numeric forms
+	IDs []string `json:"ids,omitempty"`
+	// Properties is the change an OpPatch applies: each key is set to its
+	// value, and null removes the property
+	Properties map[string]json.RawMessage `json:"properties,omitempty"`
 }